@@ -0,0 +1,124 @@
+package beeline
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// KeyType describes which kind of Honeycomb API key the beeline was
+// configured with. The kind of key changes how datasets are chosen.
+type KeyType string
+
+const (
+	// KeyTypeClassic keys belong to a Honeycomb Classic team. Events are sent
+	// to the dataset named in the Config.
+	KeyTypeClassic KeyType = "classic"
+	// KeyTypeEnvironment keys belong to a Honeycomb environment. Events are
+	// sent to a dataset named after the service, and Config.Dataset is
+	// ignored.
+	KeyTypeEnvironment KeyType = "environment"
+)
+
+// defaultServicePrefix is used to build a service name for environment keys
+// when none is configured.
+const defaultServicePrefix = "unknown_service"
+
+// ResolvedConfig describes the settings the beeline is actually using after
+// defaults and API key rules have been applied. Services can inspect it at
+// startup and refuse to run when it isn't what they expect.
+type ResolvedConfig struct {
+	// KeyType is the kind of API key in use.
+	KeyType KeyType
+	// Dataset is the dataset events are sent to, unless overridden per trace
+	// or by an upstream service.
+	Dataset string
+	// ServiceName is the service name added to events. It may be empty for
+	// classic keys.
+	ServiceName string
+	// Warnings lists likely misconfigurations found while resolving the
+	// config, such as a missing write key or a Dataset that was ignored.
+	Warnings []string
+	// Team and Environment are the slugs of the Honeycomb team and
+	// environment the write key belongs to, as Honeycomb reports them when
+	// Config.VerifyAPIKey is set. They are empty until the check, which
+	// Init runs in the background, finishes. Environment is empty for
+	// classic keys.
+	Team        string
+	Environment string
+}
+
+// GetKeyType reports which kind of Honeycomb API key key is. Environment keys
+// are 22 characters long, and environment ingest keys start with "hcxik_" or
+// "hcaik_". Every other key, including an empty one, is treated as classic,
+// matching the beeline's behavior before environments existed.
+func GetKeyType(key string) KeyType {
+	if len(key) == 22 || strings.HasPrefix(key, "hcxik_") || strings.HasPrefix(key, "hcaik_") {
+		return KeyTypeEnvironment
+	}
+	return KeyTypeClassic
+}
+
+// Info returns the resolved configuration of the default beeline.
+func Info() ResolvedConfig {
+	return defaultBeeline.Info()
+}
+
+// Info returns the resolved configuration of this instance.
+func (b *Beeline) Info() ResolvedConfig {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	info := b.info
+	info.Warnings = append([]string(nil), b.info.Warnings...)
+	return info
+}
+
+// resolveConfig applies the dataset and service name rules for the kind of
+// API key in config, filling in defaults. When the caller supplied their own
+// client, the write key and dataset belong to that client and are left alone.
+func resolveConfig(config Config) ResolvedConfig {
+	info := ResolvedConfig{
+		KeyType:     GetKeyType(config.WriteKey),
+		Dataset:     config.Dataset,
+		ServiceName: strings.TrimSpace(config.ServiceName),
+	}
+	if config.Client != nil {
+		bld := config.Client.NewBuilder()
+		info.KeyType = GetKeyType(bld.WriteKey)
+		info.Dataset = bld.Dataset
+		return info
+	}
+	if (config.WriteKey == "" || config.WriteKey == defaultWriteKey) && !config.STDOUT && !config.Mute && !config.DevMode && config.Transmission == nil {
+		info.Warnings = append(info.Warnings, "no WriteKey is set; Honeycomb will reject all events")
+	}
+	if info.KeyType == KeyTypeEnvironment && info.ServiceName == "" {
+		info.ServiceName = fmt.Sprintf("%s:%s", defaultServicePrefix, filepath.Base(os.Args[0]))
+		info.Warnings = append(info.Warnings,
+			fmt.Sprintf("no ServiceName is set; sending events to dataset %q", info.ServiceName))
+	}
+	var warnings []string
+	info.Dataset, warnings = resolveDataset(info.KeyType, config.Dataset, info.ServiceName)
+	info.Warnings = append(info.Warnings, warnings...)
+	if info.Dataset == "" {
+		info.Dataset = defaultDataset
+	}
+	return info
+}
+
+// resolveDataset picks the dataset for the kind of key in use given the
+// requested dataset and service name. Environment keys send to a dataset
+// named after the service and ignore the requested dataset. The result is
+// empty when there is nothing to choose from.
+func resolveDataset(keyType KeyType, dataset, serviceName string) (string, []string) {
+	if keyType != KeyTypeEnvironment {
+		return dataset, nil
+	}
+	serviceName = strings.TrimSpace(serviceName)
+	var warnings []string
+	if dataset != "" && dataset != serviceName {
+		warnings = append(warnings, fmt.Sprintf(
+			"Dataset %q is ignored with an environment API key; events are sent to a dataset named after ServiceName", dataset))
+	}
+	return serviceName, warnings
+}
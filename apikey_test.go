@@ -0,0 +1,54 @@
+package beeline
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetKeyType(t *testing.T) {
+	assert.Equal(t, KeyTypeClassic, GetKeyType(""), "empty keys are treated as classic")
+	assert.Equal(t, KeyTypeClassic, GetKeyType("0123456789abcdef0123456789ABCDEF"), "32 hex characters is a classic key")
+	assert.Equal(t, KeyTypeClassic, GetKeyType("hcaic_1234567890123456789012345678901234567890123456789012345678"), "classic ingest keys are classic")
+	assert.Equal(t, KeyTypeEnvironment, GetKeyType("abcdefghijklmnopqrstuv"), "22 character keys belong to environments")
+	assert.Equal(t, KeyTypeEnvironment, GetKeyType("hcaik_01hqk4k20cjeh63wca8vva5stw70nft6m5n8wr8f5mjx3762s8269j50wc"), "environment ingest keys belong to environments")
+	assert.Equal(t, KeyTypeEnvironment, GetKeyType("hcxik_01hqk4k20cjeh63wca8vva5stw70nft6m5n8wr8f5mjx3762s8269j50wc"), "environment ingest keys belong to environments")
+	assert.Equal(t, KeyTypeClassic, GetKeyType("0123456789abcdef0123456789abcdeg"), "other keys are classic")
+	assert.Equal(t, KeyTypeClassic, GetKeyType("newkey"), "other keys are classic")
+}
+
+func TestResolveConfig(t *testing.T) {
+	info := resolveConfig(Config{WriteKey: "0123456789abcdef0123456789abcdef"})
+	assert.Equal(t, KeyTypeClassic, info.KeyType)
+	assert.Equal(t, defaultDataset, info.Dataset, "classic keys should use the default dataset")
+	assert.Empty(t, info.Warnings)
+
+	info = resolveConfig(Config{WriteKey: "0123456789abcdef0123456789abcdef", Dataset: "mine", ServiceName: "svc"})
+	assert.Equal(t, "mine", info.Dataset, "classic keys should use the configured dataset")
+
+	info = resolveConfig(Config{WriteKey: "abcdefghijklmnopqrstuv", Dataset: "mine", ServiceName: " svc "})
+	assert.Equal(t, KeyTypeEnvironment, info.KeyType)
+	assert.Equal(t, "svc", info.Dataset, "environment keys should use the trimmed service name as the dataset")
+	assert.Equal(t, "svc", info.ServiceName)
+	assert.Len(t, info.Warnings, 1, "the ignored dataset should be reported")
+
+	info = resolveConfig(Config{WriteKey: "abcdefghijklmnopqrstuv"})
+	assert.Contains(t, info.ServiceName, defaultServicePrefix+":", "environment keys without a service name should get a default")
+	assert.Equal(t, info.ServiceName, info.Dataset)
+	assert.Len(t, info.Warnings, 1, "the missing service name should be reported")
+
+	info = resolveConfig(Config{})
+	assert.Len(t, info.Warnings, 1, "a missing write key should be reported")
+	info = resolveConfig(Config{Mute: true})
+	assert.Empty(t, info.Warnings, "a missing write key doesn't matter when muted")
+}
+
+func TestNewWithEnvironmentKey(t *testing.T) {
+	bl := New(Config{WriteKey: "abcdefghijklmnopqrstuv", ServiceName: "svc", Dataset: "ignored", Mute: true})
+	info := bl.Info()
+	assert.Equal(t, "svc", info.Dataset)
+	assert.Equal(t, "svc", bl.Client().NewBuilder().Dataset, "the client should send to the service's dataset")
+	fields := bl.Client().NewBuilder().Fields()
+	assert.Equal(t, "svc", fields["service_name"])
+	assert.Equal(t, "svc", fields["service.name"])
+}
@@ -2,14 +2,21 @@ package beeline
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/honeycombio/libhoney-go/transmission"
 
 	"github.com/honeycombio/beeline-go/client"
+	"github.com/honeycombio/beeline-go/clock"
+	"github.com/honeycombio/beeline-go/logger"
+	"github.com/honeycombio/beeline-go/propagation"
 	"github.com/honeycombio/beeline-go/sample"
+	"github.com/honeycombio/beeline-go/scrub"
+	"github.com/honeycombio/beeline-go/senders"
 	"github.com/honeycombio/beeline-go/trace"
 	libhoney "github.com/honeycombio/libhoney-go"
 )
@@ -28,11 +35,15 @@ type Config struct {
 	// https://ui.honeycomb.io/account. default: apikey-placeholder
 	WriteKey string
 	// Dataset is the name of the Honeycomb dataset to which events will be
-	// sent. default: beeline-go
+	// sent. It is ignored when WriteKey is an environment API key, in which
+	// case events are sent to a dataset named after ServiceName.
+	// default: beeline-go
 	Dataset string
 	// Service Name identifies your application. While optional, setting this
 	// field is extremely valuable when you instrument multiple services. If set
-	// it will be added to all events as `service_name`
+	// it will be added to all events as `service_name`. With an environment API
+	// key it also names the dataset and is added as `service.name`.
+	// default with an environment API key: unknown_service:<program name>
 	ServiceName string
 	// SamplRate is a positive integer indicating the rate at which to sample
 	// events. Default sampling is at the trace level - entire traces will be
@@ -52,25 +63,393 @@ type Config struct {
 	// event before it gets sent to Honeycomb. Does not get invoked if the event
 	// is going to be dropped because of sampling. Runs after the SamplerHook.
 	PresendHook func(map[string]interface{})
+	// SpanNameHook, if set, is called with the name and fields of each span
+	// just before it is sent, and the name it returns replaces the span's
+	// name. Use it to rewrite names centrally, eg to collapse automatic
+	// per-customer handler names into one. Runs before the SamplerHook.
+	SpanNameHook func(name string, fields map[string]interface{}) string
+	// ResponseHook, if set, is called with the result of sending each event,
+	// so applications can alert when Honeycomb rejects or rate limits events.
+	// It runs on a single goroutine that reads the client's responses; while
+	// it's running, later responses queue up and are dropped once the queue
+	// is full, so it shouldn't block. If Client is set, the hook reads that
+	// client's responses, so nothing else should.
+	ResponseHook func(SendResult)
+	// ContextFields maps span field names to context keys. Every span started
+	// from a context holding a value for one of the keys (eg a tenant ID
+	// stored by auth middleware) gets that value as the named field, so it
+	// doesn't have to be added in every handler. Field names are used as
+	// given; they don't get the app. prefix.
+	ContextFields map[string]interface{}
+	// ContextFieldsHook, if set, is called with the context each span is
+	// started from, and the fields it returns are added to the span after
+	// those from ContextFields. It runs for every span, so it should be fast.
+	ContextFieldsHook func(context.Context) map[string]interface{}
+	// Scrubber, if set, removes sensitive data from every event just before
+	// it is sent, after the PresendHook. It applies uniformly to the fields
+	// the wrappers add automatically, such as URLs, queries, and headers, as
+	// well as to fields added by the application. Use scrub.Default() for a
+	// reasonable starting set of rules.
+	Scrubber *scrub.Scrubber
+	// MaxTraceDuration, if positive, is how long a trace may run. When it
+	// expires, any spans in the trace that haven't been sent are sent with
+	// meta.expired set to true, so hung handlers and leaked spans show up in
+	// Honeycomb instead of holding memory forever. Spans sent this way don't
+	// need to be sent again; sending them later does nothing.
+	MaxTraceDuration time.Duration
+	// MaxSpansPerTrace, if positive, caps the number of spans sent for each
+	// trace, protecting memory and event quota from loops that create huge
+	// numbers of spans. Spans created after the cap is reached aren't sent;
+	// instead a single summarized_spans child of the root span counts them
+	// in meta.summarized_span_count and meta.summarized_duration_ms.
+	MaxSpansPerTrace uint
+	// MaxSpanMemory, if positive, is roughly how many bytes the spans that
+	// have been started but not sent may hold, across every trace, before
+	// SpanMemoryPolicy sheds some of them: by default the oldest are sent
+	// early with meta.shed set, finishing the traces whose long-lived root
+	// spans have been accumulating children; trace.ShedDropLowestPriority
+	// discards the fields of the newest spans instead, never roots or spans
+	// with errors. Either way spans given trace.PriorityVerbose go first.
+	// The memory each span holds is estimated from its fields. MemoryStats
+	// reports how much is held and how many spans were shed. Neither can be
+	// changed by Reconfigure.
+	// default: no limit
+	MaxSpanMemory    int64
+	SpanMemoryPolicy trace.ShedPolicy
+	// Clock, if set, replaces time.Now for span start times, timestamps and
+	// durations. NewTraceID and NewSpanID, if set, replace the random trace
+	// and span ID generators. They exist so tests can emit identical events
+	// on every run and compare them against golden files; see
+	// beelinetest.Deterministic. Production code should leave them unset.
+	Clock      func() time.Time
+	NewTraceID func() string
+	NewSpanID  func() string
+	// MonotonicClock, if set, timestamps spans with clock.Monotonic, which
+	// keeps moving forward steadily when the host's clock is stepped, so
+	// spans recorded across a clock sync stay in order. ClockOffset, if
+	// set, is added to span timestamps to correct a host clock known to be
+	// off, so children from skewed hosts don't appear to start before their
+	// parents. NTPServer, if set, eg "time.google.com", is asked for the
+	// time in the background at startup to measure that offset instead;
+	// until it answers, or if it can't be reached, ClockOffset is used. They
+	// are ignored if Clock is set. default: time.Now, uncorrected
+	MonotonicClock bool
+	ClockOffset    time.Duration
+	NTPServer      string
+	// GoroutineLocalSpans turns on the fallback for code that loses its
+	// context.Context: when AddField, AddFields, AddFieldToTrace, or
+	// StartSpan get a context without a span, they use the span bound to the
+	// calling goroutine with Bind, if there is one. Context always wins when
+	// it has a span. It is off by default because it hides lost context.
+	GoroutineLocalSpans bool
+	// CrashSpans makes ReportPanic, as well as writing the IDs of the
+	// panicking goroutine's span to stderr, send a span named crash with
+	// the panic and its stack in panic.value and panic.stack, then send the
+	// rest of the trace and flush the beeline, waiting up to a couple of
+	// seconds, before the panic kills the process. default: false
+	CrashSpans bool
+	// LifecycleEvents, if set, sends a service_start event when the beeline
+	// is created and a service_stop event when it is closed, recording the
+	// Go version the binary was built with, its main module's path and
+	// version, the commit it was built from when go build recorded one, and
+	// a summary of the beeline's settings. Together they mark every deploy
+	// and restart. default: false
+	LifecycleEvents bool
+	// ProfilerLabels, if set, labels goroutines with the trace_id and
+	// span_name of spans started with StartSpan and StartTrace, so CPU
+	// profiles can be sliced by trace and endpoint. The goroutine's previous
+	// labels are restored when the span is sent. See trace.Span.LabelProfiles.
+	ProfilerLabels bool
+	// ExecutionTraceRegions, if set, opens a runtime/trace task and region
+	// named after each span started with StartSpan and StartTrace while an
+	// execution trace is being recorded, so traces captured during an
+	// incident line up with the beeline's spans. See
+	// trace.Span.TraceExecution.
+	ExecutionTraceRegions bool
+	// PropagationFormats are the trace context header formats the wrappers
+	// for outgoing calls, like hnynethttp's round tripper and hnygrpc's
+	// client interceptors, add to requests when they aren't given a
+	// propagation hook. List several to emit them all at once, eg
+	// propagation.FormatHoneycomb and propagation.FormatW3C while
+	// downstream services move from one to the other. Wrappers can be
+	// configured per destination with hooks from the config package.
+	// default: only the Honeycomb header
+	PropagationFormats []propagation.Format
+	// TrustPolicy, if set, decides when the trace context sent with
+	// incoming requests is honored: always, never, only from trusted
+	// networks or requests carrying a trusted header, or only for its trace
+	// ID, starting a new root span. Use it to stop clients from forging
+	// trace context, eg to choose trace IDs that are always sampled. The
+	// HTTP and gRPC wrappers tell it where each request came from. Root
+	// spans of traces whose context wasn't fully honored get
+	// meta.untrusted_trace_context set. default: always honored
+	TrustPolicy *propagation.TrustPolicy
+	// MaxTraceHops, if positive, is the most process boundaries an incoming
+	// trace may have crossed. The Honeycomb header counts them; a trace that
+	// arrives having crossed more starts over as a new trace whose root span
+	// has meta.max_trace_hops_exceeded and meta.previous_trace_id set, so
+	// request loops between services are detectable rather than growing one
+	// trace forever. default: unlimited
+	MaxTraceHops uint
+	// IgnoreEnvTrace stops New from continuing the trace passed in the
+	// HONEYCOMB_TRACE environment variable, propagation.EnvTrace. Processes
+	// started by an instrumented parent, with hnyexec or by setting the
+	// variable with propagation.MarshalEnvTraceContext, otherwise start
+	// their traces as children of the parent's span, so CLI tools and
+	// workers show up in the trace that ran them. Only traces started by
+	// StartSpan and StartSpanWithParent without a parent continue it;
+	// StartTrace and the wrappers for incoming requests don't.
+	// default: the trace in the environment is continued
+	IgnoreEnvTrace bool
+	// OrphanedSpanHook, if set, is called with each synchronous span that
+	// was still unsent when one of its ancestors was sent, and so was sent
+	// by it. Those spans are usually leaks: a missing Send, or a span that
+	// should have been async. They get meta.sent_by_parent, meta.sent_by and
+	// meta.sent_by_name, the ID and name of the span that swept them up, and
+	// meta.unfinished_ms; the hook can count or log them, or add fields of
+	// its own. It runs on the goroutine sending the ancestor, so it should
+	// be quick.
+	OrphanedSpanHook func(trace.OrphanedSpan)
+	// OrphanGoroutineDump, if set, adds a dump of every goroutine's stack
+	// to orphaned spans in meta.orphan_goroutines, and passes it to the
+	// OrphanedSpanHook, showing where the code that should have sent them
+	// is stuck. Taking it stops the world briefly, so it is meant for
+	// hunting leaks rather than for always-on use. default: false
+	OrphanGoroutineDump bool
+	// ErrorReporter, if set, is called with each error recorded on a span,
+	// in a field named error or ending in .error like db.error, as the span
+	// is sent, whether or not it is sampled. It sees the fields as they are
+	// sent, after the PresendHook and Scrubber have run; the Scrubber runs on
+	// spans sampled out too, so secrets don't reach the tracker. Forward them to an error
+	// tracker like Sentry with the trace and span IDs attached to link the
+	// two; ErrorTags does the reverse for errors reported directly. It runs
+	// on the goroutine sending the span, so it should be quick.
+	// default: none
+	ErrorReporter func(trace.SpanError)
+	// ContextDeadlines, if set, records on every span whether the context
+	// it was started with has a deadline, in context.deadline_set, and how
+	// long was left until it in context.deadline_remaining_ms. As each span
+	// is sent, context.cancelled and context.timed_out record whether that
+	// context had been cancelled or had run out of time, so deadline
+	// pressure can be seen throughout a trace rather than only where
+	// deadlines are set. default: false
+	ContextDeadlines bool
+	// OmitBuildInfo, if set, stops the beeline adding fields from the
+	// binary's build info to the root span of every trace it starts:
+	// service.version, the version of the main module when it was built as
+	// a module dependency rather than from a checkout, and build.commit,
+	// the commit it was built from when go build recorded one, as it does by
+	// default since Go 1.18. They let regressions be sliced by the version
+	// deployed. default: false
+	OmitBuildInfo bool
+	// Rollups registers how the values added with AddRollupField to each
+	// key are combined into the rollup.<key> field on the root span. Keys
+	// that aren't registered are summed; others can be counted
+	// (trace.RollupCount), keep their smallest, largest, or mean value
+	// (RollupMin, RollupMax, RollupAvg), or be counted into the buckets of
+	// a histogram (RollupHistogram), which adds a rollup.<key>.le_<bucket>
+	// field for each bucket. For example, {"db.duration_ms": {Kind:
+	// trace.RollupMax}} puts the slowest query on the root span, and adding
+	// 1 or 0 to a RollupAvg key for every cache hit or miss gives the
+	// trace's hit ratio. default: every key is summed
+	Rollups map[string]trace.Rollup
+	// LateChildren decides what StartSpan and the other ways of creating a
+	// child span do when the parent span has already been sent, which
+	// usually means a goroutine outlived the request that started it. Such
+	// children are marked with meta.late. With trace.LateChildKeep they are
+	// children of the sent span, but nothing sends them for you; with
+	// LateChildToRoot they are children of the trace's root span if it is
+	// still open, with meta.late_parent_id set to the sent span's ID; and
+	// with LateChildNewRoot, or LateChildToRoot once the root has been sent
+	// too, they start a new trace with a link back to the sent span.
+	// default: trace.LateChildKeep
+	LateChildren trace.LateChildPolicy
+	// FieldPrefixes renames the namespaces fields are sent with, so field
+	// names can be kept consistent across a fleet whose services don't all
+	// use the same wrappers. Keys are namespaces, the part of a field name
+	// before the first dot, like the db, request, response, handler and
+	// grpc namespaces the wrappers use, or app, the namespace of fields
+	// added with AddField. Values are the prefixes fields in the namespace
+	// are sent with instead, including any trailing dot: {"db": "sql.",
+	// "app": ""} sends db.query as sql.query and app.user_id as user_id.
+	// Fields are renamed before the hooks run, so they see the new names.
+	// The trace and meta namespaces can't be renamed.
+	// default: fields are sent as they are named
+	FieldPrefixes map[string]string
+	// FieldNaming chooses the names fields added by the wrappers are sent
+	// with. trace.FieldNamingSemConv sends the fields that have an
+	// OpenTelemetry semantic convention with its name instead of the
+	// beeline's own, eg http.request.method for request.method and
+	// db.query.text for db.query, and trace.FieldNamingBoth sends them with
+	// both, so queries and dashboards can be moved over a piece at a time
+	// before switching. trace.SemanticConventionNames lists the mapping.
+	// It is applied before FieldPrefixes and the hooks.
+	// default: trace.FieldNamingLegacy
+	FieldNaming trace.FieldNaming
+	// FieldNames adds to and overrides the mapping FieldNaming uses, from
+	// the beeline's field names to the names to send them with as well or
+	// instead. Mapping a field to "" keeps its own name only, eg to keep a
+	// field a dashboard still needs until it is moved over.
+	FieldNames map[string]string
+	// DatasetRoutes send the spans they match to a different dataset than
+	// the rest of the process's spans, eg audit events to a locked-down
+	// dataset, matching on span names, field values, or a function of the
+	// fields. The first route matching a span decides its dataset. Routes
+	// are matched after the PresendHook and Scrubber run, so they see the
+	// fields as they will be sent. default: no routes
+	DatasetRoutes []trace.DatasetRoute
+	// CollapseSpans turn on wide-event mode for the child spans they match,
+	// on names, field values, or a function of the fields: rather than
+	// being sent, they are counted in fields on the root span of their
+	// trace, like collapsed.cache.get.count, .duration_ms and
+	// .max_duration_ms, so chatty instrumentation costs one event per trace
+	// instead of one per span. Only spans without children are collapsed,
+	// and only while the root span is open; spans created later, those with
+	// an error recorded on them, and those given trace.PriorityCritical are
+	// sent as usual. Rules are matched as
+	// spans are sent, before the hooks run. default: no rules
+	CollapseSpans []trace.CollapseRule
+	// CompressSiblings, if at least 2, compresses runs of that many or more
+	// consecutive similar sibling spans, eg a loop making hundreds of redis
+	// GETs: spans without children with the same name and the same field
+	// names, whatever their values. The first span of the run is sent
+	// standing in for them all, lasting until the last one ended, with
+	// meta.compressed_span_count and their total, minimum and maximum
+	// durations in meta.compressed_duration_ms,
+	// meta.compressed_min_duration_ms and meta.compressed_max_duration_ms.
+	// Spans are held back until the run is long enough, or ends when a
+	// different sibling or their parent is sent; async spans, spans with
+	// errors and those given trace.PriorityCritical are never compressed.
+	// Held spans count as open spans for MaxTraceDuration and MaxSpanMemory,
+	// but if their parent is never sent and MaxTraceDuration is unset, they
+	// are never sent either: up to CompressSiblings-1 spans, plus the
+	// Exemplars, for each run. default: 0, no compression
+	CompressSiblings uint
+	// Exemplars is how many of the spans collapsed under each name by
+	// CollapseSpans, or compressed into each span by CompressSiblings, are
+	// sent as they are too, marked with meta.exemplar, so there are real
+	// instances to debug: the slowest of them. They are held until the root
+	// span or the compressed span is sent. default: 0, none
+	Exemplars uint
+	// CorrelationHeaders maps the names of correlation IDs, like request_id
+	// or order_id, to the HTTP or gRPC headers that carry them, eg
+	// {"request_id": "X-Request-ID"}. New traces started by the wrappers for
+	// incoming requests record the IDs found in those headers in the
+	// trace-level fields correlation.<name>, on every span of the trace,
+	// unless the propagated trace context already has them; AddCorrelationID
+	// records others. Outgoing requests made by the wrappers send each ID in
+	// its header as well as in the trace context, so services that don't use
+	// a beeline can log them too. default: none
+	CorrelationHeaders map[string]string
+	// MaxSpanDuration, if positive, is the longest duration a span's clock
+	// may report before the beeline decides the clock was stepped while the
+	// span ran, eg by a VM's clock sync. Durations are measured with the
+	// monotonic clock, which isn't stepped, unless Clock is set; when Clock
+	// reports a negative duration, or one longer than MaxSpanDuration that
+	// the monotonic clock doesn't agree with, the span's duration_ms is the
+	// monotonic measurement instead, with meta.duration_corrected set to
+	// "negative" or "too_long" and the rejected value in
+	// meta.clock_duration_ms. Negative durations are always corrected.
+	// default: no limit
+	MaxSpanDuration time.Duration
 
 	// APIHost is the hostname for the Honeycomb API server to which to send
 	// this event. default: https://api.honeycomb.io/
 	// Not used if client is set
 	APIHost string
+	// VerifyAPIKey, if set, asks Honeycomb at startup whether WriteKey is
+	// accepted and may send events, and which team and environment it
+	// belongs to. Init and New check in the background, recording the team
+	// and environment in Info() and logging an error, also listed in
+	// Info().Warnings, if events sent with the key would be rejected.
+	// InitWithError and ValidateConfig check before returning, and fail if
+	// the key is rejected or Honeycomb can't be reached. default: false
+	// Not used if client or Transmission is set
+	VerifyAPIKey bool
+	// ProxyURL, if set, is the URL of the HTTP(S) or SOCKS5 proxy through
+	// which events are sent, eg "http://proxy.internal:3128". Credentials
+	// may be included in the URL. If this or the TLS and timeout settings
+	// below are invalid (eg a certificate file can't be read), events are
+	// dropped rather than sent around the proxy or without the certificates;
+	// the error is logged with the standard log package and listed in
+	// Info().Warnings. default: the HTTPS_PROXY and NO_PROXY environment
+	// variables
+	// Not used if client or Transmission is set
+	ProxyURL string
+	// CACertFile, if set, is the path of a PEM file with the certificate
+	// authorities trusted when connecting to APIHost or the proxy, replacing
+	// the system's. Useful behind proxies that intercept TLS.
+	// Not used if client or Transmission is set
+	CACertFile string
+	// ClientCertFile and ClientKeyFile, if set, are the paths of a PEM
+	// certificate and key presented to the server, for networks that require
+	// mutual TLS. Both must be set.
+	// Not used if client or Transmission is set
+	ClientCertFile string
+	ClientKeyFile  string
+	// TLSConfig, if set, is the base TLS configuration for connections,
+	// with the certificates from the files above added to a copy of it.
+	// Not used if client or Transmission is set
+	TLSConfig *tls.Config
+	// DialTimeout and TLSHandshakeTimeout limit how long connecting to the
+	// API may take. defaults: 30s and 10s
+	// Not used if client or Transmission is set
+	DialTimeout         time.Duration
+	TLSHandshakeTimeout time.Duration
+
+	// Transmission, if set, replaces the sender that delivers events to
+	// Honeycomb over HTTPS. The senders package has implementations that
+	// export OTLP over gRPC or HTTP and that write events to a file; any other
+	// implementation of transmission.Sender may also be used. The batching
+	// settings below only apply to the default sender.
+	// Not used if client is set
+	Transmission transmission.Sender
 	// STDOUT when set to true will print events to STDOUT *instead* of sending
-	// them to honeycomb; useful for development. default: false
+	// them to honeycomb; useful for development. Overrides Transmission.
+	// default: false
 	// Not used if client is set
 	STDOUT bool
 	// Mute when set to true will disable Honeycomb entirely; useful for tests
-	// and CI. default: false
+	// and CI. Overrides Transmission, STDOUT, and DevMode. default: false
 	// Not used if client is set
 	Mute bool
-	// Debug will emit verbose logging to STDOUT when true. If you're having
+	// DevMode when set to true prints each completed trace to stderr as an
+	// indented tree of spans with their durations and key fields *instead* of
+	// sending it to Honeycomb, so no write key is needed during local
+	// development. See senders.ConsoleSender. Overrides Transmission and
+	// STDOUT. default: false
+	// Not used if client is set
+	DevMode bool
+	// SpoolDir, if set, is a directory where events are saved when they can't
+	// be sent, eg during a network outage, and from which they are retried
+	// later. See senders.SpoolingSender for details; use it directly as the
+	// Transmission to change the spool's limits. Not used with STDOUT or
+	// Mute. default: events that can't be sent are dropped
+	// Not used if client is set
+	SpoolDir string
+	// CaptureFile, if set, is a file to which every outgoing event is also
+	// appended as a line of JSON, whether or not it is sent, so events can be
+	// sent again later with senders.Replay. Combine it with Mute to capture
+	// events without sending them, eg in an air-gapped environment. See
+	// senders.CapturingSender. default: events aren't captured
+	// Not used if client is set
+	CaptureFile string
+	// Debug will emit verbose logging when true. If you're having
 	// trouble getting the beeline to work, set this to true in a dev
 	// environment.
 	Debug bool
+	// Logger, if set, receives the beeline's own diagnostics: configuration
+	// warnings, send errors, and with Debug the result of each send and
+	// libhoney's logging. The logger package has adapters for zap, logrus,
+	// zerolog, and slog. default: errors, and with Debug everything else, are
+	// printed with the standard log package
+	Logger logger.Logger
 	// MaxBatchSize, if set, will override the default number of events
-	// (libhoney.DefaultMaxBatchSize) that are sent per batch.
+	// (libhoney.DefaultMaxBatchSize) that are sent per batch. A full batch
+	// is sent right away, so at high event rates larger batches mean fewer
+	// requests; libhoney also splits batches that would be too large for
+	// Honeycomb to accept. BenchmarkTransmission in the benchmarks package
+	// compares settings.
 	// Not used if client is set
 	MaxBatchSize uint
 	// BatchTimeout, if set, will override the default time (libhoney.DefaultBatchTimeout)
@@ -79,28 +458,200 @@ type Config struct {
 	BatchTimeout time.Duration
 	// MaxConcurrentBatches, if set, will override the default number of
 	// goroutines (libhoney.DefaultMaxConcurrentBatches) that are used to send batches of events in parallel.
+	// Raise it if sending falls behind because each request is slow.
 	// Not used if client is set
 	MaxConcurrentBatches uint
 	// PendingWorkCapacity overrides the default event queue size (libhoney.DefaultPendingWorkCapacity).
-	// If the queue is full, events will be dropped.
+	// If the queue is full, events are handled according to OverflowPolicy.
 	// Not used if client is set
 	PendingWorkCapacity uint
+	// DisableCompression turns off gzip compression of batches sent to
+	// Honeycomb, trading bandwidth for CPU.
+	// Not used if client or Transmission is set
+	DisableCompression bool
+	// OverflowPolicy chooses what happens to events when the queue is full
+	// or when sending has been paused because the API keeps failing: drop
+	// new events, drop the oldest queued ones, block the caller for up to
+	// OverflowBlockTimeout, or automatically raise the sample rate. Setting
+	// any policy other than the default queues events in a
+	// senders.BackpressureSender, whose circuit breaker also pauses sending
+	// while the API keeps failing, and Stats reports its queue depth and
+	// drops. With the default, events go straight to libhoney, which drops
+	// new events when its queue is full.
+	// default: senders.OverflowDropNew
+	// Not used if client is set, or with STDOUT or Mute
+	OverflowPolicy senders.OverflowPolicy
+	// OverflowBlockTimeout is the longest time senders.OverflowBlock waits
+	// for room in the queue. default: 100ms
+	OverflowBlockTimeout time.Duration
 
 	// Client, if specified, allows overriding the default client used to send events to Honeycomb
 	// If set, overrides many fields in this config - see descriptions
 	Client *libhoney.Client
 }
 
+// Beeline is an instance of the beeline with its own libhoney client, sampler,
+// and hooks. Most applications only need the single instance configured by
+// Init and used by the package-level functions; create additional instances
+// with New when a library, test, or multi-tenant process needs to send events
+// with a different configuration (eg a separate write key) without touching
+// global state.
+type Beeline struct {
+	client *libhoney.Client
+	// global is set on the instance created by Init, whose client and hooks
+	// are stored in the client and trace packages for use by the wrappers.
+	global bool
+
+	// lock guards the settings below, which may be changed by Reconfigure.
+	lock        sync.RWMutex
+	traceConfig *trace.Config
+	// writeKey and dataset, when set, override the client's own values
+	writeKey string
+	dataset  string
+	// info describes the settings in use; initInfo is what New resolved
+	info     ResolvedConfig
+	initInfo ResolvedConfig
+	// initConfig is the config given to New, whose settings Reconfigure
+	// falls back to
+	initConfig Config
+
+	// logger receives diagnostics
+	logger logger.Logger
+	// goroutineLocal is set if spans bound with Bind are used when a context
+	// has no span
+	goroutineLocal bool
+	// crashSpans is set if ReportPanic sends a crash span
+	crashSpans bool
+	// lifecycle is set if service_start and service_stop events are sent,
+	// and started is when the service_start event was
+	lifecycle bool
+	started   time.Time
+	// memory limits the memory held by open spans, if MaxSpanMemory was
+	// given
+	memory *trace.MemoryBudget
+
+	// sender queues events for the transmission; nil unless a non-default
+	// OverflowPolicy was given
+	sender *senders.BackpressureSender
+	// capture is closed with the beeline if events are being captured
+	capture *senders.CapturingSender
+	// flusher is the client's outermost sender, which FlushFinished flushes;
+	// nil if the client was passed in
+	flusher *flushingSender
+	// envTrace is the trace context passed in the environment, which new
+	// traces continue; nil if there was none or IgnoreEnvTrace is set
+	envTrace *propagation.PropagationContext
+}
+
+// defaultBeeline is the instance used by the package-level functions. Until
+// Init is called it uses the unconfigured global client.
+var defaultBeeline = &Beeline{global: true}
+
+// appKeys names the fields added with AddField and its friends.
+var appKeys = trace.NewKeyPrefix("app.")
+
 // Init intializes the honeycomb instrumentation library.
 func Init(config Config) {
+	b := New(config)
+	b.global = true
+	client.Set(b.client)
+
+	globalConfig := trace.GlobalConfig
+	// drop any sampler left behind by Reconfigure in favor of the global one
+	globalConfig.Sampler = nil
+	// Use the sampler hook if it's defined, otherwise a deterministic sampler
+	if config.SamplerHook != nil {
+		globalConfig.SamplerHook = config.SamplerHook
+	} else if b.traceConfig.Sampler != nil {
+		// set a global sampler so sending traces can use it without
+		// threading it through
+		sample.GlobalSampler = b.traceConfig.Sampler
+	}
+
+	if config.PresendHook != nil {
+		globalConfig.PresendHook = config.PresendHook
+	}
+	if config.SpanNameHook != nil {
+		globalConfig.SpanNameHook = config.SpanNameHook
+	}
+	globalConfig.ContextFields = b.traceConfig.ContextFields
+	globalConfig.Scrubber = config.Scrubber
+	globalConfig.MaxTraceDuration = config.MaxTraceDuration
+	globalConfig.MaxSpansPerTrace = config.MaxSpansPerTrace
+	globalConfig.Clock = config.Clock
+	globalConfig.NewTraceID = config.NewTraceID
+	globalConfig.NewSpanID = config.NewSpanID
+	globalConfig.ProfilerLabels = config.ProfilerLabels
+	globalConfig.ExecutionTraceRegions = config.ExecutionTraceRegions
+	globalConfig.PropagationFormats = config.PropagationFormats
+	globalConfig.TrustPolicy = config.TrustPolicy
+	globalConfig.MaxTraceHops = config.MaxTraceHops
+	globalConfig.OrphanedSpanHook = config.OrphanedSpanHook
+	globalConfig.OrphanGoroutineDump = config.OrphanGoroutineDump
+	globalConfig.Rollups = config.Rollups
+	globalConfig.LateChildren = config.LateChildren
+	globalConfig.FieldPrefixes = config.FieldPrefixes
+	globalConfig.FieldNaming = config.FieldNaming
+	globalConfig.FieldNames = config.FieldNames
+	globalConfig.DatasetRoutes = config.DatasetRoutes
+	globalConfig.CollapseSpans = config.CollapseSpans
+	globalConfig.CompressSiblings = config.CompressSiblings
+	globalConfig.Exemplars = config.Exemplars
+	globalConfig.CorrelationHeaders = config.CorrelationHeaders
+	globalConfig.MaxSpanDuration = config.MaxSpanDuration
+	globalConfig.ErrorReporter = config.ErrorReporter
+	globalConfig.ContextDeadlines = config.ContextDeadlines
+	globalConfig.RootFields = b.traceConfig.RootFields
+	globalConfig.MemoryBudget = b.traceConfig.MemoryBudget
+	trace.SetGlobalConfig(globalConfig)
+	defaultBeeline = b
+	return
+}
+
+// InitWithError is like Init, but checks config with ValidateConfig first,
+// returning what it finds wrong instead of starting a beeline that silently
+// drops events. Services that can't do without their telemetry can refuse to
+// start:
+//
+//	if err := beeline.InitWithError(config); err != nil {
+//		log.Fatal(err)
+//	}
+func InitWithError(config Config) error {
+	auth, err := validateConfig(config)
+	if err != nil {
+		return err
+	}
+	// the key has just been checked
+	config.VerifyAPIKey = false
+	Init(config)
+	b := defaultBeeline
+	b.lock.Lock()
+	b.setAuthLocked(auth)
+	b.lock.Unlock()
+	return nil
+}
+
+// New creates a Beeline instance independent of the one configured by Init.
+// Traces started from the returned instance are sent with its own client and
+// use its own sampler and hooks. Config is interpreted the same way as it is
+// by Init.
+func New(config Config) *Beeline {
 	userAgentAddition := fmt.Sprintf("beeline/%s", version)
+	var clockOffset *clock.Offset
+	if config.Clock == nil && (config.MonotonicClock || config.ClockOffset != 0 || config.NTPServer != "") {
+		config.Clock, clockOffset = newClock(config)
+	}
+	initConfig := config
+	backpressure := !config.STDOUT && !config.Mute && !config.DevMode && config.OverflowPolicy != senders.OverflowDropNew
 
+	info := resolveConfig(config)
+	if config.Client == nil {
+		config.Dataset = info.Dataset
+		config.ServiceName = info.ServiceName
+	}
 	if config.WriteKey == "" {
 		config.WriteKey = defaultWriteKey
 	}
-	if config.Dataset == "" {
-		config.Dataset = defaultDataset
-	}
 	if config.SampleRate == 0 {
 		config.SampleRate = defaultSampleRate
 	}
@@ -117,81 +668,480 @@ func Init(config Config) {
 		config.PendingWorkCapacity = libhoney.DefaultPendingWorkCapacity
 	}
 	if config.Client == nil {
-		var tx transmission.Sender
+		info.Warnings = append(info.Warnings, validateBatching(&config)...)
+	}
+	b := &Beeline{
+		client:      config.Client,
+		traceConfig: newTraceConfig(config),
+		info:        info,
+		initInfo:    info,
+		initConfig:  initConfig,
+		logger:      config.Logger,
+
+		goroutineLocal: config.GoroutineLocalSpans,
+		crashSpans:     config.CrashSpans,
+		lifecycle:      config.LifecycleEvents,
+	}
+	if config.MaxSpanMemory > 0 {
+		b.memory = trace.NewMemoryBudget(config.MaxSpanMemory, config.SpanMemoryPolicy)
+		b.traceConfig.MemoryBudget = b.memory
+	}
+	if b.logger == nil {
+		b.logger = logger.Std{Verbose: config.Debug}
+	}
+	if !config.IgnoreEnvTrace {
+		prop, err := propagation.UnmarshalEnvTraceContext(os.Environ())
+		if err != nil {
+			info.Warnings = append(info.Warnings, fmt.Sprintf("ignoring the trace context in %s: %v", propagation.EnvTrace, err))
+			b.info, b.initInfo = info, info
+		}
+		b.envTrace = prop
+	}
+	for _, w := range info.Warnings {
+		b.logger.Warn("beeline configuration warning", "warning", w)
+	}
+	if b.client == nil {
+		tx := config.Transmission
 		if config.STDOUT == true {
 			tx = &transmission.WriterSender{}
 		}
+		if config.DevMode {
+			tx = senders.NewConsoleSender(os.Stderr)
+		}
 		if config.Mute == true {
 			tx = &transmission.DiscardSender{}
 		}
 		if tx == nil {
-			tx = &transmission.Honeycomb{
+			hny := &transmission.Honeycomb{
 				MaxBatchSize:         config.MaxBatchSize,
 				BatchTimeout:         config.BatchTimeout,
 				MaxConcurrentBatches: config.MaxConcurrentBatches,
 				PendingWorkCapacity:  config.PendingWorkCapacity,
 				UserAgentAddition:    userAgentAddition,
+				DisableCompression:   config.DisableCompression,
+				// the backpressure sender below decides what to drop
+				BlockOnSend: backpressure,
+			}
+			tx = hny
+			if hasTransportConfig(config) {
+				transport, err := newTransport(config)
+				if err == nil {
+					hny.Transport = transport
+				} else {
+					b.logger.Error("dropping all events; the transport settings are invalid", "error", err)
+					b.info.Warnings = append(b.info.Warnings, fmt.Sprintf("dropping all events: %v", err))
+					b.initInfo = b.info
+					tx = &transmission.DiscardSender{}
+				}
+			}
+		}
+		if backpressure {
+			b.sender = senders.NewBackpressureSender(tx, senders.BackpressureConfig{
+				Policy:       config.OverflowPolicy,
+				QueueSize:    config.PendingWorkCapacity,
+				BlockTimeout: config.OverflowBlockTimeout,
+			})
+			tx = b.sender
+		}
+		if config.SpoolDir != "" && !config.STDOUT && !config.Mute && !config.DevMode {
+			// spool outside the backpressure sender so events it drops
+			// are saved too
+			spooled, err := senders.NewSpoolingSender(tx, senders.SpoolConfig{Dir: config.SpoolDir})
+			if err == nil {
+				tx = spooled
+			} else {
+				b.logger.Warn("not spooling events", "error", err)
+				b.info.Warnings = append(b.info.Warnings, fmt.Sprintf("not spooling events: %v", err))
+				b.initInfo = b.info
+			}
+		}
+		if config.CaptureFile != "" {
+			// capture outside everything else so events dropped or spooled
+			// on the way are captured too
+			capture, err := senders.NewCapturingSender(tx, config.CaptureFile)
+			if err == nil {
+				tx = capture
+				b.capture = capture
+			} else {
+				b.logger.Warn("not capturing events", "error", err)
+				b.info.Warnings = append(b.info.Warnings, fmt.Sprintf("not capturing events: %v", err))
+				b.initInfo = b.info
 			}
 		}
+		b.flusher = &flushingSender{Sender: tx}
 		clientConfig := libhoney.ClientConfig{
 			APIKey:       config.WriteKey,
 			Dataset:      config.Dataset,
-			Transmission: tx,
+			Transmission: b.flusher,
 		}
 		if config.APIHost != "" {
 			clientConfig.APIHost = config.APIHost
 		}
 		if config.Debug {
-			clientConfig.Logger = &libhoney.DefaultLogger{}
+			clientConfig.Logger = logger.Printf{Logger: b.logger}
 		}
-		c, _ := libhoney.NewClient(clientConfig)
-		client.Set(c)
-	} else {
-		client.Set(config.Client)
+		b.client, _ = libhoney.NewClient(clientConfig)
 	}
 
-	client.AddField("meta.beeline_version", version)
+	b.client.AddField("meta.beeline_version", version)
 	// add a bunch of fields
 	if config.ServiceName != "" {
-		client.AddField("service_name", config.ServiceName)
+		b.client.AddField("service_name", config.ServiceName)
+	}
+	if info.KeyType == KeyTypeEnvironment && info.ServiceName != "" {
+		b.client.AddField("service.name", info.ServiceName)
 	}
 	if hostname, err := os.Hostname(); err == nil {
-		client.AddField("meta.local_hostname", hostname)
+		b.client.AddField("meta.local_hostname", hostname)
 	}
 
-	if config.Debug {
-		// TODO add more debugging than just the responses queue
-		go readResponses(client.TxResponses())
+	if config.ResponseHook != nil || config.Debug {
+		var debug logger.Logger
+		if config.Debug {
+			// TODO add more debugging than just the responses queue
+			debug = b.logger
+		}
+		go handleResponses(b.client.TxResponses(), config.ResponseHook, debug)
+	}
+	if clockOffset != nil && config.NTPServer != "" {
+		go func() {
+			if err := clockOffset.SyncNTP(config.NTPServer, ntpTimeout); err != nil {
+				b.logger.Warn("couldn't measure the clock offset", "server", config.NTPServer, "error", err)
+			}
+		}()
+	}
+	if config.VerifyAPIKey && sendsToHoneycomb(config) && config.WriteKey != defaultWriteKey {
+		go b.preflight(config)
 	}
+	if b.lifecycle {
+		b.sendServiceStart(config)
+	}
+	return b
+}
 
-	// Use the sampler hook if it's defined, otherwise a deterministic sampler
-	if config.SamplerHook != nil {
-		trace.GlobalConfig.SamplerHook = config.SamplerHook
-	} else {
-		// configure and set a global sampler so sending traces can use it
-		// without threading it through
-		sampler, err := sample.NewDeterministicSampler(config.SampleRate)
+// newTraceConfig builds the hooks and sampler described by config.
+func newTraceConfig(config Config) *trace.Config {
+	cfg := &trace.Config{
+		SamplerHook:      config.SamplerHook,
+		PresendHook:      config.PresendHook,
+		SpanNameHook:     config.SpanNameHook,
+		ContextFields:    contextFieldsHook(config.ContextFields, config.ContextFieldsHook),
+		Scrubber:         config.Scrubber,
+		MaxTraceDuration: config.MaxTraceDuration,
+		MaxSpansPerTrace: config.MaxSpansPerTrace,
+		Clock:            config.Clock,
+		NewTraceID:       config.NewTraceID,
+		NewSpanID:        config.NewSpanID,
+		ProfilerLabels:   config.ProfilerLabels,
+
+		ExecutionTraceRegions: config.ExecutionTraceRegions,
+		PropagationFormats:    config.PropagationFormats,
+		TrustPolicy:           config.TrustPolicy,
+		MaxTraceHops:          config.MaxTraceHops,
+		OrphanedSpanHook:      config.OrphanedSpanHook,
+		OrphanGoroutineDump:   config.OrphanGoroutineDump,
+		Rollups:               config.Rollups,
+		LateChildren:          config.LateChildren,
+		FieldPrefixes:         config.FieldPrefixes,
+		FieldNaming:           config.FieldNaming,
+		FieldNames:            config.FieldNames,
+		DatasetRoutes:         config.DatasetRoutes,
+		CollapseSpans:         config.CollapseSpans,
+		CompressSiblings:      config.CompressSiblings,
+		Exemplars:             config.Exemplars,
+		CorrelationHeaders:    config.CorrelationHeaders,
+		MaxSpanDuration:       config.MaxSpanDuration,
+		ErrorReporter:         config.ErrorReporter,
+		ContextDeadlines:      config.ContextDeadlines,
+		RootFields:            rootBuildFields(config),
+	}
+	if config.SamplerHook == nil {
+		sampleRate := config.SampleRate
+		if sampleRate == 0 {
+			sampleRate = defaultSampleRate
+		}
+		sampler, err := sample.NewDeterministicSampler(sampleRate)
 		if err == nil {
-			sample.GlobalSampler = sampler
+			cfg.Sampler = sampler
 		}
 	}
+	return cfg
+}
 
-	if config.PresendHook != nil {
-		trace.GlobalConfig.PresendHook = config.PresendHook
+// Reconfigure changes the settings of the default beeline without restarting
+// the process. It is safe to call while requests are being traced, so it may
+// be driven by a feature flag or a loop watching a config file. Traces already
+// in progress finish with the settings they started with, so a sample rate
+// change never splits a trace.
+//
+// The settings that can be changed are the write key, dataset, and
+// ServiceName (which names the dataset when an environment API key is in
+// use); the sample rate; the hooks, ContextFields, Scrubber, Clock, and ID
+// generators; and the PropagationFormats, TrustPolicy, Rollups,
+// FieldPrefixes, FieldNames, DatasetRoutes, CollapseSpans, and
+// CorrelationHeaders. Empty ones fall back to the value given to Init (or its
+// default), so a later call undoes the changes of an earlier one unless it
+// repeats them.
+//
+// Settings that a zero value turns off can't be told apart from ones left
+// empty, so they keep the values given to Init: the switches like
+// ProfilerLabels and ContextDeadlines, the limits like MaxTraceDuration and
+// MaxSpansPerTrace, and LateChildren, FieldNaming, CompressSiblings, and
+// Exemplars. So do the fields of config that control how the client sends
+// events.
+func Reconfigure(config Config) {
+	defaultBeeline.Reconfigure(config)
+}
+
+// Reconfigure changes the settings of this instance while it is in use. See
+// the package-level Reconfigure for details.
+func (b *Beeline) Reconfigure(config Config) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	config = mergeConfig(config, b.initConfig)
+	traceConfig := newTraceConfig(config)
+	traceConfig.MemoryBudget = b.memory
+
+	// the dataset rules depend on the kind of key that will be in use
+	info := b.initInfo
+	info.Warnings = nil
+	if config.WriteKey != "" {
+		info.KeyType = GetKeyType(config.WriteKey)
 	}
-	return
+	if config.WriteKey != b.initConfig.WriteKey {
+		// they were reported for the old key
+		info.Team = ""
+		info.Environment = ""
+	}
+	dataset, warnings := resolveDataset(info.KeyType, config.Dataset, config.ServiceName)
+	if dataset != "" {
+		info.Dataset = dataset
+	}
+	info.Warnings = warnings
+
+	b.traceConfig = traceConfig
+	b.writeKey = config.WriteKey
+	b.dataset = dataset
+	b.info = info
+	if b.global {
+		client.SetDefaults(config.WriteKey, dataset)
+		trace.SetGlobalConfig(*traceConfig)
+	}
+}
+
+// mergeConfig returns config with the settings used by Reconfigure that it
+// leaves empty taken from base, and those it can't change set to base's.
+func mergeConfig(config, base Config) Config {
+	if config.WriteKey == "" {
+		config.WriteKey = base.WriteKey
+	}
+	if config.Dataset == "" {
+		config.Dataset = base.Dataset
+	}
+	if config.ServiceName == "" {
+		config.ServiceName = base.ServiceName
+	}
+	if config.SampleRate == 0 {
+		config.SampleRate = base.SampleRate
+	}
+	if config.SamplerHook == nil {
+		config.SamplerHook = base.SamplerHook
+	}
+	if config.PresendHook == nil {
+		config.PresendHook = base.PresendHook
+	}
+	if config.SpanNameHook == nil {
+		config.SpanNameHook = base.SpanNameHook
+	}
+	if config.ContextFields == nil {
+		config.ContextFields = base.ContextFields
+	}
+	if config.ContextFieldsHook == nil {
+		config.ContextFieldsHook = base.ContextFieldsHook
+	}
+	if config.Scrubber == nil {
+		config.Scrubber = base.Scrubber
+	}
+	if config.Clock == nil {
+		config.Clock = base.Clock
+	}
+	if config.NewTraceID == nil {
+		config.NewTraceID = base.NewTraceID
+	}
+	if config.NewSpanID == nil {
+		config.NewSpanID = base.NewSpanID
+	}
+	if config.PropagationFormats == nil {
+		config.PropagationFormats = base.PropagationFormats
+	}
+	if config.TrustPolicy == nil {
+		config.TrustPolicy = base.TrustPolicy
+	}
+	if config.OrphanedSpanHook == nil {
+		config.OrphanedSpanHook = base.OrphanedSpanHook
+	}
+	if config.Rollups == nil {
+		config.Rollups = base.Rollups
+	}
+	if config.FieldPrefixes == nil {
+		config.FieldPrefixes = base.FieldPrefixes
+	}
+	if config.FieldNames == nil {
+		config.FieldNames = base.FieldNames
+	}
+	if config.DatasetRoutes == nil {
+		config.DatasetRoutes = base.DatasetRoutes
+	}
+	if config.CollapseSpans == nil {
+		config.CollapseSpans = base.CollapseSpans
+	}
+	if config.CorrelationHeaders == nil {
+		config.CorrelationHeaders = base.CorrelationHeaders
+	}
+	if config.ErrorReporter == nil {
+		config.ErrorReporter = base.ErrorReporter
+	}
+
+	// zero turns these off, so an empty field can't mean "keep it"
+	config.MaxTraceDuration = base.MaxTraceDuration
+	config.MaxSpansPerTrace = base.MaxSpansPerTrace
+	config.MaxTraceHops = base.MaxTraceHops
+	config.MaxSpanDuration = base.MaxSpanDuration
+	config.ProfilerLabels = base.ProfilerLabels
+	config.ExecutionTraceRegions = base.ExecutionTraceRegions
+	config.OrphanGoroutineDump = base.OrphanGoroutineDump
+	config.LateChildren = base.LateChildren
+	config.FieldNaming = base.FieldNaming
+	config.CompressSiblings = base.CompressSiblings
+	config.Exemplars = base.Exemplars
+	config.ContextDeadlines = base.ContextDeadlines
+	config.OmitBuildInfo = base.OmitBuildInfo
+	return config
+}
+
+// ntpTimeout bounds the request made to Config.NTPServer.
+const ntpTimeout = 5 * time.Second
+
+// newClock builds the clock described by the MonotonicClock, ClockOffset,
+// and NTPServer settings in config, returning the offset it is corrected by.
+func newClock(config Config) (func() time.Time, *clock.Offset) {
+	now := time.Now
+	if config.MonotonicClock {
+		now = clock.Monotonic()
+	}
+	if config.ClockOffset == 0 && config.NTPServer == "" {
+		return now, nil
+	}
+	offset := &clock.Offset{}
+	offset.Set(config.ClockOffset)
+	return clock.WithOffset(now, offset), offset
+}
+
+// contextFieldsHook combines the ContextFields and ContextFieldsHook settings
+// into a single function, or returns nil if neither is set.
+func contextFieldsHook(keys map[string]interface{}, hook func(context.Context) map[string]interface{}) func(context.Context) map[string]interface{} {
+	if len(keys) == 0 {
+		return hook
+	}
+	// copy the keys so later changes to the caller's map aren't seen
+	fieldKeys := make(map[string]interface{}, len(keys))
+	for name, key := range keys {
+		fieldKeys[name] = key
+	}
+	return func(ctx context.Context) map[string]interface{} {
+		fields := make(map[string]interface{})
+		for name, key := range fieldKeys {
+			if v := ctx.Value(key); v != nil {
+				fields[name] = v
+			}
+		}
+		if hook != nil {
+			for k, v := range hook(ctx) {
+				fields[k] = v
+			}
+		}
+		return fields
+	}
+}
+
+// Client returns the libhoney client this instance uses to send events.
+func (b *Beeline) Client() *libhoney.Client {
+	if b.global {
+		return client.Get()
+	}
+	return b.client
+}
+
+// TraceOptions returns the options that tie a new trace to this instance. Pass
+// them to trace.NewTraceFromPropagationContext when creating traces directly
+// instead of through StartSpan or StartTrace.
+func (b *Beeline) TraceOptions() []trace.Option {
+	if b.global {
+		// the instance created by Init keeps its settings in the client and
+		// trace packages, which traces use by default
+		return nil
+	}
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	opts := []trace.Option{trace.WithConfig(b.traceConfig)}
+	if b.writeKey == "" && b.dataset == "" {
+		return append(opts, trace.WithClient(b.client))
+	}
+	bld := b.client.NewBuilder()
+	if b.writeKey != "" {
+		bld.WriteKey = b.writeKey
+	}
+	if b.dataset != "" {
+		bld.Dataset = b.dataset
+	}
+	return append(opts, trace.WithBuilder(bld))
+}
+
+// Stats reports the depth of the default beeline's send queue and counts of
+// events sent and dropped. It is empty unless Config.OverflowPolicy chose a
+// policy other than the default, since libhoney's own queue isn't visible.
+func Stats() senders.Stats {
+	return defaultBeeline.Stats()
+}
+
+// Stats reports on this instance's send queue. See the package-level Stats.
+func (b *Beeline) Stats() senders.Stats {
+	if b.sender == nil {
+		return senders.Stats{}
+	}
+	return b.sender.Stats()
+}
+
+// MemoryStats reports the memory held by the default beeline's open spans
+// and how many were shed to keep it under Config.MaxSpanMemory. It is empty
+// unless MaxSpanMemory was set.
+func MemoryStats() trace.MemoryStats {
+	return defaultBeeline.MemoryStats()
+}
+
+// MemoryStats reports on this instance's open spans. See the package-level
+// MemoryStats.
+func (b *Beeline) MemoryStats() trace.MemoryStats {
+	return b.memory.Stats()
 }
 
 // Flush sends any pending events to Honeycomb. This is optional; events will be
 // flushed on a timer otherwise. It is useful to flush before AWS Lambda
 // functions finish to ensure events get sent before AWS freezes the function.
-// Flush implicitly ends all currently active spans.
+// Flush implicitly ends all currently active spans. Use FlushFinished instead
+// to send the spans finished so far while leaving the trace open.
 func Flush(ctx context.Context) {
+	defaultBeeline.Flush(ctx)
+}
+
+// Flush sends the trace in ctx and any pending events from this instance. See
+// the package-level Flush for details.
+func (b *Beeline) Flush(ctx context.Context) {
 	tr := trace.GetTraceFromContext(ctx)
 	if tr != nil {
 		tr.Send()
 	}
-	client.Flush()
+	b.flushEvents()
 }
 
 // Close shuts down the beeline. Closing does not send any pending traces but
@@ -199,7 +1149,23 @@ func Flush(ctx context.Context) {
 // It is optional to close the beeline, and prohibited to try and send an event
 // after the beeline has been closed.
 func Close() {
-	client.Close()
+	defaultBeeline.Close()
+}
+
+// Close shuts down this instance's client. See the package-level Close for
+// details.
+func (b *Beeline) Close() {
+	if b.lifecycle {
+		b.sendServiceStop()
+	}
+	if b.global {
+		client.Close()
+	} else {
+		b.client.Close()
+	}
+	if b.capture != nil {
+		b.capture.Close()
+	}
 }
 
 // AddField allows you to add a single field to an event anywhere downstream of
@@ -209,10 +1175,16 @@ func Close() {
 // add.This function is good for span-level data, eg timers or the arguments to
 // a specific function call, etc. Fields added here are prefixed with `app.`
 func AddField(ctx context.Context, key string, val interface{}) {
-	span := trace.GetSpanFromContext(ctx)
+	defaultBeeline.AddField(ctx, key, val)
+}
+
+// AddField adds a field to the span in ctx. See the package-level AddField for
+// details.
+func (b *Beeline) AddField(ctx context.Context, key string, val interface{}) {
+	span := b.spanFromContext(ctx)
 	if span != nil {
 		if val != nil {
-			namespacedKey := fmt.Sprintf("app.%s", key)
+			namespacedKey := appKeys.Key(key)
 			if valErr, ok := val.(error); ok {
 				// treat errors specially because it's a pain to have to
 				// remember to stringify them
@@ -224,6 +1196,33 @@ func AddField(ctx context.Context, key string, val interface{}) {
 	}
 }
 
+// AddFields adds all of fields to the span in ctx at once, prefixed with
+// `app.` like AddField. Unlike calling AddField in a loop, hooks and
+// concurrent senders never see only some of the fields.
+func AddFields(ctx context.Context, fields map[string]interface{}) {
+	defaultBeeline.AddFields(ctx, fields)
+}
+
+// AddFields adds fields to the span in ctx. See the package-level AddFields
+// for details.
+func (b *Beeline) AddFields(ctx context.Context, fields map[string]interface{}) {
+	span := b.spanFromContext(ctx)
+	if span == nil {
+		return
+	}
+	namespaced := make(map[string]interface{}, len(fields))
+	for k, v := range fields {
+		if v == nil {
+			continue
+		}
+		if valErr, ok := v.(error); ok {
+			v = valErr.Error()
+		}
+		namespaced[appKeys.Key(k)] = v
+	}
+	span.AddFields(namespaced)
+}
+
 // AddFieldToTrace adds the field to both the currently active span and all
 // other spans involved in this trace that occur within this process.
 // Additionally, these fields are packaged up and passed along to downstream
@@ -232,13 +1231,48 @@ func AddField(ctx context.Context, key string, val interface{}) {
 // eg user IDs, globally relevant feature flags, errors, etc. Fields added here
 // are prefixed with `app.`
 func AddFieldToTrace(ctx context.Context, key string, val interface{}) {
-	namespacedKey := fmt.Sprintf("app.%s", key)
+	defaultBeeline.AddFieldToTrace(ctx, key, val)
+}
+
+// AddFieldToTrace adds a field to the trace in ctx. See the package-level
+// AddFieldToTrace for details.
+func (b *Beeline) AddFieldToTrace(ctx context.Context, key string, val interface{}) {
+	namespacedKey := appKeys.Key(key)
 	tr := trace.GetTraceFromContext(ctx)
+	if tr == nil {
+		if span := b.spanFromContext(ctx); span != nil {
+			tr = span.GetTrace()
+		}
+	}
 	if tr != nil {
 		tr.AddField(namespacedKey, val)
 	}
 }
 
+// AddCorrelationID records id, an identifier like a request, job, or order ID
+// that correlates the trace in ctx with other systems' records, in the
+// trace-level field correlation.<name> of every span in the trace. It is
+// passed along to downstream services, and sent in the header
+// Config.CorrelationHeaders names for it, if any. Use it for correlation IDs
+// that aren't in a request header, eg a job ID once a job is dequeued.
+func AddCorrelationID(ctx context.Context, name, id string) {
+	defaultBeeline.AddCorrelationID(ctx, name, id)
+}
+
+// AddCorrelationID records a correlation ID on the trace in ctx. See the
+// package-level AddCorrelationID for details.
+func (b *Beeline) AddCorrelationID(ctx context.Context, name, id string) {
+	tr := trace.GetTraceFromContext(ctx)
+	if tr == nil {
+		if span := b.spanFromContext(ctx); span != nil {
+			tr = span.GetTrace()
+		}
+	}
+	if tr != nil {
+		tr.AddCorrelationID(name, id)
+	}
+}
+
 // StartSpan lets you start a new span as a child of an already instrumented
 // handler. If there isn't an existing wrapped handler in the context when this
 // is called, it will start a new trace. Spans automatically get a `duration_ms`
@@ -249,7 +1283,15 @@ func AddFieldToTrace(ctx context.Context, key string, val interface{}) {
 // `span.Send()` when the span should be sent (often in a defer immediately
 // after creation). You should pass the returned context downstream.
 func StartSpan(ctx context.Context, name string) (context.Context, *trace.Span) {
-	span := trace.GetSpanFromContext(ctx)
+	return defaultBeeline.StartSpan(ctx, name)
+}
+
+// StartSpan starts a new span as a child of the span in ctx, or starts a new
+// trace belonging to this instance if there is none. Child spans belong to
+// the same instance as the trace that contains them. See the package-level
+// StartSpan for details.
+func (b *Beeline) StartSpan(ctx context.Context, name string) (context.Context, *trace.Span) {
+	span := b.spanFromContext(ctx)
 	var newSpan *trace.Span
 	if span != nil {
 		ctx, newSpan = span.CreateChild(ctx)
@@ -257,30 +1299,62 @@ func StartSpan(ctx context.Context, name string) (context.Context, *trace.Span)
 		// there is no trace active; we should make one, but use the root span
 		// as the "new" span instead of creating a child of this mostly empty
 		// span
-		ctx, _ = trace.NewTrace(ctx, "")
-		newSpan = trace.GetSpanFromContext(ctx)
+		var tr *trace.Trace
+		ctx, tr = trace.NewTraceFromPropagationContext(ctx, b.envTrace, b.TraceOptions()...)
+		newSpan = tr.GetRootSpan()
 	}
 	newSpan.AddField("name", name)
+	ctx = newSpan.LabelProfiles(ctx, name)
+	ctx = newSpan.TraceExecution(ctx, name)
 	return ctx, newSpan
 }
 
-// readResponses pulls from the response queue and spits them to STDOUT for
-// debugging
-func readResponses(responses chan transmission.Response) {
-	for r := range responses {
-		var metadata string
-		if r.Metadata != nil {
-			metadata = fmt.Sprintf("%s", r.Metadata)
-		}
-		if r.StatusCode >= 200 && r.StatusCode < 300 {
-			message := "Successfully sent event to Honeycomb"
-			if metadata != "" {
-				message += fmt.Sprintf(": %s", metadata)
-			}
-			fmt.Printf("%s\n", message)
-		} else {
-			fmt.Printf("Error sending event to Honeycomb! %s had code %d, err %v and response body %s \n",
-				metadata, r.StatusCode, r.Err, r.Body)
-		}
+// StartSpanWithParent starts a new span named name as a child of parent and
+// returns it, without reading or returning a context.Context. It is for
+// codebases that can't thread a context through every layer: hold on to the
+// returned span and pass it, rather than a context, to the code that creates
+// its children, either with StartSpanWithParent or the span's own StartChild
+// method. If parent is nil, a new trace is started and its root span is
+// returned. Call `span.Send()` when the span is done, as with StartSpan; a
+// span's children must be sent before it is. Spans are safe to share between
+// goroutines. To get back to context-based instrumentation, put the span in a
+// context with trace.PutSpanInContext.
+func StartSpanWithParent(parent *trace.Span, name string) *trace.Span {
+	return defaultBeeline.StartSpanWithParent(parent, name)
+}
+
+// StartSpanWithParent starts a new span as a child of parent, or starts a new
+// trace belonging to this instance if parent is nil. See the package-level
+// StartSpanWithParent for details.
+func (b *Beeline) StartSpanWithParent(parent *trace.Span, name string) *trace.Span {
+	if parent != nil {
+		return parent.StartChild(name)
 	}
+	_, tr := trace.NewTraceFromPropagationContext(context.Background(), b.envTrace, b.TraceOptions()...)
+	rootSpan := tr.GetRootSpan()
+	rootSpan.AddField("name", name)
+	return rootSpan
+}
+
+// StartTrace starts a brand new trace, regardless of whether ctx already
+// carries one, and returns a context containing its root span along with the
+// root span itself. The name argument becomes the name of the root span. Pass
+// options from the trace package to control the new trace - for example,
+// trace.WithDataset sends this trace to a different dataset than the one
+// given to Init, which is useful when a single process runs both web requests
+// and batch jobs. As with StartSpan, call `span.Send()` when the trace is done.
+func StartTrace(ctx context.Context, name string, opts ...trace.Option) (context.Context, *trace.Span) {
+	return defaultBeeline.StartTrace(ctx, name, opts...)
+}
+
+// StartTrace starts a new trace belonging to this instance. See the
+// package-level StartTrace for details.
+func (b *Beeline) StartTrace(ctx context.Context, name string, opts ...trace.Option) (context.Context, *trace.Span) {
+	opts = append(b.TraceOptions(), opts...)
+	ctx, tr := trace.NewTraceFromPropagationContext(ctx, nil, opts...)
+	rootSpan := tr.GetRootSpan()
+	rootSpan.AddField("name", name)
+	ctx = rootSpan.LabelProfiles(ctx, name)
+	ctx = rootSpan.TraceExecution(ctx, name)
+	return ctx, rootSpan
 }
@@ -1,12 +1,26 @@
 package beeline
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	rtrace "runtime/trace"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/honeycombio/libhoney-go/transmission"
 
+	"github.com/honeycombio/beeline-go/propagation"
+	"github.com/honeycombio/beeline-go/scrub"
+	"github.com/honeycombio/beeline-go/senders"
+	"github.com/honeycombio/beeline-go/trace"
 	libhoney "github.com/honeycombio/libhoney-go"
 	"github.com/stretchr/testify/assert"
 )
@@ -92,6 +106,266 @@ func TestBasicSpanAttributes(t *testing.T) {
 	assert.True(t, foundRoot, "root span missing")
 }
 
+// TestStartTraceWithDataset verifies that traces started with a dataset option
+// are sent to that dataset while other traces keep the default.
+func TestStartTraceWithDataset(t *testing.T) {
+	mo := setupLibhoney(t)
+	ctx, webRoot := StartSpan(context.Background(), "web")
+	batchCtx, jobRoot := StartTrace(ctx, "job", trace.WithDataset("batch-jobs"))
+	_, jobChild := StartSpan(batchCtx, "step")
+	jobChild.Send()
+	jobRoot.Send()
+	webRoot.Send()
+
+	events := mo.Events()
+	assert.Equal(t, 3, len(events), "should have sent 3 events")
+	datasets := make(map[string]string)
+	for _, ev := range events {
+		datasets[ev.Data["name"].(string)] = ev.Dataset
+	}
+	assert.Equal(t, "batch-jobs", datasets["job"], "new trace should use the dataset option")
+	assert.Equal(t, "batch-jobs", datasets["step"], "children should inherit the trace's dataset")
+	assert.Equal(t, "placeholder", datasets["web"], "other traces should use the default dataset")
+	assert.NotEqual(t, trace.GetTraceFromContext(ctx).GetTraceID(), jobRoot.GetTrace().GetTraceID(),
+		"StartTrace should start a new trace even if one is in the context")
+}
+
+// TestNewInstancesAreIndependent verifies that instances created with New send
+// with their own client and hooks, and don't touch the default instance.
+func TestNewInstancesAreIndependent(t *testing.T) {
+	defaultMo := setupLibhoney(t)
+
+	instanceMo := &transmission.MockSender{}
+	instanceClient, err := libhoney.NewClient(libhoney.ClientConfig{
+		APIKey:       "other",
+		Dataset:      "other",
+		APIHost:      "placeholder",
+		Transmission: instanceMo,
+	})
+	assert.Equal(t, nil, err)
+	bl := New(Config{
+		Client: instanceClient,
+		PresendHook: func(fields map[string]interface{}) {
+			fields["presend"] = "instance"
+		},
+	})
+
+	ctx, root := bl.StartSpan(context.Background(), "instance_root")
+	bl.AddField(ctx, "col", 1)
+	_, child := bl.StartSpan(ctx, "instance_child")
+	child.Send()
+	root.Send()
+
+	_, defaultRoot := StartSpan(context.Background(), "default_root")
+	defaultRoot.Send()
+
+	events := instanceMo.Events()
+	assert.Equal(t, 2, len(events), "instance should have sent 2 events")
+	for _, ev := range events {
+		assert.Equal(t, "other", ev.APIKey, "instance events should use the instance's write key")
+		assert.Equal(t, "instance", ev.Data["presend"], "instance presend hook should run on instance events")
+	}
+
+	events = defaultMo.Events()
+	assert.Equal(t, 1, len(events), "default instance should have sent 1 event")
+	assert.Equal(t, "default_root", events[0].Data["name"])
+	assert.Nil(t, events[0].Data["presend"], "instance presend hook should not run on default events")
+}
+
+// TestReconfigure verifies that changes made with Reconfigure apply to traces
+// started afterward.
+func TestReconfigure(t *testing.T) {
+	mo := setupLibhoney(t)
+	// reset the default beeline's settings when done
+	defer Reconfigure(Config{})
+
+	_, span := StartSpan(context.Background(), "before")
+	span.Send()
+
+	Reconfigure(Config{
+		WriteKey: "newkey",
+		Dataset:  "newdataset",
+		PresendHook: func(fields map[string]interface{}) {
+			fields["reconfigured"] = true
+		},
+	})
+	_, span = StartSpan(context.Background(), "after")
+	span.Send()
+
+	events := mo.Events()
+	assert.Equal(t, 2, len(events), "should have sent 2 events")
+	assert.Equal(t, "placeholder", events[0].Dataset, "spans before reconfiguring should use the original dataset")
+	assert.Nil(t, events[0].Data["reconfigured"], "spans before reconfiguring should not run the new presend hook")
+	assert.Equal(t, "newdataset", events[1].Dataset, "spans after reconfiguring should use the new dataset")
+	assert.Equal(t, "newkey", events[1].APIKey, "spans after reconfiguring should use the new write key")
+	assert.Equal(t, true, events[1].Data["reconfigured"], "spans after reconfiguring should run the new presend hook")
+
+	// a high sample rate should drop nearly all traces
+	Reconfigure(Config{SampleRate: 1000000})
+	for i := 0; i < 10; i++ {
+		_, span = StartSpan(context.Background(), "sampled")
+		span.Send()
+	}
+	assert.True(t, len(mo.Events()) < 12, "spans after raising the sample rate should be sampled")
+}
+
+// TestReconfigureDuringTrace verifies that traces in progress keep the settings
+// they started with, and that empty fields keep the values given to Init.
+func TestReconfigureDuringTrace(t *testing.T) {
+	mo := &transmission.MockSender{}
+	c, err := libhoney.NewClient(libhoney.ClientConfig{
+		APIKey:       "placeholder",
+		Dataset:      "placeholder",
+		APIHost:      "placeholder",
+		Transmission: mo,
+	})
+	assert.Equal(t, nil, err)
+	Init(Config{
+		Client: c,
+		PresendHook: func(fields map[string]interface{}) {
+			fields["presend"] = "init"
+		},
+	})
+	defer Init(Config{Client: c})
+
+	ctx, root := StartSpan(context.Background(), "root")
+	Reconfigure(Config{SampleRate: 1000000})
+	for i := 0; i < 10; i++ {
+		_, span := StartSpan(ctx, "child")
+		span.Send()
+	}
+	root.Send()
+	events := mo.Events()
+	assert.Equal(t, 11, len(events), "a trace started before reconfiguring should not be sampled at the new rate")
+	for _, ev := range events {
+		assert.Equal(t, "init", ev.Data["presend"], "omitted hooks should keep the ones given to Init")
+	}
+}
+
+// TestReconfigureKeepsSwitches verifies that settings a zero value turns off
+// keep the values given to Init rather than being merged with config.
+func TestReconfigureKeepsSwitches(t *testing.T) {
+	base := Config{
+		SampleRate:       4,
+		ProfilerLabels:   true,
+		CompressSiblings: 3,
+		MaxTraceDuration: time.Minute,
+	}
+	merged := mergeConfig(Config{CompressSiblings: 5}, base)
+	assert.Equal(t, uint(4), merged.SampleRate, "empty settings should fall back to Init's")
+	assert.True(t, merged.ProfilerLabels, "switches should keep Init's value")
+	assert.Equal(t, uint(3), merged.CompressSiblings, "counts that zero turns off should keep Init's value")
+	assert.Equal(t, time.Minute, merged.MaxTraceDuration, "limits should keep Init's value")
+
+	merged = mergeConfig(Config{SampleRate: 10}, Config{})
+	assert.Equal(t, uint(10), merged.SampleRate, "the sample rate should be changed")
+	assert.False(t, merged.ProfilerLabels, "switches off at Init should stay off")
+}
+
+func TestReconfigureDoesNotRaceWithSend(t *testing.T) {
+	setupLibhoney(t)
+	defer Reconfigure(Config{})
+
+	wg := &sync.WaitGroup{}
+	wg.Add(2)
+	go func() {
+		for i := 0; i < 100; i++ {
+			Reconfigure(Config{SampleRate: uint(i%3 + 1), Dataset: fmt.Sprintf("ds%d", i)})
+		}
+		wg.Done()
+	}()
+	go func() {
+		for i := 0; i < 100; i++ {
+			ctx, span := StartSpan(context.Background(), "root")
+			_, child := StartSpan(ctx, "child")
+			child.Send()
+			span.Send()
+		}
+		wg.Done()
+	}()
+	wg.Wait()
+}
+
+// TestReconfigureInstance verifies Reconfigure on an instance created with New.
+func TestReconfigureInstance(t *testing.T) {
+	mo := &transmission.MockSender{}
+	c, err := libhoney.NewClient(libhoney.ClientConfig{
+		APIKey:       "0123456789abcdef0123456789abcdef",
+		Dataset:      "placeholder",
+		APIHost:      "placeholder",
+		Transmission: mo,
+	})
+	assert.Equal(t, nil, err)
+	bl := New(Config{Client: c})
+	bl.Reconfigure(Config{Dataset: "newdataset"})
+	_, span := bl.StartSpan(context.Background(), "after")
+	span.Send()
+
+	// environment keys send to a dataset named after the service
+	bl.Reconfigure(Config{WriteKey: "abcdefghijklmnopqrstuv", Dataset: "ignored", ServiceName: "my-service"})
+	_, span = bl.StartSpan(context.Background(), "environment")
+	span.Send()
+
+	events := mo.Events()
+	assert.Equal(t, 2, len(events), "should have sent 2 events")
+	assert.Equal(t, "newdataset", events[0].Dataset, "instance spans should use the new dataset")
+	assert.Equal(t, "0123456789abcdef0123456789abcdef", events[0].APIKey, "instance spans should keep the client's write key")
+	assert.Equal(t, "my-service", events[1].Dataset, "environment keys should send to the service's dataset")
+	info := bl.Info()
+	assert.Equal(t, KeyTypeEnvironment, info.KeyType)
+	assert.Equal(t, "my-service", info.Dataset)
+	assert.Len(t, info.Warnings, 1, "the ignored dataset should be reported")
+}
+
+func TestNewWithTransmission(t *testing.T) {
+	mo := &transmission.MockSender{}
+	bl := New(Config{
+		WriteKey:     "0123456789abcdef0123456789abcdef",
+		Dataset:      "custom",
+		Transmission: mo,
+	})
+	assert.Equal(t, senders.Stats{}, bl.Stats(), "events should go straight to libhoney by default")
+	bl = New(Config{
+		WriteKey:       "0123456789abcdef0123456789abcdef",
+		Dataset:        "custom",
+		Transmission:   mo,
+		OverflowPolicy: senders.OverflowDropOldest,
+	})
+	_, span := bl.StartSpan(context.Background(), "custom")
+	span.Send()
+	bl.Flush(context.Background())
+
+	events := mo.Events()
+	assert.Equal(t, 1, len(events), "events should go to the configured transmission")
+	assert.Equal(t, "custom", events[0].Dataset)
+	stats := bl.Stats()
+	assert.Equal(t, libhoney.DefaultPendingWorkCapacity, stats.QueueCapacity, "the send queue should be reported")
+	assert.Equal(t, 0, stats.QueueDepth, "flushing should empty the send queue")
+
+	muted := &transmission.MockSender{}
+	bl = New(Config{Transmission: muted, Mute: true})
+	_, span = bl.StartSpan(context.Background(), "muted")
+	span.Send()
+	assert.Equal(t, 0, len(muted.Events()), "Mute should override the configured transmission")
+
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	captured := &transmission.MockSender{}
+	bl = New(Config{
+		WriteKey:     "0123456789abcdef0123456789abcdef",
+		Dataset:      "custom",
+		Transmission: captured,
+		CaptureFile:  filepath.Join(dir, "capture.json"),
+	})
+	_, span = bl.StartSpan(context.Background(), "captured")
+	span.Send()
+	bl.Close()
+	assert.Equal(t, 1, len(captured.Events()), "captured events should still be sent")
+	contents, err := ioutil.ReadFile(filepath.Join(dir, "capture.json"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(contents), `"name":"captured"`)
+}
+
 func BenchmarkCreateSpan(b *testing.B) {
 	setupLibhoney(b)
 
@@ -126,3 +400,395 @@ func setupLibhoney(t testing.TB) *transmission.MockSender {
 
 	return mo
 }
+
+// recordingLogger keeps the messages logged to it by level.
+type recordingLogger struct {
+	lock     sync.Mutex
+	messages map[string][]string
+}
+
+func (l *recordingLogger) log(level, msg string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.messages == nil {
+		l.messages = make(map[string][]string)
+	}
+	l.messages[level] = append(l.messages[level], msg)
+}
+
+func (l *recordingLogger) get(level string) []string {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return append([]string(nil), l.messages[level]...)
+}
+
+func (l *recordingLogger) Debug(msg string, keyvals ...interface{}) { l.log("debug", msg) }
+func (l *recordingLogger) Info(msg string, keyvals ...interface{})  { l.log("info", msg) }
+func (l *recordingLogger) Warn(msg string, keyvals ...interface{})  { l.log("warn", msg) }
+func (l *recordingLogger) Error(msg string, keyvals ...interface{}) { l.log("error", msg) }
+
+func TestNewLogsDiagnostics(t *testing.T) {
+	l := &recordingLogger{}
+	bl := New(Config{Logger: l, CACertFile: "/does/not/exist.pem"})
+	defer bl.Close()
+	assert.Equal(t, []string{"beeline configuration warning"}, l.get("warn"), "the missing write key should be logged")
+	assert.Len(t, l.get("error"), 1, "dropping all events should be logged as an error")
+
+	l = &recordingLogger{}
+	bl = New(Config{Logger: l, Debug: true, Transmission: &statusSender{codes: []int{500}, responses: make(chan transmission.Response, 1)}})
+	_, span := bl.StartSpan(context.Background(), "failed")
+	span.Send()
+	assert.Eventually(t, func() bool { return len(l.get("warn")) == 1 }, time.Second, time.Millisecond,
+		"failed sends should be logged with Debug")
+}
+
+type tenantKey struct{}
+
+func TestContextFields(t *testing.T) {
+	mo := &transmission.MockSender{}
+	c, err := libhoney.NewClient(libhoney.ClientConfig{
+		APIKey:       "placeholder",
+		Dataset:      "placeholder",
+		APIHost:      "placeholder",
+		Transmission: mo,
+	})
+	assert.Equal(t, nil, err)
+	bl := New(Config{
+		Client:        c,
+		ContextFields: map[string]interface{}{"app.tenant": tenantKey{}},
+		ContextFieldsHook: func(ctx context.Context) map[string]interface{} {
+			return map[string]interface{}{"app.hooked": true}
+		},
+	})
+
+	ctx, root := bl.StartSpan(context.Background(), "root")
+	ctx = context.WithValue(ctx, tenantKey{}, "acme")
+	_, child := bl.StartSpan(ctx, "child")
+	child.Send()
+	root.Send()
+
+	events := mo.Events()
+	assert.Equal(t, 2, len(events))
+	for _, ev := range events {
+		assert.Equal(t, true, ev.Data["app.hooked"], "the hook should run for every span")
+		if ev.Data["name"] == "child" {
+			assert.Equal(t, "acme", ev.Data["app.tenant"], "spans started from the context should get its values")
+		} else {
+			assert.Nil(t, ev.Data["app.tenant"], "spans started before the value was set should not get it")
+		}
+	}
+}
+
+func TestScrubber(t *testing.T) {
+	mo := &transmission.MockSender{}
+	c, err := libhoney.NewClient(libhoney.ClientConfig{
+		APIKey:       "placeholder",
+		Dataset:      "placeholder",
+		APIHost:      "placeholder",
+		Transmission: mo,
+	})
+	assert.Equal(t, nil, err)
+	bl := New(Config{
+		Client:   c,
+		Scrubber: scrub.Default(),
+		PresendHook: func(fields map[string]interface{}) {
+			fields["app.added_by_hook"] = "jo@example.com"
+		},
+	})
+
+	_, span := bl.StartSpan(context.Background(), "root")
+	span.AddField("request.url", "/signup?email=jo@example.com")
+	span.AddField("request.header.authorization", "Bearer abc123")
+	span.Send()
+
+	events := mo.Events()
+	assert.Equal(t, 1, len(events))
+	assert.Equal(t, "/signup?email=[REDACTED]", events[0].Data["request.url"])
+	assert.Equal(t, "[REDACTED]", events[0].Data["request.header.authorization"])
+	assert.Equal(t, "[REDACTED]", events[0].Data["app.added_by_hook"], "the scrubber should run after the presend hook")
+}
+
+func TestSpanNameHook(t *testing.T) {
+	mo := &transmission.MockSender{}
+	c, err := libhoney.NewClient(libhoney.ClientConfig{
+		APIKey:       "placeholder",
+		Dataset:      "placeholder",
+		APIHost:      "placeholder",
+		Transmission: mo,
+	})
+	assert.Equal(t, nil, err)
+	var sampledName interface{}
+	bl := New(Config{
+		Client: c,
+		SpanNameHook: func(name string, fields map[string]interface{}) string {
+			if fields["app.customer"] != nil {
+				return "customer_handler"
+			}
+			return name
+		},
+		SamplerHook: func(fields map[string]interface{}) (bool, int) {
+			sampledName = fields["name"]
+			return true, 1
+		},
+	})
+
+	ctx, root := bl.StartSpan(context.Background(), "root")
+	_, child := bl.StartSpan(ctx, "handle_acme")
+	child.AddField("app.customer", "acme")
+	child.Send()
+	assert.Equal(t, "customer_handler", sampledName, "the hook should run before the sampler")
+	root.SetName("renamed_root")
+	root.Send()
+
+	events := mo.Events()
+	assert.Equal(t, 2, len(events))
+	assert.Equal(t, "customer_handler", events[0].Data["name"])
+	assert.Equal(t, "renamed_root", events[1].Data["name"], "SetName should replace the name")
+}
+
+func TestAddFields(t *testing.T) {
+	mo := setupLibhoney(t)
+	ctx, span := StartSpan(context.Background(), "root")
+	AddFields(ctx, map[string]interface{}{
+		"user_id": 1,
+		"err":     fmt.Errorf("oops"),
+		"skipped": nil,
+	})
+	span.Send()
+
+	events := mo.Events()
+	assert.Equal(t, 1, len(events))
+	assert.Equal(t, 1, events[0].Data["app.user_id"])
+	assert.Equal(t, "oops", events[0].Data["app.err"], "errors should be stringified")
+	_, ok := events[0].Data["app.skipped"]
+	assert.False(t, ok, "nil values should be skipped")
+}
+
+func TestStartSpanWithParent(t *testing.T) {
+	mo := setupLibhoney(t)
+	root := StartSpanWithParent(nil, "root")
+	child := StartSpanWithParent(root, "child")
+	grandchild := child.StartChild("grandchild")
+	grandchild.AddField("app.depth", 2)
+	grandchild.Send()
+	child.Send()
+	root.Send()
+
+	events := mo.Events()
+	assert.Equal(t, 3, len(events))
+	assert.Equal(t, "grandchild", events[0].Data["name"])
+	assert.Equal(t, child.GetSpanID(), events[0].Data["trace.parent_id"])
+	assert.Equal(t, "child", events[1].Data["name"])
+	assert.Equal(t, root.GetSpanID(), events[1].Data["trace.parent_id"])
+	assert.Equal(t, "root", events[2].Data["name"])
+	assert.Equal(t, root.GetTrace().GetTraceID(), events[0].Data["trace.trace_id"])
+}
+
+func TestProfilerLabels(t *testing.T) {
+	mo := &transmission.MockSender{}
+	client, _ := libhoney.NewClient(libhoney.ClientConfig{APIKey: "placeholder", Dataset: "placeholder", Transmission: mo})
+	bl := New(Config{Client: client, ProfilerLabels: true})
+	ctx, root := bl.StartTrace(context.Background(), "root")
+	traceID, _ := pprof.Label(ctx, "trace_id")
+	assert.Equal(t, root.GetTrace().GetTraceID(), traceID)
+	childCtx, child := bl.StartSpan(ctx, "child")
+	name, _ := pprof.Label(childCtx, "span_name")
+	assert.Equal(t, "child", name)
+	assert.Equal(t, child, trace.GetSpanFromContext(childCtx))
+	child.Send()
+	root.Send()
+
+	ctx, span := New(Config{Client: client}).StartSpan(context.Background(), "unlabeled")
+	_, ok := pprof.Label(ctx, "trace_id")
+	assert.False(t, ok, "labels are off by default")
+	span.Send()
+}
+
+func TestMaxSpanMemory(t *testing.T) {
+	mo := &transmission.MockSender{}
+	client, _ := libhoney.NewClient(libhoney.ClientConfig{APIKey: "placeholder", Dataset: "placeholder", Transmission: mo})
+	bl := New(Config{Client: client, MaxSpanMemory: 1})
+	_, old := bl.StartTrace(context.Background(), "old")
+	assert.Equal(t, int64(1), bl.MemoryStats().Spans)
+
+	// Reconfigure keeps the budget
+	bl.Reconfigure(Config{SampleRate: 1})
+	_, root := bl.StartTrace(context.Background(), "new")
+	assert.True(t, old.IsFinished(), "the oldest span should have been sent")
+	stats := bl.MemoryStats()
+	assert.Equal(t, int64(1), stats.MaxBytes)
+	assert.Equal(t, int64(1), stats.Spans)
+	assert.Equal(t, uint64(1), stats.SentEarly)
+	root.Send()
+	if evs := mo.Events(); assert.Len(t, evs, 2) {
+		assert.Equal(t, true, evs[0].Data["meta.shed"])
+	}
+
+	assert.Equal(t, trace.MemoryStats{}, New(Config{Client: client}).MemoryStats(),
+		"there's no budget by default")
+}
+
+func TestCorrelationIDs(t *testing.T) {
+	mo := &transmission.MockSender{}
+	client, _ := libhoney.NewClient(libhoney.ClientConfig{APIKey: "placeholder", Dataset: "placeholder", Transmission: mo})
+	bl := New(Config{Client: client, CorrelationHeaders: map[string]string{"job_id": "X-Job-ID"}})
+	ctx, root := bl.StartTrace(context.Background(), "root")
+	bl.AddCorrelationID(ctx, "job_id", "job-1")
+	headers := root.PropagationHeaders(ctx)
+	assert.Equal(t, "job-1", headers["X-Job-ID"], "correlation IDs should be sent in their headers")
+	root.Send()
+	if evs := mo.Events(); assert.Len(t, evs, 1) {
+		assert.Equal(t, "job-1", evs[0].Data["correlation.job_id"])
+	}
+}
+
+func TestContextDeadlines(t *testing.T) {
+	mo := &transmission.MockSender{}
+	client, _ := libhoney.NewClient(libhoney.ClientConfig{APIKey: "placeholder", Dataset: "placeholder", Transmission: mo})
+	bl := New(Config{Client: client, ContextDeadlines: true})
+	ctx, root := bl.StartTrace(context.Background(), "root")
+	timeoutCtx, cancel := context.WithTimeout(ctx, time.Minute)
+	_, timedOut := bl.StartSpan(timeoutCtx, "timed out")
+	cancel()
+	timedOut.Send()
+	deadlineCtx, cancel := context.WithDeadline(ctx, time.Now().Add(-time.Second))
+	defer cancel()
+	_, expired := bl.StartSpan(deadlineCtx, "expired")
+	expired.Send()
+	root.Send()
+
+	evs := mo.Events()
+	if assert.Equal(t, 3, len(evs)) {
+		assert.Equal(t, true, evs[0].Data["context.deadline_set"])
+		assert.InDelta(t, 60000, evs[0].Data["context.deadline_remaining_ms"], 1000)
+		assert.Equal(t, true, evs[0].Data["context.cancelled"])
+		assert.Equal(t, false, evs[0].Data["context.timed_out"])
+		assert.Equal(t, false, evs[1].Data["context.cancelled"])
+		assert.Equal(t, true, evs[1].Data["context.timed_out"])
+		assert.Equal(t, false, evs[2].Data["context.deadline_set"])
+		assert.NotContains(t, evs[2].Data, "context.deadline_remaining_ms")
+		assert.Equal(t, false, evs[2].Data["context.cancelled"])
+	}
+
+	_, span := New(Config{Client: client}).StartSpan(context.Background(), "plain")
+	span.Send()
+	assert.NotContains(t, mo.Events()[3].Data, "context.deadline_set", "deadlines aren't recorded by default")
+}
+
+func TestExecutionTraceRegions(t *testing.T) {
+	mo := &transmission.MockSender{}
+	client, _ := libhoney.NewClient(libhoney.ClientConfig{APIKey: "placeholder", Dataset: "placeholder", Transmission: mo})
+	bl := New(Config{Client: client, ExecutionTraceRegions: true})
+
+	// nothing is opened unless an execution trace is being recorded
+	ctx, span := bl.StartTrace(context.Background(), "untraced")
+	assert.Equal(t, span, trace.GetSpanFromContext(ctx))
+	span.Send()
+
+	var buf bytes.Buffer
+	if err := rtrace.Start(&buf); err != nil {
+		t.Skipf("couldn't start execution trace: %v", err)
+	}
+	ctx, root := bl.StartTrace(context.Background(), "root_task_name")
+	_, child := bl.StartSpan(ctx, "child_region_name")
+	child.Send()
+	root.Send()
+	rtrace.Stop()
+
+	assert.Contains(t, buf.String(), "root_task_name")
+	assert.Contains(t, buf.String(), "child_region_name")
+	assert.Equal(t, 3, len(mo.Events()))
+}
+
+func TestClockSettings(t *testing.T) {
+	mo := &transmission.MockSender{}
+	bl := New(Config{Transmission: mo, ClockOffset: time.Hour, MonotonicClock: true})
+	defer bl.Close()
+	_, span := bl.StartTrace(context.Background(), "skewed")
+	span.Send()
+	bl.Flush(context.Background())
+	events := mo.Events()
+	if assert.Len(t, events, 1) {
+		assert.WithinDuration(t, time.Now().Add(time.Hour), events[0].Timestamp, time.Minute)
+	}
+
+	fixed := time.Unix(1000, 0)
+	bl = New(Config{Transmission: mo, ClockOffset: time.Hour, Clock: func() time.Time { return fixed }})
+	defer bl.Close()
+	_, span = bl.StartTrace(context.Background(), "fixed")
+	span.Send()
+	bl.Flush(context.Background())
+	assert.Equal(t, fixed, mo.Events()[1].Timestamp, "an explicit Clock wins")
+}
+
+func TestFlushFinished(t *testing.T) {
+	mo := &transmission.MockSender{}
+	bl := New(Config{Transmission: mo})
+	ctx, root := bl.StartTrace(context.Background(), "handler")
+	_, early := bl.StartSpan(ctx, "early")
+	early.Send()
+	bl.FlushFinished(ctx)
+	assert.Len(t, mo.Events(), 1)
+	assert.False(t, root.IsSent(), "the trace should stay open")
+	bl.Flush(ctx)
+	assert.Len(t, mo.Events(), 2)
+
+	// flushing the default sender while spans are being sent mustn't send
+	// them to a stopped sender
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("[]"))
+	}))
+	defer srv.Close()
+	bl = New(Config{WriteKey: "abc123", Dataset: "flush", APIHost: srv.URL})
+	defer bl.Close()
+	ctx, _ = bl.StartTrace(context.Background(), "handler")
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				_, span := bl.StartSpan(ctx, "work")
+				span.Send()
+			}
+		}()
+	}
+	for i := 0; i < 20; i++ {
+		bl.FlushFinished(ctx)
+	}
+	wg.Wait()
+}
+
+func TestEnvTrace(t *testing.T) {
+	os.Setenv(propagation.EnvTrace, "1;trace_id=parent-trace,parent_id=parent-span,hops=1,context=e30=")
+	defer os.Unsetenv(propagation.EnvTrace)
+
+	mo := &transmission.MockSender{}
+	bl := New(Config{Transmission: mo})
+	defer bl.Close()
+	_, span := bl.StartSpan(context.Background(), "child")
+	span.Send()
+	bl.StartSpanWithParent(nil, "child").Send()
+	_, span = bl.StartTrace(context.Background(), "fresh")
+	span.Send()
+
+	ignoring := New(Config{Transmission: mo, IgnoreEnvTrace: true})
+	defer ignoring.Close()
+	_, span = ignoring.StartSpan(context.Background(), "ignored")
+	span.Send()
+
+	os.Setenv(propagation.EnvTrace, "garbage")
+	bad := New(Config{Transmission: mo})
+	defer bad.Close()
+	assert.NotEmpty(t, bad.Info().Warnings, "an unparseable trace context should be reported")
+
+	events := mo.Events()
+	if assert.Len(t, events, 4) {
+		for _, ev := range events[:2] {
+			assert.Equal(t, "parent-trace", ev.Data["trace.trace_id"])
+			assert.Equal(t, "parent-span", ev.Data["trace.parent_id"])
+		}
+		assert.NotEqual(t, "parent-trace", events[2].Data["trace.trace_id"], "StartTrace starts a new trace")
+		assert.NotEqual(t, "parent-trace", events[3].Data["trace.trace_id"])
+	}
+}
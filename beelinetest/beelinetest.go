@@ -0,0 +1,266 @@
+package beelinetest
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	beeline "github.com/honeycombio/beeline-go"
+	"github.com/honeycombio/libhoney-go/transmission"
+)
+
+// Span is a span that was sent to a Recorder.
+type Span struct {
+	Name     string
+	TraceID  string
+	SpanID   string
+	ParentID string
+	Dataset  string
+	// SampleRate is the rate the span was sampled at. Spans dropped by
+	// sampling never reach the Recorder.
+	SampleRate uint
+	Timestamp  time.Time
+	// Fields holds every field on the span, including the ones above.
+	Fields map[string]interface{}
+}
+
+// IsSpanEvent reports whether s is a span event, sent with
+// trace.Span.SendSpanEvent, rather than a span.
+func (s *Span) IsSpanEvent() bool {
+	return s.Fields["meta.annotation_type"] == "span_event"
+}
+
+// Recorder is a transmission.Sender that keeps the spans sent through it in
+// memory. It is safe for concurrent use.
+type Recorder struct {
+	lock      sync.Mutex
+	spans     []*Span
+	responses chan transmission.Response
+}
+
+// NewRecorder returns an empty Recorder. Use it as beeline.Config's
+// Transmission, or use Init or New to set that up.
+func NewRecorder() *Recorder {
+	return &Recorder{responses: make(chan transmission.Response, 1000)}
+}
+
+// Init initializes the default beeline with config, sending to a new Recorder,
+// and returns the Recorder. A placeholder write key and dataset are used if
+// config doesn't set them.
+func Init(config beeline.Config) *Recorder {
+	r := NewRecorder()
+	beeline.Init(recorderConfig(config, r))
+	return r
+}
+
+// New creates a Beeline instance with config that sends to a new Recorder,
+// for tests of code that takes a *beeline.Beeline. A placeholder write key
+// and dataset are used if config doesn't set them.
+func New(config beeline.Config) (*beeline.Beeline, *Recorder) {
+	r := NewRecorder()
+	return beeline.New(recorderConfig(config, r)), r
+}
+
+func recorderConfig(config beeline.Config, r *Recorder) beeline.Config {
+	config.Client = nil
+	config.Transmission = r
+	config.STDOUT = false
+	config.Mute = false
+	if config.WriteKey == "" {
+		config.WriteKey = "beelinetest"
+	}
+	if config.Dataset == "" {
+		config.Dataset = "beelinetest"
+	}
+	return config
+}
+
+// Add records ev. It is part of the transmission.Sender interface.
+func (r *Recorder) Add(ev *transmission.Event) {
+	s := &Span{
+		Dataset:    ev.Dataset,
+		SampleRate: ev.SampleRate,
+		Timestamp:  ev.Timestamp,
+		Fields:     make(map[string]interface{}, len(ev.Data)),
+	}
+	for k, v := range ev.Data {
+		s.Fields[k] = v
+	}
+	s.Name, _ = s.Fields["name"].(string)
+	s.TraceID, _ = s.Fields["trace.trace_id"].(string)
+	s.SpanID, _ = s.Fields["trace.span_id"].(string)
+	s.ParentID, _ = s.Fields["trace.parent_id"].(string)
+
+	r.lock.Lock()
+	r.spans = append(r.spans, s)
+	r.lock.Unlock()
+	r.SendResponse(transmission.Response{StatusCode: 202, Metadata: ev.Metadata})
+}
+
+// Start does nothing. It is part of the transmission.Sender interface.
+func (r *Recorder) Start() error {
+	return nil
+}
+
+// Stop does nothing; spans are recorded as soon as they're sent. It is part
+// of the transmission.Sender interface.
+func (r *Recorder) Stop() error {
+	return nil
+}
+
+// TxResponses returns the channel of responses to recorded spans. It is part
+// of the transmission.Sender interface.
+func (r *Recorder) TxResponses() chan transmission.Response {
+	return r.responses
+}
+
+// SendResponse queues resp without blocking and reports whether it was
+// dropped. It is part of the transmission.Sender interface.
+func (r *Recorder) SendResponse(resp transmission.Response) bool {
+	select {
+	case r.responses <- resp:
+		return false
+	default:
+		return true
+	}
+}
+
+// Spans returns every span recorded so far, in the order they were sent.
+// Children are usually sent before their parents.
+func (r *Recorder) Spans() []*Span {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	spans := make([]*Span, len(r.spans))
+	copy(spans, r.spans)
+	return spans
+}
+
+// Reset forgets all recorded spans.
+func (r *Recorder) Reset() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.spans = nil
+}
+
+// Find returns the first recorded span named name, or nil if there isn't one.
+func (r *Recorder) Find(name string) *Span {
+	for _, s := range r.Spans() {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// Children returns the recorded spans whose parent is s.
+func (r *Recorder) Children(s *Span) []*Span {
+	var children []*Span
+	for _, child := range r.Spans() {
+		if child.ParentID == s.SpanID && child.TraceID == s.TraceID {
+			children = append(children, child)
+		}
+	}
+	return children
+}
+
+// AssertSpan fails t if no span named name was recorded. It returns the span,
+// or nil if there wasn't one.
+func (r *Recorder) AssertSpan(t testing.TB, name string) *Span {
+	t.Helper()
+	s := r.Find(name)
+	if s == nil {
+		t.Errorf("no span named %q was sent; got %s", name, r.names())
+	}
+	return s
+}
+
+// AssertNoSpan fails t if a span named name was recorded.
+func (r *Recorder) AssertNoSpan(t testing.TB, name string) {
+	t.Helper()
+	if r.Find(name) != nil {
+		t.Errorf("a span named %q was sent", name)
+	}
+}
+
+// AssertParent fails t unless spans named child and parent were recorded
+// and the first child's parent is the first parent.
+func (r *Recorder) AssertParent(t testing.TB, child, parent string) {
+	t.Helper()
+	c := r.AssertSpan(t, child)
+	p := r.AssertSpan(t, parent)
+	if c == nil || p == nil {
+		return
+	}
+	if c.TraceID != p.TraceID || c.ParentID != p.SpanID {
+		t.Errorf("span %q is not a child of %q", child, parent)
+	}
+}
+
+// AssertField fails t unless a span named name was recorded and its field
+// key equals want. Numbers are compared by value, so an int want matches a
+// float64 field.
+func (r *Recorder) AssertField(t testing.TB, name, key string, want interface{}) {
+	t.Helper()
+	s := r.AssertSpan(t, name)
+	if s == nil {
+		return
+	}
+	got, ok := s.Fields[key]
+	if !ok {
+		t.Errorf("span %q has no field %q", name, key)
+		return
+	}
+	if !equal(got, want) {
+		t.Errorf("span %q field %q = %#v, want %#v", name, key, got, want)
+	}
+}
+
+// names lists the names of the recorded spans for failure messages.
+func (r *Recorder) names() string {
+	var names []string
+	for _, s := range r.Spans() {
+		names = append(names, s.Name)
+	}
+	return fmt.Sprintf("%q", names)
+}
+
+// equal compares a and b, treating numbers of different types as equal if
+// they have the same value.
+func equal(a, b interface{}) bool {
+	if af, ok := toFloat(a); ok {
+		bf, ok := toFloat(b)
+		return ok && af == bf
+	}
+	return fmt.Sprintf("%#v", a) == fmt.Sprintf("%#v", b)
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
@@ -0,0 +1,92 @@
+package beelinetest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	beeline "github.com/honeycombio/beeline-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeT records failures instead of failing the test.
+type fakeT struct {
+	testing.TB
+	failures []string
+}
+
+func (f *fakeT) Helper() {}
+
+func (f *fakeT) Errorf(format string, args ...interface{}) {
+	f.failures = append(f.failures, fmt.Sprintf(format, args...))
+}
+
+func TestRecorder(t *testing.T) {
+	bl, rec := New(beeline.Config{})
+	ctx, root := bl.StartSpan(context.Background(), "checkout")
+	ctx, child := bl.StartSpan(ctx, "charge_card")
+	bl.AddField(ctx, "amount", 1999)
+	child.SendSpanEvent("retry", nil)
+	child.Send()
+	root.Send()
+
+	spans := rec.Spans()
+	assert.Equal(t, 3, len(spans))
+	charge := rec.Find("charge_card")
+	if assert.NotNil(t, charge) {
+		assert.Equal(t, "beelinetest", charge.Dataset)
+		assert.Equal(t, root.GetSpanID(), charge.ParentID)
+		assert.Equal(t, 1999, charge.Fields["app.amount"])
+	}
+	assert.True(t, rec.Find("retry").IsSpanEvent())
+	assert.Equal(t, []*Span{charge}, rec.Children(rec.Find("checkout")))
+	assert.Equal(t, []*Span{rec.Find("retry")}, rec.Children(charge), "span events should be children of their span")
+
+	rec.AssertParent(t, "charge_card", "checkout")
+	rec.AssertField(t, "charge_card", "app.amount", 1999.0)
+	rec.AssertNoSpan(t, "refund")
+
+	ft := &fakeT{}
+	rec.AssertSpan(ft, "refund")
+	rec.AssertParent(ft, "checkout", "charge_card")
+	rec.AssertField(ft, "charge_card", "app.amount", 5)
+	rec.AssertField(ft, "charge_card", "app.currency", "usd")
+	rec.AssertNoSpan(ft, "checkout")
+	assert.Equal(t, 5, len(ft.failures), "%q", ft.failures)
+
+	rec.Reset()
+	assert.Empty(t, rec.Spans())
+}
+
+func TestInit(t *testing.T) {
+	rec := Init(beeline.Config{ServiceName: "beelinetest"})
+	defer beeline.Close()
+	_, span := beeline.StartSpan(context.Background(), "root")
+	span.Send()
+	rec.AssertField(t, "root", "service_name", "beelinetest")
+}
+
+func TestDeterministic(t *testing.T) {
+	run := func() []*Span {
+		bl, rec := New(Deterministic(beeline.Config{}, 0))
+		defer bl.Close()
+		ctx, root := bl.StartSpan(context.Background(), "root")
+		_, child := bl.StartSpan(ctx, "child")
+		child.Send()
+		root.Send()
+		return rec.Spans()
+	}
+	first, second := run(), run()
+	assert.Equal(t, first, second)
+	if assert.Equal(t, 2, len(first)) {
+		child, root := first[0], first[1]
+		assert.Equal(t, "00000000000000000000000000000001", root.TraceID)
+		assert.Equal(t, "0000000000000001", root.SpanID)
+		assert.Equal(t, "0000000000000002", child.SpanID)
+		assert.Equal(t, Epoch, root.Timestamp)
+		assert.Equal(t, Epoch.Add(time.Millisecond), child.Timestamp)
+		assert.Equal(t, 1.0, child.Fields["duration_ms"])
+		assert.Equal(t, 3.0, root.Fields["duration_ms"])
+	}
+}
@@ -0,0 +1,49 @@
+package beelinetest
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	beeline "github.com/honeycombio/beeline-go"
+)
+
+// Epoch is the time the clock installed by Deterministic starts at.
+var Epoch = time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Deterministic returns config with a Clock that starts at Epoch and
+// advances by step every time it is read, and NewTraceID and NewSpanID
+// functions that count up from 1. A step of zero advances the clock by one
+// millisecond. Code that creates and sends spans in the same order on every
+// run then emits identical events, timestamps and durations included, so
+// they can be compared with golden files.
+func Deterministic(config beeline.Config, step time.Duration) beeline.Config {
+	if step == 0 {
+		step = time.Millisecond
+	}
+	var (
+		lock              sync.Mutex
+		ticks             int64
+		traceIDs, spanIDs uint64
+	)
+	config.Clock = func() time.Time {
+		lock.Lock()
+		defer lock.Unlock()
+		now := Epoch.Add(time.Duration(ticks) * step)
+		ticks++
+		return now
+	}
+	config.NewTraceID = func() string {
+		lock.Lock()
+		defer lock.Unlock()
+		traceIDs++
+		return fmt.Sprintf("%032x", traceIDs)
+	}
+	config.NewSpanID = func() string {
+		lock.Lock()
+		defer lock.Unlock()
+		spanIDs++
+		return fmt.Sprintf("%016x", spanIDs)
+	}
+	return config
+}
@@ -0,0 +1,35 @@
+/*
+Package beelinetest helps applications unit test their instrumentation.
+
+Summary
+
+A Recorder is a transmission.Sender that keeps every span sent through it as
+a Span, with the trace fields pulled out into struct fields, so tests don't
+need to dig through libhoney's transmission events. Init points the default
+beeline at a new Recorder; New builds a separate Beeline instance that
+records to one.
+
+	func TestCheckout(t *testing.T) {
+		rec := beelinetest.Init(beeline.Config{})
+		defer beeline.Close()
+
+		checkout(context.Background())
+
+		rec.AssertParent(t, "charge_card", "checkout")
+		rec.AssertField(t, "charge_card", "app.amount", 1999)
+	}
+
+The Assert methods report failures with t.Errorf and keep going, so one test
+can check several things about the spans it produced.
+
+Deterministic output
+
+Deterministic fills in a Config's Clock, NewTraceID and NewSpanID with a
+stepping clock and counting IDs, so a test that sends the same spans in the
+same order emits exactly the same events every time. That makes it possible
+to compare Recorder.Spans against a golden file.
+
+	rec := beelinetest.Init(beelinetest.Deterministic(beeline.Config{}, time.Millisecond))
+
+*/
+package beelinetest
@@ -0,0 +1,183 @@
+package benchmarks
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	beeline "github.com/honeycombio/beeline-go"
+	"github.com/honeycombio/beeline-go/propagation"
+	"github.com/honeycombio/beeline-go/wrappers/hnynethttp"
+	libhoney "github.com/honeycombio/libhoney-go"
+	"github.com/honeycombio/libhoney-go/transmission"
+)
+
+// setup points the default beeline at a transmission that throws events away
+// and returns a function that closes it.
+func setup(b *testing.B, sampleRate uint) func() {
+	c, err := libhoney.NewClient(libhoney.ClientConfig{
+		APIKey:       "placeholder",
+		Dataset:      "placeholder",
+		APIHost:      "placeholder",
+		Transmission: &transmission.DiscardSender{},
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	beeline.Init(beeline.Config{Client: c, SampleRate: sampleRate})
+	return beeline.Close
+}
+
+func BenchmarkSpanLifecycle(b *testing.B) {
+	for _, sampleRate := range []uint{1, 1000} {
+		for _, numFields := range []int{5, 20} {
+			keys := make([]string, numFields)
+			for i := range keys {
+				keys[i] = fmt.Sprintf("field%d", i)
+			}
+			b.Run(fmt.Sprintf("sample rate %d/%d fields", sampleRate, numFields), func(b *testing.B) {
+				defer setup(b, sampleRate)()
+				b.ReportAllocs()
+				for n := 0; n < b.N; n++ {
+					ctx, root := beeline.StartSpan(context.Background(), "root")
+					ctx, child := beeline.StartSpan(ctx, "child")
+					for i, key := range keys {
+						beeline.AddField(ctx, key, i)
+					}
+					child.Send()
+					root.Send()
+				}
+			})
+		}
+	}
+}
+
+var prop = &propagation.PropagationContext{
+	TraceID:      "0af7651916cd43dd8448eb211c80319c",
+	ParentID:     "b7ad6b7169203331",
+	Dataset:      "my-dataset",
+	TraceContext: map[string]interface{}{"user_id": 1},
+}
+
+func BenchmarkMarshal(b *testing.B) {
+	b.Run("honeycomb", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			_ = propagation.MarshalHoneycombTraceContext(prop)
+		}
+	})
+	b.Run("amazon", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			_ = propagation.MarshalAmazonTraceContext(prop)
+		}
+	})
+	b.Run("w3c", func(b *testing.B) {
+		ctx := context.Background()
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			_, _ = propagation.MarshalW3CTraceContext(ctx, prop)
+		}
+	})
+}
+
+func BenchmarkUnmarshal(b *testing.B) {
+	b.Run("honeycomb", func(b *testing.B) {
+		header := propagation.MarshalHoneycombTraceContext(prop)
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			_, _ = propagation.UnmarshalHoneycombTraceContext(header)
+		}
+	})
+	b.Run("amazon", func(b *testing.B) {
+		header := propagation.MarshalAmazonTraceContext(prop)
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			_, _ = propagation.UnmarshalAmazonTraceContext(header)
+		}
+	})
+	b.Run("w3c", func(b *testing.B) {
+		ctx, headers := propagation.MarshalW3CTraceContext(context.Background(), prop)
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			_, _, _ = propagation.UnmarshalW3CTraceContext(ctx, headers)
+		}
+	})
+}
+
+// BenchmarkHandler compares serving a request with a bare handler to serving
+// it through the net/http wrapper, so the difference is the wrapper's
+// overhead.
+func BenchmarkHandler(b *testing.B) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	serve := func(b *testing.B, h http.Handler) {
+		r := httptest.NewRequest("GET", "/hello?name=bee", nil)
+		r.Header.Set(propagation.TracePropagationHTTPHeader, propagation.MarshalHoneycombTraceContext(prop))
+		b.ReportAllocs()
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			h.ServeHTTP(httptest.NewRecorder(), r)
+		}
+	}
+	b.Run("bare", func(b *testing.B) {
+		serve(b, handler)
+	})
+	b.Run("wrapped", func(b *testing.B) {
+		defer setup(b, 1)()
+		serve(b, hnynethttp.WrapHandler(handler))
+	})
+	b.Run("wrapped and dropped", func(b *testing.B) {
+		defer setup(b, 1000)()
+		serve(b, hnynethttp.WrapHandler(handler))
+	})
+}
+
+// BenchmarkTransmission measures how many events a second the default
+// libhoney transmission sustains with a few batching settings, sending to a
+// server that takes a millisecond to accept each batch, as a nearby
+// Honeycomb endpoint or proxy might.
+func BenchmarkTransmission(b *testing.B) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(ioutil.Discard, r.Body)
+		time.Sleep(time.Millisecond)
+		// no per-event statuses; libhoney sends its responses without them
+		w.Write([]byte("[]"))
+	}))
+	defer server.Close()
+	for _, bench := range []struct {
+		name   string
+		config beeline.Config
+	}{
+		{"default", beeline.Config{}},
+		{"serial", beeline.Config{MaxConcurrentBatches: 1}},
+		{"small batches", beeline.Config{MaxBatchSize: 10}},
+		{"large batches", beeline.Config{MaxBatchSize: 1000, BatchTimeout: 10 * time.Millisecond}},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			config := bench.config
+			config.WriteKey = "placeholder"
+			config.Dataset = "placeholder"
+			config.APIHost = server.URL
+			config.PendingWorkCapacity = uint(b.N) + 1
+			beeline.Init(config)
+			b.ReportAllocs()
+			b.ResetTimer()
+			start := time.Now()
+			for n := 0; n < b.N; n++ {
+				_, span := beeline.StartSpan(context.Background(), "span")
+				span.AddField("user_id", n)
+				span.Send()
+			}
+			// Close waits until every event has been sent
+			beeline.Close()
+			b.ReportMetric(float64(b.N)/time.Since(start).Seconds(), "events/s")
+		})
+	}
+}
@@ -0,0 +1,23 @@
+/*
+Package benchmarks measures the beeline's per-request overhead.
+
+Summary
+
+The benchmarks in this package cover the paths that run for every request:
+the span lifecycle, propagation header marshaling and unmarshaling, and the
+net/http wrapper compared to a bare handler. They send events to a discarding
+transmission, so they measure the beeline rather than the network.
+
+baseline.txt holds results from the main branch. To check a change for
+regressions, run the benchmarks before and after it and compare the results
+with benchstat (golang.org/x/perf/cmd/benchstat):
+
+	go test -run xxx -bench . -benchmem -count 5 ./benchmarks > new.txt
+	benchstat baseline.txt new.txt
+
+Update baseline.txt with a new run when a change is expected to move the
+numbers, and note the hardware in the commit message; results are only
+comparable on the same machine.
+
+*/
+package benchmarks
@@ -0,0 +1,53 @@
+package beeline
+
+import (
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+var (
+	buildFieldsOnce sync.Once
+	buildFieldsMap  map[string]interface{}
+)
+
+// buildFields returns fields describing the running binary: the Go version
+// it was built with, and the path and version of its main module and the
+// commit it was built from, when its build info records them.
+func buildFields() map[string]interface{} {
+	buildFieldsOnce.Do(func() {
+		buildFieldsMap = map[string]interface{}{"build.go_version": runtime.Version()}
+		bi, ok := debug.ReadBuildInfo()
+		if !ok {
+			return
+		}
+		if bi.Main.Path != "" {
+			buildFieldsMap["build.path"] = bi.Main.Path
+		}
+		// binaries built from a checkout rather than a module version
+		// have the version (devel)
+		if v := bi.Main.Version; v != "" && v != "(devel)" {
+			buildFieldsMap["service.version"] = v
+		}
+		addVCSFields(bi, buildFieldsMap)
+	})
+	return buildFieldsMap
+}
+
+// rootBuildFields returns the build info fields added to root spans, unless
+// config.OmitBuildInfo is set.
+func rootBuildFields(config Config) map[string]interface{} {
+	if config.OmitBuildInfo {
+		return nil
+	}
+	var fields map[string]interface{}
+	for _, k := range []string{"service.version", "build.commit"} {
+		if v, ok := buildFields()[k]; ok {
+			if fields == nil {
+				fields = make(map[string]interface{})
+			}
+			fields[k] = v
+		}
+	}
+	return fields
+}
@@ -0,0 +1,21 @@
+//go:build go1.18
+// +build go1.18
+
+package beeline
+
+import "runtime/debug"
+
+// addVCSFields adds the commit bi was built from, as recorded by go build
+// since Go 1.18, to fields.
+func addVCSFields(bi *debug.BuildInfo, fields map[string]interface{}) {
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			fields["build.commit"] = s.Value
+		case "vcs.time":
+			fields["build.commit_time"] = s.Value
+		case "vcs.modified":
+			fields["build.modified"] = s.Value == "true"
+		}
+	}
+}
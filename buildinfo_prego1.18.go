@@ -0,0 +1,10 @@
+//go:build !go1.18
+// +build !go1.18
+
+package beeline
+
+import "runtime/debug"
+
+// addVCSFields does nothing, since go build only records the commit a binary
+// was built from since Go 1.18.
+func addVCSFields(bi *debug.BuildInfo, fields map[string]interface{}) {}
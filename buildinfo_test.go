@@ -0,0 +1,42 @@
+package beeline
+
+import (
+	"context"
+	"testing"
+
+	"github.com/honeycombio/libhoney-go/transmission"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildInfoFields(t *testing.T) {
+	// test binaries have no module version or commit of their own
+	buildFields()
+	saved := buildFieldsMap
+	buildFieldsMap = map[string]interface{}{
+		"build.go_version": "go1.18",
+		"service.version":  "v1.2.3",
+		"build.commit":     "0123abcd",
+	}
+	defer func() { buildFieldsMap = saved }()
+
+	mo := &transmission.MockSender{}
+	bl := New(Config{Transmission: mo})
+	defer bl.Close()
+	ctx, root := bl.StartTrace(context.Background(), "root")
+	_, child := bl.StartSpan(ctx, "child")
+	child.Send()
+	root.Send()
+	evs := mo.Events()
+	if assert.Equal(t, 2, len(evs)) {
+		assert.NotContains(t, evs[0].Data, "service.version", "only root spans get build info")
+		assert.Equal(t, "v1.2.3", evs[1].Data["service.version"])
+		assert.Equal(t, "0123abcd", evs[1].Data["build.commit"])
+		assert.NotContains(t, evs[1].Data, "build.go_version")
+	}
+
+	omit := New(Config{Transmission: mo, OmitBuildInfo: true})
+	defer omit.Close()
+	_, root = omit.StartTrace(context.Background(), "root")
+	root.Send()
+	assert.NotContains(t, mo.Events()[2].Data, "service.version")
+}
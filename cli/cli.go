@@ -0,0 +1,169 @@
+// Package cli traces runs of command line tools. Short-lived tools tend to
+// lose their last trace, or their only one, because they exit before the
+// beeline's batches are sent; Run sends a command's root span and flushes
+// the beeline, within a deadline, before it returns, and Exit does the same
+// for tools that call os.Exit.
+//
+// Run doesn't depend on any command line framework. With cobra, wrap a
+// command's RunE:
+//
+//	RunE: func(cmd *cobra.Command, args []string) error {
+//		flags := map[string]string{}
+//		cmd.Flags().Visit(func(f *pflag.Flag) { flags[f.Name] = f.Value.String() })
+//		return cli.Run(cmd.Context(), cmd.CommandPath(), flags, func(ctx context.Context) error {
+//			return deploy(ctx, args)
+//		})
+//	},
+//
+// and with urfave/cli, whose package name this one shares, an Action:
+//
+//	Action: func(c *cli.Context) error {
+//		flags := map[string]string{}
+//		for _, name := range c.FlagNames() {
+//			flags[name] = c.String(name)
+//		}
+//		return hnycli.Run(c.Context, c.Command.FullName(), flags, deploy)
+//	},
+//
+// Programs using the standard flag package can pass Flags(flag.CommandLine).
+package cli
+
+import (
+	"context"
+	"flag"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	beeline "github.com/honeycombio/beeline-go"
+	"github.com/honeycombio/beeline-go/scrub"
+)
+
+// DefaultFlushTimeout is how long Run and Exit wait for events to be sent
+// when Options.FlushTimeout isn't set.
+const DefaultFlushTimeout = 5 * time.Second
+
+// Options configures Run.
+type Options struct {
+	// FlushTimeout bounds how long Run waits for the beeline's events to be
+	// sent after the command finishes. default: DefaultFlushTimeout
+	FlushTimeout time.Duration
+	// Redact reports whether the value of the flag name should be hidden in
+	// cli.flags. default: flags whose names, with dashes read as
+	// underscores, match scrub.SensitiveKeys
+	Redact func(name string) bool
+}
+
+// Run runs fn with the default Options. See Options.Run.
+func Run(ctx context.Context, path string, flags map[string]string, fn func(context.Context) error) error {
+	return Options{}.Run(ctx, path, flags, fn)
+}
+
+// Run runs fn in a span for the command path, like "tool deploy", continuing
+// the trace in ctx or, for tools started by an instrumented parent, the one
+// in the environment, and starting a new one otherwise. The span records the
+// command in cli.command, the flags that were set in cli.flags, with the
+// values of sensitive ones redacted, and fn's exit code and error in
+// cli.exit_code and cli.error. It is sent, and the beeline flushed, before Run
+// returns fn's error.
+//
+// The exit code is that of an error with an ExitCode method, like those of
+// urfave/cli's cli.Exit and os/exec; otherwise it is 1 if fn fails and 0 if
+// it succeeds. A panic in fn is recorded with exit code 2, flushed and
+// re-raised.
+func (o Options) Run(ctx context.Context, path string, flags map[string]string, fn func(context.Context) error) (err error) {
+	ctx, span := beeline.StartSpan(ctx, path)
+	span.AddField("meta.type", "cli")
+	span.AddField("cli.command", path)
+	if len(flags) > 0 {
+		span.AddField("cli.flags", o.redact(flags))
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			span.AddField("cli.exit_code", 2)
+			span.AddField("cli.panic", p)
+			span.Send()
+			o.flush(ctx)
+			panic(p)
+		}
+		code := ExitCode(err)
+		span.AddField("cli.exit_code", code)
+		if err != nil {
+			span.AddField("cli.error", err.Error())
+		}
+		span.Send()
+		o.flush(ctx)
+	}()
+	return fn(ctx)
+}
+
+// Exit flushes the beeline, waiting at most DefaultFlushTimeout, and exits
+// with code, for tools that exit with os.Exit, which skips deferred calls.
+func Exit(code int) {
+	Options{}.flush(context.Background())
+	os.Exit(code)
+}
+
+// ExitCode returns the exit code for a command that failed with err, as
+// described for Run.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	if coder, ok := err.(interface{ ExitCode() int }); ok {
+		return coder.ExitCode()
+	}
+	return 1
+}
+
+// Flags returns the flags set in fs, by name, for Run.
+func Flags(fs *flag.FlagSet) map[string]string {
+	flags := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) {
+		flags[f.Name] = f.Value.String()
+	})
+	return flags
+}
+
+// redact returns the flags as "name=value", with sensitive values hidden.
+func (o Options) redact(flags map[string]string) []string {
+	redact := o.Redact
+	if redact == nil {
+		redact = sensitive
+	}
+	list := make([]string, 0, len(flags))
+	for name, value := range flags {
+		if redact(name) {
+			value = scrub.DefaultReplacement
+		}
+		list = append(list, name+"="+value)
+	}
+	sort.Strings(list)
+	return list
+}
+
+func sensitive(name string) bool {
+	return scrub.SensitiveKeys.MatchString(strings.Replace(name, "-", "_", -1))
+}
+
+// flush flushes the beeline, giving up after the flush timeout so a stuck
+// connection to Honeycomb can't keep the tool from exiting.
+func (o Options) flush(ctx context.Context) {
+	timeout := o.FlushTimeout
+	if timeout <= 0 {
+		timeout = DefaultFlushTimeout
+	}
+	done := make(chan struct{})
+	go func() {
+		// not Flush, which would send the rest of a trace continued from ctx
+		beeline.FlushFinished(ctx)
+		close(done)
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C:
+	}
+}
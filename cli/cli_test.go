@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	beeline "github.com/honeycombio/beeline-go"
+	"github.com/honeycombio/beeline-go/trace"
+	"github.com/honeycombio/libhoney-go/transmission"
+)
+
+type exitError struct{ code int }
+
+func (e exitError) Error() string { return "exit" }
+func (e exitError) ExitCode() int { return e.code }
+
+func TestRun(t *testing.T) {
+	mo := &transmission.MockSender{}
+	beeline.Init(beeline.Config{Transmission: mo})
+	defer beeline.Close()
+
+	fs := flag.NewFlagSet("tool", flag.ContinueOnError)
+	fs.String("region", "", "")
+	fs.String("api-key", "", "")
+	fs.Bool("verbose", false, "")
+	assert.NoError(t, fs.Parse([]string{"--region", "us-east-1", "--api-key", "abc123"}))
+
+	var inner context.Context
+	err := Run(context.Background(), "tool deploy", Flags(fs), func(ctx context.Context) error {
+		inner = ctx
+		_, span := beeline.StartSpan(ctx, "upload")
+		span.Send()
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Len(t, mo.Events(), 2, "Run should flush before returning")
+
+	err = Run(context.Background(), "tool rollback", nil, func(context.Context) error {
+		return exitError{3}
+	})
+	assert.Equal(t, exitError{3}, err)
+	assert.Panics(t, func() {
+		Options{Redact: func(string) bool { return false }}.Run(context.Background(), "tool crash", nil, func(context.Context) error {
+			panic("boom")
+		})
+	})
+
+	events := mo.Events()
+	if !assert.Len(t, events, 4) {
+		return
+	}
+	assert.NotNil(t, trace.GetSpanFromContext(inner))
+	deploy := events[1].Data
+	assert.Equal(t, "tool deploy", deploy["name"])
+	assert.Equal(t, events[1].Data["trace.span_id"], events[0].Data["trace.parent_id"])
+	assert.Equal(t, []string{"api-key=[REDACTED]", "region=us-east-1"}, deploy["cli.flags"])
+	assert.Equal(t, 0, deploy["cli.exit_code"])
+	assert.Nil(t, deploy["cli.error"])
+
+	assert.Equal(t, 3, events[2].Data["cli.exit_code"])
+	assert.Equal(t, "exit", events[2].Data["cli.error"])
+	assert.Nil(t, events[2].Data["cli.flags"])
+
+	assert.Equal(t, 2, events[3].Data["cli.exit_code"])
+	assert.Equal(t, "boom", events[3].Data["cli.panic"])
+}
+
+func TestExitCode(t *testing.T) {
+	assert.Equal(t, 0, ExitCode(nil))
+	assert.Equal(t, 1, ExitCode(errors.New("failed")))
+	assert.Equal(t, 7, ExitCode(exitError{7}))
+	var ee *exec.ExitError
+	assert.Implements(t, (*interface{ ExitCode() int })(nil), ee)
+}
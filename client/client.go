@@ -4,24 +4,56 @@
 package client
 
 import (
+	"sync"
+
 	libhoney "github.com/honeycombio/libhoney-go"
 	"github.com/honeycombio/libhoney-go/transmission"
 )
 
-var client = &libhoney.Client{}
+var (
+	client = &libhoney.Client{}
+	// writeKey and dataset, when set, override the client's own values on
+	// builders handed out by NewBuilder.
+	writeKey string
+	dataset  string
+	// isSet is true once a client has been given to Set; until then client
+	// is a placeholder whose transmission never closes its responses.
+	isSet bool
+	lock  sync.RWMutex
+)
 
-// Set the active libhoney client used by the beeline
+// Set the active libhoney client used by the beeline. Setting a client clears
+// any defaults set with SetDefaults.
 func Set(c *libhoney.Client) {
+	lock.Lock()
+	defer lock.Unlock()
 	client = c
+	isSet = c != nil
+	writeKey = ""
+	dataset = ""
 }
 
 // Get returns the libhoney client used by the beeline
 func Get() *libhoney.Client {
+	lock.RLock()
+	defer lock.RUnlock()
 	return client
 }
 
+// SetDefaults overrides the write key and dataset of builders created by
+// NewBuilder without replacing the client. Empty values leave the client's own
+// setting in place. It is safe to call while other goroutines are creating
+// builders.
+func SetDefaults(key, ds string) {
+	lock.Lock()
+	defer lock.Unlock()
+	writeKey = key
+	dataset = ds
+}
+
 // Close the libhoney client
 func Close() {
+	client := Get()
 	if client != nil {
 		client.Close()
 	}
@@ -29,6 +61,7 @@ func Close() {
 
 // Flush all pending events in the libhoney client
 func Flush() {
+	client := Get()
 	if client != nil {
 		client.Flush()
 	}
@@ -36,21 +69,36 @@ func Flush() {
 
 // AddField adds the given field at the client level
 func AddField(name string, val interface{}) {
+	client := Get()
 	if client != nil {
 		client.AddField(name, val)
 	}
 }
 
 func NewBuilder() *libhoney.Builder {
+	lock.RLock()
+	defer lock.RUnlock()
 	if client != nil {
-		return client.NewBuilder()
+		b := client.NewBuilder()
+		if writeKey != "" {
+			b.WriteKey = writeKey
+		}
+		if dataset != "" {
+			b.Dataset = dataset
+		}
+		return b
 	}
 	return &libhoney.Builder{}
 }
 
+// TxResponses returns the libhoney client's channel of send responses, or a
+// closed channel if no client has been set
 func TxResponses() chan transmission.Response {
-	if client != nil {
-		client.TxResponses()
+	lock.RLock()
+	client, set := client, isSet
+	lock.RUnlock()
+	if set {
+		return client.TxResponses()
 	}
 
 	c := make(chan transmission.Response)
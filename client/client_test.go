@@ -3,6 +3,10 @@ package client
 import (
 	"fmt"
 	"testing"
+
+	libhoney "github.com/honeycombio/libhoney-go"
+	"github.com/honeycombio/libhoney-go/transmission"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestClientWrappersWorkWithoutInit(t *testing.T) {
@@ -20,3 +24,35 @@ func TestClientWrappersWorkWithoutInit(t *testing.T) {
 		fmt.Println(r.Body)
 	}
 }
+
+func TestSetDefaults(t *testing.T) {
+	c, _ := libhoney.NewClient(libhoney.ClientConfig{
+		APIKey:       "key",
+		Dataset:      "ds",
+		Transmission: &transmission.MockSender{},
+	})
+	Set(c)
+	b := NewBuilder()
+	assert.Equal(t, "key", b.WriteKey, "builders should use the client's write key")
+	assert.Equal(t, "ds", b.Dataset, "builders should use the client's dataset")
+
+	SetDefaults("", "other")
+	b = NewBuilder()
+	assert.Equal(t, "key", b.WriteKey, "empty default write key should keep the client's write key")
+	assert.Equal(t, "other", b.Dataset, "default dataset should override the client's dataset")
+
+	Set(c)
+	b = NewBuilder()
+	assert.Equal(t, "ds", b.Dataset, "setting a client should clear defaults")
+}
+
+func TestTxResponses(t *testing.T) {
+	mo := &transmission.MockSender{}
+	c, _ := libhoney.NewClient(libhoney.ClientConfig{
+		APIKey:       "key",
+		Dataset:      "ds",
+		Transmission: mo,
+	})
+	Set(c)
+	assert.Equal(t, mo.TxResponses(), TxResponses(), "responses should come from the client's transmission")
+}
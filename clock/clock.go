@@ -0,0 +1,66 @@
+// Package clock provides clock sources for span timestamps that hold up on
+// hosts with skewed or stepping clocks, for use as beeline.Config.Clock or
+// trace.Config.Clock.
+//
+// Containers and VMs often run with clocks that are off by seconds, or that
+// jump when they are synced, which makes traces show children starting before
+// their parents when spans from different hosts, or from before and after a
+// jump, are put together. Monotonic clocks don't jump, and an Offset, which
+// can be measured against an NTP server with SyncNTP, corrects the skew.
+package clock
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Monotonic returns a clock that reads the wall clock once, when Monotonic is
+// called, and then advances with the monotonic clock, so its readings keep
+// moving forward steadily even if the wall clock is stepped. The readings
+// drift from the wall clock by as much as it is stepped, so long-running
+// processes may want to correct them with an Offset measured with SyncNTP.
+func Monotonic() func() time.Time {
+	start := time.Now()
+	return func() time.Time {
+		return start.Add(time.Since(start))
+	}
+}
+
+// Offset is a correction added to a clock's readings, which may be updated
+// while the clock is in use, eg by SyncNTP. The zero Offset adds nothing.
+type Offset struct {
+	nanos int64
+}
+
+// Set replaces the offset.
+func (o *Offset) Set(d time.Duration) {
+	atomic.StoreInt64(&o.nanos, int64(d))
+}
+
+// Get returns the offset.
+func (o *Offset) Get() time.Duration {
+	return time.Duration(atomic.LoadInt64(&o.nanos))
+}
+
+// SyncNTP measures how far the local clock is from the clock of the NTP
+// server at addr, a host with an optional port, and sets the offset to
+// correct it. If the server can't be reached the offset is left alone.
+func (o *Offset) SyncNTP(addr string, timeout time.Duration) error {
+	d, err := NTPOffset(addr, timeout)
+	if err != nil {
+		return err
+	}
+	o.Set(d)
+	return nil
+}
+
+// WithOffset returns a clock whose readings are those of clock, or time.Now
+// if it is nil, corrected by offset.
+func WithOffset(clock func() time.Time, offset *Offset) func() time.Time {
+	if clock == nil {
+		clock = time.Now
+	}
+	return func() time.Time {
+		return clock().Add(offset.Get())
+	}
+}
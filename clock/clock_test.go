@@ -0,0 +1,69 @@
+package clock
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMonotonic(t *testing.T) {
+	now := Monotonic()
+	first := now()
+	second := now()
+	assert.False(t, second.Before(first))
+	assert.WithinDuration(t, time.Now(), first, time.Second)
+}
+
+func TestWithOffset(t *testing.T) {
+	fixed := time.Unix(1000, 0)
+	var offset Offset
+	now := WithOffset(func() time.Time { return fixed }, &offset)
+	assert.Equal(t, fixed, now())
+	offset.Set(-time.Second)
+	assert.Equal(t, fixed.Add(-time.Second), now())
+	assert.Equal(t, -time.Second, offset.Get())
+}
+
+// serveNTP answers one SNTP request with times skew ahead of the local clock.
+func serveNTP(t *testing.T, skew time.Duration, stratum byte) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		defer conn.Close()
+		buf := make([]byte, ntpPacketSize)
+		_, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		resp := make([]byte, ntpPacketSize)
+		resp[0] = 4<<3 | 4
+		resp[1] = stratum
+		putNTPTime(resp[32:40], time.Now().Add(skew))
+		putNTPTime(resp[40:48], time.Now().Add(skew))
+		conn.WriteTo(resp, addr)
+	}()
+	return conn.LocalAddr().String()
+}
+
+func putNTPTime(b []byte, t time.Time) {
+	binary.BigEndian.PutUint32(b[:4], uint32(t.Unix()+ntpEpochOffset))
+	binary.BigEndian.PutUint32(b[4:8], uint32((int64(t.Nanosecond())<<32)/1e9))
+}
+
+func TestNTPOffset(t *testing.T) {
+	offset, err := NTPOffset(serveNTP(t, 5*time.Second, 2), time.Second)
+	assert.NoError(t, err)
+	assert.InDelta(t, float64(5*time.Second), float64(offset), float64(100*time.Millisecond))
+
+	var o Offset
+	assert.NoError(t, o.SyncNTP(serveNTP(t, -3*time.Second, 2), time.Second))
+	assert.InDelta(t, float64(-3*time.Second), float64(o.Get()), float64(100*time.Millisecond))
+
+	assert.Error(t, o.SyncNTP(serveNTP(t, time.Hour, 0), time.Second), "kiss-of-death responses should be rejected")
+	assert.InDelta(t, float64(-3*time.Second), float64(o.Get()), float64(100*time.Millisecond), "failed syncs should leave the offset alone")
+}
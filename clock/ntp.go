@@ -0,0 +1,71 @@
+package clock
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+const (
+	// ntpEpochOffset is the number of seconds between the NTP epoch, 1900,
+	// and the Unix epoch, 1970.
+	ntpEpochOffset = 2208988800
+	ntpPacketSize  = 48
+	defaultNTPPort = "123"
+)
+
+// NTPOffset asks the NTP server at addr, a host with an optional port, for the
+// time with a single SNTP (RFC 4330) request, and returns how far the local
+// clock is behind it: the duration to add to local readings to match the
+// server.
+func NTPOffset(addr string, timeout time.Duration) (time.Duration, error) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, defaultNTPPort)
+	}
+	conn, err := net.DialTimeout("udp", addr, timeout)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return 0, err
+	}
+
+	req := make([]byte, ntpPacketSize)
+	// leap indicator 0, version 4, mode 3 (client)
+	req[0] = 0<<6 | 4<<3 | 3
+	sent := time.Now()
+	if _, err := conn.Write(req); err != nil {
+		return 0, err
+	}
+	resp := make([]byte, ntpPacketSize)
+	n, err := conn.Read(resp)
+	received := time.Now()
+	if err != nil {
+		return 0, err
+	}
+	if n < ntpPacketSize {
+		return 0, fmt.Errorf("short NTP response from %s: %d bytes", addr, n)
+	}
+	if mode := resp[0] & 0x7; mode != 4 {
+		return 0, fmt.Errorf("unexpected NTP mode %d from %s", mode, addr)
+	}
+	if stratum := resp[1]; stratum == 0 {
+		return 0, errors.New("NTP server " + addr + " sent a kiss-of-death response")
+	}
+	serverReceived := ntpTime(resp[32:40])
+	serverSent := ntpTime(resp[40:48])
+	// the clock offset as defined by RFC 4330
+	offset := (serverReceived.Sub(sent) + serverSent.Sub(received)) / 2
+	return offset, nil
+}
+
+// ntpTime decodes an NTP timestamp: seconds since 1900 and a binary fraction
+// of a second.
+func ntpTime(b []byte) time.Time {
+	secs := int64(binary.BigEndian.Uint32(b[:4])) - ntpEpochOffset
+	frac := int64(binary.BigEndian.Uint32(b[4:8]))
+	return time.Unix(secs, (frac*1e9)>>32)
+}
@@ -0,0 +1,50 @@
+// Command beelinegen generates instrumented decorators for interfaces, for
+// use in go:generate directives. See package codegen for what the decorators
+// do.
+//
+// Usage:
+//
+//	beelinegen -type Repository [-prefix repo] [-args] [-o repository_beeline.go]
+//
+// It reads the package in the current directory, or the one given with -dir,
+// and writes the decorator to the -o file, by default the interface's name in
+// lower case followed by _beeline.go.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/honeycombio/beeline-go/codegen"
+)
+
+func main() {
+	var opts codegen.Options
+	flag.StringVar(&opts.Type, "type", "", "the interface to decorate")
+	flag.StringVar(&opts.Prefix, "prefix", "", "the prefix of the decorator's field names (default the interface's name, lower case)")
+	flag.BoolVar(&opts.Args, "args", false, "add parameters of basic types as fields")
+	dir := flag.String("dir", ".", "the directory of the package declaring the interface")
+	output := flag.String("o", "", "the file to write (default <type>_beeline.go)")
+	flag.Parse()
+	if opts.Type == "" {
+		fmt.Fprintln(os.Stderr, "beelinegen: -type is required")
+		flag.Usage()
+		os.Exit(2)
+	}
+	src, err := codegen.Generate(*dir, opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "beelinegen:", err)
+		os.Exit(1)
+	}
+	if *output == "" {
+		*output = filepath.Join(*dir, strings.ToLower(opts.Type)+"_beeline.go")
+	}
+	if err := ioutil.WriteFile(*output, src, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, "beelinegen:", err)
+		os.Exit(1)
+	}
+}
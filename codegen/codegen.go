@@ -0,0 +1,371 @@
+// Package codegen generates instrumented decorators for interfaces: types
+// that wrap an implementation of the interface and start a span around each
+// of its methods that takes a context.Context, so repository and service
+// interfaces don't need hand-written tracing wrappers. The beelinegen command
+// runs it from go:generate directives:
+//
+//	//go:generate beelinegen -type Repository
+//
+// For an interface Repository it writes a TracedRepository struct embedding
+// it, with a NewTracedRepository constructor. Each method whose first
+// parameter is a context.Context starts a span named after the interface and
+// method, eg Repository.GetUser, records the error it returns, if any, and
+// can add fields of its own: with Options.Args set, parameters of basic types
+// are added as fields named after the prefix and parameter, and the
+// decorator's Fields hook, if set, is called with the method name and
+// arguments of every call to add any others. Methods without a context are
+// passed straight through.
+package codegen
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const beelinePath = "github.com/honeycombio/beeline-go"
+
+// Options configures the decorator Generate writes.
+type Options struct {
+	// Type is the name of the interface to decorate.
+	Type string
+	// Prefix starts the names of the fields the decorator adds, like
+	// repository.error. default: the interface's name, lower case
+	Prefix string
+	// Args, if set, adds the parameters of basic types, like strings and
+	// ints, as fields. The argument values are sent to Honeycomb, so only
+	// set it for interfaces whose arguments aren't sensitive.
+	Args bool
+}
+
+// Generate returns the source of a decorator for the interface opts.Type,
+// declared in the package in dir.
+func Generate(dir string, opts Options) ([]byte, error) {
+	if opts.Type == "" {
+		return nil, errors.New("no interface given")
+	}
+	if opts.Prefix == "" {
+		opts.Prefix = strings.ToLower(opts.Type)
+	}
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, pkg := range pkgs {
+		g := &generator{fset: fset, pkg: pkg, opts: opts, imports: map[string]string{}}
+		iface, file := g.findInterface(opts.Type)
+		if iface == nil {
+			continue
+		}
+		methods, err := g.methods(iface, file)
+		if err != nil {
+			return nil, err
+		}
+		return g.generate(methods)
+	}
+	return nil, fmt.Errorf("no interface %s in %s", opts.Type, dir)
+}
+
+type generator struct {
+	fset *token.FileSet
+	pkg  *ast.Package
+	opts Options
+	// imports maps the names of packages the generated code refers to to
+	// their paths
+	imports map[string]string
+}
+
+// method is a method of the interface, with the file it's declared in, for
+// its imports.
+type method struct {
+	name string
+	typ  *ast.FuncType
+	file *ast.File
+}
+
+// findInterface returns the declaration of the interface name and the file
+// it's in.
+func (g *generator) findInterface(name string) (*ast.InterfaceType, *ast.File) {
+	for _, f := range g.pkg.Files {
+		for _, decl := range f.Decls {
+			gd, ok := decl.(*ast.GenDecl)
+			if !ok || gd.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gd.Specs {
+				ts := spec.(*ast.TypeSpec)
+				if ts.Name.Name != name {
+					continue
+				}
+				if it, ok := ts.Type.(*ast.InterfaceType); ok {
+					return it, f
+				}
+			}
+		}
+	}
+	return nil, nil
+}
+
+// methods returns the methods of iface, including those of interfaces it
+// embeds from the same package, sorted by name. Methods of interfaces
+// embedded from other packages are passed through by the embedded interface.
+func (g *generator) methods(iface *ast.InterfaceType, file *ast.File) ([]method, error) {
+	var methods []method
+	for _, m := range iface.Methods.List {
+		switch t := m.Type.(type) {
+		case *ast.FuncType:
+			for _, name := range m.Names {
+				methods = append(methods, method{name: name.Name, typ: t, file: file})
+			}
+		case *ast.Ident:
+			embedded, f := g.findInterface(t.Name)
+			if embedded == nil {
+				return nil, fmt.Errorf("embedded interface %s not found", t.Name)
+			}
+			more, err := g.methods(embedded, f)
+			if err != nil {
+				return nil, err
+			}
+			methods = append(methods, more...)
+		}
+	}
+	sort.Slice(methods, func(i, j int) bool { return methods[i].name < methods[j].name })
+	return methods, nil
+}
+
+// expr prints e, which appears in file, noting the imports it needs.
+func (g *generator) expr(e ast.Expr, file *ast.File) string {
+	ast.Inspect(e, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if id, ok := sel.X.(*ast.Ident); ok {
+			if path := importPath(file, id.Name); path != "" {
+				g.imports[id.Name] = path
+			}
+		}
+		return true
+	})
+	var buf bytes.Buffer
+	printer.Fprint(&buf, g.fset, e)
+	return buf.String()
+}
+
+// importPath returns the path of the package file imports as name.
+func importPath(file *ast.File, name string) string {
+	for _, imp := range file.Imports {
+		path, err := strconv.Unquote(imp.Path.Value)
+		if err != nil {
+			continue
+		}
+		n := path[strings.LastIndex(path, "/")+1:]
+		if imp.Name != nil {
+			n = imp.Name.Name
+		}
+		if n == name {
+			return path
+		}
+	}
+	return ""
+}
+
+// param is a parameter or result of a generated method.
+type param struct {
+	name     string
+	typ      string
+	variadic bool
+	// named is set if the parameter is named in the interface
+	named bool
+}
+
+var basicTypes = map[string]bool{
+	"string": true, "bool": true,
+	"int": true, "int8": true, "int16": true, "int32": true, "int64": true,
+	"uint": true, "uint8": true, "uint16": true, "uint32": true, "uint64": true,
+	"float32": true, "float64": true, "byte": true, "rune": true,
+}
+
+// fields expands a parameter list into one param per name, naming unnamed
+// and blank parameters with prefix and their position, and renaming any
+// that would collide with the names the generated code uses.
+func (g *generator) fields(list *ast.FieldList, file *ast.File, prefix string, used map[string]bool) []param {
+	if list == nil {
+		return nil
+	}
+	var params []param
+	for _, f := range list.List {
+		typ, variadic := f.Type, false
+		if ell, ok := typ.(*ast.Ellipsis); ok {
+			typ, variadic = ell.Elt, true
+		}
+		names := f.Names
+		if len(names) == 0 {
+			names = []*ast.Ident{{Name: "_"}}
+		}
+		for _, n := range names {
+			name := n.Name
+			named := name != "_" && !used[name]
+			if id, ok := typ.(*ast.Ident); !named && ok && id.Name == "error" && !used["err"] {
+				name = "err"
+			} else if !named {
+				for i := len(params); ; i++ {
+					name = fmt.Sprintf("%s%d", prefix, i)
+					if !used[name] {
+						break
+					}
+				}
+			}
+			used[name] = true
+			params = append(params, param{name: name, typ: g.expr(typ, file), variadic: variadic, named: named})
+		}
+	}
+	return params
+}
+
+// takesContext reports whether m's first parameter is a context.Context.
+func takesContext(m method) bool {
+	if len(m.typ.Params.List) == 0 {
+		return false
+	}
+	sel, ok := m.typ.Params.List[0].Type.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "Context" {
+		return false
+	}
+	id, ok := sel.X.(*ast.Ident)
+	return ok && importPath(m.file, id.Name) == "context"
+}
+
+func (g *generator) generate(methods []method) ([]byte, error) {
+	var body bytes.Buffer
+	typ := g.opts.Type
+	traced := "Traced" + typ
+	fmt.Fprintf(&body, "// %s wraps a %s, starting a span for each call of its methods\n", traced, typ)
+	fmt.Fprintf(&body, "// that take a context.Context.\n")
+	fmt.Fprintf(&body, "type %s struct {\n\t%s\n", traced, typ)
+	fmt.Fprintf(&body, "\t// Fields, if set, is called with the name and arguments, other than the\n")
+	fmt.Fprintf(&body, "\t// context, of each call, and the fields it returns are added to the\n")
+	fmt.Fprintf(&body, "\t// call's span.\n")
+	fmt.Fprintf(&body, "\tFields func(method string, args ...interface{}) map[string]interface{}\n}\n\n")
+	fmt.Fprintf(&body, "// New%s returns a %s wrapping inner.\n", traced, traced)
+	fmt.Fprintf(&body, "func New%s(inner %s) *%s {\n\treturn &%s{%s: inner}\n}\n", traced, typ, traced, traced, typ)
+
+	for _, m := range methods {
+		if !takesContext(m) {
+			// passed through by the embedded interface
+			continue
+		}
+		used := map[string]bool{"w": true, "span": true, "beeline": true}
+		params := g.fields(m.typ.Params, m.file, "p", used)
+		results := g.fields(m.typ.Results, m.file, "r", used)
+		ctx := params[0].name
+		var decl, args, fieldArgs, names []string
+		for i, p := range params {
+			t := p.typ
+			arg := p.name
+			if p.variadic {
+				t = "..." + t
+				arg += "..."
+			}
+			decl = append(decl, p.name+" "+t)
+			args = append(args, arg)
+			if i > 0 {
+				fieldArgs = append(fieldArgs, p.name)
+			}
+		}
+		var rdecl []string
+		errResult := ""
+		for _, r := range results {
+			rdecl = append(rdecl, r.name+" "+r.typ)
+			names = append(names, r.name)
+			if r.typ == "error" {
+				errResult = r.name
+			}
+		}
+		fmt.Fprintf(&body, "\n// %s calls %s on the wrapped %s in a span.\n", m.name, m.name, typ)
+		fmt.Fprintf(&body, "func (w *%s) %s(%s)", traced, m.name, strings.Join(decl, ", "))
+		if len(rdecl) > 0 {
+			fmt.Fprintf(&body, " (%s)", strings.Join(rdecl, ", "))
+		}
+		fmt.Fprintf(&body, " {\n")
+		fmt.Fprintf(&body, "\t%s, span := beeline.StartSpan(%s, %q)\n", ctx, ctx, typ+"."+m.name)
+		fmt.Fprintf(&body, "\tdefer span.Send()\n")
+		if g.opts.Args {
+			for _, p := range params[1:] {
+				if basicTypes[p.typ] && p.named && !p.variadic {
+					fmt.Fprintf(&body, "\tspan.AddField(%q, %s)\n", g.opts.Prefix+"."+p.name, p.name)
+				}
+			}
+		}
+		fmt.Fprintf(&body, "\tif w.Fields != nil {\n")
+		fmt.Fprintf(&body, "\t\tspan.AddFields(w.Fields(%s))\n", strings.Join(append([]string{strconv.Quote(m.name)}, fieldArgs...), ", "))
+		fmt.Fprintf(&body, "\t}\n")
+		call := fmt.Sprintf("w.%s.%s(%s)", typ, m.name, strings.Join(args, ", "))
+		if len(names) > 0 {
+			fmt.Fprintf(&body, "\t%s = %s\n", strings.Join(names, ", "), call)
+		} else {
+			fmt.Fprintf(&body, "\t%s\n", call)
+		}
+		if errResult != "" {
+			fmt.Fprintf(&body, "\tif %s != nil {\n", errResult)
+			fmt.Fprintf(&body, "\t\tspan.AddField(%q, %s.Error())\n", g.opts.Prefix+".error", errResult)
+			fmt.Fprintf(&body, "\t}\n")
+		}
+		if len(names) > 0 {
+			fmt.Fprintf(&body, "\treturn %s\n", strings.Join(names, ", "))
+		}
+		fmt.Fprintf(&body, "}\n")
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by beelinegen; DO NOT EDIT.\n\n")
+	fmt.Fprintf(&out, "package %s\n\n", g.pkg.Name)
+	g.imports["beeline"] = beelinePath
+	var paths []string
+	named := make(map[string]string)
+	for name, path := range g.imports {
+		paths = append(paths, path)
+		if path[strings.LastIndex(path, "/")+1:] != name && path != beelinePath {
+			named[path] = name
+		}
+	}
+	// the standard library first, as goimports would
+	sort.Slice(paths, func(i, j int) bool {
+		si, sj := isStd(paths[i]), isStd(paths[j])
+		if si != sj {
+			return si
+		}
+		return paths[i] < paths[j]
+	})
+	fmt.Fprintf(&out, "import (\n")
+	for i, path := range paths {
+		if i > 0 && isStd(path) != isStd(paths[i-1]) {
+			fmt.Fprintf(&out, "\n")
+		}
+		if name, ok := named[path]; ok {
+			fmt.Fprintf(&out, "\t%s %q\n", name, path)
+		} else {
+			fmt.Fprintf(&out, "\t%q\n", path)
+		}
+	}
+	fmt.Fprintf(&out, ")\n\n")
+	out.Write(body.Bytes())
+	return format.Source(out.Bytes())
+}
+
+// isStd reports whether path is a standard library package's.
+func isStd(path string) bool {
+	return !strings.Contains(strings.SplitN(path, "/", 2)[0], ".")
+}
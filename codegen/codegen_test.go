@@ -0,0 +1,73 @@
+package codegen_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/honeycombio/libhoney-go/transmission"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/honeycombio/beeline-go"
+	"github.com/honeycombio/beeline-go/codegen"
+	"github.com/honeycombio/beeline-go/codegen/internal/example"
+)
+
+func TestGenerateUpToDate(t *testing.T) {
+	dir := filepath.Join("internal", "example")
+	src, err := codegen.Generate(dir, codegen.Options{Type: "Store", Prefix: "store", Args: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := ioutil.ReadFile(filepath.Join(dir, "store_beeline.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, string(want), string(src), "run go generate ./codegen/... to update the example")
+
+	_, err = codegen.Generate(dir, codegen.Options{Type: "Missing"})
+	assert.Error(t, err)
+}
+
+type store struct{ example.Store }
+
+func (store) Get(ctx context.Context, id string) ([]byte, error) {
+	return nil, errors.New("not found")
+}
+
+func (store) Put(ctx context.Context, id string, data []byte, ttl time.Duration) error {
+	return nil
+}
+
+func (store) Name() string { return "memory" }
+
+func TestTracedStore(t *testing.T) {
+	mo := &transmission.MockSender{}
+	beeline.Init(beeline.Config{Transmission: mo})
+	defer beeline.Close()
+
+	traced := example.NewTracedStore(store{})
+	traced.Fields = func(method string, args ...interface{}) map[string]interface{} {
+		return map[string]interface{}{"store.method": method, "store.args": len(args)}
+	}
+	ctx := context.Background()
+	_, err := traced.Get(ctx, "a")
+	assert.Error(t, err)
+	assert.NoError(t, traced.Put(ctx, "b", []byte("data"), time.Minute))
+	assert.Equal(t, "memory", traced.Name())
+
+	events := mo.Events()
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, "Store.Get", events[0].Data["name"])
+		assert.Equal(t, "a", events[0].Data["store.id"])
+		assert.Equal(t, "not found", events[0].Data["store.error"])
+		assert.Equal(t, "Get", events[0].Data["store.method"])
+		assert.Equal(t, "Store.Put", events[1].Data["name"])
+		assert.Equal(t, 3, events[1].Data["store.args"])
+		assert.Nil(t, events[1].Data["store.error"])
+		assert.Nil(t, events[1].Data["store.data"], "only basic types are added as fields")
+	}
+}
@@ -0,0 +1,26 @@
+// Package example declares an interface to generate a decorator for, to test
+// the generated code.
+package example
+
+import (
+	"context"
+	"io"
+	stdtime "time"
+)
+
+//go:generate go run github.com/honeycombio/beeline-go/codegen/beelinegen -type Store -prefix store -args
+
+// Store is a repository of the kind decorators are generated for.
+type Store interface {
+	Lister
+	io.Closer
+	Get(ctx context.Context, id string) ([]byte, error)
+	Put(ctx context.Context, id string, data []byte, ttl stdtime.Duration) error
+	Touch(context.Context, string, ...int)
+	Name() string
+}
+
+// Lister is embedded in Store.
+type Lister interface {
+	List(ctx context.Context, prefix string, limit int) (ids []string, err error)
+}
@@ -0,0 +1,81 @@
+// Code generated by beelinegen; DO NOT EDIT.
+
+package example
+
+import (
+	"context"
+	stdtime "time"
+
+	"github.com/honeycombio/beeline-go"
+)
+
+// TracedStore wraps a Store, starting a span for each call of its methods
+// that take a context.Context.
+type TracedStore struct {
+	Store
+	// Fields, if set, is called with the name and arguments, other than the
+	// context, of each call, and the fields it returns are added to the
+	// call's span.
+	Fields func(method string, args ...interface{}) map[string]interface{}
+}
+
+// NewTracedStore returns a TracedStore wrapping inner.
+func NewTracedStore(inner Store) *TracedStore {
+	return &TracedStore{Store: inner}
+}
+
+// Get calls Get on the wrapped Store in a span.
+func (w *TracedStore) Get(ctx context.Context, id string) (r0 []byte, err error) {
+	ctx, span := beeline.StartSpan(ctx, "Store.Get")
+	defer span.Send()
+	span.AddField("store.id", id)
+	if w.Fields != nil {
+		span.AddFields(w.Fields("Get", id))
+	}
+	r0, err = w.Store.Get(ctx, id)
+	if err != nil {
+		span.AddField("store.error", err.Error())
+	}
+	return r0, err
+}
+
+// List calls List on the wrapped Store in a span.
+func (w *TracedStore) List(ctx context.Context, prefix string, limit int) (ids []string, err error) {
+	ctx, span := beeline.StartSpan(ctx, "Store.List")
+	defer span.Send()
+	span.AddField("store.prefix", prefix)
+	span.AddField("store.limit", limit)
+	if w.Fields != nil {
+		span.AddFields(w.Fields("List", prefix, limit))
+	}
+	ids, err = w.Store.List(ctx, prefix, limit)
+	if err != nil {
+		span.AddField("store.error", err.Error())
+	}
+	return ids, err
+}
+
+// Put calls Put on the wrapped Store in a span.
+func (w *TracedStore) Put(ctx context.Context, id string, data []byte, ttl stdtime.Duration) (err error) {
+	ctx, span := beeline.StartSpan(ctx, "Store.Put")
+	defer span.Send()
+	span.AddField("store.id", id)
+	if w.Fields != nil {
+		span.AddFields(w.Fields("Put", id, data, ttl))
+	}
+	err = w.Store.Put(ctx, id, data, ttl)
+	if err != nil {
+		span.AddField("store.error", err.Error())
+	}
+	return err
+}
+
+// Touch calls Touch on the wrapped Store in a span.
+func (w *TracedStore) Touch(p0 context.Context, p1 string, p2 ...int) {
+	p0, span := beeline.StartSpan(p0, "Store.Touch")
+	defer span.Send()
+	if w.Fields != nil {
+		span.AddFields(w.Fields("Touch", p1, p2))
+	}
+	w.Store.Touch(p0, p1, p2...)
+}
@@ -0,0 +1,55 @@
+// Command beelinecov reports the call sites in Go code that aren't
+// instrumented with the beeline's wrappers: HTTP requests made with
+// uninstrumented clients, databases opened without hnysql or hnysqlx, and
+// goroutines started without the request's context. See package coverage for
+// the details of the checks.
+//
+// Usage:
+//
+//	beelinecov [-kind http,sql,goroutine] [dir ...]
+//
+// It checks the directory trees given, or the current directory, and exits
+// with status 1 if it finds anything, so it can fail CI builds.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/honeycombio/beeline-go/coverage"
+)
+
+func main() {
+	kinds := flag.String("kind", "", "comma-separated kinds of findings to report: http, sql, goroutine (default all)")
+	flag.Parse()
+	want := make(map[string]bool)
+	for _, k := range strings.Split(*kinds, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			want[k] = true
+		}
+	}
+	dirs := flag.Args()
+	if len(dirs) == 0 {
+		dirs = []string{"."}
+	}
+	found := false
+	for _, dir := range dirs {
+		findings, err := coverage.CheckDir(dir)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "beelinecov:", err)
+			os.Exit(2)
+		}
+		for _, f := range findings {
+			if len(want) > 0 && !want[f.Kind] {
+				continue
+			}
+			fmt.Println(f)
+			found = true
+		}
+	}
+	if found {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,330 @@
+// Package coverage finds call sites in Go code that would produce telemetry
+// if they went through the beeline's wrappers but don't: outbound HTTP
+// requests made with uninstrumented clients, databases opened without
+// hnysql or hnysqlx, and goroutines that leave the trace of the request that
+// started them behind. Large codebases can run it in CI, or with the
+// beelinecov command, to audit their instrumentation coverage.
+//
+// The checks work on syntax alone, following imports to tell which package a
+// name refers to, so they need nothing but the source and run on code that
+// doesn't build. Like go vet's analyzers they check one file at a time, and
+// they err on the side of silence: a client whose transport comes from a
+// variable, say, is assumed to be instrumented.
+package coverage
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Kinds of findings.
+const (
+	KindHTTP      = "http"
+	KindSQL       = "sql"
+	KindGoroutine = "goroutine"
+)
+
+const (
+	beelinePath    = "github.com/honeycombio/beeline-go"
+	tracePath      = beelinePath + "/trace"
+	nethttpPath    = beelinePath + "/wrappers/hnynethttp"
+	hnysqlPath     = beelinePath + "/wrappers/hnysql"
+	hnysqlxPath    = beelinePath + "/wrappers/hnysqlx"
+	sqlxPath       = "github.com/jmoiron/sqlx"
+	databaseSQL    = "database/sql"
+	netHTTP        = "net/http"
+	contextPackage = "context"
+)
+
+// A Finding is an uninstrumented call site.
+type Finding struct {
+	Pos     token.Position
+	Kind    string
+	Message string
+}
+
+func (f Finding) String() string {
+	return f.Pos.String() + ": " + f.Message
+}
+
+// CheckFile reports the uninstrumented call sites in f, which was parsed
+// with fset.
+func CheckFile(fset *token.FileSet, f *ast.File) []Finding {
+	c := &checker{fset: fset, imports: make(map[string]string)}
+	for _, imp := range f.Imports {
+		path, err := strconv.Unquote(imp.Path.Value)
+		if err != nil {
+			continue
+		}
+		name := path[strings.LastIndex(path, "/")+1:]
+		if path == beelinePath {
+			name = "beeline"
+		}
+		if imp.Name != nil {
+			name = imp.Name.Name
+		}
+		if name == "_" || name == "." {
+			continue
+		}
+		c.imports[name] = path
+	}
+	for _, decl := range f.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Body != nil {
+			c.checkFunc(fn.Type, fn.Body)
+		}
+	}
+	c.checkHTTP(f)
+	sort.Slice(c.findings, func(i, j int) bool {
+		return c.findings[i].Pos.Offset < c.findings[j].Pos.Offset
+	})
+	return c.findings
+}
+
+// CheckDir parses the Go files in the directory tree at root, skipping
+// tests, vendor and testdata directories, and directories whose names start
+// with "." or "_", and reports their uninstrumented call sites.
+func CheckDir(root string) ([]Finding, error) {
+	var findings []Finding
+	fset := token.NewFileSet()
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name := info.Name()
+		if info.IsDir() {
+			if path != root && (name == "vendor" || name == "testdata" ||
+				strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			return nil
+		}
+		f, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			return err
+		}
+		findings = append(findings, CheckFile(fset, f)...)
+		return nil
+	})
+	return findings, err
+}
+
+type checker struct {
+	fset *token.FileSet
+	// imports maps the names the file's imports are known by to their paths
+	imports  map[string]string
+	findings []Finding
+}
+
+func (c *checker) report(pos token.Pos, kind, msg string) {
+	c.findings = append(c.findings, Finding{Pos: c.fset.Position(pos), Kind: kind, Message: msg})
+}
+
+// pkgFunc returns the import path and name of the package-level identifier
+// e refers to, like net/http and Get for http.Get.
+func (c *checker) pkgFunc(e ast.Expr) (path, name string) {
+	sel, ok := e.(*ast.SelectorExpr)
+	if !ok {
+		return "", ""
+	}
+	id, ok := sel.X.(*ast.Ident)
+	if !ok || id.Obj != nil {
+		// id.Obj is set for local variables, which may shadow packages
+		return "", ""
+	}
+	return c.imports[id.Name], sel.Sel.Name
+}
+
+// isCall reports whether e is a call of the function name in the package at
+// path.
+func (c *checker) isCall(e ast.Expr, path string, names ...string) bool {
+	call, ok := e.(*ast.CallExpr)
+	if !ok {
+		return false
+	}
+	p, n := c.pkgFunc(call.Fun)
+	if p != path {
+		return false
+	}
+	for _, name := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// uses reports whether n refers to anything in the packages at paths.
+func (c *checker) uses(n ast.Node, paths ...string) bool {
+	found := false
+	ast.Inspect(n, func(n ast.Node) bool {
+		if e, ok := n.(ast.Expr); ok && !found {
+			if p, _ := c.pkgFunc(e); p != "" {
+				for _, path := range paths {
+					if p == path {
+						found = true
+					}
+				}
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+var httpShortcuts = map[string]bool{"Get": true, "Head": true, "Post": true, "PostForm": true}
+
+// checkHTTP reports requests made with http.DefaultClient and clients whose
+// transports aren't wrapped.
+func (c *checker) checkHTTP(f *ast.File) {
+	// http.DefaultClient.Transport = hnynethttp.WrapRoundTripper(...) makes
+	// the default client an instrumented one
+	wrapped := false
+	ast.Inspect(f, func(n ast.Node) bool {
+		if as, ok := n.(*ast.AssignStmt); ok && len(as.Lhs) == len(as.Rhs) {
+			for i, lhs := range as.Lhs {
+				if sel, ok := lhs.(*ast.SelectorExpr); ok && sel.Sel.Name == "Transport" &&
+					c.isCall(as.Rhs[i], nethttpPath, "WrapRoundTripper", "WrapRoundTripperWithConfig") {
+					if p, name := c.pkgFunc(sel.X); p == netHTTP && name == "DefaultClient" {
+						wrapped = true
+					}
+				}
+			}
+		}
+		return true
+	})
+	if wrapped {
+		// the file instruments the default client itself
+		return
+	}
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.CallExpr:
+			if p, name := c.pkgFunc(n.Fun); p == netHTTP && httpShortcuts[name] {
+				c.report(n.Pos(), KindHTTP, "http."+name+" sends the request with http.DefaultClient, whose transport isn't wrapped with hnynethttp.WrapRoundTripper")
+			}
+		case *ast.SelectorExpr:
+			if p, name := c.pkgFunc(n); p == netHTTP && name == "DefaultClient" {
+				c.report(n.Pos(), KindHTTP, "http.DefaultClient's transport isn't wrapped with hnynethttp.WrapRoundTripper")
+			}
+		case *ast.CompositeLit:
+			if p, name := c.pkgFunc(n.Type); p == netHTTP && name == "Client" {
+				c.checkClient(n)
+			}
+		}
+		return true
+	})
+}
+
+// checkClient reports an http.Client literal whose Transport is missing or
+// evidently unwrapped.
+func (c *checker) checkClient(lit *ast.CompositeLit) {
+	for _, elt := range lit.Elts {
+		kv, ok := elt.(*ast.KeyValueExpr)
+		if !ok {
+			continue
+		}
+		if key, ok := kv.Key.(*ast.Ident); !ok || key.Name != "Transport" {
+			continue
+		}
+		v := kv.Value
+		if u, ok := v.(*ast.UnaryExpr); ok && u.Op == token.AND {
+			v = u.X
+		}
+		if cl, ok := v.(*ast.CompositeLit); ok {
+			v = cl.Type
+		}
+		if p, name := c.pkgFunc(v); p == netHTTP && (name == "Transport" || name == "DefaultTransport") {
+			c.report(kv.Pos(), KindHTTP, "the http.Client's transport isn't wrapped with hnynethttp.WrapRoundTripper")
+		}
+		return
+	}
+	c.report(lit.Pos(), KindHTTP, "the http.Client uses http.DefaultTransport, which isn't wrapped with hnynethttp.WrapRoundTripper")
+}
+
+// checkFunc reports databases opened without being wrapped, and goroutines
+// started without the context, in the function with type ft and body.
+func (c *checker) checkFunc(ft *ast.FuncType, body *ast.BlockStmt) {
+	wrapsSQL := c.usesFunc(body, hnysqlPath, "WrapDB")
+	wrapsSQLX := c.usesFunc(body, hnysqlxPath, "WrapDB")
+	ctxNames := c.contextParams(ft)
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.CallExpr:
+			if c.isCall(n, databaseSQL, "Open", "OpenDB") && !wrapsSQL {
+				c.report(n.Pos(), KindSQL, "the *sql.DB isn't wrapped with hnysql.WrapDB")
+			}
+			if c.isCall(n, sqlxPath, "Open", "Connect", "MustOpen", "MustConnect", "NewDb") && !wrapsSQLX {
+				c.report(n.Pos(), KindSQL, "the *sqlx.DB isn't wrapped with hnysqlx.WrapDB")
+			}
+		case *ast.FuncLit:
+			// function literals take their own contexts, and any goroutines
+			// they start are checked against those
+			if names := c.contextParams(n.Type); len(names) > 0 {
+				c.checkFunc(n.Type, n.Body)
+				return false
+			}
+		case *ast.GoStmt:
+			if len(ctxNames) > 0 && !c.mentions(n.Call, ctxNames) && !c.uses(n.Call, beelinePath, tracePath) {
+				c.report(n.Pos(), KindGoroutine, "the goroutine doesn't get the context, so its spans won't join the trace; pass it an async span's context, eg from CreateAsyncChild")
+			}
+		}
+		return true
+	})
+}
+
+// usesFunc reports whether n calls the function name in the package at path.
+func (c *checker) usesFunc(n ast.Node, path, name string) bool {
+	found := false
+	ast.Inspect(n, func(n ast.Node) bool {
+		if !found && c.isCall(asExpr(n), path, name) {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+func asExpr(n ast.Node) ast.Expr {
+	e, _ := n.(ast.Expr)
+	return e
+}
+
+// contextParams returns the names of ft's context.Context parameters.
+func (c *checker) contextParams(ft *ast.FuncType) map[string]bool {
+	names := make(map[string]bool)
+	if ft.Params == nil {
+		return names
+	}
+	for _, field := range ft.Params.List {
+		if p, name := c.pkgFunc(field.Type); p != contextPackage || name != "Context" {
+			continue
+		}
+		for _, id := range field.Names {
+			if id.Name != "_" {
+				names[id.Name] = true
+			}
+		}
+	}
+	return names
+}
+
+// mentions reports whether any of names is referred to in n.
+func (c *checker) mentions(n ast.Node, names map[string]bool) bool {
+	found := false
+	ast.Inspect(n, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && names[id.Name] {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
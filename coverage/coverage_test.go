@@ -0,0 +1,119 @@
+package coverage
+
+import (
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const source = `package app
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+
+	"github.com/honeycombio/beeline-go/trace"
+	"github.com/honeycombio/beeline-go/wrappers/hnynethttp"
+	"github.com/honeycombio/beeline-go/wrappers/hnysql"
+	"github.com/jmoiron/sqlx"
+)
+
+var wrapped = &http.Client{Transport: hnynethttp.WrapRoundTripper(http.DefaultTransport)}
+var bare = &http.Client{}
+var explicit = http.Client{Transport: &http.Transport{}}
+
+func fetch(url string) {
+	http.Get(url)
+	http.DefaultClient.Do(nil)
+}
+
+func open() *hnysql.DB {
+	db, _ := sql.Open("mysql", "")
+	return hnysql.WrapDB(db)
+}
+
+func openBare() {
+	sql.Open("mysql", "")
+	sqlx.Connect("mysql", "")
+}
+
+func handle(ctx context.Context) {
+	go work()
+	go work2(ctx)
+	go func() {
+		trace.GetSpanFromContext(ctx)
+	}()
+	go func() {
+		_, span := trace.GetSpanFromContext(context.Background()).CreateAsyncChild(context.Background())
+		span.Send()
+	}()
+	f := func(inner context.Context) {
+		go work2(inner)
+		go work()
+	}
+	f(ctx)
+}
+
+func background() {
+	go work()
+}
+
+func shadowed() {
+	http := struct{ Get func(string) }{}
+	http.Get("")
+}
+
+func work()                  {}
+func work2(context.Context) {}
+`
+
+func TestCheckFile(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "app.go", source, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type got struct {
+		line int
+		kind string
+	}
+	var findings []got
+	for _, finding := range CheckFile(fset, f) {
+		findings = append(findings, got{finding.Pos.Line, finding.Kind})
+	}
+	assert.Equal(t, []got{
+		{15, KindHTTP},      // bare
+		{16, KindHTTP},      // explicit
+		{19, KindHTTP},      // http.Get
+		{20, KindHTTP},      // http.DefaultClient
+		{29, KindSQL},       // sql.Open
+		{30, KindSQL},       // sqlx.Connect
+		{34, KindGoroutine}, // go work()
+		{45, KindGoroutine}, // go work() in f
+	}, findings)
+}
+
+func TestCheckDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "coverage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"app.go", "app_test.go", "vendor/dep/dep.go", "testdata/data.go"} {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(source), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	findings, err := CheckDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, findings, 8, "only app.go should be checked")
+	assert.Equal(t, filepath.Join(dir, "app.go"), findings[0].Pos.Filename)
+}
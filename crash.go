@@ -0,0 +1,83 @@
+package beeline
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"runtime/debug"
+	"time"
+
+	"github.com/honeycombio/beeline-go/trace"
+)
+
+// crashFlushTimeout bounds how long ReportPanic waits for the crash span to
+// be sent.
+const crashFlushTimeout = 2 * time.Second
+
+// crashOutput is where ReportPanic writes the IDs of the panicking span.
+var crashOutput io.Writer = os.Stderr
+
+// ReportPanic, deferred at the top of main, a goroutine or a request
+// handler, adds the trace to the crash output of a panic that would
+// otherwise kill the process. It writes the trace.trace_id and trace.span_id
+// of the span in ctx to stderr, just before the runtime prints the panic and
+// its stack, and with Config.CrashSpans set sends a crash span first. The
+// panic then carries on as before:
+//
+//	func worker(ctx context.Context) {
+//		defer beeline.ReportPanic(ctx)
+//		...
+//	}
+//
+// It must be deferred directly, not called from another deferred function,
+// for it to see the panic.
+func ReportPanic(ctx context.Context) {
+	if p := recover(); p != nil {
+		defaultBeeline.reportPanic(ctx, p)
+		panic(p)
+	}
+}
+
+// ReportPanic adds the trace to the crash output of a panic, sending a crash
+// span if this instance has CrashSpans set. See the package-level
+// ReportPanic for details.
+func (b *Beeline) ReportPanic(ctx context.Context) {
+	if p := recover(); p != nil {
+		b.reportPanic(ctx, p)
+		panic(p)
+	}
+}
+
+func (b *Beeline) reportPanic(ctx context.Context, p interface{}) {
+	span := b.spanFromContext(ctx)
+	var crash *trace.Span
+	if b.crashSpans {
+		ctx, crash = b.StartSpan(ctx, "crash")
+		crash.AddField("meta.type", "crash")
+		crash.AddField("panic.value", fmt.Sprint(p))
+		crash.AddField("panic.stack", string(debug.Stack()))
+		if span == nil {
+			// the crash span is the root of a trace of its own
+			span = crash
+		}
+	}
+	if span != nil {
+		fmt.Fprintf(crashOutput, "beeline: panic in trace.trace_id=%s trace.span_id=%s\n",
+			span.GetTrace().GetTraceID(), span.GetSpanID())
+	}
+	if crash == nil {
+		return
+	}
+	crash.Send()
+	done := make(chan struct{})
+	go func() {
+		// the process is about to die, so the rest of the trace goes too
+		b.Flush(ctx)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(crashFlushTimeout):
+	}
+}
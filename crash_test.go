@@ -0,0 +1,56 @@
+package beeline
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+
+	"github.com/honeycombio/libhoney-go/transmission"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReportPanic(t *testing.T) {
+	var out bytes.Buffer
+	crashOutput = &out
+	defer func() { crashOutput = os.Stderr }()
+
+	mo := &transmission.MockSender{}
+	bl := New(Config{Transmission: mo})
+	defer bl.Close()
+	ctx, root := bl.StartTrace(context.Background(), "handler")
+	assert.PanicsWithValue(t, "boom", func() {
+		defer bl.ReportPanic(ctx)
+		panic("boom")
+	})
+	assert.Equal(t, "beeline: panic in trace.trace_id="+root.GetTrace().GetTraceID()+" trace.span_id="+root.GetSpanID()+"\n", out.String())
+	assert.Empty(t, mo.Events(), "without CrashSpans nothing is sent")
+
+	crashing := New(Config{Transmission: mo, CrashSpans: true})
+	defer crashing.Close()
+	ctx, root = crashing.StartTrace(context.Background(), "handler")
+	assert.Panics(t, func() {
+		defer crashing.ReportPanic(ctx)
+		panic("boom")
+	})
+	events := mo.Events()
+	if assert.Len(t, events, 2, "the crash span and the rest of the trace should be sent") {
+		assert.Equal(t, "crash", events[0].Data["name"])
+		assert.Equal(t, "boom", events[0].Data["panic.value"])
+		assert.Contains(t, events[0].Data["panic.stack"], "TestReportPanic")
+		assert.Equal(t, root.GetSpanID(), events[0].Data["trace.parent_id"])
+		assert.Equal(t, "handler", events[1].Data["name"])
+	}
+
+	out.Reset()
+	assert.NotPanics(t, func() {
+		defer crashing.ReportPanic(context.Background())
+	})
+	assert.Empty(t, out.String())
+	assert.Panics(t, func() {
+		defer crashing.ReportPanic(context.Background())
+		panic("boom")
+	})
+	assert.Contains(t, out.String(), "beeline: panic in trace.trace_id=")
+	assert.Len(t, mo.Events(), 3, "panics outside a trace get a crash trace of their own")
+}
@@ -0,0 +1,124 @@
+package beeline
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/honeycombio/beeline-go/trace"
+)
+
+// Diagnostics is the report served by DiagnosticsHandler.
+type Diagnostics struct {
+	Version string `json:"version"`
+	// WriteKey is the write key in use with all but its first four
+	// characters hidden. It is empty if the beeline was given a Client
+	// without a WriteKey.
+	WriteKey    string   `json:"write_key"`
+	KeyType     KeyType  `json:"key_type"`
+	Dataset     string   `json:"dataset"`
+	ServiceName string   `json:"service_name"`
+	Team        string   `json:"team,omitempty"`
+	Environment string   `json:"environment,omitempty"`
+	Warnings    []string `json:"warnings"`
+	// Sampler is "deterministic" when traces are sampled at SampleRate, and
+	// "hook" when a SamplerHook decides.
+	Sampler              string `json:"sampler"`
+	SampleRate           uint   `json:"sample_rate,omitempty"`
+	SampleRateMultiplier uint   `json:"sample_rate_multiplier,omitempty"`
+	// The fields below come from Stats, and are zero unless the beeline
+	// queues events itself; see Config.OverflowPolicy.
+	QueueDepth       int        `json:"queue_depth"`
+	QueueCapacity    int        `json:"queue_capacity"`
+	Sent             uint64     `json:"events_sent"`
+	Failed           uint64     `json:"events_failed"`
+	RateLimited      uint64     `json:"events_rate_limited"`
+	DroppedQueueFull uint64     `json:"events_dropped_queue_full"`
+	DroppedSampled   uint64     `json:"events_dropped_sampled"`
+	CircuitOpen      bool       `json:"circuit_open"`
+	LastError        string     `json:"last_error,omitempty"`
+	LastErrorTime    *time.Time `json:"last_error_time,omitempty"`
+	// RepeatedSpanSends counts calls to Send on spans that had already been
+	// sent; see trace.RepeatedSends.
+	RepeatedSpanSends uint64 `json:"repeated_span_sends"`
+}
+
+// DiagnosticsHandler returns an http.Handler that reports the state of the
+// default beeline as JSON: its version, resolved config with the write key
+// redacted, queue depth, counts of events sent and dropped, the last send
+// error, and the sampler in use. It is meant to be mounted somewhere only
+// operators can reach, for triage in production:
+//
+//   http.Handle("/debug/beeline", beeline.DiagnosticsHandler())
+func DiagnosticsHandler() http.Handler {
+	return defaultBeeline.DiagnosticsHandler()
+}
+
+// DiagnosticsHandler returns an http.Handler that reports the state of this
+// instance. See the package-level DiagnosticsHandler for details.
+func (b *Beeline) DiagnosticsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(b.Diagnostics())
+	})
+}
+
+// Diagnostics returns the report served by DiagnosticsHandler.
+func (b *Beeline) Diagnostics() Diagnostics {
+	info := b.Info()
+	b.lock.RLock()
+	writeKey := b.writeKey
+	if writeKey == "" {
+		writeKey = b.initConfig.WriteKey
+	}
+	traceConfig := b.traceConfig
+	b.lock.RUnlock()
+
+	d := Diagnostics{
+		Version:     version,
+		WriteKey:    redactKey(writeKey),
+		KeyType:     info.KeyType,
+		Dataset:     info.Dataset,
+		ServiceName: info.ServiceName,
+		Team:        info.Team,
+		Environment: info.Environment,
+		Warnings:    info.Warnings,
+		Sampler:     "deterministic",
+	}
+	if traceConfig != nil && traceConfig.SamplerHook != nil {
+		d.Sampler = "hook"
+	} else if traceConfig != nil && traceConfig.Sampler != nil {
+		d.SampleRate = uint(traceConfig.Sampler.GetSampleRate())
+	}
+	stats := b.Stats()
+	d.SampleRateMultiplier = stats.SampleRateMultiplier
+	d.QueueDepth = stats.QueueDepth
+	d.QueueCapacity = stats.QueueCapacity
+	d.Sent = stats.Sent
+	d.Failed = stats.Failed
+	d.RateLimited = stats.RateLimited
+	d.DroppedQueueFull = stats.DroppedQueueFull
+	d.DroppedSampled = stats.DroppedSampled
+	d.CircuitOpen = stats.CircuitOpen
+	d.LastError = stats.LastError
+	if !stats.LastErrorTime.IsZero() {
+		d.LastErrorTime = &stats.LastErrorTime
+	}
+	d.RepeatedSpanSends = trace.RepeatedSends()
+	return d
+}
+
+// redactKey hides all but the first four characters of key, or all of a key
+// too short to reveal any of.
+func redactKey(key string) string {
+	if key == "" {
+		return ""
+	}
+	if len(key) <= 8 {
+		return "..."
+	}
+	return key[:4] + "..."
+}
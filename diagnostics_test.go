@@ -0,0 +1,45 @@
+package beeline
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/honeycombio/libhoney-go/transmission"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/honeycombio/beeline-go/senders"
+)
+
+func TestDiagnosticsHandler(t *testing.T) {
+	bl := New(Config{
+		WriteKey:       "abcabc123123defdef456456",
+		Dataset:        "diagnostics",
+		SampleRate:     10,
+		Transmission:   &transmission.MockSender{},
+		OverflowPolicy: senders.OverflowDropOldest,
+	})
+	defer bl.Close()
+
+	rr := httptest.NewRecorder()
+	bl.DiagnosticsHandler().ServeHTTP(rr, httptest.NewRequest("GET", "/debug/beeline", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	assert.NotContains(t, rr.Body.String(), "abcabc123123defdef456456")
+
+	var d Diagnostics
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &d))
+	assert.Equal(t, version, d.Version)
+	assert.Equal(t, "abca...", d.WriteKey)
+	assert.Equal(t, KeyTypeClassic, d.KeyType)
+	assert.Equal(t, "diagnostics", d.Dataset)
+	assert.Equal(t, "deterministic", d.Sampler)
+	assert.Equal(t, uint(10), d.SampleRate)
+	assert.NotZero(t, d.QueueCapacity)
+	assert.Nil(t, d.LastErrorTime)
+
+	bl = New(Config{SamplerHook: func(map[string]interface{}) (bool, int) { return true, 1 }, Mute: true})
+	assert.Equal(t, "hook", bl.Diagnostics().Sampler)
+	assert.Equal(t, "...", redactKey("short"))
+}
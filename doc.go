@@ -18,6 +18,9 @@
 // The `propagation`, `sample`, and `timer` packages are used internally and not
 // very interesting.
 //
+// The `logger` package defines the interface through which the beeline reports
+// its own diagnostics, with adapters for common logging libraries.
+//
 // The `wrappers` package contains middleware to use with other existing
 // packages such as HTTP routers (eg goji, gorilla, or just plain net/http) and
 // SQL packages (including sqlx and pop).
@@ -41,6 +44,17 @@
 // Once configured, use one of the subpackages to wrap HTTP handlers and SQL db
 // objects.
 //
+// Libraries, tests, and processes that need to send to more than one place can
+// create additional, independent instances with New. Each instance has its own
+// client, sampler, and hooks, and offers the same functions as the package
+// (StartSpan, AddField, Flush, etc.) as methods.
+//
+// Code that can't pass a context.Context everywhere has two ways out.
+// StartSpanWithParent works with spans directly instead of contexts. For call
+// stacks that only lose the context deep down, set GoroutineLocalSpans and
+// Bind the current span to the goroutine; AddField and friends fall back to it
+// when their context has no span.
+//
 // Examples
 //
 // There are runnable examples at
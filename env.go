@@ -0,0 +1,270 @@
+package beeline
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/honeycombio/beeline-go/senders"
+)
+
+// Environment variables read by ConfigFromEnv. HTTP(S) proxies may also be
+// configured with the standard HTTPS_PROXY and NO_PROXY variables, which are
+// honored by the default transport used to send events to Honeycomb unless
+// EnvProxyURL is set.
+const (
+	// EnvAPIKey holds the Honeycomb write key
+	EnvAPIKey = "HONEYCOMB_API_KEY"
+	// EnvWriteKey is an older name for EnvAPIKey, used if EnvAPIKey is unset
+	EnvWriteKey = "HONEYCOMB_WRITEKEY"
+	// EnvDataset holds the name of the dataset to send events to
+	EnvDataset = "HONEYCOMB_DATASET"
+	// EnvAPIHost holds the URL of the Honeycomb API server
+	EnvAPIHost = "HONEYCOMB_API_HOST"
+	// EnvServiceName holds the name of the instrumented service
+	EnvServiceName = "HONEYCOMB_SERVICE_NAME"
+	// EnvSampleRate holds a positive integer sample rate
+	EnvSampleRate = "BEELINE_SAMPLE_RATE"
+	// EnvDebug turns on debug logging when set to a true value
+	EnvDebug = "BEELINE_DEBUG"
+	// EnvSTDOUT prints events to STDOUT instead of sending them when true
+	EnvSTDOUT = "BEELINE_STDOUT"
+	// EnvMute drops all events when true
+	EnvMute = "BEELINE_MUTE"
+	// EnvDevMode prints traces to stderr as trees instead of sending them
+	// when true
+	EnvDevMode = "BEELINE_DEV_MODE"
+	// EnvSpoolDir holds a directory in which to spool events that can't be
+	// sent
+	EnvSpoolDir = "BEELINE_SPOOL_DIR"
+	// EnvCaptureFile holds a file to which outgoing events are also written
+	EnvCaptureFile = "BEELINE_CAPTURE_FILE"
+	// EnvOverflowPolicy holds the name of the policy for a full send queue:
+	// drop_new, drop_oldest, block, or degrade_sample_rate
+	EnvOverflowPolicy = "BEELINE_OVERFLOW_POLICY"
+	// EnvProxyURL holds the URL of the proxy through which to send events
+	EnvProxyURL = "BEELINE_PROXY_URL"
+	// EnvCACertFile holds the path of a PEM file of trusted certificate
+	// authorities
+	EnvCACertFile = "BEELINE_CA_CERT_FILE"
+	// EnvClientCertFile and EnvClientKeyFile hold the paths of a PEM client
+	// certificate and key for mutual TLS
+	EnvClientCertFile = "BEELINE_CLIENT_CERT_FILE"
+	EnvClientKeyFile  = "BEELINE_CLIENT_KEY_FILE"
+	// EnvDialTimeout and EnvTLSHandshakeTimeout hold duration strings like
+	// "5s" limiting how long connecting to the API may take
+	EnvDialTimeout         = "BEELINE_DIAL_TIMEOUT"
+	EnvTLSHandshakeTimeout = "BEELINE_TLS_HANDSHAKE_TIMEOUT"
+	// EnvConfigFile holds the path of a YAML or JSON config file to read
+	// before applying the other environment variables
+	EnvConfigFile = "BEELINE_CONFIG_FILE"
+)
+
+// fileConfig is the representation of Config in YAML and JSON config files.
+// Only settings that can be expressed as plain values are supported; hooks
+// and clients must still be set in code.
+type fileConfig struct {
+	WriteKey             string `json:"write_key" yaml:"write_key"`
+	Dataset              string `json:"dataset" yaml:"dataset"`
+	ServiceName          string `json:"service_name" yaml:"service_name"`
+	SampleRate           uint   `json:"sample_rate" yaml:"sample_rate"`
+	APIHost              string `json:"api_host" yaml:"api_host"`
+	STDOUT               bool   `json:"stdout" yaml:"stdout"`
+	Mute                 bool   `json:"mute" yaml:"mute"`
+	DevMode              bool   `json:"dev_mode" yaml:"dev_mode"`
+	Debug                bool   `json:"debug" yaml:"debug"`
+	SpoolDir             string `json:"spool_dir" yaml:"spool_dir"`
+	CaptureFile          string `json:"capture_file" yaml:"capture_file"`
+	OverflowPolicy       string `json:"overflow_policy" yaml:"overflow_policy"`
+	OverflowBlockTimeout string `json:"overflow_block_timeout" yaml:"overflow_block_timeout"`
+	ProxyURL             string `json:"proxy_url" yaml:"proxy_url"`
+	CACertFile           string `json:"ca_cert_file" yaml:"ca_cert_file"`
+	ClientCertFile       string `json:"client_cert_file" yaml:"client_cert_file"`
+	ClientKeyFile        string `json:"client_key_file" yaml:"client_key_file"`
+	DialTimeout          string `json:"dial_timeout" yaml:"dial_timeout"`
+	TLSHandshakeTimeout  string `json:"tls_handshake_timeout" yaml:"tls_handshake_timeout"`
+	MaxBatchSize         uint   `json:"max_batch_size" yaml:"max_batch_size"`
+	BatchTimeout         string `json:"batch_timeout" yaml:"batch_timeout"`
+	MaxConcurrentBatches uint   `json:"max_concurrent_batches" yaml:"max_concurrent_batches"`
+	PendingWorkCapacity  uint   `json:"pending_work_capacity" yaml:"pending_work_capacity"`
+	DisableCompression   bool   `json:"disable_compression" yaml:"disable_compression"`
+}
+
+// InitFromEnv initializes the beeline with the config returned by
+// ConfigFromEnv. Deployments can then be configured without code changes. If
+// the environment can't be parsed, the beeline is left uninitialized and an
+// error is returned.
+func InitFromEnv() error {
+	config, err := ConfigFromEnv()
+	if err != nil {
+		return err
+	}
+	Init(config)
+	return nil
+}
+
+// ConfigFromEnv builds a Config from the environment variables listed above.
+// If EnvConfigFile is set, that file is read first with ConfigFromFile and
+// the other environment variables override its values. Unset variables leave
+// the corresponding field at its zero value, which Init replaces with the
+// usual default. Hooks and other settings that can't come from the
+// environment may be added to the returned Config before passing it to Init.
+func ConfigFromEnv() (Config, error) {
+	var config Config
+	if path := os.Getenv(EnvConfigFile); path != "" {
+		var err error
+		config, err = ConfigFromFile(path)
+		if err != nil {
+			return Config{}, err
+		}
+	}
+
+	if v := os.Getenv(EnvAPIKey); v != "" {
+		config.WriteKey = v
+	} else if v := os.Getenv(EnvWriteKey); v != "" {
+		config.WriteKey = v
+	}
+	if v := os.Getenv(EnvDataset); v != "" {
+		config.Dataset = v
+	}
+	if v := os.Getenv(EnvAPIHost); v != "" {
+		config.APIHost = v
+	}
+	if v := os.Getenv(EnvServiceName); v != "" {
+		config.ServiceName = v
+	}
+	if v := os.Getenv(EnvSpoolDir); v != "" {
+		config.SpoolDir = v
+	}
+	if v := os.Getenv(EnvCaptureFile); v != "" {
+		config.CaptureFile = v
+	}
+	for name, field := range map[string]*string{
+		EnvProxyURL:       &config.ProxyURL,
+		EnvCACertFile:     &config.CACertFile,
+		EnvClientCertFile: &config.ClientCertFile,
+		EnvClientKeyFile:  &config.ClientKeyFile,
+	} {
+		if v := os.Getenv(name); v != "" {
+			*field = v
+		}
+	}
+	for name, field := range map[string]*time.Duration{
+		EnvDialTimeout:         &config.DialTimeout,
+		EnvTLSHandshakeTimeout: &config.TLSHandshakeTimeout,
+	} {
+		if v := os.Getenv(name); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return Config{}, fmt.Errorf("%s must be a duration, got %q", name, v)
+			}
+			*field = d
+		}
+	}
+	if v := os.Getenv(EnvOverflowPolicy); v != "" {
+		policy, err := senders.ParseOverflowPolicy(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("%s: %v", EnvOverflowPolicy, err)
+		}
+		config.OverflowPolicy = policy
+	}
+	if v := os.Getenv(EnvSampleRate); v != "" {
+		rate, err := strconv.ParseUint(v, 10, 32)
+		if err != nil || rate == 0 {
+			return Config{}, fmt.Errorf("%s must be a positive integer, got %q", EnvSampleRate, v)
+		}
+		config.SampleRate = uint(rate)
+	}
+	for name, field := range map[string]*bool{
+		EnvDebug:   &config.Debug,
+		EnvSTDOUT:  &config.STDOUT,
+		EnvMute:    &config.Mute,
+		EnvDevMode: &config.DevMode,
+	} {
+		if v := os.Getenv(name); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return Config{}, fmt.Errorf("%s must be a boolean, got %q", name, v)
+			}
+			*field = b
+		}
+	}
+	return config, nil
+}
+
+// ConfigFromFile reads a Config from a YAML (.yaml or .yml) or JSON file. Keys
+// are the snake_case names of the Config fields, eg `write_key`, `dataset`,
+// `sample_rate`, and `batch_timeout` (given as a duration string like
+// "100ms"). Fields missing from the file are left at their zero value.
+func ConfigFromFile(path string) (Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("reading beeline config file: %v", err)
+	}
+	var fc fileConfig
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.UnmarshalStrict(data, &fc)
+	default:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&fc)
+	}
+	if err != nil {
+		return Config{}, fmt.Errorf("parsing beeline config file %s: %v", path, err)
+	}
+
+	config := Config{
+		WriteKey:             fc.WriteKey,
+		Dataset:              fc.Dataset,
+		ServiceName:          fc.ServiceName,
+		SampleRate:           fc.SampleRate,
+		APIHost:              fc.APIHost,
+		STDOUT:               fc.STDOUT,
+		Mute:                 fc.Mute,
+		DevMode:              fc.DevMode,
+		Debug:                fc.Debug,
+		SpoolDir:             fc.SpoolDir,
+		CaptureFile:          fc.CaptureFile,
+		ProxyURL:             fc.ProxyURL,
+		CACertFile:           fc.CACertFile,
+		ClientCertFile:       fc.ClientCertFile,
+		ClientKeyFile:        fc.ClientKeyFile,
+		MaxBatchSize:         fc.MaxBatchSize,
+		MaxConcurrentBatches: fc.MaxConcurrentBatches,
+		PendingWorkCapacity:  fc.PendingWorkCapacity,
+		DisableCompression:   fc.DisableCompression,
+	}
+	for _, d := range []struct {
+		name  string
+		value string
+		field *time.Duration
+	}{
+		{"batch_timeout", fc.BatchTimeout, &config.BatchTimeout},
+		{"overflow_block_timeout", fc.OverflowBlockTimeout, &config.OverflowBlockTimeout},
+		{"dial_timeout", fc.DialTimeout, &config.DialTimeout},
+		{"tls_handshake_timeout", fc.TLSHandshakeTimeout, &config.TLSHandshakeTimeout},
+	} {
+		if d.value != "" {
+			*d.field, err = time.ParseDuration(d.value)
+			if err != nil {
+				return Config{}, fmt.Errorf("parsing %s in beeline config file %s: %v", d.name, path, err)
+			}
+		}
+	}
+	if fc.OverflowPolicy != "" {
+		config.OverflowPolicy, err = senders.ParseOverflowPolicy(fc.OverflowPolicy)
+		if err != nil {
+			return Config{}, fmt.Errorf("parsing overflow_policy in beeline config file %s: %v", path, err)
+		}
+	}
+	return config, nil
+}
@@ -0,0 +1,151 @@
+package beeline
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/honeycombio/beeline-go/senders"
+)
+
+// setenv sets the environment variable key and returns a function that
+// restores its previous value.
+func setenv(key, value string) func() {
+	old, had := os.LookupEnv(key)
+	os.Setenv(key, value)
+	return func() {
+		if had {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	}
+}
+
+// writeConfigFile writes contents to a file with the given name in dir and
+// returns its path.
+func writeConfigFile(t *testing.T, dir, name, contents string) string {
+	path := filepath.Join(dir, name)
+	assert.NoError(t, ioutil.WriteFile(path, []byte(contents), 0600))
+	return path
+}
+
+// tempDir creates a temporary directory that the caller must remove.
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "beeline")
+	assert.NoError(t, err)
+	return dir
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	defer setenv(EnvAPIKey, "envkey")()
+	defer setenv(EnvDataset, "envdataset")()
+	defer setenv(EnvServiceName, "envservice")()
+	defer setenv(EnvSampleRate, "20")()
+	defer setenv(EnvDebug, "true")()
+	defer setenv(EnvMute, "1")()
+	defer setenv(EnvDevMode, "true")()
+
+	config, err := ConfigFromEnv()
+	assert.NoError(t, err)
+	assert.Equal(t, "envkey", config.WriteKey)
+	assert.Equal(t, "envdataset", config.Dataset)
+	assert.Equal(t, "envservice", config.ServiceName)
+	assert.Equal(t, uint(20), config.SampleRate)
+	assert.True(t, config.Debug)
+	assert.True(t, config.Mute)
+	assert.True(t, config.DevMode)
+	assert.False(t, config.STDOUT, "unset variables should leave fields at their zero value")
+
+	restore := setenv(EnvOverflowPolicy, "drop_oldest")
+	config, err = ConfigFromEnv()
+	assert.NoError(t, err)
+	assert.Equal(t, senders.OverflowDropOldest, config.OverflowPolicy)
+	restore()
+
+	restore = setenv(EnvOverflowPolicy, "drop_everything")
+	_, err = ConfigFromEnv()
+	assert.Error(t, err, "unknown overflow policies should be rejected")
+	restore()
+
+	restore = setenv(EnvProxyURL, "http://proxy.internal:3128")
+	defer setenv(EnvCACertFile, "/etc/beeline/ca.pem")()
+	defer setenv(EnvClientCertFile, "/etc/beeline/client.pem")()
+	defer setenv(EnvClientKeyFile, "/etc/beeline/client.key")()
+	defer setenv(EnvDialTimeout, "5s")()
+	config, err = ConfigFromEnv()
+	assert.NoError(t, err)
+	assert.Equal(t, "http://proxy.internal:3128", config.ProxyURL)
+	assert.Equal(t, "/etc/beeline/ca.pem", config.CACertFile)
+	assert.Equal(t, "/etc/beeline/client.pem", config.ClientCertFile)
+	assert.Equal(t, "/etc/beeline/client.key", config.ClientKeyFile)
+	assert.Equal(t, 5*time.Second, config.DialTimeout)
+	restore()
+
+	restore = setenv(EnvTLSHandshakeTimeout, "soon")
+	_, err = ConfigFromEnv()
+	assert.Error(t, err, "unparseable durations should be rejected")
+	restore()
+
+	restore = setenv(EnvSampleRate, "0")
+	_, err = ConfigFromEnv()
+	assert.Error(t, err, "a zero sample rate should be rejected")
+
+	restore()
+	defer setenv(EnvDebug, "sometimes")()
+	_, err = ConfigFromEnv()
+	assert.Error(t, err, "a non-boolean debug flag should be rejected")
+}
+
+func TestConfigFromEnvWithFile(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := writeConfigFile(t, dir, "beeline.yaml", `
+write_key: filekey
+dataset: filedataset
+sample_rate: 5
+batch_timeout: 250ms
+proxy_url: http://proxy.internal:3128
+dial_timeout: 5s
+`)
+	defer setenv(EnvConfigFile, path)()
+	defer setenv(EnvDataset, "envdataset")()
+
+	config, err := ConfigFromEnv()
+	assert.NoError(t, err)
+	assert.Equal(t, "filekey", config.WriteKey, "values from the file should be used")
+	assert.Equal(t, "envdataset", config.Dataset, "environment variables should override the file")
+	assert.Equal(t, uint(5), config.SampleRate)
+	assert.Equal(t, 250*time.Millisecond, config.BatchTimeout)
+	assert.Equal(t, "http://proxy.internal:3128", config.ProxyURL)
+	assert.Equal(t, 5*time.Second, config.DialTimeout)
+}
+
+func TestConfigFromFile(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := writeConfigFile(t, dir, "beeline.json", `{"write_key": "jsonkey", "stdout": true, "max_batch_size": 10, "spool_dir": "/var/spool/beeline", "capture_file": "/var/log/beeline.json", "disable_compression": true}`)
+	config, err := ConfigFromFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "jsonkey", config.WriteKey)
+	assert.True(t, config.STDOUT)
+	assert.Equal(t, uint(10), config.MaxBatchSize)
+	assert.Equal(t, "/var/spool/beeline", config.SpoolDir)
+	assert.Equal(t, "/var/log/beeline.json", config.CaptureFile)
+	assert.True(t, config.DisableCompression)
+
+	path = writeConfigFile(t, dir, "beeline.yml", "wrte_key: typo\n")
+	_, err = ConfigFromFile(path)
+	assert.Error(t, err, "unknown keys should be rejected")
+
+	path = writeConfigFile(t, dir, "beeline.json", `{"batch_timeout": "soon"}`)
+	_, err = ConfigFromFile(path)
+	assert.Error(t, err, "unparseable durations should be rejected")
+
+	_, err = ConfigFromFile(filepath.Join(dir, "does-not-exist.json"))
+	assert.Error(t, err, "missing files should return an error")
+}
@@ -0,0 +1,24 @@
+package beeline
+
+import "context"
+
+// ErrorTags returns the trace.trace_id and trace.span_id of the span in ctx,
+// for stamping onto error tracker events, like Sentry's tags, so an error
+// reported there links back to its trace. It returns nil if ctx has no span.
+// Config.ErrorReporter links errors the other way.
+func ErrorTags(ctx context.Context) map[string]string {
+	return defaultBeeline.ErrorTags(ctx)
+}
+
+// ErrorTags returns the IDs of the span in ctx for error tracker events. See
+// the package-level ErrorTags for details.
+func (b *Beeline) ErrorTags(ctx context.Context) map[string]string {
+	span := b.spanFromContext(ctx)
+	if span == nil {
+		return nil
+	}
+	return map[string]string{
+		"trace.trace_id": span.GetTrace().GetTraceID(),
+		"trace.span_id":  span.GetSpanID(),
+	}
+}
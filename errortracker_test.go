@@ -0,0 +1,80 @@
+package beeline
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/honeycombio/libhoney-go/transmission"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/honeycombio/beeline-go/scrub"
+	"github.com/honeycombio/beeline-go/trace"
+)
+
+func TestErrorReporter(t *testing.T) {
+	var lock sync.Mutex
+	var reported []trace.SpanError
+	mo := &transmission.MockSender{}
+	bl := New(Config{Transmission: mo, ErrorReporter: func(e trace.SpanError) {
+		lock.Lock()
+		defer lock.Unlock()
+		reported = append(reported, e)
+	}})
+	defer bl.Close()
+
+	ctx, root := bl.StartTrace(context.Background(), "handler")
+	_, query := bl.StartSpan(ctx, "QueryContext")
+	query.AddField("db.error", "deadlock detected")
+	query.AddField("error", true)
+	query.Send()
+	root.SendSpanEvent("log", map[string]interface{}{"log.error": "retrying"})
+	root.AddField("handler.error", "")
+	root.Send()
+
+	assert.Equal(t, []trace.SpanError{
+		{TraceID: root.GetTrace().GetTraceID(), SpanID: query.GetSpanID(), Name: "QueryContext", Field: "db.error", Message: "deadlock detected", Sampled: true},
+		{TraceID: root.GetTrace().GetTraceID(), SpanID: query.GetSpanID(), Name: "QueryContext", Field: "error", Message: "true", Sampled: true},
+		{TraceID: root.GetTrace().GetTraceID(), SpanID: root.GetSpanID(), Name: "log", Field: "log.error", Message: "retrying", Sampled: true},
+	}, reported, "empty errors aren't reported")
+
+	tags := bl.ErrorTags(ctx)
+	assert.Equal(t, map[string]string{
+		"trace.trace_id": root.GetTrace().GetTraceID(),
+		"trace.span_id":  root.GetSpanID(),
+	}, tags)
+	assert.Nil(t, bl.ErrorTags(context.Background()))
+}
+
+func TestErrorReporterAfterScrubbing(t *testing.T) {
+	var reported []trace.SpanError
+	for _, keep := range []bool{true, false} {
+		keep := keep
+		mo := &transmission.MockSender{}
+		bl := New(Config{
+			Transmission: mo,
+			SamplerHook: func(map[string]interface{}) (bool, int) {
+				return keep, 1
+			},
+			Scrubber: scrub.Default(),
+			PresendHook: func(fields map[string]interface{}) {
+				if _, ok := fields["app.error"]; ok {
+					fields["app.error"] = fields["app.error"].(string) + " (retried)"
+				}
+			},
+			ErrorReporter: func(e trace.SpanError) {
+				reported = append(reported, e)
+			},
+		})
+		_, root := bl.StartTrace(context.Background(), "handler")
+		root.AddField("app.error", "no account for jo@example.com")
+		root.Send()
+		bl.Close()
+	}
+	if assert.Len(t, reported, 2) {
+		assert.Equal(t, "no account for [REDACTED] (retried)", reported[0].Message,
+			"errors should be reported after the presend hook and scrubber")
+		assert.Equal(t, "no account for [REDACTED]", reported[1].Message,
+			"errors on spans sampled out should be scrubbed too")
+	}
+}
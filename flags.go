@@ -0,0 +1,55 @@
+package beeline
+
+import (
+	"context"
+
+	"github.com/honeycombio/beeline-go/trace"
+)
+
+// flagKeys names the feature_flag.<flag> fields.
+var flagKeys = trace.NewKeyPrefix("feature_flag.")
+
+// Reasons for a flag evaluation's variant, for RecordFlagEvaluation. They are
+// the reasons defined by OpenFeature, which flag SDKs generally use too.
+const (
+	FlagReasonStatic         = "STATIC"
+	FlagReasonDefault        = "DEFAULT"
+	FlagReasonTargetingMatch = "TARGETING_MATCH"
+	FlagReasonSplit          = "SPLIT"
+	FlagReasonCached         = "CACHED"
+	FlagReasonDisabled       = "DISABLED"
+	FlagReasonError          = "ERROR"
+)
+
+// RecordFlagEvaluation records that the feature flag flag evaluated to
+// variant, for reason, in the span in ctx, so requests can be grouped and
+// compared by the flags that shaped them. The span gets a
+// feature_flag.<flag> field holding the variant, and a feature_flag span
+// event with feature_flag.key, feature_flag.variant and feature_flag.reason,
+// the OpenTelemetry names, marks when the flag was evaluated.
+//
+// To record every evaluation made through OpenFeature, register the hook in
+// the wrappers/hnyopenfeature module:
+//
+//	openfeature.AddHooks(hnyopenfeature.NewHook())
+func RecordFlagEvaluation(ctx context.Context, flag, variant, reason string) {
+	defaultBeeline.RecordFlagEvaluation(ctx, flag, variant, reason)
+}
+
+// RecordFlagEvaluation records a feature flag evaluation in the span in ctx.
+// See the package-level RecordFlagEvaluation for details.
+func (b *Beeline) RecordFlagEvaluation(ctx context.Context, flag, variant, reason string) {
+	span := b.spanFromContext(ctx)
+	if span == nil {
+		return
+	}
+	span.AddField(flagKeys.Key(flag), variant)
+	fields := map[string]interface{}{
+		"feature_flag.key":     flag,
+		"feature_flag.variant": variant,
+	}
+	if reason != "" {
+		fields["feature_flag.reason"] = reason
+	}
+	span.SendSpanEvent("feature_flag", fields)
+}
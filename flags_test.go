@@ -0,0 +1,47 @@
+package beeline
+
+import (
+	"context"
+	"testing"
+
+	"github.com/honeycombio/libhoney-go/transmission"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordFlagEvaluation(t *testing.T) {
+	mo := &transmission.MockSender{}
+	bl := New(Config{Transmission: mo})
+	defer bl.Close()
+
+	ctx, root := bl.StartTrace(context.Background(), "handler")
+	bl.RecordFlagEvaluation(ctx, "new-checkout", "on", FlagReasonTargetingMatch)
+	bl.RecordFlagEvaluation(ctx, "dark-mode", "off", "")
+	bl.RecordFlagEvaluation(context.Background(), "ignored", "on", FlagReasonStatic)
+	root.Send()
+
+	events := mo.Events()
+	if assert.Len(t, events, 3) {
+		assert.Equal(t, map[string]interface{}{
+			"feature_flag.key":     "new-checkout",
+			"feature_flag.variant": "on",
+			"feature_flag.reason":  FlagReasonTargetingMatch,
+		}, pick(events[0].Data, "feature_flag.key", "feature_flag.variant", "feature_flag.reason"))
+		assert.Equal(t, "feature_flag", events[0].Data["name"])
+		assert.Equal(t, root.GetSpanID(), events[0].Data["trace.parent_id"])
+		assert.NotContains(t, events[1].Data, "feature_flag.reason")
+
+		assert.Equal(t, "on", events[2].Data["feature_flag.new-checkout"])
+		assert.Equal(t, "off", events[2].Data["feature_flag.dark-mode"])
+	}
+}
+
+// pick returns the fields of data named by keys that it has.
+func pick(data map[string]interface{}, keys ...string) map[string]interface{} {
+	picked := make(map[string]interface{})
+	for _, k := range keys {
+		if v, ok := data[k]; ok {
+			picked[k] = v
+		}
+	}
+	return picked
+}
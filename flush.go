@@ -0,0 +1,62 @@
+package beeline
+
+import (
+	"context"
+	"sync"
+
+	"github.com/honeycombio/beeline-go/client"
+	"github.com/honeycombio/libhoney-go/transmission"
+)
+
+// FlushFinished sends the events of the spans that have already been sent,
+// in the trace in ctx and every other, without sending the rest of the trace,
+// which stays open. Long request handlers can call it to make their early
+// spans visible in Honeycomb before the request completes. Unlike Flush, it
+// is safe to call while other goroutines are still sending spans.
+func FlushFinished(ctx context.Context) {
+	defaultBeeline.FlushFinished(ctx)
+}
+
+// FlushFinished sends the events of this instance's spans that have already
+// been sent. See the package-level FlushFinished for details.
+func (b *Beeline) FlushFinished(ctx context.Context) {
+	b.flushEvents()
+}
+
+// flushEvents sends the events queued by the instance's client.
+func (b *Beeline) flushEvents() {
+	if b.flusher != nil && (!b.global || client.Get() == b.client) {
+		b.flusher.flush()
+		return
+	}
+	if b.global {
+		client.Flush()
+	} else {
+		b.client.Flush()
+	}
+}
+
+// flushingSender wraps the sender a beeline's client sends with, so flushing
+// it doesn't race with spans being sent. Flushing a libhoney client stops
+// and restarts its sender, and an event that arrives in between would be sent
+// to a stopped sender, which for the default sender panics.
+type flushingSender struct {
+	transmission.Sender
+	lock sync.RWMutex
+}
+
+// Add passes ev to the wrapped sender, waiting for any flush in progress.
+func (s *flushingSender) Add(ev *transmission.Event) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	s.Sender.Add(ev)
+}
+
+// flush sends the events queued by the wrapped sender by stopping and
+// restarting it, holding events being added until it has restarted.
+func (s *flushingSender) flush() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.Sender.Stop()
+	s.Sender.Start()
+}
@@ -0,0 +1,91 @@
+package beeline
+
+import (
+	"bytes"
+	"context"
+	"runtime"
+	"strconv"
+	"sync"
+
+	"github.com/honeycombio/beeline-go/trace"
+)
+
+// boundSpans holds the spans bound with Bind, keyed by goroutine ID.
+var boundSpans = struct {
+	sync.RWMutex
+	spans map[uint64]*trace.Span
+}{spans: make(map[uint64]*trace.Span)}
+
+// Bind makes span the current span of the calling goroutine, for beelines
+// with GoroutineLocalSpans set. Deep call stacks that dropped their context
+// can then still add fields to span by passing any context, such as
+// context.Background(), to AddField. Binding a span replaces the one already
+// bound, if any. Every Bind must be paired with an Unbind on the same
+// goroutine, usually deferred, or the span is held until the goroutine binds
+// another one.
+//
+// Bound spans are not inherited by goroutines the caller starts; bind the
+// span again in the new goroutine if it should have it too.
+func Bind(span *trace.Span) {
+	if span == nil {
+		Unbind()
+		return
+	}
+	id := goroutineID()
+	boundSpans.Lock()
+	boundSpans.spans[id] = span
+	boundSpans.Unlock()
+}
+
+// Unbind removes the span bound to the calling goroutine with Bind.
+func Unbind() {
+	id := goroutineID()
+	boundSpans.Lock()
+	delete(boundSpans.spans, id)
+	boundSpans.Unlock()
+}
+
+// BoundSpan returns the span bound to the calling goroutine with Bind, or nil
+// if there is none.
+func BoundSpan() *trace.Span {
+	boundSpans.RLock()
+	empty := len(boundSpans.spans) == 0
+	boundSpans.RUnlock()
+	if empty {
+		// skip the cost of finding the goroutine ID
+		return nil
+	}
+	id := goroutineID()
+	boundSpans.RLock()
+	span := boundSpans.spans[id]
+	boundSpans.RUnlock()
+	return span
+}
+
+// spanFromContext returns the span in ctx, falling back to the span bound to
+// the calling goroutine if b has GoroutineLocalSpans set.
+func (b *Beeline) spanFromContext(ctx context.Context) *trace.Span {
+	if span := trace.GetSpanFromContext(ctx); span != nil {
+		return span
+	}
+	if b.goroutineLocal {
+		return BoundSpan()
+	}
+	return nil
+}
+
+var goroutinePrefix = []byte("goroutine ")
+
+// goroutineID returns the ID of the calling goroutine. Go deliberately doesn't
+// expose it, so it is read from the first line of the goroutine's stack trace,
+// which looks like "goroutine 123 [running]:".
+func goroutineID() uint64 {
+	var buf [64]byte
+	b := buf[:runtime.Stack(buf[:], false)]
+	b = bytes.TrimPrefix(b, goroutinePrefix)
+	if i := bytes.IndexByte(b, ' '); i >= 0 {
+		b = b[:i]
+	}
+	id, _ := strconv.ParseUint(string(b), 10, 64)
+	return id
+}
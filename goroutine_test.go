@@ -0,0 +1,60 @@
+package beeline
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/honeycombio/beeline-go/trace"
+	libhoney "github.com/honeycombio/libhoney-go"
+	"github.com/honeycombio/libhoney-go/transmission"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGoroutineLocalSpans(t *testing.T) {
+	mo := &transmission.MockSender{}
+	client, _ := libhoney.NewClient(libhoney.ClientConfig{APIKey: "placeholder", Dataset: "placeholder", Transmission: mo})
+	bl := New(Config{Client: client, GoroutineLocalSpans: true})
+	off := New(Config{Client: client})
+
+	_, span := bl.StartSpan(context.Background(), "root")
+	Bind(span)
+	assert.Equal(t, span, BoundSpan())
+	bl.AddField(context.Background(), "bound", true)
+	off.AddField(context.Background(), "unbound", true)
+	_, child := bl.StartSpan(context.TODO(), "child")
+	assert.Equal(t, span.GetSpanID(), child.GetParentID())
+	child.Send()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assert.Nil(t, BoundSpan(), "bound spans aren't inherited")
+		other := &trace.Span{}
+		Bind(other)
+		assert.Equal(t, other, BoundSpan())
+		Unbind()
+	}()
+	wg.Wait()
+	assert.Equal(t, span, BoundSpan())
+
+	Unbind()
+	assert.Nil(t, BoundSpan())
+	span.Send()
+
+	events := mo.Events()
+	assert.Equal(t, 2, len(events))
+	assert.Equal(t, true, events[1].Data["app.bound"])
+	_, ok := events[1].Data["app.unbound"]
+	assert.False(t, ok, "beelines without GoroutineLocalSpans ignore bound spans")
+}
+
+func TestGoroutineID(t *testing.T) {
+	ids := make(chan uint64, 2)
+	go func() { ids <- goroutineID() }()
+	go func() { ids <- goroutineID() }()
+	a, b := <-ids, <-ids
+	assert.NotZero(t, a)
+	assert.NotEqual(t, a, b)
+}
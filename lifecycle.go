@@ -0,0 +1,64 @@
+package beeline
+
+import (
+	"os"
+	"time"
+
+	libhoney "github.com/honeycombio/libhoney-go"
+)
+
+// sendServiceStart sends the service_start event when LifecycleEvents is
+// set.
+func (b *Beeline) sendServiceStart(config Config) {
+	b.started = time.Now()
+	ev := b.lifecycleEvent("service_start")
+	info := b.Info()
+	ev.AddField("config.key_type", string(info.KeyType))
+	ev.AddField("config.warnings", len(info.Warnings))
+	b.lock.RLock()
+	traceConfig := b.traceConfig
+	b.lock.RUnlock()
+	if traceConfig.SamplerHook != nil {
+		ev.AddField("config.sampler", "hook")
+	} else {
+		ev.AddField("config.sampler", "deterministic")
+		ev.AddField("config.sample_rate", config.SampleRate)
+	}
+	if len(config.PropagationFormats) > 0 {
+		formats := make([]string, len(config.PropagationFormats))
+		for i, f := range config.PropagationFormats {
+			formats[i] = string(f)
+		}
+		ev.AddField("config.propagation_formats", formats)
+	}
+	ev.Send()
+}
+
+// sendServiceStop sends the service_stop event when LifecycleEvents is set.
+func (b *Beeline) sendServiceStop() {
+	ev := b.lifecycleEvent("service_stop")
+	ev.AddField("service.uptime_ms", float64(time.Since(b.started))/float64(time.Millisecond))
+	ev.Send()
+}
+
+// lifecycleEvent returns an event of type typ, with the fields describing
+// the running binary, to send where this instance's traces are sent.
+func (b *Beeline) lifecycleEvent(typ string) *libhoney.Event {
+	bld := b.client.NewBuilder()
+	b.lock.RLock()
+	if b.writeKey != "" {
+		bld.WriteKey = b.writeKey
+	}
+	if b.dataset != "" {
+		bld.Dataset = b.dataset
+	}
+	b.lock.RUnlock()
+	ev := bld.NewEvent()
+	ev.AddField("meta.type", typ)
+	ev.AddField("name", typ)
+	ev.AddField("process.pid", os.Getpid())
+	for k, v := range buildFields() {
+		ev.AddField(k, v)
+	}
+	return ev
+}
@@ -0,0 +1,35 @@
+package beeline
+
+import (
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/honeycombio/libhoney-go/transmission"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLifecycleEvents(t *testing.T) {
+	mo := &transmission.MockSender{}
+	bl := New(Config{Transmission: mo, LifecycleEvents: true, SampleRate: 10})
+	evs := mo.Events()
+	if assert.Equal(t, 1, len(evs)) {
+		start := evs[0].Data
+		assert.Equal(t, "service_start", start["meta.type"])
+		assert.Equal(t, runtime.Version(), start["build.go_version"])
+		assert.Equal(t, os.Getpid(), start["process.pid"])
+		assert.Equal(t, "deterministic", start["config.sampler"])
+		assert.Equal(t, uint(10), start["config.sample_rate"])
+		assert.Equal(t, uint(1), evs[0].SampleRate, "lifecycle events aren't sampled")
+	}
+	bl.Close()
+	evs = mo.Events()
+	if assert.Equal(t, 2, len(evs)) {
+		assert.Equal(t, "service_stop", evs[1].Data["meta.type"])
+		assert.Contains(t, evs[1].Data, "service.uptime_ms")
+	}
+
+	quiet := New(Config{Transmission: mo})
+	quiet.Close()
+	assert.Equal(t, 2, len(mo.Events()), "lifecycle events are off by default")
+}
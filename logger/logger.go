@@ -0,0 +1,90 @@
+// Package logger defines the interface the beeline uses to report its own
+// diagnostics, such as configuration warnings and failed sends. Set
+// beeline.Config.Logger to an implementation to send them to your own
+// structured logs; the zapadapter, logrusadapter, zerologadapter, and
+// slogadapter subpackages wrap popular logging libraries.
+package logger
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Logger receives the beeline's diagnostics. keyvals holds alternating keys
+// and values, as in Info("sent batch", "count", 50, "status", 202); keys
+// are strings. Implementations must be safe for concurrent use.
+type Logger interface {
+	Debug(msg string, keyvals ...interface{})
+	Info(msg string, keyvals ...interface{})
+	Warn(msg string, keyvals ...interface{})
+	Error(msg string, keyvals ...interface{})
+}
+
+// Nop is a Logger that discards everything.
+type Nop struct{}
+
+func (Nop) Debug(msg string, keyvals ...interface{}) {}
+func (Nop) Info(msg string, keyvals ...interface{})  {}
+func (Nop) Warn(msg string, keyvals ...interface{})  {}
+func (Nop) Error(msg string, keyvals ...interface{}) {}
+
+// Std is a Logger that prints with the standard log package. Only errors are
+// printed unless Verbose is set.
+type Std struct {
+	Verbose bool
+}
+
+func (l Std) Debug(msg string, keyvals ...interface{}) { l.print(false, "DEBUG", msg, keyvals) }
+func (l Std) Info(msg string, keyvals ...interface{})  { l.print(false, "INFO", msg, keyvals) }
+func (l Std) Warn(msg string, keyvals ...interface{})  { l.print(false, "WARN", msg, keyvals) }
+func (l Std) Error(msg string, keyvals ...interface{}) { l.print(true, "ERROR", msg, keyvals) }
+
+func (l Std) print(always bool, level, msg string, keyvals []interface{}) {
+	if !always && !l.Verbose {
+		return
+	}
+	log.Printf("beeline %s: %s", level, Format(msg, keyvals...))
+}
+
+// Format renders msg and keyvals as a single line, eg `sent batch count=50`.
+// It is useful to Loggers that wrap unstructured logging libraries.
+func Format(msg string, keyvals ...interface{}) string {
+	var b strings.Builder
+	b.WriteString(msg)
+	for i := 0; i < len(keyvals); i += 2 {
+		b.WriteByte(' ')
+		if i+1 < len(keyvals) {
+			fmt.Fprintf(&b, "%v=%v", keyvals[i], keyvals[i+1])
+		} else {
+			fmt.Fprintf(&b, "%v", keyvals[i])
+		}
+	}
+	return b.String()
+}
+
+// Fields turns keyvals into a map, for Loggers that wrap libraries taking
+// fields as a map. A trailing key without a value gets a nil value.
+func Fields(keyvals ...interface{}) map[string]interface{} {
+	fields := make(map[string]interface{}, len(keyvals)/2)
+	for i := 0; i < len(keyvals); i += 2 {
+		key := fmt.Sprint(keyvals[i])
+		if i+1 < len(keyvals) {
+			fields[key] = keyvals[i+1]
+		} else {
+			fields[key] = nil
+		}
+	}
+	return fields
+}
+
+// Printf adapts a Logger to the Printf-style logger used by libhoney,
+// logging each line at debug level.
+type Printf struct {
+	Logger Logger
+}
+
+// Printf logs the formatted message at debug level.
+func (p Printf) Printf(format string, args ...interface{}) {
+	p.Logger.Debug(fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,33 @@
+package logger
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormat(t *testing.T) {
+	assert.Equal(t, "sent batch count=50 status=202", Format("sent batch", "count", 50, "status", 202))
+	assert.Equal(t, "odd key", Format("odd", "key"))
+}
+
+func TestFields(t *testing.T) {
+	assert.Equal(t, map[string]interface{}{"count": 50, "dangling": nil}, Fields("count", 50, "dangling"))
+}
+
+func TestStd(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	Std{}.Warn("quiet")
+	Std{}.Error("loud", "err", "boom")
+	assert.NotContains(t, buf.String(), "quiet", "only errors should be printed unless verbose")
+	assert.Contains(t, buf.String(), "beeline ERROR: loud err=boom")
+
+	Std{Verbose: true}.Debug("chatty")
+	assert.Contains(t, buf.String(), "beeline DEBUG: chatty")
+}
@@ -0,0 +1,38 @@
+// Package logrusadapter sends the beeline's diagnostics to a logrus logger.
+//
+//   beeline.Init(beeline.Config{
+//     WriteKey: "abcabc123123defdef456456",
+//     Logger:   logrusadapter.New(logrus.StandardLogger()),
+//   })
+package logrusadapter
+
+import (
+	"github.com/sirupsen/logrus"
+
+	"github.com/honeycombio/beeline-go/logger"
+)
+
+// Logger is a logger.Logger backed by a logrus logger.
+type Logger struct {
+	l logrus.FieldLogger
+}
+
+// New returns a Logger that writes to l, which may be a *logrus.Logger or a
+// *logrus.Entry with fields of its own.
+func New(l logrus.FieldLogger) *Logger {
+	return &Logger{l: l}
+}
+
+var _ logger.Logger = (*Logger)(nil)
+
+func (l *Logger) Debug(msg string, keyvals ...interface{}) { l.with(keyvals).Debug(msg) }
+func (l *Logger) Info(msg string, keyvals ...interface{})  { l.with(keyvals).Info(msg) }
+func (l *Logger) Warn(msg string, keyvals ...interface{})  { l.with(keyvals).Warn(msg) }
+func (l *Logger) Error(msg string, keyvals ...interface{}) { l.with(keyvals).Error(msg) }
+
+func (l *Logger) with(keyvals []interface{}) logrus.FieldLogger {
+	if len(keyvals) == 0 {
+		return l.l
+	}
+	return l.l.WithFields(logrus.Fields(logger.Fields(keyvals...)))
+}
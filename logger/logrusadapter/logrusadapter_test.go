@@ -0,0 +1,18 @@
+package logrusadapter
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogger(t *testing.T) {
+	l, hook := test.NewNullLogger()
+	New(l).Error("failed to send", "status", 500)
+	entry := hook.LastEntry()
+	assert.Equal(t, logrus.ErrorLevel, entry.Level)
+	assert.Equal(t, "failed to send", entry.Message)
+	assert.Equal(t, 500, entry.Data["status"])
+}
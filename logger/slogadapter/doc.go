@@ -0,0 +1,8 @@
+// Package slogadapter sends the beeline's diagnostics to a log/slog logger.
+// It requires Go 1.21 or later.
+//
+//   beeline.Init(beeline.Config{
+//     WriteKey: "abcabc123123defdef456456",
+//     Logger:   slogadapter.New(slog.Default()),
+//   })
+package slogadapter
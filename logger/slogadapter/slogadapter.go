@@ -0,0 +1,39 @@
+//go:build go1.21
+// +build go1.21
+
+package slogadapter
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/honeycombio/beeline-go/logger"
+)
+
+// Logger is a logger.Logger backed by a slog.Logger.
+type Logger struct {
+	l *slog.Logger
+}
+
+// New returns a Logger that writes to l.
+func New(l *slog.Logger) *Logger {
+	return &Logger{l: l}
+}
+
+var _ logger.Logger = (*Logger)(nil)
+
+func (l *Logger) Debug(msg string, keyvals ...interface{}) {
+	l.l.Log(context.Background(), slog.LevelDebug, msg, keyvals...)
+}
+
+func (l *Logger) Info(msg string, keyvals ...interface{}) {
+	l.l.Log(context.Background(), slog.LevelInfo, msg, keyvals...)
+}
+
+func (l *Logger) Warn(msg string, keyvals ...interface{}) {
+	l.l.Log(context.Background(), slog.LevelWarn, msg, keyvals...)
+}
+
+func (l *Logger) Error(msg string, keyvals ...interface{}) {
+	l.l.Log(context.Background(), slog.LevelError, msg, keyvals...)
+}
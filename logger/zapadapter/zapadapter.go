@@ -0,0 +1,30 @@
+// Package zapadapter sends the beeline's diagnostics to a zap logger.
+//
+//   beeline.Init(beeline.Config{
+//     WriteKey: "abcabc123123defdef456456",
+//     Logger:   zapadapter.New(zapLogger),
+//   })
+package zapadapter
+
+import (
+	"go.uber.org/zap"
+
+	"github.com/honeycombio/beeline-go/logger"
+)
+
+// Logger is a logger.Logger backed by a zap.SugaredLogger.
+type Logger struct {
+	s *zap.SugaredLogger
+}
+
+// New returns a Logger that writes to l.
+func New(l *zap.Logger) *Logger {
+	return &Logger{s: l.Sugar()}
+}
+
+var _ logger.Logger = (*Logger)(nil)
+
+func (l *Logger) Debug(msg string, keyvals ...interface{}) { l.s.Debugw(msg, keyvals...) }
+func (l *Logger) Info(msg string, keyvals ...interface{})  { l.s.Infow(msg, keyvals...) }
+func (l *Logger) Warn(msg string, keyvals ...interface{})  { l.s.Warnw(msg, keyvals...) }
+func (l *Logger) Error(msg string, keyvals ...interface{}) { l.s.Errorw(msg, keyvals...) }
@@ -0,0 +1,20 @@
+package zapadapter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestLogger(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	New(zap.New(core)).Warn("failed to send", "status", 500)
+	entries := logs.All()
+	assert.Len(t, entries, 1)
+	assert.Equal(t, zapcore.WarnLevel, entries[0].Level)
+	assert.Equal(t, "failed to send", entries[0].Message)
+	assert.Equal(t, map[string]interface{}{"status": int64(500)}, entries[0].ContextMap())
+}
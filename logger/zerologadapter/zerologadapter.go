@@ -0,0 +1,37 @@
+// Package zerologadapter sends the beeline's diagnostics to a zerolog logger.
+//
+//   beeline.Init(beeline.Config{
+//     WriteKey: "abcabc123123defdef456456",
+//     Logger:   zerologadapter.New(zlog.Logger),
+//   })
+package zerologadapter
+
+import (
+	"github.com/rs/zerolog"
+
+	"github.com/honeycombio/beeline-go/logger"
+)
+
+// Logger is a logger.Logger backed by a zerolog.Logger.
+type Logger struct {
+	l zerolog.Logger
+}
+
+// New returns a Logger that writes to l.
+func New(l zerolog.Logger) *Logger {
+	return &Logger{l: l}
+}
+
+var _ logger.Logger = (*Logger)(nil)
+
+func (l *Logger) Debug(msg string, keyvals ...interface{}) { log(l.l.Debug(), msg, keyvals) }
+func (l *Logger) Info(msg string, keyvals ...interface{})  { log(l.l.Info(), msg, keyvals) }
+func (l *Logger) Warn(msg string, keyvals ...interface{})  { log(l.l.Warn(), msg, keyvals) }
+func (l *Logger) Error(msg string, keyvals ...interface{}) { log(l.l.Error(), msg, keyvals) }
+
+func log(ev *zerolog.Event, msg string, keyvals []interface{}) {
+	if len(keyvals) > 0 {
+		ev = ev.Fields(logger.Fields(keyvals...))
+	}
+	ev.Msg(msg)
+}
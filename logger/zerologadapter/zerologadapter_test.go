@@ -0,0 +1,15 @@
+package zerologadapter
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	New(zerolog.New(&buf)).Info("sent batch", "count", 50)
+	assert.JSONEq(t, `{"level":"info","count":50,"message":"sent batch"}`, buf.String())
+}
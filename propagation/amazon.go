@@ -52,7 +52,6 @@ func MarshalAmazonTraceContext(prop *PropagationContext) string {
 //
 // If the header cannot be used to construct a valid PropagationContext, an error will be returned.
 func UnmarshalAmazonTraceContext(header string) (*PropagationContext, error) {
-	segments := strings.Split(header, ";")
 	// From https://docs.aws.amazon.com/elasticloadbalancing/latest/application/load-balancer-request-tracing.html
 	// If the X-Amzn-Trace-Id header is not present on an incoming request, the load balancer generates a header
 	// with a Root field and forwards the request. If the X-Amzn-Trace-Id header is present and has a Root field,
@@ -66,20 +65,22 @@ func UnmarshalAmazonTraceContext(header string) (*PropagationContext, error) {
 	prop := &PropagationContext{}
 	prop.TraceContext = make(map[string]interface{})
 	var parent string
-	for _, segment := range segments {
-		keyval := strings.SplitN(segment, "=", 2)
-		if len(keyval) < 2 {
+	for rest := header; rest != ""; {
+		var segment string
+		segment, rest, _ = cut(rest, ';')
+		key, val, found := cut(segment, '=')
+		if !found {
 			continue
 		}
-		switch strings.ToLower(keyval[0]) {
-		case "self":
-			prop.ParentID = keyval[1]
-		case "root":
-			prop.TraceID = keyval[1]
-		case "parent":
-			parent = keyval[1]
+		switch {
+		case strings.EqualFold(key, "self"):
+			prop.ParentID = val
+		case strings.EqualFold(key, "root"):
+			prop.TraceID = val
+		case strings.EqualFold(key, "parent"):
+			parent = val
 		default:
-			prop.TraceContext[keyval[0]] = keyval[1]
+			prop.TraceContext[key] = val
 		}
 	}
 
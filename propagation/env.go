@@ -0,0 +1,54 @@
+package propagation
+
+import "strings"
+
+// EnvTrace is the environment variable trace context is passed to child
+// processes in, so that a CLI tool or worker started by an instrumented
+// process continues its trace. Its value is in the Honeycomb header format.
+const EnvTrace = "HONEYCOMB_TRACE"
+
+// MarshalEnvTraceContext returns the environment variable to pass prop to a
+// child process in, like "HONEYCOMB_TRACE=1;trace_id=...", ready to be
+// appended to an exec.Cmd's Env.
+//
+// If prop is nil, the returned value will be an empty string.
+func MarshalEnvTraceContext(prop *PropagationContext) string {
+	if prop == nil {
+		return ""
+	}
+	return EnvTrace + "=" + MarshalHoneycombTraceContext(prop)
+}
+
+// UnmarshalEnvTraceContext parses the trace context in env, a list of
+// "key=value" strings like os.Environ returns. As in os/exec, the last
+// EnvTrace entry wins.
+//
+// If env has no trace context, it returns nil and no error. If the trace
+// context can't be parsed, an error will be returned.
+func UnmarshalEnvTraceContext(env []string) (*PropagationContext, error) {
+	value, found := "", false
+	for _, kv := range env {
+		if k, v, ok := cut(kv, '='); ok && k == EnvTrace {
+			value, found = v, true
+		}
+	}
+	if !found || value == "" {
+		return nil, nil
+	}
+	return UnmarshalHoneycombTraceContext(value)
+}
+
+// SetEnvTraceContext returns a copy of env with any trace context in it
+// replaced by prop's, or removed if prop is nil.
+func SetEnvTraceContext(env []string, prop *PropagationContext) []string {
+	set := make([]string, 0, len(env)+1)
+	for _, kv := range env {
+		if !strings.HasPrefix(kv, EnvTrace+"=") {
+			set = append(set, kv)
+		}
+	}
+	if prop != nil {
+		set = append(set, MarshalEnvTraceContext(prop))
+	}
+	return set
+}
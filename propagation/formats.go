@@ -0,0 +1,63 @@
+package propagation
+
+import (
+	"context"
+	"fmt"
+)
+
+// Format is a trace context header format that MarshalHeaders can emit.
+type Format string
+
+const (
+	// FormatHoneycomb is the X-Honeycomb-Trace header.
+	FormatHoneycomb Format = "honeycomb"
+	// FormatW3C is the traceparent and tracestate headers of the W3C Trace
+	// Context specification.
+	FormatW3C Format = "w3c"
+	// FormatAmazon is the X-Amzn-Trace-Id header.
+	FormatAmazon Format = "amazon"
+)
+
+// ParseFormat returns the Format named s, as in the Format constants.
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(s); f {
+	case FormatHoneycomb, FormatW3C, FormatAmazon:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown propagation format %q", s)
+}
+
+// MarshalHeaders uses the information in prop to create trace context headers
+// in each of formats, so a trace can be continued by services that only
+// understand some of them, eg while migrating from one format to another. The
+// headers are returned as a map of header names to values, ready to be added
+// to an outbound request. Every header is built from the same prop and so
+// identifies the same trace and parent span.
+//
+// As with MarshalW3CTraceContext, ctx holds any tracestate to pass along. W3C
+// headers are only included if prop's IDs are valid W3C IDs, and the
+// tracestate header only if it isn't empty.
+//
+// If prop is nil or formats is empty, the return value will be an empty map.
+func MarshalHeaders(ctx context.Context, prop *PropagationContext, formats ...Format) map[string]string {
+	headers := make(map[string]string)
+	if prop == nil {
+		return headers
+	}
+	for _, f := range formats {
+		switch f {
+		case FormatHoneycomb:
+			headers[TracePropagationHTTPHeader] = MarshalHoneycombTraceContext(prop)
+		case FormatAmazon:
+			headers[amazonTracePropagationHTTPHeader] = MarshalAmazonTraceContext(prop)
+		case FormatW3C:
+			_, w3c := MarshalW3CTraceContext(ctx, prop)
+			for k, v := range w3c {
+				if v != "" {
+					headers[k] = v
+				}
+			}
+		}
+	}
+	return headers
+}
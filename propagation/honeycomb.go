@@ -5,7 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/url"
-	"strings"
+	"strconv"
 )
 
 // assumes a header of the form:
@@ -20,6 +20,7 @@ import (
 //  trace_id=${traceId}    - traceId is an opaque ascii string which shall not include ','
 //  parent_id=${spanId}    - spanId is an opaque ascii string which shall not include ','
 //  dataset=${datasetId}   - datasetId is the slug for the honeycomb dataset to which downstream spans should be sent; shall not include ','
+//  hops=${hops}           - hops is the number of process boundaries the trace has crossed, counting this one
 //  context=${contextBlob} - contextBlob is a base64 encoded json object.
 //
 // ex: X-Honeycomb-Trace: 1;trace_id=weofijwoeifj,parent_id=owefjoweifj,context=SGVsbG8gV29ybGQ=
@@ -50,13 +51,18 @@ func MarshalHoneycombTraceContext(prop *PropagationContext) string {
 	if prop.Dataset != "" {
 		datasetClause = fmt.Sprintf("dataset=%s,", url.QueryEscape(prop.Dataset))
 	}
+	var hopsClause string
+	if prop.Hops > 0 {
+		hopsClause = fmt.Sprintf("hops=%d,", prop.Hops)
+	}
 
 	return fmt.Sprintf(
-		"%d;trace_id=%s,parent_id=%s,%scontext=%s",
+		"%d;trace_id=%s,parent_id=%s,%s%scontext=%s",
 		TracePropagationVersion,
 		prop.TraceID,
 		prop.ParentID,
 		datasetClause,
+		hopsClause,
 		tcB64,
 	)
 }
@@ -68,11 +74,11 @@ func MarshalHoneycombTraceContext(prop *PropagationContext) string {
 // an error will be returned.
 func UnmarshalHoneycombTraceContext(header string) (*PropagationContext, error) {
 	// pull the version out of the header
-	getVer := strings.SplitN(header, ";", 2)
-	if getVer[0] == "1" {
-		return unmarshalHoneycombTraceContextV1(getVer[1])
+	version, payload, _ := cut(header, ';')
+	if version == "1" {
+		return unmarshalHoneycombTraceContextV1(payload)
 	}
-	return nil, &PropagationError{fmt.Sprintf("unrecognized version for trace header %s", getVer[0]), nil}
+	return nil, &PropagationError{fmt.Sprintf("unrecognized version for trace header %s", version), nil}
 }
 
 // unmarshalHoneycombTraceContextV1 takes the trace header, stripped of the
@@ -80,20 +86,29 @@ func UnmarshalHoneycombTraceContext(header string) (*PropagationContext, error)
 // parent id but not a trace id, or if the header contains an unparseable
 // string in the trace context, an error will be returned.
 func unmarshalHoneycombTraceContextV1(header string) (*PropagationContext, error) {
-	clauses := strings.Split(header, ",")
 	var prop = &PropagationContext{}
 	var tcB64 string
-	for _, clause := range clauses {
-		keyval := strings.SplitN(clause, "=", 2)
-		switch keyval[0] {
+	// scan the clauses in place rather than splitting them into slices,
+	// since this runs for every incoming request
+	for header != "" {
+		var clause string
+		clause, header, _ = cut(header, ',')
+		key, val, _ := cut(clause, '=')
+		switch key {
 		case "trace_id":
-			prop.TraceID = keyval[1]
+			prop.TraceID = val
 		case "parent_id":
-			prop.ParentID = keyval[1]
+			prop.ParentID = val
 		case "dataset":
-			prop.Dataset, _ = url.QueryUnescape(keyval[1])
+			prop.Dataset, _ = url.QueryUnescape(val)
+		case "hops":
+			// an unparseable count is ignored rather than failing the
+			// whole header
+			if hops, err := strconv.ParseUint(val, 10, 32); err == nil {
+				prop.Hops = uint(hops)
+			}
 		case "context":
-			tcB64 = keyval[1]
+			tcB64 = val
 		}
 	}
 	if prop.TraceID == "" && prop.ParentID != "" {
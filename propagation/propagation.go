@@ -6,6 +6,7 @@ package propagation
 
 import (
 	"fmt"
+	"strings"
 )
 
 // PropagationContext contains information about a trace that can cross process boundaries.
@@ -16,6 +17,10 @@ type PropagationContext struct {
 	Dataset      string
 	TraceContext map[string]interface{}
 	TraceFlags   byte
+	// Hops is the number of process boundaries the trace has crossed,
+	// counting the one it is being propagated across. It is only carried by
+	// the Honeycomb header.
+	Hops uint
 }
 
 // hasTraceID checks that the trace ID is valid.
@@ -74,3 +79,14 @@ func UnmarshalTraceContext(header string) (*PropagationContext, error) {
 func UnmarshalTraceContextV1(header string) (*PropagationContext, error) {
 	return unmarshalHoneycombTraceContextV1(header)
 }
+
+// cut slices s around the first instance of sep, returning the text before
+// and after it. If sep isn't found, it returns s, "", false. The unmarshal
+// functions use it to scan headers in place instead of splitting them into
+// slices.
+func cut(s string, sep byte) (before, after string, found bool) {
+	if i := strings.IndexByte(s, sep); i >= 0 {
+		return s[:i], s[i+1:], true
+	}
+	return s, "", false
+}
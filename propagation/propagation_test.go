@@ -3,6 +3,7 @@ package propagation
 import (
 	"context"
 	"encoding/hex"
+	"net"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -95,6 +96,51 @@ func TestMarshalTraceContext(t *testing.T) {
 	assert.Equal(t, "1;trace_id=,parent_id=,dataset=imadataset,context=bnVsbA==", marshaled)
 }
 
+func TestMarshalTraceContextHops(t *testing.T) {
+	prop := &PropagationContext{
+		TraceID:  "abcdef123456",
+		ParentID: "0102030405",
+		Hops:     3,
+	}
+	marshaled := MarshalTraceContext(prop)
+	assert.Equal(t, "1;trace_id=abcdef123456,parent_id=0102030405,hops=3,context=bnVsbA==", marshaled)
+
+	returned, err := UnmarshalTraceContext(marshaled)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(3), returned.Hops, "roundtrip hops")
+
+	returned, err = UnmarshalTraceContext("1;trace_id=abcdef123456,parent_id=0102030405,hops=lots")
+	assert.NoError(t, err, "a bad hop count shouldn't fail the header")
+	assert.Equal(t, uint(0), returned.Hops)
+}
+
+func TestEnvTraceContext(t *testing.T) {
+	prop := &PropagationContext{
+		TraceID:  "abcdef123456",
+		ParentID: "0102030405",
+		Hops:     1,
+	}
+	marshaled := MarshalEnvTraceContext(prop)
+	assert.Equal(t, "HONEYCOMB_TRACE=1;trace_id=abcdef123456,parent_id=0102030405,hops=1,context=bnVsbA==", marshaled)
+	assert.Equal(t, "", MarshalEnvTraceContext(nil))
+
+	env := SetEnvTraceContext([]string{"PATH=/bin", "HONEYCOMB_TRACE=1;trace_id=old,parent_id=old"}, prop)
+	assert.Equal(t, []string{"PATH=/bin", marshaled}, env, "the old trace context should be replaced")
+	assert.Equal(t, []string{"PATH=/bin"}, SetEnvTraceContext(env, nil))
+
+	returned, err := UnmarshalEnvTraceContext(env)
+	assert.NoError(t, err)
+	assert.Equal(t, prop.TraceID, returned.TraceID)
+	assert.Equal(t, prop.ParentID, returned.ParentID)
+	assert.Equal(t, uint(1), returned.Hops)
+
+	returned, err = UnmarshalEnvTraceContext([]string{"PATH=/bin", "HONEYCOMB_TRACE="})
+	assert.NoError(t, err)
+	assert.Nil(t, returned, "an empty trace context is no trace context")
+	_, err = UnmarshalEnvTraceContext([]string{"HONEYCOMB_TRACE=garbage"})
+	assert.Error(t, err)
+}
+
 func TestMarshalAmazonTraceContext(t *testing.T) {
 	// According to the documentation for load balancer request tracing:
 	// https://docs.aws.amazon.com/elasticloadbalancing/latest/application/load-balancer-request-tracing.html
@@ -197,6 +243,12 @@ func TestUnmarshalTraceContext(t *testing.T) {
 			},
 			false,
 		},
+		{
+			"v1 with no payload",
+			"1",
+			&PropagationContext{},
+			false,
+		},
 		{
 			"v1, parent_id without trace_id",
 			"1;parent_id=12345",
@@ -322,3 +374,156 @@ func TestUnmarshalAmazonTraceContext(t *testing.T) {
 		}
 	}
 }
+
+func TestUnmarshalW3CTraceparent(t *testing.T) {
+	testCases := []struct {
+		name        string
+		traceparent string
+		valid       bool
+	}{
+		{"sampled", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01", true},
+		{"future version with more fields", "01-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-09-extra", true},
+		{"version 00 with unknown flags", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-09", false},
+		{"invalid version ff", "ff-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01", false},
+		{"uppercase hex", "00-0AF7651916CD43DD8448EB211C80319C-b7ad6b7169203331-01", false},
+		{"zero trace id", "00-00000000000000000000000000000000-b7ad6b7169203331-01", false},
+		{"zero span id", "00-0af7651916cd43dd8448eb211c80319c-0000000000000000-01", false},
+		{"short", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b71692033-01", false},
+		{"trailing garbage", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01x", false},
+	}
+	for _, tt := range testCases {
+		_, prop, err := UnmarshalW3CTraceContext(context.Background(), map[string]string{"traceparent": tt.traceparent})
+		if !tt.valid {
+			assert.Error(t, err, tt.name)
+			continue
+		}
+		if assert.NoError(t, err, tt.name) {
+			assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", prop.TraceID, tt.name)
+			assert.Equal(t, "b7ad6b7169203331", prop.ParentID, tt.name)
+			assert.Equal(t, byte(1), prop.TraceFlags, tt.name)
+		}
+	}
+}
+
+func TestMarshalHeaders(t *testing.T) {
+	prop := &PropagationContext{
+		TraceID:      "0af7651916cd43dd8448eb211c80319c",
+		ParentID:     "b7ad6b7169203331",
+		Dataset:      "myapp",
+		TraceContext: map[string]interface{}{"userID": "1"},
+	}
+	headers := MarshalHeaders(context.Background(), prop, FormatHoneycomb, FormatW3C, FormatAmazon)
+	assert.Equal(t, 3, len(headers), "empty tracestate headers should be left out")
+
+	// every format should identify the same trace and parent
+	hny, err := UnmarshalHoneycombTraceContext(headers["X-Honeycomb-Trace"])
+	if assert.NoError(t, err) {
+		assert.Equal(t, prop, hny)
+	}
+	_, w3c, err := UnmarshalW3CTraceContext(context.Background(), headers)
+	if assert.NoError(t, err) {
+		assert.Equal(t, prop.TraceID, w3c.TraceID)
+		assert.Equal(t, prop.ParentID, w3c.ParentID)
+	}
+	amzn, err := UnmarshalAmazonTraceContext(headers["X-Amzn-Trace-Id"])
+	if assert.NoError(t, err) {
+		assert.Equal(t, prop.TraceID, amzn.TraceID)
+		assert.Equal(t, prop.ParentID, amzn.ParentID)
+	}
+
+	// tracestate from an incoming request is passed along
+	ctx, _, err := UnmarshalW3CTraceContext(context.Background(), map[string]string{
+		"traceparent": "00-0af7651916cd43dd8448eb211c80319c-00f067aa0ba902b7-01",
+		"tracestate":  "foo=bar",
+	})
+	assert.NoError(t, err)
+	headers = MarshalHeaders(ctx, prop, FormatW3C)
+	assert.Equal(t, "foo=bar", headers["tracestate"])
+
+	// IDs that aren't valid W3C IDs leave the W3C headers out
+	headers = MarshalHeaders(context.Background(), &PropagationContext{TraceID: "abcdef", ParentID: "123456"}, FormatHoneycomb, FormatW3C)
+	assert.Equal(t, []string{"X-Honeycomb-Trace"}, keys(headers))
+
+	assert.Empty(t, MarshalHeaders(context.Background(), nil, FormatHoneycomb))
+	assert.Empty(t, MarshalHeaders(context.Background(), prop))
+
+	f, err := ParseFormat("w3c")
+	assert.NoError(t, err)
+	assert.Equal(t, FormatW3C, f)
+	_, err = ParseFormat("b3")
+	assert.Error(t, err)
+}
+
+func TestTrustPolicy(t *testing.T) {
+	prop := &PropagationContext{
+		TraceID:      "abcdef",
+		ParentID:     "123456",
+		Dataset:      "other",
+		TraceContext: map[string]interface{}{"admin": true},
+	}
+	_, internal, _ := net.ParseCIDR("10.0.0.0/8")
+	gateway := func(name string) string {
+		if name == "X-Gateway-Secret" {
+			return "s3cret"
+		}
+		return ""
+	}
+	inside := &Source{RemoteAddr: "10.1.2.3:5000"}
+	outside := &Source{RemoteAddr: "203.0.113.9:5000"}
+	viaGateway := &Source{RemoteAddr: "203.0.113.9:5000", Header: gateway}
+	traceIDOnly := &PropagationContext{TraceID: "abcdef"}
+
+	testCases := []struct {
+		name   string
+		policy TrustPolicy
+		src    *Source
+		want   *PropagationContext
+	}{
+		{"always", TrustPolicy{}, outside, prop},
+		{"never", TrustPolicy{Mode: TrustNever}, inside, nil},
+		{"trace ID only", TrustPolicy{Mode: TrustTraceIDOnly}, inside, traceIDOnly},
+		{"trusted network", TrustPolicy{Mode: TrustSources, Networks: []*net.IPNet{internal}}, inside, prop},
+		{"untrusted network", TrustPolicy{Mode: TrustSources, Networks: []*net.IPNet{internal}}, outside, nil},
+		{"unknown source", TrustPolicy{Mode: TrustSources, Networks: []*net.IPNet{internal}}, nil, nil},
+		{"trusted header", TrustPolicy{Mode: TrustSources, Header: "X-Gateway-Secret", HeaderValue: "s3cret"}, viaGateway, prop},
+		{"wrong header", TrustPolicy{Mode: TrustSources, Header: "X-Gateway-Secret", HeaderValue: "other"}, viaGateway, nil},
+		{"untrusted trace ID only", TrustPolicy{Mode: TrustSources, UntrustedTraceIDOnly: true}, outside, traceIDOnly},
+	}
+	for _, tt := range testCases {
+		assert.Equal(t, tt.want, tt.policy.Apply(prop, tt.src), tt.name)
+	}
+	assert.Nil(t, (&TrustPolicy{}).Apply(nil, inside))
+}
+
+func keys(m map[string]string) []string {
+	var ks []string
+	for k := range m {
+		ks = append(ks, k)
+	}
+	return ks
+}
+
+func BenchmarkUnmarshalHoneycombTraceContext(b *testing.B) {
+	header := "1;trace_id=0af7651916cd43dd8448eb211c80319c,parent_id=b7ad6b7169203331,dataset=my-dataset"
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		_, _ = UnmarshalHoneycombTraceContext(header)
+	}
+}
+
+func BenchmarkUnmarshalAmazonTraceContext(b *testing.B) {
+	header := "Root=1-67891233-abcdef012345678912345678;Self=1-67891233-abcdef0876543219876543210"
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		_, _ = UnmarshalAmazonTraceContext(header)
+	}
+}
+
+func BenchmarkUnmarshalW3CTraceContext(b *testing.B) {
+	headers := map[string]string{"traceparent": "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"}
+	ctx := context.Background()
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		_, _, _ = UnmarshalW3CTraceContext(ctx, headers)
+	}
+}
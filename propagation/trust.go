@@ -0,0 +1,109 @@
+package propagation
+
+import (
+	"crypto/subtle"
+	"net"
+)
+
+// TrustMode is how a TrustPolicy treats incoming trace context.
+type TrustMode int
+
+const (
+	// TrustAlways honors all incoming trace context. It is the default.
+	TrustAlways TrustMode = iota
+	// TrustNever ignores incoming trace context, so every request starts a
+	// new trace.
+	TrustNever
+	// TrustSources honors trace context from the sources a TrustPolicy
+	// trusts, and ignores it from others.
+	TrustSources
+	// TrustTraceIDOnly keeps the incoming trace ID and hop count, so the
+	// trace can still be found across services, but starts a new root span,
+	// ignoring the incoming parent ID, dataset, and trace fields.
+	TrustTraceIDOnly
+)
+
+// TrustPolicy decides when incoming trace context is honored, to protect
+// against clients that send forged trace context, eg to pick trace IDs that
+// are always sampled, to send spans to another dataset, or to add trace
+// fields.
+type TrustPolicy struct {
+	Mode TrustMode
+	// Networks are the networks of the peers whose trace context is trusted
+	// in TrustSources mode, eg your load balancers and other services.
+	Networks []*net.IPNet
+	// Header and HeaderValue, if set, trust trace context sent with a
+	// request whose header Header is HeaderValue, eg a secret added by an
+	// API gateway, in TrustSources mode.
+	Header      string
+	HeaderValue string
+	// UntrustedTraceIDOnly, in TrustSources mode, treats trace context from
+	// untrusted sources as in TrustTraceIDOnly mode instead of ignoring it.
+	UntrustedTraceIDOnly bool
+}
+
+// Source describes where incoming trace context came from.
+type Source struct {
+	// RemoteAddr is the address of the peer, as an IP or host:port.
+	RemoteAddr string
+	// Header returns the value of a request header, or "" if it has none.
+	Header func(name string) string
+}
+
+// Trusts reports whether trace context from src is trusted in TrustSources
+// mode. Nothing is trusted from a nil src.
+func (p *TrustPolicy) Trusts(src *Source) bool {
+	if src == nil {
+		return false
+	}
+	if p.Header != "" && p.HeaderValue != "" && src.Header != nil {
+		got := src.Header(p.Header)
+		if subtle.ConstantTimeCompare([]byte(got), []byte(p.HeaderValue)) == 1 {
+			return true
+		}
+	}
+	if len(p.Networks) == 0 {
+		return false
+	}
+	host := src.RemoteAddr
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, n := range p.Networks {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply returns the parts of prop, which came from src, that the policy
+// honors: prop itself, a copy holding only its trace ID, or nil. src may be
+// nil if the source isn't known.
+func (p *TrustPolicy) Apply(prop *PropagationContext, src *Source) *PropagationContext {
+	if prop == nil {
+		return nil
+	}
+	mode := p.Mode
+	if mode == TrustSources {
+		switch {
+		case p.Trusts(src):
+			mode = TrustAlways
+		case p.UntrustedTraceIDOnly:
+			mode = TrustTraceIDOnly
+		default:
+			mode = TrustNever
+		}
+	}
+	switch mode {
+	case TrustNever:
+		return nil
+	case TrustTraceIDOnly:
+		return &PropagationContext{TraceID: prop.TraceID, Hops: prop.Hops}
+	}
+	return prop
+}
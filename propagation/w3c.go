@@ -43,21 +43,25 @@ func MarshalW3CTraceContext(ctx context.Context, prop *PropagationContext) (cont
 // which is an interface that defines Get and Set methods, http.Header is an implementation.
 //
 // Context is passed into this function and returned so that we can maintain the value of the
-// tracestate header. This is required in order to use the Propagator interface exported by the
-// OpenTelemetry Go SDK and avoid writing our own W3C Trace Context parser and serializer.
+// tracestate header, which MarshalW3CTraceContext passes along. The traceparent header is
+// parsed in place, without the allocations of the OpenTelemetry propagator, since this runs on
+// every incoming request.
 //
 // If the headers contain neither a trace id or parent id, an error will be returned.
 func UnmarshalW3CTraceContext(ctx context.Context, headers map[string]string) (context.Context, *PropagationContext, error) {
-	supp := supplier{
-		values: headers,
+	if state := headers[tracestateHeader]; state != "" {
+		// let the OpenTelemetry propagator keep the tracestate in ctx so it
+		// is passed along by MarshalW3CTraceContext. It's only given the
+		// tracestate, so it doesn't parse the traceparent header itself.
+		ctx = trace.DefaultHTTPPropagator().Extract(ctx, tracestateSupplier(state))
 	}
-	propagator := trace.DefaultHTTPPropagator()
-	ctx = propagator.Extract(ctx, supp)
-	spanContext := trace.RemoteSpanContextFromContext(ctx)
-	prop := &PropagationContext{
-		TraceID:    spanContext.TraceID.String(),
-		ParentID:   spanContext.SpanID.String(),
-		TraceFlags: spanContext.TraceFlags,
+	prop := &PropagationContext{}
+	spanContext, ok := parseTraceparent(headers[traceparentHeader])
+	if ok {
+		prop.TraceID = headers[traceparentHeader][3:35]
+		prop.ParentID = headers[traceparentHeader][36:52]
+		prop.TraceFlags = spanContext.TraceFlags
+		ctx = trace.ContextWithRemoteSpanContext(ctx, spanContext)
 	}
 	if !prop.IsValid() {
 		return ctx, nil, &PropagationError{
@@ -68,6 +72,85 @@ func UnmarshalW3CTraceContext(ctx context.Context, headers map[string]string) (c
 	return ctx, prop, nil
 }
 
+const (
+	traceparentHeader = "traceparent"
+	tracestateHeader  = "tracestate"
+	// maxTraceparentVersion is the highest valid traceparent version; ff is
+	// reserved as invalid.
+	maxTraceparentVersion = 254
+)
+
+// parseTraceparent parses a traceparent header of the form
+// version-traceid-spanid-flags, accepting the same headers as the
+// OpenTelemetry propagator but scanning the header in place instead of
+// matching it with a regular expression.
+func parseTraceparent(h string) (trace.SpanContext, bool) {
+	var sc trace.SpanContext
+	// later versions may append fields after another dash
+	if len(h) < 55 || h[2] != '-' || h[35] != '-' || h[52] != '-' || (len(h) > 55 && h[55] != '-') {
+		return sc, false
+	}
+	version, ok := decodeHexByte(h[0:2])
+	if !ok || version > maxTraceparentVersion {
+		return sc, false
+	}
+	if !decodeLowerHex(sc.TraceID[:], h[3:35]) || !decodeLowerHex(sc.SpanID[:], h[36:52]) {
+		return sc, false
+	}
+	flags, ok := decodeHexByte(h[53:55])
+	if !ok || (version == 0 && flags > 2) {
+		return sc, false
+	}
+	// clear all flags other than the sampling bit
+	sc.TraceFlags = flags & trace.FlagsSampled
+	return sc, sc.IsValid()
+}
+
+// decodeHexByte decodes a two character lowercase hex string.
+func decodeHexByte(s string) (byte, bool) {
+	var b [1]byte
+	ok := decodeLowerHex(b[:], s)
+	return b[0], ok
+}
+
+// decodeLowerHex decodes the lowercase hex string s into dst, which must be
+// half its length. traceparent headers may only use lowercase hex.
+func decodeLowerHex(dst []byte, s string) bool {
+	for i := range dst {
+		hi, ok1 := lowerHexValue(s[2*i])
+		lo, ok2 := lowerHexValue(s[2*i+1])
+		if !ok1 || !ok2 {
+			return false
+		}
+		dst[i] = hi<<4 | lo
+	}
+	return true
+}
+
+func lowerHexValue(c byte) (byte, bool) {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0', true
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10, true
+	}
+	return 0, false
+}
+
+// tracestateSupplier is a supplier that holds only a tracestate header.
+type tracestateSupplier string
+
+// Get returns the tracestate header if key asks for it.
+func (s tracestateSupplier) Get(key string) string {
+	if key == tracestateHeader {
+		return string(s)
+	}
+	return ""
+}
+
+// Set does nothing. It exists to satisfy the propagation.HTTPSupplier interface.
+func (s tracestateSupplier) Set(key string, value string) {}
+
 // createOpenTelemetrySpan creates a shell trace.Span with information from the provided
 // PropagationContext. It's a shell because the only field populated is the span context.
 func createOpenTelemetrySpan(prop *PropagationContext) (trace.Span, error) {
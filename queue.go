@@ -0,0 +1,70 @@
+package beeline
+
+import (
+	"context"
+	"time"
+
+	"github.com/honeycombio/beeline-go/trace"
+)
+
+// Envelope carries a value through a channel or work queue along with the
+// span it was enqueued in and when, so the goroutine that takes it off the
+// queue can continue the trace and record how long the value waited. Send
+// Envelopes, made by EnqueueWithTrace, instead of the values themselves.
+type Envelope struct {
+	Value interface{}
+
+	span     *trace.Span
+	enqueued time.Time
+}
+
+// EnqueueWithTrace wraps value, about to be queued by code running in ctx,
+// in an Envelope:
+//
+//	jobs <- beeline.EnqueueWithTrace(ctx, job)
+//
+// and in the worker:
+//
+//	for e := range jobs {
+//		ctx, span := beeline.DequeueWithTrace(context.Background(), e, "process job")
+//		process(ctx, e.Value.(Job))
+//		span.Send()
+//	}
+func EnqueueWithTrace(ctx context.Context, value interface{}) Envelope {
+	return defaultBeeline.EnqueueWithTrace(ctx, value)
+}
+
+// EnqueueWithTrace wraps value in an Envelope. See the package-level
+// EnqueueWithTrace for details.
+func (b *Beeline) EnqueueWithTrace(ctx context.Context, value interface{}) Envelope {
+	return Envelope{Value: value, span: b.spanFromContext(ctx), enqueued: time.Now()}
+}
+
+// Wait returns how long e has been queued.
+func (e Envelope) Wait() time.Duration {
+	return time.Since(e.enqueued)
+}
+
+// DequeueWithTrace starts a span named name for processing the value in e,
+// recording how long it waited in the queue in queue.wait_ms. The span is an
+// async child of the span the value was enqueued in, since the producer
+// usually moves on without waiting for it, or the root of a new trace if
+// there was none. It is returned in a context derived from ctx.
+func DequeueWithTrace(ctx context.Context, e Envelope, name string) (context.Context, *trace.Span) {
+	return defaultBeeline.DequeueWithTrace(ctx, e, name)
+}
+
+// DequeueWithTrace starts a span for processing the value in e. See the
+// package-level DequeueWithTrace for details.
+func (b *Beeline) DequeueWithTrace(ctx context.Context, e Envelope, name string) (context.Context, *trace.Span) {
+	wait := e.Wait()
+	var span *trace.Span
+	if e.span != nil {
+		ctx, span = e.span.CreateAsyncChild(ctx)
+		span.AddField("name", name)
+	} else {
+		ctx, span = b.StartTrace(ctx, name)
+	}
+	span.AddField("queue.wait_ms", float64(wait)/float64(time.Millisecond))
+	return ctx, span
+}
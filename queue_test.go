@@ -0,0 +1,45 @@
+package beeline
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/honeycombio/libhoney-go/transmission"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueueWait(t *testing.T) {
+	mo := &transmission.MockSender{}
+	bl := New(Config{Transmission: mo})
+	defer bl.Close()
+
+	jobs := make(chan Envelope, 2)
+	ctx, producer := bl.StartTrace(context.Background(), "handler")
+	jobs <- bl.EnqueueWithTrace(ctx, "rose")
+	producer.Send()
+	jobs <- bl.EnqueueWithTrace(context.Background(), "mint")
+	close(jobs)
+
+	time.Sleep(10 * time.Millisecond)
+	var values []interface{}
+	for e := range jobs {
+		_, span := bl.DequeueWithTrace(context.Background(), e, "process job")
+		values = append(values, e.Value)
+		span.Send()
+	}
+	assert.Equal(t, []interface{}{"rose", "mint"}, values)
+
+	events := mo.Events()
+	if assert.Len(t, events, 3) {
+		consumer := events[1].Data
+		assert.Equal(t, "process job", consumer["name"])
+		assert.Equal(t, producer.GetSpanID(), consumer["trace.parent_id"])
+		assert.True(t, consumer["queue.wait_ms"].(float64) >= 10)
+		assert.Equal(t, true, consumer["meta.late"], "the producer was sent before the job was taken")
+
+		orphan := events[2].Data
+		assert.Nil(t, orphan["trace.parent_id"], "values queued outside a trace start their own")
+		assert.Contains(t, orphan, "queue.wait_ms")
+	}
+}
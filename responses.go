@@ -0,0 +1,55 @@
+package beeline
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/honeycombio/libhoney-go/transmission"
+
+	"github.com/honeycombio/beeline-go/logger"
+)
+
+// SendResult is the outcome of sending one event, passed to
+// Config.ResponseHook. Events in the same batch share the batch's Duration,
+// and each carries its own StatusCode from Honeycomb.
+type SendResult struct {
+	transmission.Response
+}
+
+// OK reports whether Honeycomb accepted the event.
+func (r SendResult) OK() bool {
+	return r.Err == nil && r.StatusCode >= 200 && r.StatusCode < 300
+}
+
+// RateLimited reports whether Honeycomb rejected the event because the team
+// or dataset is sending too fast.
+func (r SendResult) RateLimited() bool {
+	return r.StatusCode == http.StatusTooManyRequests
+}
+
+// handleResponses reads the client's responses until the channel is closed,
+// passing each to hook if it's set, and logging it to debug if that's set.
+func handleResponses(responses chan transmission.Response, hook func(SendResult), debug logger.Logger) {
+	for r := range responses {
+		if hook != nil {
+			hook(SendResult{r})
+		}
+		if debug != nil {
+			logResponse(debug, SendResult{r})
+		}
+	}
+}
+
+// logResponse reports the result of a send for debugging
+func logResponse(l logger.Logger, r SendResult) {
+	keyvals := []interface{}{"status", r.StatusCode, "duration", r.Duration}
+	if r.Metadata != nil {
+		keyvals = append(keyvals, "metadata", fmt.Sprintf("%s", r.Metadata))
+	}
+	if r.OK() {
+		l.Debug("sent event to Honeycomb", keyvals...)
+		return
+	}
+	keyvals = append(keyvals, "error", r.Err, "body", string(r.Body))
+	l.Warn("error sending event to Honeycomb", keyvals...)
+}
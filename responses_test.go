@@ -0,0 +1,68 @@
+package beeline
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/honeycombio/beeline-go/senders"
+	"github.com/honeycombio/libhoney-go/transmission"
+	"github.com/stretchr/testify/assert"
+)
+
+// statusSender responds to each event with the next of its status codes.
+type statusSender struct {
+	lock      sync.Mutex
+	codes     []int
+	responses chan transmission.Response
+}
+
+func (s *statusSender) Add(ev *transmission.Event) {
+	s.lock.Lock()
+	code := s.codes[0]
+	s.codes = s.codes[1:]
+	s.lock.Unlock()
+	s.responses <- transmission.Response{StatusCode: code, Metadata: ev.Metadata}
+}
+
+func (s *statusSender) Start() error                              { return nil }
+func (s *statusSender) Stop() error                               { return nil }
+func (s *statusSender) TxResponses() chan transmission.Response   { return s.responses }
+func (s *statusSender) SendResponse(r transmission.Response) bool { s.responses <- r; return false }
+
+func TestResponseHook(t *testing.T) {
+	tx := &statusSender{codes: []int{202, 429, 400}, responses: make(chan transmission.Response, 10)}
+	var lock sync.Mutex
+	var results []SendResult
+	bl := New(Config{
+		WriteKey:       "0123456789abcdef0123456789abcdef",
+		Transmission:   tx,
+		OverflowPolicy: senders.OverflowDropOldest,
+		ResponseHook: func(r SendResult) {
+			lock.Lock()
+			defer lock.Unlock()
+			results = append(results, r)
+		},
+	})
+	for i := 0; i < 3; i++ {
+		_, span := bl.StartSpan(context.Background(), "span")
+		span.Send()
+	}
+	assert.Eventually(t, func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(results) == 3
+	}, time.Second, time.Millisecond, "the hook should see every response")
+
+	lock.Lock()
+	defer lock.Unlock()
+	assert.True(t, results[0].OK())
+	assert.False(t, results[1].OK())
+	assert.True(t, results[1].RateLimited())
+	assert.False(t, results[2].OK())
+	assert.False(t, results[2].RateLimited())
+	stats := bl.Stats()
+	assert.Equal(t, uint64(2), stats.Failed)
+	assert.Equal(t, uint64(1), stats.RateLimited)
+}
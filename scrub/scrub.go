@@ -0,0 +1,192 @@
+// Package scrub removes sensitive data from events before they are sent.
+//
+// A Scrubber matches field names against deny-list patterns, and string
+// values (including strings inside slices, such as SQL query arguments)
+// against value patterns like Email and CreditCard. Matches are redacted or
+// replaced with a salted hash, which still lets equal values be grouped
+// together without revealing them. Set beeline.Config.Scrubber to apply one to
+// every span, including the fields added automatically by the wrappers: URLs,
+// queries, and headers.
+package scrub
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+)
+
+// Action says what happens to a sensitive field or value.
+type Action int
+
+const (
+	// Redact replaces the value with Scrubber.Replacement.
+	Redact Action = iota
+	// Hash replaces the value with a salted hash of it, like
+	// "sha256:1f2e3d4c5b6a7988".
+	Hash
+	// Drop removes the field entirely. It only applies to KeyAction; values
+	// matching a ValuePattern are redacted instead.
+	Drop
+)
+
+// DefaultReplacement is used by Redact when Scrubber.Replacement is empty.
+const DefaultReplacement = "[REDACTED]"
+
+var (
+	// Email matches email addresses.
+	Email = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	// CreditCard matches runs of 13 to 19 digits, optionally separated by
+	// spaces or dashes. Only runs that pass the Luhn check are scrubbed, so
+	// most other numbers are left alone.
+	CreditCard = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+	// SensitiveKeys matches field names that usually hold secrets.
+	SensitiveKeys = regexp.MustCompile(`(?i)(password|passwd|secret|token|api_?key|authorization|cookie|session)`)
+)
+
+// metaPrefix starts the names of the fields the beeline adds to describe
+// spans, like meta.session_elapsed_ms, which DenyKeys aren't matched against.
+const metaPrefix = "meta."
+
+// protectedKeys are never scrubbed, since changing them would break traces.
+var protectedKeys = map[string]bool{
+	"trace.trace_id":  true,
+	"trace.span_id":   true,
+	"trace.parent_id": true,
+}
+
+// Scrubber removes sensitive fields and values from events. Its settings
+// should not be changed once it is in use.
+type Scrubber struct {
+	// DenyKeys are matched against field names; the values of matching
+	// fields are handled according to KeyAction. Names starting with "meta."
+	// belong to the beeline and aren't matched.
+	DenyKeys  []*regexp.Regexp
+	KeyAction Action
+	// ValuePatterns are matched against string values; the matching parts
+	// are handled according to ValueAction.
+	ValuePatterns []*regexp.Regexp
+	ValueAction   Action
+	// Replacement is the text used by Redact. default: DefaultReplacement
+	Replacement string
+	// HashSalt is prepended to values before they are hashed, so hashes
+	// can't be reversed by hashing guesses without knowing it.
+	HashSalt string
+}
+
+// Default returns a Scrubber that redacts fields named like secrets and
+// email addresses and credit card numbers found in any value.
+func Default() *Scrubber {
+	return &Scrubber{
+		DenyKeys:      []*regexp.Regexp{SensitiveKeys},
+		ValuePatterns: []*regexp.Regexp{Email, CreditCard},
+	}
+}
+
+// Scrub modifies fields in place.
+func (s *Scrubber) Scrub(fields map[string]interface{}) {
+	for k, v := range fields {
+		if protectedKeys[k] {
+			continue
+		}
+		if !strings.HasPrefix(k, metaPrefix) && s.denied(k) {
+			if s.KeyAction == Drop {
+				delete(fields, k)
+			} else {
+				fields[k] = s.replace(s.KeyAction, v)
+			}
+			continue
+		}
+		if len(s.ValuePatterns) > 0 {
+			fields[k] = s.scrubValue(v)
+		}
+	}
+}
+
+func (s *Scrubber) denied(key string) bool {
+	for _, re := range s.DenyKeys {
+		if re.MatchString(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// scrubValue applies the value patterns to strings in v.
+func (s *Scrubber) scrubValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		return s.scrubString(v)
+	case []string:
+		scrubbed := make([]string, len(v))
+		for i, str := range v {
+			scrubbed[i] = s.scrubString(str)
+		}
+		return scrubbed
+	case []interface{}:
+		scrubbed := make([]interface{}, len(v))
+		for i, elem := range v {
+			scrubbed[i] = s.scrubValue(elem)
+		}
+		return scrubbed
+	}
+	return v
+}
+
+func (s *Scrubber) scrubString(str string) string {
+	action := s.ValueAction
+	if action == Drop {
+		action = Redact
+	}
+	for _, re := range s.ValuePatterns {
+		str = re.ReplaceAllStringFunc(str, func(match string) string {
+			if re == CreditCard && !luhn(match) {
+				return match
+			}
+			return s.replace(action, match).(string)
+		})
+	}
+	return str
+}
+
+// replace returns what v becomes under action.
+func (s *Scrubber) replace(action Action, v interface{}) interface{} {
+	if action == Hash {
+		str, ok := v.(string)
+		if !ok {
+			return s.replacement()
+		}
+		sum := sha256.Sum256([]byte(s.HashSalt + str))
+		return "sha256:" + hex.EncodeToString(sum[:8])
+	}
+	return s.replacement()
+}
+
+func (s *Scrubber) replacement() string {
+	if s.Replacement != "" {
+		return s.Replacement
+	}
+	return DefaultReplacement
+}
+
+// luhn reports whether the digits in number pass the Luhn checksum used by
+// payment card numbers.
+func luhn(number string) bool {
+	var sum, n int
+	for i := len(number) - 1; i >= 0; i-- {
+		c := number[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return sum%10 == 0
+}
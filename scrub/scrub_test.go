@@ -0,0 +1,54 @@
+package scrub
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefault(t *testing.T) {
+	fields := map[string]interface{}{
+		"request.url":                  "/users?email=jo@example.com&page=2",
+		"request.header.authorization": "Bearer abc123",
+		"app.card":                     "pay with 4111 1111 1111 1111 today",
+		"app.order_id":                 "1234567890123456",
+		"db.query_args":                []interface{}{"jo@example.com", 42},
+		"trace.trace_id":               "4111111111111111",
+		"duration_ms":                  1.5,
+		"meta.session_elapsed_ms":      12.5,
+		"app.session_id":               "s3cr3t",
+	}
+	Default().Scrub(fields)
+	assert.Equal(t, "/users?email=[REDACTED]&page=2", fields["request.url"])
+	assert.Equal(t, "[REDACTED]", fields["request.header.authorization"])
+	assert.Equal(t, "pay with [REDACTED] today", fields["app.card"])
+	assert.Equal(t, "1234567890123456", fields["app.order_id"], "numbers failing the Luhn check should be kept")
+	assert.Equal(t, []interface{}{"[REDACTED]", 42}, fields["db.query_args"])
+	assert.Equal(t, "4111111111111111", fields["trace.trace_id"], "trace IDs should never be scrubbed")
+	assert.Equal(t, 1.5, fields["duration_ms"])
+	assert.Equal(t, 12.5, fields["meta.session_elapsed_ms"], "the beeline's meta fields should not match DenyKeys")
+	assert.Equal(t, "[REDACTED]", fields["app.session_id"])
+}
+
+func TestHashAndDrop(t *testing.T) {
+	s := &Scrubber{
+		DenyKeys:      []*regexp.Regexp{regexp.MustCompile(`^app\.password$`)},
+		KeyAction:     Drop,
+		ValuePatterns: []*regexp.Regexp{Email},
+		ValueAction:   Hash,
+		HashSalt:      "pepper",
+	}
+	fields := map[string]interface{}{
+		"app.password": "hunter2",
+		"app.user":     "jo@example.com",
+		"app.other":    "jo@example.com",
+	}
+	s.Scrub(fields)
+	assert.NotContains(t, fields, "app.password")
+	hashed := fields["app.user"].(string)
+	assert.True(t, strings.HasPrefix(hashed, "sha256:"))
+	assert.Equal(t, hashed, fields["app.other"], "equal values should hash the same")
+	assert.NotContains(t, hashed, "jo@example.com")
+}
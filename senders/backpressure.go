@@ -0,0 +1,584 @@
+package senders
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	libhoney "github.com/honeycombio/libhoney-go"
+	"github.com/honeycombio/libhoney-go/transmission"
+
+	"github.com/honeycombio/beeline-go/sample"
+)
+
+// OverflowPolicy chooses what a BackpressureSender does with events when its
+// queue is full, either because events are being created faster than they can
+// be sent or because the circuit breaker has paused sending.
+type OverflowPolicy int
+
+const (
+	// OverflowDropNew drops each new event that doesn't fit in the queue.
+	// This is the default, and how libhoney has always behaved.
+	OverflowDropNew OverflowPolicy = iota
+	// OverflowDropOldest drops the oldest queued event to make room for the
+	// new one, so the freshest data is sent once sending catches up.
+	OverflowDropOldest
+	// OverflowBlock makes the code sending the event wait up to BlockTimeout
+	// for room in the queue, then drops the event. This slows the
+	// application down instead of losing data.
+	OverflowBlock
+	// OverflowDegradeSampleRate drops the new event and doubles a sample
+	// rate multiplier, up to MaxSampleRateMultiplier. Whole traces are then
+	// sampled at the higher rate, with sample rates adjusted so Honeycomb
+	// still reports accurate counts, until the queue drains and the
+	// multiplier is halved again. Meanwhile critical events are all kept and
+	// verbose ones dropped.
+	OverflowDegradeSampleRate
+)
+
+// overflowPolicyNames are the names of the policies used in config files.
+var overflowPolicyNames = map[OverflowPolicy]string{
+	OverflowDropNew:           "drop_new",
+	OverflowDropOldest:        "drop_oldest",
+	OverflowBlock:             "block",
+	OverflowDegradeSampleRate: "degrade_sample_rate",
+}
+
+// String returns the name of the policy, as accepted by ParseOverflowPolicy.
+func (p OverflowPolicy) String() string {
+	if name, ok := overflowPolicyNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("OverflowPolicy(%d)", int(p))
+}
+
+// ParseOverflowPolicy returns the policy with the given name: drop_new,
+// drop_oldest, block, or degrade_sample_rate.
+func ParseOverflowPolicy(name string) (OverflowPolicy, error) {
+	for p, n := range overflowPolicyNames {
+		if n == name {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown overflow policy %q", name)
+}
+
+// When the queue is full, events are dropped in order of priority: verbose
+// spans first, then normal events, keeping critical ones as long as there is
+// anything else to drop. Root spans and events with an error recorded on them
+// are critical; other spans have the priority the beeline sends in their
+// meta.priority field, if they were given one.
+const (
+	priorityVerbose = iota
+	priorityNormal
+	priorityCritical
+	numPriorities
+)
+
+const fieldPriority = "meta.priority"
+
+// eventPriority returns the priority of ev.
+func eventPriority(ev *transmission.Event) int {
+	switch ev.Data[fieldPriority] {
+	case "critical":
+		return priorityCritical
+	case "verbose":
+		return eventErrorPriority(ev, priorityVerbose)
+	}
+	if _, ok := ev.Data[fieldTraceID]; ok {
+		if _, ok := ev.Data[fieldParentID]; !ok {
+			return priorityCritical
+		}
+	}
+	return eventErrorPriority(ev, priorityNormal)
+}
+
+// eventErrorPriority returns priorityCritical if an error is recorded on ev
+// and otherwise priority.
+func eventErrorPriority(ev *transmission.Event, priority int) int {
+	for k, v := range ev.Data {
+		if (k == fieldError || strings.HasSuffix(k, "."+fieldError)) && v != nil && v != false && v != "" {
+			return priorityCritical
+		}
+	}
+	return priority
+}
+
+// Errors returned in responses for events dropped by a BackpressureSender.
+var (
+	errQueueFull    = errors.New("event dropped; send queue is full")
+	errDegradeDrops = errors.New("event dropped; sampled out while degraded")
+)
+
+const (
+	defaultBlockTimeout            = 100 * time.Millisecond
+	defaultBreakerFailureThreshold = 5
+	defaultBreakerCooldown         = 10 * time.Second
+	defaultMaxSampleRateMultiplier = 64
+	// degradeRecoveryInterval is the least time between halvings of the
+	// sample rate multiplier
+	degradeRecoveryInterval = time.Second
+	// degradeSalt is added to trace IDs when sampling for backpressure so the
+	// decision is independent of the beeline's own deterministic sampler
+	degradeSalt = ":backpressure"
+)
+
+// BackpressureConfig configures a BackpressureSender.
+type BackpressureConfig struct {
+	// Policy chooses what to do when the queue is full. default:
+	// OverflowDropNew
+	Policy OverflowPolicy
+	// QueueSize is the number of events that may wait to be sent.
+	// default: libhoney.DefaultPendingWorkCapacity
+	QueueSize uint
+	// BlockTimeout is the longest time OverflowBlock waits for room in the
+	// queue. default: 100ms
+	BlockTimeout time.Duration
+	// FailureThreshold is the number of consecutive failed sends (errors,
+	// 429s, and 5xx responses) that open the circuit breaker. While it is
+	// open, queued events are held rather than sent. Set it to -1 to disable
+	// the circuit breaker. default: 5
+	FailureThreshold int
+	// Cooldown is how long the circuit breaker stays open before sending is
+	// retried. If the next send fails it opens again. default: 10s
+	Cooldown time.Duration
+	// MaxSampleRateMultiplier limits how far OverflowDegradeSampleRate raises
+	// the sample rate. default: 64
+	MaxSampleRateMultiplier uint
+}
+
+// Stats describes the state of a BackpressureSender and counts what has
+// happened to the events given to it.
+type Stats struct {
+	// QueueDepth is the number of events waiting to be sent and
+	// QueueCapacity the most that may wait.
+	QueueDepth    int
+	QueueCapacity int
+	// Sent counts events that were sent successfully and Failed those that
+	// the wrapped sender couldn't send.
+	Sent   uint64
+	Failed uint64
+	// RateLimited counts the failed events that Honeycomb rejected with a
+	// 429 response.
+	RateLimited uint64
+	// DroppedQueueFull counts events dropped because the queue was full,
+	// including those pushed out by OverflowDropOldest.
+	DroppedQueueFull uint64
+	// DroppedSampled counts events dropped by the raised sample rate of
+	// OverflowDegradeSampleRate.
+	DroppedSampled uint64
+	// CircuitOpen is true while the circuit breaker is holding events.
+	CircuitOpen bool
+	// SampleRateMultiplier is the current multiplier applied by
+	// OverflowDegradeSampleRate; 1 when not degraded.
+	SampleRateMultiplier uint
+	// LastError describes the most recent failed send, and LastErrorTime
+	// says when it happened. They are empty if no send has failed.
+	LastError     string
+	LastErrorTime time.Time
+}
+
+// BackpressureSender wraps another sender with a bounded queue, a policy for
+// when that queue is full, and a circuit breaker that stops sending to an API
+// that keeps failing. Its Stats method reports the queue depth and how many
+// events were dropped and why.
+//
+// The wrapped sender should block rather than drop events when it is busy (for
+// libhoney's transmission.Honeycomb, set BlockOnSend) so the queue here fills
+// up and the policy takes effect.
+type BackpressureSender struct {
+	inner  transmission.Sender
+	config BackpressureConfig
+
+	// lock guards everything below
+	lock  sync.Mutex
+	queue []*transmission.Event
+	// queued counts the queued events of each priority
+	queued  [numPriorities]int
+	running bool
+	// pumping is true while the pump goroutine is running
+	pumping bool
+	// notify wakes the pump when events are queued or the sender stops
+	notify chan struct{}
+	// space is closed and replaced whenever room is made in the queue
+	space chan struct{}
+	// drained is closed by the pump when it exits
+	drained chan struct{}
+
+	innerResponses chan transmission.Response
+	failures       int
+	openUntil      time.Time
+	multiplier     uint
+	samplers       map[uint]*sample.DeterministicSampler
+	lastDegrade    time.Time
+
+	sent, failed, rateLimited, droppedFull, droppedSampled uint64
+	// lastError and lastErrorTime describe the most recent failed send
+	lastError     string
+	lastErrorTime time.Time
+
+	responses chan transmission.Response
+}
+
+// backpressureMetadata replaces the Metadata of events passed to the wrapped
+// sender so their responses can be counted.
+type backpressureMetadata struct {
+	metadata interface{}
+	priority int
+}
+
+// NewBackpressureSender returns a sender that queues events for inner
+// according to config.
+func NewBackpressureSender(inner transmission.Sender, config BackpressureConfig) *BackpressureSender {
+	if config.QueueSize == 0 {
+		config.QueueSize = libhoney.DefaultPendingWorkCapacity
+	}
+	if config.BlockTimeout == 0 {
+		config.BlockTimeout = defaultBlockTimeout
+	}
+	if config.FailureThreshold == 0 {
+		config.FailureThreshold = defaultBreakerFailureThreshold
+	}
+	if config.Cooldown == 0 {
+		config.Cooldown = defaultBreakerCooldown
+	}
+	if config.MaxSampleRateMultiplier == 0 {
+		config.MaxSampleRateMultiplier = defaultMaxSampleRateMultiplier
+	}
+	return &BackpressureSender{
+		inner:      inner,
+		config:     config,
+		notify:     make(chan struct{}, 1),
+		space:      make(chan struct{}),
+		multiplier: 1,
+		samplers:   make(map[uint]*sample.DeterministicSampler),
+		responses:  make(chan transmission.Response, defaultResponseQueueSize),
+	}
+}
+
+// Add queues ev to be sent, applying the overflow policy if the queue is full.
+func (s *BackpressureSender) Add(ev *transmission.Event) {
+	wrapped := *ev
+	priority := eventPriority(ev)
+	wrapped.Metadata = &backpressureMetadata{metadata: ev.Metadata, priority: priority}
+
+	s.lock.Lock()
+	if s.config.Policy == OverflowDegradeSampleRate && !s.keep(&wrapped, priority) {
+		s.droppedSampled++
+		s.lock.Unlock()
+		s.SendResponse(transmission.Response{Err: errDegradeDrops, Metadata: ev.Metadata})
+		return
+	}
+	for len(s.queue) >= int(s.config.QueueSize) {
+		switch s.config.Policy {
+		case OverflowBlock:
+			space := s.space
+			s.lock.Unlock()
+			timer := time.NewTimer(s.config.BlockTimeout)
+			select {
+			case <-space:
+				timer.Stop()
+				s.lock.Lock()
+				continue
+			case <-timer.C:
+			}
+			s.lock.Lock()
+			if len(s.queue) < int(s.config.QueueSize) {
+				continue
+			}
+		case OverflowDegradeSampleRate:
+			s.degrade()
+		}
+		s.droppedFull++
+		i := s.victimLocked(priority, s.config.Policy == OverflowDropOldest)
+		if i < 0 {
+			s.lock.Unlock()
+			s.SendResponse(transmission.Response{Err: errQueueFull, Metadata: ev.Metadata})
+			return
+		}
+		dropped := s.removeLocked(i)
+		s.appendLocked(&wrapped)
+		s.lock.Unlock()
+		s.SendResponse(transmission.Response{
+			Err:      errQueueFull,
+			Metadata: dropped.Metadata.(*backpressureMetadata).metadata,
+		})
+		return
+	}
+	s.appendLocked(&wrapped)
+	s.lock.Unlock()
+}
+
+// victimLocked returns the index of the queued event to drop to make room for
+// a new event of priority, or -1 to drop the new event instead. The victim is
+// the newest of the lowest priority queued events, or the oldest if oldest is
+// set; the new event is dropped if it has the lowest priority, unless oldest
+// is set and queued events share it. The caller must hold s.lock.
+func (s *BackpressureSender) victimLocked(priority int, oldest bool) int {
+	lowest := priorityVerbose
+	for lowest <= priority && s.queued[lowest] == 0 {
+		lowest++
+	}
+	if lowest > priority || lowest == priority && !oldest {
+		return -1
+	}
+	if oldest {
+		for i, ev := range s.queue {
+			if ev.Metadata.(*backpressureMetadata).priority == lowest {
+				return i
+			}
+		}
+	} else {
+		for i := len(s.queue) - 1; i >= 0; i-- {
+			if s.queue[i].Metadata.(*backpressureMetadata).priority == lowest {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// appendLocked queues ev and wakes the pump. The caller must hold s.lock.
+func (s *BackpressureSender) appendLocked(ev *transmission.Event) {
+	s.queue = append(s.queue, ev)
+	s.queued[ev.Metadata.(*backpressureMetadata).priority]++
+	s.wake()
+}
+
+// removeLocked removes and returns the event at index i of the queue. The
+// caller must hold s.lock.
+func (s *BackpressureSender) removeLocked(i int) *transmission.Event {
+	ev := s.queue[i]
+	if i == 0 {
+		s.queue[0] = nil
+		s.queue = s.queue[1:]
+	} else {
+		copy(s.queue[i:], s.queue[i+1:])
+		s.queue[len(s.queue)-1] = nil
+		s.queue = s.queue[:len(s.queue)-1]
+	}
+	s.queued[ev.Metadata.(*backpressureMetadata).priority]--
+	return ev
+}
+
+// keep applies the degraded sample rate to ev, adjusting its sample rate if it
+// is kept. Events in the same trace get the same decision, except that
+// critical events are always kept, at their own sample rate, and verbose ones
+// are dropped. The caller must hold s.lock.
+func (s *BackpressureSender) keep(ev *transmission.Event, priority int) bool {
+	if s.multiplier > 1 && len(s.queue) < int(s.config.QueueSize)/4 &&
+		time.Since(s.lastDegrade) > degradeRecoveryInterval {
+		// the queue has drained; start recovering
+		s.multiplier /= 2
+		s.lastDegrade = time.Now()
+	}
+	if s.multiplier <= 1 {
+		return true
+	}
+	switch priority {
+	case priorityCritical:
+		return true
+	case priorityVerbose:
+		return false
+	}
+	sampler, ok := s.samplers[s.multiplier]
+	if !ok {
+		sampler, _ = sample.NewDeterministicSampler(s.multiplier)
+		s.samplers[s.multiplier] = sampler
+	}
+	determinant, _ := ev.Data[fieldTraceID].(string)
+	if determinant == "" {
+		determinant, _ = ev.Data[fieldSpanID].(string)
+	}
+	if !sampler.Sample(determinant + degradeSalt) {
+		return false
+	}
+	rate := ev.SampleRate
+	if rate == 0 {
+		rate = 1
+	}
+	ev.SampleRate = rate * s.multiplier
+	return true
+}
+
+// degrade doubles the sample rate multiplier. The caller must hold s.lock.
+func (s *BackpressureSender) degrade() {
+	if s.multiplier*2 <= s.config.MaxSampleRateMultiplier {
+		s.multiplier *= 2
+	}
+	s.lastDegrade = time.Now()
+}
+
+// wake signals the pump without blocking. The caller must hold s.lock.
+func (s *BackpressureSender) wake() {
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Start starts the wrapped sender and begins passing queued events to it.
+func (s *BackpressureSender) Start() error {
+	if err := s.inner.Start(); err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	// some senders replace their responses channel each time they start
+	if ch := s.inner.TxResponses(); ch != s.innerResponses {
+		s.innerResponses = ch
+		go s.handleResponses(ch)
+	}
+	s.running = true
+	if !s.pumping {
+		s.pumping = true
+		s.drained = make(chan struct{})
+		go s.pump(s.drained)
+	}
+	return nil
+}
+
+// Stop passes every queued event to the wrapped sender, even if the circuit
+// breaker is open, and then stops it. The sender may be started again.
+func (s *BackpressureSender) Stop() error {
+	s.lock.Lock()
+	s.running = false
+	drained := s.drained
+	s.wake()
+	s.lock.Unlock()
+	if drained != nil {
+		<-drained
+	}
+	return s.inner.Stop()
+}
+
+// Close stops the sender. If the wrapped sender has a Close method, it is
+// called too.
+func (s *BackpressureSender) Close() error {
+	err := s.Stop()
+	if c, ok := s.inner.(interface{ Close() error }); ok {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// pump passes queued events to the wrapped sender, waiting while the circuit
+// breaker is open. Once the sender is stopped it sends what remains and exits.
+func (s *BackpressureSender) pump(drained chan struct{}) {
+	defer close(drained)
+	for {
+		s.lock.Lock()
+		if len(s.queue) == 0 {
+			if !s.running {
+				s.pumping = false
+				s.lock.Unlock()
+				return
+			}
+			s.lock.Unlock()
+			<-s.notify
+			continue
+		}
+		if wait := time.Until(s.openUntil); wait > 0 && s.running {
+			s.lock.Unlock()
+			select {
+			case <-time.After(wait):
+			case <-s.notify:
+			}
+			continue
+		}
+		ev := s.removeLocked(0)
+		close(s.space)
+		s.space = make(chan struct{})
+		s.lock.Unlock()
+		s.inner.Add(ev)
+	}
+}
+
+// handleResponses counts responses from the wrapped sender, updates the
+// circuit breaker, and passes the responses on.
+func (s *BackpressureSender) handleResponses(ch chan transmission.Response) {
+	for r := range ch {
+		if m, ok := r.Metadata.(*backpressureMetadata); ok {
+			r.Metadata = m.metadata
+		}
+		s.lock.Lock()
+		if msg := describeFailure(r); msg != "" {
+			s.lastError = msg
+			s.lastErrorTime = time.Now()
+		}
+		if retryable(r) {
+			s.failed++
+			if r.StatusCode == http.StatusTooManyRequests {
+				s.rateLimited++
+			}
+			s.failures++
+			if s.config.FailureThreshold > 0 && s.failures >= s.config.FailureThreshold {
+				s.openUntil = time.Now().Add(s.config.Cooldown)
+			}
+		} else {
+			if r.StatusCode >= 200 && r.StatusCode < 300 {
+				s.sent++
+			} else {
+				s.failed++
+			}
+			s.failures = 0
+			s.openUntil = time.Time{}
+		}
+		s.lock.Unlock()
+		s.SendResponse(r)
+	}
+}
+
+// Stats returns the current state of the sender.
+func (s *BackpressureSender) Stats() Stats {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return Stats{
+		QueueDepth:           len(s.queue),
+		QueueCapacity:        int(s.config.QueueSize),
+		Sent:                 s.sent,
+		Failed:               s.failed,
+		RateLimited:          s.rateLimited,
+		DroppedQueueFull:     s.droppedFull,
+		DroppedSampled:       s.droppedSampled,
+		CircuitOpen:          time.Now().Before(s.openUntil),
+		SampleRateMultiplier: s.multiplier,
+		LastError:            s.lastError,
+		LastErrorTime:        s.lastErrorTime,
+	}
+}
+
+// describeFailure returns a description of the error in r, or "" if r is
+// for an event that was sent successfully.
+func describeFailure(r transmission.Response) string {
+	if r.Err != nil {
+		return r.Err.Error()
+	}
+	if r.StatusCode >= 200 && r.StatusCode < 300 {
+		return ""
+	}
+	if body := strings.TrimSpace(string(r.Body)); body != "" {
+		return fmt.Sprintf("status %d: %s", r.StatusCode, body)
+	}
+	return fmt.Sprintf("status %d", r.StatusCode)
+}
+
+// TxResponses returns the channel of responses to added events.
+func (s *BackpressureSender) TxResponses() chan transmission.Response {
+	return s.responses
+}
+
+// SendResponse queues r without blocking and reports whether it was dropped.
+func (s *BackpressureSender) SendResponse(r transmission.Response) bool {
+	select {
+	case s.responses <- r:
+		return false
+	default:
+		return true
+	}
+}
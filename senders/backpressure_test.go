@@ -0,0 +1,227 @@
+package senders
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/honeycombio/libhoney-go/transmission"
+	"github.com/stretchr/testify/assert"
+)
+
+// gateSender blocks in Add until its gate is opened, like a sender whose own
+// queue is full.
+type gateSender struct {
+	gate      chan struct{}
+	lock      sync.Mutex
+	added     []*transmission.Event
+	responses chan transmission.Response
+}
+
+func newGateSender() *gateSender {
+	return &gateSender{gate: make(chan struct{}), responses: make(chan transmission.Response, 100)}
+}
+
+func (g *gateSender) Add(ev *transmission.Event) {
+	g.lock.Lock()
+	g.added = append(g.added, ev)
+	g.lock.Unlock()
+	<-g.gate
+	g.responses <- transmission.Response{StatusCode: 200, Metadata: ev.Metadata}
+}
+
+func (g *gateSender) addedCount() int {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	return len(g.added)
+}
+
+func (g *gateSender) addedNames() []string {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	var names []string
+	for _, ev := range g.added {
+		names = append(names, ev.Data["name"].(string))
+	}
+	return names
+}
+
+func (g *gateSender) Start() error                              { return nil }
+func (g *gateSender) Stop() error                               { return nil }
+func (g *gateSender) TxResponses() chan transmission.Response   { return g.responses }
+func (g *gateSender) SendResponse(r transmission.Response) bool { g.responses <- r; return false }
+
+// startBlocked returns a started sender whose pump is stuck sending the event
+// named "first".
+func startBlocked(t *testing.T, config BackpressureConfig) (*BackpressureSender, *gateSender) {
+	inner := newGateSender()
+	s := NewBackpressureSender(inner, config)
+	assert.NoError(t, s.Start())
+	s.Add(namedEvent("first"))
+	assert.Eventually(t, func() bool { return inner.addedCount() == 1 }, time.Second, time.Millisecond)
+	return s, inner
+}
+
+// nextError returns the next response with an error.
+func nextError(s *BackpressureSender) transmission.Response {
+	for r := range s.TxResponses() {
+		if r.Err != nil {
+			return r
+		}
+	}
+	return transmission.Response{}
+}
+
+func TestBackpressureDropNew(t *testing.T) {
+	s, inner := startBlocked(t, BackpressureConfig{QueueSize: 2})
+	for _, name := range []string{"a", "b", "c"} {
+		s.Add(namedEvent(name))
+	}
+	r := nextError(s)
+	assert.Equal(t, errQueueFull, r.Err)
+	assert.Equal(t, "c", r.Metadata, "the new event should be dropped")
+	stats := s.Stats()
+	assert.Equal(t, 2, stats.QueueDepth)
+	assert.Equal(t, 2, stats.QueueCapacity)
+	assert.Equal(t, uint64(1), stats.DroppedQueueFull)
+
+	close(inner.gate)
+	assert.NoError(t, s.Stop())
+	assert.Equal(t, []string{"first", "a", "b"}, inner.addedNames())
+	assert.Equal(t, 0, s.Stats().QueueDepth, "stopping should drain the queue")
+}
+
+func TestBackpressureDropOldest(t *testing.T) {
+	s, inner := startBlocked(t, BackpressureConfig{QueueSize: 2, Policy: OverflowDropOldest})
+	for _, name := range []string{"a", "b", "c"} {
+		s.Add(namedEvent(name))
+	}
+	r := nextError(s)
+	assert.Equal(t, "a", r.Metadata, "the oldest queued event should be dropped")
+	close(inner.gate)
+	assert.NoError(t, s.Stop())
+	assert.Equal(t, []string{"first", "b", "c"}, inner.addedNames())
+}
+
+// priorityEvent returns a span event named name with the given fields.
+func priorityEvent(name string, fields map[string]interface{}) *transmission.Event {
+	ev := namedEvent(name)
+	ev.Data["trace.trace_id"] = "trace"
+	ev.Data["trace.parent_id"] = "parent"
+	for k, v := range fields {
+		ev.Data[k] = v
+	}
+	return ev
+}
+
+func TestBackpressurePriority(t *testing.T) {
+	assert.Equal(t, priorityNormal, eventPriority(namedEvent("untraced")))
+	assert.Equal(t, priorityCritical, eventPriority(&transmission.Event{Data: map[string]interface{}{"trace.trace_id": "trace"}}), "root spans")
+	assert.Equal(t, priorityCritical, eventPriority(priorityEvent("", map[string]interface{}{"meta.priority": "verbose", "db.error": "timeout"})), "errors")
+	assert.Equal(t, priorityNormal, eventPriority(priorityEvent("", map[string]interface{}{"error": ""})), "empty errors")
+
+	for _, policy := range []OverflowPolicy{OverflowDropNew, OverflowDropOldest} {
+		s, inner := startBlocked(t, BackpressureConfig{QueueSize: 3, Policy: policy})
+		s.Add(priorityEvent("verbose", map[string]interface{}{"meta.priority": "verbose"}))
+		s.Add(priorityEvent("normal", nil))
+		s.Add(priorityEvent("critical", map[string]interface{}{"meta.priority": "critical"}))
+		s.Add(priorityEvent("new", nil))
+		assert.Equal(t, "verbose", nextError(s).Metadata, "%v should drop verbose events first", policy)
+		s.Add(priorityEvent("newer", nil))
+		if policy == OverflowDropOldest {
+			assert.Equal(t, "normal", nextError(s).Metadata, "%v should drop the oldest normal event", policy)
+		} else {
+			assert.Equal(t, "newer", nextError(s).Metadata, "%v should drop the new event", policy)
+		}
+		s.Add(priorityEvent("late verbose", map[string]interface{}{"meta.priority": "verbose"}))
+		assert.Equal(t, "late verbose", nextError(s).Metadata, "%v should drop new verbose events", policy)
+		assert.Equal(t, uint64(3), s.Stats().DroppedQueueFull)
+
+		close(inner.gate)
+		assert.NoError(t, s.Stop())
+		added := inner.addedNames()
+		assert.Contains(t, added, "critical", "%v should keep critical events", policy)
+		assert.Len(t, added, 4)
+	}
+}
+
+func TestBackpressureBlock(t *testing.T) {
+	s, inner := startBlocked(t, BackpressureConfig{QueueSize: 1, Policy: OverflowBlock, BlockTimeout: 20 * time.Millisecond})
+	s.Add(namedEvent("a"))
+	start := time.Now()
+	s.Add(namedEvent("timed out"))
+	assert.True(t, time.Since(start) >= 20*time.Millisecond, "Add should block until the timeout")
+	assert.Equal(t, uint64(1), s.Stats().DroppedQueueFull)
+
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		close(inner.gate)
+	}()
+	s.config.BlockTimeout = time.Second
+	s.Add(namedEvent("waited"))
+	assert.NoError(t, s.Stop())
+	assert.Equal(t, []string{"first", "a", "waited"}, inner.addedNames(), "blocked events should be queued once there is room")
+}
+
+func TestBackpressureDegradeSampleRate(t *testing.T) {
+	s, inner := startBlocked(t, BackpressureConfig{QueueSize: 1, Policy: OverflowDegradeSampleRate})
+	s.Add(namedEvent("a"))
+	s.Add(namedEvent("overflow"))
+	assert.Equal(t, uint(2), s.Stats().SampleRateMultiplier, "overflowing should raise the sample rate")
+	close(inner.gate)
+	assert.NoError(t, s.Stop())
+
+	s.lock.Lock()
+	s.multiplier = 4
+	var kept int
+	for i := 0; i < 400; i++ {
+		ev := &transmission.Event{
+			SampleRate: 2,
+			Data:       map[string]interface{}{"trace.trace_id": fmt.Sprintf("trace-%d", i)},
+		}
+		again := &transmission.Event{Data: ev.Data}
+		keep := s.keep(ev, priorityNormal)
+		assert.Equal(t, keep, s.keep(again, priorityNormal), "spans in the same trace should get the same decision")
+		if keep {
+			kept++
+			assert.Equal(t, uint(8), ev.SampleRate, "kept events should have their sample rate multiplied")
+		}
+	}
+	assert.True(t, s.keep(&transmission.Event{Data: map[string]interface{}{}}, priorityCritical), "critical events should be kept")
+	assert.False(t, s.keep(&transmission.Event{Data: map[string]interface{}{}}, priorityVerbose), "verbose events should be dropped")
+	s.lock.Unlock()
+	assert.InDelta(t, 100, kept, 40, "about a quarter of traces should be kept")
+}
+
+func TestBackpressureCircuitBreaker(t *testing.T) {
+	inner := newFlakySender(true)
+	s := NewBackpressureSender(inner, BackpressureConfig{FailureThreshold: 2, Cooldown: time.Hour})
+	assert.NoError(t, s.Start())
+	s.Add(namedEvent("a"))
+	s.Add(namedEvent("b"))
+	assert.Eventually(t, func() bool { return s.Stats().CircuitOpen }, time.Second, time.Millisecond,
+		"repeated failures should open the circuit")
+	s.Add(namedEvent("held"))
+	time.Sleep(10 * time.Millisecond)
+	stats := s.Stats()
+	assert.Equal(t, 1, stats.QueueDepth, "events should be held while the circuit is open")
+	assert.Equal(t, uint64(2), stats.Failed)
+	assert.Equal(t, "status 503", stats.LastError)
+	assert.False(t, stats.LastErrorTime.IsZero())
+
+	inner.setFailing(false)
+	assert.NoError(t, s.Stop())
+	assert.Equal(t, []string{"held"}, inner.sentNames(), "stopping should send held events")
+	assert.Eventually(t, func() bool { return s.Stats().Sent == 1 }, time.Second, time.Millisecond)
+}
+
+func TestParseOverflowPolicy(t *testing.T) {
+	for p := range overflowPolicyNames {
+		parsed, err := ParseOverflowPolicy(p.String())
+		assert.NoError(t, err)
+		assert.Equal(t, p, parsed)
+	}
+	_, err := ParseOverflowPolicy("drop_everything")
+	assert.Error(t, err)
+}
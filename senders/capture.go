@@ -0,0 +1,212 @@
+package senders
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/honeycombio/libhoney-go/transmission"
+)
+
+// defaultReplayAPIHost is where Replay sends events that don't set an API
+// host, matching libhoney's default.
+const defaultReplayAPIHost = "https://api.honeycomb.io/"
+
+// CapturingSender wraps another sender and also writes every event it is
+// given to a capture file, in the same newline-delimited JSON format as
+// FileSender, before passing it on. Events are captured whether or not the
+// wrapped sender manages to send them, so the file is a complete record of
+// what was sent, eg for an air-gapped environment or for looking back at an
+// incident. Captured events can be sent to Honeycomb later with Replay.
+//
+// Capture files don't contain write keys; give one to Replay instead.
+type CapturingSender struct {
+	inner   transmission.Sender
+	capture *FileSender
+}
+
+// NewCapturingSender returns a CapturingSender that sends events with inner
+// and appends them to the file at path, creating it if necessary. Call Close
+// after closing the beeline to close the file.
+func NewCapturingSender(inner transmission.Sender, path string) (*CapturingSender, error) {
+	capture, err := NewFileSender(path)
+	if err != nil {
+		return nil, err
+	}
+	return &CapturingSender{inner: inner, capture: capture}, nil
+}
+
+// Add captures ev and passes it to the wrapped sender.
+func (s *CapturingSender) Add(ev *transmission.Event) {
+	s.capture.Add(ev)
+	// the wrapped sender's responses are the ones that matter
+	select {
+	case <-s.capture.responses:
+	default:
+	}
+	s.inner.Add(ev)
+}
+
+// Start starts the wrapped sender.
+func (s *CapturingSender) Start() error {
+	return s.inner.Start()
+}
+
+// Stop stops the wrapped sender and syncs the capture file to disk.
+func (s *CapturingSender) Stop() error {
+	err := s.inner.Stop()
+	if cerr := s.capture.Stop(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Close closes the capture file. Events added afterwards are still passed to
+// the wrapped sender but aren't captured.
+func (s *CapturingSender) Close() error {
+	return s.capture.Close()
+}
+
+// TxResponses returns the wrapped sender's responses.
+func (s *CapturingSender) TxResponses() chan transmission.Response {
+	return s.inner.TxResponses()
+}
+
+// SendResponse passes r to the wrapped sender.
+func (s *CapturingSender) SendResponse(r transmission.Response) bool {
+	return s.inner.SendResponse(r)
+}
+
+// ReplayOverrides changes the events sent by Replay. Zero values leave events
+// as they were captured.
+type ReplayOverrides struct {
+	// Dataset, if set, is the dataset every event is sent to. Events captured
+	// without a dataset can't be replayed unless it is set.
+	Dataset string
+	// APIKey is the write key events are sent with. Capture files don't hold
+	// write keys, so it must be set to send events to Honeycomb.
+	APIKey string
+	// APIHost is the Honeycomb API server events are sent to.
+	// default: https://api.honeycomb.io/
+	APIHost string
+}
+
+// ReplayResult describes the events sent by Replay.
+type ReplayResult struct {
+	// Sent is the number of events given to the sender.
+	Sent int
+	// Failed is the number of them whose response was an error or a
+	// non-2xx status code.
+	Failed int
+}
+
+// Replay reads events written by a CapturingSender or FileSender from r and
+// sends them with sender, eg a &transmission.Honeycomb{BlockOnSend: true}
+// so none are dropped when its queue is full, after applying
+// overrides. Replay starts the sender and stops it once every event has been
+// added, so the sender shouldn't be in use elsewhere.
+//
+// Reading stops at the first line that can't be parsed; its error is returned
+// along with the result for the events sent before it.
+func Replay(r io.Reader, sender transmission.Sender, overrides ReplayOverrides) (ReplayResult, error) {
+	var result ReplayResult
+	if err := sender.Start(); err != nil {
+		return result, err
+	}
+	// responses are only available once the sender has started
+	responses := sender.TxResponses()
+	record := func(resp transmission.Response) {
+		if resp.Err != nil || resp.StatusCode < 200 || resp.StatusCode > 299 {
+			result.Failed++
+		}
+	}
+	drain := func() {
+		for {
+			select {
+			case resp, ok := <-responses:
+				if !ok {
+					return
+				}
+				record(resp)
+			default:
+				return
+			}
+		}
+	}
+
+	var readErr error
+	br := bufio.NewReader(r)
+	for line := 1; ; line++ {
+		b, err := br.ReadBytes('\n')
+		if len(bytes.TrimSpace(b)) > 0 {
+			ev, perr := replayEvent(b, overrides)
+			if perr != nil {
+				readErr = fmt.Errorf("line %d: %v", line, perr)
+				break
+			}
+			sender.Add(ev)
+			result.Sent++
+			drain()
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			readErr = err
+			break
+		}
+	}
+	err := sender.Stop()
+	drain()
+	if readErr != nil {
+		return result, readErr
+	}
+	return result, err
+}
+
+// replayEvent parses a line written by FileSender into an event to send.
+func replayEvent(line []byte, overrides ReplayOverrides) (*transmission.Event, error) {
+	var fe fileEvent
+	if err := json.Unmarshal(line, &fe); err != nil {
+		return nil, err
+	}
+	ev := &transmission.Event{
+		Data:       fe.Data,
+		Dataset:    fe.Dataset,
+		SampleRate: fe.SampleRate,
+		APIKey:     overrides.APIKey,
+		APIHost:    overrides.APIHost,
+	}
+	if overrides.Dataset != "" {
+		ev.Dataset = overrides.Dataset
+	}
+	if ev.Dataset == "" {
+		return nil, fmt.Errorf("event has no dataset")
+	}
+	if ev.SampleRate == 0 {
+		ev.SampleRate = 1
+	}
+	if ev.APIHost == "" {
+		ev.APIHost = defaultReplayAPIHost
+	}
+	if fe.Timestamp != nil {
+		ev.Timestamp = *fe.Timestamp
+	} else {
+		ev.Timestamp = time.Now()
+	}
+	return ev, nil
+}
+
+// ReplayFile replays the events in the capture file at path. See Replay.
+func ReplayFile(path string, sender transmission.Sender, overrides ReplayOverrides) (ReplayResult, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return ReplayResult{}, err
+	}
+	defer f.Close()
+	return Replay(f, sender, overrides)
+}
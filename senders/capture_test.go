@@ -0,0 +1,95 @@
+package senders
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/honeycombio/libhoney-go/transmission"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCaptureAndReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "senders")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "capture.json")
+
+	inner := &transmission.MockSender{}
+	s, err := NewCapturingSender(inner, path)
+	assert.NoError(t, err)
+	assert.NoError(t, s.Start())
+	ts := time.Date(2020, 8, 21, 19, 47, 14, 0, time.UTC)
+	s.Add(&transmission.Event{
+		APIKey:     "secretkey",
+		Dataset:    "myapp",
+		SampleRate: 4,
+		Timestamp:  ts,
+		Data:       map[string]interface{}{"name": "root"},
+	})
+	s.Add(&transmission.Event{
+		APIKey:    "secretkey",
+		Dataset:   "myapp",
+		Timestamp: ts,
+		Data:      map[string]interface{}{"name": "child"},
+	})
+	assert.NoError(t, s.Stop())
+	assert.NoError(t, s.Close())
+	assert.Len(t, inner.Events(), 2, "events should be passed to the wrapped sender")
+	assert.Equal(t, 0, len(s.capture.responses), "capture responses shouldn't pile up")
+
+	contents, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(contents), "secretkey", "write keys shouldn't be captured")
+
+	replayed := &transmission.MockSender{}
+	f, err := os.Open(path)
+	assert.NoError(t, err)
+	defer f.Close()
+	result, err := Replay(f, replayed, ReplayOverrides{APIKey: "newkey"})
+	assert.NoError(t, err)
+	assert.Equal(t, ReplayResult{Sent: 2}, result)
+	events := replayed.Events()
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, "root", events[0].Data["name"])
+		assert.Equal(t, "myapp", events[0].Dataset)
+		assert.Equal(t, uint(4), events[0].SampleRate)
+		assert.True(t, ts.Equal(events[0].Timestamp))
+		assert.Equal(t, "newkey", events[0].APIKey)
+		assert.Equal(t, defaultReplayAPIHost, events[0].APIHost)
+		assert.Equal(t, uint(1), events[1].SampleRate)
+	}
+
+	replayed = &transmission.MockSender{}
+	result, err = ReplayFile(path, replayed, ReplayOverrides{Dataset: "forensics", APIHost: "http://localhost:8080"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, result.Sent)
+	for _, ev := range replayed.Events() {
+		assert.Equal(t, "forensics", ev.Dataset)
+		assert.Equal(t, "http://localhost:8080", ev.APIHost)
+	}
+}
+
+func TestReplayErrors(t *testing.T) {
+	input := `{"data":{"name":"a"},"dataset":"myapp"}
+
+{"data":{"name":"b"}}
+{"data":{"name":"c"},"dataset":"myapp"}
+`
+	replayed := &transmission.MockSender{}
+	result, err := Replay(strings.NewReader(input), replayed, ReplayOverrides{})
+	assert.EqualError(t, err, "line 3: event has no dataset")
+	assert.Equal(t, 1, result.Sent, "events before the bad line should be sent")
+
+	result, err = Replay(strings.NewReader("not json\n"), &transmission.MockSender{}, ReplayOverrides{Dataset: "myapp"})
+	assert.Error(t, err)
+	assert.Equal(t, 0, result.Sent)
+
+	failing := newFlakySender(true)
+	result, err = Replay(strings.NewReader(input), failing, ReplayOverrides{Dataset: "myapp"})
+	assert.NoError(t, err)
+	assert.Equal(t, ReplayResult{Sent: 3, Failed: 3}, result)
+}
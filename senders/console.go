@@ -0,0 +1,223 @@
+package senders
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/honeycombio/libhoney-go/transmission"
+)
+
+// defaultConsoleWait is how long a ConsoleSender waits for more spans of a
+// trace whose root span it hasn't seen.
+const defaultConsoleWait = 2 * time.Second
+
+// consoleFields are the fields a ConsoleSender shows for each span, in order,
+// before any app. fields.
+var consoleFields = []string{"request.method", "request.path", "response.status_code", "db.query", "error"}
+
+// ConsoleSender prints traces to a writer, usually stderr, as indented trees
+// of spans with their durations and most useful fields, for reading during
+// local development:
+//
+//	trace 5d5e47c9a4bebdb4e0e2e7d490d6d673 (3 spans)
+//	└─ /hello 12.4ms request.method=GET request.path=/hello response.status_code=200
+//	   ├─ load_user 3.1ms app.user_id=42
+//	   └─ render 8.0ms
+//
+// Spans are held until their trace's root span is sent, since children are
+// usually sent before their parents. Spans of traces continued from another
+// service, whose root isn't sent from this one, are printed once no more have
+// arrived for a couple of seconds. Events that aren't part of a trace are
+// printed on their own. Nothing is sent to Honeycomb.
+type ConsoleSender struct {
+	lock      sync.Mutex
+	w         io.Writer
+	wait      time.Duration
+	traces    map[string]*consoleTrace
+	responses chan transmission.Response
+}
+
+// consoleTrace holds the spans of a trace that hasn't been printed yet.
+type consoleTrace struct {
+	spans []*transmission.Event
+	timer *time.Timer
+}
+
+// NewConsoleSender returns a ConsoleSender that prints to w.
+func NewConsoleSender(w io.Writer) *ConsoleSender {
+	return &ConsoleSender{
+		w:         w,
+		wait:      defaultConsoleWait,
+		traces:    make(map[string]*consoleTrace),
+		responses: make(chan transmission.Response, defaultResponseQueueSize),
+	}
+}
+
+// Add queues ev to be printed with the rest of its trace.
+func (s *ConsoleSender) Add(ev *transmission.Event) {
+	s.SendResponse(transmission.Response{StatusCode: 200, Metadata: ev.Metadata})
+	traceID, _ := ev.Data["trace.trace_id"].(string)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if traceID == "" {
+		s.print("event", []*transmission.Event{ev})
+		return
+	}
+	t := s.traces[traceID]
+	if t == nil {
+		t = &consoleTrace{}
+		s.traces[traceID] = t
+	}
+	t.spans = append(t.spans, ev)
+	if _, ok := ev.Data["trace.parent_id"]; !ok {
+		s.flushLocked(traceID)
+		return
+	}
+	if t.timer == nil {
+		t.timer = time.AfterFunc(s.wait, func() {
+			s.lock.Lock()
+			defer s.lock.Unlock()
+			s.flushLocked(traceID)
+		})
+	} else {
+		t.timer.Reset(s.wait)
+	}
+}
+
+// flushLocked prints the spans held for traceID.
+func (s *ConsoleSender) flushLocked(traceID string) {
+	t := s.traces[traceID]
+	if t == nil {
+		return
+	}
+	delete(s.traces, traceID)
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+	s.print("trace "+traceID, t.spans)
+}
+
+// print writes a tree of spans with a heading.
+func (s *ConsoleSender) print(heading string, spans []*transmission.Event) {
+	var buf bytes.Buffer
+	switch {
+	case heading == "event":
+	case len(spans) == 1:
+		fmt.Fprintf(&buf, "%s (1 span)\n", heading)
+	default:
+		fmt.Fprintf(&buf, "%s (%d spans)\n", heading, len(spans))
+	}
+	children := make(map[string][]*transmission.Event)
+	ids := make(map[string]bool, len(spans))
+	for _, ev := range spans {
+		if id, ok := ev.Data["trace.span_id"].(string); ok {
+			ids[id] = true
+		}
+	}
+	var roots []*transmission.Event
+	for _, ev := range spans {
+		parent, _ := ev.Data["trace.parent_id"].(string)
+		if parent != "" && ids[parent] {
+			children[parent] = append(children[parent], ev)
+		} else {
+			roots = append(roots, ev)
+		}
+	}
+	writeSpans(&buf, roots, children, "")
+	s.w.Write(buf.Bytes())
+}
+
+// writeSpans writes spans and their descendants, indented by prefix.
+func writeSpans(buf *bytes.Buffer, spans []*transmission.Event, children map[string][]*transmission.Event, prefix string) {
+	sort.SliceStable(spans, func(i, j int) bool {
+		return spans[i].Timestamp.Before(spans[j].Timestamp)
+	})
+	for i, ev := range spans {
+		branch, indent := "├─ ", "│  "
+		if i == len(spans)-1 {
+			branch, indent = "└─ ", "   "
+		}
+		buf.WriteString(prefix)
+		buf.WriteString(branch)
+		buf.WriteString(describeSpan(ev))
+		buf.WriteByte('\n')
+		if id, ok := ev.Data["trace.span_id"].(string); ok {
+			writeSpans(buf, children[id], children, prefix+indent)
+		}
+	}
+}
+
+// describeSpan returns a line describing ev: its name, duration, and the
+// fields in consoleFields and under app.
+func describeSpan(ev *transmission.Event) string {
+	var b strings.Builder
+	name, _ := ev.Data["name"].(string)
+	if name == "" {
+		name = "(unnamed)"
+	}
+	if ev.Data["meta.annotation_type"] == "span_event" {
+		name = "• " + name
+	}
+	b.WriteString(name)
+	if ms, ok := ev.Data["duration_ms"].(float64); ok {
+		fmt.Fprintf(&b, " %sms", strconv.FormatFloat(ms, 'f', 1, 64))
+	}
+	for _, k := range consoleFields {
+		if v, ok := ev.Data[k]; ok {
+			writeField(&b, k, v)
+		}
+	}
+	var app []string
+	for k := range ev.Data {
+		if strings.HasPrefix(k, "app.") {
+			app = append(app, k)
+		}
+	}
+	sort.Strings(app)
+	for _, k := range app {
+		writeField(&b, k, ev.Data[k])
+	}
+	return b.String()
+}
+
+func writeField(b *strings.Builder, k string, v interface{}) {
+	s := fmt.Sprint(v)
+	if strings.ContainsAny(s, " \t\n\"") {
+		s = strconv.Quote(s)
+	}
+	fmt.Fprintf(b, " %s=%s", k, s)
+}
+
+// Start does nothing.
+func (s *ConsoleSender) Start() error { return nil }
+
+// Stop prints every trace that is still being held.
+func (s *ConsoleSender) Stop() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for id := range s.traces {
+		s.flushLocked(id)
+	}
+	return nil
+}
+
+// TxResponses returns the channel of responses to added events.
+func (s *ConsoleSender) TxResponses() chan transmission.Response {
+	return s.responses
+}
+
+// SendResponse queues r without blocking and reports whether it was dropped.
+func (s *ConsoleSender) SendResponse(r transmission.Response) bool {
+	select {
+	case s.responses <- r:
+		return false
+	default:
+		return true
+	}
+}
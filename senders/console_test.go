@@ -0,0 +1,89 @@
+package senders
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/honeycombio/libhoney-go/transmission"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConsoleSender(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewConsoleSender(&buf)
+	assert.NoError(t, s.Start())
+	ts := time.Date(2020, 8, 21, 19, 47, 14, 0, time.UTC)
+	span := func(id, parent, name string, offset time.Duration, fields map[string]interface{}) *transmission.Event {
+		data := map[string]interface{}{
+			"trace.trace_id": "abc",
+			"trace.span_id":  id,
+			"name":           name,
+			"duration_ms":    1.25,
+		}
+		if parent != "" {
+			data["trace.parent_id"] = parent
+		}
+		for k, v := range fields {
+			data[k] = v
+		}
+		return &transmission.Event{Timestamp: ts.Add(offset), Data: data}
+	}
+	s.Add(span("c2", "root", "render", 2*time.Millisecond, nil))
+	s.Add(span("g1", "c1", "query", 1*time.Millisecond, map[string]interface{}{"db.query": "select 1"}))
+	s.Add(span("c1", "root", "load_user", 1*time.Millisecond, map[string]interface{}{"app.user_id": 42}))
+	assert.Equal(t, "", buf.String(), "spans should be held until the root arrives")
+	s.Add(span("root", "", "/hello", 0, map[string]interface{}{
+		"request.method":       "GET",
+		"response.status_code": 200,
+		"app.zone":             "b",
+		"other":                "hidden",
+	}))
+	assert.Equal(t, "trace abc (4 spans)\n"+
+		"└─ /hello 1.2ms request.method=GET response.status_code=200 app.zone=b\n"+
+		"   ├─ load_user 1.2ms app.user_id=42\n"+
+		"   │  └─ query 1.2ms db.query=\"select 1\"\n"+
+		"   └─ render 1.2ms\n", buf.String())
+
+	buf.Reset()
+	s.Add(&transmission.Event{Data: map[string]interface{}{"name": "tick"}})
+	assert.Equal(t, "└─ tick\n", buf.String(), "events outside a trace should print immediately")
+
+	buf.Reset()
+	s.Add(&transmission.Event{Data: map[string]interface{}{
+		"trace.trace_id":  "remote",
+		"trace.span_id":   "s1",
+		"trace.parent_id": "upstream",
+		"name":            "continued",
+	}})
+	assert.Equal(t, "", buf.String())
+	assert.NoError(t, s.Stop())
+	assert.Equal(t, "trace remote (1 span)\n└─ continued\n", buf.String(),
+		"Stop should print traces still waiting for a root")
+
+	responses := 0
+	for len(s.TxResponses()) > 0 {
+		r := <-s.TxResponses()
+		assert.Equal(t, 200, r.StatusCode)
+		responses++
+	}
+	assert.Equal(t, 6, responses)
+}
+
+func TestConsoleSenderWait(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewConsoleSender(&buf)
+	s.wait = 10 * time.Millisecond
+	s.Add(&transmission.Event{Data: map[string]interface{}{
+		"trace.trace_id":  "remote",
+		"trace.span_id":   "s1",
+		"trace.parent_id": "upstream",
+		"name":            "continued",
+	}})
+	time.Sleep(50 * time.Millisecond)
+	s.lock.Lock()
+	out := buf.String()
+	s.lock.Unlock()
+	assert.Equal(t, "trace remote (1 span)\n└─ continued\n", out,
+		"traces without a root should print once spans stop arriving")
+}
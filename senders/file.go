@@ -0,0 +1,120 @@
+package senders
+
+import (
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/honeycombio/libhoney-go/transmission"
+)
+
+// FileSender writes each event to a file as a line of JSON. Lines have the
+// same shape as events in the Honeycomb batch API:
+//
+//   {"data":{...},"samplerate":2,"time":"2020-08-21T19:47:14.212Z","dataset":"myapp"}
+//
+// so the file can be read by other tools, or sent to Honeycomb later with
+// honeytail. Events are written synchronously as they are sent.
+type FileSender struct {
+	lock      sync.Mutex
+	w         io.Writer
+	closer    io.Closer
+	responses chan transmission.Response
+}
+
+// NewFileSender returns a FileSender that appends events to the file at path,
+// creating it if necessary. Call Close after closing the beeline to close the
+// file.
+func NewFileSender(path string) (*FileSender, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	s := NewWriterSender(f)
+	s.closer = f
+	return s, nil
+}
+
+// NewWriterSender returns a FileSender that writes events to w. Writes to w
+// are serialized.
+func NewWriterSender(w io.Writer) *FileSender {
+	return &FileSender{
+		w:         w,
+		responses: make(chan transmission.Response, defaultResponseQueueSize),
+	}
+}
+
+// fileEvent is the JSON representation of an event written by FileSender.
+type fileEvent struct {
+	Data       map[string]interface{} `json:"data"`
+	SampleRate uint                   `json:"samplerate,omitempty"`
+	Timestamp  *time.Time             `json:"time,omitempty"`
+	Dataset    string                 `json:"dataset,omitempty"`
+}
+
+// Add writes ev to the file and sends a response with the result.
+func (s *FileSender) Add(ev *transmission.Event) {
+	start := time.Now()
+	buf := getBuffer()
+	line, err := appendFileEvent(*buf, ev)
+	if err == nil {
+		line = append(line, '\n')
+		s.lock.Lock()
+		_, err = s.w.Write(line)
+		s.lock.Unlock()
+	}
+	*buf = line
+	putBuffer(buf)
+	resp := transmission.Response{
+		Err:      err,
+		Duration: time.Since(start),
+		Metadata: ev.Metadata,
+	}
+	if err == nil {
+		resp.StatusCode = 200
+	}
+	s.SendResponse(resp)
+}
+
+// Start does nothing; the file is opened by NewFileSender.
+func (s *FileSender) Start() error { return nil }
+
+// Stop syncs the file to disk, if it is one. Since libhoney stops and restarts
+// its sender to flush it, the file is left open; use Close to close it.
+func (s *FileSender) Stop() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if f, ok := s.w.(*os.File); ok {
+		return f.Sync()
+	}
+	return nil
+}
+
+// Close closes the file opened by NewFileSender. Events added afterwards are
+// dropped with an error response.
+func (s *FileSender) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closer == nil {
+		return nil
+	}
+	err := s.closer.Close()
+	s.closer = nil
+	return err
+}
+
+// TxResponses returns the channel of responses to added events.
+func (s *FileSender) TxResponses() chan transmission.Response {
+	return s.responses
+}
+
+// SendResponse queues r without blocking and reports whether it was dropped.
+func (s *FileSender) SendResponse(r transmission.Response) bool {
+	select {
+	case s.responses <- r:
+		return false
+	default:
+		return true
+	}
+}
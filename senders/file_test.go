@@ -0,0 +1,71 @@
+package senders
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/honeycombio/libhoney-go/transmission"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileSender(t *testing.T) {
+	dir, err := ioutil.TempDir("", "senders")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "events.json")
+
+	s, err := NewFileSender(path)
+	assert.NoError(t, err)
+	assert.NoError(t, s.Start())
+	ts := time.Date(2020, 8, 21, 19, 47, 14, 0, time.UTC)
+	s.Add(&transmission.Event{
+		Dataset:    "myapp",
+		SampleRate: 4,
+		Timestamp:  ts,
+		Metadata:   "first",
+		Data:       map[string]interface{}{"name": "root", "duration_ms": 1.5},
+	})
+	s.Add(&transmission.Event{
+		SampleRate: 1,
+		Data:       map[string]interface{}{"name": "child"},
+	})
+	assert.NoError(t, s.Stop())
+	assert.NoError(t, s.Close())
+
+	resp := <-s.TxResponses()
+	assert.NoError(t, resp.Err)
+	assert.Equal(t, "first", resp.Metadata, "responses should carry the event's metadata")
+
+	f, err := os.Open(path)
+	assert.NoError(t, err)
+	defer f.Close()
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var line map[string]interface{}
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+		lines = append(lines, line)
+	}
+	assert.Equal(t, 2, len(lines), "each event should be written on its own line")
+	assert.Equal(t, "myapp", lines[0]["dataset"])
+	assert.Equal(t, float64(4), lines[0]["samplerate"])
+	assert.Equal(t, "2020-08-21T19:47:14Z", lines[0]["time"])
+	assert.Equal(t, map[string]interface{}{"name": "root", "duration_ms": 1.5}, lines[0]["data"])
+	_, ok := lines[1]["samplerate"]
+	assert.False(t, ok, "a sample rate of 1 should be left out")
+
+	// reopening appends rather than truncating
+	s, err = NewFileSender(path)
+	assert.NoError(t, err)
+	s.Add(&transmission.Event{Data: map[string]interface{}{"name": "third"}})
+	assert.NoError(t, s.Close())
+	contents, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, bytes.Count(contents, []byte("\n")), "reopening the file should append to it")
+}
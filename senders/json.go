@@ -0,0 +1,281 @@
+package senders
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/honeycombio/libhoney-go/transmission"
+)
+
+// The senders that write events as JSON encode them by appending to a
+// reusable buffer rather than with json.Marshal, which builds each event
+// through reflection and allocates for every field. The output is the same as
+// json.Marshal's, keys sorted and HTML characters escaped, so files written by
+// earlier versions read the same; values of types without a fast path here
+// are encoded with json.Marshal.
+
+// maxPooledBuffer is the largest buffer kept for reuse, so that one huge
+// event doesn't pin its buffer forever.
+const maxPooledBuffer = 64 << 10
+
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 0, 1024)
+		return &b
+	},
+}
+
+var keysPool = sync.Pool{
+	New: func() interface{} {
+		k := make([]string, 0, 32)
+		return &k
+	},
+}
+
+// getBuffer returns an empty buffer from the pool, to be returned with
+// putBuffer once it has been written.
+func getBuffer() *[]byte {
+	b := bufferPool.Get().(*[]byte)
+	*b = (*b)[:0]
+	return b
+}
+
+func putBuffer(b *[]byte) {
+	if cap(*b) <= maxPooledBuffer {
+		bufferPool.Put(b)
+	}
+}
+
+// appendFileEvent appends ev as a FileSender line, without the newline, in
+// the shape of fileEvent.
+func appendFileEvent(buf []byte, ev *transmission.Event) ([]byte, error) {
+	buf = append(buf, `{"data":`...)
+	buf, err := appendJSONFields(buf, ev.Data)
+	if err != nil {
+		return buf, err
+	}
+	// a sample rate of 1 is the default and is left out
+	if ev.SampleRate > 1 {
+		buf = append(buf, `,"samplerate":`...)
+		buf = strconv.AppendUint(buf, uint64(ev.SampleRate), 10)
+	}
+	if !ev.Timestamp.IsZero() {
+		buf = append(buf, `,"time":`...)
+		if buf, err = appendJSONTime(buf, ev.Timestamp); err != nil {
+			return buf, err
+		}
+	}
+	if ev.Dataset != "" {
+		buf = append(buf, `,"dataset":`...)
+		buf = appendJSONString(buf, ev.Dataset)
+	}
+	return append(buf, '}'), nil
+}
+
+// appendSpooledEvent appends ev as a spool file line, without the newline,
+// in the shape of spooledEvent.
+func appendSpooledEvent(buf []byte, ev *transmission.Event) ([]byte, error) {
+	buf = append(buf, '{')
+	if ev.APIKey != "" {
+		buf = append(buf, `"api_key":`...)
+		buf = appendJSONString(buf, ev.APIKey)
+		buf = append(buf, ',')
+	}
+	if ev.APIHost != "" {
+		buf = append(buf, `"api_host":`...)
+		buf = appendJSONString(buf, ev.APIHost)
+		buf = append(buf, ',')
+	}
+	if ev.Dataset != "" {
+		buf = append(buf, `"dataset":`...)
+		buf = appendJSONString(buf, ev.Dataset)
+		buf = append(buf, ',')
+	}
+	if ev.SampleRate != 0 {
+		buf = append(buf, `"samplerate":`...)
+		buf = strconv.AppendUint(buf, uint64(ev.SampleRate), 10)
+		buf = append(buf, ',')
+	}
+	buf = append(buf, `"time":`...)
+	buf, err := appendJSONTime(buf, ev.Timestamp)
+	if err != nil {
+		return buf, err
+	}
+	buf = append(buf, `,"data":`...)
+	if buf, err = appendJSONFields(buf, ev.Data); err != nil {
+		return buf, err
+	}
+	return append(buf, '}'), nil
+}
+
+// appendJSONFields appends an event's fields as a JSON object with its keys
+// sorted.
+func appendJSONFields(buf []byte, fields map[string]interface{}) ([]byte, error) {
+	if fields == nil {
+		return append(buf, "null"...), nil
+	}
+	keysp := keysPool.Get().(*[]string)
+	keys := (*keysp)[:0]
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	buf = append(buf, '{')
+	var err error
+	for i, k := range keys {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		buf = appendJSONString(buf, k)
+		buf = append(buf, ':')
+		if buf, err = appendJSONValue(buf, fields[k]); err != nil {
+			break
+		}
+	}
+	*keysp = keys[:0]
+	keysPool.Put(keysp)
+	return append(buf, '}'), err
+}
+
+// appendJSONValue appends v as JSON, taking a fast path for the types spans'
+// fields usually hold.
+func appendJSONValue(buf []byte, v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return append(buf, "null"...), nil
+	case string:
+		return appendJSONString(buf, v), nil
+	case bool:
+		return strconv.AppendBool(buf, v), nil
+	case int:
+		return strconv.AppendInt(buf, int64(v), 10), nil
+	case int8:
+		return strconv.AppendInt(buf, int64(v), 10), nil
+	case int16:
+		return strconv.AppendInt(buf, int64(v), 10), nil
+	case int32:
+		return strconv.AppendInt(buf, int64(v), 10), nil
+	case int64:
+		return strconv.AppendInt(buf, v, 10), nil
+	case uint:
+		return strconv.AppendUint(buf, uint64(v), 10), nil
+	case uint8:
+		return strconv.AppendUint(buf, uint64(v), 10), nil
+	case uint16:
+		return strconv.AppendUint(buf, uint64(v), 10), nil
+	case uint32:
+		return strconv.AppendUint(buf, uint64(v), 10), nil
+	case uint64:
+		return strconv.AppendUint(buf, v, 10), nil
+	case float32:
+		return appendJSONFloat(buf, float64(v), 32)
+	case float64:
+		return appendJSONFloat(buf, v, 64)
+	case time.Time:
+		return appendJSONTime(buf, v)
+	}
+	j, err := json.Marshal(v)
+	if err != nil {
+		return buf, err
+	}
+	return append(buf, j...), nil
+}
+
+// appendJSONFloat appends f formatted like encoding/json does: as a decimal
+// unless it is very large or small.
+func appendJSONFloat(buf []byte, f float64, bits int) ([]byte, error) {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		// let encoding/json describe the error
+		_, err := json.Marshal(f)
+		return buf, err
+	}
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 {
+		if bits == 64 && (abs < 1e-6 || abs >= 1e21) ||
+			bits == 32 && (float32(abs) < 1e-6 || float32(abs) >= 1e21) {
+			format = 'e'
+		}
+	}
+	buf = strconv.AppendFloat(buf, f, format, -1, bits)
+	if format == 'e' {
+		// shorten e-09 to e-9, as encoding/json does
+		if n := len(buf); n >= 4 && buf[n-4] == 'e' && buf[n-3] == '-' && buf[n-2] == '0' {
+			buf[n-2] = buf[n-1]
+			buf = buf[:n-1]
+		}
+	}
+	return buf, nil
+}
+
+// appendJSONTime appends t as time.Time's MarshalJSON does.
+func appendJSONTime(buf []byte, t time.Time) ([]byte, error) {
+	if y := t.Year(); y < 0 || y >= 10000 {
+		// let time describe the error
+		_, err := t.MarshalJSON()
+		return buf, err
+	}
+	buf = append(buf, '"')
+	buf = t.AppendFormat(buf, time.RFC3339Nano)
+	return append(buf, '"'), nil
+}
+
+const hexDigits = "0123456789abcdef"
+
+// appendJSONString appends s as a JSON string, escaped like encoding/json
+// escapes it: HTML characters and U+2028 and U+2029 as \u escapes, and
+// invalid UTF-8 replaced with U+FFFD.
+func appendJSONString(buf []byte, s string) []byte {
+	buf = append(buf, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		if b := s[i]; b < utf8.RuneSelf {
+			if b >= 0x20 && b != '"' && b != '\\' && b != '<' && b != '>' && b != '&' {
+				i++
+				continue
+			}
+			buf = append(buf, s[start:i]...)
+			switch b {
+			case '"', '\\':
+				buf = append(buf, '\\', b)
+			case '\b':
+				buf = append(buf, '\\', 'b')
+			case '\f':
+				buf = append(buf, '\\', 'f')
+			case '\n':
+				buf = append(buf, '\\', 'n')
+			case '\r':
+				buf = append(buf, '\\', 'r')
+			case '\t':
+				buf = append(buf, '\\', 't')
+			default:
+				buf = append(buf, '\\', 'u', '0', '0', hexDigits[b>>4], hexDigits[b&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+		c, size := utf8.DecodeRuneInString(s[i:])
+		if c == utf8.RuneError && size == 1 {
+			buf = append(buf, s[start:i]...)
+			buf = append(buf, "\ufffd"...)
+			i += size
+			start = i
+			continue
+		}
+		if c == '\u2028' || c == '\u2029' {
+			buf = append(buf, s[start:i]...)
+			buf = append(buf, '\\', 'u', '2', '0', '2', hexDigits[c&0xF])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	buf = append(buf, s[start:]...)
+	return append(buf, '"')
+}
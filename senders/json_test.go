@@ -0,0 +1,104 @@
+package senders
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/honeycombio/libhoney-go/transmission"
+	"github.com/stretchr/testify/assert"
+)
+
+func jsonTestEvent() *transmission.Event {
+	return &transmission.Event{
+		APIKey:     "key",
+		APIHost:    "https://api.honeycomb.io",
+		Dataset:    "my<app>",
+		SampleRate: 4,
+		Timestamp:  time.Date(2020, 8, 21, 19, 47, 14, 212000000, time.UTC),
+		Data: map[string]interface{}{
+			"name":              "GET /",
+			"escapes":           "quote\" slash\\ <b>&amp;</b> \n\r\t\b\f\x01    \xff é",
+			"duration_ms":       12.5,
+			"tiny":              1e-9,
+			"huge":              1e21,
+			"float32":           float32(0.1),
+			"zero":              0.0,
+			"int":               -3,
+			"int8":              int8(8),
+			"uint64":            uint64(math.MaxUint64),
+			"bool":              true,
+			"nil":               nil,
+			"time":              time.Date(2021, 1, 2, 3, 4, 5, 6, time.FixedZone("x", 3600)),
+			"slice":             []string{"a", "b"},
+			"map":               map[string]int{"b": 2, "a": 1},
+			"error":             errors.New("not marshaled as a string"),
+			"trace.trace_id":    "abc",
+			"response.bytes":    int64(1 << 40),
+			"meta.span_type":    "root",
+			"app.nested.object": struct{ A int }{1},
+		},
+	}
+}
+
+func TestAppendEventsMatchJSONMarshal(t *testing.T) {
+	ev := jsonTestEvent()
+
+	want, err := json.Marshal(fileEvent{
+		Data:       ev.Data,
+		SampleRate: ev.SampleRate,
+		Timestamp:  &ev.Timestamp,
+		Dataset:    ev.Dataset,
+	})
+	assert.NoError(t, err)
+	got, err := appendFileEvent(nil, ev)
+	assert.NoError(t, err)
+	assert.Equal(t, string(want), string(got))
+
+	want, err = json.Marshal(spooledEvent{
+		APIKey:     ev.APIKey,
+		APIHost:    ev.APIHost,
+		Dataset:    ev.Dataset,
+		SampleRate: ev.SampleRate,
+		Timestamp:  ev.Timestamp,
+		Data:       ev.Data,
+	})
+	assert.NoError(t, err)
+	got, err = appendSpooledEvent(nil, ev)
+	assert.NoError(t, err)
+	assert.Equal(t, string(want), string(got))
+
+	got, err = appendFileEvent(nil, &transmission.Event{SampleRate: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"data":null}`, string(got), "defaults should be left out")
+}
+
+func TestAppendEventErrors(t *testing.T) {
+	for _, v := range []interface{}{math.NaN(), math.Inf(1), float32(math.Inf(-1)), make(chan int)} {
+		_, err := appendFileEvent(nil, &transmission.Event{Data: map[string]interface{}{"v": v}})
+		assert.Error(t, err, "%v can't be encoded", v)
+	}
+	_, err := appendSpooledEvent(nil, &transmission.Event{Timestamp: time.Date(10000, 1, 1, 0, 0, 0, 0, time.UTC)})
+	assert.Error(t, err)
+}
+
+func BenchmarkEncodeEvent(b *testing.B) {
+	ev := jsonTestEvent()
+	delete(ev.Data, "error")
+	b.Run("json.Marshal", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			json.Marshal(fileEvent{Data: ev.Data, SampleRate: ev.SampleRate, Timestamp: &ev.Timestamp, Dataset: ev.Dataset})
+		}
+	})
+	b.Run("append", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			buf := getBuffer()
+			*buf, _ = appendFileEvent(*buf, ev)
+			putBuffer(buf)
+		}
+	})
+}
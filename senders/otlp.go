@@ -0,0 +1,313 @@
+package senders
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/honeycombio/libhoney-go/transmission"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// defaultOTLPHTTPEndpoint is the Honeycomb OTLP/HTTP endpoint, used when
+	// neither the config nor the event names an API host.
+	defaultOTLPHTTPEndpoint = "https://api.honeycomb.io"
+	// defaultOTLPGRPCEndpoint is the Honeycomb OTLP/gRPC endpoint.
+	defaultOTLPGRPCEndpoint = "api.honeycomb.io:443"
+	// otlpTracesPath is added to OTLP/HTTP endpoints that don't have a path.
+	otlpTracesPath = "/v1/traces"
+	// otlpExportMethod is the full name of the OTLP trace export RPC.
+	otlpExportMethod = "/opentelemetry.proto.collector.trace.v1.TraceService/Export"
+	// defaultOTLPTimeout limits each export request.
+	defaultOTLPTimeout = 10 * time.Second
+	// maxResponseBody limits how much of an error response is kept.
+	maxResponseBody = 64 * 1024
+)
+
+// Headers used by Honeycomb to authorize OTLP requests and choose a dataset.
+const (
+	headerTeam    = "x-honeycomb-team"
+	headerDataset = "x-honeycomb-dataset"
+)
+
+// OTLPConfig configures the OTLP senders. Events are converted to spans using
+// the beeline's trace fields (trace.trace_id, trace.span_id, trace.parent_id,
+// name, and duration_ms); every other field becomes a span attribute. The
+// service name becomes the service.name resource attribute. Each event's write
+// key and dataset are sent as Honeycomb headers so the beeline's usual
+// WriteKey and Dataset settings keep working.
+type OTLPConfig struct {
+	// Endpoint is where spans are sent. For OTLP/HTTP it is a URL, to which
+	// /v1/traces is added if it has no path; the default is each event's API
+	// host (Config.APIHost), or https://api.honeycomb.io. For OTLP/gRPC it is
+	// a host:port. default: api.honeycomb.io:443
+	Endpoint string
+	// Insecure disables TLS for OTLP/gRPC. For OTLP/HTTP use an http:// URL
+	// as the Endpoint instead.
+	Insecure bool
+	// Headers are added to every export request, eg to authenticate with a
+	// collector.
+	Headers map[string]string
+	// Timeout limits how long each export request may take. default: 10s
+	Timeout time.Duration
+	// MaxBatchSize is the largest number of spans sent in one request.
+	// default: libhoney.DefaultMaxBatchSize
+	MaxBatchSize uint
+	// MaxBatchBytes limits the size of each request, as estimated from the
+	// lengths of the spans' fields, so busy services send batches as soon
+	// as they are big enough rather than waiting for BatchTimeout.
+	// default: 2MB
+	MaxBatchBytes uint
+	// MaxConcurrentBatches is how many requests may be in flight at once.
+	// default: libhoney.DefaultMaxConcurrentBatches
+	MaxConcurrentBatches uint
+	// BatchTimeout is how long after its first span arrived a batch that
+	// isn't full is sent. default: libhoney.DefaultBatchTimeout
+	BatchTimeout time.Duration
+	// PendingWorkCapacity is the number of events that may be queued waiting
+	// to be sent. If the queue is full, events are dropped.
+	// default: libhoney.DefaultPendingWorkCapacity
+	PendingWorkCapacity uint
+	// Transport, if set, is used for OTLP/HTTP requests.
+	// default: http.DefaultTransport
+	Transport http.RoundTripper
+	// DialOptions are added to the options used to connect to an OTLP/gRPC
+	// endpoint, eg to supply custom credentials.
+	DialOptions []grpc.DialOption
+}
+
+func (c OTLPConfig) timeout() time.Duration {
+	if c.Timeout == 0 {
+		return defaultOTLPTimeout
+	}
+	return c.Timeout
+}
+
+func (c OTLPConfig) limits() batchLimits {
+	return batchLimits{
+		maxBatchSize:         c.MaxBatchSize,
+		maxBatchBytes:        c.MaxBatchBytes,
+		maxConcurrentBatches: c.MaxConcurrentBatches,
+		batchTimeout:         c.BatchTimeout,
+		pendingWorkCapacity:  c.PendingWorkCapacity,
+	}
+}
+
+// headers returns the headers for a request sending events to key.
+func (c OTLPConfig) headers(key batchKey) map[string]string {
+	h := make(map[string]string, len(c.Headers)+2)
+	for k, v := range c.Headers {
+		h[strings.ToLower(k)] = v
+	}
+	if key.apiKey != "" {
+		h[headerTeam] = key.apiKey
+	}
+	if key.dataset != "" {
+		h[headerDataset] = key.dataset
+	}
+	return h
+}
+
+// OTLPSender sends events as OTLP traces. Create one with NewOTLPHTTPSender or
+// NewOTLPGRPCSender.
+type OTLPSender struct {
+	*batcher
+	// dial, if set, is called by Start to connect to the endpoint
+	dial func() error
+	// close, if set, is called by Close to disconnect from the endpoint
+	close func() error
+}
+
+// Add queues ev to be sent in the next batch.
+func (s *OTLPSender) Add(ev *transmission.Event) {
+	s.batcher.add(ev)
+}
+
+// Start begins sending events. For OTLP/gRPC it also connects to the endpoint
+// the first time it is called.
+func (s *OTLPSender) Start() error {
+	if s.dial != nil {
+		if err := s.dial(); err != nil {
+			return err
+		}
+		s.dial = nil
+	}
+	s.batcher.start()
+	return nil
+}
+
+// Stop sends any queued events and waits for them to finish. The sender may
+// be started again.
+func (s *OTLPSender) Stop() error {
+	s.batcher.stop()
+	return nil
+}
+
+// Close stops the sender and closes its connection, if it has one.
+func (s *OTLPSender) Close() error {
+	s.batcher.stop()
+	if s.close != nil {
+		return s.close()
+	}
+	return nil
+}
+
+// TxResponses returns the channel of responses to added events.
+func (s *OTLPSender) TxResponses() chan transmission.Response {
+	return s.batcher.responses
+}
+
+// SendResponse queues r without blocking and reports whether it was dropped.
+func (s *OTLPSender) SendResponse(r transmission.Response) bool {
+	return s.batcher.sendResponse(r)
+}
+
+// NewOTLPHTTPSender returns a sender that exports spans with OTLP/HTTP using
+// protobuf encoding.
+func NewOTLPHTTPSender(config OTLPConfig) (*OTLPSender, error) {
+	if config.Endpoint != "" {
+		if _, err := otlpHTTPURL(config.Endpoint); err != nil {
+			return nil, err
+		}
+	}
+	client := &http.Client{
+		Transport: config.Transport,
+		Timeout:   config.timeout(),
+	}
+	export := func(key batchKey, events []*transmission.Event) (int, []byte, error) {
+		endpoint := config.Endpoint
+		if endpoint == "" {
+			endpoint = key.apiHost
+		}
+		if endpoint == "" {
+			endpoint = defaultOTLPHTTPEndpoint
+		}
+		u, err := otlpHTTPURL(endpoint)
+		if err != nil {
+			return 0, nil, err
+		}
+		req, err := http.NewRequest("POST", u, bytes.NewReader(encodeExportRequest(events)))
+		if err != nil {
+			return 0, nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-protobuf")
+		for k, v := range config.headers(key) {
+			req.Header.Set(k, v)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return 0, nil, err
+		}
+		defer resp.Body.Close()
+		var body []byte
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			body, _ = ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+		} else {
+			io.Copy(ioutil.Discard, resp.Body)
+		}
+		return resp.StatusCode, body, nil
+	}
+	return &OTLPSender{
+		batcher: newBatcher(config.limits(), export),
+	}, nil
+}
+
+// otlpHTTPURL returns the URL to which spans are posted for endpoint.
+func otlpHTTPURL(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid OTLP endpoint %q: %v", endpoint, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("invalid OTLP endpoint %q: scheme must be http or https", endpoint)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = otlpTracesPath
+	}
+	return u.String(), nil
+}
+
+// NewOTLPGRPCSender returns a sender that exports spans with OTLP/gRPC. The
+// connection is made when the sender is started.
+func NewOTLPGRPCSender(config OTLPConfig) (*OTLPSender, error) {
+	endpoint := config.Endpoint
+	if endpoint == "" {
+		endpoint = defaultOTLPGRPCEndpoint
+	}
+	if strings.Contains(endpoint, "://") {
+		return nil, fmt.Errorf("invalid OTLP endpoint %q: gRPC endpoints are host:port", endpoint)
+	}
+	var conn *grpc.ClientConn
+	s := &OTLPSender{}
+	s.dial = func() error {
+		opts := []grpc.DialOption{
+			grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{})),
+		}
+		if config.Insecure {
+			opts = []grpc.DialOption{grpc.WithInsecure()}
+		}
+		opts = append(opts, config.DialOptions...)
+		var err error
+		conn, err = grpc.Dial(endpoint, opts...)
+		return err
+	}
+	s.close = func() error {
+		if conn == nil {
+			return nil
+		}
+		return conn.Close()
+	}
+	export := func(key batchKey, events []*transmission.Event) (int, []byte, error) {
+		if conn == nil {
+			return 0, nil, errors.New("OTLP sender has not been started")
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), config.timeout())
+		defer cancel()
+		ctx = metadata.NewOutgoingContext(ctx, metadata.New(config.headers(key)))
+		req := rawMessage(encodeExportRequest(events))
+		var resp rawMessage
+		if err := conn.Invoke(ctx, otlpExportMethod, &req, &resp, grpc.ForceCodec(rawCodec{})); err != nil {
+			return 0, nil, err
+		}
+		return http.StatusOK, nil, nil
+	}
+	s.batcher = newBatcher(config.limits(), export)
+	return s, nil
+}
+
+// rawMessage is an already encoded protobuf message.
+type rawMessage []byte
+
+// rawCodec passes rawMessages to and from gRPC without any further encoding.
+// It is named "proto" so the content type matches what OTLP servers expect.
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(*rawMessage)
+	if !ok {
+		return nil, fmt.Errorf("rawCodec can't marshal %T", v)
+	}
+	return *m, nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(*rawMessage)
+	if !ok {
+		return fmt.Errorf("rawCodec can't unmarshal into %T", v)
+	}
+	*m = append((*m)[:0], data...)
+	return nil
+}
+
+func (rawCodec) Name() string { return "proto" }
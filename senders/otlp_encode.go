@@ -0,0 +1,288 @@
+package senders
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/honeycombio/libhoney-go/transmission"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Field numbers from the OTLP trace protobuf definitions
+// (opentelemetry/proto/collector/trace/v1 and opentelemetry/proto/trace/v1).
+// They are encoded by hand to avoid depending on generated code.
+const (
+	exportRequestResourceSpans protowire.Number = 1
+
+	resourceSpansResource   protowire.Number = 1
+	resourceSpansScopeSpans protowire.Number = 2
+
+	resourceAttributes protowire.Number = 1
+
+	scopeSpansScope protowire.Number = 1
+	scopeSpansSpans protowire.Number = 2
+
+	scopeName    protowire.Number = 1
+	scopeVersion protowire.Number = 2
+
+	spanTraceID      protowire.Number = 1
+	spanSpanID       protowire.Number = 2
+	spanParentSpanID protowire.Number = 4
+	spanName         protowire.Number = 5
+	spanStartTime    protowire.Number = 7
+	spanEndTime      protowire.Number = 8
+	spanAttributes   protowire.Number = 9
+	spanStatus       protowire.Number = 15
+
+	statusMessage protowire.Number = 2
+	statusCode    protowire.Number = 3
+
+	keyValueKey   protowire.Number = 1
+	keyValueValue protowire.Number = 2
+
+	anyValueString protowire.Number = 1
+	anyValueBool   protowire.Number = 2
+	anyValueInt    protowire.Number = 3
+	anyValueDouble protowire.Number = 4
+)
+
+// statusCodeError is the OTLP status code for failed spans.
+const statusCodeError = 2
+
+// scopeNameBeeline is the instrumentation scope reported for all spans.
+const scopeNameBeeline = "beeline-go"
+
+// Beeline fields that become parts of the OTLP span rather than attributes.
+const (
+	fieldTraceID    = "trace.trace_id"
+	fieldSpanID     = "trace.span_id"
+	fieldParentID   = "trace.parent_id"
+	fieldName       = "name"
+	fieldDurationMs = "duration_ms"
+	fieldError      = "error"
+)
+
+// serviceNameFields are checked in order to find the service name of an event.
+var serviceNameFields = []string{"service.name", "service_name"}
+
+// encodeExportRequest encodes events as an OTLP ExportTraceServiceRequest.
+// Events are grouped into one resource per service name. Events that aren't
+// part of a trace are sent as single-span traces.
+func encodeExportRequest(events []*transmission.Event) []byte {
+	var services []string
+	byService := make(map[string][]*transmission.Event)
+	for _, ev := range events {
+		service := serviceName(ev.Data)
+		if _, ok := byService[service]; !ok {
+			services = append(services, service)
+		}
+		byService[service] = append(byService[service], ev)
+	}
+
+	var req []byte
+	for _, service := range services {
+		var rs []byte
+		var resource []byte
+		if service != "" {
+			resource = appendMessage(resource, resourceAttributes, encodeKeyValue("service.name", service))
+		}
+		rs = appendMessage(rs, resourceSpansResource, resource)
+
+		evs := byService[service]
+		var scope []byte
+		scope = appendString(scope, scopeName, scopeNameBeeline)
+		if v, ok := evs[0].Data["meta.beeline_version"].(string); ok {
+			scope = appendString(scope, scopeVersion, v)
+		}
+		var ss []byte
+		ss = appendMessage(ss, scopeSpansScope, scope)
+		for _, ev := range evs {
+			ss = appendMessage(ss, scopeSpansSpans, encodeSpan(ev))
+		}
+		rs = appendMessage(rs, resourceSpansScopeSpans, ss)
+		req = appendMessage(req, exportRequestResourceSpans, rs)
+	}
+	return req
+}
+
+// serviceName returns the service name recorded in data, if any.
+func serviceName(data map[string]interface{}) string {
+	for _, field := range serviceNameFields {
+		if s, ok := data[field].(string); ok && s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// encodeSpan encodes a single event as an OTLP Span.
+func encodeSpan(ev *transmission.Event) []byte {
+	var b []byte
+	traceID := idBytes(ev.Data[fieldTraceID], 16)
+	spanID := idBytes(ev.Data[fieldSpanID], 8)
+	if traceID == nil {
+		traceID = randomID(16)
+	}
+	if spanID == nil {
+		spanID = randomID(8)
+	}
+	b = appendBytes(b, spanTraceID, traceID)
+	b = appendBytes(b, spanSpanID, spanID)
+	if parentID := idBytes(ev.Data[fieldParentID], 8); parentID != nil {
+		b = appendBytes(b, spanParentSpanID, parentID)
+	}
+	if name, ok := ev.Data[fieldName].(string); ok {
+		b = appendString(b, spanName, name)
+	}
+
+	start := ev.Timestamp
+	if start.IsZero() {
+		start = time.Now()
+	}
+	end := start
+	if ms, ok := toFloat(ev.Data[fieldDurationMs]); ok && ms > 0 {
+		end = start.Add(time.Duration(ms * float64(time.Millisecond)))
+	}
+	b = appendFixed64(b, spanStartTime, uint64(start.UnixNano()))
+	b = appendFixed64(b, spanEndTime, uint64(end.UnixNano()))
+
+	for k, v := range ev.Data {
+		switch k {
+		case fieldTraceID, fieldSpanID, fieldParentID, fieldName, fieldDurationMs:
+			continue
+		}
+		if v == nil {
+			continue
+		}
+		b = appendMessage(b, spanAttributes, encodeKeyValue(k, v))
+	}
+
+	if errVal, ok := ev.Data[fieldError]; ok && errVal != nil {
+		var status []byte
+		status = appendString(status, statusMessage, fmt.Sprint(errVal))
+		status = protowire.AppendTag(status, statusCode, protowire.VarintType)
+		status = protowire.AppendVarint(status, statusCodeError)
+		b = appendMessage(b, spanStatus, status)
+	}
+	return b
+}
+
+// encodeKeyValue encodes an OTLP KeyValue. Values that aren't strings,
+// booleans, or numbers are encoded as strings, using JSON where possible.
+func encodeKeyValue(key string, val interface{}) []byte {
+	var av []byte
+	switch v := val.(type) {
+	case string:
+		av = appendString(av, anyValueString, v)
+	case bool:
+		av = protowire.AppendTag(av, anyValueBool, protowire.VarintType)
+		av = protowire.AppendVarint(av, protowire.EncodeBool(v))
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		av = protowire.AppendTag(av, anyValueInt, protowire.VarintType)
+		av = protowire.AppendVarint(av, uint64(toInt(v)))
+	case float32:
+		av = appendFixed64(av, anyValueDouble, math.Float64bits(float64(v)))
+	case float64:
+		av = appendFixed64(av, anyValueDouble, math.Float64bits(v))
+	case error:
+		av = appendString(av, anyValueString, v.Error())
+	case fmt.Stringer:
+		av = appendString(av, anyValueString, v.String())
+	default:
+		s := fmt.Sprint(v)
+		if j, err := json.Marshal(v); err == nil {
+			s = string(j)
+		}
+		av = appendString(av, anyValueString, s)
+	}
+	var kv []byte
+	kv = appendString(kv, keyValueKey, key)
+	kv = appendMessage(kv, keyValueValue, av)
+	return kv
+}
+
+// idBytes converts a beeline trace or span ID into an OTLP ID of n bytes. IDs
+// that are already hex of the right length (including UUIDs for trace IDs)
+// are decoded; any other ID is hashed so that the same beeline ID always maps
+// to the same OTLP ID. It returns nil if there is no ID.
+func idBytes(val interface{}, n int) []byte {
+	id, ok := val.(string)
+	if !ok || id == "" {
+		return nil
+	}
+	if b, err := hex.DecodeString(strings.Replace(id, "-", "", -1)); err == nil && len(b) == n {
+		return b
+	}
+	sum := sha256.Sum256([]byte(id))
+	return sum[:n]
+}
+
+// randomID returns n random bytes for use as an ID.
+func randomID(n int) []byte {
+	b := make([]byte, n)
+	rand.Read(b)
+	return b
+}
+
+func toInt(val interface{}) int64 {
+	switch v := val.(type) {
+	case int:
+		return int64(v)
+	case int8:
+		return int64(v)
+	case int16:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case int64:
+		return v
+	case uint:
+		return int64(v)
+	case uint8:
+		return int64(v)
+	case uint16:
+		return int64(v)
+	case uint32:
+		return int64(v)
+	case uint64:
+		return int64(v)
+	}
+	return 0
+}
+
+func toFloat(val interface{}) (float64, bool) {
+	switch v := val.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return float64(toInt(v)), true
+	}
+	return 0, false
+}
+
+func appendMessage(b []byte, num protowire.Number, msg []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, msg)
+}
+
+func appendBytes(b []byte, num protowire.Number, v []byte) []byte {
+	return appendMessage(b, num, v)
+}
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendFixed64(b []byte, num protowire.Number, v uint64) []byte {
+	b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, v)
+}
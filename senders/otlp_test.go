@@ -0,0 +1,305 @@
+package senders
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/honeycombio/libhoney-go/transmission"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// fields decodes a protobuf message into its fields by number. Varint and
+// fixed64 values are returned as uint64, length-delimited ones as []byte.
+func fields(t *testing.T, b []byte) map[protowire.Number][]interface{} {
+	f := make(map[protowire.Number][]interface{})
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		assert.True(t, n > 0, "invalid tag")
+		b = b[n:]
+		var v interface{}
+		switch typ {
+		case protowire.VarintType:
+			v, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed64Type:
+			v, n = protowire.ConsumeFixed64(b)
+		case protowire.BytesType:
+			v, n = protowire.ConsumeBytes(b)
+		default:
+			t.Fatalf("unexpected wire type %v", typ)
+		}
+		assert.True(t, n > 0, "invalid value")
+		b = b[n:]
+		f[num] = append(f[num], v)
+	}
+	return f
+}
+
+// decodedSpan holds the parts of an encoded span checked by the tests.
+type decodedSpan struct {
+	service    string
+	traceID    string
+	spanID     string
+	parentID   string
+	name       string
+	durationNs uint64
+	attributes map[string]interface{}
+	errored    bool
+}
+
+// decodeSpans decodes an ExportTraceServiceRequest.
+func decodeSpans(t *testing.T, req []byte) []decodedSpan {
+	var spans []decodedSpan
+	for _, rs := range fields(t, req)[exportRequestResourceSpans] {
+		rsf := fields(t, rs.([]byte))
+		var service string
+		for _, res := range rsf[resourceSpansResource] {
+			for _, kv := range fields(t, res.([]byte))[resourceAttributes] {
+				k, v := decodeKeyValue(t, kv.([]byte))
+				if k == "service.name" {
+					service = v.(string)
+				}
+			}
+		}
+		for _, ss := range rsf[resourceSpansScopeSpans] {
+			for _, sp := range fields(t, ss.([]byte))[scopeSpansSpans] {
+				sf := fields(t, sp.([]byte))
+				span := decodedSpan{
+					service:    service,
+					traceID:    hex.EncodeToString(sf[spanTraceID][0].([]byte)),
+					spanID:     hex.EncodeToString(sf[spanSpanID][0].([]byte)),
+					attributes: make(map[string]interface{}),
+					errored:    len(sf[spanStatus]) > 0,
+				}
+				if p := sf[spanParentSpanID]; len(p) > 0 {
+					span.parentID = hex.EncodeToString(p[0].([]byte))
+				}
+				if n := sf[spanName]; len(n) > 0 {
+					span.name = string(n[0].([]byte))
+				}
+				span.durationNs = sf[spanEndTime][0].(uint64) - sf[spanStartTime][0].(uint64)
+				for _, kv := range sf[spanAttributes] {
+					k, v := decodeKeyValue(t, kv.([]byte))
+					span.attributes[k] = v
+				}
+				spans = append(spans, span)
+			}
+		}
+	}
+	return spans
+}
+
+func decodeKeyValue(t *testing.T, kv []byte) (string, interface{}) {
+	f := fields(t, kv)
+	key := string(f[keyValueKey][0].([]byte))
+	av := fields(t, f[keyValueValue][0].([]byte))
+	switch {
+	case len(av[anyValueString]) > 0:
+		return key, string(av[anyValueString][0].([]byte))
+	case len(av[anyValueBool]) > 0:
+		return key, protowire.DecodeBool(av[anyValueBool][0].(uint64))
+	case len(av[anyValueInt]) > 0:
+		return key, int64(av[anyValueInt][0].(uint64))
+	}
+	return key, nil
+}
+
+func testEvents() []*transmission.Event {
+	ts := time.Now()
+	return []*transmission.Event{
+		{
+			APIKey:    "key",
+			Dataset:   "myapp",
+			Timestamp: ts,
+			Data: map[string]interface{}{
+				"trace.trace_id": "0af7651916cd43dd8448eb211c80319c",
+				"trace.span_id":  "b7ad6b7169203331",
+				"name":           "root",
+				"duration_ms":    2.5,
+				"service_name":   "myservice",
+				"app.count":      3,
+				"app.ok":         true,
+			},
+		},
+		{
+			APIKey:    "key",
+			Dataset:   "myapp",
+			Timestamp: ts,
+			Data: map[string]interface{}{
+				"trace.trace_id":  "0af7651916cd43dd8448eb211c80319c",
+				"trace.span_id":   "a-span-id-that-isnt-hex",
+				"trace.parent_id": "b7ad6b7169203331",
+				"name":            "child",
+				"service_name":    "myservice",
+				"error":           "oops",
+			},
+		},
+	}
+}
+
+func TestEncodeExportRequest(t *testing.T) {
+	spans := decodeSpans(t, encodeExportRequest(testEvents()))
+	assert.Equal(t, 2, len(spans))
+
+	root := spans[0]
+	assert.Equal(t, "myservice", root.service, "the service name should be a resource attribute")
+	assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", root.traceID)
+	assert.Equal(t, "b7ad6b7169203331", root.spanID)
+	assert.Equal(t, "", root.parentID)
+	assert.Equal(t, "root", root.name)
+	assert.Equal(t, uint64(2500000), root.durationNs, "duration_ms should set the end time")
+	assert.Equal(t, int64(3), root.attributes["app.count"])
+	assert.Equal(t, true, root.attributes["app.ok"])
+	_, ok := root.attributes["trace.trace_id"]
+	assert.False(t, ok, "trace fields should not be repeated as attributes")
+	assert.False(t, root.errored)
+
+	child := spans[1]
+	assert.Equal(t, root.traceID, child.traceID)
+	assert.Equal(t, root.spanID, child.parentID, "parent IDs should match the parent's span ID")
+	assert.Equal(t, 16, len(child.spanID), "non-hex span IDs should be hashed to 8 bytes")
+	assert.True(t, child.errored, "the error field should set the span status")
+
+	again := decodeSpans(t, encodeExportRequest(testEvents()))
+	assert.Equal(t, child.spanID, again[1].spanID, "hashed IDs should be stable")
+}
+
+func TestOTLPHTTPSender(t *testing.T) {
+	var lock sync.Mutex
+	var spans []decodedSpan
+	var headers http.Header
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		lock.Lock()
+		defer lock.Unlock()
+		spans = append(spans, decodeSpans(t, body)...)
+		headers = r.Header
+		path = r.URL.Path
+	}))
+	defer server.Close()
+
+	s, err := NewOTLPHTTPSender(OTLPConfig{
+		Endpoint: server.URL,
+		Headers:  map[string]string{"X-Extra": "extra"},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, s.Start())
+	for _, ev := range testEvents() {
+		s.Add(ev)
+	}
+	assert.NoError(t, s.Stop())
+
+	lock.Lock()
+	assert.Equal(t, 2, len(spans), "stopping should send queued events")
+	assert.Equal(t, "/v1/traces", path)
+	assert.Equal(t, "application/x-protobuf", headers.Get("Content-Type"))
+	assert.Equal(t, "key", headers.Get(headerTeam), "the write key should be sent as a header")
+	assert.Equal(t, "myapp", headers.Get(headerDataset))
+	assert.Equal(t, "extra", headers.Get("X-Extra"))
+	lock.Unlock()
+
+	resp := <-s.TxResponses()
+	assert.NoError(t, resp.Err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// the sender can be restarted, as libhoney does to flush it
+	assert.NoError(t, s.Start())
+	s.Add(testEvents()[0])
+	assert.NoError(t, s.Close())
+	lock.Lock()
+	assert.Equal(t, 3, len(spans))
+	lock.Unlock()
+
+	_, err = NewOTLPHTTPSender(OTLPConfig{Endpoint: "localhost:4318"})
+	assert.Error(t, err, "endpoints without a scheme should be rejected")
+}
+
+// serverCodec is the server side of rawCodec, using the older interface
+// accepted by grpc.CustomCodec.
+type serverCodec struct{ rawCodec }
+
+func (serverCodec) String() string { return "proto" }
+
+func TestOTLPGRPCSender(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	var lock sync.Mutex
+	var spans []decodedSpan
+	var method string
+	var md metadata.MD
+	server := grpc.NewServer(
+		grpc.CustomCodec(serverCodec{}),
+		grpc.UnknownServiceHandler(func(srv interface{}, stream grpc.ServerStream) error {
+			var req rawMessage
+			if err := stream.RecvMsg(&req); err != nil {
+				return err
+			}
+			lock.Lock()
+			spans = append(spans, decodeSpans(t, req)...)
+			method, _ = grpc.MethodFromServerStream(stream)
+			md, _ = metadata.FromIncomingContext(stream.Context())
+			lock.Unlock()
+			return stream.SendMsg(&rawMessage{})
+		}),
+	)
+	go server.Serve(lis)
+	defer server.Stop()
+
+	s, err := NewOTLPGRPCSender(OTLPConfig{Endpoint: lis.Addr().String(), Insecure: true})
+	assert.NoError(t, err)
+	assert.NoError(t, s.Start())
+	for _, ev := range testEvents() {
+		s.Add(ev)
+	}
+	assert.NoError(t, s.Close())
+
+	resp := <-s.TxResponses()
+	assert.NoError(t, resp.Err)
+
+	lock.Lock()
+	defer lock.Unlock()
+	assert.Equal(t, 2, len(spans))
+	assert.Equal(t, otlpExportMethod, method)
+	assert.Equal(t, []string{"key"}, md.Get(headerTeam), "the write key should be sent as metadata")
+	assert.Equal(t, []string{"myapp"}, md.Get(headerDataset))
+
+	_, err = NewOTLPGRPCSender(OTLPConfig{Endpoint: "https://api.honeycomb.io"})
+	assert.Error(t, err, "URLs should be rejected as gRPC endpoints")
+}
+
+func TestBatcherOverflow(t *testing.T) {
+	block := make(chan struct{})
+	limits := batchLimits{maxBatchSize: 1, maxConcurrentBatches: 1, batchTimeout: time.Millisecond, pendingWorkCapacity: 1}
+	b := newBatcher(limits, func(batchKey, []*transmission.Event) (int, []byte, error) {
+		<-block
+		return http.StatusOK, nil, nil
+	})
+	b.start()
+	for i := 0; i < 10; i++ {
+		b.add(&transmission.Event{Metadata: i})
+	}
+	close(block)
+	b.stop()
+
+	var overflowed int
+	for len(b.responses) > 0 {
+		if r := <-b.responses; r.Err == errQueueOverflow {
+			overflowed++
+		}
+	}
+	assert.True(t, overflowed > 0, "events beyond the queue capacity should be dropped")
+
+	b.add(&transmission.Event{})
+	r := <-b.responses
+	assert.Equal(t, errStopped, r.Err, "events added while stopped should be dropped")
+}
@@ -0,0 +1,290 @@
+// Package senders contains implementations of libhoney's transmission.Sender
+// that can be given to the beeline as Config.Transmission to change where
+// events go.
+//
+// Summary
+//
+// By default the beeline sends events to Honeycomb over HTTPS using libhoney's
+// transmission.Honeycomb; pass a configured &transmission.Honeycomb{} to
+// control it directly. This package adds senders that export spans as
+// OpenTelemetry (OTLP) traces over gRPC or HTTP, one that appends events to a
+// file as newline-delimited JSON, and one that prints traces as trees for
+// reading during development, which Config.DevMode uses. Any other type implementing
+// transmission.Sender may be used as well.
+//
+//   tx, err := senders.NewOTLPGRPCSender(senders.OTLPConfig{
+//     Endpoint: "localhost:4317",
+//     Insecure: true,
+//   })
+//   ...
+//   beeline.Init(beeline.Config{
+//     WriteKey:     "abcabc123123defdef456456",
+//     ServiceName:  "myapp",
+//     Transmission: tx,
+//   })
+package senders
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	libhoney "github.com/honeycombio/libhoney-go"
+	"github.com/honeycombio/libhoney-go/transmission"
+)
+
+// errQueueOverflow is returned in the response for events dropped because the
+// pending work queue is full.
+var errQueueOverflow = errors.New("event dropped; queue overflow")
+
+// errStopped is returned in the response for events added while the sender is
+// stopped.
+var errStopped = errors.New("event dropped; sender is stopped")
+
+// defaultResponseQueueSize is the number of responses that are buffered before
+// new responses are dropped.
+const defaultResponseQueueSize = 2 * libhoney.DefaultPendingWorkCapacity
+
+// exportFunc sends a batch of events that all share the same write key,
+// dataset, and API host. It returns the status code and body of the response
+// if there was one.
+type exportFunc func(key batchKey, events []*transmission.Event) (int, []byte, error)
+
+// batchKey identifies events that can be sent in the same request.
+type batchKey struct {
+	apiHost string
+	apiKey  string
+	dataset string
+}
+
+// defaultMaxBatchBytes is the default limit on the estimated size of a
+// batch, which keeps requests well inside the 5MB Honeycomb accepts and the
+// 4MB gRPC allows by default.
+const defaultMaxBatchBytes = 2 << 20
+
+// batchLimits configures a batcher. Zero values are replaced with libhoney's
+// defaults, or defaultMaxBatchBytes.
+type batchLimits struct {
+	maxBatchSize         uint
+	maxBatchBytes        uint
+	maxConcurrentBatches uint
+	batchTimeout         time.Duration
+	pendingWorkCapacity  uint
+}
+
+// batcher queues events and hands them to export in batches. A batch is
+// exported as soon as it holds maxBatchSize events or about maxBatchBytes of
+// them, or batchTimeout after its first event arrived, so under high event
+// rates batches fill and are sent long before the timeout, while quiet
+// periods still send promptly. Up to maxConcurrentBatches batches are
+// exported at once; while they all are, events wait in the queue and are taken
+// into full batches as soon as an export finishes. A batcher may be stopped
+// and started again, which is how libhoney flushes a client.
+type batcher struct {
+	maxBatchSize         int
+	maxBatchBytes        int
+	maxConcurrentBatches int
+	batchTimeout         time.Duration
+	pendingWorkCapacity  int
+	export               exportFunc
+
+	// lock guards running, events, and done; events may only be written
+	// while it is held
+	lock    sync.RWMutex
+	running bool
+	events  chan *transmission.Event
+	done    chan struct{}
+
+	responses chan transmission.Response
+}
+
+// newBatcher creates a batcher, filling in the defaults for any zero limits.
+func newBatcher(limits batchLimits, export exportFunc) *batcher {
+	if limits.maxBatchSize == 0 {
+		limits.maxBatchSize = libhoney.DefaultMaxBatchSize
+	}
+	if limits.maxBatchBytes == 0 {
+		limits.maxBatchBytes = defaultMaxBatchBytes
+	}
+	if limits.maxConcurrentBatches == 0 {
+		limits.maxConcurrentBatches = libhoney.DefaultMaxConcurrentBatches
+	}
+	if limits.batchTimeout == 0 {
+		limits.batchTimeout = libhoney.DefaultBatchTimeout
+	}
+	if limits.pendingWorkCapacity == 0 {
+		limits.pendingWorkCapacity = libhoney.DefaultPendingWorkCapacity
+	}
+	return &batcher{
+		maxBatchSize:         int(limits.maxBatchSize),
+		maxBatchBytes:        int(limits.maxBatchBytes),
+		maxConcurrentBatches: int(limits.maxConcurrentBatches),
+		batchTimeout:         limits.batchTimeout,
+		pendingWorkCapacity:  int(limits.pendingWorkCapacity),
+		export:               export,
+		responses:            make(chan transmission.Response, defaultResponseQueueSize),
+	}
+}
+
+// start begins accepting events. It does nothing if the batcher is running.
+func (b *batcher) start() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.running {
+		return
+	}
+	b.running = true
+	b.events = make(chan *transmission.Event, b.pendingWorkCapacity)
+	b.done = make(chan struct{})
+	go b.run(b.events, b.done)
+}
+
+// stop stops accepting events and waits for queued events to be exported.
+func (b *batcher) stop() {
+	b.lock.Lock()
+	if !b.running {
+		b.lock.Unlock()
+		return
+	}
+	b.running = false
+	close(b.events)
+	done := b.done
+	b.lock.Unlock()
+	<-done
+}
+
+// add queues ev without blocking. Events that don't fit in the queue, or that
+// are added while the batcher is stopped, are dropped with an error response.
+func (b *batcher) add(ev *transmission.Event) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	if !b.running {
+		b.sendResponse(transmission.Response{Err: errStopped, Metadata: ev.Metadata})
+		return
+	}
+	select {
+	case b.events <- ev:
+	default:
+		b.sendResponse(transmission.Response{Err: errQueueOverflow, Metadata: ev.Metadata})
+	}
+}
+
+// sendResponse queues r without blocking and reports whether it was dropped.
+func (b *batcher) sendResponse(r transmission.Response) bool {
+	select {
+	case b.responses <- r:
+		return false
+	default:
+		return true
+	}
+}
+
+func (b *batcher) run(events chan *transmission.Event, done chan struct{}) {
+	defer close(done)
+	// exporting holds a token for each batch being exported
+	exporting := make(chan struct{}, b.maxConcurrentBatches)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	var batch []*transmission.Event
+	var batchBytes int
+	var timer *time.Timer
+	var timeout <-chan time.Time
+	send := func() {
+		if timer != nil {
+			timer.Stop()
+			timer, timeout = nil, nil
+		}
+		if len(batch) == 0 {
+			return
+		}
+		// wait for an export to finish if as many as are allowed are
+		// running, leaving events to queue up in the meantime
+		exporting <- struct{}{}
+		wg.Add(1)
+		go func(batch []*transmission.Event) {
+			defer wg.Done()
+			b.flush(batch)
+			<-exporting
+		}(batch)
+		batch, batchBytes = nil, 0
+	}
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				send()
+				return
+			}
+			size := eventSize(ev)
+			if len(batch) > 0 && batchBytes+size > b.maxBatchBytes {
+				send()
+			}
+			if len(batch) == 0 {
+				timer = time.NewTimer(b.batchTimeout)
+				timeout = timer.C
+			}
+			batch = append(batch, ev)
+			batchBytes += size
+			if len(batch) >= b.maxBatchSize || batchBytes >= b.maxBatchBytes {
+				send()
+			}
+		case <-timeout:
+			timer, timeout = nil, nil
+			send()
+		}
+	}
+}
+
+// eventSize estimates the size of ev once encoded, from the lengths of its
+// field names and values.
+func eventSize(ev *transmission.Event) int {
+	// the timestamp, sample rate, and punctuation
+	size := 64
+	for k, v := range ev.Data {
+		size += len(k) + 4
+		switch v := v.(type) {
+		case string:
+			size += len(v) + 2
+		case []byte:
+			size += len(v)
+		case bool:
+			size += 5
+		case nil:
+			size += 4
+		default:
+			// numbers, and a guess for anything else
+			size += 16
+		}
+	}
+	return size
+}
+
+// flush exports batch, splitting it into one request per destination, and
+// sends a response for every event.
+func (b *batcher) flush(batch []*transmission.Event) {
+	var keys []batchKey
+	groups := make(map[batchKey][]*transmission.Event)
+	for _, ev := range batch {
+		key := batchKey{apiHost: ev.APIHost, apiKey: ev.APIKey, dataset: ev.Dataset}
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], ev)
+	}
+	for _, key := range keys {
+		events := groups[key]
+		start := time.Now()
+		status, body, err := b.export(key, events)
+		dur := time.Since(start)
+		for _, ev := range events {
+			b.sendResponse(transmission.Response{
+				Err:        err,
+				StatusCode: status,
+				Body:       body,
+				Duration:   dur,
+				Metadata:   ev.Metadata,
+			})
+		}
+	}
+}
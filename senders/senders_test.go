@@ -0,0 +1,114 @@
+package senders
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/honeycombio/libhoney-go/transmission"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatcherBatchBytes(t *testing.T) {
+	var lock sync.Mutex
+	var sizes []int
+	b := newBatcher(batchLimits{maxBatchBytes: 5000, batchTimeout: time.Hour}, func(_ batchKey, events []*transmission.Event) (int, []byte, error) {
+		lock.Lock()
+		sizes = append(sizes, len(events))
+		lock.Unlock()
+		return http.StatusOK, nil, nil
+	})
+	b.start()
+	big := strings.Repeat("x", 1000)
+	for i := 0; i < 10; i++ {
+		b.add(&transmission.Event{Data: map[string]interface{}{"body": big}})
+	}
+	b.stop()
+	// each event is estimated at a little over 1000 bytes
+	assert.ElementsMatch(t, []int{4, 4, 2}, sizes, "batches should be sent once they reach the byte limit")
+}
+
+func TestBatcherTimeout(t *testing.T) {
+	exported := make(chan int, 1)
+	b := newBatcher(batchLimits{batchTimeout: 10 * time.Millisecond}, func(_ batchKey, events []*transmission.Event) (int, []byte, error) {
+		exported <- len(events)
+		return http.StatusOK, nil, nil
+	})
+	b.start()
+	defer b.stop()
+	b.add(&transmission.Event{})
+	b.add(&transmission.Event{})
+	select {
+	case n := <-exported:
+		assert.Equal(t, 2, n)
+	case <-time.After(time.Second):
+		t.Error("a batch that isn't full should be sent after the timeout")
+	}
+}
+
+func TestBatcherConcurrentBatches(t *testing.T) {
+	var running, most int32
+	b := newBatcher(batchLimits{maxBatchSize: 1, maxConcurrentBatches: 3}, func(batchKey, []*transmission.Event) (int, []byte, error) {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			m := atomic.LoadInt32(&most)
+			if n <= m || atomic.CompareAndSwapInt32(&most, m, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return http.StatusOK, nil, nil
+	})
+	b.start()
+	for i := 0; i < 20; i++ {
+		b.add(&transmission.Event{Metadata: i})
+	}
+	b.stop()
+	assert.Equal(t, int32(3), atomic.LoadInt32(&most), "batches should be exported concurrently, up to the limit")
+	assert.Equal(t, 20, len(b.responses), "stop should wait for every export")
+}
+
+// BenchmarkBatcher measures how many events a second the batcher sustains
+// when each export takes a millisecond, as a request to a nearby collector
+// might.
+func BenchmarkBatcher(b *testing.B) {
+	for _, bench := range []struct {
+		name       string
+		concurrent uint
+	}{
+		{"serial", 1},
+		{"concurrent", 0},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			bt := newBatcher(batchLimits{
+				maxConcurrentBatches: bench.concurrent,
+				pendingWorkCapacity:  uint(b.N) + 1,
+			}, func(batchKey, []*transmission.Event) (int, []byte, error) {
+				time.Sleep(time.Millisecond)
+				return http.StatusOK, nil, nil
+			})
+			// drain responses so they don't fill up
+			done := make(chan struct{})
+			go func() {
+				for range bt.responses {
+				}
+				close(done)
+			}()
+			ev := &transmission.Event{Data: map[string]interface{}{"name": "span", "duration_ms": 1.5}}
+			bt.start()
+			b.ResetTimer()
+			start := time.Now()
+			for i := 0; i < b.N; i++ {
+				bt.add(ev)
+			}
+			bt.stop()
+			b.ReportMetric(float64(b.N)/time.Since(start).Seconds(), "events/s")
+			close(bt.responses)
+			<-done
+		})
+	}
+}
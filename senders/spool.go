@@ -0,0 +1,617 @@
+package senders
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/honeycombio/libhoney-go/transmission"
+)
+
+// ErrSpooled is returned in the response for an event that could not be sent
+// and was saved to disk to be retried later.
+var ErrSpooled = errors.New("event could not be sent and was spooled to disk")
+
+// errSpoolFull is returned in the response for an event that could not be
+// sent or spooled because the spool is full.
+var errSpoolFull = errors.New("event dropped; spool is full")
+
+const (
+	defaultSpoolMaxBytes         = 100 * 1024 * 1024
+	defaultSpoolSegmentBytes     = 1024 * 1024
+	defaultSpoolFailureThreshold = 3
+	defaultSpoolMinBackoff       = time.Second
+	defaultSpoolMaxBackoff       = time.Minute
+	defaultSpoolReplayBatchSize  = 100
+	// replayResponseTimeout bounds the wait for responses to a batch of
+	// replayed events, in case the wrapped sender drops some of them
+	replayResponseTimeout = 30 * time.Second
+	// spoolSuffix is the extension of spool segment files
+	spoolSuffix = ".spool"
+)
+
+// SpoolConfig configures a SpoolingSender.
+type SpoolConfig struct {
+	// Dir is the directory in which spooled events are stored. It is created
+	// if it doesn't exist. Events left in it by a previous process are sent
+	// when the sender starts. Required.
+	Dir string
+	// MaxBytes limits the total size of the spool. Events that would make it
+	// larger are dropped. default: 100MB
+	MaxBytes int64
+	// SegmentBytes is the size at which a new spool file is started. Spooled
+	// events are replayed one file at a time. default: 1MB
+	SegmentBytes int64
+	// FailureThreshold is the number of consecutive failed sends after which
+	// new events are written straight to the spool until a send succeeds.
+	// default: 3
+	FailureThreshold int
+	// MinBackoff and MaxBackoff bound the time between attempts to replay
+	// the spool while sends are failing. The delay doubles after each failed
+	// attempt. defaults: 1s and 1m
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// ReplayBatchSize is the most replayed events given to the wrapped sender
+	// at once. The next batch is only given to it once every event in the
+	// last one has a response, so replaying a large spool doesn't overflow
+	// its queue. default: 100
+	ReplayBatchSize int
+}
+
+// SpoolingSender wraps another sender and saves events it fails to send to a
+// bounded on-disk spool, replaying them with backoff once sends succeed
+// again. Brief outages or network problems then delay events instead of
+// losing them.
+//
+// Sends fail when the wrapped sender returns an error, a 429, or a 5xx
+// response. Each failed event gets a response with ErrSpooled. Once
+// FailureThreshold sends in a row have failed, new events are spooled without
+// being attempted (also with an ErrSpooled response) and the spool is retried
+// one file at a time with exponential backoff; the first successful send
+// resumes normal operation and the rest of the spool is replayed, in batches
+// of ReplayBatchSize that each wait for the responses to the last. Replayed
+// events don't get responses, since their Metadata can't be saved to disk.
+// A spool file is only removed once all of its events have been sent or
+// spooled again, so events are delivered at least once: if the process exits
+// while a file is being replayed, some of its events may be sent twice.
+//
+// Spool files contain each event's write key and are created readable only by
+// the current user.
+type SpoolingSender struct {
+	inner  transmission.Sender
+	config SpoolConfig
+
+	// runLock guards running; the wrapped sender may only be given replayed
+	// events while it is running
+	runLock sync.RWMutex
+	running bool
+
+	// lock guards everything below
+	lock           sync.Mutex
+	innerResponses chan transmission.Response
+	failures       int
+	outage         bool
+	segment        *os.File
+	segmentBytes   int64
+	spooledBytes   int64
+	lastSeq        int64
+	// replaying holds the spool files whose events are being replayed
+	replaying map[string]bool
+
+	responses chan transmission.Response
+	// wake makes the replay loop run immediately, when sends recover
+	wake chan struct{}
+	// done stops the replay loop, which closes replayDone when it exits
+	done       chan struct{}
+	replayDone chan struct{}
+	startOnce  sync.Once
+	closeOnce  sync.Once
+}
+
+// spoolMetadata replaces the Metadata of events passed to the wrapped sender
+// so failed events can be spooled.
+type spoolMetadata struct {
+	metadata interface{}
+	ev       *transmission.Event
+	// batch is the spool file a replayed event came from
+	batch *replayBatch
+}
+
+// replayBatch tracks the events from a spool file that are being replayed.
+// pending is guarded by the sender's lock.
+type replayBatch struct {
+	path    string
+	size    int64
+	pending int
+	// answered is signaled each time a replayed event gets a response
+	answered chan struct{}
+}
+
+// spooledEvent is the representation of an event in a spool file.
+type spooledEvent struct {
+	APIKey     string                 `json:"api_key,omitempty"`
+	APIHost    string                 `json:"api_host,omitempty"`
+	Dataset    string                 `json:"dataset,omitempty"`
+	SampleRate uint                   `json:"samplerate,omitempty"`
+	Timestamp  time.Time              `json:"time"`
+	Data       map[string]interface{} `json:"data"`
+}
+
+// NewSpoolingSender returns a sender that sends events with inner and spools
+// them to config.Dir when sending fails.
+func NewSpoolingSender(inner transmission.Sender, config SpoolConfig) (*SpoolingSender, error) {
+	if config.Dir == "" {
+		return nil, errors.New("a spool directory is required")
+	}
+	if err := os.MkdirAll(config.Dir, 0700); err != nil {
+		return nil, fmt.Errorf("creating spool directory: %v", err)
+	}
+	if config.MaxBytes == 0 {
+		config.MaxBytes = defaultSpoolMaxBytes
+	}
+	if config.SegmentBytes == 0 {
+		config.SegmentBytes = defaultSpoolSegmentBytes
+	}
+	if config.FailureThreshold == 0 {
+		config.FailureThreshold = defaultSpoolFailureThreshold
+	}
+	if config.MinBackoff == 0 {
+		config.MinBackoff = defaultSpoolMinBackoff
+	}
+	if config.MaxBackoff == 0 {
+		config.MaxBackoff = defaultSpoolMaxBackoff
+	}
+	if config.ReplayBatchSize == 0 {
+		config.ReplayBatchSize = defaultSpoolReplayBatchSize
+	}
+	if config.MaxBackoff < config.MinBackoff {
+		config.MaxBackoff = config.MinBackoff
+	}
+	s := &SpoolingSender{
+		inner:      inner,
+		config:     config,
+		responses:  make(chan transmission.Response, defaultResponseQueueSize),
+		wake:       make(chan struct{}, 1),
+		done:       make(chan struct{}),
+		replayDone: make(chan struct{}),
+		replaying:  make(map[string]bool),
+	}
+	segments, err := s.segments()
+	if err != nil {
+		return nil, err
+	}
+	for _, seg := range segments {
+		if info, err := os.Stat(seg); err == nil {
+			s.spooledBytes += info.Size()
+		}
+	}
+	return s, nil
+}
+
+// Add sends ev with the wrapped sender, or spools it if sends are failing.
+func (s *SpoolingSender) Add(ev *transmission.Event) {
+	s.lock.Lock()
+	outage := s.outage
+	s.lock.Unlock()
+	if !outage {
+		s.inner.Add(wrapSpoolEvent(ev, ev.Metadata, nil))
+		return
+	}
+	resp := transmission.Response{Err: ErrSpooled, Metadata: ev.Metadata}
+	if err := s.spool(ev); err != nil {
+		resp.Err = err
+	}
+	s.SendResponse(resp)
+}
+
+// wrapSpoolEvent returns a copy of ev whose Metadata lets a failed send be
+// spooled.
+func wrapSpoolEvent(ev *transmission.Event, metadata interface{}, batch *replayBatch) *transmission.Event {
+	wrapped := *ev
+	wrapped.Metadata = &spoolMetadata{metadata: metadata, ev: ev, batch: batch}
+	return &wrapped
+}
+
+// Start starts the wrapped sender and, the first time it is called, begins
+// replaying any spooled events.
+func (s *SpoolingSender) Start() error {
+	if err := s.inner.Start(); err != nil {
+		return err
+	}
+	s.lock.Lock()
+	// some senders replace their responses channel each time they start
+	if ch := s.inner.TxResponses(); ch != s.innerResponses {
+		s.innerResponses = ch
+		go s.handleResponses(ch)
+	}
+	s.lock.Unlock()
+	s.runLock.Lock()
+	s.running = true
+	s.runLock.Unlock()
+	s.startOnce.Do(func() {
+		go s.replayLoop()
+	})
+	return nil
+}
+
+// Stop stops the wrapped sender, which sends its pending events, and syncs
+// the spool to disk. The sender may be started again.
+func (s *SpoolingSender) Stop() error {
+	s.runLock.Lock()
+	s.running = false
+	s.runLock.Unlock()
+	err := s.inner.Stop()
+	s.lock.Lock()
+	s.closeSegment()
+	s.lock.Unlock()
+	return err
+}
+
+// Close stops the sender and its background work. Events that have not been
+// sent remain in the spool for the next process to send. If the wrapped
+// sender has a Close method, it is called too.
+func (s *SpoolingSender) Close() error {
+	s.closeOnce.Do(func() { close(s.done) })
+	// if the replay loop was never started there is nothing to wait for
+	s.startOnce.Do(func() { close(s.replayDone) })
+	<-s.replayDone
+	err := s.Stop()
+	if c, ok := s.inner.(io.Closer); ok {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	s.lock.Lock()
+	s.closeSegment()
+	s.lock.Unlock()
+	return err
+}
+
+// TxResponses returns the channel of responses to added events.
+func (s *SpoolingSender) TxResponses() chan transmission.Response {
+	return s.responses
+}
+
+// SendResponse queues r without blocking and reports whether it was dropped.
+func (s *SpoolingSender) SendResponse(r transmission.Response) bool {
+	select {
+	case s.responses <- r:
+		return false
+	default:
+		return true
+	}
+}
+
+// retryable reports whether r is a failure that may succeed later. Events
+// deliberately sampled out by a BackpressureSender are not retried.
+func retryable(r transmission.Response) bool {
+	if r.Err == errDegradeDrops {
+		return false
+	}
+	return r.Err != nil || r.StatusCode == 429 || r.StatusCode >= 500
+}
+
+// handleResponses spools failed events from the wrapped sender and passes the
+// other responses on.
+func (s *SpoolingSender) handleResponses(ch chan transmission.Response) {
+	for r := range ch {
+		m, ok := r.Metadata.(*spoolMetadata)
+		if !ok {
+			s.SendResponse(r)
+			continue
+		}
+		r.Metadata = m.metadata
+		if retryable(r) {
+			s.recordFailure()
+			r.Err = ErrSpooled
+			if err := s.spool(m.ev); err != nil {
+				r.Err = err
+			}
+		} else {
+			s.recordSuccess()
+		}
+		if m.batch != nil {
+			s.finishReplay(m.batch)
+		} else {
+			s.SendResponse(r)
+		}
+	}
+}
+
+func (s *SpoolingSender) recordFailure() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.failures++
+	if s.failures >= s.config.FailureThreshold {
+		s.outage = true
+	}
+}
+
+func (s *SpoolingSender) recordSuccess() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.failures = 0
+	if s.outage {
+		s.outage = false
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// replayLoop replays spooled events one segment at a time, backing off while
+// sends are failing.
+func (s *SpoolingSender) replayLoop() {
+	defer close(s.replayDone)
+	backoff := s.config.MinBackoff
+	var delay time.Duration
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.wake:
+		case <-time.After(delay):
+		}
+		s.lock.Lock()
+		outage := s.outage
+		s.lock.Unlock()
+		s.replaySegment()
+		if outage {
+			delay = backoff
+			backoff *= 2
+			if backoff > s.config.MaxBackoff {
+				backoff = s.config.MaxBackoff
+			}
+		} else {
+			// pace replays so they don't overflow the wrapped sender
+			delay = s.config.MinBackoff
+			backoff = s.config.MinBackoff
+		}
+	}
+}
+
+// replaySegment passes the events in the oldest spool file that isn't
+// already being replayed to the wrapped sender, in batches of ReplayBatchSize.
+// The file is removed once every event in it has a response; events that fail
+// again are spooled again, as are those not yet passed on if the batch before
+// them failed or the sender was stopped.
+func (s *SpoolingSender) replaySegment() {
+	s.runLock.RLock()
+	running := s.running
+	s.runLock.RUnlock()
+	if !running {
+		return
+	}
+	s.lock.Lock()
+	if s.spooledBytes == 0 {
+		s.lock.Unlock()
+		return
+	}
+	segments, err := s.segments()
+	var path string
+	for _, seg := range segments {
+		if !s.replaying[seg] {
+			path = seg
+			break
+		}
+	}
+	if err != nil || path == "" {
+		s.lock.Unlock()
+		return
+	}
+	if s.segment != nil && s.segment.Name() == path {
+		s.closeSegment()
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		s.lock.Unlock()
+		return
+	}
+	var events []*transmission.Event
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, int(s.config.SegmentBytes)+bufio.MaxScanTokenSize)
+	for scanner.Scan() {
+		var se spooledEvent
+		if json.Unmarshal(scanner.Bytes(), &se) != nil {
+			// skip lines that were only partly written
+			continue
+		}
+		events = append(events, &transmission.Event{
+			APIKey:     se.APIKey,
+			APIHost:    se.APIHost,
+			Dataset:    se.Dataset,
+			SampleRate: se.SampleRate,
+			Timestamp:  se.Timestamp,
+			Data:       se.Data,
+		})
+	}
+	batch := &replayBatch{
+		path:     path,
+		size:     int64(len(data)),
+		pending:  len(events),
+		answered: make(chan struct{}, 1),
+	}
+	if len(events) == 0 {
+		s.removeSegment(batch)
+		s.lock.Unlock()
+		return
+	}
+	s.replaying[path] = true
+	s.lock.Unlock()
+
+	for start := 0; start < len(events); start += s.config.ReplayBatchSize {
+		end := start + s.config.ReplayBatchSize
+		if end > len(events) {
+			end = len(events)
+		}
+		if !s.replayEvents(batch, events[start:end]) {
+			// try the rest again later
+			for _, ev := range events[start:] {
+				s.spool(ev)
+				s.finishReplay(batch)
+			}
+			return
+		}
+		if !s.awaitReplay(batch, len(events)-end) {
+			return
+		}
+		s.lock.Lock()
+		outage := s.outage
+		s.lock.Unlock()
+		if outage && end < len(events) {
+			for _, ev := range events[end:] {
+				s.spool(ev)
+				s.finishReplay(batch)
+			}
+			return
+		}
+	}
+}
+
+// replayEvents passes events, replayed from batch, to the wrapped sender, and
+// reports whether it could: it can't once the sender has been stopped.
+func (s *SpoolingSender) replayEvents(batch *replayBatch, events []*transmission.Event) bool {
+	s.runLock.RLock()
+	defer s.runLock.RUnlock()
+	if !s.running {
+		return false
+	}
+	for _, ev := range events {
+		s.inner.Add(wrapSpoolEvent(ev, nil, batch))
+	}
+	return true
+}
+
+// awaitReplay waits until there are only unsent events of batch without a
+// response, giving up after replayResponseTimeout, and reports whether it
+// wasn't interrupted by Close.
+func (s *SpoolingSender) awaitReplay(batch *replayBatch, unsent int) bool {
+	timeout := time.NewTimer(replayResponseTimeout)
+	defer timeout.Stop()
+	for {
+		s.lock.Lock()
+		pending := batch.pending
+		s.lock.Unlock()
+		if pending <= unsent {
+			return true
+		}
+		select {
+		case <-batch.answered:
+		case <-timeout.C:
+			return true
+		case <-s.done:
+			return false
+		}
+	}
+}
+
+// finishReplay records that a replayed event has a response, removing its
+// spool file once all of them do.
+func (s *SpoolingSender) finishReplay(batch *replayBatch) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	batch.pending--
+	if batch.pending == 0 {
+		s.removeSegment(batch)
+	}
+	select {
+	case batch.answered <- struct{}{}:
+	default:
+	}
+}
+
+// removeSegment deletes a replayed spool file. The caller must hold s.lock.
+func (s *SpoolingSender) removeSegment(batch *replayBatch) {
+	delete(s.replaying, batch.path)
+	if err := os.Remove(batch.path); err == nil || os.IsNotExist(err) {
+		s.spooledBytes -= batch.size
+	}
+}
+
+// spool appends ev to the current spool file.
+func (s *SpoolingSender) spool(ev *transmission.Event) error {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	line, err := appendSpooledEvent(*buf, ev)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	*buf = line
+	size := int64(len(line))
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.spooledBytes+size > s.config.MaxBytes {
+		return errSpoolFull
+	}
+	if s.segment == nil || s.segmentBytes+size > s.config.SegmentBytes {
+		if err := s.openSegment(); err != nil {
+			return err
+		}
+	}
+	if _, err := s.segment.Write(line); err != nil {
+		return err
+	}
+	s.segmentBytes += size
+	s.spooledBytes += size
+	return nil
+}
+
+// openSegment closes the current spool file and starts a new one. Files are
+// named so they sort in the order they were created. The caller must hold
+// s.lock.
+func (s *SpoolingSender) openSegment() error {
+	s.closeSegment()
+	seq := time.Now().UnixNano()
+	if seq <= s.lastSeq {
+		seq = s.lastSeq + 1
+	}
+	s.lastSeq = seq
+	path := filepath.Join(s.config.Dir, fmt.Sprintf("%020d%s", seq, spoolSuffix))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	s.segment = f
+	s.segmentBytes = 0
+	return nil
+}
+
+// closeSegment syncs and closes the current spool file, if any. The caller
+// must hold s.lock.
+func (s *SpoolingSender) closeSegment() {
+	if s.segment == nil {
+		return
+	}
+	s.segment.Sync()
+	s.segment.Close()
+	s.segment = nil
+}
+
+// segments returns the paths of the spool files, oldest first.
+func (s *SpoolingSender) segments() ([]string, error) {
+	infos, err := ioutil.ReadDir(s.config.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading spool directory: %v", err)
+	}
+	var paths []string
+	for _, info := range infos {
+		if !info.IsDir() && strings.HasSuffix(info.Name(), spoolSuffix) {
+			paths = append(paths, filepath.Join(s.config.Dir, info.Name()))
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
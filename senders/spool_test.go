@@ -0,0 +1,217 @@
+package senders
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/honeycombio/libhoney-go/transmission"
+	"github.com/stretchr/testify/assert"
+)
+
+// flakySender responds to each event immediately, with an error while it is
+// failing.
+type flakySender struct {
+	lock    sync.Mutex
+	failing bool
+	// holding, if set, keeps the responses in held until release is called
+	holding   bool
+	held      []transmission.Response
+	sent      []*transmission.Event
+	responses chan transmission.Response
+}
+
+func newFlakySender(failing bool) *flakySender {
+	return &flakySender{failing: failing, responses: make(chan transmission.Response, 100)}
+}
+
+func (f *flakySender) Add(ev *transmission.Event) {
+	f.lock.Lock()
+	resp := transmission.Response{StatusCode: 200, Metadata: ev.Metadata}
+	if f.failing {
+		resp = transmission.Response{StatusCode: 503, Metadata: ev.Metadata}
+	} else {
+		f.sent = append(f.sent, ev)
+	}
+	if f.holding {
+		f.held = append(f.held, resp)
+		f.lock.Unlock()
+		return
+	}
+	f.lock.Unlock()
+	f.responses <- resp
+}
+
+// release sends the held responses and reports how many there were.
+func (f *flakySender) release() int {
+	f.lock.Lock()
+	held := f.held
+	f.held = nil
+	f.lock.Unlock()
+	for _, r := range held {
+		f.responses <- r
+	}
+	return len(held)
+}
+
+func (f *flakySender) heldCount() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return len(f.held)
+}
+
+func (f *flakySender) setFailing(failing bool) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.failing = failing
+}
+
+func (f *flakySender) sentNames() []string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	var names []string
+	for _, ev := range f.sent {
+		names = append(names, ev.Data["name"].(string))
+	}
+	return names
+}
+
+func (f *flakySender) Start() error                              { return nil }
+func (f *flakySender) Stop() error                               { return nil }
+func (f *flakySender) TxResponses() chan transmission.Response   { return f.responses }
+func (f *flakySender) SendResponse(r transmission.Response) bool { f.responses <- r; return false }
+
+func spoolTestConfig(t *testing.T) SpoolConfig {
+	dir, err := ioutil.TempDir("", "spool")
+	assert.NoError(t, err)
+	return SpoolConfig{
+		Dir:              dir,
+		FailureThreshold: 2,
+		MinBackoff:       5 * time.Millisecond,
+		MaxBackoff:       20 * time.Millisecond,
+	}
+}
+
+func namedEvent(name string) *transmission.Event {
+	return &transmission.Event{
+		APIKey:    "key",
+		Dataset:   "myapp",
+		Timestamp: time.Now(),
+		Metadata:  name,
+		Data:      map[string]interface{}{"name": name},
+	}
+}
+
+func TestSpoolingSenderRecovers(t *testing.T) {
+	config := spoolTestConfig(t)
+	defer os.RemoveAll(config.Dir)
+	inner := newFlakySender(true)
+	s, err := NewSpoolingSender(inner, config)
+	assert.NoError(t, err)
+	assert.NoError(t, s.Start())
+	defer s.Close()
+
+	for _, name := range []string{"a", "b", "c"} {
+		s.Add(namedEvent(name))
+	}
+	for i := 0; i < 3; i++ {
+		r := <-s.TxResponses()
+		assert.Equal(t, ErrSpooled, r.Err, "failed events should be spooled")
+		assert.NotNil(t, r.Metadata, "responses should carry the event's metadata")
+	}
+	assert.Empty(t, inner.sentNames())
+
+	inner.setFailing(false)
+	assert.Eventually(t, func() bool { return len(inner.sentNames()) == 3 }, 5*time.Second, 5*time.Millisecond,
+		"spooled events should be replayed once sends succeed")
+	assert.ElementsMatch(t, []string{"a", "b", "c"}, inner.sentNames())
+	assert.Eventually(t, func() bool {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		return !s.outage
+	}, 5*time.Second, 5*time.Millisecond, "successful replays should end the outage")
+
+	s.Add(namedEvent("d"))
+	r := <-s.TxResponses()
+	assert.NoError(t, r.Err)
+	assert.Equal(t, "d", r.Metadata, "events should be sent normally after recovering")
+}
+
+func TestSpoolingSenderReplaysInBatches(t *testing.T) {
+	config := spoolTestConfig(t)
+	defer os.RemoveAll(config.Dir)
+	config.ReplayBatchSize = 3
+	inner := newFlakySender(true)
+	s, err := NewSpoolingSender(inner, config)
+	assert.NoError(t, err)
+	assert.NoError(t, s.Start())
+	defer s.Close()
+
+	for i := 0; i < 7; i++ {
+		s.Add(namedEvent(fmt.Sprint(i)))
+	}
+	for i := 0; i < 7; i++ {
+		<-s.TxResponses()
+	}
+
+	inner.lock.Lock()
+	inner.failing = false
+	inner.holding = true
+	inner.lock.Unlock()
+	for _, want := range []int{3, 3, 1} {
+		assert.Eventually(t, func() bool { return inner.heldCount() == want }, 5*time.Second, time.Millisecond,
+			"a batch of replayed events should be sent")
+		time.Sleep(20 * time.Millisecond)
+		assert.Equal(t, want, inner.heldCount(), "the next batch should wait for responses to the last")
+		inner.release()
+	}
+	assert.Equal(t, 7, len(inner.sentNames()), "every spooled event should be replayed")
+}
+
+func TestSpoolingSenderPersists(t *testing.T) {
+	config := spoolTestConfig(t)
+	defer os.RemoveAll(config.Dir)
+	s, err := NewSpoolingSender(newFlakySender(true), config)
+	assert.NoError(t, err)
+	assert.NoError(t, s.Start())
+	s.Add(namedEvent("saved"))
+	<-s.TxResponses()
+	assert.NoError(t, s.Close())
+
+	segments, err := s.segments()
+	assert.NoError(t, err)
+	assert.NotEmpty(t, segments, "the event should be left in the spool")
+
+	inner := newFlakySender(false)
+	s, err = NewSpoolingSender(inner, config)
+	assert.NoError(t, err)
+	assert.NoError(t, s.Start())
+	defer s.Close()
+	assert.Eventually(t, func() bool { return len(inner.sentNames()) > 0 }, 5*time.Second, 5*time.Millisecond,
+		"events spooled by an earlier sender should be sent at startup")
+	inner.lock.Lock()
+	ev := inner.sent[0]
+	inner.lock.Unlock()
+	assert.Equal(t, "saved", ev.Data["name"])
+	assert.Equal(t, "key", ev.APIKey)
+	assert.Equal(t, "myapp", ev.Dataset)
+}
+
+func TestSpoolingSenderFull(t *testing.T) {
+	config := spoolTestConfig(t)
+	defer os.RemoveAll(config.Dir)
+	config.MaxBytes = 10
+	s, err := NewSpoolingSender(newFlakySender(true), config)
+	assert.NoError(t, err)
+	assert.NoError(t, s.Start())
+	defer s.Close()
+	s.Add(namedEvent("too big"))
+	r := <-s.TxResponses()
+	assert.Equal(t, errSpoolFull, r.Err, "events should be dropped when the spool is full")
+
+	_, err = NewSpoolingSender(newFlakySender(false), SpoolConfig{})
+	assert.Error(t, err, "a directory should be required")
+}
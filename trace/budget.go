@@ -0,0 +1,276 @@
+package trace
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// ShedPolicy says what a MemoryBudget does once the spans it holds take more
+// memory than it allows.
+type ShedPolicy int
+
+const (
+	// ShedSendOldest sends the oldest open spans early, marked with
+	// meta.shed, along with their synchronous children, starting with
+	// verbose spans. Long-lived root spans are usually the oldest, so this
+	// finishes the traces that have been accumulating children the longest.
+	ShedSendOldest ShedPolicy = iota
+	// ShedDropLowestPriority discards the fields of the open spans that
+	// matter least: verbose spans, then normal ones, the most recently
+	// started first, so the outline of each trace recorded so far is kept.
+	// Critical spans, including roots and spans with errors, are never
+	// discarded. Discarded spans aren't sent, though their children still
+	// are.
+	ShedDropLowestPriority
+)
+
+// The memory held by a span is estimated, since measuring it would cost more
+// than it saves: a fixed overhead for the span and its event, and for each
+// field added to it, an overhead for the map entry plus the length of its
+// key and of its value if that is a string.
+const (
+	spanMemoryOverhead  = 1024
+	fieldMemoryOverhead = 48
+)
+
+// A MemoryBudget limits the memory held by spans that have been started but
+// not sent, across every trace created with it in their Config. When
+// long-lived root spans accumulate children faster than they are sent, it
+// sheds spans according to its ShedPolicy rather than letting them grow
+// until the process runs out of memory. The budget is checked as spans are
+// started, so fields added to open spans can take it over until the next
+// one is.
+type MemoryBudget struct {
+	max    int64
+	policy ShedPolicy
+
+	// bytes and spans are the estimated memory and number of the open
+	// spans, and sentEarly and dropped count the spans shed.
+	bytes     int64
+	spans     int64
+	sentEarly uint64
+	dropped   uint64
+
+	// head and tail are the oldest and newest open spans, linked through
+	// their budgetPrev and budgetNext, under lock.
+	lock       sync.Mutex
+	head, tail *Span
+}
+
+// NewMemoryBudget returns a MemoryBudget that lets open spans hold about
+// maxBytes, shedding them with policy beyond that.
+func NewMemoryBudget(maxBytes int64, policy ShedPolicy) *MemoryBudget {
+	return &MemoryBudget{max: maxBytes, policy: policy}
+}
+
+// MemoryStats are gauges describing the spans held by a MemoryBudget.
+type MemoryStats struct {
+	// MaxBytes is the budget.
+	MaxBytes int64
+	// Bytes is the estimated memory held by open spans, and Spans is how
+	// many there are.
+	Bytes int64
+	Spans int64
+	// SentEarly and Dropped count the spans shed by sending them early and
+	// by discarding them.
+	SentEarly uint64
+	Dropped   uint64
+}
+
+// Stats returns the budget's current gauges. It returns empty stats for a
+// nil budget.
+func (mb *MemoryBudget) Stats() MemoryStats {
+	if mb == nil {
+		return MemoryStats{}
+	}
+	return MemoryStats{
+		MaxBytes:  mb.max,
+		Bytes:     atomic.LoadInt64(&mb.bytes),
+		Spans:     atomic.LoadInt64(&mb.spans),
+		SentEarly: atomic.LoadUint64(&mb.sentEarly),
+		Dropped:   atomic.LoadUint64(&mb.dropped),
+	}
+}
+
+// fieldMemory estimates the memory taken by adding a field to an event.
+func fieldMemory(key string, val interface{}) int64 {
+	n := int64(fieldMemoryOverhead + len(key))
+	if s, ok := val.(string); ok {
+		n += int64(len(s))
+	}
+	return n
+}
+
+// track starts accounting for s, which has just been started, and then sheds
+// spans if the budget is exceeded.
+func (mb *MemoryBudget) track(s *Span) {
+	// link s into the list before accounting for it, so that release, which
+	// unlinks spans it has accounted for, can't miss it
+	mb.lock.Lock()
+	s.budgetPrev = mb.tail
+	if mb.tail != nil {
+		mb.tail.budgetNext = s
+	} else {
+		mb.head = s
+	}
+	mb.tail = s
+	s.listed = true
+	mb.lock.Unlock()
+
+	s.eventLock.Lock()
+	started := SpanState(atomic.LoadInt32(&s.state)) == SpanStarted
+	var bytes int64
+	if started {
+		s.budgeted = true
+		s.memBytes = spanMemoryOverhead
+		atomic.AddInt64(&mb.spans, 1)
+		bytes = atomic.AddInt64(&mb.bytes, spanMemoryOverhead)
+	}
+	s.eventLock.Unlock()
+	if !started {
+		// shedding sent it along with an ancestor before it could be
+		// accounted for
+		mb.lock.Lock()
+		mb.unlinkLocked(s)
+		mb.lock.Unlock()
+		return
+	}
+	if bytes <= mb.max {
+		return
+	}
+
+	mb.lock.Lock()
+	var shed []*Span
+	if over := atomic.LoadInt64(&mb.bytes) - mb.max; over > 0 {
+		shed = mb.pickLocked(over, s)
+	}
+	mb.lock.Unlock()
+
+	// shed them outside the lock, since sending spans releases them
+	for _, victim := range shed {
+		if mb.policy == ShedDropLowestPriority {
+			if victim.discard() {
+				atomic.AddUint64(&mb.dropped, 1)
+			}
+			mb.release(victim)
+			continue
+		}
+		victim.AddField("meta.shed", true)
+		if victim.sendOnce() {
+			atomic.AddUint64(&mb.sentEarly, 1)
+		}
+	}
+}
+
+// pickLocked unlinks and returns the spans to shed to free over bytes,
+// according to the budget's policy. Verbose spans are shed first. Sending
+// newest, the span just started, early would be pointless, so that policy
+// leaves it alone; dropping never touches critical spans. The caller holds
+// lock.
+func (mb *MemoryBudget) pickLocked(over int64, newest *Span) []*Span {
+	var picked []*Span
+	var freed int64
+	first, next := func() *Span { return mb.head }, func(s *Span) *Span { return s.budgetNext }
+	most := PriorityCritical
+	if mb.policy == ShedDropLowestPriority {
+		first, next = func() *Span { return mb.tail }, func(s *Span) *Span { return s.budgetPrev }
+		most = PriorityNormal
+	}
+	for _, upTo := range []Priority{PriorityVerbose, most} {
+		for s := first(); s != nil && freed < over; {
+			n := next(s)
+			if s != newest || mb.policy == ShedDropLowestPriority {
+				if mem, ok := s.sheddable(upTo); ok {
+					freed += mem
+					mb.unlinkLocked(s)
+					picked = append(picked, s)
+				}
+			}
+			s = n
+		}
+	}
+	return picked
+}
+
+// sheddable reports whether s's priority is no higher than upTo, and the
+// memory it holds.
+func (s *Span) sheddable(upTo Priority) (int64, bool) {
+	s.eventLock.Lock()
+	defer s.eventLock.Unlock()
+	if s.priorityLocked() > upTo {
+		return 0, false
+	}
+	return s.memBytes, true
+}
+
+// unlinkLocked removes s from the list of open spans. The caller holds lock.
+func (mb *MemoryBudget) unlinkLocked(s *Span) {
+	if !s.listed {
+		return
+	}
+	if s.budgetPrev != nil {
+		s.budgetPrev.budgetNext = s.budgetNext
+	} else {
+		mb.head = s.budgetNext
+	}
+	if s.budgetNext != nil {
+		s.budgetNext.budgetPrev = s.budgetPrev
+	} else {
+		mb.tail = s.budgetPrev
+	}
+	s.budgetPrev, s.budgetNext = nil, nil
+	s.listed = false
+}
+
+// grow accounts for n more bytes held by s. The caller holds s.eventLock.
+func (mb *MemoryBudget) grow(s *Span, n int64) {
+	if !s.budgeted {
+		return
+	}
+	s.memBytes += n
+	atomic.AddInt64(&mb.bytes, n)
+}
+
+// release stops accounting for s, once it has been sent or discarded.
+func (mb *MemoryBudget) release(s *Span) {
+	s.eventLock.Lock()
+	budgeted := s.budgeted
+	if budgeted {
+		atomic.AddInt64(&mb.bytes, -s.memBytes)
+		atomic.AddInt64(&mb.spans, -1)
+		s.budgeted = false
+		s.memBytes = 0
+	}
+	s.eventLock.Unlock()
+	if !budgeted {
+		return
+	}
+	mb.lock.Lock()
+	mb.unlinkLocked(s)
+	mb.lock.Unlock()
+}
+
+// discard throws away the fields s holds, if it hasn't been sent or is
+// still held in a run of compressed siblings, so it won't be sent either, and
+// reports whether it did.
+func (s *Span) discard() bool {
+	s.sendLock.Lock()
+	defer s.sendLock.Unlock()
+	if (s.isSent && !s.held) || s.discarded {
+		return false
+	}
+	s.eventLock.Lock()
+	if s.eventSent {
+		s.eventLock.Unlock()
+		return false
+	}
+	s.discarded = true
+	// keep an empty event, so the span can still be finished and send its
+	// children, but not its fields
+	ev := s.trace.builder.NewEvent()
+	ev.Timestamp = s.ev.Timestamp
+	s.ev = ev
+	s.eventSent = true
+	s.eventLock.Unlock()
+	return true
+}
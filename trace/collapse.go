@@ -0,0 +1,203 @@
+package trace
+
+// defaultCollapsePrefix is put in front of the fields summarizing collapsed
+// spans when their CollapseRule doesn't set a Prefix.
+const defaultCollapsePrefix = "collapsed."
+
+// A CollapseRule selects child spans to be summarized in fields on the root
+// span of their trace instead of being sent as events of their own. Chatty
+// instrumentation, like a span for every cache lookup, can then be analyzed
+// from the root span, one wide event per trace, at a fraction of the event
+// volume. A rule matches a span if every one of its criteria that is set
+// does. Only spans without children are collapsed, and only until the root
+// span is sent; spans with an error recorded on them and those given
+// PriorityCritical are always sent, so hooks and the ErrorReporter see them.
+type CollapseRule struct {
+	// Names, if set, matches spans with any of these names.
+	Names []string
+	// Fields, if set, matches spans with every one of these fields set to
+	// the given value. The values must be comparable with ==.
+	Fields map[string]interface{}
+	// Match, if set, is called with the span's fields, and matches the span
+	// if it returns true. It must not modify them.
+	Match func(fields map[string]interface{}) bool
+	// Prefix is put in front of the names of the fields summarizing the
+	// matched spans. For each span name the root span gets the fields
+	// <Prefix><name>.count, .duration_ms, the total, and .max_duration_ms.
+	// default: "collapsed."
+	Prefix string
+}
+
+func (r *CollapseRule) matches(fields map[string]interface{}) bool {
+	return matchSpan(r.Names, r.Fields, r.Match, fields)
+}
+
+func (r *CollapseRule) prefix() string {
+	if r.Prefix == "" {
+		return defaultCollapsePrefix
+	}
+	return r.Prefix
+}
+
+// spanAggregate summarizes the spans collapsed under one name, or compressed
+// into one.
+type spanAggregate struct {
+	count    int
+	total    float64
+	min      float64
+	max      float64
+	examples exemplars
+}
+
+// exemplars keeps some of the spans that are aggregated to send as they are,
+// so there are real instances to look at: the slowest, up to max of them.
+type exemplars struct {
+	max int
+	// slowest is sorted slowest first
+	slowest []exemplar
+}
+
+type exemplar struct {
+	span *Span
+	dur  float64
+}
+
+// offer keeps s, which took dur milliseconds, if it is one of the exemplars
+// so far, and returns the span that no longer is one: s, the fastest of the
+// ones kept before, or nil.
+func (e *exemplars) offer(s *Span, dur float64) *Span {
+	n := e.max
+	if n == 0 {
+		return s
+	}
+	i := len(e.slowest)
+	for i > 0 && e.slowest[i-1].dur < dur {
+		i--
+	}
+	if i >= n {
+		return s
+	}
+	e.slowest = append(e.slowest, exemplar{})
+	copy(e.slowest[i+1:], e.slowest[i:])
+	e.slowest[i] = exemplar{span: s, dur: dur}
+	if len(e.slowest) > n {
+		out := e.slowest[n].span
+		e.slowest = e.slowest[:n]
+		return out
+	}
+	return nil
+}
+
+// keeps reports whether s is one of the exemplars.
+func (e *exemplars) keeps(s *Span) bool {
+	for _, x := range e.slowest {
+		if x.span == s {
+			return true
+		}
+	}
+	return false
+}
+
+// send sends the exemplars, marked with meta.exemplar.
+func (e *exemplars) send() {
+	for _, x := range e.slowest {
+		x.span.AddField("meta.exemplar", true)
+		x.span.sendHeld()
+	}
+}
+
+// add counts a span that took dur milliseconds.
+func (a *spanAggregate) add(dur float64) {
+	a.count++
+	a.total += dur
+	if a.count == 1 || dur < a.min {
+		a.min = dur
+	}
+	if a.count == 1 || dur > a.max {
+		a.max = dur
+	}
+}
+
+// fields calls add with the names and values of the fields summarizing the
+// spans, whose names start with prefix.
+func (a *spanAggregate) fields(prefix string, add func(string, interface{})) {
+	add(prefix+".count", a.count)
+	add(prefix+".duration_ms", a.total)
+	add(prefix+".max_duration_ms", a.max)
+}
+
+// collapse summarizes s, which took dur milliseconds, on its trace's root span
+// if one of the trace's CollapseRules matches it, and reports whether it did.
+// The caller holds sendLock, and has checked that s has no children.
+func (s *Span) collapse(dur float64) bool {
+	cfg := s.trace.getConfig()
+	rules := cfg.CollapseSpans
+	if len(rules) == 0 || s.isRoot || s.ev == nil {
+		return false
+	}
+	s.eventLock.Lock()
+	if s.priorityLocked() == PriorityCritical {
+		s.eventLock.Unlock()
+		return false
+	}
+	fields := s.ev.Fields()
+	var rule *CollapseRule
+	for i := range rules {
+		if rules[i].matches(fields) {
+			rule = &rules[i]
+			break
+		}
+	}
+	name, _ := fields["name"].(string)
+	s.eventLock.Unlock()
+	if rule == nil {
+		return false
+	}
+	return s.trace.addCollapsed(s, rule.prefix()+name, dur, int(cfg.Exemplars))
+}
+
+// addCollapsed counts s, a collapsed span, in the fields starting with key,
+// keeping up to exemplars of those spans, unless the root span has already
+// been sent, and reports whether it did.
+func (t *Trace) addCollapsed(s *Span, key string, dur float64, exemplars int) bool {
+	t.collapseLock.Lock()
+	defer t.collapseLock.Unlock()
+	if t.collapseDone {
+		return false
+	}
+	agg, ok := t.collapsed[key]
+	if !ok {
+		if t.collapsed == nil {
+			t.collapsed = make(map[string]*spanAggregate)
+		}
+		agg = &spanAggregate{}
+		agg.examples.max = exemplars
+		t.collapsed[key] = agg
+	}
+	agg.add(dur)
+	agg.examples.offer(s, dur)
+	return true
+}
+
+// collapsedFields returns the fields summarizing the trace's collapsed spans
+// for the root span, and their exemplars to send, after which no more spans
+// are collapsed.
+func (t *Trace) collapsedFields() (map[string]interface{}, []*exemplars) {
+	t.collapseLock.Lock()
+	defer t.collapseLock.Unlock()
+	t.collapseDone = true
+	if len(t.collapsed) == 0 {
+		return nil, nil
+	}
+	fields := make(map[string]interface{}, 3*len(t.collapsed))
+	var examples []*exemplars
+	for key, agg := range t.collapsed {
+		agg.fields(key, func(name string, v interface{}) {
+			fields[name] = v
+		})
+		if len(agg.examples.slowest) > 0 {
+			examples = append(examples, &agg.examples)
+		}
+	}
+	return fields, examples
+}
@@ -0,0 +1,174 @@
+package trace
+
+import (
+	"hash/fnv"
+	"sync/atomic"
+	"time"
+)
+
+// siblingSignature identifies spans similar enough to be compressed together:
+// those with the same name and the same field names, whatever their values.
+type siblingSignature struct {
+	name   string
+	fields int
+	keys   uint64
+}
+
+// signature returns the span's siblingSignature, or false if it shouldn't be
+// compressed because an error was recorded on it or it was given
+// PriorityCritical.
+func (s *Span) signature() (siblingSignature, bool) {
+	s.eventLock.Lock()
+	defer s.eventLock.Unlock()
+	if s.erred || Priority(atomic.LoadInt32(&s.priority)) == PriorityCritical {
+		return siblingSignature{}, false
+	}
+	fields := s.ev.Fields()
+	sig := siblingSignature{fields: len(fields)}
+	sig.name, _ = fields["name"].(string)
+	h := fnv.New64a()
+	for k := range fields {
+		h.Reset()
+		h.Write([]byte(k))
+		// combined so that the order of the fields doesn't matter
+		sig.keys ^= h.Sum64()
+	}
+	return sig, true
+}
+
+// A siblingRun holds consecutive similar children of a span as they are sent.
+// Until there are threshold of them they are held back, in case there are
+// fewer and they are sent as they are; from then on only first, the span
+// standing in for them all, is kept, to be sent summarizing the run, along
+// with the exemplars among the rest. Spans the run holds stay tracked as open
+// spans, and in the memory budget, until they are sent or dropped from it.
+type siblingRun struct {
+	sig       siblingSignature
+	threshold int
+	first     *Span
+	held      []*Span
+	agg       spanAggregate
+	end       time.Time
+}
+
+// compress adds s, which took dur milliseconds, to the run of similar
+// siblings its parent is holding, when the trace's CompressSiblings is set,
+// and reports whether it did, in which case the run releases s once it is
+// sent or dropped. A sibling that doesn't belong in the run, or leaf being
+// unset, ends it. The caller holds sendLock.
+func (s *Span) compress(dur float64, leaf bool) bool {
+	cfg := s.trace.getConfig()
+	threshold := int(cfg.CompressSiblings)
+	p := s.parent
+	if threshold < 2 || s.isRoot || p == nil || s.summary != nil {
+		return false
+	}
+	var sig siblingSignature
+	ok := leaf && !s.isAsync && s.ev != nil && !s.discarded
+	if ok {
+		sig, ok = s.signature()
+	}
+	end := s.started.Add(time.Duration(dur * float64(time.Millisecond)))
+
+	p.childrenLock.Lock()
+	if p.runDone {
+		p.childrenLock.Unlock()
+		return false
+	}
+	run := p.run
+	if ok && run != nil && run.sig == sig {
+		dropped := run.add(s, dur, end)
+		p.childrenLock.Unlock()
+		for _, d := range dropped {
+			d.release()
+		}
+		return true
+	}
+	p.run = nil
+	if ok {
+		p.run = &siblingRun{sig: sig, threshold: threshold, first: s}
+		p.run.agg.examples.max = int(cfg.Exemplars)
+		p.run.agg.add(dur)
+		p.run.end = end
+	}
+	p.childrenLock.Unlock()
+	run.send()
+	return ok
+}
+
+// add adds s, which took dur milliseconds and ended at end, to the run, and
+// returns the spans it no longer holds, which won't be sent. The caller holds
+// the parent's childrenLock.
+func (r *siblingRun) add(s *Span, dur float64, end time.Time) []*Span {
+	r.agg.add(dur)
+	out := r.agg.examples.offer(s, dur)
+	if end.After(r.end) {
+		r.end = end
+	}
+	if r.agg.count < r.threshold {
+		r.held = append(r.held, s)
+		return nil
+	}
+	if r.held == nil {
+		if out == nil {
+			return nil
+		}
+		return []*Span{out}
+	}
+	// long enough to compress: keep only the exemplars of the spans held
+	held := append(r.held, s)
+	r.held = nil
+	dropped := held[:0]
+	for _, h := range held {
+		if !r.agg.examples.keeps(h) {
+			dropped = append(dropped, h)
+		}
+	}
+	return dropped
+}
+
+// flushRun sends the run of siblings s is holding, once s is being sent, and
+// stops holding more.
+func (s *Span) flushRun() {
+	s.childrenLock.Lock()
+	run := s.run
+	s.run = nil
+	s.runDone = true
+	s.childrenLock.Unlock()
+	run.send()
+}
+
+// send sends the spans held in the run, or if there were at least threshold
+// of them the first one, summarizing the run in its meta.compressed_ fields
+// and lasting from the start of the first to the end of the last, and the
+// run's exemplars.
+func (r *siblingRun) send() {
+	if r == nil {
+		return
+	}
+	if r.agg.count < r.threshold {
+		r.first.sendHeld()
+		for _, s := range r.held {
+			s.sendHeld()
+		}
+		return
+	}
+	r.first.AddFields(map[string]interface{}{
+		"duration_ms":                     float64(r.end.Sub(r.first.started)) / float64(time.Millisecond),
+		"meta.compressed_span_count":      r.agg.count,
+		"meta.compressed_duration_ms":     r.agg.total,
+		"meta.compressed_min_duration_ms": r.agg.min,
+		"meta.compressed_max_duration_ms": r.agg.max,
+	})
+	r.first.sendHeld()
+	r.agg.examples.send()
+}
+
+// sendHeld sends the event of s, which was held back after s was sent, and
+// releases it.
+func (s *Span) sendHeld() {
+	s.sendLock.Lock()
+	s.send()
+	s.sendLock.Unlock()
+	s.release()
+}
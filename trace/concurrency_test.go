@@ -0,0 +1,56 @@
+package trace
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestConcurrentMutation exercises every way of changing a trace from many
+// goroutines at once. It doesn't check much on its own; run it with -race.
+func TestConcurrentMutation(t *testing.T) {
+	mo := setupLibhoney()
+	ctx, tr := NewTrace(context.Background(), "")
+	rs := tr.GetRootSpan()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rs.AddField(fmt.Sprintf("field%d", i), i)
+			rs.AddFields(map[string]interface{}{"a": i, "b": i})
+			rs.AddRollupField("count", 1)
+			rs.AddTraceField(fmt.Sprintf("trace%d", i), i)
+			tr.AddFields(map[string]interface{}{"shared": i})
+			_ = rs.SerializeHeaders()
+			_ = rs.PropagationContext()
+			_ = rs.GetChildren()
+			childCtx, child := rs.CreateChild(ctx)
+			_, async := child.CreateAsyncChild(childCtx)
+			child.AddFields(map[string]interface{}{"c": i})
+			go async.Send()
+			child.Send()
+		}(i)
+	}
+	wg.Wait()
+	rs.Send()
+	// adding fields after sending should be harmless
+	rs.AddField("late", true)
+	rs.AddFields(map[string]interface{}{"late": true})
+
+	var root map[string]interface{}
+	for _, ev := range mo.Events() {
+		if ev.Data["meta.span_type"] == "root" {
+			root = ev.Data
+		}
+	}
+	if assert.NotNil(t, root) {
+		assert.Equal(t, root["a"], root["b"], "AddFields should set its fields together")
+		assert.Equal(t, float64(20), root["rollup.count"])
+		assert.Nil(t, root["late"], "fields added after sending should be dropped")
+	}
+}
@@ -0,0 +1,51 @@
+package trace
+
+// correlationKeys names the trace-level fields holding correlation IDs.
+var correlationKeys = NewKeyPrefix("correlation.")
+
+// AddCorrelationID records id, an identifier that correlates the trace with
+// other systems' records like a request, job, or order ID, in the trace-level
+// field correlation.<name>. Like other trace-level fields it is added to every
+// span in the trace and passed along to downstream services, and if the
+// trace's Config.CorrelationHeaders names a header for it, it is sent in that
+// header too, so services that don't use a beeline can log it.
+func (t *Trace) AddCorrelationID(name, id string) {
+	t.AddField(correlationKeys.Key(name), id)
+}
+
+// CorrelationID returns the correlation ID recorded with name, or "" if there
+// is none.
+func (t *Trace) CorrelationID(name string) string {
+	id, _ := t.getTraceLevelFields()[correlationKeys.Key(name)].(string)
+	return id
+}
+
+// addCorrelationHeaders adds to fields, a new trace's trace-level fields, the
+// correlation IDs found in the headers of requests from src that headers
+// names, unless they came with the propagated trace context.
+func addCorrelationHeaders(fields map[string]interface{}, headers map[string]string, header func(string) string) {
+	for name, h := range headers {
+		key := correlationKeys.Key(name)
+		if _, ok := fields[key]; ok {
+			continue
+		}
+		if id := header(h); id != "" {
+			fields[key] = id
+		}
+	}
+}
+
+// correlationHeaders adds to headers the trace's correlation IDs that have a
+// header named for them in the trace's Config.CorrelationHeaders.
+func (t *Trace) correlationHeaders(headers map[string]string) {
+	names := t.getConfig().CorrelationHeaders
+	if len(names) == 0 {
+		return
+	}
+	fields := t.getTraceLevelFields()
+	for name, h := range names {
+		if id, ok := fields[correlationKeys.Key(name)].(string); ok && id != "" {
+			headers[h] = id
+		}
+	}
+}
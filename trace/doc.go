@@ -85,11 +85,36 @@
 //       \--- sync child -------|
 //            \-------------|
 //
+// Sessions
+//
+// Traces usually last as long as a request, but some, like a game session or
+// a stream processor's run, stay open for hours. Spans are sent as they
+// finish, so a long trace only holds the spans still running, but its root
+// span isn't sent until it ends. Start these traces with WithCheckpoints to
+// send a checkpoint span event on the open root span periodically, carrying
+// its fields and rollup totals so far, so the session can be queried before
+// it ends.
+//
+// Concurrency
+//
+// Spans and traces are safe to use from multiple goroutines. AddField,
+// AddFields, AddRollupField, and AddTraceField may be called concurrently with
+// each other, with creating children, and with Send. Fields added to a span
+// after it has been sent are dropped. Use AddFields to add several fields at
+// once; hooks never see only some of them.
+//
+// Code that can't pass a context.Context down can hold spans directly instead:
+// StartChild and StartAsyncChild create children of a span by name and return
+// them without touching a context.
+//
 // Sampling
 //
 // The default sampling applied by the beeline samples entire traces. For
 // example, if you set a sample rate to 10, then one out of 10 traces will be
-// sent, and all spans in that trace will be sent (or none at all). If you take
+// sent, and all spans in that trace will be sent (or none at all). Since that
+// decision depends only on the trace ID, it is made when the trace is created;
+// spans in dropped traces have no events, so adding fields to them and
+// creating their children costs very little. If you take
 // advantage of the SamplerHook, it is up to you and your implementation to
 // decide whether to sample entire traces or individual spans. If traces are
 // incomplete (i.e. some spans are kept and others dropped), the Honeycomb UI
@@ -132,4 +157,9 @@
 // (`meta.sent_by_parent`) added to indicate that they were unsent. Sending
 // unsent spans is likely indicative of either an opportunity to use an async
 // span or a bug in the program where a span accidentally does not get sent.
+// To help track them down, such spans also get `meta.sent_by` and
+// `meta.sent_by_name`, the ID and name of the span whose Send swept them up,
+// and `meta.unfinished_ms`, how long they had been running. Config's
+// OrphanedSpanHook is called with each of them, and OrphanGoroutineDump adds
+// a dump of every goroutine's stack in `meta.orphan_goroutines`.
 package trace
@@ -0,0 +1,65 @@
+package trace
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SpanError is an error recorded on a span, passed to Config.ErrorReporter.
+type SpanError struct {
+	// TraceID and SpanID identify the span the error was recorded on. For
+	// span events, SpanID is the span the event is attached to.
+	TraceID string
+	SpanID  string
+	// Name is the span's name.
+	Name string
+	// Field is the field the error was recorded in, like db.error, and
+	// Message its value.
+	Field   string
+	Message string
+	// Sampled is set if the span is being sent to Honeycomb, so that a link
+	// to its trace will find it.
+	Sampled bool
+}
+
+// isErrorField reports whether key names a field errors are recorded in.
+func isErrorField(key string) bool {
+	return key == "error" || strings.HasSuffix(key, ".error")
+}
+
+// recordsError reports whether adding val in the field key records an error.
+func recordsError(key string, val interface{}) bool {
+	return isErrorField(key) && val != nil && val != false && val != ""
+}
+
+// reportErrors passes the errors in an event's fields to report, in order of
+// their field names.
+func reportErrors(report func(SpanError), fields map[string]interface{}, sampled bool) {
+	var keys []string
+	for k, v := range fields {
+		if recordsError(k, v) {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return
+	}
+	sort.Strings(keys)
+	traceID, _ := fields["trace.trace_id"].(string)
+	spanID, _ := fields["trace.span_id"].(string)
+	if annotation, _ := fields["meta.annotation_type"].(string); annotation == "span_event" {
+		spanID, _ = fields["trace.parent_id"].(string)
+	}
+	name, _ := fields["name"].(string)
+	for _, k := range keys {
+		report(SpanError{
+			TraceID: traceID,
+			SpanID:  spanID,
+			Name:    name,
+			Field:   k,
+			Message: fmt.Sprint(fields[k]),
+			Sampled: sampled,
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package trace
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+)
+
+// ExternalTraceID returns the trace ID derived from key, a business
+// identifier like an order ID or an idempotency key, in namespace, which says
+// what kind of identifier it is, eg "order". The ID is a hash of both, in the
+// form of the beeline's own trace IDs, so it is valid in every propagation
+// format, and a tool that knows an order ID can find the order's trace
+// without looking it up. The namespace and key are length-prefixed before
+// hashing, so different pairs can't run together into the same input, and
+// IDs from different namespaces are independent.
+func ExternalTraceID(namespace, key string) string {
+	h := sha256.New()
+	var n [binary.MaxVarintLen64]byte
+	h.Write(n[:binary.PutUvarint(n[:], uint64(len(namespace)))])
+	h.Write([]byte(namespace))
+	h.Write(n[:binary.PutUvarint(n[:], uint64(len(key)))])
+	h.Write([]byte(key))
+	id := h.Sum(nil)[:traceIDLengthBytes]
+	// W3C and B3 reject all-zero trace IDs
+	zero := true
+	for _, b := range id {
+		if b != 0 {
+			zero = false
+			break
+		}
+	}
+	if zero {
+		id[len(id)-1] = 1
+	}
+	return hex.EncodeToString(id)
+}
+
+// WithExternalTraceID gives the new trace the ID ExternalTraceID derives from
+// namespace and key, instead of a random one or the config's NewTraceID, and
+// records namespace in the root span's meta.trace_id_namespace field. Every
+// trace started with the same key gets the same ID, so retries of an
+// operation make one trace; keys that are reused for unrelated work make
+// confusing ones. A trace continuing one propagated from upstream keeps the
+// upstream trace's ID, and one restarted for exceeding MaxTraceHops gets a
+// new one as usual.
+func WithExternalTraceID(namespace, key string) Option {
+	return func(o *options) {
+		o.traceIDNamespace = namespace
+		o.traceID = ExternalTraceID(namespace, key)
+	}
+}
@@ -0,0 +1,97 @@
+package trace
+
+import "strings"
+
+// reservedNamespaces are the field namespaces Honeycomb and the beeline rely
+// on to assemble traces, which FieldPrefixes may not rename.
+var reservedNamespaces = map[string]bool{
+	"trace": true,
+	"meta":  true,
+}
+
+// applyFieldPrefixes renames the fields whose namespaces, the part of their
+// names before the first dot, have a prefix in prefixes: with {"db": "sql."},
+// db.query becomes sql.query.
+func applyFieldPrefixes(fields map[string]interface{}, prefixes map[string]string) {
+	var renames map[string]string
+	for k := range fields {
+		dot := strings.IndexByte(k, '.')
+		if dot < 0 {
+			continue
+		}
+		ns := k[:dot]
+		prefix, ok := prefixes[ns]
+		if !ok || reservedNamespaces[ns] {
+			continue
+		}
+		if renames == nil {
+			renames = make(map[string]string)
+		}
+		renames[k] = prefix + k[dot+1:]
+	}
+	// rename after collecting them, so renamed fields aren't renamed again
+	values := make(map[string]interface{}, len(renames))
+	for from := range renames {
+		values[from] = fields[from]
+		delete(fields, from)
+	}
+	for from, to := range renames {
+		fields[to] = values[from]
+	}
+}
+
+// DatasetRoute sends the spans it matches to a different dataset than the
+// rest of the trace, eg audit events to a locked-down dataset. A route
+// matches a span if every one of its criteria that is set does.
+type DatasetRoute struct {
+	// Dataset is where matching spans are sent.
+	Dataset string
+	// Names, if set, matches spans with any of these names.
+	Names []string
+	// Fields, if set, matches spans with every one of these fields set to
+	// the given value. The values must be comparable with ==.
+	Fields map[string]interface{}
+	// Match, if set, is called with the span's fields, and matches the span
+	// if it returns true. It must not modify them.
+	Match func(fields map[string]interface{}) bool
+}
+
+// matches reports whether the route matches a span with fields.
+func (r *DatasetRoute) matches(fields map[string]interface{}) bool {
+	return matchSpan(r.Names, r.Fields, r.Match, fields)
+}
+
+// matchSpan reports whether a span with fields has one of names, every one of
+// want, and is matched by match, skipping the criteria that aren't set.
+func matchSpan(names []string, want map[string]interface{}, match func(map[string]interface{}) bool, fields map[string]interface{}) bool {
+	if len(names) > 0 {
+		name, _ := fields["name"].(string)
+		found := false
+		for _, n := range names {
+			if n == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	for k, w := range want {
+		if v, ok := fields[k]; !ok || v != w {
+			return false
+		}
+	}
+	return match == nil || match(fields)
+}
+
+// routeDataset returns the dataset of the first of routes matching a span
+// with fields, or "" if none do.
+func routeDataset(routes []DatasetRoute, fields map[string]interface{}) string {
+	for i := range routes {
+		if routes[i].matches(fields) {
+			return routes[i].Dataset
+		}
+	}
+	return ""
+}
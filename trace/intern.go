@@ -0,0 +1,66 @@
+package trace
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// maxInternedKeys is the number of keys a KeyPrefix interns. Keys past it are
+// built afresh each time, so that keys made from unbounded values, like IDs,
+// can't grow the table forever.
+const maxInternedKeys = 1024
+
+// A KeyPrefix builds field names that share a prefix, like the app. fields
+// added through the beeline or the handler.vars. fields of a router's path
+// parameters. It interns the names, so the same one isn't allocated again for
+// every span: in a busy service that adds up to a lot of garbage. A KeyPrefix
+// is safe for concurrent use.
+type KeyPrefix struct {
+	prefix string
+	// keys maps keys to their prefixed names in a map[string]string that is
+	// never modified once stored, so looking one up takes no lock. Writers
+	// take lock and store a copy with the new key added.
+	keys atomic.Value
+	lock sync.Mutex
+}
+
+// NewKeyPrefix returns a KeyPrefix that puts prefix, including any trailing
+// dot, in front of keys.
+func NewKeyPrefix(prefix string) *KeyPrefix {
+	p := &KeyPrefix{prefix: prefix}
+	p.keys.Store(map[string]string{})
+	return p
+}
+
+// Prefix returns the prefix p puts in front of keys.
+func (p *KeyPrefix) Prefix() string {
+	return p.prefix
+}
+
+// Key returns key with p's prefix in front of it.
+func (p *KeyPrefix) Key(key string) string {
+	keys := p.keys.Load().(map[string]string)
+	if name, ok := keys[key]; ok {
+		return name
+	}
+	name := p.prefix + key
+	if len(keys) >= maxInternedKeys {
+		return name
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	keys = p.keys.Load().(map[string]string)
+	if interned, ok := keys[key]; ok {
+		return interned
+	}
+	if len(keys) >= maxInternedKeys {
+		return name
+	}
+	added := make(map[string]string, len(keys)+1)
+	for k, v := range keys {
+		added[k] = v
+	}
+	added[key] = name
+	p.keys.Store(added)
+	return name
+}
@@ -0,0 +1,160 @@
+package trace
+
+import (
+	"fmt"
+	"time"
+)
+
+// RecordedSpan is a span that has already happened, described by timing data
+// recorded elsewhere, eg parsed from logs or read from an ETL job's run
+// history. Batch turns recorded spans into events.
+type RecordedSpan struct {
+	// TraceID is the ID of the trace the span belongs to. It is required.
+	TraceID string
+	// SpanID is the span's ID. If it is empty one is generated, but then no
+	// other span can name it as a parent.
+	SpanID string
+	// ParentID is the ID of the span's parent, in this batch or elsewhere.
+	// It is empty for root spans.
+	ParentID string
+	// Name is the span's name.
+	Name string
+	// Start is when the span started. It is required.
+	Start time.Time
+	// Duration is how long the span ran.
+	Duration time.Duration
+	// Async marks spans that outlived their parents.
+	Async bool
+	// Fields are added to the span's event.
+	Fields map[string]interface{}
+}
+
+// Batch builds traces from spans that have already happened and sends them in
+// bulk, so tools that convert logs or job histories into traces get the same
+// events, sampling, and hooks as traces recorded live instead of hand-rolling
+// libhoney events. Create one with NewBatch, Add spans to it, and Send it.
+// Batches aren't safe for concurrent use.
+type Batch struct {
+	opts  options
+	spans []RecordedSpan
+}
+
+// NewBatch creates an empty batch whose traces are built with opts, like
+// those given to NewTrace: the dataset, client, builder, config, and sample
+// rate options apply to every trace in the batch, and WithDrop drops them all.
+// Each trace is sampled as a whole, by its trace ID, and its spans are run
+// through the config's hooks before they are sent.
+func NewBatch(opts ...Option) *Batch {
+	return &Batch{opts: newOptions(opts)}
+}
+
+// Add adds spans to the batch. Spans may be added in any order, and a trace's
+// spans needn't be added together.
+func (b *Batch) Add(spans ...RecordedSpan) {
+	b.spans = append(b.spans, spans...)
+}
+
+// Len returns the number of spans in the batch.
+func (b *Batch) Len() int {
+	return len(b.spans)
+}
+
+// Send sends every span in the batch, in the order they were added, and
+// empties it. The events are handed to libhoney, which sends them in the
+// background; flush or close the client to wait for them. If any span is
+// missing its trace ID or start time, or reuses another span's ID in the same
+// trace, Send returns an error describing it and sends nothing.
+func (b *Batch) Send() error {
+	type spanKey struct{ traceID, spanID string }
+	ids := make(map[spanKey]bool, len(b.spans))
+	parents := make(map[spanKey]bool, len(b.spans))
+	for i, s := range b.spans {
+		if s.TraceID == "" {
+			return fmt.Errorf("span %d (%q) has no trace ID", i, s.Name)
+		}
+		if s.Start.IsZero() {
+			return fmt.Errorf("span %d (%q) has no start time", i, s.Name)
+		}
+		if s.SpanID != "" {
+			key := spanKey{s.TraceID, s.SpanID}
+			if ids[key] {
+				return fmt.Errorf("span %d (%q) reuses span ID %s in trace %s", i, s.Name, s.SpanID, s.TraceID)
+			}
+			ids[key] = true
+		}
+		if s.ParentID != "" {
+			parents[spanKey{s.TraceID, s.ParentID}] = true
+		}
+	}
+
+	traces := make(map[string]*Trace)
+	for _, s := range b.spans {
+		t, ok := traces[s.TraceID]
+		if !ok {
+			t = b.newTrace(s.TraceID)
+			traces[s.TraceID] = t
+		}
+		if t.isDropped() {
+			continue
+		}
+		spanID := s.SpanID
+		if spanID == "" {
+			spanID = t.newSpanID()
+		}
+		var spanType string
+		switch {
+		case s.ParentID == "":
+			spanType = "root"
+		case s.Async:
+			spanType = "async"
+		case parents[spanKey{s.TraceID, spanID}]:
+			spanType = "mid"
+		default:
+			spanType = "leaf"
+		}
+
+		ev := t.builder.NewEvent()
+		ev.Timestamp = s.Start
+		for k, v := range s.Fields {
+			ev.AddField(k, v)
+		}
+		if s.Name != "" {
+			ev.AddField("name", s.Name)
+		}
+		ev.AddField("duration_ms", float64(s.Duration)/float64(time.Millisecond))
+		ev.AddField("trace.trace_id", s.TraceID)
+		if s.ParentID != "" {
+			ev.AddField("trace.parent_id", s.ParentID)
+		}
+		ev.AddField("trace.span_id", spanID)
+		ev.AddField("meta.span_type", spanType)
+		t.sendEvent(ev)
+	}
+	b.spans = nil
+	return nil
+}
+
+// newTrace creates the trace that sends the batch's spans with traceID. It
+// holds only what sendEvent needs: the trace's builder, config, and sampling
+// decision.
+func (b *Batch) newTrace(traceID string) *Trace {
+	o := b.opts
+	t := &Trace{
+		traceID:      traceID,
+		boxedTraceID: traceID,
+		config:       o.config,
+		builder:      o.newBuilder(),
+	}
+	if o.dataset != "" {
+		t.builder.Dataset = o.dataset
+	}
+	switch {
+	case o.drop:
+		t.sampleDecided = true
+	case o.sampleRate > 0:
+		t.sampleWith(o.sampleRate)
+	default:
+		t.headSample()
+	}
+	return t
+}
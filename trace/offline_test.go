@@ -0,0 +1,63 @@
+package trace
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatch(t *testing.T) {
+	mo := setupLibhoney()
+	start := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	var hooked []string
+	cfg := &Config{PresendHook: func(fields map[string]interface{}) {
+		hooked = append(hooked, fields["name"].(string))
+	}}
+	b := NewBatch(WithConfig(cfg), WithDataset("etl"))
+	b.Add(
+		RecordedSpan{TraceID: "t1", SpanID: "a", Name: "job", Start: start, Duration: 3 * time.Second},
+		RecordedSpan{TraceID: "t1", SpanID: "b", ParentID: "a", Name: "extract", Start: start, Duration: time.Second,
+			Fields: map[string]interface{}{"app.rows": 10}},
+		RecordedSpan{TraceID: "t1", ParentID: "b", Name: "read", Start: start, Duration: time.Millisecond},
+		RecordedSpan{TraceID: "t2", ParentID: "x", Name: "notify", Start: start.Add(time.Minute), Async: true},
+	)
+	assert.Equal(t, 4, b.Len())
+	assert.NoError(t, b.Send())
+	assert.Equal(t, 0, b.Len())
+
+	events := mo.Events()
+	assert.Equal(t, 4, len(events))
+	assert.Equal(t, []string{"job", "extract", "read", "notify"}, hooked, "spans should run through the config's hooks")
+	job, extract, read, notify := events[0], events[1], events[2], events[3]
+	assert.Equal(t, "etl", job.Dataset)
+	assert.Equal(t, start, job.Timestamp)
+	assert.Equal(t, float64(3000), job.Data["duration_ms"])
+	assert.Equal(t, "root", job.Data["meta.span_type"])
+	assert.NotContains(t, job.Data, "trace.parent_id")
+	assert.Equal(t, "a", extract.Data["trace.parent_id"])
+	assert.Equal(t, "mid", extract.Data["meta.span_type"])
+	assert.Equal(t, 10, extract.Data["app.rows"])
+	assert.Equal(t, "leaf", read.Data["meta.span_type"])
+	assert.NotEmpty(t, read.Data["trace.span_id"], "missing span IDs should be generated")
+	assert.Equal(t, "t2", notify.Data["trace.trace_id"])
+	assert.Equal(t, "async", notify.Data["meta.span_type"])
+
+	// invalid batches send nothing
+	mo = setupLibhoney()
+	b.Add(
+		RecordedSpan{TraceID: "t1", SpanID: "a", Start: start},
+		RecordedSpan{TraceID: "t1", SpanID: "a", Start: start},
+	)
+	assert.Error(t, b.Send())
+	b = NewBatch()
+	b.Add(RecordedSpan{TraceID: "t1", SpanID: "a"})
+	assert.Error(t, b.Send())
+	assert.Empty(t, mo.Events())
+
+	// traces are sampled as a whole
+	b = NewBatch(WithDrop())
+	b.Add(RecordedSpan{TraceID: "t1", Start: start})
+	assert.NoError(t, b.Send())
+	assert.Empty(t, mo.Events())
+}
@@ -0,0 +1,64 @@
+package trace
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// Priority says how much a span matters when spans have to be shed to save
+// memory or dropped because they can't be sent fast enough: verbose spans go
+// first and critical ones are kept. Root spans and spans with an error
+// recorded on them are always critical.
+type Priority int
+
+const (
+	// PriorityVerbose marks detail spans, like a database driver's row
+	// scans, that are the first to go.
+	PriorityVerbose Priority = -1
+	// PriorityNormal is the priority of spans that haven't been given one.
+	PriorityNormal Priority = 0
+	// PriorityCritical marks spans that should be kept as long as anything
+	// is.
+	PriorityCritical Priority = 1
+)
+
+// priorityField carries a span's priority, if it isn't PriorityNormal, to
+// senders that queue events, so they can drop verbose spans first too.
+const priorityField = "meta.priority"
+
+var priorityNames = map[Priority]string{
+	PriorityVerbose:  "verbose",
+	PriorityNormal:   "normal",
+	PriorityCritical: "critical",
+}
+
+// String returns the name of the priority, as sent in the meta.priority field.
+func (p Priority) String() string {
+	if name, ok := priorityNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("Priority(%d)", int(p))
+}
+
+// SetPriority sets the span's priority. It has no effect on root spans and
+// spans with an error recorded on them, which are always critical.
+func (s *Span) SetPriority(p Priority) {
+	atomic.StoreInt32(&s.priority, int32(p))
+}
+
+// Priority returns the span's priority: PriorityCritical for root spans and
+// spans with an error recorded on them, and otherwise the one set with
+// SetPriority.
+func (s *Span) Priority() Priority {
+	s.eventLock.Lock()
+	defer s.eventLock.Unlock()
+	return s.priorityLocked()
+}
+
+// priorityLocked returns the span's priority. The caller holds eventLock.
+func (s *Span) priorityLocked() Priority {
+	if s.isRoot || s.erred {
+		return PriorityCritical
+	}
+	return Priority(atomic.LoadInt32(&s.priority))
+}
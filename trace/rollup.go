@@ -0,0 +1,110 @@
+package trace
+
+import (
+	"math"
+	"strconv"
+)
+
+// rollupKeys names the root span's rollup fields.
+var rollupKeys = NewKeyPrefix("rollup.")
+
+// RollupKind says how the values added to a rollup key with AddRollupField
+// are combined into the trace's total on the root span.
+type RollupKind int
+
+const (
+	// RollupSum adds the values together. It is the default for keys that
+	// aren't registered in Config.Rollups.
+	RollupSum RollupKind = iota
+	// RollupCount counts the values, ignoring what they are.
+	RollupCount
+	// RollupMin and RollupMax keep the smallest and largest value.
+	RollupMin
+	RollupMax
+	// RollupAvg keeps the mean of the values. Adding 1 for every hit and 0
+	// for every miss gives a hit ratio.
+	RollupAvg
+	// RollupHistogram counts the values falling at or below each of the
+	// rollup's Buckets, in fields named rollup.<key>.le_<bucket>, with
+	// rollup.<key>.le_inf counting every value.
+	RollupHistogram
+)
+
+// Rollup registers how a rollup key's values are combined. Buckets are the
+// upper bounds of a RollupHistogram's buckets, in increasing order; other
+// kinds ignore them.
+type Rollup struct {
+	Kind    RollupKind
+	Buckets []float64
+}
+
+// rollupAgg combines the values added to a rollup key whose Rollup isn't a
+// sum.
+type rollupAgg struct {
+	rollup Rollup
+	count  float64
+	sum    float64
+	min    float64
+	max    float64
+	// buckets holds the number of values at or below each of the rollup's
+	// Buckets, but not below the one before it.
+	buckets []float64
+}
+
+func newRollupAgg(r Rollup) *rollupAgg {
+	a := &rollupAgg{
+		rollup: r,
+		min:    math.Inf(1),
+		max:    math.Inf(-1),
+	}
+	if r.Kind == RollupHistogram {
+		a.buckets = make([]float64, len(r.Buckets))
+	}
+	return a
+}
+
+func (a *rollupAgg) add(val float64) {
+	a.count++
+	a.sum += val
+	if val < a.min {
+		a.min = val
+	}
+	if val > a.max {
+		a.max = val
+	}
+	for i, bound := range a.rollup.Buckets {
+		if i < len(a.buckets) && val <= bound {
+			a.buckets[i]++
+			break
+		}
+	}
+}
+
+// fields calls field with the name, without the rollup. prefix, and value of
+// each field the rollup adds to the root span.
+func (a *rollupAgg) fields(key string, field func(string, float64)) {
+	if a.count == 0 {
+		return
+	}
+	switch a.rollup.Kind {
+	case RollupCount:
+		field(key, a.count)
+	case RollupMin:
+		field(key, a.min)
+	case RollupMax:
+		field(key, a.max)
+	case RollupAvg:
+		field(key, a.sum/a.count)
+	case RollupHistogram:
+		// report cumulative counts, like the le buckets of a Prometheus
+		// histogram
+		var total float64
+		for i, bound := range a.rollup.Buckets {
+			total += a.buckets[i]
+			field(key+".le_"+strconv.FormatFloat(bound, 'g', -1, 64), total)
+		}
+		field(key+".le_inf", a.count)
+	default:
+		field(key, a.sum)
+	}
+}
@@ -0,0 +1,91 @@
+package trace
+
+// FieldNaming chooses the names the fields added by the wrappers are sent
+// with.
+type FieldNaming int
+
+const (
+	// FieldNamingLegacy sends fields with the beeline's own names, like
+	// request.method and db.query.
+	FieldNamingLegacy FieldNaming = iota
+	// FieldNamingSemConv sends fields that have an OpenTelemetry semantic
+	// convention with its name instead, like http.request.method and
+	// db.query.text.
+	FieldNamingSemConv
+	// FieldNamingBoth sends those fields with both names, so queries and
+	// dashboards can move from one to the other a piece at a time.
+	FieldNamingBoth
+)
+
+// semConvNames maps the beeline's field names to the names of the
+// OpenTelemetry semantic conventions for the same attributes.
+var semConvNames = map[string]string{
+	"request.method":            "http.request.method",
+	"request.path":              "url.path",
+	"request.query":             "url.query",
+	"request.url":               "url.full",
+	"request.host":              "server.address",
+	"request.route":             "http.route",
+	"request.http_version":      "network.protocol.version",
+	"request.client_ip":         "client.address",
+	"request.remote_addr":       "network.peer.address",
+	"request.content_length":    "http.request.body.size",
+	"request.header.user_agent": "user_agent.original",
+	"request.tls.version":       "tls.protocol.version",
+	"request.tls.cipher_suite":  "tls.cipher",
+	"request.tls.server_name":   "tls.client.server_name",
+	"response.status_code":      "http.response.status_code",
+	"response.content_length":   "http.response.body.size",
+	"response.grpc_status_code": "rpc.grpc.status_code",
+	"db.query":                  "db.query.text",
+	"db.call":                   "db.operation.name",
+	"grpc.service":              "rpc.service",
+	"grpc.method":               "rpc.method",
+}
+
+// SemanticConventionNames returns the mapping FieldNamingSemConv and
+// FieldNamingBoth use from the beeline's field names to OpenTelemetry
+// semantic convention names, eg to rewrite saved queries. Config.FieldNames
+// adds to and overrides it.
+func SemanticConventionNames() map[string]string {
+	names := make(map[string]string, len(semConvNames))
+	for k, v := range semConvNames {
+		names[k] = v
+	}
+	return names
+}
+
+// applyFieldNaming renames or copies the fields that have semantic
+// convention names, according to naming. overrides are consulted before the
+// built-in mapping; an empty name leaves the field as it is.
+func applyFieldNaming(fields map[string]interface{}, naming FieldNaming, overrides map[string]string) {
+	if naming == FieldNamingLegacy {
+		return
+	}
+	var renames map[string]string
+	for k := range fields {
+		name, ok := overrides[k]
+		if !ok {
+			name, ok = semConvNames[k]
+		}
+		if !ok || name == "" || name == k {
+			continue
+		}
+		if renames == nil {
+			renames = make(map[string]string)
+		}
+		renames[k] = name
+	}
+	// read every value before writing any, in case a field is renamed to
+	// the name of another
+	values := make(map[string]interface{}, len(renames))
+	for from := range renames {
+		values[from] = fields[from]
+		if naming == FieldNamingSemConv {
+			delete(fields, from)
+		}
+	}
+	for from, to := range renames {
+		fields[to] = values[from]
+	}
+}
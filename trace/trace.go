@@ -4,12 +4,17 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"runtime"
+	"runtime/pprof"
+	rtrace "runtime/trace"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/honeycombio/beeline-go/client"
 	"github.com/honeycombio/beeline-go/propagation"
 	"github.com/honeycombio/beeline-go/sample"
+	"github.com/honeycombio/beeline-go/scrub"
 	libhoney "github.com/honeycombio/libhoney-go"
 )
 
@@ -18,8 +23,23 @@ const (
 	spanIDLengthBytes  = 8
 )
 
+// GlobalConfig is the Config used by traces that were not given one with
+// WithConfig when they were created. Traces read it when they are created, so
+// changes made with SetGlobalConfig apply to traces started afterward.
 var GlobalConfig Config
 
+// globalConfigLock guards GlobalConfig against changes made by
+// SetGlobalConfig.
+var globalConfigLock sync.RWMutex
+
+// SetGlobalConfig replaces GlobalConfig. Unlike assigning to GlobalConfig
+// directly, it is safe to call while other goroutines are starting traces.
+func SetGlobalConfig(cfg Config) {
+	globalConfigLock.Lock()
+	defer globalConfigLock.Unlock()
+	GlobalConfig = cfg
+}
+
 type Config struct {
 	// SamplerHook is a function to manage sampling on this trace. See the docs
 	// for `beeline.Config` for a full description.
@@ -27,65 +47,494 @@ type Config struct {
 	// PresendHook is a function to mutate spans just before they are sent to
 	// Honeycomb. See the docs for `beeline.Config` for a full description.
 	PresendHook func(map[string]interface{})
+	// SpanNameHook is a function to rewrite span names just before they are
+	// sent. See the docs for `beeline.Config` for a full description.
+	SpanNameHook func(name string, fields map[string]interface{}) string
+	// Sampler is the sampler used when no SamplerHook is set. If it is nil,
+	// sample.GlobalSampler is used instead.
+	Sampler *sample.DeterministicSampler
+	// ContextFields, if set, is called with the context each span is started
+	// from, and the fields it returns are added to the span. See the docs for
+	// `beeline.Config` for a full description.
+	ContextFields func(context.Context) map[string]interface{}
+	// Scrubber, if set, removes sensitive fields and values from events
+	// after the PresendHook runs. See the docs for `beeline.Config` for a
+	// full description.
+	Scrubber *scrub.Scrubber
+	// MaxTraceDuration, if positive, is how long a trace may run before any
+	// spans in it that haven't been sent are sent with meta.expired set. See
+	// the docs for `beeline.Config` for a full description.
+	MaxTraceDuration time.Duration
+	// MaxSpansPerTrace, if positive, caps the number of spans sent for each
+	// trace. See the docs for `beeline.Config` for a full description.
+	MaxSpansPerTrace uint
+	// Clock, if set, is used instead of time.Now for span timestamps and
+	// durations. NewTraceID and NewSpanID, if set, generate trace and span
+	// IDs. They let tests produce stable events; see the docs for
+	// `beeline.Config` for a full description.
+	Clock      func() time.Time
+	NewTraceID func() string
+	NewSpanID  func() string
+	// ProfilerLabels, if set, lets LabelProfiles set pprof labels on the
+	// goroutine that starts a span.
+	ProfilerLabels bool
+	// ExecutionTraceRegions, if set, lets TraceExecution open a runtime/trace
+	// task and region for a span.
+	ExecutionTraceRegions bool
+	// PropagationFormats are the header formats PropagationHeaders emits.
+	// If it is empty, only the Honeycomb header is emitted.
+	PropagationFormats []propagation.Format
+	// TrustPolicy, if set, decides how much of the incoming trace context
+	// new traces honor. See the docs for `beeline.Config` for a full
+	// description.
+	TrustPolicy *propagation.TrustPolicy
+	// MaxTraceHops, if positive, is the most process boundaries an incoming
+	// trace may have crossed before a fresh trace is started instead. See
+	// the docs for `beeline.Config` for a full description.
+	MaxTraceHops uint
+	// OrphanedSpanHook, if set, is called with each synchronous span that
+	// was still unsent when an ancestor was sent, and so was sent by it.
+	// OrphanGoroutineDump, if set, includes a dump of every goroutine's
+	// stack with the first orphan each Send finds. See the docs for
+	// `beeline.Config` for a full description.
+	OrphanedSpanHook    func(OrphanedSpan)
+	OrphanGoroutineDump bool
+	// Rollups registers how the values added to rollup keys are combined on
+	// the root span. Keys that aren't registered are summed. See the docs for
+	// `beeline.Config` for a full description.
+	Rollups map[string]Rollup
+	// LateChildren decides what happens to children created from a span
+	// that has already been sent. See the docs for `beeline.Config` for a
+	// full description.
+	LateChildren LateChildPolicy
+	// FieldPrefixes renames field namespaces, the part of field names before
+	// the first dot, as events are sent. See the docs for `beeline.Config`
+	// for a full description.
+	FieldPrefixes map[string]string
+	// FieldNaming, if not FieldNamingLegacy, sends fields that have an
+	// OpenTelemetry semantic convention with its name, instead of or as
+	// well as their own. FieldNames adds to and overrides the mapping. See
+	// the docs for `beeline.Config` for a full description.
+	FieldNaming FieldNaming
+	FieldNames  map[string]string
+	// DatasetRoutes send the spans they match to other datasets. See the
+	// docs for `beeline.Config` for a full description.
+	DatasetRoutes []DatasetRoute
+	// MaxSpanDuration, if positive, is the longest duration the Clock may
+	// report for a span before it is treated as a clock step. See the docs
+	// for `beeline.Config` for a full description.
+	MaxSpanDuration time.Duration
+	// ErrorReporter, if set, is called with each error recorded on a span
+	// as it is sent. See the docs for `beeline.Config` for a full
+	// description.
+	ErrorReporter func(SpanError)
+	// ContextDeadlines records the deadlines and cancellation of the
+	// contexts spans are started with. See the docs for `beeline.Config` for
+	// a full description.
+	ContextDeadlines bool
+	// RootFields are added to the root span of every trace, eg the build
+	// info fields added by the beeline. See the docs for
+	// `beeline.Config.OmitBuildInfo` for a full description.
+	RootFields map[string]interface{}
+	// MemoryBudget, if set, limits the memory held by open spans across
+	// every trace using it. See the docs for `beeline.Config.MaxSpanMemory`
+	// for a full description.
+	MemoryBudget *MemoryBudget
+	// CollapseSpans summarize the child spans they match in fields on the
+	// root span instead of sending them. See the docs for `beeline.Config`
+	// for a full description.
+	CollapseSpans []CollapseRule
+	// CompressSiblings, if at least 2, is the number of consecutive similar
+	// sibling spans that are sent as a single span summarizing them. See
+	// the docs for `beeline.Config` for a full description.
+	CompressSiblings uint
+	// Exemplars is the number of the spans collapsed under each name, or
+	// compressed into each span, that are sent as well. See the docs for
+	// `beeline.Config` for a full description.
+	Exemplars uint
+	// CorrelationHeaders maps the names of correlation IDs to the headers
+	// they are read from and sent in. See the docs for `beeline.Config` for
+	// a full description.
+	CorrelationHeaders map[string]string
 }
 
+// LateChildPolicy decides what happens to a child created from a span that
+// has already been sent, usually because a goroutine outlived the request
+// that started it. Such children are marked with meta.late whatever the
+// policy.
+type LateChildPolicy int
+
+const (
+	// LateChildKeep creates late children of the sent span, as usual. Since
+	// the span won't send them, they reach Honeycomb only if they are sent
+	// themselves.
+	LateChildKeep LateChildPolicy = iota
+	// LateChildToRoot creates late children of the trace's root span
+	// instead, if it hasn't been sent, with meta.late_parent_id set to the
+	// sent span's ID. Otherwise they are handled like LateChildNewRoot.
+	LateChildToRoot
+	// LateChildNewRoot starts a new trace for each late child, whose root
+	// span is the child. It carries the original trace's trace level fields,
+	// and has a link to the sent span.
+	LateChildNewRoot
+)
+
+// OrphanedSpan describes a synchronous span that was still unsent when an
+// ancestor was sent. Spans like these usually mean a missing call to Send, or
+// a span that should have been async.
+type OrphanedSpan struct {
+	// Span is the orphaned span, just before it is sent. The hook may add
+	// fields to it, but must not send it.
+	Span *Span
+	// SentBy is the span whose Send swept up the orphan.
+	SentBy *Span
+	// Unfinished is how long the orphan had been running when it was sent.
+	Unfinished time.Duration
+	// Goroutines is a dump of every goroutine's stack, taken when the orphan
+	// was found, if the trace's config has OrphanGoroutineDump set. Orphans
+	// swept up by the same Send share a dump.
+	Goroutines []byte
+}
+
+// maxGoroutineDump caps the size of the goroutine dump taken for orphaned
+// spans.
+const maxGoroutineDump = 64 << 10
+
 // Trace holds some trace level state and the root of the span tree that will be
 // the entire in-process trace. Traces are sent to Honeycomb when the root span
 // is sent. You can send a trace manually, and that will cause all
 // synchronous  spans in the trace to be sent and sent. Asynchronous spans
 // must still be sent on their own
 type Trace struct {
-	builder          *libhoney.Builder
+	builder *libhoney.Builder
+	traceID string
+	// boxedTraceID is traceID as an interface, so it isn't boxed again for
+	// every span
+	boxedTraceID interface{}
+	// sampleDecided is set if the trace's sampling decision was made when it
+	// was created, in which case keep and sampleRate hold the decision.
+	sampleDecided bool
+	keep          bool
+	sampleRate    uint
+	parentID      string
+	rollupFields  map[string]float64
+	rollupLock    sync.Mutex
+	rootSpan      *Span
+	// traceLevelFields holds the trace's fields in a map[string]interface{}
+	// that is never modified once stored, so that every span sent can read
+	// it without locking. Writers take tlfLock and store a modified copy.
+	// Nothing is stored in traces that can't have trace level fields.
+	traceLevelFields atomic.Value
+	tlfLock          sync.Mutex
+	config           *Config
+	// openSpans holds the spans that haven't been sent yet, spread across
+	// shards so that concurrent children don't all contend for one lock,
+	// and openCount counts them. They are only kept when the trace has a
+	// MaxTraceDuration, so they can be found when it expires.
+	openSpans   *[openShards]openShard
+	openCount   int32
+	nextShard   uint32
+	expiryTimer *time.Timer
+	// budget is the Config's MemoryBudget, if the trace's spans are
+	// accounted for in one.
+	budget *MemoryBudget
+
+	// collapsed summarizes the spans collapsed by the CollapseSpans rules,
+	// under collapseLock, until collapseDone is set when the root span is
+	// sent.
+	collapsed    map[string]*spanAggregate
+	collapseLock sync.Mutex
+	collapseDone bool
+	// spanCount is the number of spans created in the trace, and
+	// summarySpan stands in for the spans created after MaxSpansPerTrace is
+	// reached.
+	spanCount   uint32
+	summaryOnce sync.Once
+	summarySpan *Span
+	// timings holds the total duration in milliseconds of the sent spans
+	// with each of the names given to RecordTimings
+	timings    map[string]float64
+	timingLock sync.Mutex
+	// hops is the number of process boundaries the trace crossed to reach
+	// this process
+	hops uint
+	// rollupsSent is set, under rollupLock, once the root span has been sent
+	// with the trace's rollup totals. lateRollups then collects the values
+	// added since, and openAsync counts the async spans that may still add
+	// them, so they can be sent in a follow-up event once the last finishes.
+	rollupsSent bool
+	lateRollups map[string]float64
+	openAsync   int32
+	// rollupAggs and lateAggs hold the keys registered in Config.Rollups
+	// with a kind other than RollupSum, under rollupLock.
+	rollupAggs map[string]*rollupAgg
+	lateAggs   map[string]*rollupAgg
+	// checkpointTimer fires every checkpointInterval in sessions started
+	// with WithCheckpoints, until the root span is sent. checkpoints counts
+	// the checkpoints sent, and checkpointsDone is set once the root span
+	// has been sent.
+	checkpointTimer    *time.Timer
+	checkpointInterval time.Duration
+	checkpointLock     sync.Mutex
+	checkpoints        int
+	checkpointsDone    bool
+}
+
+// Option configures a trace as it is created. Options are applied before the
+// root span is built, so they affect every span in the trace.
+type Option func(*options)
+
+// options collects the settings applied by a list of Options.
+type options struct {
+	dataset string
+	client  *libhoney.Client
+	builder *libhoney.Builder
+	config  *Config
+	drop    bool
+	// sampleRate, if set, overrides the config's sampler
+	sampleRate uint
+	// source is where the propagation context came from
+	source *propagation.Source
+	// checkpointInterval, if set, makes the trace a session
+	checkpointInterval time.Duration
+	// traceID, if set, is the ID of a new trace, derived from a key in
+	// traceIDNamespace
 	traceID          string
-	parentID         string
-	rollupFields     map[string]float64
-	rollupLock       sync.Mutex
-	rootSpan         *Span
-	tlfLock          sync.RWMutex
-	traceLevelFields map[string]interface{}
+	traceIDNamespace string
+}
+
+// newOptions applies opts, filling in the config from GlobalConfig if none
+// was given.
+func newOptions(opts []Option) options {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.config == nil {
+		// capture the global settings so changes made while the trace is
+		// running don't apply to only some of its spans
+		cfg := currentGlobalConfig()
+		if cfg.SamplerHook == nil && cfg.Sampler == nil {
+			cfg.Sampler = sample.GlobalSampler
+		}
+		o.config = &cfg
+	}
+	return o
+}
+
+// newBuilder returns the builder a trace created with o makes its events
+// from.
+func (o *options) newBuilder() *libhoney.Builder {
+	switch {
+	case o.builder != nil:
+		return o.builder.Clone()
+	case o.client != nil:
+		return o.client.NewBuilder()
+	default:
+		return client.NewBuilder()
+	}
+}
+
+// WithDataset overrides the dataset to which every span in the new trace will
+// be sent. It takes precedence over a dataset carried in an incoming
+// propagation context, and is itself propagated to downstream services. This
+// lets a single process send different kinds of traces (eg web requests and
+// batch jobs) to different datasets.
+func WithDataset(dataset string) Option {
+	return func(o *options) {
+		o.dataset = dataset
+	}
+}
+
+// WithClient sends all spans in the new trace using c instead of the client
+// stored in the client package.
+func WithClient(c *libhoney.Client) Option {
+	return func(o *options) {
+		o.client = c
+	}
+}
+
+// WithBuilder creates the new trace's events from a clone of b instead of a
+// builder from the client package. Fields, write key, and dataset set on b are
+// inherited by every span in the trace. It takes precedence over WithClient.
+func WithBuilder(b *libhoney.Builder) Option {
+	return func(o *options) {
+		o.builder = b
+	}
+}
+
+// WithConfig uses cfg for the new trace's hooks and sampler instead of
+// GlobalConfig. cfg should not be modified after it is handed to a trace.
+func WithConfig(cfg *Config) Option {
+	return func(o *options) {
+		o.config = cfg
+	}
+}
+
+// WithDrop drops the new trace regardless of sampling: none of its spans are
+// sent, and like spans in traces dropped by the sampler they cost very little
+// to create and annotate. The trace is still propagated to downstream
+// services, which make their own sampling decisions.
+func WithDrop() Option {
+	return func(o *options) {
+		o.drop = true
+	}
+}
+
+// WithSampleRate samples the new trace at rate, deterministically by trace
+// ID, instead of using the config's Sampler or SamplerHook. Use it for kinds
+// of traces that are much more or less interesting than the rest.
+func WithSampleRate(rate uint) Option {
+	return func(o *options) {
+		o.sampleRate = rate
+	}
+}
+
+// WithSource tells the config's TrustPolicy where the new trace's
+// propagation context came from, eg the peer and headers of an incoming
+// request, so it can decide whether to honor it. Without it, no source is
+// trusted.
+func WithSource(src *propagation.Source) Option {
+	return func(o *options) {
+		o.source = src
+	}
+}
+
+// WithCheckpoints makes the new trace a long-running session, like a game
+// session or a stream processor's run, whose root span stays open for hours.
+// Every interval, the trace checkpoints: see Checkpoint. Sessions aren't
+// expired by the config's MaxTraceDuration, since they are expected to
+// outlive it.
+func WithCheckpoints(interval time.Duration) Option {
+	return func(o *options) {
+		o.checkpointInterval = interval
+	}
 }
 
 // getNewID generates a lowercase hex encoded string with the specified number
 // of bytes. It is used for ID generation for traces and spans.
 func getNewID(length uint16) string {
-	id := make([]byte, length)
+	// use a buffer on the stack for the common lengths to save an allocation
+	var buf [traceIDLengthBytes]byte
+	var id []byte
+	if int(length) <= len(buf) {
+		id = buf[:length]
+	} else {
+		id = make([]byte, length)
+	}
 	// rand.Seed is called in libhoney's init, so this is sure to have well-seeded random content.
 	_, _ = rand.Read(id)
 	return hex.EncodeToString(id)
 }
 
 // NewTraceFromPropagationContext creates a brand new trace. prop is optional, and if included,
-// should be populated with data from a trace context header.
-func NewTraceFromPropagationContext(ctx context.Context, prop *propagation.PropagationContext) (context.Context, *Trace) {
+// should be populated with data from a trace context header. Any opts given are
+// applied to the new trace.
+func NewTraceFromPropagationContext(ctx context.Context, prop *propagation.PropagationContext, opts ...Option) (context.Context, *Trace) {
+	o := newOptions(opts)
 	trace := &Trace{
-		builder:          client.NewBuilder(),
-		rollupFields:     make(map[string]float64),
-		traceLevelFields: make(map[string]interface{}),
+		rollupFields: make(map[string]float64),
+		config:       o.config,
+		builder:      o.newBuilder(),
 	}
+	traceFields := make(map[string]interface{})
 
+	untrusted := false
+	if prop != nil && o.config.TrustPolicy != nil {
+		honored := o.config.TrustPolicy.Apply(prop, o.source)
+		untrusted = honored != prop
+		prop = honored
+	}
+	var loopedTraceID string
+	if prop != nil && o.config.MaxTraceHops > 0 && prop.Hops > o.config.MaxTraceHops {
+		// the trace has probably looped back through this service; start
+		// over rather than adding to it forever
+		loopedTraceID = prop.TraceID
+		prop = nil
+	}
 	if prop != nil {
 		trace.traceID = prop.TraceID
 		trace.parentID = prop.ParentID
+		trace.hops = prop.Hops
 		for k, v := range prop.TraceContext {
-			trace.traceLevelFields[k] = v
+			traceFields[k] = v
 		}
 		if prop.Dataset != "" {
 			trace.builder.Dataset = prop.Dataset
 		}
 	}
+	if len(o.config.CorrelationHeaders) > 0 && o.source != nil && o.source.Header != nil {
+		addCorrelationHeaders(traceFields, o.config.CorrelationHeaders, o.source.Header)
+	}
+	trace.traceLevelFields.Store(traceFields)
+	if o.dataset != "" {
+		trace.builder.Dataset = o.dataset
+	}
 
+	external := false
+	if trace.traceID == "" && o.traceID != "" && loopedTraceID == "" {
+		trace.traceID = o.traceID
+		external = true
+	}
 	if trace.traceID == "" {
-		trace.traceID = getNewID(traceIDLengthBytes)
+		if o.config.NewTraceID != nil {
+			trace.traceID = o.config.NewTraceID()
+		} else {
+			trace.traceID = getNewID(traceIDLengthBytes)
+		}
+	}
+	trace.boxedTraceID = trace.traceID
+	switch {
+	case o.drop:
+		trace.sampleDecided = true
+	case o.sampleRate > 0:
+		trace.sampleWith(o.sampleRate)
+	default:
+		trace.headSample()
 	}
 
-	rootSpan := newSpan()
+	rootSpan := newSpan(trace)
 	rootSpan.isRoot = true
 	if trace.parentID != "" {
 		rootSpan.parentID = trace.parentID
 	}
-	rootSpan.ev = trace.builder.NewEvent()
-	rootSpan.trace = trace
 	trace.rootSpan = rootSpan
+	if trace.isDropped() {
+		// spans in dropped traces have no events, so adding fields to them
+		// does nothing
+		ctx = PutTraceInContext(ctx, trace)
+		ctx = PutSpanInContext(ctx, rootSpan)
+		return ctx, trace
+	}
+	rootSpan.ev = trace.builder.NewEvent()
+	rootSpan.ev.Timestamp = rootSpan.started
+	trace.spanCount = 1
+	if o.config.MemoryBudget != nil {
+		trace.budget = o.config.MemoryBudget
+		trace.budget.track(rootSpan)
+	}
+	if o.checkpointInterval > 0 {
+		trace.checkpointInterval = o.checkpointInterval
+		trace.checkpointTimer = time.AfterFunc(o.checkpointInterval, trace.checkpointTick)
+	} else if o.config.MaxTraceDuration > 0 {
+		trace.openSpans = new([openShards]openShard)
+		trace.trackSpan(rootSpan)
+		trace.expiryTimer = time.AfterFunc(o.config.MaxTraceDuration, trace.expire)
+	}
+	for k, v := range o.config.RootFields {
+		rootSpan.AddField(k, v)
+	}
+	rootSpan.addContextFields(ctx)
+	if untrusted {
+		rootSpan.AddField("meta.untrusted_trace_context", true)
+	}
+	if external {
+		rootSpan.AddField("meta.trace_id_namespace", o.traceIDNamespace)
+	}
+	if loopedTraceID != "" {
+		rootSpan.AddField("meta.max_trace_hops_exceeded", true)
+		rootSpan.AddField("meta.previous_trace_id", loopedTraceID)
+	}
 
 	// put trace and root span in context
 	ctx = PutTraceInContext(ctx, trace)
@@ -120,11 +569,38 @@ func NewTrace(ctx context.Context, serializedHeaders string) (context.Context, *
 func (t *Trace) AddField(key string, val interface{}) {
 	t.tlfLock.Lock()
 	defer t.tlfLock.Unlock()
-	if t.traceLevelFields != nil {
-		t.traceLevelFields[key] = val
+	if old, ok := t.traceLevelFields.Load().(map[string]interface{}); ok {
+		fields := copyFields(old, 1)
+		fields[key] = val
+		t.traceLevelFields.Store(fields)
 	}
 }
 
+// AddFields adds all of fields to the trace at once. See AddField.
+func (t *Trace) AddFields(fields map[string]interface{}) {
+	if len(fields) == 0 {
+		return
+	}
+	t.tlfLock.Lock()
+	defer t.tlfLock.Unlock()
+	if old, ok := t.traceLevelFields.Load().(map[string]interface{}); ok {
+		merged := copyFields(old, len(fields))
+		for k, v := range fields {
+			merged[k] = v
+		}
+		t.traceLevelFields.Store(merged)
+	}
+}
+
+// copyFields returns a copy of fields with room for extra more.
+func copyFields(fields map[string]interface{}, extra int) map[string]interface{} {
+	c := make(map[string]interface{}, len(fields)+extra)
+	for k, v := range fields {
+		c[k] = v
+	}
+	return c
+}
+
 // serializeHeaders returns the trace ID, given span ID as parent ID, and an
 // encoded form of all trace level fields. This serialized header is intended
 // to be put in an HTTP (or other protocol) header to transmit to downstream
@@ -132,51 +608,348 @@ func (t *Trace) AddField(key string, val interface{}) {
 // The serialized form may be passed to NewTrace() in order to create a new
 // trace that will be connected to this trace.
 func (t *Trace) serializeHeaders(spanID string) string {
+	fields, _ := t.traceLevelFields.Load().(map[string]interface{})
 	var prop = &propagation.PropagationContext{
 		TraceID:      t.traceID,
 		ParentID:     spanID,
 		Dataset:      t.builder.Dataset,
-		TraceContext: t.traceLevelFields,
+		TraceContext: fields,
+		Hops:         t.hops + 1,
 	}
-	t.tlfLock.RLock()
-	defer t.tlfLock.RUnlock()
 	return propagation.MarshalTraceContext(prop)
 }
 
 // addRollupField is here to let a span contribute a field to the trace while
 // keeping the trace's locks private.
 func (t *Trace) addRollupField(key string, val float64) {
+	rollup, registered := t.getConfig().Rollups[key]
 	t.rollupLock.Lock()
 	defer t.rollupLock.Unlock()
+	if registered && rollup.Kind != RollupSum {
+		if t.rollupAggs == nil {
+			t.rollupAggs = make(map[string]*rollupAgg)
+		}
+		addToRollupAgg(t.rollupAggs, key, rollup, val)
+		if t.rollupsSent {
+			if t.lateAggs == nil {
+				t.lateAggs = make(map[string]*rollupAgg)
+			}
+			addToRollupAgg(t.lateAggs, key, rollup, val)
+		}
+		return
+	}
 	if t.rollupFields != nil {
 		t.rollupFields[key] += val
 	}
+	if t.rollupsSent {
+		if t.lateRollups == nil {
+			t.lateRollups = make(map[string]float64)
+		}
+		t.lateRollups[key] += val
+	}
+}
+
+func addToRollupAgg(aggs map[string]*rollupAgg, key string, rollup Rollup, val float64) {
+	agg, ok := aggs[key]
+	if !ok {
+		agg = newRollupAgg(rollup)
+		aggs[key] = agg
+	}
+	agg.add(val)
 }
 
 // getTraceLevelFields is here to let a span retrieve trace level fields to add
-// them to itself just before sending while keeping the trace's locks around
-// that field private.
+// them to itself just before sending. It returns the trace's current fields,
+// which are shared and must not be modified, or nil if there are none.
 func (t *Trace) getTraceLevelFields() map[string]interface{} {
-	t.tlfLock.Lock()
-	defer t.tlfLock.Unlock()
-	// return a copy of trace level fields
-	retVals := make(map[string]interface{})
-	for k, v := range t.traceLevelFields {
-		retVals[k] = v
+	fields, _ := t.traceLevelFields.Load().(map[string]interface{})
+	if len(fields) == 0 {
+		return nil
 	}
-	return retVals
+	return fields
 }
 
+// getRollupFields returns the trace's rollup totals for the root span, after
+// which any values added are late and sent by flushLateRollups instead.
 func (t *Trace) getRollupFields() map[string]interface{} {
 	t.rollupLock.Lock()
 	defer t.rollupLock.Unlock()
+	t.rollupsSent = true
 	rollupFields := make(map[string]interface{})
 	for k, v := range t.rollupFields {
 		rollupFields[k] = v
 	}
+	for k, agg := range t.rollupAggs {
+		agg.fields(k, func(name string, v float64) {
+			rollupFields[name] = v
+		})
+	}
 	return rollupFields
 }
 
+// RollupTotals returns the trace's rollup totals, combining the values added
+// with AddRollupField across every span in the trace so far, including those
+// added after the root span was sent. Keys are the names of the root span's
+// rollup fields, without the rollup. prefix.
+func (t *Trace) RollupTotals() map[string]float64 {
+	t.rollupLock.Lock()
+	defer t.rollupLock.Unlock()
+	totals := make(map[string]float64, len(t.rollupFields)+len(t.rollupAggs))
+	for k, v := range t.rollupFields {
+		totals[k] = v
+	}
+	for k, agg := range t.rollupAggs {
+		agg.fields(k, func(name string, v float64) {
+			totals[name] = v
+		})
+	}
+	return totals
+}
+
+// flushLateRollups sends the rollup values added since the root span was sent
+// as a span event on the root span, so async spans that finish after the root
+// still count toward the trace's totals. It is called once the last async span
+// is sent, and after the trace expires or a span sweeps up orphaned children,
+// in case async spans that will never be sent are keeping it from happening. Each key gets a rollup. field, like
+// the root span's, combining the values added since the root span or the
+// previous flush was sent.
+func (t *Trace) flushLateRollups() {
+	t.rollupLock.Lock()
+	late, lateAggs := t.lateRollups, t.lateAggs
+	t.lateRollups, t.lateAggs = nil, nil
+	t.rollupLock.Unlock()
+	if len(late) == 0 && len(lateAggs) == 0 {
+		return
+	}
+	fields := make(map[string]interface{}, len(late)+len(lateAggs)+1)
+	for k, v := range late {
+		fields[rollupKeys.Key(k)] = v
+	}
+	for k, agg := range lateAggs {
+		agg.fields(k, func(name string, v float64) {
+			fields[rollupKeys.Key(name)] = v
+		})
+	}
+	fields["meta.late_rollup"] = true
+	t.rootSpan.SendSpanEvent("late_rollups", fields)
+}
+
+// headSample makes the trace's sampling decision up front when it can. With
+// no SamplerHook the decision depends only on the trace ID, so there's no
+// need to wait until spans are sent, and traces that will be dropped can skip
+// building their spans entirely.
+func (t *Trace) headSample() {
+	cfg := t.getConfig()
+	if cfg.SamplerHook != nil {
+		return
+	}
+	sampler := cfg.Sampler
+	if sampler == nil {
+		sampler = sample.GlobalSampler
+	}
+	if sampler == nil {
+		return
+	}
+	t.sampleDecided = true
+	t.keep = sampler.Sample(t.traceID)
+	t.sampleRate = uint(sampler.GetSampleRate())
+}
+
+// sampleWith decides whether to keep t with a deterministic sampler at rate.
+func (t *Trace) sampleWith(rate uint) {
+	sampler, err := sample.NewDeterministicSampler(rate)
+	if err != nil {
+		t.headSample()
+		return
+	}
+	t.sampleDecided = true
+	t.keep = sampler.Sample(t.traceID)
+	t.sampleRate = rate
+}
+
+// isDropped reports whether the trace was dropped by head sampling.
+func (t *Trace) isDropped() bool {
+	return t.sampleDecided && !t.keep
+}
+
+// Checkpoint sends a snapshot of the trace's root span while it is still
+// open, so a long-running session can be queried before it ends. Spans are
+// sent as they finish, so a session only holds the ones still running, but
+// its root span isn't sent until the session ends. The snapshot is a span
+// event on the root span named checkpoint, carrying the root span's fields so
+// far, the trace's rollup totals so far as rollup. fields, the number of the
+// checkpoint in meta.checkpoint, and the session's age in
+// meta.session_elapsed_ms. Sessions started with WithCheckpoints call it
+// periodically, but it may be called at any time. It does nothing once the
+// root span has been sent.
+func (t *Trace) Checkpoint() {
+	t.checkpointLock.Lock()
+	if t.checkpointsDone {
+		t.checkpointLock.Unlock()
+		return
+	}
+	t.checkpoints++
+	n := t.checkpoints
+	t.checkpointLock.Unlock()
+
+	root := t.rootSpan
+	fields := make(map[string]interface{})
+	root.eventLock.Lock()
+	if root.ev == nil || root.eventSent {
+		root.eventLock.Unlock()
+		return
+	}
+	for k, v := range root.ev.Fields() {
+		fields[k] = v
+	}
+	root.eventLock.Unlock()
+	delete(fields, "name")
+	for k, v := range t.RollupTotals() {
+		fields[rollupKeys.Key(k)] = v
+	}
+	fields["meta.checkpoint"] = n
+	fields["meta.session_elapsed_ms"] = t.millisecondsSince(root.started)
+	root.SendSpanEvent("checkpoint", fields)
+}
+
+// checkpointTick checkpoints a session and schedules the next checkpoint.
+func (t *Trace) checkpointTick() {
+	t.Checkpoint()
+	t.checkpointLock.Lock()
+	defer t.checkpointLock.Unlock()
+	if !t.checkpointsDone {
+		t.checkpointTimer.Reset(t.checkpointInterval)
+	}
+}
+
+// stopCheckpoints stops a session's checkpoints once its root span is sent.
+func (t *Trace) stopCheckpoints() {
+	if t.checkpointTimer == nil {
+		return
+	}
+	t.checkpointLock.Lock()
+	defer t.checkpointLock.Unlock()
+	t.checkpointsDone = true
+	t.checkpointTimer.Stop()
+}
+
+// openShards is the number of shards a trace's open spans are spread across.
+const openShards = 16
+
+// openShard holds some of a trace's open spans.
+type openShard struct {
+	sync.Mutex
+	spans map[*Span]struct{}
+}
+
+// trackSpan records that s has been created and not yet sent.
+func (t *Trace) trackSpan(s *Span) {
+	if t.openSpans == nil {
+		return
+	}
+	// spread spans across the shards in turn; s remembers which it's in
+	s.shard = uint8(atomic.AddUint32(&t.nextShard, 1) % openShards)
+	shard := &t.openSpans[s.shard]
+	shard.Lock()
+	if shard.spans == nil {
+		shard.spans = make(map[*Span]struct{})
+	}
+	shard.spans[s] = struct{}{}
+	shard.Unlock()
+	atomic.AddInt32(&t.openCount, 1)
+}
+
+// untrackSpan records that s has been sent, and stops the expiry timer once
+// every span has been.
+func (t *Trace) untrackSpan(s *Span) {
+	if t.openSpans == nil {
+		return
+	}
+	shard := &t.openSpans[s.shard]
+	shard.Lock()
+	_, open := shard.spans[s]
+	delete(shard.spans, s)
+	shard.Unlock()
+	if open && atomic.AddInt32(&t.openCount, -1) == 0 && t.expiryTimer != nil {
+		t.expiryTimer.Stop()
+	}
+}
+
+// expire sends every span in the trace that is still open, marking each one
+// with meta.expired so hung handlers and leaked spans show up in Honeycomb
+// instead of silently holding memory.
+func (t *Trace) expire() {
+	spans := make([]*Span, 0, atomic.LoadInt32(&t.openCount))
+	for i := range t.openSpans {
+		shard := &t.openSpans[i]
+		shard.Lock()
+		for s := range shard.spans {
+			spans = append(spans, s)
+		}
+		shard.Unlock()
+	}
+	// mark them all first, since sending a span also sends its synchronous
+	// children
+	for _, s := range spans {
+		if SpanState(atomic.LoadInt32(&s.state)) == SpanSent {
+			// held in a run of compressed siblings, finished in time; the
+			// run is sent with its parent
+			continue
+		}
+		s.AddField("meta.expired", true)
+	}
+	for _, s := range spans {
+		s.sendOnce()
+	}
+	// async spans expired with the rest may have added late rollups
+	t.flushLateRollups()
+}
+
+// overSpanLimit counts a new span and reports whether it is beyond the
+// trace's MaxSpansPerTrace.
+func (t *Trace) overSpanLimit() bool {
+	max := t.getConfig().MaxSpansPerTrace
+	if max == 0 {
+		return false
+	}
+	return uint(atomic.AddUint32(&t.spanCount, 1)) > max
+}
+
+// summary returns the span that counts the spans created after the trace
+// reached MaxSpansPerTrace, creating it if need be. It is a child of the root
+// span and is sent along with it.
+func (t *Trace) summary() *Span {
+	t.summaryOnce.Do(func() {
+		_, t.summarySpan = t.rootSpan.newChildSpan(context.Background(), false)
+		t.summarySpan.AddField("name", "summarized_spans")
+		t.summarySpan.AddField("meta.summary", true)
+	})
+	return t.summarySpan
+}
+
+// getConfig returns the Config governing this trace's hooks and sampler.
+func (t *Trace) getConfig() Config {
+	if t.config != nil {
+		return *t.config
+	}
+	return currentGlobalConfig()
+}
+
+// currentGlobalConfig returns GlobalConfig.
+func currentGlobalConfig() Config {
+	globalConfigLock.RLock()
+	defer globalConfigLock.RUnlock()
+	return GlobalConfig
+}
+
+// ScrubFields applies GlobalConfig's Scrubber, if any, to fields. Wrappers
+// use it for events they send outside of a trace.
+func ScrubFields(fields map[string]interface{}) {
+	if scrubber := currentGlobalConfig().Scrubber; scrubber != nil {
+		scrubber.Scrub(fields)
+	}
+}
+
 // GetRootSpan returns the root of the in-process trace. Sending the root span
 // will send the entire trace to Honeycomb. From the root span you can walk the
 // entire span tree using GetChildren (and recursively calling GetChildren on
@@ -195,23 +968,96 @@ func (t *Trace) GetParentID() string {
 	return t.parentID
 }
 
+// Hops returns the number of process boundaries the trace crossed to reach
+// this process, which is 0 if it started here.
+func (t *Trace) Hops() uint {
+	return t.hops
+}
+
+// RecordTimings makes the trace total up the durations of the spans named
+// each of names as they are sent, for Timings. It is usually called by a
+// wrapper as the trace starts, since spans sent before it is called aren't
+// counted.
+func (t *Trace) RecordTimings(names ...string) {
+	t.timingLock.Lock()
+	defer t.timingLock.Unlock()
+	if t.timings == nil {
+		t.timings = make(map[string]float64, len(names))
+	}
+	for _, name := range names {
+		if _, ok := t.timings[name]; !ok {
+			t.timings[name] = 0
+		}
+	}
+}
+
+// Timings returns the total duration in milliseconds of the spans sent so far
+// with each of the names given to RecordTimings. Names no span has been sent
+// with yet are left out.
+func (t *Trace) Timings() map[string]float64 {
+	t.timingLock.Lock()
+	defer t.timingLock.Unlock()
+	timings := make(map[string]float64, len(t.timings))
+	for name, dur := range t.timings {
+		if dur > 0 {
+			timings[name] = dur
+		}
+	}
+	return timings
+}
+
+// recordTiming adds dur to the timing for the name of span, if it's being
+// recorded.
+func (t *Trace) recordTiming(span *Span, dur float64) {
+	t.timingLock.Lock()
+	defer t.timingLock.Unlock()
+	if t.timings == nil {
+		return
+	}
+	span.eventLock.Lock()
+	name, _ := span.ev.Fields()["name"].(string)
+	span.eventLock.Unlock()
+	if _, ok := t.timings[name]; ok {
+		t.timings[name] += dur
+	}
+}
+
 // Send will finish and send all the synchronous spans in the trace to Honeycomb
 func (t *Trace) Send() {
-	rs := t.rootSpan
-	if !rs.isSent {
-		rs.Send()
-		// sending the span will also send all its children
-	}
+	// sending the span will also send all its children; it does nothing if
+	// the root span was already sent
+	t.rootSpan.Send()
 }
 
 // Span represents a specific task or portion of an application. It has a time
 // and duration, and is linked to parent and children.
 type Span struct {
-	isAsync      bool
-	isSent       bool
-	isRoot       bool
+	isAsync bool
+	isSent  bool
+	isRoot  bool
+	// children holds the span's unsent children, under childrenLock, in the
+	// order they were created. Sent children leave a nil behind, so removing
+	// them doesn't shift the rest, and holes counts the nils until the slice
+	// is compacted.
 	children     []*Span
+	holes        int
 	childrenLock sync.Mutex
+	// hadChildren is set, under childrenLock, once a child has been
+	// created, so a span whose children have all been sent isn't mistaken
+	// for one that never had any.
+	hadChildren bool
+	// run holds the consecutive similar children being compressed, under
+	// childrenLock, until runDone is set as the span is sent.
+	run     *siblingRun
+	runDone bool
+	// held is set, under sendLock, once the span has been sent into its
+	// parent's run, which holds its event back until the run is sent.
+	held bool
+	// childIndex is the span's index in its parent's children, under the
+	// parent's childrenLock.
+	childIndex int
+	// shard is the shard of the trace's open spans the span is in.
+	shard        uint8
 	ev           *libhoney.Event
 	spanID       string
 	parentID     string
@@ -222,39 +1068,226 @@ type Span struct {
 	trace        *Trace
 	eventLock    sync.Mutex
 	sendLock     sync.RWMutex
+	// eventSent is set, under eventLock, once ev has been handed to
+	// libhoney, which may read it from another goroutine.
+	eventSent bool
+	// summary is set on spans created after the trace reached
+	// MaxSpansPerTrace. They have no event of their own; sending one adds it
+	// to the counts on summary instead.
+	summary *Span
+	// unlabel holds the context whose pprof labels were in effect before
+	// LabelProfiles labeled the goroutine, to be restored by Send.
+	unlabel context.Context
+	// task and region are the runtime/trace task and region opened by
+	// TraceExecution, to be ended by Send.
+	task   *rtrace.Task
+	region *rtrace.Region
+	// sweep is set on spans sent by an ancestor instead of by their own
+	// Send.
+	sweep *orphanSweep
+	// state is the span's SpanState, read and written atomically.
+	state int32
+	// onEnd holds the functions registered with OnEnd, under onEndLock,
+	// until ended is set once the span has been sent.
+	onEnd     []func(*Span)
+	onEndLock sync.Mutex
+	ended     bool
+	// mono is when the span started according to the monotonic clock, to
+	// check the durations reported by the trace's Clock against.
+	mono time.Time
+	// startCtx is the context the span was started with, when
+	// ContextDeadlines is set, to check for cancellation when the span is
+	// sent.
+	startCtx context.Context
+	// budgeted is set, under eventLock, while the span is accounted for in
+	// its trace's MemoryBudget, holding an estimated memBytes. listed is
+	// set while it is in the budget's list of open spans, linked through
+	// budgetPrev and budgetNext under the budget's lock. discarded is set,
+	// under sendLock, once the budget has thrown away the span's fields.
+	budgeted               bool
+	memBytes               int64
+	listed                 bool
+	budgetPrev, budgetNext *Span
+	discarded              bool
+	// priority is the Priority set with SetPriority, read and written
+	// atomically, and erred is set, under eventLock, once an error has been
+	// recorded on the span.
+	priority int32
+	erred    bool
+}
+
+// orphanSweep is shared by all the orphans swept up by one call to Send.
+type orphanSweep struct {
+	by         *Span
+	goroutines []byte
+}
+
+// spanSlices holds the scratch slices sendLocked uses to collect children to
+// send. Spans themselves aren't pooled: callers keep pointers to them after
+// they're sent, so they can never safely be reused.
+var spanSlices = sync.Pool{
+	New: func() interface{} {
+		s := make([]*Span, 0, 8)
+		return &s
+	},
+}
+
+// getSpanSlice returns an empty slice from the pool, to be returned with
+// putSpanSlice once the spans in it have been sent.
+func getSpanSlice() *[]*Span {
+	s := spanSlices.Get().(*[]*Span)
+	*s = (*s)[:0]
+	return s
+}
+
+func putSpanSlice(s *[]*Span) {
+	// don't hold on to the spans
+	for i := range *s {
+		(*s)[i] = nil
+	}
+	*s = (*s)[:0]
+	spanSlices.Put(s)
 }
 
 // newSpan takes care of *some* of the initialization necessary to create a new
-// span. IMPORTANT it is not all of the initialization! It does *not* set parent
-// ID or assign the pointer to the trace that contains this span. See existing
-// uses of this function to get an example of the other things necessary to
-// create a well formed span.
-func newSpan() *Span {
-	return &Span{
-		spanID:  getNewID(spanIDLengthBytes),
-		started: time.Now(),
+// span in t. IMPORTANT it is not all of the initialization! It does *not* set
+// parent ID or create the span's event. See existing uses of this function to
+// get an example of the other things necessary to create a well formed span.
+func newSpan(t *Trace) *Span {
+	s := &Span{
+		spanID:  t.newSpanID(),
+		started: t.now(),
+		trace:   t,
+	}
+	// time.Now readings carry the monotonic clock along with the wall clock
+	s.mono = s.started
+	if t.config != nil && t.config.Clock != nil {
+		s.mono = time.Now()
 	}
+	return s
 }
 
-// AddField adds a key/value pair to this span
+// newSpanID returns an ID for a new span in the trace.
+func (t *Trace) newSpanID() string {
+	if cfg := t.config; cfg != nil && cfg.NewSpanID != nil {
+		return cfg.NewSpanID()
+	}
+	return getNewID(spanIDLengthBytes)
+}
+
+// now returns the current time according to the trace's Clock.
+func (t *Trace) now() time.Time {
+	if t.config != nil && t.config.Clock != nil {
+		return t.config.Clock()
+	}
+	return time.Now()
+}
+
+// millisecondsSince returns the time since start in milliseconds according to
+// the trace's Clock.
+func (t *Trace) millisecondsSince(start time.Time) float64 {
+	return float64(t.now().Sub(start)) / float64(time.Millisecond)
+}
+
+// Reasons a span's duration was corrected, sent in meta.duration_corrected.
+const (
+	durationNegative = "negative"
+	durationTooLong  = "too_long"
+)
+
+// elapsed returns how long the span has been running according to the
+// trace's Clock, unless the Clock was stepped while it ran: if the Clock
+// reports a negative duration, or one longer than MaxSpanDuration that the
+// monotonic clock doesn't agree with, the monotonic duration is returned
+// instead, along with the Clock's duration and the reason it was rejected.
+func (s *Span) elapsed() (d time.Duration, rejected time.Duration, reason string) {
+	d = s.trace.now().Sub(s.started)
+	if d < 0 {
+		return time.Since(s.mono), d, durationNegative
+	}
+	if max := s.trace.config.maxSpanDuration(); max > 0 && d > max {
+		if mono := time.Since(s.mono); mono <= max {
+			return mono, d, durationTooLong
+		}
+	}
+	return d, 0, ""
+}
+
+func (c *Config) maxSpanDuration() time.Duration {
+	if c == nil {
+		return 0
+	}
+	return c.MaxSpanDuration
+}
+
+// Elapsed returns how long the span has been running, according to the
+// trace's Clock, corrected as its duration_ms will be if the Clock was
+// stepped.
+func (s *Span) Elapsed() time.Duration {
+	d, _, _ := s.elapsed()
+	return d
+}
+
+// AddField adds a key/value pair to this span. It is safe to call
+// concurrently with the span's other methods; fields added after the span has
+// been sent are dropped.
 func (s *Span) AddField(key string, val interface{}) {
 	// The call to event's AddField is protected by a lock, but this is not always sufficient
 	// See send for why this lock exists
 	s.eventLock.Lock()
 	defer s.eventLock.Unlock()
-	if s.ev != nil {
+	if s.ev != nil && !s.eventSent {
 		s.ev.AddField(key, val)
+		if s.budgeted {
+			s.trace.budget.grow(s, fieldMemory(key, val))
+		}
+		if recordsError(key, val) {
+			s.erred = true
+		}
+	}
+}
+
+// AddFields adds all of fields to this span at once, so hooks and concurrent
+// senders see either none or all of them.
+func (s *Span) AddFields(fields map[string]interface{}) {
+	s.eventLock.Lock()
+	defer s.eventLock.Unlock()
+	if s.ev != nil && !s.eventSent {
+		for k, v := range fields {
+			s.ev.AddField(k, v)
+			if s.budgeted {
+				s.trace.budget.grow(s, fieldMemory(k, v))
+			}
+			if recordsError(k, v) {
+				s.erred = true
+			}
+		}
 	}
 }
 
+// SetName replaces the span's name, which is otherwise fixed when the span is
+// created.
+func (s *Span) SetName(name string) {
+	s.AddField("name", name)
+}
+
 // AddRollupField adds a key/value pair to this span. If it is called repeatedly
 // on the same span, the values will be summed together.  Additionally, this
 // field will be summed across all spans and added to the trace as a total. It
 // is especially useful for doing things like adding the duration spent talking
 // to a specific external service - eg database time. The root span will then
 // get a field that represents the total time spent talking to the database from
-// all of the spans that are part of the trace.
+// all of the spans that are part of the trace. Keys registered in the trace's
+// Config.Rollups can be counted, or keep the minimum, maximum, mean, or a
+// histogram of their values on the root span instead; the span's own field
+// is still their sum. Values added after the root span was sent, usually by
+// async spans, are sent in a late_rollups span event on the root span once the
+// trace's last async span is sent, and are included in Trace.RollupTotals.
 func (s *Span) AddRollupField(key string, val float64) {
+	if s.trace != nil && s.trace.isDropped() {
+		// the span won't be sent
+		return
+	}
 	if s.trace != nil {
 		s.trace.addRollupField(key, val)
 	}
@@ -283,44 +1316,235 @@ func (s *Span) AddTraceField(key string, val interface{}) {
 // span to Honeycomb. Sending a span also triggers sending all synchronous
 // child spans - in other words, if any synchronous child span has not yet been
 // sent, sending the parent will finish and send the children as well.
+//
+// Send may safely be called more than once, and from more than one
+// goroutine: only the first call sends the span. The others do nothing but
+// count toward RepeatedSends, since they usually point at a bug, like a
+// wrapper and its caller both sending the same span.
+//
+// Send also restores the calling goroutine's pprof labels and ends the
+// execution trace region set up by LabelProfiles and TraceExecution, even if
+// the span was already sent by an ancestor, the trace expiring, or being shed.
 func (s *Span) Send() {
+	if !s.sendOnce() {
+		atomic.AddUint64(&repeatedSends, 1)
+	}
+	s.endGoroutine()
+}
+
+// endGoroutine undoes LabelProfiles and TraceExecution on the calling
+// goroutine, which they must have been called on, if they haven't been
+// undone already.
+func (s *Span) endGoroutine() {
+	s.sendLock.Lock()
+	unlabel, task, region := s.unlabel, s.task, s.region
+	s.unlabel, s.task, s.region = nil, nil, nil
+	s.sendLock.Unlock()
+	if unlabel != nil {
+		pprof.SetGoroutineLabels(unlabel)
+	}
+	if region != nil {
+		region.End()
+		task.End()
+	}
+}
+
+// repeatedSends counts calls to Send on spans that were already sent.
+var repeatedSends uint64
+
+// RepeatedSends returns the number of times Send has been called on a span
+// that had already been sent, by an earlier call or by an ancestor, since the
+// process started.
+func RepeatedSends() uint64 {
+	return atomic.LoadUint64(&repeatedSends)
+}
+
+// sendOnce sends s unless it has already been sent, and reports whether it
+// did.
+func (s *Span) sendOnce() bool {
 	s.sendLock.Lock()
-	defer s.sendLock.Unlock()
 	// don't send already sent spans
 	if s.isSent {
-		return
+		s.sendLock.Unlock()
+		return false
 	}
 
 	s.sendLocked()
+	s.sendLock.Unlock()
+	s.runOnEnd()
+	return true
 }
 
-func (s *Span) sendByParent() {
+func (s *Span) sendByParent(sweep *orphanSweep) {
 	s.sendLock.Lock()
-	defer s.sendLock.Unlock()
 	// don't send already sent spans
 	if s.isSent {
+		s.sendLock.Unlock()
 		return
 	}
 
-	s.AddField("meta.sent_by_parent", true)
+	s.sweep = sweep
+	if s.ev != nil {
+		s.addOrphanFields()
+	}
 	s.sendLocked()
+	s.sendLock.Unlock()
+	s.runOnEnd()
+}
+
+// SpanState is where a span is in its lifecycle.
+type SpanState int32
+
+const (
+	// SpanStarted spans are running: nothing has sent them yet.
+	SpanStarted SpanState = iota
+	// SpanFinished spans are being sent, by their own Send or an
+	// ancestor's. Their duration is fixed, but their synchronous children
+	// and their own event are still being sent.
+	SpanFinished
+	// SpanSent spans are done. Their event, unless the trace was dropped by
+	// sampling, has been handed off to be sent to Honeycomb, and fields
+	// added to them are dropped.
+	SpanSent
+)
+
+// String returns the state's name.
+func (st SpanState) String() string {
+	switch st {
+	case SpanStarted:
+		return "started"
+	case SpanFinished:
+		return "finished"
+	case SpanSent:
+		return "sent"
+	}
+	return "unknown"
+}
+
+// State returns where the span is in its lifecycle. It is safe to call from
+// any goroutine, but the span may move on as soon as it returns.
+func (s *Span) State() SpanState {
+	return SpanState(atomic.LoadInt32(&s.state))
+}
+
+// IsFinished reports whether the span has started being sent, so its
+// duration is fixed. It is true for sent spans too.
+func (s *Span) IsFinished() bool {
+	return s.State() >= SpanFinished
+}
+
+// IsSent reports whether the span has been sent.
+func (s *Span) IsSent() bool {
+	return s.State() == SpanSent
+}
+
+// OnEnd registers f to be called once the span has been sent, however it is
+// sent: by Send, by an ancestor, or by the trace expiring. Each function
+// registered is called exactly once, in the order they were registered, on
+// the goroutine that sent the span; if the span has already been sent, f is
+// called right away. Use it to release resources tied to the span. f may
+// read the span but must not send its ancestors, which may still be being
+// sent.
+func (s *Span) OnEnd(f func(*Span)) {
+	s.onEndLock.Lock()
+	if !s.ended {
+		s.onEnd = append(s.onEnd, f)
+		s.onEndLock.Unlock()
+		return
+	}
+	s.onEndLock.Unlock()
+	f(s)
+}
+
+// runOnEnd calls the span's OnEnd functions once it has been sent.
+func (s *Span) runOnEnd() {
+	s.onEndLock.Lock()
+	s.ended = true
+	onEnd := s.onEnd
+	s.onEnd = nil
+	s.onEndLock.Unlock()
+	for _, f := range onEnd {
+		f(s)
+	}
+}
+
+// addOrphanFields marks a span sent by an ancestor with where and when it was
+// swept up, and passes it to the OrphanedSpanHook.
+func (s *Span) addOrphanFields() {
+	cfg := s.trace.getConfig()
+	sweep := s.sweep
+	if cfg.OrphanGoroutineDump && sweep.goroutines == nil {
+		buf := make([]byte, maxGoroutineDump)
+		sweep.goroutines = buf[:runtime.Stack(buf, true)]
+	}
+	unfinished := s.Elapsed()
+	fields := map[string]interface{}{
+		"meta.sent_by_parent": true,
+		"meta.sent_by":        sweep.by.spanID,
+		"meta.unfinished_ms":  float64(unfinished) / float64(time.Millisecond),
+	}
+	if name := sweep.by.name(); name != "" {
+		fields["meta.sent_by_name"] = name
+	}
+	if sweep.goroutines != nil {
+		fields["meta.orphan_goroutines"] = string(sweep.goroutines)
+	}
+	s.AddFields(fields)
+	if cfg.OrphanedSpanHook != nil {
+		cfg.OrphanedSpanHook(OrphanedSpan{
+			Span:       s,
+			SentBy:     sweep.by,
+			Unfinished: unfinished,
+			Goroutines: sweep.goroutines,
+		})
+	}
+}
+
+// name returns the span's name field, if it has one.
+func (s *Span) name() string {
+	s.eventLock.Lock()
+	defer s.eventLock.Unlock()
+	if s.ev == nil {
+		return ""
+	}
+	name, _ := s.ev.Fields()["name"].(string)
+	return name
 }
 
 func (s *Span) sendLocked() {
+	atomic.StoreInt32(&s.state, int32(SpanFinished))
+	if s.summary != nil {
+		d, _, _ := s.elapsed()
+		s.summary.summarize(float64(d) / float64(time.Millisecond))
+		s.setSent()
+		return
+	}
 	if s.ev == nil {
+		s.setSent()
 		return
 	}
+	s.addCancelFields()
 	// finish the timer for this span
+	var dur float64
 	if !s.started.IsZero() {
-		dur := float64(time.Since(s.started)) / float64(time.Millisecond)
+		d, rejected, reason := s.elapsed()
+		dur = float64(d) / float64(time.Millisecond)
 		s.AddField("duration_ms", dur)
+		if reason != "" {
+			s.ev.AddField("meta.duration_corrected", reason)
+			s.ev.AddField("meta.clock_duration_ms", float64(rejected)/float64(time.Millisecond))
+		}
+		s.trace.recordTiming(s, dur)
 	}
 	// set trace IDs for this span
-	s.ev.AddField("trace.trace_id", s.trace.traceID)
+	s.ev.AddField("trace.trace_id", s.trace.boxedTraceID)
 	if s.parentID != "" {
 		s.AddField("trace.parent_id", s.parentID)
 	}
 	s.ev.AddField("trace.span_id", s.spanID)
+	if s.trace.hops > 0 {
+		s.ev.AddField("trace.hops", s.trace.hops)
+	}
 	// add this span's rollup fields to the event
 	s.rollupLock.Lock()
 	for k, v := range s.rollupFields {
@@ -329,25 +1553,57 @@ func (s *Span) sendLocked() {
 	s.rollupLock.Unlock()
 
 	s.childrenLock.Lock()
-	var childrenToSend []*Span
+	leaf := !s.hadChildren
+	var childrenToSend *[]*Span
 	if len(s.children) > 0 {
-		childrenToSend = make([]*Span, 0, len(s.children))
+		childrenToSend = getSpanSlice()
 		for _, child := range s.children {
-			if !child.IsAsync() {
+			if child != nil && !child.IsAsync() {
 				// queue children up to be sent. We'd deadlock if we actually sent the
 				// child here.
-				childrenToSend = append(childrenToSend, child)
+				*childrenToSend = append(*childrenToSend, child)
 			}
 		}
 	}
 	s.childrenLock.Unlock()
 
-	for _, child := range childrenToSend {
-		child.sendByParent()
+	if childrenToSend != nil {
+		if len(*childrenToSend) > 0 {
+			sweep := s.sweep
+			if sweep == nil {
+				sweep = &orphanSweep{by: s}
+			}
+			for _, child := range *childrenToSend {
+				child.sendByParent(sweep)
+			}
+			if sweep.by == s {
+				// the orphans may have added late rollups, and with an
+				// async span leaked nothing else may send them
+				s.trace.flushLateRollups()
+			}
+		}
+		putSpanSlice(childrenToSend)
 	}
 
-	s.send()
-	s.isSent = true
+	if s.isRoot {
+		s.trace.stopCheckpoints()
+	}
+	if !leaf {
+		s.flushRun()
+	}
+	if !(leaf && s.collapse(dur)) {
+		// a run holding s keeps it tracked until it is sent or dropped
+		if s.held = s.compress(dur, leaf); !s.held {
+			s.send()
+		}
+	}
+	s.setSent()
+	if !s.held {
+		s.release()
+	}
+	if s.isAsync && atomic.AddInt32(&s.trace.openAsync, -1) == 0 {
+		s.trace.flushLateRollups()
+	}
 
 	// Remove this span from its parent's children list so that it can be GC'd
 	if s.parent != nil {
@@ -356,15 +1612,39 @@ func (s *Span) sendLocked() {
 
 }
 
+// release stops tracking s as open and accounting for it in the memory
+// budget, once its event has been sent or won't be.
+func (s *Span) release() {
+	s.trace.untrackSpan(s)
+	if s.trace.budget != nil {
+		s.trace.budget.release(s)
+	}
+}
+
+// setSent records that the span has been sent. The caller holds sendLock.
+func (s *Span) setSent() {
+	s.isSent = true
+	atomic.StoreInt32(&s.state, int32(SpanSent))
+}
+
 // IsAsync reveals whether the span is asynchronous (true) or synchronous (false).
 func (s *Span) IsAsync() bool {
 	return s.isAsync
 }
 
-// GetChildren returns a list of all child spans (both synchronous and
-// asynchronous).
+// GetChildren returns a list of all unsent child spans (both synchronous and
+// asynchronous). The list is a copy, so it is safe to use while children are
+// being created or sent.
 func (s *Span) GetChildren() []*Span {
-	return s.children
+	s.childrenLock.Lock()
+	defer s.childrenLock.Unlock()
+	children := make([]*Span, 0, len(s.children)-s.holes)
+	for _, child := range s.children {
+		if child != nil {
+			children = append(children, child)
+		}
+	}
+	return children
 }
 
 // Get Parent returns this span's parent.
@@ -400,6 +1680,72 @@ func (s *Span) CreateChild(ctx context.Context) (context.Context, *Span) {
 	return s.createChildSpan(ctx, false)
 }
 
+// StartChild creates a synchronous child of the current span named name, for
+// code that holds spans directly instead of passing a context.Context around.
+// Context fields are computed from an empty context, since there is none to
+// read them from. The child carries the same concurrency guarantees as any
+// other span, so it can be created, annotated, and sent from a different
+// goroutine than its parent, but it must still be sent before its parent is.
+func (s *Span) StartChild(name string) *Span {
+	_, child := s.createChildSpan(context.Background(), false)
+	child.AddField("name", name)
+	return child
+}
+
+// StartAsyncChild is like StartChild, but creates an async child that may
+// outlive the current span. See CreateAsyncChild.
+func (s *Span) StartAsyncChild(name string) *Span {
+	_, child := s.createChildSpan(context.Background(), true)
+	child.AddField("name", name)
+	return child
+}
+
+// LabelProfiles sets the pprof labels trace_id and span_name on the calling
+// goroutine, so CPU profiles can be broken down by trace and endpoint and
+// lined up with traces in Honeycomb. ctx should be the context holding s;
+// the returned context carries the labels too, so goroutines started with
+// pprof.Do inherit them. The goroutine's previous labels, the ones in ctx,
+// are restored when Send is called on s, which should happen on the same
+// goroutine, even if s was already sent another way. LabelProfiles does nothing unless the trace's config has
+// ProfilerLabels set. The beeline package calls it for spans started with
+// beeline.StartSpan and beeline.StartTrace.
+func (s *Span) LabelProfiles(ctx context.Context, name string) context.Context {
+	cfg := s.trace.config
+	if cfg == nil || !cfg.ProfilerLabels {
+		return ctx
+	}
+	labeled := pprof.WithLabels(ctx, pprof.Labels("trace_id", s.trace.traceID, "span_name", name))
+	s.sendLock.Lock()
+	s.unlabel = ctx
+	s.sendLock.Unlock()
+	pprof.SetGoroutineLabels(labeled)
+	return labeled
+}
+
+// TraceExecution opens a runtime/trace task and region named name for s, so Go
+// execution traces line up with the beeline's spans: the task groups the work
+// done for the span across goroutines, and the region marks when the calling
+// goroutine was running it. ctx should be the context holding s; the returned
+// context holds the task, so tasks opened for child spans nest inside it. Both
+// are ended when Send is called on s, which should happen on the goroutine
+// that called TraceExecution, even if s was already sent another way. TraceExecution does nothing unless the trace's
+// config has ExecutionTraceRegions set and an execution trace is being
+// recorded. The beeline package calls it for spans started with
+// beeline.StartSpan and beeline.StartTrace.
+func (s *Span) TraceExecution(ctx context.Context, name string) context.Context {
+	cfg := s.trace.config
+	if cfg == nil || !cfg.ExecutionTraceRegions || !rtrace.IsEnabled() {
+		return ctx
+	}
+	ctx, task := rtrace.NewTask(ctx, name)
+	region := rtrace.StartRegion(ctx, name)
+	s.sendLock.Lock()
+	s.task = task
+	s.region = region
+	s.sendLock.Unlock()
+	return ctx
+}
+
 // SerializeHeaders returns the trace ID, current span ID as parent ID, and an
 // encoded form of all trace level fields. This serialized header is intended to
 // be put in an HTTP (or other protocol) header to transmit to downstream
@@ -415,21 +1761,45 @@ func (s *Span) SerializeHeaders() string {
 func (s *Span) removeChildSpan(sentSpan *Span) {
 	s.childrenLock.Lock()
 	defer s.childrenLock.Unlock()
-	var index *int
-	for i, child := range s.children {
-		i := i
-		if child == sentSpan {
-			index = &i
+	i := sentSpan.childIndex
+	if i >= len(s.children) || s.children[i] != sentSpan {
+		return
+	}
+	s.children[i] = nil
+	s.holes++
+	if s.holes == len(s.children) {
+		// they're all nil; keep the backing array for the next children
+		s.children = s.children[:0]
+		s.holes = 0
+	} else if 2*s.holes >= len(s.children) {
+		s.compactChildren()
+	}
+}
+
+// compactChildren removes the holes left in s.children by sent children,
+// keeping the rest in order. The caller holds childrenLock.
+func (s *Span) compactChildren() {
+	live := s.children[:0]
+	for _, child := range s.children {
+		if child != nil {
+			child.childIndex = len(live)
+			live = append(live, child)
 		}
 	}
-	if index != nil {
-		s.children = append(s.children[:*index], s.children[*index+1:]...)
+	for i := len(live); i < len(s.children); i++ {
+		s.children[i] = nil
 	}
+	s.children = live
+	s.holes = 0
 }
 
 // send gets all the trace level fields and does pre-send hooks, then sends the
 // span.
 func (s *Span) send() {
+	if s.discarded {
+		// the memory budget threw its fields away
+		return
+	}
 	// add all the trace level fields to the event as late as possible - when
 	// the trace is all getting sent
 	for k, v := range s.trace.getTraceLevelFields() {
@@ -437,8 +1807,9 @@ func (s *Span) send() {
 	}
 
 	s.childrenLock.Lock()
-	// classify span type
-	var spanType string
+	// classify span type. Holding it as an interface keeps AddField from
+	// allocating to box it.
+	var spanType interface{}
 	switch {
 	case s.isRoot:
 		if s.parentID == "" {
@@ -448,18 +1819,30 @@ func (s *Span) send() {
 		}
 	case s.isAsync:
 		spanType = "async"
-	case len(s.children) == 0:
+	case len(s.children) == s.holes:
 		spanType = "leaf"
 	default:
 		spanType = "mid"
 	}
 	s.childrenLock.Unlock()
 	s.AddField("meta.span_type", spanType)
+	if p := Priority(atomic.LoadInt32(&s.priority)); p != PriorityNormal && !s.isRoot {
+		s.AddField(priorityField, p.String())
+	}
 
 	if spanType == "root" {
 		// add the trace's rollup fields to the root span
 		for k, v := range s.trace.getRollupFields() {
-			s.AddField("rollup."+k, v)
+			s.AddField(rollupKeys.Key(k), v)
+		}
+	}
+	if s.isRoot {
+		collapsed, examples := s.trace.collapsedFields()
+		if collapsed != nil {
+			s.AddFields(collapsed)
+		}
+		for _, e := range examples {
+			e.send()
 		}
 	}
 
@@ -469,49 +1852,264 @@ func (s *Span) send() {
 	// prevent this from causing an unnecessary panic.
 	s.eventLock.Lock()
 	defer s.eventLock.Unlock()
+	s.trace.sendEvent(s.ev)
+	s.eventSent = true
+}
+
+// sendEvent runs the trace's hooks and sampler on ev and sends it if it is
+// kept.
+func (t *Trace) sendEvent(ev *libhoney.Event) {
+	cfg := t.getConfig()
+	applyFieldNaming(ev.Fields(), cfg.FieldNaming, cfg.FieldNames)
+	if len(cfg.FieldPrefixes) > 0 {
+		applyFieldPrefixes(ev.Fields(), cfg.FieldPrefixes)
+	}
 	// run hooks
+	if cfg.SpanNameHook != nil {
+		name, _ := ev.Fields()["name"].(string)
+		ev.Fields()["name"] = cfg.SpanNameHook(name, ev.Fields())
+	}
 	var shouldKeep = true
-	if GlobalConfig.SamplerHook != nil {
+	if t.sampleDecided {
+		shouldKeep = t.keep
+		ev.SampleRate = t.sampleRate
+	} else if cfg.SamplerHook != nil {
 		var sampleRate int
-		shouldKeep, sampleRate = GlobalConfig.SamplerHook(s.ev.Fields())
-		s.ev.SampleRate = uint(sampleRate)
+		shouldKeep, sampleRate = cfg.SamplerHook(ev.Fields())
+		ev.SampleRate = uint(sampleRate)
 	} else {
 		// use the default sampler
-		if sample.GlobalSampler != nil {
-			shouldKeep = sample.GlobalSampler.Sample(s.trace.traceID)
-			s.ev.SampleRate = uint(sample.GlobalSampler.GetSampleRate())
+		sampler := cfg.Sampler
+		if sampler == nil {
+			sampler = sample.GlobalSampler
+		}
+		if sampler != nil {
+			shouldKeep = sampler.Sample(t.traceID)
+			ev.SampleRate = uint(sampler.GetSampleRate())
 		}
 	}
+	if shouldKeep && cfg.PresendHook != nil {
+		// munge all the fields
+		cfg.PresendHook(ev.Fields())
+	}
+	// scrub before reporting errors, so secrets in them don't reach the
+	// error tracker either
+	if cfg.Scrubber != nil && (shouldKeep || cfg.ErrorReporter != nil) {
+		cfg.Scrubber.Scrub(ev.Fields())
+	}
+	if cfg.ErrorReporter != nil {
+		reportErrors(cfg.ErrorReporter, ev.Fields(), shouldKeep)
+	}
 	if shouldKeep {
-		if GlobalConfig.PresendHook != nil {
-			// munge all the fields
-			GlobalConfig.PresendHook(s.ev.Fields())
+		if len(cfg.DatasetRoutes) > 0 {
+			if dataset := routeDataset(cfg.DatasetRoutes, ev.Fields()); dataset != "" {
+				ev.Dataset = dataset
+			}
 		}
-		s.ev.SendPresampled()
+		ev.SendPresampled()
 	}
 }
 
+// SendSpanEvent immediately sends a span event: a timestamped annotation
+// attached to this span, such as a logged error, which Honeycomb shows on the
+// span in the trace view. Span events are sampled along with their trace and
+// have the trace's fields added, but don't have durations or children.
+func (s *Span) SendSpanEvent(name string, fields map[string]interface{}) {
+	if s.trace == nil || s.trace.builder == nil || s.trace.isDropped() {
+		return
+	}
+	ev := s.trace.builder.NewEvent()
+	ev.Timestamp = s.trace.now()
+	for k, v := range s.trace.getTraceLevelFields() {
+		ev.AddField(k, v)
+	}
+	for k, v := range fields {
+		ev.AddField(k, v)
+	}
+	ev.AddField("name", name)
+	ev.AddField("trace.trace_id", s.trace.traceID)
+	ev.AddField("trace.parent_id", s.spanID)
+	ev.AddField("meta.annotation_type", "span_event")
+	s.trace.sendEvent(ev)
+}
+
 func (s *Span) createChildSpan(ctx context.Context, async bool) (context.Context, *Span) {
-	newSpan := newSpan()
+	if s.trace.isDropped() {
+		// the trace won't be sent, so build as little as possible: no event,
+		// no context fields, and no place in the parent's children
+		newSpan := newSpan(s.trace)
+		newSpan.parent = s
+		newSpan.parentID = s.spanID
+		newSpan.isAsync = async
+		return PutSpanInContext(ctx, newSpan), newSpan
+	}
+	if s.IsFinished() {
+		return s.createLateChild(ctx, async)
+	}
+	if s.trace.overSpanLimit() {
+		summary := s.trace.summary()
+		newSpan := newSpan(s.trace)
+		newSpan.parent = summary
+		newSpan.parentID = summary.spanID
+		newSpan.isAsync = async
+		newSpan.summary = summary
+		return PutSpanInContext(ctx, newSpan), newSpan
+	}
+	return s.newChildSpan(ctx, async)
+}
+
+// createLateChild creates a child of s, which has already been sent,
+// according to the trace's LateChildPolicy.
+func (s *Span) createLateChild(ctx context.Context, async bool) (context.Context, *Span) {
+	switch s.trace.getConfig().LateChildren {
+	case LateChildToRoot:
+		root := s.trace.rootSpan
+		if root != s && !root.IsFinished() {
+			ctx, child := root.createChildSpan(ctx, async)
+			child.AddField("meta.late", true)
+			child.AddField("meta.late_parent_id", s.spanID)
+			return ctx, child
+		}
+		fallthrough
+	case LateChildNewRoot:
+		opts := []Option{WithBuilder(s.trace.builder)}
+		if s.trace.config != nil {
+			opts = append(opts, WithConfig(s.trace.config))
+		}
+		ctx, tr := NewTraceFromPropagationContext(ctx, nil, opts...)
+		tr.AddFields(s.trace.getTraceLevelFields())
+		root := tr.GetRootSpan()
+		root.AddField("meta.late", true)
+		root.addLink(s.trace.traceID, s.spanID)
+		return ctx, root
+	}
+	ctx, child := s.newChildSpan(ctx, async)
+	child.AddField("meta.late", true)
+	return ctx, child
+}
+
+// addLink sends a link from s to the span spanID in the trace traceID.
+func (s *Span) addLink(traceID, spanID string) {
+	if s.trace.isDropped() {
+		return
+	}
+	ev := s.trace.builder.NewEvent()
+	ev.Timestamp = s.started
+	ev.AddField("trace.trace_id", s.trace.traceID)
+	ev.AddField("trace.parent_id", s.spanID)
+	ev.AddField("trace.link.trace_id", traceID)
+	ev.AddField("trace.link.span_id", spanID)
+	ev.AddField("meta.annotation_type", "link")
+	s.trace.sendEvent(ev)
+}
+
+// newChildSpan creates a child span regardless of the trace's span limit.
+func (s *Span) newChildSpan(ctx context.Context, async bool) (context.Context, *Span) {
+	newSpan := newSpan(s.trace)
 	newSpan.parent = s
 	newSpan.parentID = s.spanID
-	newSpan.trace = s.trace
 	newSpan.ev = s.trace.builder.NewEvent()
+	newSpan.ev.Timestamp = newSpan.started
 	newSpan.isAsync = async
+	if async {
+		atomic.AddInt32(&s.trace.openAsync, 1)
+	}
+	newSpan.addContextFields(ctx)
+	s.trace.trackSpan(newSpan)
 	s.childrenLock.Lock()
+	newSpan.childIndex = len(s.children)
 	s.children = append(s.children, newSpan)
+	s.hadChildren = true
 	s.childrenLock.Unlock()
+	if s.trace.budget != nil {
+		s.trace.budget.track(newSpan)
+	}
 	ctx = PutSpanInContext(ctx, newSpan)
 	return ctx, newSpan
 }
 
+// summarize counts a span that took dur milliseconds, which was created after
+// the trace reached MaxSpansPerTrace, in this summary span's fields.
+func (s *Span) summarize(dur float64) {
+	s.rollupLock.Lock()
+	defer s.rollupLock.Unlock()
+	if s.rollupFields == nil {
+		s.rollupFields = make(map[string]float64)
+	}
+	s.rollupFields["meta.summarized_span_count"]++
+	s.rollupFields["meta.summarized_duration_ms"] += dur
+}
+
+// addContextFields adds the fields the trace's ContextFields hook finds in
+// ctx, the context the span is being started from.
+func (s *Span) addContextFields(ctx context.Context) {
+	if ctx == nil {
+		return
+	}
+	cfg := s.trace.getConfig()
+	if cfg.ContextDeadlines {
+		s.addDeadlineFields(ctx)
+	}
+	hook := cfg.ContextFields
+	if hook == nil {
+		return
+	}
+	for k, v := range hook(ctx) {
+		s.AddField(k, v)
+	}
+}
+
+// addDeadlineFields records whether ctx has a deadline and how long is left
+// until it, and keeps ctx to check for cancellation when the span is sent.
+func (s *Span) addDeadlineFields(ctx context.Context) {
+	deadline, ok := ctx.Deadline()
+	s.AddField("context.deadline_set", ok)
+	if ok {
+		s.AddField("context.deadline_remaining_ms", float64(time.Until(deadline))/float64(time.Millisecond))
+	}
+	s.startCtx = ctx
+}
+
+// addCancelFields records whether the context the span was started with had
+// been cancelled or timed out when the span was sent. Spans started without
+// a context get neither field.
+func (s *Span) addCancelFields() {
+	if s.startCtx == nil {
+		return
+	}
+	err := s.startCtx.Err()
+	s.startCtx = nil
+	s.AddField("context.cancelled", err == context.Canceled)
+	s.AddField("context.timed_out", err == context.DeadlineExceeded)
+}
+
 // PropagationContext creates and returns a new propagation.PropagationContext using the
 // information in the current span.
 func (s *Span) PropagationContext() *propagation.PropagationContext {
+	// the caller owns the propagation context, so give it a copy
+	traceContext := copyFields(s.trace.getTraceLevelFields(), 0)
 	return &propagation.PropagationContext{
 		TraceID:      s.trace.traceID,
 		ParentID:     s.spanID,
 		Dataset:      s.trace.builder.Dataset,
-		TraceContext: s.trace.traceLevelFields,
+		TraceContext: traceContext,
+		Hops:         s.trace.hops + 1,
+	}
+}
+
+// PropagationHeaders returns the trace context headers to add to an outgoing
+// request made within this span, in each of the trace's PropagationFormats,
+// or just the Honeycomb header if it has none, along with the headers of the
+// trace's correlation IDs named in its CorrelationHeaders. ctx holds any W3C
+// tracestate to pass along; see propagation.MarshalHeaders.
+func (s *Span) PropagationHeaders(ctx context.Context) map[string]string {
+	formats := s.trace.getConfig().PropagationFormats
+	var headers map[string]string
+	if len(formats) == 0 {
+		headers = map[string]string{propagation.TracePropagationHTTPHeader: s.SerializeHeaders()}
+	} else {
+		headers = propagation.MarshalHeaders(ctx, s.PropagationContext(), formats...)
 	}
+	s.trace.correlationHeaders(headers)
+	return headers
 }
@@ -1,16 +1,20 @@
 package trace
 
 import (
+	"bytes"
 	"context"
 	"encoding/hex"
 	"fmt"
+	"runtime/pprof"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/honeycombio/beeline-go/client"
 	"github.com/honeycombio/beeline-go/propagation"
+	"github.com/honeycombio/beeline-go/sample"
 	libhoney "github.com/honeycombio/libhoney-go"
 	"github.com/honeycombio/libhoney-go/transmission"
 	"github.com/stretchr/testify/assert"
@@ -26,7 +30,7 @@ func TestNewTrace(t *testing.T) {
 	assert.Empty(t, tr.parentID, "trace created with no headers should have an empty parent ID")
 	assert.NotNil(t, tr.rollupFields, "trace should initialize rollup fields map")
 	assert.NotNil(t, tr.rootSpan, "trace should have a root span")
-	assert.NotNil(t, tr.traceLevelFields, "trace should initialize trace level fields map")
+	assert.NotNil(t, traceFields(tr), "trace should initialize trace level fields map")
 	trFromContext := GetTraceFromContext(ctx)
 	assert.Equal(t, tr, trFromContext, "new trace should put the trace in the context")
 	spFromContext := GetSpanFromContext(ctx)
@@ -41,9 +45,9 @@ func TestNewTrace(t *testing.T) {
 	_, tr = NewTrace(context.Background(), serializedHeaders)
 	assert.Equal(t, "abcdef123456", tr.traceID, "trace with headers should take trace ID")
 	assert.Equal(t, "0102030405", tr.parentID, "trace with headers should take parent ID")
-	assert.Equal(t, float64(1), tr.traceLevelFields["userID"], "trace with headers should populate trace level fields")
-	assert.Equal(t, "failed to sign on", tr.traceLevelFields["errorMsg"], "trace with headers should populate trace level fields")
-	assert.Equal(t, true, tr.traceLevelFields["toRetry"], "trace with headers should populate trace level fields")
+	assert.Equal(t, float64(1), traceFields(tr)["userID"], "trace with headers should populate trace level fields")
+	assert.Equal(t, "failed to sign on", traceFields(tr)["errorMsg"], "trace with headers should populate trace level fields")
+	assert.Equal(t, true, traceFields(tr)["toRetry"], "trace with headers should populate trace level fields")
 
 	t.Run("Serializing headers does not race with adding trace level fields", func(t *testing.T) {
 		wg := &sync.WaitGroup{}
@@ -69,7 +73,7 @@ func TestNewTraceFromPropagationContext(t *testing.T) {
 	assert.Empty(t, tr.parentID, "trace created with no propagation context should have an empty parent ID")
 	assert.NotNil(t, tr.rollupFields, "trace should initialize rollup fields map")
 	assert.NotNil(t, tr.rootSpan, "trace should have a root span")
-	assert.NotNil(t, tr.traceLevelFields, "trace should initialize trace level fields map")
+	assert.NotNil(t, traceFields(tr), "trace should initialize trace level fields map")
 	trFromContext := GetTraceFromContext(ctx)
 	assert.Equal(t, tr, trFromContext, "new trace should put the trace in the context")
 	spFromContext := GetSpanFromContext(ctx)
@@ -93,16 +97,36 @@ func TestNewTraceFromPropagationContext(t *testing.T) {
 	_, tr = NewTraceFromPropagationContext(ctx, prop)
 	assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", tr.traceID, "trace with a propagation context should take trace ID")
 	assert.Equal(t, "00f067aa0ba902b7", tr.parentID, "trace with a propagation context should take parent ID")
-	assert.Equal(t, int(1), tr.traceLevelFields["userID"], "trace with a propagation context should populate trace level fields")
-	assert.Equal(t, "failed to sign on", tr.traceLevelFields["errorMsg"], "trace with a propagation context should populate trace level fields")
-	assert.Equal(t, true, tr.traceLevelFields["toRetry"], "trace with a propagation context should populate trace level fields")
+	assert.Equal(t, int(1), traceFields(tr)["userID"], "trace with a propagation context should populate trace level fields")
+	assert.Equal(t, "failed to sign on", traceFields(tr)["errorMsg"], "trace with a propagation context should populate trace level fields")
+	assert.Equal(t, true, traceFields(tr)["toRetry"], "trace with a propagation context should populate trace level fields")
+}
+
+// TestNewTraceWithDataset verifies the dataset option overrides both the
+// default and any propagated dataset.
+func TestNewTraceWithDataset(t *testing.T) {
+	setupLibhoney()
+	_, tr := NewTraceFromPropagationContext(context.Background(), nil, WithDataset("batch"))
+	assert.Equal(t, "batch", tr.builder.Dataset, "dataset option should set the trace's dataset")
+
+	prop := &propagation.PropagationContext{
+		TraceID:  "0af7651916cd43dd8448eb211c80319c",
+		ParentID: "00f067aa0ba902b7",
+		Dataset:  "upstream",
+	}
+	_, tr = NewTraceFromPropagationContext(context.Background(), prop, WithDataset("batch"))
+	assert.Equal(t, "batch", tr.builder.Dataset, "dataset option should take precedence over a propagated dataset")
+	assert.Contains(t, tr.GetRootSpan().SerializeHeaders(), "dataset=batch", "overridden dataset should propagate downstream")
+
+	_, tr = NewTraceFromPropagationContext(context.Background(), nil)
+	assert.Equal(t, "placeholder", tr.builder.Dataset, "traces without options should use the client's dataset")
 }
 
 // TestAddField tests adding a field to a trace
 func TestAddField(t *testing.T) {
 	_, tr := NewTrace(context.Background(), "")
 	tr.AddField("wander", "lust")
-	assert.Equal(t, "lust", tr.traceLevelFields["wander"], "AddField on a trace should add the field to the trace level fields map")
+	assert.Equal(t, "lust", traceFields(tr)["wander"], "AddField on a trace should add the field to the trace level fields map")
 }
 
 // TestRollupField tests adding a field to a trace
@@ -115,6 +139,162 @@ func TestRollupField(t *testing.T) {
 	assert.Equal(t, 0.1, tr.rollupFields["smallnum"], "addRollupField on a trace should sum the fields added")
 }
 
+func TestLateRollups(t *testing.T) {
+	mo := setupLibhoney()
+	ctx, tr := NewTrace(context.Background(), "")
+	rs := tr.GetRootSpan()
+	_, async1 := rs.CreateAsyncChild(ctx)
+	_, async2 := rs.CreateAsyncChild(ctx)
+	async1.AddRollupField("db_ms", 1)
+	rs.Send()
+	async1.AddRollupField("db_ms", 2)
+	async1.Send()
+	async2.AddRollupField("db_ms", 4)
+	async2.AddRollupField("calls", 1)
+	assert.Equal(t, map[string]float64{"db_ms": 7, "calls": 1}, tr.RollupTotals())
+	assert.Equal(t, 2, len(mo.Events()), "late rollups wait for the last async span")
+	async2.Send()
+
+	events := mo.Events()
+	assert.Equal(t, 4, len(events))
+	assert.Equal(t, float64(1), events[0].Data["rollup.db_ms"])
+	late := events[3]
+	assert.Equal(t, "late_rollups", late.Data["name"])
+	assert.Equal(t, rs.GetSpanID(), late.Data["trace.parent_id"])
+	assert.Equal(t, float64(6), late.Data["rollup.db_ms"])
+	assert.Equal(t, float64(1), late.Data["rollup.calls"])
+	assert.Equal(t, true, late.Data["meta.late_rollup"])
+
+	// orphans swept by a span send their late rollups without waiting for
+	// async spans that may never be sent
+	mo = setupLibhoney()
+	ctx, tr = NewTrace(context.Background(), "")
+	rs = tr.GetRootSpan()
+	asyncCtx, async1 := rs.CreateAsyncChild(ctx)
+	_, leaked := rs.CreateAsyncChild(ctx)
+	leaked.AddField("name", "leaked")
+	rs.Send()
+	_, orphan := async1.CreateChild(asyncCtx)
+	orphan.AddRollupField("db_ms", 3)
+	async1.Send()
+	events = mo.Events()
+	assert.Equal(t, 4, len(events), "sweeping orphans should flush late rollups")
+	late = nil
+	for _, ev := range events {
+		if ev.Data["name"] == "late_rollups" {
+			late = ev
+		}
+	}
+	if assert.NotNil(t, late, "sweeping orphans should flush late rollups") {
+		assert.Equal(t, float64(3), late.Data["rollup.db_ms"])
+	}
+
+	// traces with no late rollups don't get the event
+	mo = setupLibhoney()
+	ctx, tr = NewTrace(context.Background(), "")
+	_, async1 = tr.GetRootSpan().CreateAsyncChild(ctx)
+	async1.AddRollupField("db_ms", 1)
+	async1.Send()
+	tr.Send()
+	assert.Equal(t, 2, len(mo.Events()))
+}
+
+func TestRollupKinds(t *testing.T) {
+	mo := setupLibhoney()
+	cfg := &Config{Rollups: map[string]Rollup{
+		"calls":   {Kind: RollupCount},
+		"fastest": {Kind: RollupMin},
+		"slowest": {Kind: RollupMax},
+		"hits":    {Kind: RollupAvg},
+		"latency": {Kind: RollupHistogram, Buckets: []float64{10, 100}},
+		"unused":  {Kind: RollupMax},
+	}}
+	ctx, tr := NewTraceFromPropagationContext(context.Background(), nil, WithConfig(cfg))
+	rs := tr.GetRootSpan()
+	for _, v := range []float64{5, 50, 500, 20} {
+		_, child := rs.CreateChild(ctx)
+		child.AddRollupField("calls", v)
+		child.AddRollupField("fastest", v)
+		child.AddRollupField("slowest", v)
+		child.AddRollupField("latency", v)
+		child.AddRollupField("total", v)
+		child.AddRollupField("hits", 1)
+		child.Send()
+	}
+	rs.AddRollupField("hits", 0)
+	rs.Send()
+
+	events := mo.Events()
+	root := events[len(events)-1].Data
+	assert.Equal(t, float64(4), root["rollup.calls"])
+	assert.Equal(t, float64(5), root["rollup.fastest"])
+	assert.Equal(t, float64(500), root["rollup.slowest"])
+	assert.Equal(t, 0.8, root["rollup.hits"])
+	assert.Equal(t, float64(1), root["rollup.latency.le_10"])
+	assert.Equal(t, float64(3), root["rollup.latency.le_100"])
+	assert.Equal(t, float64(4), root["rollup.latency.le_inf"])
+	assert.Equal(t, float64(575), root["rollup.total"], "unregistered keys are summed")
+	assert.NotContains(t, root, "rollup.unused")
+	assert.Equal(t, float64(500), events[2].Data["slowest"], "spans keep their own sum")
+	assert.Equal(t, float64(3), tr.RollupTotals()["latency.le_100"])
+}
+
+func TestCheckpoints(t *testing.T) {
+	mo := setupLibhoney()
+	cfg := &Config{MaxTraceDuration: time.Millisecond}
+	ctx, tr := NewTraceFromPropagationContext(context.Background(), nil,
+		WithConfig(cfg), WithCheckpoints(50*time.Millisecond))
+	rs := tr.GetRootSpan()
+	rs.AddField("name", "session")
+	rs.AddField("app.player", "ada")
+	_, child := rs.CreateChild(ctx)
+	child.AddRollupField("score", 3)
+	child.Send()
+	tr.Checkpoint()
+
+	events := mo.Events()
+	assert.Equal(t, 2, len(events))
+	cp := events[1].Data
+	assert.Equal(t, "checkpoint", cp["name"])
+	assert.Equal(t, rs.GetSpanID(), cp["trace.parent_id"])
+	assert.Equal(t, "ada", cp["app.player"])
+	assert.Equal(t, float64(3), cp["rollup.score"])
+	assert.Equal(t, 1, cp["meta.checkpoint"])
+	assert.Contains(t, cp, "meta.session_elapsed_ms")
+
+	// the timer checkpoints too, and sessions don't expire
+	assert.Eventually(t, func() bool { return len(mo.Events()) > 3 }, 2*time.Second, time.Millisecond)
+	assert.NotContains(t, mo.Events()[2].Data, "meta.expired")
+	rs.Send()
+	n := len(mo.Events())
+	time.Sleep(100 * time.Millisecond)
+	tr.Checkpoint()
+	assert.Equal(t, n, len(mo.Events()), "checkpoints stop when the session ends")
+	assert.Equal(t, "session", mo.Events()[n-1].Data["name"])
+}
+
+func TestRecordTimings(t *testing.T) {
+	setupLibhoney()
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time {
+		now = now.Add(time.Millisecond)
+		return now
+	}
+	ctx, tr := NewTraceFromPropagationContext(context.Background(), nil, WithConfig(&Config{Clock: clock}))
+	root := tr.GetRootSpan()
+	tr.RecordTimings("db", "cache")
+	for i := 0; i < 2; i++ {
+		_, db := root.CreateChild(ctx)
+		db.AddField("name", "db")
+		db.Send()
+	}
+	_, other := root.CreateChild(ctx)
+	other.AddField("name", "render")
+	other.Send()
+	assert.Equal(t, map[string]float64{"db": 2}, tr.Timings(), "only recorded names with sent spans should be timed")
+	assert.Equal(t, 7*time.Millisecond, root.Elapsed())
+}
+
 // TestGetRootSpan verifies the real root span is returned
 func TestGetRootSpan(t *testing.T) {
 	_, tr := NewTrace(context.Background(), "")
@@ -171,6 +351,836 @@ func TestSendTrace(t *testing.T) {
 	assert.Equal(t, expected, actual, "actually sent events doesn't match expectations")
 }
 
+// TestSendSpanEvent verifies span events are sent immediately and attached to
+// their span.
+func TestSendSpanEvent(t *testing.T) {
+	mo := setupLibhoney()
+	_, tr := NewTrace(context.Background(), "")
+	tr.AddField("tenant", "acme")
+	rs := tr.GetRootSpan()
+	rs.SendSpanEvent("cache miss", map[string]interface{}{"key": "user:1"})
+
+	events := mo.Events()
+	assert.Equal(t, 1, len(events), "span events should be sent without waiting for their span")
+	fields := events[0].Data
+	assert.Equal(t, "cache miss", fields["name"])
+	assert.Equal(t, "user:1", fields["key"])
+	assert.Equal(t, "span_event", fields["meta.annotation_type"])
+	assert.Equal(t, rs.GetSpanID(), fields["trace.parent_id"])
+	assert.Equal(t, tr.GetTraceID(), fields["trace.trace_id"])
+	assert.Equal(t, "acme", fields["tenant"], "span events should get trace level fields")
+	assert.Nil(t, fields["duration_ms"])
+}
+
+func TestMaxTraceDuration(t *testing.T) {
+	mo := setupLibhoney()
+	ctx, tr := NewTraceFromPropagationContext(context.Background(), nil, WithConfig(&Config{MaxTraceDuration: 20 * time.Millisecond}))
+	rs := tr.GetRootSpan()
+	rs.AddField("name", "root")
+	_, done := rs.CreateChild(ctx)
+	done.AddField("name", "done")
+	done.Send()
+	_, hung := rs.CreateAsyncChild(ctx)
+	hung.AddField("name", "hung")
+
+	assert.Eventually(t, func() bool { return len(mo.Events()) == 3 }, time.Second, 5*time.Millisecond,
+		"open spans should be sent when the trace expires")
+	expired := make(map[string]interface{})
+	for _, ev := range mo.Events() {
+		expired[ev.Data["name"].(string)] = ev.Data["meta.expired"]
+	}
+	assert.Nil(t, expired["done"], "spans sent before the trace expired should not be marked")
+	assert.Equal(t, true, expired["root"])
+	assert.Equal(t, true, expired["hung"])
+
+	hung.Send()
+	assert.Equal(t, 3, len(mo.Events()), "expired spans should not be sent again")
+
+	// a trace that finishes in time should stop its timer
+	_, tr = NewTraceFromPropagationContext(context.Background(), nil, WithConfig(&Config{MaxTraceDuration: 20 * time.Millisecond}))
+	tr.Send()
+	assert.False(t, tr.expiryTimer.Stop(), "the timer should already have been stopped")
+}
+
+// goroutineLabels returns the goroutine profile, which lists the pprof labels
+// each goroutine has.
+func goroutineLabels() string {
+	var buf bytes.Buffer
+	pprof.Lookup("goroutine").WriteTo(&buf, 1)
+	return buf.String()
+}
+
+// TestSendRestoresLabelsAfterExpiry verifies that Send restores the calling
+// goroutine's labels even when the span was already sent by its trace
+// expiring on another goroutine.
+func TestSendRestoresLabelsAfterExpiry(t *testing.T) {
+	mo := setupLibhoney()
+	ctx, tr := NewTraceFromPropagationContext(context.Background(), nil, WithConfig(&Config{
+		MaxTraceDuration: 20 * time.Millisecond,
+		ProfilerLabels:   true,
+	}))
+	label := `"trace_id":"` + tr.GetTraceID() + `"`
+	rs := tr.GetRootSpan()
+	rs.LabelProfiles(ctx, "root")
+	assert.Contains(t, goroutineLabels(), label)
+
+	assert.Eventually(t, func() bool { return len(mo.Events()) == 1 }, time.Second, 5*time.Millisecond,
+		"the root span should be sent when the trace expires")
+	assert.Contains(t, goroutineLabels(), label, "expiring on another goroutine should leave the labels in place")
+	rs.Send()
+	assert.NotContains(t, goroutineLabels(), label, "Send should restore the labels of an expired span")
+}
+
+func TestMaxSpansPerTrace(t *testing.T) {
+	mo := setupLibhoney()
+	ctx, tr := NewTraceFromPropagationContext(context.Background(), nil, WithConfig(&Config{MaxSpansPerTrace: 3}))
+	rs := tr.GetRootSpan()
+	for i := 0; i < 10; i++ {
+		childCtx, child := rs.CreateChild(ctx)
+		_, grandchild := child.CreateChild(childCtx)
+		grandchild.Send()
+		child.Send()
+	}
+	rs.Send()
+
+	events := mo.Events()
+	// the root, the first child and grandchild, and the summary
+	assert.Equal(t, 4, len(events))
+	summary := events[2].Data
+	assert.Equal(t, "summarized_spans", summary["name"])
+	assert.Equal(t, rs.GetSpanID(), summary["trace.parent_id"])
+	assert.Equal(t, float64(18), summary["meta.summarized_span_count"])
+	assert.NotNil(t, summary["meta.summarized_duration_ms"])
+}
+
+func TestMemoryBudget(t *testing.T) {
+	mo := setupLibhoney()
+	budget := NewMemoryBudget(2*spanMemoryOverhead+spanMemoryOverhead/2, ShedSendOldest)
+	cfg := &Config{MemoryBudget: budget}
+	ctx, old := NewTraceFromPropagationContext(context.Background(), nil, WithConfig(cfg))
+	_, child := old.GetRootSpan().CreateChild(ctx)
+	assert.Equal(t, int64(2), budget.Stats().Spans)
+	assert.Equal(t, int64(2*spanMemoryOverhead), budget.Stats().Bytes)
+	child.AddField("name", "child")
+	assert.Equal(t, int64(2*spanMemoryOverhead+fieldMemory("name", "child")), budget.Stats().Bytes)
+
+	// a third span takes the budget over, so the oldest trace is sent
+	_, tr := NewTraceFromPropagationContext(context.Background(), nil, WithConfig(cfg))
+	assert.True(t, old.GetRootSpan().IsFinished(), "the oldest span should be sent")
+	assert.True(t, child.IsFinished(), "the oldest span's children should be sent with it")
+	assert.False(t, tr.GetRootSpan().IsFinished())
+	events := mo.Events()
+	if assert.Len(t, events, 2) {
+		assert.Nil(t, events[0].Data["meta.shed"], "children should be sent as usual")
+		assert.Equal(t, true, events[1].Data["meta.shed"], "the shed span should be marked")
+	}
+	assert.Equal(t, MemoryStats{
+		MaxBytes:  budget.max,
+		Bytes:     spanMemoryOverhead,
+		Spans:     1,
+		SentEarly: 1,
+	}, budget.Stats())
+	tr.Send()
+	assert.Equal(t, MemoryStats{MaxBytes: budget.max, SentEarly: 1}, budget.Stats())
+}
+
+func TestMemoryBudgetDrop(t *testing.T) {
+	mo := setupLibhoney()
+	budget := NewMemoryBudget(2*spanMemoryOverhead+spanMemoryOverhead/2, ShedDropLowestPriority)
+	ctx, tr := NewTraceFromPropagationContext(context.Background(), nil, WithConfig(&Config{MemoryBudget: budget}))
+	rs := tr.GetRootSpan()
+	_, kept := rs.CreateChild(ctx)
+	kept.AddField("name", "kept")
+	_, dropped := rs.CreateChild(ctx)
+	dropped.AddField("name", "dropped")
+	_, grandchild := dropped.CreateChild(ctx)
+	grandchild.AddField("name", "grandchild")
+	assert.Equal(t, uint64(2), budget.Stats().Dropped, "the newest spans should be dropped")
+
+	rs.Send()
+	assert.True(t, grandchild.IsFinished(), "discarded spans should still send their children")
+	var names []interface{}
+	for _, ev := range mo.Events() {
+		names = append(names, ev.Data["name"])
+	}
+	assert.ElementsMatch(t, []interface{}{"kept", nil}, names,
+		"only the root and the span within the budget should be sent")
+	assert.Equal(t, MemoryStats{MaxBytes: budget.max, Dropped: 2}, budget.Stats())
+}
+
+func TestSpanPriority(t *testing.T) {
+	mo := setupLibhoney()
+	budget := NewMemoryBudget(3*spanMemoryOverhead+spanMemoryOverhead/2, ShedDropLowestPriority)
+	ctx, tr := NewTraceFromPropagationContext(context.Background(), nil, WithConfig(&Config{MemoryBudget: budget}))
+	rs := tr.GetRootSpan()
+	rs.SetPriority(PriorityVerbose)
+	assert.Equal(t, PriorityCritical, rs.Priority(), "root spans should always be critical")
+
+	_, verbose := rs.CreateChild(ctx)
+	verbose.SetPriority(PriorityVerbose)
+	verbose.AddField("name", "verbose")
+	_, failed := rs.CreateChild(ctx)
+	failed.SetPriority(PriorityVerbose)
+	failed.AddFields(map[string]interface{}{"name": "failed", "db.error": "timeout"})
+	assert.Equal(t, PriorityCritical, failed.Priority(), "spans with errors should be critical")
+	assert.Equal(t, uint64(0), budget.Stats().Dropped)
+
+	// the newest span takes the budget over, but the verbose span goes first
+	_, normal := rs.CreateChild(ctx)
+	normal.AddField("name", "normal")
+	assert.Equal(t, PriorityNormal, normal.Priority())
+	assert.Equal(t, uint64(1), budget.Stats().Dropped)
+
+	rs.Send()
+	fields := make(map[interface{}]map[string]interface{})
+	for _, ev := range mo.Events() {
+		fields[ev.Data["name"]] = ev.Data
+	}
+	assert.NotContains(t, fields, "verbose", "the verbose span should be dropped")
+	assert.Contains(t, fields, "normal")
+	assert.Nil(t, fields["normal"]["meta.priority"], "normal spans shouldn't be marked")
+	if assert.Contains(t, fields, "failed", "the span with an error should be kept") {
+		assert.Equal(t, "verbose", fields["failed"]["meta.priority"], "the priority should be sent")
+	}
+}
+
+func TestCollapseSpans(t *testing.T) {
+	mo := setupLibhoney()
+	cfg := &Config{CollapseSpans: []CollapseRule{
+		{Names: []string{"cache.get"}},
+		{Fields: map[string]interface{}{"meta.type": "dns"}, Prefix: "wide."},
+	}}
+	ctx, tr := NewTraceFromPropagationContext(context.Background(), nil, WithConfig(cfg))
+	rs := tr.GetRootSpan()
+	for i := 0; i < 3; i++ {
+		_, get := rs.CreateChild(ctx)
+		get.AddField("name", "cache.get")
+		if i == 1 {
+			get.AddField("cache.error", "miss")
+		}
+		get.Send()
+	}
+	_, lookup := rs.CreateChild(ctx)
+	lookup.AddFields(map[string]interface{}{"name": "lookup", "meta.type": "dns"})
+	lookup.Send()
+	_, critical := rs.CreateChild(ctx)
+	critical.AddField("name", "cache.get")
+	critical.SetPriority(PriorityCritical)
+	critical.Send()
+	// spans with children are sent, and so are their children
+	childCtx, parent := rs.CreateChild(ctx)
+	parent.AddField("name", "cache.get")
+	_, child := parent.CreateChild(childCtx)
+	child.AddField("name", "query")
+	child.Send()
+	parent.Send()
+	rs.Send()
+	// too late to collapse
+	_, late := rs.CreateChild(ctx)
+	late.AddField("name", "cache.get")
+	late.Send()
+
+	var names []interface{}
+	var root map[string]interface{}
+	for _, ev := range mo.Events() {
+		names = append(names, ev.Data["name"])
+		if ev.Data["meta.span_type"] == "root" {
+			root = ev.Data
+		}
+	}
+	// the span with an error is sent, even though it matches a rule
+	assert.Equal(t, []interface{}{"cache.get", "cache.get", "query", "cache.get", nil, "cache.get"}, names)
+	assert.Equal(t, "miss", mo.Events()[0].Data["cache.error"])
+	assert.Equal(t, 2, root["collapsed.cache.get.count"])
+	assert.IsType(t, float64(0), root["collapsed.cache.get.duration_ms"])
+	assert.True(t, root["collapsed.cache.get.max_duration_ms"].(float64) <= root["collapsed.cache.get.duration_ms"].(float64))
+	assert.Equal(t, 1, root["wide.lookup.count"])
+}
+
+func TestCompressSiblings(t *testing.T) {
+	mo := setupLibhoney()
+	start := time.Unix(1000, 0)
+	now := start
+	cfg := &Config{
+		CompressSiblings: 3,
+		Clock:            func() time.Time { return now },
+	}
+	ctx, tr := NewTraceFromPropagationContext(context.Background(), nil, WithConfig(cfg))
+	rs := tr.GetRootSpan()
+	get := func(key string, took time.Duration) {
+		_, span := rs.CreateChild(ctx)
+		span.AddFields(map[string]interface{}{"name": "redis.get", "redis.key": key})
+		now = now.Add(took)
+		span.Send()
+	}
+	for i, took := range []time.Duration{2, 1, 3, 2} {
+		get(fmt.Sprint(i), took*time.Millisecond)
+	}
+	assert.Empty(t, mo.Events(), "the run should be held until it ends")
+	// a different sibling ends the run, and so does an error
+	_, set := rs.CreateChild(ctx)
+	set.AddField("name", "redis.set")
+	set.Send()
+	get("a", time.Millisecond)
+	_, failed := rs.CreateChild(ctx)
+	failed.AddFields(map[string]interface{}{"name": "redis.get", "redis.key": "b", "redis.error": "down"})
+	failed.Send()
+	get("c", time.Millisecond)
+	get("d", time.Millisecond)
+	rs.Send()
+
+	var names []interface{}
+	for _, ev := range mo.Events() {
+		names = append(names, ev.Data["name"])
+	}
+	assert.Equal(t, []interface{}{"redis.get", "redis.set", "redis.get", "redis.get", "redis.get", "redis.get", nil}, names,
+		"short runs should be sent as they were")
+	compressed := mo.Events()[0].Data
+	assert.Equal(t, "0", compressed["redis.key"], "the first span should stand in for the run")
+	assert.Equal(t, 4, compressed["meta.compressed_span_count"])
+	assert.Equal(t, float64(8), compressed["meta.compressed_duration_ms"])
+	assert.Equal(t, float64(1), compressed["meta.compressed_min_duration_ms"])
+	assert.Equal(t, float64(3), compressed["meta.compressed_max_duration_ms"])
+	assert.Equal(t, float64(8), compressed["duration_ms"], "the compressed span should last from the first start to the last end")
+	assert.Nil(t, mo.Events()[2].Data["meta.compressed_span_count"])
+}
+
+func TestCompressSiblingsHoldsSpansOpen(t *testing.T) {
+	mo := setupLibhoney()
+	budget := NewMemoryBudget(1<<30, ShedSendOldest)
+	cfg := &Config{
+		CompressSiblings: 3,
+		Exemplars:        1,
+		MemoryBudget:     budget,
+		MaxTraceDuration: time.Hour,
+	}
+	ctx, tr := NewTraceFromPropagationContext(context.Background(), nil, WithConfig(cfg))
+	rs := tr.GetRootSpan()
+	get := func() {
+		_, span := rs.CreateChild(ctx)
+		span.AddField("name", "redis.get")
+		span.Send()
+	}
+	get()
+	get()
+	assert.Empty(t, mo.Events())
+	assert.Equal(t, int64(3), budget.Stats().Spans, "held spans should stay in the budget")
+	assert.Equal(t, int32(3), atomic.LoadInt32(&tr.openCount), "held spans should stay open")
+	get()
+	get()
+	assert.Equal(t, int64(3), budget.Stats().Spans, "only the first span and the exemplar should be held")
+	assert.Equal(t, int32(3), atomic.LoadInt32(&tr.openCount))
+	rs.Send()
+	assert.Len(t, mo.Events(), 3)
+	assert.Equal(t, int64(0), budget.Stats().Spans)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&tr.openCount))
+
+	// a leaked parent's held spans are sent when the trace expires
+	mo = setupLibhoney()
+	ctx, tr = NewTraceFromPropagationContext(context.Background(), nil, WithConfig(cfg))
+	rs = tr.GetRootSpan()
+	get()
+	get()
+	tr.expire()
+	events := mo.Events()
+	if assert.Len(t, events, 3) {
+		for _, ev := range events[:2] {
+			assert.Equal(t, "redis.get", ev.Data["name"])
+			assert.Nil(t, ev.Data["meta.expired"], "held spans finished in time")
+		}
+		assert.Equal(t, true, events[2].Data["meta.expired"])
+	}
+	assert.Equal(t, int64(0), budget.Stats().Spans)
+
+	// held spans can be dropped to stay within the budget
+	mo = setupLibhoney()
+	budget = NewMemoryBudget(3*spanMemoryOverhead+spanMemoryOverhead/2, ShedDropLowestPriority)
+	cfg.MemoryBudget = budget
+	ctx, tr = NewTraceFromPropagationContext(context.Background(), nil, WithConfig(cfg))
+	rs = tr.GetRootSpan()
+	for i := 0; i < 2; i++ {
+		_, span := rs.CreateChild(ctx)
+		span.AddField("name", "redis.get")
+		span.SetPriority(PriorityVerbose)
+		span.Send()
+	}
+	_, other := rs.CreateChild(ctx)
+	assert.Equal(t, uint64(1), budget.Stats().Dropped, "a held span should be dropped")
+	other.Send()
+	rs.Send()
+	assert.Len(t, mo.Events(), 3, "the dropped span shouldn't be sent")
+	assert.Equal(t, int64(0), budget.Stats().Spans)
+}
+
+func TestExemplars(t *testing.T) {
+	spans := make([]*Span, 5)
+	for i := range spans {
+		spans[i] = &Span{}
+	}
+	e := exemplars{max: 3}
+	for i, dur := range []float64{5, 9, 1, 7, 8} {
+		e.offer(spans[i], dur)
+	}
+	assert.Equal(t, []exemplar{{spans[1], 9}, {spans[4], 8}, {spans[3], 7}}, e.slowest)
+
+	mo := setupLibhoney()
+	now := time.Unix(1000, 0)
+	cfg := &Config{
+		CollapseSpans:    []CollapseRule{{Names: []string{"cache.get"}}},
+		CompressSiblings: 3,
+		Exemplars:        1,
+		Clock:            func() time.Time { return now },
+	}
+	ctx, tr := NewTraceFromPropagationContext(context.Background(), nil, WithConfig(cfg))
+	rs := tr.GetRootSpan()
+	for i, took := range []time.Duration{2, 5, 3} {
+		_, span := rs.CreateChild(ctx)
+		span.AddFields(map[string]interface{}{"name": "cache.get", "i": i})
+		now = now.Add(took * time.Millisecond)
+		span.Send()
+	}
+	for i, took := range []time.Duration{2, 5, 3, 4} {
+		_, span := rs.CreateChild(ctx)
+		span.AddFields(map[string]interface{}{"name": "redis.get", "i": i})
+		now = now.Add(took * time.Millisecond)
+		span.Send()
+	}
+	rs.Send()
+
+	var examples []interface{}
+	for _, ev := range mo.Events() {
+		if ev.Data["meta.exemplar"] == true {
+			examples = append(examples, fmt.Sprintf("%v %v %v", ev.Data["name"], ev.Data["i"], ev.Data["duration_ms"]))
+		}
+	}
+	assert.ElementsMatch(t, []interface{}{"cache.get 1 5", "redis.get 1 5"}, examples,
+		"the slowest collapsed and compressed spans should be sent")
+	assert.Len(t, mo.Events(), 4)
+}
+
+func TestExternalTraceID(t *testing.T) {
+	id := ExternalTraceID("order", "1234")
+	assert.Len(t, id, 2*traceIDLengthBytes)
+	assert.Equal(t, id, ExternalTraceID("order", "1234"), "IDs should be stable")
+	assert.NotEqual(t, id, ExternalTraceID("invoice", "1234"), "namespaces should be independent")
+	assert.NotEqual(t, ExternalTraceID("ab", "c"), ExternalTraceID("a", "bc"), "pairs shouldn't run together")
+
+	mo := setupLibhoney()
+	_, tr := NewTraceFromPropagationContext(context.Background(), nil, WithExternalTraceID("order", "1234"))
+	assert.Equal(t, id, tr.GetTraceID())
+	tr.GetRootSpan().Send()
+	if events := mo.Events(); assert.Len(t, events, 1) {
+		assert.Equal(t, id, events[0].Data["trace.trace_id"])
+		assert.Equal(t, "order", events[0].Data["meta.trace_id_namespace"])
+	}
+
+	prop := &propagation.PropagationContext{TraceID: "upstream", ParentID: "parent"}
+	_, tr = NewTraceFromPropagationContext(context.Background(), prop, WithExternalTraceID("order", "1234"))
+	assert.Equal(t, "upstream", tr.GetTraceID(), "propagated traces should keep their IDs")
+}
+
+func TestCorrelationIDs(t *testing.T) {
+	mo := setupLibhoney()
+	cfg := &Config{CorrelationHeaders: map[string]string{
+		"request_id": "X-Request-ID",
+		"order_id":   "X-Order-ID",
+	}}
+	headers := map[string]string{"X-Request-ID": "req-1", "X-Order-ID": "order-from-header"}
+	src := &propagation.Source{Header: func(name string) string { return headers[name] }}
+	prop := &propagation.PropagationContext{
+		TraceID:      "trace",
+		ParentID:     "parent",
+		TraceContext: map[string]interface{}{"correlation.order_id": "order-upstream"},
+	}
+	ctx, tr := NewTraceFromPropagationContext(context.Background(), prop, WithConfig(cfg), WithSource(src))
+	assert.Equal(t, "req-1", tr.CorrelationID("request_id"))
+	assert.Equal(t, "order-upstream", tr.CorrelationID("order_id"), "propagated IDs should win")
+	tr.AddCorrelationID("job_id", "job-1")
+
+	_, child := tr.GetRootSpan().CreateChild(ctx)
+	out := child.PropagationHeaders(ctx)
+	assert.Equal(t, "req-1", out["X-Request-ID"])
+	assert.Equal(t, "order-upstream", out["X-Order-ID"])
+	assert.NotContains(t, out, "job_id", "IDs without headers should only be in the trace context")
+	assert.Equal(t, "job-1", child.PropagationContext().TraceContext["correlation.job_id"])
+	child.Send()
+	if events := mo.Events(); assert.Len(t, events, 1) {
+		assert.Equal(t, "req-1", events[0].Data["correlation.request_id"])
+		assert.Equal(t, "job-1", events[0].Data["correlation.job_id"])
+	}
+}
+
+func TestClockAndIDs(t *testing.T) {
+	mo := setupLibhoney()
+	start := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	var ids int
+	ctx, tr := NewTraceFromPropagationContext(context.Background(), nil, WithConfig(&Config{
+		Clock: func() time.Time {
+			now = now.Add(time.Second)
+			return now
+		},
+		NewTraceID: func() string { return "trace" },
+		NewSpanID: func() string {
+			ids++
+			return fmt.Sprintf("span%d", ids)
+		},
+	}))
+	rs := tr.GetRootSpan()
+	_, child := rs.CreateChild(ctx)
+	child.SendSpanEvent("event", nil)
+	child.Send()
+	rs.Send()
+
+	events := mo.Events()
+	assert.Equal(t, 3, len(events))
+	assert.Equal(t, "trace", tr.GetTraceID())
+	assert.Equal(t, start.Add(3*time.Second), events[0].Timestamp, "span event")
+	assert.Equal(t, "span2", events[0].Data["trace.parent_id"])
+	assert.Equal(t, start.Add(2*time.Second), events[1].Timestamp, "child")
+	assert.Equal(t, float64(2000), events[1].Data["duration_ms"])
+	assert.Equal(t, "span1", events[2].Data["trace.span_id"])
+	assert.Equal(t, start.Add(time.Second), events[2].Timestamp, "root")
+	assert.Equal(t, float64(4000), events[2].Data["duration_ms"])
+}
+
+func TestDurationCorrections(t *testing.T) {
+	mo := setupLibhoney()
+	now := time.Unix(1000, 0)
+	step := time.Second
+	ctx, tr := NewTraceFromPropagationContext(context.Background(), nil, WithConfig(&Config{
+		Clock: func() time.Time {
+			now = now.Add(step)
+			return now
+		},
+		MaxSpanDuration: time.Hour,
+	}))
+	rs := tr.GetRootSpan()
+	_, stepped := rs.CreateChild(ctx)
+	step = -5 * time.Second
+	stepped.Send()
+	_, jumped := rs.CreateChild(ctx)
+	step = 2 * time.Hour
+	jumped.Send()
+	step = time.Second
+	_, fine := rs.CreateChild(ctx)
+	fine.Send()
+	rs.Send()
+
+	events := mo.Events()
+	assert.Equal(t, 4, len(events))
+	assert.Equal(t, "negative", events[0].Data["meta.duration_corrected"])
+	assert.Equal(t, float64(-5000), events[0].Data["meta.clock_duration_ms"])
+	assert.True(t, events[0].Data["duration_ms"].(float64) >= 0, "negative durations should be replaced")
+	assert.Equal(t, "too_long", events[1].Data["meta.duration_corrected"])
+	assert.Equal(t, float64(2*time.Hour/time.Millisecond), events[1].Data["meta.clock_duration_ms"])
+	assert.True(t, events[1].Data["duration_ms"].(float64) < 1000, "durations the monotonic clock disagrees with should be replaced")
+	assert.Nil(t, events[2].Data["meta.duration_corrected"])
+	assert.Nil(t, events[2].Data["meta.clock_duration_ms"])
+	assert.Equal(t, float64(1000), events[2].Data["duration_ms"])
+	assert.Equal(t, "too_long", events[3].Data["meta.duration_corrected"], "the root ran across the jump too")
+}
+
+func TestTrustPolicy(t *testing.T) {
+	mo := setupLibhoney()
+	prop := &propagation.PropagationContext{TraceID: "abcdef", ParentID: "123456", Dataset: "forged"}
+	cfg := &Config{TrustPolicy: &propagation.TrustPolicy{Mode: propagation.TrustTraceIDOnly}}
+	_, tr := NewTraceFromPropagationContext(context.Background(), prop, WithConfig(cfg))
+	tr.Send()
+	_, tr = NewTraceFromPropagationContext(context.Background(), prop, WithConfig(&Config{}))
+	tr.Send()
+
+	events := mo.Events()
+	assert.Equal(t, 2, len(events))
+	assert.Equal(t, "abcdef", events[0].Data["trace.trace_id"])
+	assert.NotContains(t, events[0].Data, "trace.parent_id", "the forged parent should be ignored")
+	assert.NotEqual(t, "forged", events[0].Dataset)
+	assert.Equal(t, true, events[0].Data["meta.untrusted_trace_context"])
+	assert.Equal(t, "123456", events[1].Data["trace.parent_id"], "context should be honored without a policy")
+	assert.NotContains(t, events[1].Data, "meta.untrusted_trace_context")
+}
+
+func TestTraceHops(t *testing.T) {
+	mo := setupLibhoney()
+	prop := &propagation.PropagationContext{TraceID: "abcdef", ParentID: "123456", Hops: 2}
+	_, tr := NewTraceFromPropagationContext(context.Background(), prop, WithConfig(&Config{MaxTraceHops: 2}))
+	assert.Equal(t, uint(2), tr.Hops())
+	assert.Equal(t, uint(3), tr.GetRootSpan().PropagationContext().Hops, "outgoing context counts this hop")
+	tr.Send()
+
+	prop.Hops = 3
+	_, tr = NewTraceFromPropagationContext(context.Background(), prop, WithConfig(&Config{MaxTraceHops: 2}))
+	tr.Send()
+
+	events := mo.Events()
+	assert.Equal(t, 2, len(events))
+	assert.Equal(t, "abcdef", events[0].Data["trace.trace_id"])
+	assert.Equal(t, uint(2), events[0].Data["trace.hops"])
+	assert.NotContains(t, events[0].Data, "meta.max_trace_hops_exceeded")
+	assert.NotEqual(t, "abcdef", events[1].Data["trace.trace_id"], "a looping trace should start over")
+	assert.NotContains(t, events[1].Data, "trace.parent_id")
+	assert.NotContains(t, events[1].Data, "trace.hops")
+	assert.Equal(t, true, events[1].Data["meta.max_trace_hops_exceeded"])
+	assert.Equal(t, "abcdef", events[1].Data["meta.previous_trace_id"])
+}
+
+func TestOrphanedSpans(t *testing.T) {
+	mo := setupLibhoney()
+	var orphans []OrphanedSpan
+	cfg := &Config{
+		OrphanedSpanHook: func(o OrphanedSpan) {
+			o.Span.AddField("app.seen_by_hook", true)
+			orphans = append(orphans, o)
+		},
+		OrphanGoroutineDump: true,
+	}
+	ctx, tr := NewTraceFromPropagationContext(context.Background(), nil, WithConfig(cfg))
+	rs := tr.GetRootSpan()
+	rs.AddField("name", "root")
+	childCtx, child := rs.CreateChild(ctx)
+	_, grandchild := child.CreateChild(childCtx)
+	_, sent := rs.CreateChild(ctx)
+	sent.Send()
+	rs.Send()
+
+	assert.Equal(t, 2, len(orphans))
+	assert.Equal(t, child, orphans[0].Span)
+	assert.Equal(t, grandchild, orphans[1].Span)
+	for _, o := range orphans {
+		assert.Equal(t, rs, o.SentBy, "orphans should credit the span whose Send swept them up")
+		assert.Contains(t, string(o.Goroutines), "TestOrphanedSpans")
+	}
+	assert.Equal(t, &orphans[0].Goroutines[0], &orphans[1].Goroutines[0], "one Send should take one dump")
+
+	events := mo.Events()
+	assert.Equal(t, 4, len(events))
+	assert.NotContains(t, events[0].Data, "meta.sent_by_parent", "sent spans aren't orphans")
+	for _, ev := range events[1:3] {
+		assert.Equal(t, true, ev.Data["meta.sent_by_parent"])
+		assert.Equal(t, rs.GetSpanID(), ev.Data["meta.sent_by"])
+		assert.Equal(t, "root", ev.Data["meta.sent_by_name"])
+		assert.Contains(t, ev.Data, "meta.unfinished_ms")
+		assert.Contains(t, ev.Data, "meta.orphan_goroutines")
+		assert.Equal(t, true, ev.Data["app.seen_by_hook"])
+	}
+	assert.NotContains(t, events[3].Data, "meta.sent_by")
+}
+
+func TestSpanLifecycle(t *testing.T) {
+	setupLibhoney()
+	ctx, tr := NewTrace(context.Background(), "")
+	rs := tr.GetRootSpan()
+	_, child := rs.CreateChild(ctx)
+	var ended []string
+	var stateInHook SpanState
+	child.OnEnd(func(s *Span) {
+		stateInHook = s.State()
+		ended = append(ended, "child")
+	})
+	rs.OnEnd(func(*Span) { ended = append(ended, "root") })
+	assert.Equal(t, SpanStarted, child.State())
+	assert.False(t, child.IsFinished())
+
+	before := RepeatedSends()
+	rs.Send()
+	assert.True(t, child.IsSent(), "children sent by their parent are sent")
+	assert.True(t, rs.IsFinished())
+	assert.Equal(t, SpanSent, stateInHook)
+	assert.Equal(t, "sent", rs.State().String())
+	assert.Equal(t, []string{"child", "root"}, ended)
+
+	rs.Send()
+	child.Send()
+	assert.Equal(t, before+2, RepeatedSends())
+	assert.Equal(t, []string{"child", "root"}, ended, "OnEnd functions run once")
+	rs.OnEnd(func(*Span) { ended = append(ended, "late") })
+	assert.Equal(t, []string{"child", "root", "late"}, ended, "functions registered after the span was sent run right away")
+}
+
+func TestLateChildren(t *testing.T) {
+	mo := setupLibhoney()
+	ctx, tr := NewTrace(context.Background(), "")
+	tr.AddField("tenant", "acme")
+	rs := tr.GetRootSpan()
+	childCtx, child := rs.CreateChild(ctx)
+	child.Send()
+	_, late := child.CreateChild(childCtx)
+	assert.Equal(t, child, late.GetParent(), "late children are kept by default")
+	late.Send()
+	assert.Equal(t, true, mo.Events()[1].Data["meta.late"])
+
+	cfg := &Config{LateChildren: LateChildToRoot}
+	ctx, tr = NewTraceFromPropagationContext(context.Background(), nil, WithConfig(cfg))
+	tr.AddField("tenant", "acme")
+	rs = tr.GetRootSpan()
+	childCtx, child = rs.CreateChild(ctx)
+	child.Send()
+	_, late = child.CreateChild(childCtx)
+	assert.Equal(t, rs, late.GetParent())
+	assert.Equal(t, []*Span{late}, rs.GetChildren(), "the root should send late children")
+	rs.Send()
+	assert.True(t, late.IsSent())
+
+	sent := len(mo.Events())
+	lateCtx, late := rs.CreateChild(ctx)
+	assert.NotEqual(t, tr.GetTraceID(), late.GetTrace().GetTraceID(), "late children of a sent root start a new trace")
+	assert.Equal(t, late, GetSpanFromContext(lateCtx))
+	late.Send()
+	events := mo.Events()[sent:]
+	assert.Equal(t, 2, len(events))
+	link, newRoot := events[0].Data, events[1].Data
+	assert.Equal(t, "link", link["meta.annotation_type"])
+	assert.Equal(t, tr.GetTraceID(), link["trace.link.trace_id"])
+	assert.Equal(t, rs.GetSpanID(), link["trace.link.span_id"])
+	assert.Equal(t, late.GetSpanID(), link["trace.parent_id"])
+	assert.Equal(t, true, newRoot["meta.late"])
+	assert.Equal(t, "acme", newRoot["tenant"], "late traces keep trace level fields")
+	assert.NotContains(t, newRoot, "trace.parent_id")
+}
+
+func TestFieldPrefixes(t *testing.T) {
+	mo := setupLibhoney()
+	var hooked map[string]interface{}
+	cfg := &Config{
+		FieldPrefixes: map[string]string{"db": "sql.", "sql": "x.", "app": "", "trace": "t."},
+		PresendHook:   func(fields map[string]interface{}) { hooked = fields },
+	}
+	_, tr := NewTraceFromPropagationContext(context.Background(), nil, WithConfig(cfg))
+	rs := tr.GetRootSpan()
+	rs.AddField("db.query", "select 1")
+	rs.AddField("sql.driver", "pq")
+	rs.AddField("app.user_id", 7)
+	rs.AddField("request.path", "/")
+	rs.Send()
+
+	data := mo.Events()[0].Data
+	assert.Equal(t, "select 1", data["sql.query"])
+	assert.Equal(t, "pq", data["x.driver"], "renamed fields shouldn't be renamed again")
+	assert.Equal(t, 7, data["user_id"])
+	assert.Equal(t, "/", data["request.path"])
+	assert.Contains(t, data, "trace.trace_id", "the trace namespace is reserved")
+	assert.NotContains(t, data, "db.query")
+	assert.NotContains(t, data, "app.user_id")
+	assert.Equal(t, "select 1", hooked["sql.query"], "hooks should see renamed fields")
+}
+
+func TestFieldNaming(t *testing.T) {
+	mo := setupLibhoney()
+	for _, naming := range []FieldNaming{FieldNamingLegacy, FieldNamingSemConv, FieldNamingBoth} {
+		cfg := &Config{
+			FieldNaming: naming,
+			FieldNames:  map[string]string{"db.query": "", "app.tenant": "tenant.id"},
+		}
+		_, tr := NewTraceFromPropagationContext(context.Background(), nil, WithConfig(cfg))
+		rs := tr.GetRootSpan()
+		rs.AddField("request.method", "GET")
+		rs.AddField("db.query", "select 1")
+		rs.AddField("app.tenant", "acme")
+		rs.Send()
+	}
+
+	events := mo.Events()
+	legacy, semconv, both := events[0].Data, events[1].Data, events[2].Data
+	assert.Equal(t, "GET", legacy["request.method"])
+	assert.NotContains(t, legacy, "http.request.method")
+	assert.Equal(t, "GET", semconv["http.request.method"])
+	assert.NotContains(t, semconv, "request.method")
+	assert.Equal(t, "acme", semconv["tenant.id"])
+	assert.Equal(t, "select 1", semconv["db.query"], "fields mapped to an empty name keep their own")
+	assert.NotContains(t, semconv, "db.query.text")
+	assert.Equal(t, "GET", both["http.request.method"])
+	assert.Equal(t, "GET", both["request.method"])
+	assert.Equal(t, "db.query.text", SemanticConventionNames()["db.query"])
+}
+
+func TestDatasetRoutes(t *testing.T) {
+	mo := setupLibhoney()
+	cfg := &Config{DatasetRoutes: []DatasetRoute{
+		{Dataset: "audit", Names: []string{"login", "logout"}, Fields: map[string]interface{}{"app.audit": true}},
+		{Dataset: "slow", Match: func(fields map[string]interface{}) bool {
+			ms, _ := fields["app.ms"].(int)
+			return ms > 100
+		}},
+		{Dataset: "never", Names: []string{"login"}},
+	}}
+	ctx, tr := NewTraceFromPropagationContext(context.Background(), nil, WithConfig(cfg))
+	rs := tr.GetRootSpan()
+	for _, fields := range []map[string]interface{}{
+		{"name": "login", "app.audit": true},
+		{"name": "logout", "app.audit": []string{"uncomparable"}, "app.ms": 500},
+		{"name": "query", "app.ms": 5},
+	} {
+		_, child := rs.CreateChild(ctx)
+		child.AddFields(fields)
+		child.Send()
+	}
+	rs.Send()
+
+	events := mo.Events()
+	assert.Equal(t, "audit", events[0].Dataset)
+	assert.Equal(t, "slow", events[1].Dataset, "every criterion of a route must match")
+	assert.Equal(t, "placeholder", events[2].Dataset)
+	assert.Equal(t, "placeholder", events[3].Dataset)
+}
+
+func TestSampleOptions(t *testing.T) {
+	mo := setupLibhoney()
+	_, tr := NewTraceFromPropagationContext(context.Background(), nil, WithDrop())
+	tr.GetRootSpan().Send()
+	assert.Equal(t, 0, len(mo.Events()), "WithDrop traces should never be sent")
+
+	// the trace ID decides, so find one kept at rate 2 and one dropped
+	for _, id := range []string{"a", "b", "c", "d", "e", "f"} {
+		prop := &propagation.PropagationContext{TraceID: id, ParentID: "p"}
+		_, tr = NewTraceFromPropagationContext(context.Background(), prop, WithSampleRate(2))
+		tr.GetRootSpan().Send()
+	}
+	events := mo.Events()
+	assert.True(t, len(events) > 0 && len(events) < 6, "%d of 6 traces kept", len(events))
+	for _, ev := range events {
+		assert.Equal(t, uint(2), ev.SampleRate)
+	}
+}
+
+func TestHeadSampling(t *testing.T) {
+	mo := setupLibhoney()
+	// a sample rate this high keeps almost no traces
+	sampler, err := sample.NewDeterministicSampler(1 << 30)
+	assert.NoError(t, err)
+	var tr *Trace
+	var ctx context.Context
+	for i := 0; i < 10; i++ {
+		ctx, tr = NewTraceFromPropagationContext(context.Background(), nil, WithConfig(&Config{Sampler: sampler}))
+		if tr.isDropped() {
+			break
+		}
+	}
+	assert.True(t, tr.isDropped(), "the trace should be dropped when it is created")
+	rs := tr.GetRootSpan()
+	rs.AddField("name", "root")
+	rs.AddRollupField("count", 1)
+	tr.AddField("propagated", true)
+	childCtx, child := rs.CreateChild(ctx)
+	_, grandchild := child.CreateChild(childCtx)
+	assert.Equal(t, child, grandchild.GetParent())
+	assert.Empty(t, rs.GetChildren(), "children of dropped traces shouldn't be tracked")
+	assert.Equal(t, tr.GetTraceID(), child.PropagationContext().TraceID, "dropped traces should still propagate")
+	assert.Equal(t, true, child.PropagationContext().TraceContext["propagated"])
+	grandchild.Send()
+	child.Send()
+	rs.SendSpanEvent("nothing", nil)
+	rs.Send()
+	assert.Empty(t, mo.Events())
+
+	// kept traces use the decision made when they were created
+	keepAll, err := sample.NewDeterministicSampler(1)
+	assert.NoError(t, err)
+	_, tr = NewTraceFromPropagationContext(context.Background(), nil, WithConfig(&Config{Sampler: keepAll}))
+	assert.False(t, tr.isDropped())
+	tr.Send()
+	assert.Equal(t, 1, len(mo.Events()))
+}
+
 // TestCreateSpan verifies spans created have the expected basic contents
 func TestSpan(t *testing.T) {
 	mo := setupLibhoney()
@@ -233,12 +1243,12 @@ func TestSpan(t *testing.T) {
 	assert.Equal(t, rs, asyncParent, "span and asyncSpan's parent should be the root span")
 
 	span.AddTraceField("tr1", "vr1")
-	assert.Equal(t, "vr1", tr.traceLevelFields["tr1"], "span's trace fields should be added to the trace")
+	assert.Equal(t, "vr1", traceFields(tr)["tr1"], "span's trace fields should be added to the trace")
 	assert.Nil(t, span.ev.Fields()["tr1"], "span should not have trace fields present")
 
 	headers := span.SerializeHeaders()
 	// magical string here is base64 encoded "tr1" field for the trace propagation
-	expectedHeader := fmt.Sprintf("1;trace_id=%s,parent_id=%s,dataset=placeholder,context=eyJ0cjEiOiJ2cjEifQ==", tr.traceID, span.spanID)
+	expectedHeader := fmt.Sprintf("1;trace_id=%s,parent_id=%s,dataset=placeholder,hops=1,context=eyJ0cjEiOiJ2cjEifQ==", tr.traceID, span.spanID)
 	assert.Equal(t, expectedHeader, headers, "serialized span should match expectations")
 
 	childSpan.Send()
@@ -357,6 +1367,34 @@ func TestChildAndParentSendsDoNotRace(t *testing.T) {
 	wg.Wait()
 }
 
+func TestRemoveChildSpan(t *testing.T) {
+	setupLibhoney()
+	ctx, tr := NewTrace(context.Background(), "")
+	rs := tr.GetRootSpan()
+	var children []*Span
+	for i := 0; i < 6; i++ {
+		_, c := rs.CreateChild(ctx)
+		children = append(children, c)
+	}
+	children[1].Send()
+	children[4].Send()
+	assert.Equal(t, []*Span{children[0], children[2], children[3], children[5]}, rs.GetChildren(),
+		"sent children should be removed and the rest kept in order")
+
+	// sending half of them compacts the children, leaving the rest
+	// removable
+	children[0].Send()
+	assert.Equal(t, []*Span{children[2], children[3], children[5]}, rs.children)
+	children[5].Send()
+	_, c := rs.CreateChild(ctx)
+	assert.Equal(t, []*Span{children[2], children[3], c}, rs.GetChildren())
+	children[2].Send()
+	children[3].Send()
+	c.Send()
+	assert.Empty(t, rs.children)
+	assert.Empty(t, rs.GetChildren())
+}
+
 func TestAddFieldDoesNotCauseRaceInSendHooks(t *testing.T) {
 	samplerHook := func(fields map[string]interface{}) (bool, int) {
 		for range fields {
@@ -419,7 +1457,7 @@ func TestPropagatedFields(t *testing.T) {
 	assert.Equal(t, prop.TraceID, tr.traceID, "trace id should have propagated")
 	assert.Equal(t, prop.ParentID, tr.parentID, "parent id should have propagated")
 	assert.Equal(t, prop.Dataset, tr.builder.Dataset, "dataset should have propagated")
-	assert.Equal(t, prop.TraceContext, tr.traceLevelFields, "trace fields should have propagated")
+	assert.Equal(t, prop.TraceContext, traceFields(tr), "trace fields should have propagated")
 
 	trFromContext := GetTraceFromContext(ctx)
 	assert.Equal(t, tr, trFromContext, "new trace should put the trace in the context")
@@ -428,7 +1466,7 @@ func TestPropagatedFields(t *testing.T) {
 	assert.Equal(t, tr.traceID, tr2.traceID, "trace ID should shave propagated")
 	assert.NotEqual(t, tr.parentID, tr2.parentID, "parent ID should have changed")
 	assert.Equal(t, tr.builder.Dataset, tr2.builder.Dataset, "dataset should have propagated")
-	assert.Equal(t, tr.traceLevelFields, tr2.traceLevelFields, "trace fields should have propagated")
+	assert.Equal(t, traceFields(tr), traceFields(tr2), "trace fields should have propagated")
 
 	prop = &propagation.PropagationContext{
 		TraceID:  "trace id",
@@ -444,14 +1482,14 @@ func TestPropagatedFields(t *testing.T) {
 	assert.Equal(t, "trace id", tr.traceID, "trace id should have propagated")
 	assert.Equal(t, "parent id", tr.parentID, "parent id should have propagated")
 	assert.Equal(t, prop.Dataset, tr.builder.Dataset, "dataset should have propagated")
-	assert.Equal(t, prop.TraceContext, tr.traceLevelFields, "trace fields should have propagated")
+	assert.Equal(t, prop.TraceContext, traceFields(tr), "trace fields should have propagated")
 
 	ctx, tr = NewTrace(context.Background(), "garbage")
 	assert.NotNil(t, tr.builder, "traces should have a builder")
 	assert.NotEqual(t, "", tr.traceID, "trace id should have propagated")
 	assert.Equal(t, "", tr.parentID, "parent id should have propagated")
 	assert.Equal(t, "placeholder", tr.builder.Dataset, "dataset should have propagated")
-	assert.Equal(t, map[string]interface{}{}, tr.traceLevelFields, "trace fields should have propagated")
+	assert.Equal(t, map[string]interface{}{}, traceFields(tr), "trace fields should have propagated")
 
 }
 
@@ -481,6 +1519,70 @@ func BenchmarkSendChildSpans(b *testing.B) {
 	})
 }
 
+func TestKeyPrefix(t *testing.T) {
+	p := NewKeyPrefix("app.")
+	assert.Equal(t, "app.", p.Prefix())
+	assert.Equal(t, "app.user", p.Key("user"))
+	assert.Equal(t, "app.user", p.Key("user"))
+	key := "user"
+	allocs := testing.AllocsPerRun(100, func() {
+		_ = p.Key(key)
+	})
+	assert.Equal(t, float64(0), allocs, "interned keys shouldn't be built again")
+
+	for i := 0; i < maxInternedKeys+10; i++ {
+		assert.Equal(t, fmt.Sprintf("app.id%d", i), p.Key(fmt.Sprintf("id%d", i)))
+	}
+	assert.Len(t, p.keys.Load().(map[string]string), maxInternedKeys,
+		"keys past the limit shouldn't be interned")
+}
+
+// BenchmarkContention benchmarks the places spans in one trace contend for
+// its shared state when they're created and sent concurrently, each child
+// holding open siblings: the parent's children, the trace's open spans
+// when it has a MaxTraceDuration, and its trace level fields.
+func BenchmarkContention(b *testing.B) {
+	for _, bm := range []struct {
+		name     string
+		config   *Config
+		addField bool
+	}{
+		{name: "children", config: &Config{}},
+		{name: "open spans", config: &Config{MaxTraceDuration: time.Hour}},
+		{name: "trace fields", config: &Config{}, addField: true},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			setupLibhoney()
+			ctx, tr := NewTraceFromPropagationContext(context.Background(), nil, WithConfig(bm.config))
+			tr.AddFields(map[string]interface{}{"user": 1, "team": "bees"})
+			rs := tr.GetRootSpan()
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				var open []*Span
+				n := 0
+				for pb.Next() {
+					_, s := rs.CreateChild(ctx)
+					open = append(open, s)
+					if bm.addField && n%64 == 0 {
+						tr.AddField("last", n)
+					}
+					n++
+					if len(open) == 8 {
+						for _, s := range open {
+							s.Send()
+						}
+						open = open[:0]
+					}
+				}
+				for _, s := range open {
+					s.Send()
+				}
+			})
+		})
+	}
+}
+
 func BenchmarkSendSpan(b *testing.B) {
 	setupLibhoney()
 
@@ -504,3 +1606,56 @@ func setupLibhoney() *transmission.MockSender {
 
 	return mo
 }
+
+// BenchmarkSpanWithFields benchmarks the common case of creating a child
+// span, adding a handful of fields to it, and sending it.
+func BenchmarkSpanWithFields(b *testing.B) {
+	for _, numFields := range []int{5, 20} {
+		keys := make([]string, numFields)
+		for i := range keys {
+			keys[i] = fmt.Sprintf("field%d", i)
+		}
+		b.Run(fmt.Sprintf("%d fields", numFields), func(b *testing.B) {
+			setupLibhoney()
+			ctx, tr := NewTrace(context.Background(), "")
+			rs := tr.GetRootSpan()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				_, s := rs.CreateChild(ctx)
+				for i, key := range keys {
+					s.AddField(key, i)
+				}
+				s.Send()
+			}
+		})
+	}
+}
+
+// BenchmarkDroppedSpanWithFields is BenchmarkSpanWithFields for a trace that
+// head sampling has dropped.
+func BenchmarkDroppedSpanWithFields(b *testing.B) {
+	setupLibhoney()
+	dropAll, _ := sample.NewDeterministicSampler(1 << 30)
+	var ctx context.Context
+	var tr *Trace
+	for tr == nil || !tr.isDropped() {
+		ctx, tr = NewTraceFromPropagationContext(context.Background(), nil, WithConfig(&Config{Sampler: dropAll}))
+	}
+	rs := tr.GetRootSpan()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		_, s := rs.CreateChild(ctx)
+		for i := 0; i < 5; i++ {
+			s.AddField("field", i)
+		}
+		s.Send()
+	}
+}
+
+// traceFields returns the trace level fields stored in t.
+func traceFields(t *Trace) map[string]interface{} {
+	fields, _ := t.traceLevelFields.Load().(map[string]interface{})
+	return fields
+}
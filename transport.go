@@ -0,0 +1,105 @@
+package beeline
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// These match the settings of http.DefaultTransport.
+const (
+	defaultDialTimeout         = 30 * time.Second
+	defaultTLSHandshakeTimeout = 10 * time.Second
+)
+
+// hasTransportConfig reports whether config has any settings that require a
+// custom HTTP transport.
+func hasTransportConfig(config Config) bool {
+	return config.ProxyURL != "" || config.CACertFile != "" || config.ClientCertFile != "" ||
+		config.ClientKeyFile != "" || config.TLSConfig != nil || config.DialTimeout != 0 ||
+		config.TLSHandshakeTimeout != 0
+}
+
+// newTransport builds the HTTP transport described by the proxy, TLS, and
+// timeout settings in config. Settings that aren't given keep the defaults of
+// http.DefaultTransport, including reading proxies from the environment.
+func newTransport(config Config) (*http.Transport, error) {
+	dialer := &net.Dialer{
+		Timeout:   defaultDialTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+	if config.DialTimeout != 0 {
+		dialer.Timeout = config.DialTimeout
+	}
+	tr := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   defaultTLSHandshakeTimeout,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+	if config.TLSHandshakeTimeout != 0 {
+		tr.TLSHandshakeTimeout = config.TLSHandshakeTimeout
+	}
+
+	if config.ProxyURL != "" {
+		proxy, err := url.Parse(config.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ProxyURL: %v", err)
+		}
+		switch proxy.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return nil, fmt.Errorf("invalid ProxyURL %q: scheme must be http, https, or socks5", config.ProxyURL)
+		}
+		tr.Proxy = http.ProxyURL(proxy)
+	}
+
+	tlsConfig, err := newTLSConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	tr.TLSClientConfig = tlsConfig
+	return tr, nil
+}
+
+// newTLSConfig builds the TLS settings described by config, or returns nil if
+// there are none.
+func newTLSConfig(config Config) (*tls.Config, error) {
+	if config.TLSConfig == nil && config.CACertFile == "" && config.ClientCertFile == "" && config.ClientKeyFile == "" {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{}
+	if config.TLSConfig != nil {
+		tlsConfig = config.TLSConfig.Clone()
+	}
+	if config.CACertFile != "" {
+		pem, err := ioutil.ReadFile(config.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading CACertFile: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM certificates found in CACertFile %s", config.CACertFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if config.ClientCertFile != "" || config.ClientKeyFile != "" {
+		if config.ClientCertFile == "" || config.ClientKeyFile == "" {
+			return nil, errors.New("ClientCertFile and ClientKeyFile must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(config.ClientCertFile, config.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %v", err)
+		}
+		tlsConfig.Certificates = append(tlsConfig.Certificates, cert)
+	}
+	return tlsConfig, nil
+}
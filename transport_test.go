@@ -0,0 +1,79 @@
+package beeline
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewTransportProxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+	}))
+	defer proxy.Close()
+
+	tr, err := newTransport(Config{ProxyURL: proxy.URL, DialTimeout: time.Second})
+	assert.NoError(t, err)
+	resp, err := (&http.Client{Transport: tr}).Get("http://api.honeycomb.invalid/1/batch/dataset")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "http://api.honeycomb.invalid/1/batch/dataset", proxied, "requests should go through the proxy")
+
+	_, err = newTransport(Config{ProxyURL: "ftp://proxy.internal"})
+	assert.Error(t, err, "unsupported proxy schemes should be rejected")
+}
+
+func TestNewTransportCACert(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	caFile := writeConfigFile(t, dir, "ca.pem", string(pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: server.Certificate().Raw,
+	})))
+
+	tr, err := newTransport(Config{CACertFile: caFile})
+	assert.NoError(t, err)
+	resp, err := (&http.Client{Transport: tr}).Get(server.URL)
+	assert.NoError(t, err, "the custom CA should be trusted")
+	if resp != nil {
+		resp.Body.Close()
+	}
+
+	tr, err = newTransport(Config{DialTimeout: time.Second})
+	assert.NoError(t, err)
+	_, err = (&http.Client{Transport: tr}).Get(server.URL)
+	assert.Error(t, err, "without the custom CA the server should not be trusted")
+
+	notPEM := writeConfigFile(t, dir, "not.pem", "hello")
+	for _, config := range []Config{
+		{CACertFile: notPEM},
+		{CACertFile: dir + "/missing.pem"},
+		{ClientKeyFile: notPEM},
+		{ClientCertFile: notPEM, ClientKeyFile: notPEM},
+	} {
+		_, err = newTransport(config)
+		assert.Error(t, err, "invalid TLS settings should be rejected: %+v", config)
+	}
+}
+
+func TestNewWithInvalidTransportConfig(t *testing.T) {
+	bl := New(Config{WriteKey: "0123456789abcdef0123456789abcdef", CACertFile: "/does/not/exist.pem"})
+	defer bl.Close()
+	var found bool
+	for _, w := range bl.Info().Warnings {
+		if strings.HasPrefix(w, "dropping all events") {
+			found = true
+		}
+	}
+	assert.True(t, found, "an unusable transport config should be reported")
+}
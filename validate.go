@@ -0,0 +1,258 @@
+package beeline
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	libhoney "github.com/honeycombio/libhoney-go"
+)
+
+// validateBatching checks the batching and timeout settings in config after
+// defaults have been applied, correcting values that can't work. Zero counts
+// have already been replaced by their defaults, so only negative durations
+// need correcting. It returns a warning for each correction.
+func validateBatching(config *Config) []string {
+	var warnings []string
+	for _, d := range []struct {
+		name  string
+		field *time.Duration
+		def   time.Duration
+	}{
+		{"BatchTimeout", &config.BatchTimeout, libhoney.DefaultBatchTimeout},
+		{"OverflowBlockTimeout", &config.OverflowBlockTimeout, 0},
+		{"DialTimeout", &config.DialTimeout, 0},
+		{"TLSHandshakeTimeout", &config.TLSHandshakeTimeout, 0},
+	} {
+		if *d.field < 0 {
+			warnings = append(warnings, fmt.Sprintf("%s %v is negative; using the default", d.name, *d.field))
+			*d.field = d.def
+		}
+	}
+	return warnings
+}
+
+// ConfigError lists the problems ValidateConfig found with a Config.
+type ConfigError struct {
+	Problems []string
+}
+
+func (e *ConfigError) Error() string {
+	return "invalid beeline config: " + strings.Join(e.Problems, "; ")
+}
+
+// apiKeyPattern matches the characters Honeycomb API keys are made of.
+var apiKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// ValidateConfig checks config for settings that would keep events from
+// reaching Honeycomb, which Init otherwise accepts silently: a missing or
+// malformed write key, a missing ServiceName with an environment key, a
+// sample rate out of range, an unusable APIHost, or proxy and TLS settings
+// that can't be loaded. If config.VerifyAPIKey is set, it also asks
+// Honeycomb whether the write key is accepted and may send events, failing
+// if the API can't be reached. Settings that don't apply, like the write key
+// when a Client or Transmission is given, aren't checked. It returns a
+// *ConfigError listing every problem found, or nil.
+func ValidateConfig(config Config) error {
+	_, err := validateConfig(config)
+	return err
+}
+
+// validateConfig is ValidateConfig, also returning what Honeycomb said about
+// the write key if it was verified.
+func validateConfig(config Config) (*apiKeyAuth, error) {
+	var problems []string
+	if sendsToHoneycomb(config) {
+		problems = append(problems, validateWriteKey(config)...)
+		if config.APIHost != "" {
+			u, err := url.Parse(config.APIHost)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				problems = append(problems, fmt.Sprintf("APIHost %q must be an http or https URL, eg https://api.honeycomb.io/", config.APIHost))
+			}
+		}
+		if hasTransportConfig(config) {
+			if _, err := newTransport(config); err != nil {
+				problems = append(problems, err.Error())
+			}
+		}
+	}
+	if config.Client == nil && strings.TrimSpace(config.Dataset) != config.Dataset {
+		problems = append(problems, fmt.Sprintf("Dataset %q has leading or trailing whitespace", config.Dataset))
+	}
+	if config.SampleRate > math.MaxUint32 {
+		problems = append(problems, fmt.Sprintf("SampleRate %d is larger than the largest sample rate, %d", config.SampleRate, uint64(math.MaxUint32)))
+	}
+	if config.SampleRate > 1 && config.SamplerHook != nil {
+		problems = append(problems, "SampleRate is ignored when a SamplerHook is set; sample in the hook instead")
+	}
+	copied := config
+	for _, w := range validateBatching(&copied) {
+		problems = append(problems, strings.Replace(w, "; using the default", "", 1))
+	}
+	var auth *apiKeyAuth
+	if len(problems) == 0 && sendsToHoneycomb(config) && config.VerifyAPIKey {
+		var err error
+		if auth, err = verifyAPIKey(config); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if len(problems) > 0 {
+		return nil, &ConfigError{Problems: problems}
+	}
+	return auth, nil
+}
+
+// sendsToHoneycomb reports whether a beeline created with config sends events
+// to the Honeycomb API with its write key.
+func sendsToHoneycomb(config Config) bool {
+	return config.Client == nil && config.Transmission == nil &&
+		!config.STDOUT && !config.Mute && !config.DevMode
+}
+
+// validateWriteKey checks the write key in config looks like a Honeycomb API
+// key: 32 hex characters for classic keys, 22 letters and digits for
+// environment keys, or 64 characters for ingest keys.
+func validateWriteKey(config Config) []string {
+	key := config.WriteKey
+	if key == "" || key == defaultWriteKey {
+		return []string{"no WriteKey is set; find your API key in Honeycomb's environment or team settings"}
+	}
+	if strings.TrimSpace(key) != key {
+		return []string{"WriteKey has leading or trailing whitespace"}
+	}
+	var problems []string
+	isIngestKey := strings.HasPrefix(key, "hcxik_") || strings.HasPrefix(key, "hcaik_")
+	switch {
+	case !apiKeyPattern.MatchString(key):
+		problems = append(problems, "WriteKey contains characters that can't be in a Honeycomb API key")
+	case isIngestKey && len(key) != 64:
+		problems = append(problems, fmt.Sprintf("WriteKey looks like an ingest key but is %d characters long instead of 64", len(key)))
+	case !isIngestKey && len(key) != 22 && len(key) != 32:
+		problems = append(problems, fmt.Sprintf("WriteKey is %d characters long; Honeycomb API keys are 22 or 32 characters, or 64 for ingest keys", len(key)))
+	case len(key) == 32 && strings.Trim(key, "0123456789abcdef") != "":
+		problems = append(problems, "WriteKey is 32 characters long like a classic key, but classic keys are lowercase hex")
+	}
+	if GetKeyType(key) == KeyTypeEnvironment && strings.TrimSpace(config.ServiceName) == "" {
+		problems = append(problems, "no ServiceName is set; environment keys send events to a dataset named after the service")
+	}
+	return problems
+}
+
+// authTimeout bounds the calls made to Honeycomb's auth endpoint.
+const authTimeout = 10 * time.Second
+
+// apiKeyAuth is what Honeycomb's auth endpoint reports about an API key.
+type apiKeyAuth struct {
+	Access struct {
+		Events bool `json:"events"`
+	} `json:"api_key_access"`
+	Team struct {
+		Slug string `json:"slug"`
+	} `json:"team"`
+	Environment struct {
+		Slug string `json:"slug"`
+	} `json:"environment"`
+}
+
+// verifyAPIKey asks Honeycomb's auth endpoint about the write key in config,
+// using the proxy and TLS settings events are sent with. It fails if the key
+// is rejected or may not send events.
+func verifyAPIKey(config Config) (*apiKeyAuth, error) {
+	host := config.APIHost
+	if host == "" {
+		host = "https://api.honeycomb.io/"
+	}
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid APIHost: %v", err)
+	}
+	u.Path = path.Join(u.Path, "1", "auth")
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Honeycomb-Team", config.WriteKey)
+	req.Header.Set("User-Agent", fmt.Sprintf("beeline/%s", version))
+	client := &http.Client{Timeout: authTimeout}
+	if hasTransportConfig(config) {
+		transport, err := newTransport(config)
+		if err != nil {
+			return nil, err
+		}
+		client.Transport = transport
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't reach Honeycomb at %s to verify the WriteKey: %v", host, err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		return nil, errors.New("Honeycomb rejected the WriteKey; check it hasn't been deleted or mistyped")
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("verifying the WriteKey got an unexpected response from Honeycomb: %s", resp.Status)
+	}
+	auth := &apiKeyAuth{}
+	if err := json.NewDecoder(resp.Body).Decode(auth); err != nil {
+		return nil, fmt.Errorf("couldn't read Honeycomb's response verifying the WriteKey: %v", err)
+	}
+	if !auth.Access.Events {
+		return auth, fmt.Errorf("the WriteKey for team %q can't send events; give it the Send Events permission in Honeycomb", auth.Team.Slug)
+	}
+	return auth, nil
+}
+
+// preflight verifies the write key in config in the background, recording
+// the team and environment it belongs to in b's Info, or logging why events
+// sent with it will be rejected.
+func (b *Beeline) preflight(config Config) {
+	auth, err := verifyAPIKey(config)
+	if err != nil {
+		b.logger.Error("Honeycomb API key check failed", "error", err)
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	infos := []*ResolvedConfig{&b.initInfo}
+	// Reconfigure may have changed the key while it was being checked
+	if b.currentWriteKeyLocked() == config.WriteKey {
+		infos = append(infos, &b.info)
+	}
+	for _, info := range infos {
+		if err != nil {
+			info.Warnings = append(info.Warnings, err.Error())
+		}
+		setAuth(info, auth)
+	}
+}
+
+// currentWriteKeyLocked returns the write key b sends events with. The caller
+// holds b.lock.
+func (b *Beeline) currentWriteKeyLocked() string {
+	if b.writeKey != "" {
+		return b.writeKey
+	}
+	return b.initConfig.WriteKey
+}
+
+// setAuthLocked records the team and environment auth reports in b's Info.
+// The caller holds b.lock.
+func (b *Beeline) setAuthLocked(auth *apiKeyAuth) {
+	setAuth(&b.info, auth)
+	setAuth(&b.initInfo, auth)
+}
+
+// setAuth records the team and environment auth reports in info.
+func setAuth(info *ResolvedConfig, auth *apiKeyAuth) {
+	if auth == nil {
+		return
+	}
+	info.Team = auth.Team.Slug
+	info.Environment = auth.Environment.Slug
+}
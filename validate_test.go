@@ -0,0 +1,150 @@
+package beeline
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	libhoney "github.com/honeycombio/libhoney-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateBatching(t *testing.T) {
+	config := Config{
+		BatchTimeout:         -time.Second,
+		OverflowBlockTimeout: -time.Second,
+		DialTimeout:          -time.Second,
+	}
+	warnings := validateBatching(&config)
+	assert.Len(t, warnings, 3, "each correction should be reported")
+	assert.Equal(t, libhoney.DefaultBatchTimeout, config.BatchTimeout, "negative timeouts should use the default")
+	assert.Equal(t, time.Duration(0), config.OverflowBlockTimeout)
+	assert.Equal(t, time.Duration(0), config.DialTimeout)
+
+	config = Config{MaxBatchSize: 5000, BatchTimeout: time.Second, PendingWorkCapacity: 1000}
+	assert.Empty(t, validateBatching(&config), "sane settings should be left alone")
+	assert.Equal(t, uint(5000), config.MaxBatchSize, "batches may be larger than the queue")
+}
+
+func TestNewReportsBatchingWarnings(t *testing.T) {
+	bl := New(Config{Mute: true, BatchTimeout: -time.Second, DisableCompression: true})
+	defer bl.Close()
+	assert.Len(t, bl.Info().Warnings, 1, "a negative batch timeout should be reported")
+}
+
+func TestValidateConfig(t *testing.T) {
+	classicKey := "0123456789abcdef0123456789abcdef"
+	envKey := "abcdefghijABCDEFGHIJ01"
+	assert.NoError(t, ValidateConfig(Config{WriteKey: classicKey, Dataset: "ds"}))
+	assert.NoError(t, ValidateConfig(Config{WriteKey: envKey, ServiceName: "svc"}))
+	assert.NoError(t, ValidateConfig(Config{Mute: true}), "muted beelines need no key")
+
+	for _, c := range []struct {
+		name   string
+		config Config
+	}{
+		{"missing key", Config{}},
+		{"placeholder key", Config{WriteKey: defaultWriteKey}},
+		{"whitespace", Config{WriteKey: classicKey + "\n"}},
+		{"bad characters", Config{WriteKey: "0123456789abcdef0123456789abcde!"}},
+		{"wrong length", Config{WriteKey: "abc123"}},
+		{"uppercase classic key", Config{WriteKey: "0123456789ABCDEF0123456789ABCDEF"}},
+		{"short ingest key", Config{WriteKey: "hcaik_0123", ServiceName: "svc"}},
+		{"environment key without service", Config{WriteKey: envKey}},
+		{"bad API host", Config{WriteKey: classicKey, APIHost: "api.honeycomb.io"}},
+		{"bad proxy", Config{WriteKey: classicKey, ProxyURL: "ftp://proxy"}},
+		{"dataset whitespace", Config{WriteKey: classicKey, Dataset: " ds"}},
+		{"negative timeout", Config{WriteKey: classicKey, BatchTimeout: -time.Second}},
+		{"ignored sample rate", Config{WriteKey: classicKey, SampleRate: 10, SamplerHook: func(map[string]interface{}) (bool, int) { return true, 1 }}},
+	} {
+		err := ValidateConfig(c.config)
+		if assert.Error(t, err, c.name) {
+			assert.Len(t, err.(*ConfigError).Problems, 1, c.name)
+		}
+	}
+
+	err := ValidateConfig(Config{WriteKey: "abc", Dataset: " ds", BatchTimeout: -time.Second})
+	assert.Len(t, err.(*ConfigError).Problems, 3, "every problem should be listed")
+}
+
+func TestValidateConfigVerifyAPIKey(t *testing.T) {
+	classicKey := "0123456789abcdef0123456789abcdef"
+	var gotKey string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/1/auth", r.URL.Path)
+		gotKey = r.Header.Get("X-Honeycomb-Team")
+		if gotKey != classicKey {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"api_key_access": {"events": true}, "team": {"slug": "bees"}, "environment": {"slug": "prod"}}`))
+	}))
+	defer server.Close()
+
+	assert.NoError(t, ValidateConfig(Config{WriteKey: classicKey, APIHost: server.URL, VerifyAPIKey: true}))
+	assert.Equal(t, classicKey, gotKey)
+	err := ValidateConfig(Config{WriteKey: "fedcba9876543210fedcba9876543210", APIHost: server.URL, VerifyAPIKey: true})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "rejected")
+
+	assert.Error(t, InitWithError(Config{}), "InitWithError should fail fast")
+	assert.NoError(t, InitWithError(Config{WriteKey: classicKey, APIHost: server.URL, VerifyAPIKey: true}))
+	assert.Equal(t, "bees", Info().Team)
+	assert.Equal(t, "prod", Info().Environment)
+	Close()
+	server.Close()
+	err = ValidateConfig(Config{WriteKey: classicKey, APIHost: server.URL, VerifyAPIKey: true})
+	assert.Contains(t, err.Error(), "couldn't reach")
+}
+
+func TestPreflight(t *testing.T) {
+	classicKey := "0123456789abcdef0123456789abcdef"
+	events := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/1/auth" {
+			return
+		}
+		fmt.Fprintf(w, `{"api_key_access": {"events": %v}, "team": {"slug": "bees"}, "environment": {"slug": "prod"}}`, events)
+	}))
+	defer server.Close()
+
+	bl := New(Config{WriteKey: classicKey, APIHost: server.URL, VerifyAPIKey: true})
+	defer bl.Close()
+	assert.Eventually(t, func() bool { return bl.Info().Team == "bees" }, time.Second, time.Millisecond)
+	assert.Equal(t, "prod", bl.Info().Environment)
+	assert.Empty(t, bl.Info().Warnings)
+
+	events = false
+	bl = New(Config{WriteKey: classicKey, APIHost: server.URL, VerifyAPIKey: true})
+	defer bl.Close()
+	assert.Eventually(t, func() bool { return len(bl.Info().Warnings) > 0 }, time.Second, time.Millisecond)
+	assert.Contains(t, bl.Info().Warnings[0], "can't send events")
+	assert.Equal(t, "bees", bl.Info().Team, "the team is known even if the key can't send")
+
+	// a check that finishes after the key was changed doesn't describe it
+	checked := make(chan struct{})
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/1/auth" {
+			return
+		}
+		close(checked)
+		<-release
+		fmt.Fprint(w, `{"api_key_access": {"events": false}, "team": {"slug": "bees"}, "environment": {"slug": "prod"}}`)
+	}))
+	defer slow.Close()
+	bl = New(Config{WriteKey: classicKey, APIHost: slow.URL, VerifyAPIKey: true})
+	defer bl.Close()
+	<-checked
+	bl.Reconfigure(Config{WriteKey: "fedcba9876543210fedcba9876543210"})
+	close(release)
+	assert.Eventually(t, func() bool {
+		bl.lock.Lock()
+		defer bl.lock.Unlock()
+		return bl.initInfo.Team == "bees"
+	}, time.Second, time.Millisecond)
+	assert.Empty(t, bl.Info().Team, "a stale check should not set the team for the new key")
+	assert.Empty(t, bl.Info().Warnings, "a stale check should not warn about the new key")
+}
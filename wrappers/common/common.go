@@ -3,9 +3,15 @@ package common
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"runtime"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/felixge/httpsnoop"
 	"github.com/honeycombio/beeline-go/propagation"
@@ -21,10 +27,18 @@ type ResponseWriter struct {
 	// way would obscure optional http.ResponseWriter interfaces.
 	Wrapped http.ResponseWriter
 	Status  int
+	// BeforeHeader, if set, is called just before the response header is
+	// written, so it can still add to the header.
+	BeforeHeader func()
 }
 
 func NewResponseWriter(w http.ResponseWriter) *ResponseWriter {
 	var rw ResponseWriter
+	before := func() {
+		if rw.BeforeHeader != nil {
+			rw.BeforeHeader()
+		}
+	}
 
 	rw.Wrapped = httpsnoop.Wrap(w, httpsnoop.Hooks{
 		WriteHeader: func(next httpsnoop.WriteHeaderFunc) httpsnoop.WriteHeaderFunc {
@@ -34,10 +48,31 @@ func NewResponseWriter(w http.ResponseWriter) *ResponseWriter {
 				// code written.
 				if rw.Status == 0 {
 					rw.Status = code
+					before()
 				}
 				next(code)
 			}
 		},
+		// writing or flushing the body writes the header first if it
+		// hasn't been already
+		Write: func(next httpsnoop.WriteFunc) httpsnoop.WriteFunc {
+			return func(b []byte) (int, error) {
+				before()
+				return next(b)
+			}
+		},
+		ReadFrom: func(next httpsnoop.ReadFromFunc) httpsnoop.ReadFromFunc {
+			return func(src io.Reader) (int64, error) {
+				before()
+				return next(src)
+			}
+		},
+		Flush: func(next httpsnoop.FlushFunc) httpsnoop.FlushFunc {
+			return func() {
+				before()
+				next()
+			}
+		},
 	})
 
 	return &rw
@@ -55,20 +90,39 @@ func StartSpanOrTraceFromHTTP(r *http.Request) (context.Context, *trace.Span) {
 // accepts a TraceParserHook which will be invoked when creating a new trace for the incoming
 // HTTP request.
 func StartSpanOrTraceFromHTTPWithTraceParserHook(r *http.Request, parserHook config.HTTPTraceParserHook) (context.Context, *trace.Span) {
+	return StartSpanOrTraceFromHTTPWithConfig(r, config.HTTPIncomingConfig{HTTPParserHook: parserHook})
+}
+
+// StartSpanOrTraceFromHTTPWithConfig is a version of StartSpanOrTraceFromHTTP
+// that uses the TraceParserHook and URLPolicy in cfg, if they are set, and adds
+// a request.route field if cfg.TemplateRoutes is set. New traces for requests
+// matching cfg.Drop are dropped; use SkipRequest to check cfg.Skip first.
+func StartSpanOrTraceFromHTTPWithConfig(r *http.Request, cfg config.HTTPIncomingConfig) (context.Context, *trace.Span) {
+	parserHook := cfg.HTTPParserHook
 	ctx := r.Context()
 	span := trace.GetSpanFromContext(ctx)
 	if span == nil {
 		// there is no trace yet. We should make one! and use the root span.
 		var tr *trace.Trace
+		opts := []trace.Option{trace.WithSource(&propagation.Source{
+			RemoteAddr: r.RemoteAddr,
+			Header:     r.Header.Get,
+		})}
+		if cfg.Drop != nil && cfg.Drop(r) {
+			opts = append(opts, trace.WithDrop())
+		}
 		if parserHook == nil {
-			beelineHeader := r.Header.Get(propagation.TracePropagationHTTPHeader)
-			ctx, tr = trace.NewTrace(ctx, beelineHeader)
+			var prop *propagation.PropagationContext
+			if beelineHeader := r.Header.Get(propagation.TracePropagationHTTPHeader); beelineHeader != "" {
+				prop, _ = propagation.UnmarshalHoneycombTraceContext(beelineHeader)
+			}
+			ctx, tr = trace.NewTraceFromPropagationContext(ctx, prop, opts...)
 		} else {
 			// Call the provided TraceParserHook to get the propagation context
 			// from the incoming request. This information will then be used when
 			// create the new trace.
 			prop := parserHook(r)
-			ctx, tr = trace.NewTraceFromPropagationContext(ctx, prop)
+			ctx, tr = trace.NewTraceFromPropagationContext(ctx, prop, opts...)
 		}
 		span = tr.GetRootSpan()
 	} else {
@@ -76,42 +130,220 @@ func StartSpanOrTraceFromHTTPWithTraceParserHook(r *http.Request, parserHook con
 		ctx, span = span.CreateChild(ctx)
 	}
 	// go get any common HTTP headers and attributes to add to the span
-	for k, v := range GetRequestProps(r) {
+	policy := config.DefaultURLPolicy()
+	if cfg.URLPolicy != nil {
+		policy = *cfg.URLPolicy
+	}
+	for k, v := range GetRequestPropsWithPolicy(r, policy) {
 		span.AddField(k, v)
 	}
+	if cfg.TemplateRoutes {
+		span.AddField(FieldRequestRoute, config.TemplateRoute(r.URL.Path))
+	}
+	span.AddField(FieldRequestProtocol, Protocol(r))
+	addClientFields(span, r, cfg)
 	return ctx, span
 }
 
+// Protocol returns the protocol an incoming request was made with, named as
+// in ALPN: "h2" for HTTP/2 over TLS, "h2c" for HTTP/2 without it, as served
+// by golang.org/x/net/http2/h2c, and "http/1.1" or "http/1.0" otherwise.
+func Protocol(r *http.Request) string {
+	if r.ProtoMajor == 2 {
+		if r.TLS == nil {
+			return "h2c"
+		}
+		return "h2"
+	}
+	return strings.ToLower(r.Proto)
+}
+
+// AddClientCancelled adds a request.client_cancelled field to span if r's
+// client gave up on it before it was handled, by resetting its HTTP/2 stream
+// or closing its connection. It must be called before the handler returns,
+// since the server cancels the request's context once it has.
+func AddClientCancelled(span *trace.Span, r *http.Request) {
+	if r.Context().Err() == context.Canceled {
+		span.AddField(FieldRequestClientCancelled, true)
+	}
+}
+
+// addClientFields adds the fields describing r's client that cfg asks for.
+func addClientFields(span *trace.Span, r *http.Request, cfg config.HTTPIncomingConfig) {
+	if cfg.ClientIP {
+		span.AddField(FieldRequestClientIP, config.ClientIP(r, cfg.TrustedProxies))
+	}
+	if cfg.UserAgent {
+		if family, version := config.ParseUserAgent(r.UserAgent()); family != "" {
+			span.AddField(FieldRequestUserAgentFamily, family)
+			if version != "" {
+				span.AddField(FieldRequestUserAgentVersion, version)
+			}
+		}
+	}
+	if cfg.TLS && r.TLS != nil {
+		span.AddField(FieldRequestTLSVersion, config.TLSVersionName(r.TLS.Version))
+		span.AddField(FieldRequestTLSCipherSuite, config.TLSCipherSuiteName(r.TLS.CipherSuite))
+		if r.TLS.ServerName != "" {
+			span.AddField(FieldRequestTLSServerName, r.TLS.ServerName)
+		}
+		if len(r.TLS.PeerCertificates) > 0 {
+			span.AddField(FieldRequestTLSClientSubject, r.TLS.PeerCertificates[0].Subject.String())
+		}
+	}
+}
+
+// AddResponseStatus adds a response.status_code field holding status to span,
+// and marks span as an error if cfg.ErrorPolicy treats status as one.
+func AddResponseStatus(span *trace.Span, status int, cfg config.HTTPIncomingConfig) {
+	span.AddField(FieldResponseStatusCode, status)
+	if cfg.ErrorPolicy != nil && cfg.ErrorPolicy.IsError(status) {
+		span.AddField(FieldError, true)
+	}
+}
+
+// SkipRequest reports whether wrappers using cfg should pass r straight to
+// the wrapped handler without tracing it: cfg.Skip matches r, or cfg.Drop
+// matches r but r already belongs to a trace, which can't be dropped part
+// way through.
+func SkipRequest(r *http.Request, cfg config.HTTPIncomingConfig) bool {
+	if cfg.Skip != nil && cfg.Skip(r) {
+		return true
+	}
+	return cfg.Drop != nil && trace.GetSpanFromContext(r.Context()) != nil && cfg.Drop(r)
+}
+
+// NameSpan renames span using cfg.NameFunc, if it is set and returns a name
+// for r.
+func NameSpan(span *trace.Span, r *http.Request, cfg config.HTTPIncomingConfig) {
+	if cfg.NameFunc == nil {
+		return
+	}
+	if name := cfg.NameFunc(r); name != "" {
+		span.AddField(FieldName, name)
+	}
+}
+
+// EnrichSpan adds the fields returned by each of cfg.Enrichers for r to span.
+func EnrichSpan(span *trace.Span, r *http.Request, cfg config.HTTPIncomingConfig) {
+	for _, enrich := range cfg.Enrichers {
+		for k, v := range enrich(r) {
+			span.AddField(k, v)
+		}
+	}
+}
+
+// AddResponseHeaders adds the headers returned by cfg.ResponseHeaderHook, if
+// it is set, to header, the header of the response to r. It must be called
+// before the response header is written.
+func AddResponseHeaders(header http.Header, r *http.Request, span *trace.Span, cfg config.HTTPIncomingConfig) {
+	if cfg.ResponseHeaderHook == nil {
+		return
+	}
+	for k, v := range cfg.ResponseHeaderHook(r, span.PropagationContext()) {
+		header.Add(k, v)
+	}
+}
+
+// ServerTiming returns a function that adds a Server-Timing header, as
+// described by cfg.ServerTiming, to header, the header of the response to the
+// request span is for. The function does nothing after its first call. Call
+// it just before the response header is written, eg as a ResponseWriter's
+// BeforeHeader, and again once the request has been handled, for responses
+// that wrote nothing. If cfg.ServerTiming isn't set, the function does
+// nothing.
+func ServerTiming(header http.Header, span *trace.Span, cfg config.HTTPIncomingConfig) func() {
+	if !cfg.ServerTiming {
+		return func() {}
+	}
+	tr := span.GetTrace()
+	if len(cfg.ServerTimingSpans) > 0 {
+		tr.RecordTimings(cfg.ServerTimingSpans...)
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			header.Add("Server-Timing", serverTimingValue(span.Elapsed(), tr.Timings(), cfg.ServerTimingSpans))
+		})
+	}
+}
+
+// serverTimingValue formats a Server-Timing header with a total duration and
+// the timings of the spans named in names, in that order.
+func serverTimingValue(total time.Duration, timings map[string]float64, names []string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "total;dur=%s", formatMilliseconds(float64(total)/float64(time.Millisecond)))
+	for _, name := range names {
+		dur, ok := timings[name]
+		if !ok {
+			continue
+		}
+		token := serverTimingToken(name)
+		fmt.Fprintf(&b, ", %s;dur=%s", token, formatMilliseconds(dur))
+		if token != name {
+			fmt.Fprintf(&b, ";desc=%s", strconv.Quote(name))
+		}
+	}
+	return b.String()
+}
+
+func formatMilliseconds(ms float64) string {
+	return strconv.FormatFloat(ms, 'f', 1, 64)
+}
+
+// serverTimingToken replaces the characters in name that can't be used in a
+// Server-Timing metric name with underscores.
+func serverTimingToken(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+			return r
+		case strings.ContainsRune("!#$%&'*+-.^_`|~", r):
+			return r
+		}
+		return '_'
+	}, name)
+}
+
 // GetRequestProps is a convenient method to grab all common http request
-// properties and get them back as a map.
+// properties and get them back as a map. The URL is recorded according to
+// config.DefaultURLPolicy().
 func GetRequestProps(req *http.Request) map[string]interface{} {
+	return GetRequestPropsWithPolicy(req, config.DefaultURLPolicy())
+}
+
+// GetRequestPropsWithPolicy is a version of GetRequestProps that records the
+// URL according to policy.
+func GetRequestPropsWithPolicy(req *http.Request, policy config.URLPolicy) map[string]interface{} {
 	userAgent := req.UserAgent()
 	xForwardedFor := req.Header.Get("x-forwarded-for")
 	xForwardedProto := req.Header.Get("x-forwarded-proto")
 
-	reqProps := make(map[string]interface{})
+	// size the map for every field, so it isn't grown as they're added
+	reqProps := make(map[string]interface{}, 12)
 	// identify the type of event
-	reqProps["meta.type"] = "http_request"
+	reqProps[FieldMetaType] = "http_request"
 	// Add a variety of details about the HTTP request, such as user agent
 	// and method, to any created libhoney event.
-	reqProps["request.method"] = req.Method
-	reqProps["request.path"] = req.URL.Path
-	if req.URL.RawQuery != "" {
-		reqProps["request.query"] = req.URL.RawQuery
-	}
-	reqProps["request.url"] = req.URL.String()
-	reqProps["request.host"] = req.Host
-	reqProps["request.http_version"] = req.Proto
-	reqProps["request.content_length"] = req.ContentLength
-	reqProps["request.remote_addr"] = req.RemoteAddr
+	reqProps[FieldRequestMethod] = req.Method
+	path, query, fullURL := policy.Apply(req.URL)
+	reqProps[FieldRequestPath] = path
+	if query != "" {
+		reqProps[FieldRequestQuery] = query
+	}
+	reqProps[FieldRequestURL] = fullURL
+	reqProps[FieldRequestHost] = req.Host
+	reqProps[FieldRequestHTTPVersion] = req.Proto
+	reqProps[FieldRequestContentLength] = req.ContentLength
+	reqProps[FieldRequestRemoteAddr] = req.RemoteAddr
 	if userAgent != "" {
-		reqProps["request.header.user_agent"] = userAgent
+		reqProps[FieldRequestUserAgent] = userAgent
 	}
 	if xForwardedFor != "" {
-		reqProps["request.header.x_forwarded_for"] = xForwardedFor
+		reqProps[FieldRequestXForwardedFor] = xForwardedFor
 	}
 	if xForwardedProto != "" {
-		reqProps["request.header.x_forwarded_proto"] = xForwardedProto
+		reqProps[FieldRequestXForwardedProto] = xForwardedProto
 	}
 	return reqProps
 }
@@ -164,10 +396,33 @@ func sharedDBEvent(bld *libhoney.Builder, query string, args ...interface{}) *li
 	}
 	if args != nil {
 		ev.AddField("db.query_args", args)
+		ev.AddField("db.args_count", len(args))
 	}
 	return ev
 }
 
+// cancelReason returns why a DB call that failed with err was cut short by
+// its context, "canceled" or "deadline_exceeded", or "" if it failed for
+// some other reason or didn't fail. Drivers don't always return the
+// context's error, so a call whose context is done is taken to have been
+// cancelled whatever error it returned.
+func cancelReason(ctx context.Context, err error) string {
+	if err == nil {
+		return ""
+	}
+	cause := ctx.Err()
+	if cause == nil {
+		cause = err
+	}
+	switch {
+	case errors.Is(cause, context.DeadlineExceeded):
+		return "deadline_exceeded"
+	case errors.Is(cause, context.Canceled):
+		return "canceled"
+	}
+	return ""
+}
+
 // BuildDBEvent tries to bring together most of the things that need to happen
 // for an event to wrap a DB call in both the sql and sqlx packages. It returns a
 // function which, when called, dispatches the event that it created. This lets
@@ -177,7 +432,7 @@ func sharedDBEvent(bld *libhoney.Builder, query string, args ...interface{}) *li
 // trace.
 func BuildDBEvent(bld *libhoney.Builder, stats sql.DBStats, query string, args ...interface{}) (*libhoney.Event, func(error)) {
 	timer := timer.Start()
-	ev := sharedDBEvent(bld, query, args)
+	ev := sharedDBEvent(bld, query, args...)
 	addDBStatsToEvent(ev, stats)
 	fn := func(err error) {
 		duration := timer.Finish()
@@ -187,6 +442,7 @@ func BuildDBEvent(bld *libhoney.Builder, stats sql.DBStats, query string, args .
 			ev.AddField("db.error", err.Error())
 		}
 		ev.Metadata, _ = ev.Fields()["name"]
+		trace.ScrubFields(ev.Fields())
 		ev.Send()
 	}
 	return ev, fn
@@ -216,9 +472,16 @@ func BuildDBSpan(ctx context.Context, bld *libhoney.Builder, stats sql.DBStats,
 	for k, v := range ev.Fields() {
 		span.AddField(k, v)
 	}
+	if deadline, ok := ctx.Deadline(); ok {
+		span.AddField("db.deadline_remaining_ms", float64(time.Until(deadline))/float64(time.Millisecond))
+	}
 	fn := func(err error) {
 		duration := timer.Finish()
-		if err != nil {
+		if reason := cancelReason(ctx, err); reason != "" {
+			// not a database error; the caller gave up
+			span.AddField("db.cancelled", true)
+			span.AddField("db.cancel_reason", reason)
+		} else if err != nil {
 			span.AddField("db.error", err.Error())
 		}
 		span.AddRollupField("db.duration_ms", duration)
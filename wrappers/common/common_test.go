@@ -3,11 +3,14 @@ package common
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/honeycombio/beeline-go/wrappers/config"
 	libhoney "github.com/honeycombio/libhoney-go"
 	"github.com/stretchr/testify/assert"
 )
@@ -56,6 +59,27 @@ func TestXForwardedProtoHeader(t *testing.T) {
 	assert.Equal(t, xForwardedProto, props["request.header.x_forwarded_proto"])
 }
 
+func TestURLPolicy(t *testing.T) {
+	req := httptest.NewRequest("GET", "https://unused.com/users/42?token=secret&page=2", nil)
+	props := GetRequestProps(req)
+	assert.Equal(t, "token=secret&page=2", props["request.query"], "the default policy should record URLs unchanged")
+
+	defer config.SetDefaultURLPolicy(config.URLPolicy{})
+	config.SetDefaultURLPolicy(config.URLPolicy{
+		AllowedQueryParams: []string{"page"},
+		PathTemplates:      []config.PathTemplate{config.NumericIDs},
+	})
+	props = GetRequestProps(req)
+	assert.Equal(t, "/users/:id", props["request.path"])
+	assert.Equal(t, "page=2", props["request.query"])
+	assert.Equal(t, "https://unused.com/users/:id?page=2", props["request.url"])
+
+	props = GetRequestPropsWithPolicy(req, config.URLPolicy{StripQuery: true})
+	assert.Equal(t, "/users/42", props["request.path"], "an explicit policy should replace the default")
+	assert.Nil(t, props["request.query"])
+	assert.Equal(t, "https://unused.com/users/42", props["request.url"])
+}
+
 // TestSharedDBEvent verifies that the name field is set to something
 func TestSharedDBEvent(t *testing.T) {
 	bld := libhoney.NewBuilder()
@@ -74,6 +98,26 @@ func TestResponseWriter(t *testing.T) {
 	assert.Equal(t, 222, wr.Status)
 }
 
+func TestResponseWriterBeforeHeader(t *testing.T) {
+	rr := httptest.NewRecorder()
+	wr := NewResponseWriter(rr)
+	calls := 0
+	wr.BeforeHeader = func() {
+		calls++
+		wr.Wrapped.Header().Set("X-Before", "yes")
+	}
+	wr.Wrapped.Write([]byte("hello"))
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, "yes", rr.Header().Get("X-Before"), "headers should be added before the body is written")
+}
+
+func TestServerTimingValue(t *testing.T) {
+	value := serverTimingValue(12340*time.Microsecond,
+		map[string]float64{"db": 4.25, "GET /users": 1},
+		[]string{"db", "cache", "GET /users"})
+	assert.Equal(t, `total;dur=12.3, db;dur=4.2, GET__users;dur=1.0;desc="GET /users"`, value)
+}
+
 func TestResponseWriterTypeAssertions(t *testing.T) {
 	// testResponseWriter implements common http.ResponseWriter optional interfaces
 	type testResponseWriter struct {
@@ -120,3 +164,16 @@ func TestBuildDBSpan(t *testing.T) {
 	ctx, _, sender := BuildDBSpan(ctx, b, sql.DBStats{}, "")
 	sender(nil)
 }
+
+func TestCancelReason(t *testing.T) {
+	ctx := context.Background()
+	assert.Equal(t, "", cancelReason(ctx, nil))
+	assert.Equal(t, "", cancelReason(ctx, errors.New("syntax error")))
+	assert.Equal(t, "deadline_exceeded", cancelReason(ctx, context.DeadlineExceeded))
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.Equal(t, "canceled", cancelReason(cancelled, errors.New("driver: bad connection")),
+		"drivers don't always return the context's error")
+	assert.Equal(t, "", cancelReason(cancelled, nil))
+}
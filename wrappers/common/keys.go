@@ -0,0 +1,42 @@
+package common
+
+import "github.com/honeycombio/beeline-go/trace"
+
+// Names of the fields the HTTP wrappers add to every request's span. Wrappers
+// should use these rather than spelling them out, so the names stay the same
+// across wrappers.
+const (
+	FieldMetaType                = "meta.type"
+	FieldRequestMethod           = "request.method"
+	FieldRequestPath             = "request.path"
+	FieldRequestQuery            = "request.query"
+	FieldRequestURL              = "request.url"
+	FieldRequestHost             = "request.host"
+	FieldRequestHTTPVersion      = "request.http_version"
+	FieldRequestContentLength    = "request.content_length"
+	FieldRequestRemoteAddr       = "request.remote_addr"
+	FieldRequestUserAgent        = "request.header.user_agent"
+	FieldRequestXForwardedFor    = "request.header.x_forwarded_for"
+	FieldRequestXForwardedProto  = "request.header.x_forwarded_proto"
+	FieldRequestRoute            = "request.route"
+	FieldRequestProtocol         = "request.protocol"
+	FieldRequestClientCancelled  = "request.client_cancelled"
+	FieldRequestClientIP         = "request.client_ip"
+	FieldRequestUserAgentFamily  = "request.user_agent.family"
+	FieldRequestUserAgentVersion = "request.user_agent.version"
+	FieldRequestTLSVersion       = "request.tls.version"
+	FieldRequestTLSCipherSuite   = "request.tls.cipher_suite"
+	FieldRequestTLSServerName    = "request.tls.server_name"
+	FieldRequestTLSClientSubject = "request.tls.client_subject"
+	FieldResponseStatusCode      = "response.status_code"
+	FieldError                   = "error"
+	FieldName                    = "name"
+)
+
+// Prefixes of the fields the router wrappers add for a request's path
+// parameters and query, which are named after the parameters. They intern
+// the names, so they aren't built again for every request.
+var (
+	HandlerVars  = trace.NewKeyPrefix("handler.vars.")
+	HandlerQuery = trace.NewKeyPrefix("handler.query.")
+)
@@ -0,0 +1,151 @@
+package config
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ParseTrustedProxies parses a list of networks in CIDR notation, eg
+// "10.0.0.0/8", or single IP addresses, for HTTPIncomingConfig.TrustedProxies.
+func ParseTrustedProxies(proxies ...string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(proxies))
+	for _, p := range proxies {
+		if !strings.Contains(p, "/") {
+			ip := net.ParseIP(p)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", p)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %v", p, err)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// ClientIP returns the IP address of the client that made r. If r came from
+// one of the trusted proxies, the X-Forwarded-For header is believed: the
+// client is the last address in it that isn't a trusted proxy. X-Real-IP is
+// used if a trusted proxy sent no X-Forwarded-For. Headers from untrusted
+// peers are ignored, since anyone can set them.
+func ClientIP(r *http.Request, trusted []*net.IPNet) string {
+	remote := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+	if !isTrusted(net.ParseIP(remote), trusted) {
+		return remote
+	}
+	if xff := r.Header["X-Forwarded-For"]; len(xff) > 0 {
+		hops := strings.Split(strings.Join(xff, ","), ",")
+		client := ""
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			ip := net.ParseIP(hop)
+			if ip == nil {
+				break
+			}
+			client = hop
+			if !isTrusted(ip, trusted) {
+				break
+			}
+		}
+		if client != "" {
+			return client
+		}
+	}
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(realIP) != nil {
+		return realIP
+	}
+	return remote
+}
+
+func isTrusted(ip net.IP, trusted []*net.IPNet) bool {
+	if ip == nil {
+		return false
+	}
+	for _, n := range trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// userAgentFamilies are the products looked for in user agents, in order.
+// Browsers include the tokens of the browsers they descend from, so the
+// more specific ones come first.
+var userAgentFamilies = []struct {
+	token, family string
+}{
+	{"Edg/", "Edge"},
+	{"OPR/", "Opera"},
+	{"SamsungBrowser/", "Samsung Internet"},
+	{"Firefox/", "Firefox"},
+	{"Chrome/", "Chrome"},
+	{"CriOS/", "Chrome"},
+	{"Googlebot/", "Googlebot"},
+	{"bingbot/", "Bingbot"},
+}
+
+// ParseUserAgent returns the family and version of the client with the user
+// agent ua, eg "Chrome" and "85.0.4183.83". Common browsers and crawlers are
+// recognized by their tokens; for anything else, such as "curl/7.64.1" or
+// "Go-http-client/1.1", the first product is used. Empty strings are returned
+// for an empty user agent.
+func ParseUserAgent(ua string) (family, version string) {
+	for _, f := range userAgentFamilies {
+		if i := strings.Index(ua, f.token); i >= 0 {
+			return f.family, productVersion(ua[i+len(f.token):])
+		}
+	}
+	if strings.Contains(ua, "Safari/") {
+		if i := strings.Index(ua, "Version/"); i >= 0 {
+			return "Safari", productVersion(ua[i+len("Version/"):])
+		}
+	}
+	product := ua
+	if i := strings.IndexByte(product, ' '); i >= 0 {
+		product = product[:i]
+	}
+	if i := strings.IndexByte(product, '/'); i >= 0 {
+		return product[:i], product[i+1:]
+	}
+	return product, ""
+}
+
+// productVersion returns the version at the start of s, which follows a
+// product token's slash.
+func productVersion(s string) string {
+	if i := strings.IndexAny(s, " ;)"); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
+
+// TLSVersionName returns a name for a TLS version number from
+// tls.ConnectionState, eg "1.3".
+func TLSVersionName(version uint16) string {
+	switch version {
+	case tls.VersionTLS10:
+		return "1.0"
+	case tls.VersionTLS11:
+		return "1.1"
+	case tls.VersionTLS12:
+		return "1.2"
+	case tls.VersionTLS13:
+		return "1.3"
+	}
+	return fmt.Sprintf("0x%04x", version)
+}
@@ -0,0 +1,62 @@
+package config
+
+import (
+	"crypto/tls"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientIP(t *testing.T) {
+	trusted, err := ParseTrustedProxies("10.0.0.0/8", "192.168.1.1")
+	assert.NoError(t, err)
+	_, err = ParseTrustedProxies("not-an-ip")
+	assert.Error(t, err)
+
+	req := func(remote string, headers ...string) *http.Request {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.RemoteAddr = remote
+		for i := 0; i+1 < len(headers); i += 2 {
+			r.Header.Add(headers[i], headers[i+1])
+		}
+		return r
+	}
+	assert.Equal(t, "203.0.113.9", ClientIP(req("203.0.113.9:1234"), trusted))
+	assert.Equal(t, "203.0.113.9", ClientIP(req("203.0.113.9:1234", "X-Forwarded-For", "1.2.3.4"), trusted),
+		"headers from untrusted peers should be ignored")
+	assert.Equal(t, "1.2.3.4", ClientIP(req("10.1.1.1:80", "X-Forwarded-For", "5.6.7.8, 1.2.3.4, 10.2.2.2"), trusted),
+		"the last untrusted hop is the client, since earlier hops could be forged")
+	assert.Equal(t, "1.2.3.4", ClientIP(req("192.168.1.1:80", "X-Forwarded-For", "1.2.3.4", "X-Forwarded-For", "10.0.0.1"), trusted))
+	assert.Equal(t, "10.3.3.3", ClientIP(req("10.1.1.1:80", "X-Forwarded-For", "10.3.3.3"), trusted),
+		"the first hop is used if every hop is trusted")
+	assert.Equal(t, "1.2.3.4", ClientIP(req("10.1.1.1:80", "X-Real-IP", "1.2.3.4"), trusted))
+	assert.Equal(t, "10.1.1.1", ClientIP(req("10.1.1.1:80", "X-Real-IP", "garbage"), trusted))
+}
+
+func TestParseUserAgent(t *testing.T) {
+	cases := []struct {
+		ua, family, version string
+	}{
+		{"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_6) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/85.0.4183.83 Safari/537.36", "Chrome", "85.0.4183.83"},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/85.0.4183.102 Safari/537.36 Edg/85.0.564.51", "Edge", "85.0.564.51"},
+		{"Mozilla/5.0 (Macintosh; Intel Mac OS X 10.15; rv:80.0) Gecko/20100101 Firefox/80.0", "Firefox", "80.0"},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 14_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/14.0 Mobile/15E148 Safari/604.1", "Safari", "14.0"},
+		{"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", "Googlebot", "2.1"},
+		{"curl/7.64.1", "curl", "7.64.1"},
+		{"Go-http-client/1.1", "Go-http-client", "1.1"},
+		{"custom", "custom", ""},
+		{"", "", ""},
+	}
+	for _, c := range cases {
+		family, version := ParseUserAgent(c.ua)
+		assert.Equal(t, c.family, family, c.ua)
+		assert.Equal(t, c.version, version, c.ua)
+	}
+}
+
+func TestTLSNames(t *testing.T) {
+	assert.Equal(t, "1.3", TLSVersionName(tls.VersionTLS13))
+	assert.Equal(t, "0x0999", TLSVersionName(0x0999))
+	assert.NotEmpty(t, TLSCipherSuiteName(tls.TLS_AES_128_GCM_SHA256))
+}
@@ -1,8 +1,10 @@
 package config
 
 import (
-	"github.com/honeycombio/beeline-go/propagation"
+	"net"
 	"net/http"
+
+	"github.com/honeycombio/beeline-go/propagation"
 )
 
 // HTTPTraceParserHook is a function that will be invoked on all incoming HTTP requests
@@ -26,14 +28,114 @@ type HTTPTraceParserHook func(*http.Request) *propagation.PropagationContext
 // W3C Trace Context, etc).
 type HTTPTracePropagationHook func(*http.Request, *propagation.PropagationContext) map[string]string
 
+// HTTPTraceResponseHook is a function that will be invoked on all incoming
+// HTTP requests just before they are handled, when it is passed as a parameter
+// to an http.Handler wrapper function such as the one provided in the
+// hnynethttp package. It returns a map of header names to header values that
+// will be added to the response, so the trace can be found from the client,
+// eg by an error page that shows the trace ID to give to support. The
+// provided PropagationContext describes the request's span. See
+// TraceIDResponseHeader and ServerTimingTraceparent.
+type HTTPTraceResponseHook func(*http.Request, *propagation.PropagationContext) map[string]string
+
 // HTTPIncomingConfig stores configuration options relevant to HTTP requests that are handled by
 // a wrapper.
 type HTTPIncomingConfig struct {
 	HTTPParserHook HTTPTraceParserHook
+	// URLPolicy, if set, is used instead of DefaultURLPolicy() to decide how
+	// much of each request's URL to record.
+	URLPolicy *URLPolicy
+	// TemplateRoutes adds a request.route field holding the request's path
+	// with segments that look like IDs replaced by placeholders; see
+	// TemplateRoute. Use it with routers that don't expose their patterns.
+	TemplateRoutes bool
+	// Skip, if set, is called for every incoming request. Requests it
+	// matches are handled without being traced at all, so spans started
+	// while handling them begin new traces. Use it for requests that are
+	// too frequent and uninteresting to pay for, like health checks.
+	Skip RequestFilter
+	// Drop, if set, is called for every incoming request that isn't skipped
+	// and doesn't already belong to a trace. Requests it matches start a
+	// trace that is never sent, as though it was dropped by sampling, so
+	// spans started while handling them aren't sent either. Requests that
+	// do belong to a trace, because an outer wrapper already started one,
+	// are skipped instead.
+	Drop RequestFilter
+	// NameFunc, if set, names the span for each incoming request, replacing
+	// the name the wrapper would have chosen from its handler, which is
+	// often unhelpful for anonymous functions. It is called once routing is
+	// done, just before the request is handled. If it returns "", the
+	// wrapper's name is kept. See MethodAndRoute.
+	NameFunc func(*http.Request) string
+	// Enrichers are called, in order, for each incoming request once NameFunc
+	// has been, and the fields they return are added to the request's
+	// span. Fields returned by later enrichers replace those of earlier ones.
+	Enrichers []HTTPFieldEnricher
+	// ClientIP adds a request.client_ip field holding the address of the
+	// client, as determined by ClientIP. X-Forwarded-For and X-Real-IP are
+	// only believed from TrustedProxies; build the list with
+	// ParseTrustedProxies.
+	ClientIP       bool
+	TrustedProxies []*net.IPNet
+	// UserAgent adds request.user_agent.family and
+	// request.user_agent.version fields parsed from the User-Agent header
+	// with ParseUserAgent.
+	UserAgent bool
+	// TLS adds request.tls.version, request.tls.cipher_suite, and
+	// request.tls.server_name fields to requests made over TLS, and
+	// request.tls.client_subject when the client sent a certificate.
+	TLS bool
+	// ErrorPolicy, if set, decides which response statuses are errors. Spans
+	// for requests whose responses it treats as errors get an error field
+	// set to true, so error rates can be queried the same way your SLOs
+	// define them. If it isn't set, no error field is added.
+	ErrorPolicy *ErrorPolicy
+	// ResponseHeaderHook, if set, returns headers to add to the response to
+	// each incoming request, eg to tell the client its trace ID.
+	ResponseHeaderHook HTTPTraceResponseHook
+	// ServerTiming adds a Server-Timing response header holding how long
+	// the request's span had run when the response header was written, as
+	// "total", and the total duration of the spans sent by then named each
+	// of ServerTimingSpans, so browser devtools and RUM tools can show
+	// where the time went. Spans must be sent before the handler writes
+	// its response to be included.
+	ServerTiming      bool
+	ServerTimingSpans []string
+}
+
+// MethodAndRoute is a NameFunc that names spans after the request's method
+// and templated path, eg "GET /users/:id". See TemplateRoute.
+func MethodAndRoute(r *http.Request) string {
+	return r.Method + " " + TemplateRoute(r.URL.Path)
 }
 
 // HTTPOutgoingConfig stores configuration options relevant to HTTP requests being sent by an
 // instrumented application.
 type HTTPOutgoingConfig struct {
 	HTTPPropagationHook HTTPTracePropagationHook
+	// URLPolicy, if set, is used instead of DefaultURLPolicy() to decide how
+	// much of each request's URL to record.
+	URLPolicy *URLPolicy
+	// DetectRetries adds retry.attempt and retry.is_retry fields to the span
+	// for each request, counting the requests for the same method and URL
+	// sent from the same span, until one gets a response that isn't a 429
+	// or 5xx or that span is sent. Retry attempts more than a minute apart
+	// aren't counted, and at most 1024 requests are tracked at once, the
+	// least recently attempted being forgotten first. Retry libraries like hashicorp/go-retryablehttp resend
+	// each attempt with the original request's context, so every attempt
+	// gets its own span, a sibling of the others, that says which attempt
+	// it was. Wrap the transport of the client the retry library uses,
+	// rather than the retry library itself, so the attempts aren't merged
+	// into one span.
+	DetectRetries bool
+	// ResponseBody delays sending the span for each request that gets a
+	// response until its body has been read to the end or closed, so the
+	// span lasts until the last byte was read rather than until the
+	// response header arrived, which for large responses can be a small
+	// part of the time. It adds response.time_to_headers_ms,
+	// response.body_bytes, response.body_read_ms, and
+	// response.body_drained, which is false if the body was closed before
+	// it was read to the end. Bodies must be closed, as net/http requires
+	// anyway, for the spans to be sent.
+	ResponseBody bool
 }
@@ -0,0 +1,117 @@
+package config
+
+import (
+	"net/http"
+	"strings"
+)
+
+// RequestFilter reports whether an incoming request matches some condition.
+// Filters in an HTTPIncomingConfig decide which requests aren't worth tracing,
+// like health checks and CORS preflights.
+type RequestFilter func(*http.Request) bool
+
+// Paths matches requests whose URL path is exactly one of paths.
+func Paths(paths ...string) RequestFilter {
+	set := make(map[string]struct{}, len(paths))
+	for _, p := range paths {
+		set[p] = struct{}{}
+	}
+	return func(r *http.Request) bool {
+		_, ok := set[r.URL.Path]
+		return ok
+	}
+}
+
+// PathPrefixes matches requests whose URL path starts with one of prefixes.
+func PathPrefixes(prefixes ...string) RequestFilter {
+	return func(r *http.Request) bool {
+		for _, p := range prefixes {
+			if strings.HasPrefix(r.URL.Path, p) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Methods matches requests using one of methods, eg "OPTIONS".
+func Methods(methods ...string) RequestFilter {
+	return func(r *http.Request) bool {
+		for _, m := range methods {
+			if strings.EqualFold(r.Method, m) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Header matches requests with the header name. If value isn't empty, the
+// header must also have exactly that value.
+func Header(name, value string) RequestFilter {
+	return func(r *http.Request) bool {
+		values, ok := r.Header[http.CanonicalHeaderKey(name)]
+		if !ok {
+			return false
+		}
+		if value == "" {
+			return true
+		}
+		for _, v := range values {
+			if v == value {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// HeaderPrefix matches requests whose header name starts with prefix.
+func HeaderPrefix(name, prefix string) RequestFilter {
+	return func(r *http.Request) bool {
+		for _, v := range r.Header[http.CanonicalHeaderKey(name)] {
+			if strings.HasPrefix(v, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Any matches requests matched by any of filters.
+func Any(filters ...RequestFilter) RequestFilter {
+	return func(r *http.Request) bool {
+		for _, f := range filters {
+			if f(r) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// All matches requests matched by every one of filters.
+func All(filters ...RequestFilter) RequestFilter {
+	return func(r *http.Request) bool {
+		for _, f := range filters {
+			if !f(r) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// HealthChecks matches requests to the usual health check paths (/health,
+// /healthz, /livez, /readyz, /ping) and requests from the AWS, Google Cloud,
+// and Kubernetes health checkers, identified by their user agents.
+var HealthChecks = Any(
+	Paths("/health", "/healthz", "/livez", "/readyz", "/ping"),
+	HeaderPrefix("User-Agent", "ELB-HealthChecker/"),
+	HeaderPrefix("User-Agent", "GoogleHC/"),
+	HeaderPrefix("User-Agent", "kube-probe/"),
+)
+
+// CORSPreflight matches CORS preflight requests: OPTIONS requests with an
+// Access-Control-Request-Method header.
+var CORSPreflight = All(Methods(http.MethodOptions), Header("Access-Control-Request-Method", ""))
@@ -0,0 +1,44 @@
+package config
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestFilters(t *testing.T) {
+	req := func(method, path string, headers ...string) *http.Request {
+		r, _ := http.NewRequest(method, path, nil)
+		for i := 0; i+1 < len(headers); i += 2 {
+			r.Header.Add(headers[i], headers[i+1])
+		}
+		return r
+	}
+
+	assert.True(t, Paths("/a", "/b")(req("GET", "/b")))
+	assert.False(t, Paths("/a")(req("GET", "/a/b")))
+	assert.True(t, PathPrefixes("/debug/")(req("GET", "/debug/pprof")))
+	assert.True(t, Methods("options")(req("OPTIONS", "/")))
+	assert.False(t, Methods("GET", "HEAD")(req("POST", "/")))
+	assert.True(t, Header("X-Probe", "")(req("GET", "/", "x-probe", "1")))
+	assert.False(t, Header("X-Probe", "2")(req("GET", "/", "X-Probe", "1")))
+	assert.True(t, HeaderPrefix("User-Agent", "curl/")(req("GET", "/", "User-Agent", "curl/7.64")))
+	assert.False(t, All(Methods("GET"), Paths("/a"))(req("GET", "/b")))
+	assert.True(t, Any(Methods("PUT"), Paths("/b"))(req("GET", "/b")))
+
+	assert.True(t, HealthChecks(req("GET", "/healthz")))
+	assert.True(t, HealthChecks(req("GET", "/", "User-Agent", "ELB-HealthChecker/2.0")))
+	assert.True(t, HealthChecks(req("GET", "/status", "User-Agent", "kube-probe/1.18")))
+	assert.False(t, HealthChecks(req("GET", "/users", "User-Agent", "Mozilla/5.0")))
+	assert.True(t, CORSPreflight(req("OPTIONS", "/users", "Access-Control-Request-Method", "POST")))
+	assert.False(t, CORSPreflight(req("OPTIONS", "/users")))
+}
+
+func TestMethodFilters(t *testing.T) {
+	assert.True(t, GRPCMethods("/a.B/C")("/a.B/C"))
+	assert.False(t, GRPCMethods("/a.B/C")("/a.B/D"))
+	assert.True(t, GRPCHealthChecks("/grpc.health.v1.Health/Watch"))
+	assert.False(t, GRPCHealthChecks("/grpc.health.v1.HealthX/Check"))
+	assert.True(t, GRPCReflection("/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo"))
+}
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"context"
+	"strings"
+
+	"github.com/honeycombio/beeline-go/propagation"
+)
+
+// GRPCTraceParserHook is a function that will be invoked on all incoming gRPC
+// calls when it is passed as a parameter to an interceptor such as the ones
+// provided in the hnygrpc package. It can be used to create a
+// PropagationContext object using trace context propagation headers in the
+// call's incoming metadata, which is in ctx.
+type GRPCTraceParserHook func(ctx context.Context) *propagation.PropagationContext
+
+// GRPCFieldEnricher returns fields to add to the span for an incoming call
+// to fullMethod, eg a tenant read from the call's metadata, which is in ctx.
+type GRPCFieldEnricher func(ctx context.Context, fullMethod string) map[string]interface{}
+
+// MethodFilter reports whether a gRPC method, given by its full name (eg
+// "/grpc.health.v1.Health/Check"), matches some condition.
+type MethodFilter func(fullMethod string) bool
+
+// GRPCMethods matches the methods with the full names fullMethods.
+func GRPCMethods(fullMethods ...string) MethodFilter {
+	set := make(map[string]struct{}, len(fullMethods))
+	for _, m := range fullMethods {
+		set[m] = struct{}{}
+	}
+	return func(fullMethod string) bool {
+		_, ok := set[fullMethod]
+		return ok
+	}
+}
+
+// GRPCServices matches every method of the services named services, eg
+// "grpc.health.v1.Health".
+func GRPCServices(services ...string) MethodFilter {
+	return func(fullMethod string) bool {
+		for _, s := range services {
+			if strings.HasPrefix(fullMethod, "/"+s+"/") {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// GRPCHealthChecks matches the methods of the standard gRPC health checking
+// service, grpc.health.v1.Health.
+var GRPCHealthChecks = GRPCServices("grpc.health.v1.Health")
+
+// GRPCReflection matches the methods of the gRPC server reflection service.
+var GRPCReflection = GRPCServices("grpc.reflection.v1alpha.ServerReflection", "grpc.reflection.v1.ServerReflection")
+
+// GRPCIncomingConfig stores configuration options relevant to gRPC calls that
+// are handled by an interceptor.
+type GRPCIncomingConfig struct {
+	GRPCParserHook GRPCTraceParserHook
+	// Skip, if set, is called with the method of every incoming call. Calls
+	// it matches are handled without being traced. GRPCHealthChecks and
+	// GRPCReflection match calls that usually aren't worth tracing.
+	Skip MethodFilter
+	// Reduce, if set, is called with the method of every incoming call that
+	// isn't skipped and doesn't already belong to a trace. Calls it matches
+	// start traces sampled at ReducedSampleRate instead of the beeline's
+	// usual sample rate, so some are still traced.
+	Reduce            MethodFilter
+	ReducedSampleRate uint
+	// NameFunc, if set, names the span for each incoming call, which is
+	// otherwise named after the call's full method. If it returns "", the
+	// full method is kept. The handler.method field always holds the full
+	// method.
+	NameFunc func(fullMethod string) string
+	// Enrichers are called, in order, when the span for each incoming call
+	// starts, and the fields they return are added to it. Fields returned
+	// by later enrichers replace those of earlier ones.
+	Enrichers []GRPCFieldEnricher
+}
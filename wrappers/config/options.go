@@ -0,0 +1,70 @@
+package config
+
+import (
+	"net/http"
+
+	"github.com/honeycombio/beeline-go/propagation"
+)
+
+// An HTTPOption sets an option in an HTTPIncomingConfig. The HTTP wrappers'
+// WithOptions constructors take a list of them, so new options can be added
+// without changing their signatures.
+type HTTPOption func(*HTTPIncomingConfig)
+
+// HTTPFieldEnricher returns fields to add to the span for an incoming
+// request, eg the tenant a request was made for, read from its headers.
+type HTTPFieldEnricher func(*http.Request) map[string]interface{}
+
+// NewHTTPIncomingConfig returns an HTTPIncomingConfig with opts applied in
+// order.
+func NewHTTPIncomingConfig(opts ...HTTPOption) HTTPIncomingConfig {
+	var cfg HTTPIncomingConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// WithConfig starts from the settings in cfg, for options that have no
+// HTTPOption of their own. Options after it change the settings in cfg, and
+// options before it are replaced by them.
+func WithConfig(cfg HTTPIncomingConfig) HTTPOption {
+	return func(c *HTTPIncomingConfig) {
+		*c = cfg
+	}
+}
+
+// WithNameFunc sets the NameFunc that names the span for each request.
+func WithNameFunc(f func(*http.Request) string) HTTPOption {
+	return func(c *HTTPIncomingConfig) {
+		c.NameFunc = f
+	}
+}
+
+// WithFilter skips tracing requests that f matches, as Skip does. Giving it
+// more than once skips requests matched by any of the filters.
+func WithFilter(f RequestFilter) HTTPOption {
+	return func(c *HTTPIncomingConfig) {
+		if c.Skip != nil {
+			f = Any(c.Skip, f)
+		}
+		c.Skip = f
+	}
+}
+
+// WithPropagators continues traces from trace context headers in each of
+// formats, trying them in order, instead of only from the X-Honeycomb-Trace
+// header. See ParseFormats.
+func WithPropagators(formats ...propagation.Format) HTTPOption {
+	return func(c *HTTPIncomingConfig) {
+		c.HTTPParserHook = ParseFormats(formats...)
+	}
+}
+
+// WithFieldEnricher adds f to the Enrichers whose fields are added to the
+// span for each request.
+func WithFieldEnricher(f HTTPFieldEnricher) HTTPOption {
+	return func(c *HTTPIncomingConfig) {
+		c.Enrichers = append(c.Enrichers, f)
+	}
+}
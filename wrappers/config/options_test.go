@@ -0,0 +1,36 @@
+package config
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/honeycombio/beeline-go/propagation"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPOptions(t *testing.T) {
+	cfg := NewHTTPIncomingConfig(
+		WithConfig(HTTPIncomingConfig{TemplateRoutes: true}),
+		WithNameFunc(MethodAndRoute),
+		WithFilter(Paths("/healthz")),
+		WithFilter(CORSPreflight),
+		WithPropagators(propagation.FormatW3C),
+		WithFieldEnricher(func(r *http.Request) map[string]interface{} { return nil }),
+		WithFieldEnricher(func(r *http.Request) map[string]interface{} { return nil }),
+	)
+	assert.True(t, cfg.TemplateRoutes, "WithConfig should set options without one of their own")
+	assert.NotNil(t, cfg.NameFunc)
+	assert.NotNil(t, cfg.HTTPParserHook)
+	assert.Equal(t, 2, len(cfg.Enrichers))
+
+	r, _ := http.NewRequest("GET", "/healthz", nil)
+	assert.True(t, cfg.Skip(r))
+	r, _ = http.NewRequest("OPTIONS", "/users", nil)
+	r.Header.Set("Access-Control-Request-Method", "POST")
+	assert.True(t, cfg.Skip(r), "every filter should be applied")
+	r, _ = http.NewRequest("GET", "/users", nil)
+	assert.False(t, cfg.Skip(r))
+
+	cfg = NewHTTPIncomingConfig(WithNameFunc(MethodAndRoute), WithConfig(HTTPIncomingConfig{}))
+	assert.Nil(t, cfg.NameFunc, "WithConfig should replace earlier options")
+}
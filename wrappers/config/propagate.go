@@ -0,0 +1,110 @@
+package config
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/honeycombio/beeline-go/propagation"
+)
+
+// PropagateFormats returns an HTTPTracePropagationHook that adds trace
+// context headers in each of formats to every outgoing request, eg both the
+// Honeycomb and W3C headers while downstream services move from one to the
+// other. The headers all identify the same trace and parent span; see
+// propagation.MarshalHeaders.
+func PropagateFormats(formats ...propagation.Format) HTTPTracePropagationHook {
+	return func(r *http.Request, prop *propagation.PropagationContext) map[string]string {
+		return propagation.MarshalHeaders(r.Context(), prop, formats...)
+	}
+}
+
+// PropagateByHost returns an HTTPTracePropagationHook that chooses the formats
+// of the trace context headers added to each outgoing request by the host it
+// is sent to. Requests to hosts that aren't in byHost get headers in the
+// fallback formats, if any; give no fallback to avoid sending trace context
+// to unknown hosts.
+//
+//	hook := config.PropagateByHost(map[string][]propagation.Format{
+//	  "legacy.internal": {propagation.FormatHoneycomb},
+//	  "api.partner.com": {propagation.FormatW3C},
+//	}, propagation.FormatHoneycomb, propagation.FormatW3C)
+func PropagateByHost(byHost map[string][]propagation.Format, fallback ...propagation.Format) HTTPTracePropagationHook {
+	return func(r *http.Request, prop *propagation.PropagationContext) map[string]string {
+		formats, ok := byHost[r.URL.Hostname()]
+		if !ok {
+			formats = fallback
+		}
+		return propagation.MarshalHeaders(r.Context(), prop, formats...)
+	}
+}
+
+// ParseFormats returns an HTTPTraceParserHook that continues the trace in the
+// first of formats whose trace context headers are on the incoming request
+// and can be parsed, eg the W3C headers from services that have moved to
+// them and the Honeycomb header from those that haven't.
+func ParseFormats(formats ...propagation.Format) HTTPTraceParserHook {
+	return func(r *http.Request) *propagation.PropagationContext {
+		for _, f := range formats {
+			var prop *propagation.PropagationContext
+			var err error
+			switch f {
+			case propagation.FormatHoneycomb:
+				if header := r.Header.Get(propagation.TracePropagationHTTPHeader); header != "" {
+					prop, err = propagation.UnmarshalHoneycombTraceContext(header)
+				}
+			case propagation.FormatAmazon:
+				if header := r.Header.Get("X-Amzn-Trace-Id"); header != "" {
+					prop, err = propagation.UnmarshalAmazonTraceContext(header)
+				}
+			case propagation.FormatW3C:
+				if tp := r.Header.Get("traceparent"); tp != "" {
+					// a parser hook can't pass the tracestate along, so it
+					// isn't parsed
+					_, prop, err = propagation.UnmarshalW3CTraceContext(r.Context(), map[string]string{"traceparent": tp})
+				}
+			}
+			if err == nil && prop != nil && prop.IsValid() {
+				return prop
+			}
+		}
+		return nil
+	}
+}
+
+// GRPCTracePropagationHook is a function that will be invoked on all outgoing
+// gRPC calls when it is passed as a parameter to a client interceptor such as
+// the ones provided in the hnygrpc package. It returns a map of metadata keys
+// to values to add to the call. target is the address the call's connection
+// was dialed with, which can be used to decide which formats to send.
+type GRPCTracePropagationHook func(ctx context.Context, target string, prop *propagation.PropagationContext) map[string]string
+
+// GRPCPropagateFormats returns a GRPCTracePropagationHook that adds trace
+// context metadata in each of formats to every outgoing call. See
+// PropagateFormats.
+func GRPCPropagateFormats(formats ...propagation.Format) GRPCTracePropagationHook {
+	return func(ctx context.Context, target string, prop *propagation.PropagationContext) map[string]string {
+		return propagation.MarshalHeaders(ctx, prop, formats...)
+	}
+}
+
+// GRPCPropagateByTarget returns a GRPCTracePropagationHook that chooses the
+// formats of the trace context metadata added to each outgoing call by the
+// target its connection was dialed with. Calls to targets that aren't in
+// byTarget get metadata in the fallback formats, if any. See PropagateByHost.
+func GRPCPropagateByTarget(byTarget map[string][]propagation.Format, fallback ...propagation.Format) GRPCTracePropagationHook {
+	return func(ctx context.Context, target string, prop *propagation.PropagationContext) map[string]string {
+		formats, ok := byTarget[target]
+		if !ok {
+			formats = fallback
+		}
+		return propagation.MarshalHeaders(ctx, prop, formats...)
+	}
+}
+
+// GRPCOutgoingConfig stores configuration options relevant to gRPC calls made
+// by an instrumented application.
+type GRPCOutgoingConfig struct {
+	// GRPCPropagationHook, if set, chooses the trace context metadata added
+	// to each call, instead of the beeline's PropagationFormats.
+	GRPCPropagationHook GRPCTracePropagationHook
+}
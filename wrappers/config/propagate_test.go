@@ -0,0 +1,75 @@
+package config
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/honeycombio/beeline-go/propagation"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFormats(t *testing.T) {
+	hook := ParseFormats(propagation.FormatW3C, propagation.FormatHoneycomb)
+	r, _ := http.NewRequest("GET", "http://example.com/", nil)
+	assert.Nil(t, hook(r), "requests without trace context headers don't continue a trace")
+
+	r.Header.Set("X-Honeycomb-Trace", "1;trace_id=abcdef,parent_id=123456")
+	prop := hook(r)
+	if assert.NotNil(t, prop) {
+		assert.Equal(t, "abcdef", prop.TraceID)
+	}
+
+	r.Header.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	prop = hook(r)
+	if assert.NotNil(t, prop) {
+		assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", prop.TraceID, "earlier formats should be preferred")
+		assert.Equal(t, "b7ad6b7169203331", prop.ParentID)
+	}
+
+	r.Header.Set("traceparent", "garbage")
+	prop = hook(r)
+	if assert.NotNil(t, prop) {
+		assert.Equal(t, "abcdef", prop.TraceID, "unparseable headers should be passed over")
+	}
+	assert.Nil(t, ParseFormats(propagation.FormatAmazon)(r))
+}
+
+func TestPropagationHooks(t *testing.T) {
+	prop := &propagation.PropagationContext{
+		TraceID:  "0af7651916cd43dd8448eb211c80319c",
+		ParentID: "b7ad6b7169203331",
+	}
+	both := PropagateFormats(propagation.FormatHoneycomb, propagation.FormatW3C)
+	r, _ := http.NewRequest("GET", "http://example.com/", nil)
+	headers := both(r, prop)
+	assert.Contains(t, headers, "X-Honeycomb-Trace")
+	assert.Equal(t, "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-00", headers["traceparent"])
+
+	byHost := PropagateByHost(map[string][]propagation.Format{
+		"legacy.internal": {propagation.FormatHoneycomb},
+	})
+	r, _ = http.NewRequest("GET", "http://legacy.internal:8080/", nil)
+	headers = byHost(r, prop)
+	assert.Equal(t, 1, len(headers))
+	assert.Contains(t, headers, "X-Honeycomb-Trace")
+	r, _ = http.NewRequest("GET", "https://api.partner.com/", nil)
+	assert.Empty(t, byHost(r, prop), "unknown hosts should get no headers without a fallback")
+
+	byTarget := GRPCPropagateByTarget(map[string][]propagation.Format{
+		"users:443": {propagation.FormatW3C},
+	}, propagation.FormatHoneycomb)
+	headers = byTarget(context.Background(), "users:443", prop)
+	assert.Equal(t, []string{"traceparent"}, keysOf(headers))
+	headers = byTarget(context.Background(), "billing:443", prop)
+	assert.Equal(t, []string{"X-Honeycomb-Trace"}, keysOf(headers))
+	assert.Equal(t, 2, len(GRPCPropagateFormats(propagation.FormatHoneycomb, propagation.FormatW3C)(context.Background(), "", prop)))
+}
+
+func keysOf(m map[string]string) []string {
+	var ks []string
+	for k := range m {
+		ks = append(ks, k)
+	}
+	return ks
+}
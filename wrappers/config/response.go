@@ -0,0 +1,43 @@
+package config
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/honeycombio/beeline-go/propagation"
+)
+
+// TraceIDResponseHeader returns an HTTPTraceResponseHook that sets the
+// response header name to the request's trace ID, eg
+// TraceIDResponseHeader("X-Honeycomb-Trace-Id").
+func TraceIDResponseHeader(name string) HTTPTraceResponseHook {
+	return func(r *http.Request, prop *propagation.PropagationContext) map[string]string {
+		if prop == nil || prop.TraceID == "" {
+			return nil
+		}
+		return map[string]string{name: prop.TraceID}
+	}
+}
+
+// ServerTimingTraceparent is an HTTPTraceResponseHook that adds a
+// Server-Timing header holding the request's span as a sampled W3C
+// traceparent,
+//
+//	Server-Timing: traceparent;desc="00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+//
+// which browser RUM tools read to join their spans to the trace. Browsers only
+// let scripts from other origins read it if the response also has a
+// Timing-Allow-Origin header. Nothing is added if the trace's IDs aren't valid
+// W3C IDs.
+func ServerTimingTraceparent(r *http.Request, prop *propagation.PropagationContext) map[string]string {
+	if prop == nil {
+		return nil
+	}
+	sampled := *prop
+	sampled.TraceFlags = 1
+	traceparent := propagation.MarshalHeaders(context.Background(), &sampled, propagation.FormatW3C)["traceparent"]
+	if traceparent == "" {
+		return nil
+	}
+	return map[string]string{"Server-Timing": `traceparent;desc="` + traceparent + `"`}
+}
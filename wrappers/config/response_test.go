@@ -0,0 +1,27 @@
+package config
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/honeycombio/beeline-go/propagation"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResponseHooks(t *testing.T) {
+	r, _ := http.NewRequest("GET", "/", nil)
+	prop := &propagation.PropagationContext{
+		TraceID:  "0af7651916cd43dd8448eb211c80319c",
+		ParentID: "b7ad6b7169203331",
+	}
+	assert.Equal(t, map[string]string{"X-Trace-Id": "0af7651916cd43dd8448eb211c80319c"},
+		TraceIDResponseHeader("X-Trace-Id")(r, prop))
+	assert.Equal(t, map[string]string{
+		"Server-Timing": `traceparent;desc="00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"`,
+	}, ServerTimingTraceparent(r, prop))
+	assert.Equal(t, byte(0), prop.TraceFlags, "the hook shouldn't change the propagation context")
+
+	assert.Nil(t, ServerTimingTraceparent(r, &propagation.PropagationContext{TraceID: "abc", ParentID: "def"}),
+		"IDs that can't be traceparents should add nothing")
+	assert.Nil(t, TraceIDResponseHeader("X-Trace-Id")(r, nil))
+}
@@ -0,0 +1,36 @@
+package config
+
+import (
+	"net/http"
+
+	"github.com/honeycombio/beeline-go/propagation"
+)
+
+// BrowserTraceContext returns an HTTPTraceParserHook that continues traces
+// started in the browser by a RUM library, which sends a W3C traceparent in
+// the request header named header ("traceparent" if it is empty), so a page
+// load and the backend requests it makes become one trace. The traceparent is
+// validated before it is adopted; requests without a valid one continue a
+// trace from the X-Honeycomb-Trace header as usual, or start a new one.
+//
+// Browsers only send traceparent headers to other origins that allow them
+// with CORS, and anyone can send one, so only use this hook on endpoints that
+// browsers call directly.
+func BrowserTraceContext(header string) HTTPTraceParserHook {
+	if header == "" {
+		header = "traceparent"
+	}
+	return func(r *http.Request) *propagation.PropagationContext {
+		if tp := r.Header.Get(header); tp != "" {
+			_, prop, err := propagation.UnmarshalW3CTraceContext(r.Context(), map[string]string{"traceparent": tp})
+			if err == nil {
+				return prop
+			}
+		}
+		if h := r.Header.Get(propagation.TracePropagationHTTPHeader); h != "" {
+			prop, _ := propagation.UnmarshalHoneycombTraceContext(h)
+			return prop
+		}
+		return nil
+	}
+}
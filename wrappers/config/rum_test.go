@@ -0,0 +1,37 @@
+package config
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBrowserTraceContext(t *testing.T) {
+	hook := BrowserTraceContext("")
+	r, _ := http.NewRequest("GET", "/api", nil)
+	r.Header.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	r.Header.Set("X-Honeycomb-Trace", "1;trace_id=abcdef,parent_id=123456")
+	prop := hook(r)
+	if assert.NotNil(t, prop) {
+		assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", prop.TraceID)
+		assert.Equal(t, "b7ad6b7169203331", prop.ParentID)
+	}
+
+	r.Header.Set("traceparent", "00-00000000000000000000000000000000-b7ad6b7169203331-01")
+	prop = hook(r)
+	if assert.NotNil(t, prop, "invalid traceparents should fall back to the Honeycomb header") {
+		assert.Equal(t, "abcdef", prop.TraceID)
+	}
+
+	r.Header.Del("X-Honeycomb-Trace")
+	assert.Nil(t, hook(r))
+
+	hook = BrowserTraceContext("X-RUM-Traceparent")
+	r, _ = http.NewRequest("GET", "/api", nil)
+	r.Header.Set("X-RUM-Traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	prop = hook(r)
+	if assert.NotNil(t, prop) {
+		assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", prop.TraceID)
+	}
+}
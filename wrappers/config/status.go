@@ -0,0 +1,45 @@
+package config
+
+// StatusRange is an inclusive range of HTTP status codes, eg {500, 599}.
+type StatusRange struct {
+	Min, Max int
+}
+
+// contains reports whether status is in r.
+func (r StatusRange) contains(status int) bool {
+	return status >= r.Min && status <= r.Max
+}
+
+// ErrorPolicy decides which HTTP response statuses mark a request's span as
+// an error. A status is an error if it is in one of the Include ranges and
+// none of the Exclude ranges, so that
+//
+//   config.ErrorPolicy{
+//     Include: []config.StatusRange{{Min: 400, Max: 599}},
+//     Exclude: []config.StatusRange{{Min: 404, Max: 404}},
+//   }
+//
+// counts every 4xx and 5xx response but 404s. Statuses that aren't standard,
+// like nginx's 499 for requests the client gave up on, can be included too.
+type ErrorPolicy struct {
+	Include []StatusRange
+	Exclude []StatusRange
+}
+
+// IsError reports whether p treats status as an error.
+func (p ErrorPolicy) IsError(status int) bool {
+	for _, r := range p.Exclude {
+		if r.contains(status) {
+			return false
+		}
+	}
+	for _, r := range p.Include {
+		if r.contains(status) {
+			return true
+		}
+	}
+	return false
+}
+
+// ServerErrors is an ErrorPolicy that treats 5xx responses as errors.
+var ServerErrors = ErrorPolicy{Include: []StatusRange{{500, 599}}}
@@ -0,0 +1,22 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorPolicy(t *testing.T) {
+	assert.False(t, ErrorPolicy{}.IsError(500), "the zero policy has no errors")
+	assert.True(t, ServerErrors.IsError(503))
+	assert.False(t, ServerErrors.IsError(404))
+
+	p := ErrorPolicy{
+		Include: []StatusRange{{400, 599}},
+		Exclude: []StatusRange{{404, 404}},
+	}
+	assert.True(t, p.IsError(499))
+	assert.True(t, p.IsError(400))
+	assert.False(t, p.IsError(404))
+	assert.False(t, p.IsError(302))
+}
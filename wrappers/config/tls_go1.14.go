@@ -0,0 +1,12 @@
+//go:build go1.14
+// +build go1.14
+
+package config
+
+import "crypto/tls"
+
+// TLSCipherSuiteName returns the standard name of a cipher suite, eg
+// "TLS_AES_128_GCM_SHA256".
+func TLSCipherSuiteName(id uint16) string {
+	return tls.CipherSuiteName(id)
+}
@@ -0,0 +1,12 @@
+//go:build !go1.14
+// +build !go1.14
+
+package config
+
+import "fmt"
+
+// TLSCipherSuiteName returns the ID of a cipher suite in hex, since versions
+// of Go before 1.14 can't name them.
+func TLSCipherSuiteName(id uint16) string {
+	return fmt.Sprintf("0x%04X", id)
+}
@@ -0,0 +1,127 @@
+package config
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// URLPolicy controls how much of each request's URL the HTTP wrappers record
+// in the request.url, request.path, and request.query fields, so tokens and
+// personal data in URLs don't end up in Honeycomb. The zero value records
+// URLs unchanged.
+type URLPolicy struct {
+	// StripQuery omits the query string entirely.
+	StripQuery bool
+	// AllowedQueryParams, if set, lists the only query parameters that are
+	// recorded; all others are removed. Ignored if StripQuery is set.
+	AllowedQueryParams []string
+	// PathTemplates replace path segments that match their patterns with a
+	// placeholder, eg turning /users/1234/orders into /users/:id/orders.
+	PathTemplates []PathTemplate
+}
+
+// PathTemplate replaces whole path segments matching Pattern with
+// Placeholder.
+type PathTemplate struct {
+	Pattern     *regexp.Regexp
+	Placeholder string
+}
+
+var (
+	// NumericIDs is a PathTemplate that replaces all-digit path segments
+	// with ":id".
+	NumericIDs = PathTemplate{Pattern: regexp.MustCompile(`^[0-9]+$`), Placeholder: ":id"}
+	// UUIDs is a PathTemplate that replaces UUID path segments with ":uuid".
+	UUIDs = PathTemplate{Pattern: regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`), Placeholder: ":uuid"}
+	// Hashes is a PathTemplate that replaces path segments of 16 or more hex
+	// digits, such as SHAs and object IDs, with ":hash".
+	Hashes = PathTemplate{Pattern: regexp.MustCompile(`^[0-9a-fA-F]{16,}$`), Placeholder: ":hash"}
+)
+
+// RouteTemplates are the templates used by TemplateRoute.
+var RouteTemplates = []PathTemplate{NumericIDs, UUIDs, Hashes}
+
+// TemplateRoute guesses the route pattern that matched path for routers that
+// don't expose one, such as http.ServeMux, by replacing segments that look
+// like IDs with placeholders. Unlike the raw path, the result is low enough
+// cardinality to group requests by.
+func TemplateRoute(path string) string {
+	return URLPolicy{PathTemplates: RouteTemplates}.templatePath(path)
+}
+
+var (
+	defaultURLPolicy     URLPolicy
+	defaultURLPolicyLock sync.RWMutex
+)
+
+// SetDefaultURLPolicy sets the URLPolicy used by wrappers that aren't given
+// one in their config. It applies to incoming and outgoing requests alike.
+func SetDefaultURLPolicy(p URLPolicy) {
+	defaultURLPolicyLock.Lock()
+	defer defaultURLPolicyLock.Unlock()
+	defaultURLPolicy = p
+}
+
+// DefaultURLPolicy returns the policy set by SetDefaultURLPolicy.
+func DefaultURLPolicy() URLPolicy {
+	defaultURLPolicyLock.RLock()
+	defer defaultURLPolicyLock.RUnlock()
+	return defaultURLPolicy
+}
+
+// Apply returns the path, query string, and full URL to record for u.
+func (p URLPolicy) Apply(u *url.URL) (path, query, full string) {
+	path = p.templatePath(u.Path)
+	query = p.filterQuery(u.RawQuery)
+	if path == u.Path && query == u.RawQuery {
+		return path, query, u.String()
+	}
+	recorded := *u
+	recorded.Path = path
+	recorded.RawPath = ""
+	recorded.RawQuery = query
+	recorded.ForceQuery = false
+	return path, query, recorded.String()
+}
+
+func (p URLPolicy) templatePath(path string) string {
+	if len(p.PathTemplates) == 0 {
+		return path
+	}
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if segment == "" {
+			continue
+		}
+		for _, tmpl := range p.PathTemplates {
+			if tmpl.Pattern.MatchString(segment) {
+				segments[i] = tmpl.Placeholder
+				break
+			}
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func (p URLPolicy) filterQuery(rawQuery string) string {
+	if p.StripQuery {
+		return ""
+	}
+	if p.AllowedQueryParams == nil || rawQuery == "" {
+		return rawQuery
+	}
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		// don't risk recording something we can't filter
+		return ""
+	}
+	allowed := make(url.Values)
+	for _, name := range p.AllowedQueryParams {
+		if v, ok := values[name]; ok {
+			allowed[name] = v
+		}
+	}
+	return allowed.Encode()
+}
@@ -0,0 +1,44 @@
+package config
+
+import (
+	"net/url"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestURLPolicyApply(t *testing.T) {
+	u, err := url.Parse("https://example.com/users/1234/orders/abc?token=secret&page=2")
+	assert.NoError(t, err)
+
+	path, query, full := URLPolicy{}.Apply(u)
+	assert.Equal(t, "/users/1234/orders/abc", path, "the zero policy should record URLs unchanged")
+	assert.Equal(t, "token=secret&page=2", query)
+	assert.Equal(t, u.String(), full)
+
+	path, query, full = URLPolicy{StripQuery: true, PathTemplates: []PathTemplate{NumericIDs}}.Apply(u)
+	assert.Equal(t, "/users/:id/orders/abc", path)
+	assert.Equal(t, "", query)
+	assert.Equal(t, "https://example.com/users/:id/orders/abc", full)
+
+	p := URLPolicy{
+		AllowedQueryParams: []string{"page"},
+		PathTemplates: []PathTemplate{
+			NumericIDs,
+			{Pattern: regexp.MustCompile(`^[a-z]{3}$`), Placeholder: ":code"},
+		},
+	}
+	path, query, full = p.Apply(u)
+	assert.Equal(t, "/users/:id/orders/:code", path)
+	assert.Equal(t, "page=2", query)
+	assert.Equal(t, "https://example.com/users/:id/orders/:code?page=2", full)
+}
+
+func TestTemplateRoute(t *testing.T) {
+	assert.Equal(t, "/users/:id/orders", TemplateRoute("/users/1234/orders"))
+	assert.Equal(t, "/keys/:uuid", TemplateRoute("/keys/3f2504e0-4f89-11d3-9a0c-0305e82c3301"))
+	assert.Equal(t, "/commits/:hash/", TemplateRoute("/commits/9fceb02d0ae598e95dc970b74767f19372d61af8/"))
+	assert.Equal(t, "/users/me/v2", TemplateRoute("/users/me/v2"), "segments that don't look like IDs should be kept")
+	assert.Equal(t, "/cafe", TemplateRoute("/cafe"), "short hex words shouldn't be treated as hashes")
+}
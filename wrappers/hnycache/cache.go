@@ -0,0 +1,159 @@
+package hnycache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	beeline "github.com/honeycombio/beeline-go"
+	"github.com/honeycombio/beeline-go/trace"
+)
+
+// Store is the cache a Cache instruments.
+type Store interface {
+	// Get returns the value cached for key, and whether there was one.
+	Get(ctx context.Context, key string) (value interface{}, found bool, err error)
+	// Set caches value for key for ttl, or for as long as the cache keeps
+	// it if ttl is 0.
+	Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error
+	// Delete removes the value cached for key.
+	Delete(ctx context.Context, key string) error
+}
+
+// Funcs is a Store made of functions, for adapting caches without declaring
+// a type. Operations whose functions are nil do nothing.
+type Funcs struct {
+	GetFunc    func(ctx context.Context, key string) (interface{}, bool, error)
+	SetFunc    func(ctx context.Context, key string, value interface{}, ttl time.Duration) error
+	DeleteFunc func(ctx context.Context, key string) error
+}
+
+func (f Funcs) Get(ctx context.Context, key string) (interface{}, bool, error) {
+	if f.GetFunc == nil {
+		return nil, false, nil
+	}
+	return f.GetFunc(ctx, key)
+}
+
+func (f Funcs) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	if f.SetFunc == nil {
+		return nil
+	}
+	return f.SetFunc(ctx, key, value, ttl)
+}
+
+func (f Funcs) Delete(ctx context.Context, key string) error {
+	if f.DeleteFunc == nil {
+		return nil
+	}
+	return f.DeleteFunc(ctx, key)
+}
+
+// Cache wraps a Store to make a span of each operation, a child of the span
+// in the operation's context.
+type Cache struct {
+	store Store
+	name  string
+	// RecordKeys, if set, records keys as they are in cache.key as well as
+	// hashed in cache.key_hash. Keys often hold user or session IDs, so by
+	// default only the hash is recorded; it still groups operations on the
+	// same key.
+	RecordKeys bool
+	// Size returns the size of a value in bytes, for cache.value_bytes. The
+	// default, DefaultSize, measures []byte and string values.
+	Size func(value interface{}) int
+	// Priority is the priority of the operations' spans. Cache operations
+	// are usually many and quick, so by default they are the first spans
+	// shed when the beeline is short of memory or can't send them fast
+	// enough. default: trace.PriorityVerbose
+	Priority trace.Priority
+}
+
+// Wrap returns a Cache recording the operations made on store, with name in
+// cache.name to tell the application's caches apart.
+func Wrap(name string, store Store) *Cache {
+	return &Cache{store: store, name: name, Size: DefaultSize, Priority: trace.PriorityVerbose}
+}
+
+// DefaultSize returns the length of []byte and string values, and of values
+// with a Len method, and -1 for other values, which are not recorded.
+func DefaultSize(value interface{}) int {
+	switch v := value.(type) {
+	case []byte:
+		return len(v)
+	case string:
+		return len(v)
+	case interface{ Len() int }:
+		return v.Len()
+	}
+	return -1
+}
+
+// Get gets the value cached for key in a span named cache.get, recording
+// whether it was found in cache.hit.
+func (c *Cache) Get(ctx context.Context, key string) (interface{}, bool, error) {
+	ctx, span := c.startSpan(ctx, "get", key)
+	value, found, err := c.store.Get(ctx, key)
+	span.AddField("cache.hit", found)
+	if found {
+		c.addSize(span, value)
+	}
+	c.finish(span, err)
+	return value, found, err
+}
+
+// Set caches value for key for ttl in a span named cache.set.
+func (c *Cache) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	ctx, span := c.startSpan(ctx, "set", key)
+	c.addSize(span, value)
+	if ttl > 0 {
+		span.AddField("cache.ttl_ms", float64(ttl)/float64(time.Millisecond))
+	}
+	err := c.store.Set(ctx, key, value, ttl)
+	c.finish(span, err)
+	return err
+}
+
+// Delete removes the value cached for key in a span named cache.delete.
+func (c *Cache) Delete(ctx context.Context, key string) error {
+	ctx, span := c.startSpan(ctx, "delete", key)
+	err := c.store.Delete(ctx, key)
+	c.finish(span, err)
+	return err
+}
+
+func (c *Cache) startSpan(ctx context.Context, op, key string) (context.Context, *trace.Span) {
+	ctx, span := beeline.StartSpan(ctx, "cache."+op)
+	span.SetPriority(c.Priority)
+	span.AddField("meta.type", "cache")
+	span.AddField("cache.name", c.name)
+	span.AddField("cache.operation", op)
+	span.AddField("cache.key_hash", hashKey(key))
+	if c.RecordKeys {
+		span.AddField("cache.key", key)
+	}
+	return ctx, span
+}
+
+func (c *Cache) addSize(span *trace.Span, value interface{}) {
+	if c.Size == nil {
+		return
+	}
+	if size := c.Size(value); size >= 0 {
+		span.AddField("cache.value_bytes", size)
+	}
+}
+
+func (c *Cache) finish(span *trace.Span, err error) {
+	if err != nil {
+		span.AddField("cache.error", err.Error())
+	}
+	span.Send()
+}
+
+// hashKey returns a short hash of key, enough to tell keys apart.
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,82 @@
+package hnycache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	beeline "github.com/honeycombio/beeline-go"
+	"github.com/honeycombio/libhoney-go/transmission"
+)
+
+// mapStore is a Store backed by a map.
+type mapStore map[string]interface{}
+
+func (m mapStore) Get(ctx context.Context, key string) (interface{}, bool, error) {
+	v, ok := m[key]
+	return v, ok, nil
+}
+
+func (m mapStore) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	m[key] = value
+	return nil
+}
+
+func (m mapStore) Delete(ctx context.Context, key string) error {
+	delete(m, key)
+	return nil
+}
+
+func TestCache(t *testing.T) {
+	mo := &transmission.MockSender{}
+	beeline.Init(beeline.Config{Transmission: mo})
+	defer beeline.Close()
+
+	ctx, root := beeline.StartSpan(context.Background(), "handler")
+	c := Wrap("sessions", mapStore{})
+	assert.NoError(t, c.Set(ctx, "user:42", []byte("rose"), time.Minute))
+	v, ok, err := c.Get(ctx, "user:42")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []byte("rose"), v)
+	assert.NoError(t, c.Delete(ctx, "user:42"))
+	_, ok, _ = c.Get(ctx, "user:42")
+	assert.False(t, ok)
+
+	broken := Wrap("broken", Funcs{SetFunc: func(context.Context, string, interface{}, time.Duration) error {
+		return errors.New("out of memory")
+	}})
+	broken.RecordKeys = true
+	assert.Error(t, broken.Set(ctx, "user:42", struct{}{}, 0))
+	_, ok, err = broken.Get(ctx, "user:42")
+	assert.False(t, ok)
+	assert.NoError(t, err)
+	root.Send()
+
+	events := mo.Events()
+	if !assert.Len(t, events, 7) {
+		return
+	}
+	set, hit, del, miss, failed := events[0].Data, events[1].Data, events[2].Data, events[3].Data, events[4].Data
+	assert.Equal(t, "cache.set", set["name"])
+	assert.Equal(t, "sessions", set["cache.name"])
+	assert.Equal(t, 4, set["cache.value_bytes"])
+	assert.Equal(t, 60000.0, set["cache.ttl_ms"])
+	assert.Nil(t, set["cache.key"], "keys are only hashed by default")
+	assert.Len(t, set["cache.key_hash"], 16)
+
+	assert.Equal(t, true, hit["cache.hit"])
+	assert.Equal(t, 4, hit["cache.value_bytes"])
+	assert.Equal(t, set["cache.key_hash"], hit["cache.key_hash"])
+	assert.Equal(t, "delete", del["cache.operation"])
+	assert.Equal(t, false, miss["cache.hit"])
+	assert.Nil(t, miss["cache.value_bytes"])
+
+	assert.Equal(t, "out of memory", failed["cache.error"])
+	assert.Equal(t, "user:42", failed["cache.key"])
+	assert.Nil(t, failed["cache.value_bytes"], "struct values have no default size")
+	assert.Nil(t, failed["cache.ttl_ms"])
+}
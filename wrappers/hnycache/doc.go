@@ -0,0 +1,32 @@
+/*
+Package hnycache records cache operations as spans, for any cache library.
+
+Summary
+
+Wrap a Store, which any cache can be adapted to in a few lines, and each
+Get, Set and Delete made through the returned Cache is a span recording the
+cache's name, a hash of the key, whether a Get hit, the size of the value
+and the TTL it was set with. Funcs adapts a cache without declaring a type;
+for ristretto, say:
+
+	sessions := hnycache.Wrap("sessions", hnycache.Funcs{
+		GetFunc: func(ctx context.Context, key string) (interface{}, bool, error) {
+			v, ok := cache.Get(key)
+			return v, ok, nil
+		},
+		SetFunc: func(ctx context.Context, key string, v interface{}, ttl time.Duration) error {
+			cache.SetWithTTL(key, v, 1, ttl)
+			return nil
+		},
+		DeleteFunc: func(ctx context.Context, key string) error {
+			cache.Del(key)
+			return nil
+		},
+	})
+	v, ok, err := sessions.Get(ctx, sessionID)
+
+Stores that report misses as errors, like bigcache's ErrEntryNotFound, should
+translate them into a false found instead so they are recorded as misses.
+
+*/
+package hnycache
@@ -0,0 +1,136 @@
+package hnydns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	beeline "github.com/honeycombio/beeline-go"
+	"github.com/honeycombio/beeline-go/trace"
+)
+
+// Resolver wraps a *net.Resolver. Like hnysql's DB, it recreates the
+// resolver's lookups rather than embedding it, so that calls which show up
+// uninstrumented fail to compile instead.
+type Resolver struct {
+	wr *net.Resolver
+	// CacheThreshold, if set, marks lookups answered faster than this with
+	// dns.cached, since answers that quick almost certainly came from a
+	// local cache, like nscd or systemd-resolved, rather than a name server.
+	CacheThreshold time.Duration
+	// Dialer is used by Dial to connect once the host is resolved. The zero
+	// Dialer is used if it is nil.
+	Dialer *net.Dialer
+}
+
+// WrapResolver wraps r, or net.DefaultResolver if r is nil.
+func WrapResolver(r *net.Resolver) *Resolver {
+	if r == nil {
+		r = net.DefaultResolver
+	}
+	return &Resolver{wr: r}
+}
+
+// LookupHost looks up host, like net.Resolver's LookupHost, in a span named
+// LookupHost.
+func (r *Resolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	span, finish := r.startSpan(ctx, "LookupHost", host)
+	addrs, err := r.wr.LookupHost(ctx, host)
+	span.AddField("dns.record_count", len(addrs))
+	finish(err)
+	return addrs, err
+}
+
+// LookupIPAddr looks up host, like net.Resolver's LookupIPAddr, in a span
+// named LookupIPAddr.
+func (r *Resolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	span, finish := r.startSpan(ctx, "LookupIPAddr", host)
+	addrs, err := r.wr.LookupIPAddr(ctx, host)
+	span.AddField("dns.record_count", len(addrs))
+	finish(err)
+	return addrs, err
+}
+
+// LookupSRV looks up the SRV records for the service, like net.Resolver's
+// LookupSRV, in a span named LookupSRV.
+func (r *Resolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	span, finish := r.startSpan(ctx, "LookupSRV", name)
+	span.AddField("dns.service", service)
+	span.AddField("dns.proto", proto)
+	cname, addrs, err := r.wr.LookupSRV(ctx, service, proto, name)
+	span.AddField("dns.record_count", len(addrs))
+	if cname != "" {
+		span.AddField("dns.cname", cname)
+	}
+	finish(err)
+	return cname, addrs, err
+}
+
+// Dial resolves the host in address with LookupIPAddr, then connects to the
+// first address that accepts, so it can be used as a transport's DialContext
+// to trace the lookups made for outbound requests.
+func (r *Resolver) Dial(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	dialer := r.Dialer
+	if dialer == nil {
+		dialer = &net.Dialer{}
+	}
+	if net.ParseIP(host) != nil {
+		return dialer.DialContext(ctx, network, address)
+	}
+	addrs, err := r.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range addrs {
+		var conn net.Conn
+		conn, err = dialer.DialContext(ctx, network, net.JoinHostPort(addr.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
+
+// startSpan starts a span for a lookup of name, returning a function that
+// records how it went and sends the span.
+func (r *Resolver) startSpan(ctx context.Context, method, name string) (*trace.Span, func(error)) {
+	start := time.Now()
+	_, span := beeline.StartSpan(ctx, method)
+	span.AddField("meta.type", "dns")
+	span.AddField("dns.name", name)
+	span.AddField("dns.source", r.source())
+	return span, func(err error) {
+		if r.CacheThreshold > 0 {
+			span.AddField("dns.cached", err == nil && time.Since(start) < r.CacheThreshold)
+		}
+		if err != nil {
+			span.AddField("dns.error", err.Error())
+			var dnsErr *net.DNSError
+			if errors.As(err, &dnsErr) {
+				span.AddField("dns.not_found", dnsErr.IsNotFound)
+				span.AddField("dns.timeout", dnsErr.IsTimeout)
+				if dnsErr.Server != "" {
+					span.AddField("dns.server", dnsErr.Server)
+				}
+			}
+		}
+		span.Send()
+	}
+}
+
+// source describes which resolver answers the lookups: Go's own, Go's with
+// a custom dial, or the system's, which on some platforms Go uses instead.
+func (r *Resolver) source() string {
+	switch {
+	case r.wr.Dial != nil:
+		return "custom"
+	case r.wr.PreferGo:
+		return "go"
+	}
+	return "system"
+}
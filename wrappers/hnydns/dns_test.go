@@ -0,0 +1,57 @@
+package hnydns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	beeline "github.com/honeycombio/beeline-go"
+	"github.com/honeycombio/libhoney-go/transmission"
+)
+
+func TestResolver(t *testing.T) {
+	mo := &transmission.MockSender{}
+	beeline.Init(beeline.Config{Transmission: mo})
+	defer beeline.Close()
+
+	ctx, span := beeline.StartSpan(context.Background(), "handler")
+	r := WrapResolver(nil)
+	r.CacheThreshold = time.Hour
+	addrs, err := r.LookupHost(ctx, "localhost")
+	assert.NoError(t, err)
+
+	broken := WrapResolver(&net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return nil, errors.New("no name servers here")
+		},
+	})
+	_, _, err = broken.LookupSRV(ctx, "http", "tcp", "flavors.example")
+	assert.Error(t, err)
+	span.Send()
+
+	events := mo.Events()
+	if !assert.Len(t, events, 3) {
+		return
+	}
+	host := events[0].Data
+	assert.Equal(t, "LookupHost", host["name"])
+	assert.Equal(t, "localhost", host["dns.name"])
+	assert.Equal(t, len(addrs), host["dns.record_count"])
+	assert.Equal(t, "system", host["dns.source"])
+	assert.Equal(t, true, host["dns.cached"])
+
+	srv := events[1].Data
+	assert.Equal(t, "LookupSRV", srv["name"])
+	assert.Equal(t, "flavors.example", srv["dns.name"])
+	assert.Equal(t, "http", srv["dns.service"])
+	assert.Equal(t, "custom", srv["dns.source"])
+	assert.Equal(t, 0, srv["dns.record_count"])
+	assert.Contains(t, srv["dns.error"], "no name servers here")
+	assert.Equal(t, false, srv["dns.not_found"])
+	assert.Nil(t, srv["dns.cached"], "CacheThreshold isn't set")
+}
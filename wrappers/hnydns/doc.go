@@ -0,0 +1,19 @@
+/*
+Package hnydns wraps `net.Resolver` to emit one span per DNS lookup.
+
+Summary
+
+DNS lookups happen inside dials, so slow or failing ones usually show up as
+unexplained time at the start of an outbound request. Wrap a resolver with
+WrapResolver and call its lookups with a context carrying a span, and each
+gets a child span recording the name looked up, how many records came back,
+which resolver answered, and how a failed lookup failed:
+
+	resolver := hnydns.WrapResolver(nil)
+	addrs, err := resolver.LookupHost(ctx, "api.example.com")
+
+To time the lookups made while dialing too, use the wrapped resolver's
+Dial method as a transport's DialContext.
+
+*/
+package hnydns
@@ -3,7 +3,9 @@ package hnyecho
 import (
 	"sync"
 
+	"github.com/honeycombio/beeline-go/trace"
 	"github.com/honeycombio/beeline-go/wrappers/common"
+	"github.com/honeycombio/beeline-go/wrappers/config"
 	"github.com/labstack/echo/v4"
 )
 
@@ -12,21 +14,41 @@ type (
 	EchoWrapper struct {
 		handlerNames map[string]string
 		once         sync.Once
+		config       config.HTTPIncomingConfig
 	}
 )
 
+// paramKeys names the route.params.<param> fields.
+var paramKeys = trace.NewKeyPrefix("route.params.")
+
 // New returns a new EchoWrapper struct
 func New() *EchoWrapper {
 	return &EchoWrapper{}
 }
 
+// NewWithConfig returns a new EchoWrapper that uses the settings in cfg.
+// Requests matching cfg.Skip are not traced, and traces for requests matching
+// cfg.Drop are not sent.
+func NewWithConfig(cfg config.HTTPIncomingConfig) *EchoWrapper {
+	return &EchoWrapper{config: cfg}
+}
+
+// NewWithOptions is a version of NewWithConfig that takes its settings as a
+// list of options; see config.HTTPOption.
+func NewWithOptions(opts ...config.HTTPOption) *EchoWrapper {
+	return NewWithConfig(config.NewHTTPIncomingConfig(opts...))
+}
+
 // Middleware returns an echo.MiddlewareFunc to be used with Echo.Use()
 func (e *EchoWrapper) Middleware() echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			r := c.Request()
+			if common.SkipRequest(r, e.config) {
+				return next(c)
+			}
 			// get a new context with our trace from the request
-			ctx, span := common.StartSpanOrTraceFromHTTP(r)
+			ctx, span := common.StartSpanOrTraceFromHTTPWithConfig(r, e.config)
 			defer span.Send()
 			// push the context with our trace and span on to the request
 			c.SetRequest(r.WithContext(ctx))
@@ -44,14 +66,20 @@ func (e *EchoWrapper) Middleware() echo.MiddlewareFunc {
 			span.AddField("route.handler", handlerName)
 			for _, name := range c.ParamNames() {
 				// add field for each path param
-				span.AddField("route.params."+name, c.Param(name))
+				span.AddField(paramKeys.Key(name), c.Param(name))
 			}
+			common.NameSpan(span, c.Request(), e.config)
+			common.EnrichSpan(span, c.Request(), e.config)
+			common.AddResponseHeaders(c.Response().Header(), c.Request(), span, e.config)
+			serverTiming := common.ServerTiming(c.Response().Header(), span, e.config)
+			c.Response().Before(serverTiming)
 
 			// invoke next middleware in chain
 			err := next(c)
+			serverTiming()
 
 			// add fields for http response code and size
-			span.AddField("response.status_code", c.Response().Status)
+			common.AddResponseStatus(span, c.Response().Status, e.config)
 			span.AddField("response.size", c.Response().Size)
 
 			return err
@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	beeline "github.com/honeycombio/beeline-go"
+	"github.com/honeycombio/beeline-go/wrappers/config"
 	libhoney "github.com/honeycombio/libhoney-go"
 	"github.com/honeycombio/libhoney-go/transmission"
 	"github.com/labstack/echo/v4"
@@ -66,3 +67,27 @@ func TestEchoMiddleware(t *testing.T) {
 func helloHandler(c echo.Context) error {
 	return c.String(http.StatusOK, "ok")
 }
+
+func TestEchoMiddlewareNameFunc(t *testing.T) {
+	// set up libhoney to catch events instead of send them
+	evCatcher := &transmission.MockSender{}
+	client, err := libhoney.NewClient(libhoney.ClientConfig{
+		APIKey:       "abcd",
+		Dataset:      "efgh",
+		APIHost:      "ijkl",
+		Transmission: evCatcher,
+	})
+	assert.Equal(t, nil, err)
+	beeline.Init(beeline.Config{Client: client})
+
+	router := echo.New()
+	router.Use(NewWithConfig(config.HTTPIncomingConfig{NameFunc: config.MethodAndRoute}).Middleware())
+	router.GET("/users/:id", func(c echo.Context) error { return c.NoContent(http.StatusNoContent) })
+	r, _ := http.NewRequest("GET", "/users/1234", nil)
+	router.ServeHTTP(httptest.NewRecorder(), r)
+
+	evs := evCatcher.Events()
+	assert.Equal(t, 1, len(evs))
+	assert.Equal(t, "GET /users/:id", evs[0].Data["name"])
+	assert.NotEqual(t, "GET /users/:id", evs[0].Data["handler.name"], "only the name should change")
+}
@@ -0,0 +1,20 @@
+/*
+Package hnyexec runs subprocesses in spans.
+
+Summary
+
+Wrap an *exec.Cmd, or create one with Command or CommandContext, and running
+it sends a span recording the command line, its exit code or the signal that
+killed it, and how much it wrote to stdout and stderr:
+
+	cmd := hnyexec.CommandContext(ctx, "convert", "in.png", "out.jpg")
+	err := cmd.Run()
+
+Arguments are passed through Redact before they are recorded, which by
+default hides the values of flags that look like they hold secrets, like
+--password=hunter2. The command's environment gets HONEYCOMB_TRACE, so a
+child process that is also instrumented with the beeline continues the trace
+in a child of the command's span.
+
+*/
+package hnyexec
@@ -0,0 +1,213 @@
+package hnyexec
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	beeline "github.com/honeycombio/beeline-go"
+	"github.com/honeycombio/beeline-go/propagation"
+	"github.com/honeycombio/beeline-go/scrub"
+	"github.com/honeycombio/beeline-go/trace"
+)
+
+// Cmd wraps an *exec.Cmd, which is embedded so that the command can be set
+// up as usual, to run it in a span. Run, Start, Wait, Output and
+// CombinedOutput are instrumented; the span covers the command from Start to
+// Wait.
+type Cmd struct {
+	*exec.Cmd
+	// Redact returns the command line to record in exec.args, given the
+	// command's Args. It defaults to DefaultRedact.
+	Redact func(args []string) []string
+
+	ctx    context.Context
+	span   *trace.Span
+	stdout *countingWriter
+	stderr *countingWriter
+}
+
+// Wrap returns cmd, which is run in a child of the span in ctx.
+func Wrap(ctx context.Context, cmd *exec.Cmd) *Cmd {
+	return &Cmd{Cmd: cmd, Redact: DefaultRedact, ctx: ctx}
+}
+
+// Command returns a command, like exec.Command, that is run in a child of
+// the span in ctx. The command isn't killed when ctx is done.
+func Command(ctx context.Context, name string, arg ...string) *Cmd {
+	return Wrap(ctx, exec.Command(name, arg...))
+}
+
+// CommandContext returns a command, like exec.CommandContext, that is run
+// in a child of the span in ctx and killed when ctx is done.
+func CommandContext(ctx context.Context, name string, arg ...string) *Cmd {
+	return Wrap(ctx, exec.CommandContext(ctx, name, arg...))
+}
+
+// DefaultRedact replaces the values of flags whose names match
+// scrub.SensitiveKeys, with dashes read as underscores, given either as
+// --flag=value or as --flag value, with scrub.DefaultReplacement.
+func DefaultRedact(args []string) []string {
+	redacted := make([]string, len(args))
+	copy(redacted, args)
+	for i := 1; i < len(redacted); i++ {
+		arg := redacted[i]
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		name := strings.TrimLeft(arg, "-")
+		if eq := strings.IndexByte(name, '='); eq >= 0 {
+			if sensitive(name[:eq]) {
+				redacted[i] = arg[:len(arg)-len(name)+eq+1] + scrub.DefaultReplacement
+			}
+			continue
+		}
+		if sensitive(name) && i+1 < len(redacted) && !strings.HasPrefix(redacted[i+1], "-") {
+			i++
+			redacted[i] = scrub.DefaultReplacement
+		}
+	}
+	return redacted
+}
+
+func sensitive(flag string) bool {
+	return scrub.SensitiveKeys.MatchString(strings.Replace(flag, "-", "_", -1))
+}
+
+// Start starts the command, like exec.Cmd's Start, in a new span. If it
+// fails, the span is sent; otherwise Wait sends it.
+func (c *Cmd) Start() error {
+	_, c.span = beeline.StartSpan(c.ctx, "exec")
+	c.span.AddField("meta.type", "exec")
+	c.span.AddField("exec.path", c.Path)
+	args := c.Args
+	if c.Redact != nil {
+		args = c.Redact(args)
+	}
+	c.span.AddField("exec.args", strings.Join(args, " "))
+	c.setTraceEnv()
+	// exec.Cmd copies both to one writer with a single goroutine only if
+	// they are the same, as with CombinedOutput, so they must stay that way
+	stdout := c.Stdout
+	if c.Stdout != nil {
+		c.stdout = &countingWriter{w: c.Stdout}
+		c.Stdout = c.stdout
+	}
+	if c.Stderr != nil {
+		if c.Stderr == stdout {
+			c.stderr = c.stdout
+		} else {
+			c.stderr = &countingWriter{w: c.Stderr}
+		}
+		c.Stderr = c.stderr
+	}
+	err := c.Cmd.Start()
+	if err != nil {
+		c.finish(err)
+		return err
+	}
+	c.span.AddField("exec.pid", c.Process.Pid)
+	return nil
+}
+
+// Wait waits for the command to exit, like exec.Cmd's Wait, and sends its
+// span.
+func (c *Cmd) Wait() error {
+	err := c.Cmd.Wait()
+	if c.span != nil {
+		c.finish(err)
+	}
+	return err
+}
+
+// Run starts the command and waits for it to exit.
+func (c *Cmd) Run() error {
+	if err := c.Start(); err != nil {
+		return err
+	}
+	return c.Wait()
+}
+
+// Output runs the command and returns its standard output, like exec.Cmd's
+// Output.
+func (c *Cmd) Output() ([]byte, error) {
+	if c.Stdout != nil {
+		return nil, errors.New("exec: Stdout already set")
+	}
+	var stdout bytes.Buffer
+	c.Stdout = &stdout
+	var stderr *bytes.Buffer
+	if c.Stderr == nil {
+		stderr = &bytes.Buffer{}
+		c.Stderr = stderr
+	}
+	err := c.Run()
+	if ee, ok := err.(*exec.ExitError); ok && stderr != nil {
+		ee.Stderr = stderr.Bytes()
+	}
+	return stdout.Bytes(), err
+}
+
+// CombinedOutput runs the command and returns its standard output and
+// standard error combined, like exec.Cmd's CombinedOutput.
+func (c *Cmd) CombinedOutput() ([]byte, error) {
+	if c.Stdout != nil {
+		return nil, errors.New("exec: Stdout already set")
+	}
+	if c.Stderr != nil {
+		return nil, errors.New("exec: Stderr already set")
+	}
+	var b bytes.Buffer
+	c.Stdout = &b
+	c.Stderr = &b
+	err := c.Run()
+	return b.Bytes(), err
+}
+
+// setTraceEnv passes the span's trace context to the command in its
+// environment, replacing any the environment already had.
+func (c *Cmd) setTraceEnv() {
+	env := c.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	c.Env = propagation.SetEnvTraceContext(env, c.span.PropagationContext())
+}
+
+// finish records how the command ended and sends its span.
+func (c *Cmd) finish(err error) {
+	span := c.span
+	c.span = nil
+	if c.stdout != nil {
+		span.AddField("exec.stdout_bytes", c.stdout.n)
+	}
+	if c.stderr != nil && c.stderr != c.stdout {
+		span.AddField("exec.stderr_bytes", c.stderr.n)
+	}
+	if c.ProcessState != nil {
+		span.AddField("exec.exit_code", c.ProcessState.ExitCode())
+		if sig := signal(c.ProcessState); sig != "" {
+			span.AddField("exec.signal", sig)
+		}
+	}
+	if err != nil {
+		span.AddField("exec.error", err.Error())
+	}
+	span.Send()
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,102 @@
+package hnyexec
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	beeline "github.com/honeycombio/beeline-go"
+	"github.com/honeycombio/beeline-go/propagation"
+	"github.com/honeycombio/libhoney-go/transmission"
+)
+
+func TestDefaultRedact(t *testing.T) {
+	assert.Equal(t,
+		[]string{"deploy", "--api-key=[REDACTED]", "--token", "[REDACTED]", "--verbose", "--region", "us-east-1", "prod"},
+		DefaultRedact([]string{"deploy", "--api-key=abc123", "--token", "s3cr3t", "--verbose", "--region", "us-east-1", "prod"}))
+	assert.Equal(t, []string{"login", "--password", "--help"}, DefaultRedact([]string{"login", "--password", "--help"}),
+		"flags without values are left alone")
+}
+
+func TestCmd(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test commands need a unix shell")
+	}
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh")
+	}
+	mo := &transmission.MockSender{}
+	beeline.Init(beeline.Config{Transmission: mo})
+	defer beeline.Close()
+
+	ctx, span := beeline.StartSpan(context.Background(), "handler")
+	var stdout, stderr bytes.Buffer
+	cmd := Command(ctx, "sh", "-c", "echo out; echo error >&2; exit 3", "--secret", "s3cr3t")
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	assert.Error(t, cmd.Run())
+	assert.Equal(t, "out\n", stdout.String())
+
+	out, err := Command(ctx, "sh", "-c", "echo $HONEYCOMB_TRACE").Output()
+	assert.NoError(t, err)
+	prop, err := propagation.UnmarshalHoneycombTraceContext(strings.TrimSpace(string(out)))
+	assert.NoError(t, err)
+
+	assert.Error(t, Command(ctx, "sh", "-c", "kill -9 $$").Run())
+	assert.Error(t, Command(ctx, "no-such-command-anywhere").Run())
+	span.Send()
+
+	events := mo.Events()
+	if !assert.Len(t, events, 5) {
+		return
+	}
+	failed := events[0].Data
+	assert.Equal(t, "exec", failed["name"])
+	assert.Equal(t, "sh -c echo out; echo error >&2; exit 3 --secret [REDACTED]", failed["exec.args"])
+	assert.Equal(t, 3, failed["exec.exit_code"])
+	assert.Equal(t, int64(4), failed["exec.stdout_bytes"])
+	assert.Equal(t, int64(6), failed["exec.stderr_bytes"])
+	assert.Contains(t, failed, "exec.pid")
+
+	echo := events[1].Data
+	if assert.NotNil(t, prop) {
+		assert.Equal(t, echo["trace.trace_id"], prop.TraceID)
+		assert.Equal(t, echo["trace.span_id"], prop.ParentID, "the child process should continue the command's span")
+	}
+	assert.Equal(t, 0, echo["exec.exit_code"])
+	assert.Nil(t, echo["exec.error"])
+
+	assert.Equal(t, "killed", events[2].Data["exec.signal"])
+	assert.Equal(t, -1, events[2].Data["exec.exit_code"])
+
+	assert.Contains(t, events[3].Data["exec.error"], "not found")
+	assert.Nil(t, events[3].Data["exec.exit_code"])
+}
+
+func TestCombinedOutput(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test commands need a unix shell")
+	}
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh")
+	}
+	mo := &transmission.MockSender{}
+	beeline.Init(beeline.Config{Transmission: mo})
+	defer beeline.Close()
+
+	ctx, span := beeline.StartSpan(context.Background(), "handler")
+	out, err := Command(ctx, "sh", "-c", "echo out; echo error >&2").CombinedOutput()
+	assert.NoError(t, err)
+	assert.Equal(t, "out\nerror\n", string(out))
+	span.Send()
+
+	events := mo.Events()
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, int64(10), events[0].Data["exec.stdout_bytes"], "combined output should be counted once")
+		assert.Nil(t, events[0].Data["exec.stderr_bytes"])
+	}
+}
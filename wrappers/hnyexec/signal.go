@@ -0,0 +1,17 @@
+//go:build !plan9
+// +build !plan9
+
+package hnyexec
+
+import (
+	"os"
+	"syscall"
+)
+
+// signal returns the name of the signal that killed the process, if one did.
+func signal(ps *os.ProcessState) string {
+	if ws, ok := ps.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return ws.Signal().String()
+	}
+	return ""
+}
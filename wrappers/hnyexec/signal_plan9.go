@@ -0,0 +1,9 @@
+package hnyexec
+
+import "os"
+
+// signal returns "", since plan9 processes exit with notes rather than
+// signals.
+func signal(ps *os.ProcessState) string {
+	return ""
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/honeycombio/beeline-go"
 	"github.com/honeycombio/beeline-go/trace"
 	"github.com/honeycombio/beeline-go/wrappers/common"
+	"github.com/honeycombio/beeline-go/wrappers/config"
 )
 
 const ginContextKey = "beeline-middleware-context"
@@ -14,9 +15,20 @@ const ginContextKey = "beeline-middleware-context"
 // Middleware wraps httprouter handlers. Since it wraps handlers with explicit
 // parameters, it can add those values to the event it generates.
 func Middleware(queryParams map[string]struct{}) gin.HandlerFunc {
+	return MiddlewareWithConfig(queryParams, config.HTTPIncomingConfig{})
+}
+
+// MiddlewareWithConfig is a version of Middleware that uses the settings in
+// cfg. Requests matching cfg.Skip are not traced, and traces for requests
+// matching cfg.Drop are not sent.
+func MiddlewareWithConfig(queryParams map[string]struct{}, cfg config.HTTPIncomingConfig) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if common.SkipRequest(c.Request, cfg) {
+			c.Next()
+			return
+		}
 		// get a new context with our trace from the request, and add common fields
-		ctx, span := common.StartSpanOrTraceFromHTTP(c.Request)
+		ctx, span := common.StartSpanOrTraceFromHTTPWithConfig(c.Request, cfg)
 		defer span.Send()
 		// Add the span context to the gin context as we need to be able to pass
 		// this context around our gin application
@@ -26,7 +38,7 @@ func Middleware(queryParams map[string]struct{}) gin.HandlerFunc {
 
 		// pull out any variables in the URL, add the thing we're matching, etc.
 		for _, param := range c.Params {
-			span.AddField("handler.vars."+param.Key, param.Value)
+			span.AddField(common.HandlerVars.Key(param.Key), param.Value)
 		}
 
 		// pull out any GET query params
@@ -34,11 +46,11 @@ func Middleware(queryParams map[string]struct{}) gin.HandlerFunc {
 			for key, value := range c.Request.URL.Query() {
 				if _, ok := queryParams[key]; ok {
 					if len(value) > 1 {
-						span.AddField("handler.query."+key, value)
+						span.AddField(common.HandlerQuery.Key(key), value)
 					} else if len(value) == 1 {
-						span.AddField("handler.query."+key, value[0])
+						span.AddField(common.HandlerQuery.Key(key), value[0])
 					} else {
-						span.AddField("handler.query."+key, nil)
+						span.AddField(common.HandlerQuery.Key(key), nil)
 					}
 				}
 			}
@@ -47,10 +59,53 @@ func Middleware(queryParams map[string]struct{}) gin.HandlerFunc {
 		name := c.HandlerName()
 		span.AddField("handler.name", name)
 		span.AddField("name", name)
+		common.NameSpan(span, c.Request, cfg)
+		common.EnrichSpan(span, c.Request, cfg)
+		common.AddResponseHeaders(c.Writer.Header(), c.Request, span, cfg)
+		if cfg.ServerTiming {
+			serverTiming := common.ServerTiming(c.Writer.Header(), span, cfg)
+			c.Writer = &beforeHeaderWriter{ResponseWriter: c.Writer, before: serverTiming}
+			defer serverTiming()
+		}
 		// Run the next function in the Middleware chain
 		c.Next()
-		span.AddField("response.status_code", c.Writer.Status())
+		common.AddResponseStatus(span, c.Writer.Status(), cfg)
+	}
+}
+
+// beforeHeaderWriter is a gin.ResponseWriter that calls before just before
+// the response header is written.
+type beforeHeaderWriter struct {
+	gin.ResponseWriter
+	before func()
+}
+
+func (w *beforeHeaderWriter) WriteHeaderNow() {
+	if !w.Written() {
+		w.before()
+	}
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *beforeHeaderWriter) Write(b []byte) (int, error) {
+	if !w.Written() {
+		w.before()
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *beforeHeaderWriter) WriteString(s string) (int, error) {
+	if !w.Written() {
+		w.before()
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *beforeHeaderWriter) Flush() {
+	if !w.Written() {
+		w.before()
 	}
+	w.ResponseWriter.Flush()
 }
 
 // StartSpan is a helper function to start a new span in a gin-gonic context
@@ -7,6 +7,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	beeline "github.com/honeycombio/beeline-go"
+	"github.com/honeycombio/beeline-go/wrappers/config"
 	libhoney "github.com/honeycombio/libhoney-go"
 	"github.com/honeycombio/libhoney-go/transmission"
 	"github.com/stretchr/testify/assert"
@@ -74,3 +75,27 @@ func TestHTTPRouterMiddlewareReturnsStatusCode(t *testing.T) {
 	assert.True(t, ok, "'status_code' field must exist on middleware generated event")
 	assert.Equal(t, http.StatusNotFound, status)
 }
+
+func TestMiddlewareWithConfigServerTiming(t *testing.T) {
+	// set up libhoney to catch events instead of send them
+	mo := &transmission.MockSender{}
+	client, err := libhoney.NewClient(libhoney.ClientConfig{
+		APIKey:       "placeholder",
+		Dataset:      "placeholder",
+		APIHost:      "placeholder",
+		Transmission: mo})
+	assert.Equal(t, nil, err)
+	beeline.Init(beeline.Config{Client: client})
+
+	router := gin.New()
+	router.Use(MiddlewareWithConfig(nil, config.HTTPIncomingConfig{ServerTiming: true}))
+	router.GET("/hello", func(c *gin.Context) { c.String(http.StatusOK, "hello") })
+	router.GET("/empty", func(_ *gin.Context) {})
+	for _, path := range []string{"/hello", "/empty"} {
+		r, _ := http.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		assert.Regexp(t, `^total;dur=\d+\.\d$`, w.Header().Get("Server-Timing"), path)
+	}
+	assert.Equal(t, 2, len(mo.Events()))
+}
@@ -6,17 +6,46 @@ import (
 	"runtime"
 	"strings"
 
+	"github.com/honeycombio/beeline-go/trace"
 	"github.com/honeycombio/beeline-go/wrappers/common"
+	"github.com/honeycombio/beeline-go/wrappers/config"
 	"goji.io/v3/middleware"
 	"goji.io/v3/pat"
 )
 
+// patKeys names the goji.pat.<var> fields.
+var patKeys = trace.NewKeyPrefix("goji.pat.")
+
 // Middleware is specifically to use with goji's router.Use() function for
 // inserting middleware
 func Middleware(handler http.Handler) http.Handler {
+	return MiddlewareWithConfig(config.HTTPIncomingConfig{})(handler)
+}
+
+// MiddlewareWithConfig returns a middleware like Middleware that uses the
+// settings in cfg, for goji's router.Use() function. Requests matching
+// cfg.Skip are not traced, and traces for requests matching cfg.Drop are not
+// sent.
+func MiddlewareWithConfig(cfg config.HTTPIncomingConfig) func(http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		return wrapHandler(handler, cfg)
+	}
+}
+
+// MiddlewareWithOptions is a version of MiddlewareWithConfig that takes its
+// settings as a list of options; see config.HTTPOption.
+func MiddlewareWithOptions(opts ...config.HTTPOption) func(http.Handler) http.Handler {
+	return MiddlewareWithConfig(config.NewHTTPIncomingConfig(opts...))
+}
+
+func wrapHandler(handler http.Handler, cfg config.HTTPIncomingConfig) http.Handler {
 	wrappedHandler := func(w http.ResponseWriter, r *http.Request) {
+		if common.SkipRequest(r, cfg) {
+			handler.ServeHTTP(w, r)
+			return
+		}
 		// get a new context with our trace from the request, and add common fields
-		ctx, span := common.StartSpanOrTraceFromHTTP(r)
+		ctx, span := common.StartSpanOrTraceFromHTTPWithConfig(r, cfg)
 		defer span.Send()
 		// push the context with our trace and span on to the request
 		r = r.WithContext(ctx)
@@ -47,18 +76,24 @@ func Middleware(handler http.Handler) http.Handler {
 				span.AddField("goji.methods", p.HTTPMethods())
 				span.AddField("goji.path_prefix", p.PathPrefix())
 				patvar := strings.TrimPrefix(p.String(), p.PathPrefix()+":")
-				span.AddField("goji.pat."+patvar, pat.Param(r, patvar))
+				span.AddField(patKeys.Key(patvar), pat.Param(r, patvar))
 			} else {
 				span.AddField("pat", "NOT pat.Pattern")
 
 			}
 		}
+		common.NameSpan(span, r, cfg)
+		common.EnrichSpan(span, r, cfg)
+		common.AddResponseHeaders(wrappedWriter.Wrapped.Header(), r, span, cfg)
+		serverTiming := common.ServerTiming(wrappedWriter.Wrapped.Header(), span, cfg)
+		wrappedWriter.BeforeHeader = serverTiming
 		// TODO get all the parameters and their values
 		handler.ServeHTTP(wrappedWriter.Wrapped, r)
+		serverTiming()
 		if wrappedWriter.Status == 0 {
 			wrappedWriter.Status = 200
 		}
-		span.AddField("response.status_code", wrappedWriter.Status)
+		common.AddResponseStatus(span, wrappedWriter.Status, cfg)
 	}
 	return http.HandlerFunc(wrappedHandler)
 }
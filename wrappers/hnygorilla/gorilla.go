@@ -6,15 +6,44 @@ import (
 	"runtime"
 
 	"github.com/gorilla/mux"
+	"github.com/honeycombio/beeline-go/trace"
 	"github.com/honeycombio/beeline-go/wrappers/common"
+	"github.com/honeycombio/beeline-go/wrappers/config"
 )
 
+// varKeys names the gorilla.vars.<var> fields.
+var varKeys = trace.NewKeyPrefix("gorilla.vars.")
+
 // Middleware is a gorilla middleware to add Honeycomb instrumentation to the
 // gorilla muxer.
 func Middleware(handler http.Handler) http.Handler {
+	return middleware(handler, config.HTTPIncomingConfig{})
+}
+
+// MiddlewareWithConfig returns a gorilla middleware like Middleware that uses
+// the settings in cfg, for use with the muxer's Use method. Requests matching
+// cfg.Skip are not traced, and traces for requests matching cfg.Drop are not
+// sent.
+func MiddlewareWithConfig(cfg config.HTTPIncomingConfig) mux.MiddlewareFunc {
+	return func(handler http.Handler) http.Handler {
+		return middleware(handler, cfg)
+	}
+}
+
+// MiddlewareWithOptions is a version of MiddlewareWithConfig that takes its
+// settings as a list of options; see config.HTTPOption.
+func MiddlewareWithOptions(opts ...config.HTTPOption) mux.MiddlewareFunc {
+	return MiddlewareWithConfig(config.NewHTTPIncomingConfig(opts...))
+}
+
+func middleware(handler http.Handler, cfg config.HTTPIncomingConfig) http.Handler {
 	wrappedHandler := func(w http.ResponseWriter, r *http.Request) {
+		if common.SkipRequest(r, cfg) {
+			handler.ServeHTTP(w, r)
+			return
+		}
 		// get a new context with our trace from the request, and add common fields
-		ctx, span := common.StartSpanOrTraceFromHTTP(r)
+		ctx, span := common.StartSpanOrTraceFromHTTPWithConfig(r, cfg)
 		defer span.Send()
 		// push the context with our trace and span on to the request
 		r = r.WithContext(ctx)
@@ -24,7 +53,7 @@ func Middleware(handler http.Handler) http.Handler {
 		// pull out any variables in the URL, add the thing we're matching, etc.
 		vars := mux.Vars(r)
 		for k, v := range vars {
-			span.AddField("gorilla.vars."+k, v)
+			span.AddField(varKeys.Key(k), v)
 		}
 		route := mux.CurrentRoute(r)
 		if route != nil {
@@ -54,11 +83,17 @@ func Middleware(handler http.Handler) http.Handler {
 				span.AddField("handler.route", path)
 			}
 		}
+		common.NameSpan(span, r, cfg)
+		common.EnrichSpan(span, r, cfg)
+		common.AddResponseHeaders(wrappedWriter.Wrapped.Header(), r, span, cfg)
+		serverTiming := common.ServerTiming(wrappedWriter.Wrapped.Header(), span, cfg)
+		wrappedWriter.BeforeHeader = serverTiming
 		handler.ServeHTTP(wrappedWriter.Wrapped, r)
+		serverTiming()
 		if wrappedWriter.Status == 0 {
 			wrappedWriter.Status = 200
 		}
-		span.AddField("response.status_code", wrappedWriter.Status)
+		common.AddResponseStatus(span, wrappedWriter.Status, cfg)
 	}
 	return http.HandlerFunc(wrappedHandler)
 }
@@ -7,6 +7,7 @@ import (
 
 	"github.com/gorilla/mux"
 	beeline "github.com/honeycombio/beeline-go"
+	"github.com/honeycombio/beeline-go/wrappers/config"
 	libhoney "github.com/honeycombio/libhoney-go"
 	"github.com/honeycombio/libhoney-go/transmission"
 	"github.com/stretchr/testify/assert"
@@ -66,3 +67,62 @@ func TestGorillaMiddleware(t *testing.T) {
 		assert.Equal(t, "testHandler", evs[1].Data["name"])
 	})
 }
+
+func TestGorillaMiddlewareNameFunc(t *testing.T) {
+	// set up libhoney to catch events instead of send them
+	mo := &transmission.MockSender{}
+	client, err := libhoney.NewClient(libhoney.ClientConfig{
+		APIKey:       "placeholder",
+		Dataset:      "placeholder",
+		APIHost:      "placeholder",
+		Transmission: mo})
+	assert.Equal(t, nil, err)
+	beeline.Init(beeline.Config{Client: client})
+
+	router := mux.NewRouter()
+	router.Use(MiddlewareWithConfig(config.HTTPIncomingConfig{
+		NameFunc: func(r *http.Request) string {
+			tmpl, _ := mux.CurrentRoute(r).GetPathTemplate()
+			return r.Method + " " + tmpl
+		},
+		Skip: config.Paths("/healthz"),
+	}))
+	router.HandleFunc("/hello/{name}", func(_ http.ResponseWriter, _ *http.Request) {})
+	router.HandleFunc("/healthz", func(_ http.ResponseWriter, _ *http.Request) {})
+
+	r, _ := http.NewRequest("GET", "/hello/pooh", nil)
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	r, _ = http.NewRequest("GET", "/healthz", nil)
+	router.ServeHTTP(httptest.NewRecorder(), r)
+
+	evs := mo.Events()
+	assert.Equal(t, 1, len(evs), "the health check should be skipped")
+	assert.Equal(t, "GET /hello/{name}", evs[0].Data["name"])
+}
+
+func TestGorillaMiddlewareWithOptions(t *testing.T) {
+	// set up libhoney to catch events instead of send them
+	mo := &transmission.MockSender{}
+	client, err := libhoney.NewClient(libhoney.ClientConfig{
+		APIKey:       "placeholder",
+		Dataset:      "placeholder",
+		APIHost:      "placeholder",
+		Transmission: mo})
+	assert.Equal(t, nil, err)
+	beeline.Init(beeline.Config{Client: client})
+
+	router := mux.NewRouter()
+	router.Use(MiddlewareWithOptions(config.WithFieldEnricher(func(r *http.Request) map[string]interface{} {
+		// enrichers run once the request has been routed
+		return map[string]interface{}{"app.user": mux.Vars(r)["name"]}
+	})))
+	router.HandleFunc("/hello/{name}", func(_ http.ResponseWriter, _ *http.Request) {})
+
+	r, _ := http.NewRequest("GET", "/hello/pooh", nil)
+	router.ServeHTTP(httptest.NewRecorder(), r)
+
+	evs := mo.Events()
+	if assert.Equal(t, 1, len(evs)) {
+		assert.Equal(t, "pooh", evs[0].Data["app.user"])
+	}
+}
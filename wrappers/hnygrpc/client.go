@@ -0,0 +1,177 @@
+package hnygrpc
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/honeycombio/beeline-go/trace"
+	"github.com/honeycombio/beeline-go/wrappers/config"
+)
+
+// UnaryClientInterceptor returns a grpc.UnaryClientInterceptor that creates a
+// span for each unary call made within a trace and passes the trace along to
+// the server in the call's metadata. Calls made outside a trace aren't
+// traced.
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return UnaryClientInterceptorWithConfig(config.GRPCOutgoingConfig{})
+}
+
+// UnaryClientInterceptorWithConfig is a version of UnaryClientInterceptor
+// that uses the settings in cfg.
+func UnaryClientInterceptorWithConfig(cfg config.GRPCOutgoingConfig) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		parent := trace.GetSpanFromContext(ctx)
+		if parent == nil {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		ctx, span := startClientSpan(ctx, parent, method, cc.Target(), cfg)
+		defer span.Send()
+		span.AddField("meta.type", "grpc_client")
+		if size, ok := messageSize(req); ok {
+			span.AddField("grpc.request_size", size)
+		}
+
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		addStatusFields(span, err)
+		if size, ok := messageSize(reply); ok && err == nil {
+			span.AddField("grpc.response_size", size)
+		}
+		return err
+	}
+}
+
+// StreamClientInterceptor returns a grpc.StreamClientInterceptor that creates
+// a span for each streaming call made within a trace, covering the whole
+// stream, and passes the trace along to the server in the call's metadata.
+// The span is sent once the stream ends, which is when a message can't be
+// received from it, so streams must be read until RecvMsg returns an error
+// (usually io.EOF) for their spans to be sent.
+func StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return StreamClientInterceptorWithConfig(config.GRPCOutgoingConfig{})
+}
+
+// StreamClientInterceptorWithConfig is a version of StreamClientInterceptor
+// that uses the settings in cfg.
+func StreamClientInterceptorWithConfig(cfg config.GRPCOutgoingConfig) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		parent := trace.GetSpanFromContext(ctx)
+		if parent == nil {
+			return streamer(ctx, desc, cc, method, opts...)
+		}
+		ctx, span := startClientSpan(ctx, parent, method, cc.Target(), cfg)
+		span.AddField("meta.type", "grpc_client_stream")
+		span.AddField("grpc.client_streaming", desc.ClientStreams)
+		span.AddField("grpc.server_streaming", desc.ServerStreams)
+
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			addStatusFields(span, err)
+			span.Send()
+			return cs, err
+		}
+		return &clientStream{ClientStream: cs, span: span, serverStreams: desc.ServerStreams}, nil
+	}
+}
+
+// DialOptions returns options for grpc.Dial that add the unary and stream
+// client interceptors, configured with cfg, to the connection's interceptor
+// chains, so they can be combined with options adding other interceptors.
+func DialOptions(cfg config.GRPCOutgoingConfig) []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(UnaryClientInterceptorWithConfig(cfg)),
+		grpc.WithChainStreamInterceptor(StreamClientInterceptorWithConfig(cfg)),
+	}
+}
+
+// clientStream is a grpc.ClientStream that sends its span when the stream
+// ends. Like serverStream, it counts the messages sent and received.
+type clientStream struct {
+	// the counts come first to keep them 64-bit aligned for atomic access on
+	// 32-bit platforms
+	received, receivedBytes, sent, sentBytes int64
+
+	grpc.ClientStream
+	span          *trace.Span
+	serverStreams bool
+	finishOnce    sync.Once
+}
+
+func (s *clientStream) SendMsg(m interface{}) error {
+	err := s.ClientStream.SendMsg(m)
+	if err == nil {
+		atomic.AddInt64(&s.sent, 1)
+		if size, ok := messageSize(m); ok {
+			atomic.AddInt64(&s.sentBytes, int64(size))
+		}
+	}
+	return err
+}
+
+func (s *clientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err == nil {
+		atomic.AddInt64(&s.received, 1)
+		if size, ok := messageSize(m); ok {
+			atomic.AddInt64(&s.receivedBytes, int64(size))
+		}
+		if !s.serverStreams {
+			// the server sends only one message, so the call is done
+			s.finish(nil)
+		}
+		return nil
+	}
+	if err == io.EOF {
+		s.finish(nil)
+	} else {
+		s.finish(err)
+	}
+	return err
+}
+
+// finish records the stream's status and counts and sends its span, the
+// first time it is called.
+func (s *clientStream) finish(err error) {
+	s.finishOnce.Do(func() {
+		addStatusFields(s.span, err)
+		s.span.AddField("grpc.messages_received", atomic.LoadInt64(&s.received))
+		s.span.AddField("grpc.messages_sent", atomic.LoadInt64(&s.sent))
+		s.span.AddField("grpc.request_size", atomic.LoadInt64(&s.sentBytes))
+		s.span.AddField("grpc.response_size", atomic.LoadInt64(&s.receivedBytes))
+		s.span.Send()
+	})
+}
+
+// startClientSpan creates a span for a call to fullMethod on target as a
+// child of parent, and adds the trace context to the call's outgoing
+// metadata.
+func startClientSpan(ctx context.Context, parent *trace.Span, fullMethod, target string, cfg config.GRPCOutgoingConfig) (context.Context, *trace.Span) {
+	ctx, span := parent.CreateChild(ctx)
+	span.AddField("name", fullMethod)
+	if i := strings.LastIndexByte(fullMethod, '/'); i > 0 {
+		span.AddField("grpc.service", fullMethod[1:i])
+		span.AddField("grpc.method", fullMethod[i+1:])
+	}
+	span.AddField("request.host", target)
+
+	var headers map[string]string
+	if cfg.GRPCPropagationHook != nil {
+		headers = cfg.GRPCPropagationHook(ctx, target, span.PropagationContext())
+	} else {
+		headers = span.PropagationHeaders(ctx)
+	}
+	if len(headers) > 0 {
+		kv := make([]string, 0, 2*len(headers))
+		for k, v := range headers {
+			// metadata keys must be lowercase
+			kv = append(kv, strings.ToLower(k), v)
+		}
+		ctx = metadata.AppendToOutgoingContext(ctx, kv...)
+	}
+	return ctx, span
+}
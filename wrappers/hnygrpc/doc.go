@@ -0,0 +1,47 @@
+// Package hnygrpc has interceptors to use with gRPC servers and clients.
+//
+// Summary
+//
+// hnygrpc has unary and stream server interceptors that start a span, or a
+// trace if the call doesn't continue one, for every call a gRPC server
+// handles. Pass them to grpc.NewServer:
+//
+//   server := grpc.NewServer(
+//     grpc.UnaryInterceptor(hnygrpc.UnaryServerInterceptor()),
+//     grpc.StreamInterceptor(hnygrpc.StreamServerInterceptor()),
+//   )
+//
+// ServerOptions adds the same interceptors to the server's interceptor chains
+// instead, so they can be combined with other interceptors:
+//
+//   opts := hnygrpc.ServerOptions(config.GRPCIncomingConfig{
+//     Skip:     config.GRPCHealthChecks,
+//     NameFunc: path.Base,
+//   })
+//   server := grpc.NewServer(append(opts,
+//     grpc.ChainUnaryInterceptor(authInterceptor),
+//   )...)
+//
+// Spans record the method called, the status returned, the sizes of the
+// messages received and sent, the call's deadline, the compression used, and
+// the client's address and TLS identity.
+//
+// Incoming traces are continued from the x-honeycomb-trace metadata key, as
+// sent by the beeline's HTTP round tripper; use a GRPCParserHook to read other
+// formats. Health checks and server reflection calls can be skipped, or
+// sampled more heavily than other calls, with the options in
+// config.GRPCIncomingConfig, which can also rename spans and add fields of
+// your own to them with Enrichers.
+//
+// The client interceptors create a span for each call made within a trace and
+// pass the trace along in the call's metadata, in the formats given by the
+// beeline's PropagationFormats or by a GRPCPropagationHook:
+//
+//   conn, err := grpc.Dial(target,
+//     grpc.WithUnaryInterceptor(hnygrpc.UnaryClientInterceptor()),
+//     grpc.WithStreamInterceptor(hnygrpc.StreamClientInterceptor()),
+//   )
+//
+// or, to combine them with other interceptors, with DialOptions.
+//
+package hnygrpc
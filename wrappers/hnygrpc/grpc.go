@@ -0,0 +1,265 @@
+package hnygrpc
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/runtime/protoiface"
+	"google.golang.org/protobuf/runtime/protoimpl"
+
+	"github.com/honeycombio/beeline-go/propagation"
+	"github.com/honeycombio/beeline-go/trace"
+	"github.com/honeycombio/beeline-go/wrappers/config"
+)
+
+// UnaryServerInterceptor returns a grpc.UnaryServerInterceptor that creates a
+// span for each unary call.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return UnaryServerInterceptorWithConfig(config.GRPCIncomingConfig{})
+}
+
+// UnaryServerInterceptorWithConfig is a version of UnaryServerInterceptor that
+// uses the settings in cfg.
+func UnaryServerInterceptorWithConfig(cfg config.GRPCIncomingConfig) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if cfg.Skip != nil && cfg.Skip(info.FullMethod) {
+			return handler(ctx, req)
+		}
+		ctx, span := startSpanOrTraceFromGRPC(ctx, info.FullMethod, cfg)
+		defer span.Send()
+		span.AddField("meta.type", "grpc_request")
+		if size, ok := messageSize(req); ok {
+			span.AddField("grpc.request_size", size)
+		}
+
+		resp, err := handler(ctx, req)
+		addStatusFields(span, err)
+		if size, ok := messageSize(resp); ok && err == nil {
+			span.AddField("grpc.response_size", size)
+		}
+		return resp, err
+	}
+}
+
+// ServerOptions returns options for grpc.NewServer that add the unary and
+// stream server interceptors, configured with cfg, to the server's
+// interceptor chains. Unlike grpc.UnaryInterceptor, which only allows one
+// interceptor, they can be combined with options adding other interceptors;
+// interceptors added by earlier options run first, so pass these first for
+// the others' work to be timed and traced.
+func ServerOptions(cfg config.GRPCIncomingConfig) []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(UnaryServerInterceptorWithConfig(cfg)),
+		grpc.ChainStreamInterceptor(StreamServerInterceptorWithConfig(cfg)),
+	}
+}
+
+// StreamServerInterceptor returns a grpc.StreamServerInterceptor that creates
+// a span for each streaming call, covering the whole stream.
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return StreamServerInterceptorWithConfig(config.GRPCIncomingConfig{})
+}
+
+// StreamServerInterceptorWithConfig is a version of StreamServerInterceptor
+// that uses the settings in cfg.
+func StreamServerInterceptorWithConfig(cfg config.GRPCIncomingConfig) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if cfg.Skip != nil && cfg.Skip(info.FullMethod) {
+			return handler(srv, ss)
+		}
+		ctx, span := startSpanOrTraceFromGRPC(ss.Context(), info.FullMethod, cfg)
+		defer span.Send()
+		span.AddField("meta.type", "grpc_stream")
+		span.AddField("grpc.client_streaming", info.IsClientStream)
+		span.AddField("grpc.server_streaming", info.IsServerStream)
+
+		wrapped := &serverStream{ServerStream: ss, ctx: ctx}
+		err := handler(srv, wrapped)
+		addStatusFields(span, err)
+		span.AddField("grpc.messages_received", atomic.LoadInt64(&wrapped.received))
+		span.AddField("grpc.messages_sent", atomic.LoadInt64(&wrapped.sent))
+		span.AddField("grpc.request_size", atomic.LoadInt64(&wrapped.receivedBytes))
+		span.AddField("grpc.response_size", atomic.LoadInt64(&wrapped.sentBytes))
+		return err
+	}
+}
+
+// serverStream is a grpc.ServerStream whose context holds the call's span.
+// It counts the messages sent and received on the stream and their sizes;
+// the counts are updated atomically, since messages may be sent and received
+// on different goroutines.
+type serverStream struct {
+	// the counts come first to keep them 64-bit aligned for atomic access on
+	// 32-bit platforms
+	received, receivedBytes, sent, sentBytes int64
+
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *serverStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		atomic.AddInt64(&s.received, 1)
+		if size, ok := messageSize(m); ok {
+			atomic.AddInt64(&s.receivedBytes, int64(size))
+		}
+	}
+	return err
+}
+
+func (s *serverStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		atomic.AddInt64(&s.sent, 1)
+		if size, ok := messageSize(m); ok {
+			atomic.AddInt64(&s.sentBytes, int64(size))
+		}
+	}
+	return err
+}
+
+// startSpanOrTraceFromGRPC creates a span for a call to fullMethod, as a child
+// of the span in ctx if there is one and as the root of a new trace if not.
+func startSpanOrTraceFromGRPC(ctx context.Context, fullMethod string, cfg config.GRPCIncomingConfig) (context.Context, *trace.Span) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	span := trace.GetSpanFromContext(ctx)
+	if span == nil {
+		var prop *propagation.PropagationContext
+		if cfg.GRPCParserHook != nil {
+			prop = cfg.GRPCParserHook(ctx)
+		} else if header := metadataValue(md, propagation.TracePropagationHTTPHeader); header != "" {
+			// metadata keys are lowercase, so this is x-honeycomb-trace
+			prop, _ = propagation.UnmarshalHoneycombTraceContext(header)
+		}
+		opts := []trace.Option{trace.WithSource(grpcSource(ctx, md))}
+		if cfg.Reduce != nil && cfg.ReducedSampleRate > 0 && cfg.Reduce(fullMethod) {
+			opts = append(opts, trace.WithSampleRate(cfg.ReducedSampleRate))
+		}
+		var tr *trace.Trace
+		ctx, tr = trace.NewTraceFromPropagationContext(ctx, prop, opts...)
+		span = tr.GetRootSpan()
+	} else {
+		ctx, span = span.CreateChild(ctx)
+	}
+	name := fullMethod
+	if cfg.NameFunc != nil {
+		if n := cfg.NameFunc(fullMethod); n != "" {
+			name = n
+		}
+	}
+	span.AddField("name", name)
+	span.AddField("handler.method", fullMethod)
+	if i := strings.LastIndexByte(fullMethod, '/'); i > 0 {
+		span.AddField("grpc.service", fullMethod[1:i])
+		span.AddField("grpc.method", fullMethod[i+1:])
+	}
+	if ct := metadataValue(md, "content-type"); ct != "" {
+		span.AddField("request.content_type", ct)
+	}
+	if ua := metadataValue(md, "user-agent"); ua != "" {
+		span.AddField("request.header.user_agent", ua)
+	}
+	if authority := metadataValue(md, ":authority"); authority != "" {
+		span.AddField("request.host", authority)
+	}
+	if encoding := metadataValue(md, "grpc-encoding"); encoding != "" {
+		span.AddField("grpc.compression", encoding)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		span.AddField("grpc.deadline_set", true)
+		span.AddField("grpc.deadline_remaining_ms", float64(time.Until(deadline))/float64(time.Millisecond))
+	} else {
+		span.AddField("grpc.deadline_set", false)
+	}
+	addPeerFields(ctx, span)
+	for _, enrich := range cfg.Enrichers {
+		for k, v := range enrich(ctx, fullMethod) {
+			span.AddField(k, v)
+		}
+	}
+	return ctx, span
+}
+
+// grpcSource describes the peer and metadata of the incoming call in ctx for
+// the beeline's TrustPolicy.
+func grpcSource(ctx context.Context, md metadata.MD) *propagation.Source {
+	src := &propagation.Source{
+		Header: func(name string) string { return metadataValue(md, name) },
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		src.RemoteAddr = p.Addr.String()
+	}
+	return src
+}
+
+// addPeerFields records the address of the call's client, and its identity if
+// it connected with TLS.
+func addPeerFields(ctx context.Context, span *trace.Span) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return
+	}
+	if p.Addr != nil {
+		span.AddField("request.remote_addr", p.Addr.String())
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return
+	}
+	span.AddField("request.tls.version", config.TLSVersionName(tlsInfo.State.Version))
+	span.AddField("request.tls.cipher_suite", config.TLSCipherSuiteName(tlsInfo.State.CipherSuite))
+	if certs := tlsInfo.State.PeerCertificates; len(certs) > 0 {
+		span.AddField("request.tls.client_subject", certs[0].Subject.String())
+	}
+	if tlsInfo.SPIFFEID != nil {
+		span.AddField("request.tls.spiffe_id", tlsInfo.SPIFFEID.String())
+	}
+}
+
+// messageSize returns the encoded size of the protobuf message m. It reports
+// false if m isn't a protobuf message.
+func messageSize(m interface{}) (int, bool) {
+	switch msg := m.(type) {
+	case nil:
+		return 0, false
+	case proto.Message:
+		return proto.Size(msg), true
+	case protoiface.MessageV1:
+		return proto.Size(protoimpl.X.ProtoMessageV2Of(msg)), true
+	case interface{ Size() int }:
+		// gogo/protobuf messages
+		return msg.Size(), true
+	}
+	return 0, false
+}
+
+// addStatusFields records the gRPC status of a call that returned err.
+func addStatusFields(span *trace.Span, err error) {
+	st := status.Convert(err)
+	span.AddField("response.grpc_status_code", int(st.Code()))
+	span.AddField("response.grpc_status", st.Code().String())
+	if err != nil {
+		span.AddField("response.grpc_status_message", st.Message())
+	}
+}
+
+// metadataValue returns the first value of key in md, or "" if it has none.
+func metadataValue(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
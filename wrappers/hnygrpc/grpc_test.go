@@ -0,0 +1,367 @@
+package hnygrpc
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	beeline "github.com/honeycombio/beeline-go"
+	"github.com/honeycombio/beeline-go/propagation"
+	"github.com/honeycombio/beeline-go/trace"
+	"github.com/honeycombio/beeline-go/wrappers/config"
+	libhoney "github.com/honeycombio/libhoney-go"
+	"github.com/honeycombio/libhoney-go/transmission"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupLibhoney(t *testing.T) *transmission.MockSender {
+	mo := &transmission.MockSender{}
+	client, err := libhoney.NewClient(libhoney.ClientConfig{
+		APIKey:       "placeholder",
+		Dataset:      "placeholder",
+		APIHost:      "placeholder",
+		Transmission: mo})
+	assert.Equal(t, nil, err)
+	beeline.Init(beeline.Config{Client: client})
+	return mo
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	mo := setupLibhoney(t)
+	md := metadata.Pairs(
+		"x-honeycomb-trace", "1;trace_id=abcdef,parent_id=123456",
+		"user-agent", "grpc-go/1.31.0",
+		"content-type", "application/grpc",
+	)
+	ctx := metadata.NewIncomingContext(context.Background(), md)
+	info := &grpc.UnaryServerInfo{FullMethod: "/hello.Greeter/SayHello"}
+	var handlerSpan *trace.Span
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		handlerSpan = trace.GetSpanFromContext(ctx)
+		return nil, status.Error(codes.NotFound, "no such greeting")
+	}
+	_, err := UnaryServerInterceptor()(ctx, nil, info, handler)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.NotNil(t, handlerSpan)
+
+	evs := mo.Events()
+	assert.Equal(t, 1, len(evs))
+	fields := evs[0].Data
+	assert.Equal(t, "/hello.Greeter/SayHello", fields["name"])
+	assert.Equal(t, "hello.Greeter", fields["grpc.service"])
+	assert.Equal(t, "SayHello", fields["grpc.method"])
+	assert.Equal(t, "abcdef", fields["trace.trace_id"])
+	assert.Equal(t, "123456", fields["trace.parent_id"])
+	assert.Equal(t, "grpc-go/1.31.0", fields["request.header.user_agent"])
+	assert.Equal(t, int(codes.NotFound), fields["response.grpc_status_code"])
+	assert.Equal(t, "no such greeting", fields["response.grpc_status_message"])
+}
+
+func TestServerInterceptorsSkipAndReduce(t *testing.T) {
+	mo := setupLibhoney(t)
+	cfg := config.GRPCIncomingConfig{
+		Skip:              config.GRPCHealthChecks,
+		Reduce:            config.GRPCReflection,
+		ReducedSampleRate: 1 << 30,
+	}
+	unary := UnaryServerInterceptorWithConfig(cfg)
+	var traced bool
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		traced = trace.GetSpanFromContext(ctx) != nil
+		return nil, nil
+	}
+	unary(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/grpc.health.v1.Health/Check"}, handler)
+	assert.False(t, traced, "health checks should be skipped")
+	assert.Equal(t, 0, len(mo.Events()))
+
+	stream := StreamServerInterceptorWithConfig(cfg)
+	ss := &fakeServerStream{ctx: context.Background()}
+	streamInfo := &grpc.StreamServerInfo{FullMethod: "/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo", IsClientStream: true, IsServerStream: true}
+	for i := 0; i < 10; i++ {
+		stream(nil, ss, streamInfo, func(srv interface{}, ss grpc.ServerStream) error {
+			traced = trace.GetSpanFromContext(ss.Context()) != nil
+			return nil
+		})
+		assert.True(t, traced, "reduced calls should still be traced")
+	}
+	assert.Equal(t, 0, len(mo.Events()), "almost no reflection calls should be kept at this sample rate")
+
+	streamInfo.FullMethod = "/hello.Greeter/SayHellos"
+	stream(nil, ss, streamInfo, func(srv interface{}, ss grpc.ServerStream) error { return nil })
+	evs := mo.Events()
+	if assert.Equal(t, 1, len(evs)) {
+		assert.Equal(t, "grpc_stream", evs[0].Data["meta.type"])
+		assert.Equal(t, true, evs[0].Data["grpc.client_streaming"])
+		assert.Equal(t, "OK", evs[0].Data["response.grpc_status"])
+	}
+}
+
+func TestServerInterceptorNameAndEnrichers(t *testing.T) {
+	mo := setupLibhoney(t)
+	cfg := config.GRPCIncomingConfig{
+		NameFunc: func(fullMethod string) string {
+			if fullMethod == "/hello.Greeter/SayHello" {
+				return "greet"
+			}
+			return ""
+		},
+		Enrichers: []config.GRPCFieldEnricher{
+			func(ctx context.Context, fullMethod string) map[string]interface{} {
+				md, _ := metadata.FromIncomingContext(ctx)
+				return map[string]interface{}{"app.tenant": metadataValue(md, "tenant"), "app.version": 1}
+			},
+			func(ctx context.Context, fullMethod string) map[string]interface{} {
+				return map[string]interface{}{"app.version": 2}
+			},
+		},
+	}
+	unary := UnaryServerInterceptorWithConfig(cfg)
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("tenant", "acme"))
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) { return nil, nil }
+	unary(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/hello.Greeter/SayHello"}, handler)
+	unary(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/hello.Greeter/SayGoodbye"}, handler)
+
+	evs := mo.Events()
+	if assert.Equal(t, 2, len(evs)) {
+		assert.Equal(t, "greet", evs[0].Data["name"])
+		assert.Equal(t, "/hello.Greeter/SayHello", evs[0].Data["handler.method"])
+		assert.Equal(t, "acme", evs[0].Data["app.tenant"])
+		assert.Equal(t, 2, evs[0].Data["app.version"], "later enrichers should win")
+		assert.Equal(t, "/hello.Greeter/SayGoodbye", evs[1].Data["name"], "an empty name should keep the full method")
+	}
+}
+
+func TestServerOptionsChain(t *testing.T) {
+	mo := setupLibhoney(t)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// an interceptor chained after the beeline's should see its span
+	var inner *trace.Span
+	after := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		inner = trace.GetSpanFromContext(ctx)
+		return handler(ctx, req)
+	}
+	opts := append(ServerOptions(config.GRPCIncomingConfig{}), grpc.ChainUnaryInterceptor(after))
+	server := grpc.NewServer(opts...)
+	server.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "hello.Greeter",
+		HandlerType: (*interface{})(nil),
+		Methods: []grpc.MethodDesc{{
+			MethodName: "SayHello",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				req := &wrapperspb.StringValue{}
+				if err := dec(req); err != nil {
+					return nil, err
+				}
+				info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/hello.Greeter/SayHello"}
+				return interceptor(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+					return wrapperspb.String("hello"), nil
+				})
+			},
+		}},
+	}, struct{}{})
+	go server.Serve(lis)
+	defer server.Stop()
+
+	cc, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cc.Close()
+	resp := &wrapperspb.StringValue{}
+	err = cc.Invoke(context.Background(), "/hello.Greeter/SayHello", wrapperspb.String("me"), resp)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", resp.Value)
+	assert.NotNil(t, inner)
+
+	evs := mo.Events()
+	if assert.Equal(t, 1, len(evs)) {
+		assert.Equal(t, "/hello.Greeter/SayHello", evs[0].Data["name"])
+		assert.Equal(t, "OK", evs[0].Data["response.grpc_status"])
+	}
+}
+
+func TestServerInterceptorMessageFields(t *testing.T) {
+	mo := setupLibhoney(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("grpc-encoding", "gzip"))
+	ctx = peer.NewContext(ctx, &peer.Peer{
+		Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 5000},
+		AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{
+			Version:          tls.VersionTLS13,
+			PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "client"}}},
+		}},
+	})
+	info := &grpc.UnaryServerInfo{FullMethod: "/hello.Greeter/SayHello"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return wrapperspb.String("hello, world"), nil
+	}
+	UnaryServerInterceptor()(ctx, wrapperspb.String("hello"), info, handler)
+
+	ss := &fakeServerStream{ctx: context.Background(), recv: []proto.Message{wrapperspb.Int64(1), wrapperspb.Int64(300)}}
+	streamInfo := &grpc.StreamServerInfo{FullMethod: "/hello.Greeter/SayHellos", IsClientStream: true}
+	StreamServerInterceptor()(nil, ss, streamInfo, func(srv interface{}, ss grpc.ServerStream) error {
+		for ss.RecvMsg(&wrapperspb.Int64Value{}) == nil {
+		}
+		return ss.SendMsg(wrapperspb.String("done"))
+	})
+
+	evs := mo.Events()
+	assert.Equal(t, 2, len(evs))
+	fields := evs[0].Data
+	assert.Equal(t, 7, fields["grpc.request_size"])
+	assert.Equal(t, 14, fields["grpc.response_size"])
+	assert.Equal(t, true, fields["grpc.deadline_set"])
+	remaining := fields["grpc.deadline_remaining_ms"].(float64)
+	assert.True(t, remaining > 0 && remaining <= 60000, "%v", remaining)
+	assert.Equal(t, "gzip", fields["grpc.compression"])
+	assert.Equal(t, "10.0.0.1:5000", fields["request.remote_addr"])
+	assert.Equal(t, "1.3", fields["request.tls.version"])
+	assert.Equal(t, "CN=client", fields["request.tls.client_subject"])
+
+	fields = evs[1].Data
+	assert.Equal(t, false, fields["grpc.deadline_set"])
+	assert.Equal(t, int64(2), fields["grpc.messages_received"])
+	assert.Equal(t, int64(1), fields["grpc.messages_sent"])
+	assert.Equal(t, int64(5), fields["grpc.request_size"])
+	assert.Equal(t, int64(6), fields["grpc.response_size"])
+}
+
+// fakeServerStream is a grpc.ServerStream that receives the messages in recv
+// and discards the messages sent to it.
+type fakeServerStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	recv []proto.Message
+}
+
+func (s *fakeServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *fakeServerStream) RecvMsg(m interface{}) error {
+	if len(s.recv) == 0 {
+		return io.EOF
+	}
+	proto.Merge(m.(proto.Message), s.recv[0])
+	s.recv = s.recv[1:]
+	return nil
+}
+
+func (s *fakeServerStream) SendMsg(m interface{}) error {
+	return nil
+}
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	mo := setupLibhoney(t)
+	cc, err := grpc.Dial("passthrough:///users:443", grpc.WithInsecure())
+	assert.NoError(t, err)
+	defer cc.Close()
+
+	var md metadata.MD
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		md, _ = metadata.FromOutgoingContext(ctx)
+		proto.Merge(reply.(proto.Message), wrapperspb.String("hello, world"))
+		return nil
+	}
+	cfg := config.GRPCOutgoingConfig{
+		GRPCPropagationHook: config.GRPCPropagateFormats(propagation.FormatHoneycomb, propagation.FormatW3C),
+	}
+	interceptor := UnaryClientInterceptorWithConfig(cfg)
+
+	err = interceptor(context.Background(), "/hello.Greeter/SayHello", wrapperspb.String("hello"), &wrapperspb.StringValue{}, cc, invoker)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(mo.Events()), "calls outside a trace shouldn't be traced")
+	assert.Empty(t, md.Get("x-honeycomb-trace"))
+
+	ctx, span := beeline.StartSpan(context.Background(), "parent")
+	err = interceptor(ctx, "/hello.Greeter/SayHello", wrapperspb.String("hello"), &wrapperspb.StringValue{}, cc, invoker)
+	assert.NoError(t, err)
+	span.Send()
+
+	hny, err := propagation.UnmarshalHoneycombTraceContext(metadataValue(md, "x-honeycomb-trace"))
+	assert.NoError(t, err)
+	_, w3c, err := propagation.UnmarshalW3CTraceContext(context.Background(), map[string]string{"traceparent": metadataValue(md, "traceparent")})
+	assert.NoError(t, err)
+	assert.Equal(t, hny.TraceID, w3c.TraceID, "metadata should identify the same trace")
+	assert.Equal(t, hny.ParentID, w3c.ParentID, "metadata should identify the same parent")
+
+	evs := mo.Events()
+	assert.Equal(t, 2, len(evs))
+	fields := evs[0].Data
+	assert.Equal(t, hny.ParentID, fields["trace.span_id"])
+	assert.Equal(t, "/hello.Greeter/SayHello", fields["name"])
+	assert.Equal(t, "grpc_client", fields["meta.type"])
+	assert.Equal(t, "passthrough:///users:443", fields["request.host"])
+	assert.Equal(t, "OK", fields["response.grpc_status"])
+	assert.Equal(t, 7, fields["grpc.request_size"])
+	assert.Equal(t, 14, fields["grpc.response_size"])
+}
+
+func TestStreamClientInterceptor(t *testing.T) {
+	mo := setupLibhoney(t)
+	cc, err := grpc.Dial("passthrough:///users:443", grpc.WithInsecure())
+	assert.NoError(t, err)
+	defer cc.Close()
+
+	var md metadata.MD
+	streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		md, _ = metadata.FromOutgoingContext(ctx)
+		return &fakeClientStream{recv: []proto.Message{wrapperspb.Int64(1), wrapperspb.Int64(300)}}, nil
+	}
+	ctx, span := beeline.StartSpan(context.Background(), "parent")
+	desc := &grpc.StreamDesc{ServerStreams: true}
+	cs, err := StreamClientInterceptor()(ctx, desc, cc, "/hello.Greeter/ListHellos", streamer)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, metadataValue(md, "x-honeycomb-trace"), "the Honeycomb header should be sent by default")
+	assert.NoError(t, cs.SendMsg(wrapperspb.String("hi")))
+	for cs.RecvMsg(&wrapperspb.Int64Value{}) == nil {
+	}
+	assert.Equal(t, 1, len(mo.Events()), "the span should be sent when the stream ends")
+	span.Send()
+
+	fields := mo.Events()[0].Data
+	assert.Equal(t, "grpc_client_stream", fields["meta.type"])
+	assert.Equal(t, "OK", fields["response.grpc_status"])
+	assert.Equal(t, int64(2), fields["grpc.messages_received"])
+	assert.Equal(t, int64(1), fields["grpc.messages_sent"])
+	assert.Equal(t, int64(4), fields["grpc.request_size"])
+	assert.Equal(t, int64(5), fields["grpc.response_size"])
+}
+
+// fakeClientStream is a grpc.ClientStream that receives the messages in recv
+// and discards the messages sent to it.
+type fakeClientStream struct {
+	grpc.ClientStream
+	recv []proto.Message
+}
+
+func (s *fakeClientStream) RecvMsg(m interface{}) error {
+	if len(s.recv) == 0 {
+		return io.EOF
+	}
+	proto.Merge(m.(proto.Message), s.recv[0])
+	s.recv = s.recv[1:]
+	return nil
+}
+
+func (s *fakeClientStream) SendMsg(m interface{}) error {
+	return nil
+}
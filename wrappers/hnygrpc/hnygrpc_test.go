@@ -0,0 +1,66 @@
+package hnygrpc
+
+import (
+	"context"
+	"path"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/honeycombio/beeline-go/propagation"
+	"github.com/honeycombio/beeline-go/wrappers/config"
+)
+
+func ExampleUnaryServerInterceptorWithConfig() {
+	cfg := config.GRPCIncomingConfig{
+		// don't trace health checks at all
+		Skip: config.GRPCHealthChecks,
+		// keep one in 100 traces of server reflection calls
+		Reduce:            config.GRPCReflection,
+		ReducedSampleRate: 100,
+	}
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(UnaryServerInterceptorWithConfig(cfg)),
+		grpc.StreamInterceptor(StreamServerInterceptorWithConfig(cfg)),
+	)
+	_ = server
+}
+
+func ExampleServerOptions() {
+	opts := ServerOptions(config.GRPCIncomingConfig{
+		Skip: config.GRPCHealthChecks,
+		// name spans after the method alone, without the service
+		NameFunc: path.Base,
+		// tag every call with the tenant it was made for
+		Enrichers: []config.GRPCFieldEnricher{
+			func(ctx context.Context, fullMethod string) map[string]interface{} {
+				md, _ := metadata.FromIncomingContext(ctx)
+				return map[string]interface{}{"app.tenant": md.Get("tenant")}
+			},
+		},
+	})
+	// the beeline's interceptors run first, so the span covers the others
+	server := grpc.NewServer(append(opts,
+		grpc.ChainUnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			// check the caller's credentials here
+			return handler(ctx, req)
+		}),
+	)...)
+	_ = server
+}
+
+func ExampleUnaryClientInterceptorWithConfig() {
+	// send both Honeycomb and W3C trace context to the users service while it
+	// moves to W3C, and only Honeycomb trace context elsewhere
+	cfg := config.GRPCOutgoingConfig{
+		GRPCPropagationHook: config.GRPCPropagateByTarget(map[string][]propagation.Format{
+			"users:443": {propagation.FormatHoneycomb, propagation.FormatW3C},
+		}, propagation.FormatHoneycomb),
+	}
+	conn, err := grpc.Dial("users:443",
+		grpc.WithInsecure(),
+		grpc.WithUnaryInterceptor(UnaryClientInterceptorWithConfig(cfg)),
+		grpc.WithStreamInterceptor(StreamClientInterceptorWithConfig(cfg)),
+	)
+	_, _ = conn, err
+}
@@ -6,15 +6,27 @@ import (
 	"runtime"
 
 	"github.com/honeycombio/beeline-go/wrappers/common"
+	"github.com/honeycombio/beeline-go/wrappers/config"
 	"github.com/julienschmidt/httprouter"
 )
 
 // Middleware wraps httprouter handlers. Since it wraps handlers with explicit
 // parameters, it can add those values to the event it generates.
 func Middleware(handle httprouter.Handle) httprouter.Handle {
+	return MiddlewareWithConfig(handle, config.HTTPIncomingConfig{})
+}
+
+// MiddlewareWithConfig is a version of Middleware that uses the settings in
+// cfg. Requests matching cfg.Skip are not traced, and traces for requests
+// matching cfg.Drop are not sent.
+func MiddlewareWithConfig(handle httprouter.Handle, cfg config.HTTPIncomingConfig) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if common.SkipRequest(r, cfg) {
+			handle(w, r, ps)
+			return
+		}
 		// get a new context with our trace from the request, and add common fields
-		ctx, span := common.StartSpanOrTraceFromHTTP(r)
+		ctx, span := common.StartSpanOrTraceFromHTTPWithConfig(r, cfg)
 		defer span.Send()
 		// push the context with our trace and span on to the request
 		r = r.WithContext(ctx)
@@ -24,17 +36,29 @@ func Middleware(handle httprouter.Handle) httprouter.Handle {
 
 		// pull out any variables in the URL, add the thing we're matching, etc.
 		for _, param := range ps {
-			span.AddField("handler.vars."+param.Key, param.Value)
+			span.AddField(common.HandlerVars.Key(param.Key), param.Value)
 		}
 		name := runtime.FuncForPC(reflect.ValueOf(handle).Pointer()).Name()
 		span.AddField("handler.name", name)
 		span.AddField("name", name)
+		common.NameSpan(span, r, cfg)
+		common.EnrichSpan(span, r, cfg)
+		common.AddResponseHeaders(wrappedWriter.Wrapped.Header(), r, span, cfg)
+		serverTiming := common.ServerTiming(wrappedWriter.Wrapped.Header(), span, cfg)
+		wrappedWriter.BeforeHeader = serverTiming
 
 		handle(wrappedWriter.Wrapped, r, ps)
+		serverTiming()
 
 		if wrappedWriter.Status == 0 {
 			wrappedWriter.Status = 200
 		}
-		span.AddField("response.status_code", wrappedWriter.Status)
+		common.AddResponseStatus(span, wrappedWriter.Status, cfg)
 	}
 }
+
+// MiddlewareWithOptions is a version of MiddlewareWithConfig that takes its
+// settings as a list of options; see config.HTTPOption.
+func MiddlewareWithOptions(handle httprouter.Handle, opts ...config.HTTPOption) httprouter.Handle {
+	return MiddlewareWithConfig(handle, config.NewHTTPIncomingConfig(opts...))
+}
@@ -0,0 +1,30 @@
+/*
+Package hnyio records file and blob storage transfers as spans.
+
+Summary
+
+Uploads to and downloads from blob stores like S3 and GCS show up as opaque
+HTTP spans, if at all, and streamed transfers keep going long after the
+request that started them returns. WrapReadCloser and WrapWriteCloser give a
+stream its own span, sent when it is closed, with the bytes transferred, the
+throughput and the operation in io.bytes, io.throughput_bytes_per_sec and
+io.operation.
+
+Upload, Download and NewWriter fit the usual shapes of blob SDK calls and
+add the bucket and key. With the S3 upload manager, say:
+
+	err := hnyio.Upload(ctx, bucket, key, file, func(ctx context.Context, r io.Reader) error {
+		_, err := uploader.UploadWithContext(ctx, &s3manager.UploadInput{
+			Bucket: &bucket, Key: &key, Body: r,
+		})
+		return err
+	})
+
+and with GCS:
+
+	w := hnyio.NewWriter(ctx, bucket, key, func(ctx context.Context) io.WriteCloser {
+		return client.Bucket(bucket).Object(key).NewWriter(ctx)
+	})
+
+*/
+package hnyio
@@ -0,0 +1,184 @@
+package hnyio
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	beeline "github.com/honeycombio/beeline-go"
+	"github.com/honeycombio/beeline-go/trace"
+)
+
+// Operations recorded in io.operation by the blob helpers.
+const (
+	OpUpload   = "upload"
+	OpDownload = "download"
+)
+
+// WrapReadCloser returns rc in a span named op, an async child of the span in
+// ctx, that is sent when the returned reader is closed.
+func WrapReadCloser(ctx context.Context, rc io.ReadCloser, op string) io.ReadCloser {
+	_, span := startStreamSpan(ctx, op)
+	return &readCloser{rc: rc, t: newTransfer(span, op)}
+}
+
+// WrapWriteCloser returns wc in a span named op, an async child of the span in
+// ctx, that is sent when the returned writer is closed.
+func WrapWriteCloser(ctx context.Context, wc io.WriteCloser, op string) io.WriteCloser {
+	_, span := startStreamSpan(ctx, op)
+	return &writeCloser{wc: wc, t: newTransfer(span, op)}
+}
+
+// Upload calls upload with a context carrying an upload span and a reader
+// counting the bytes it reads from r, for SDK calls like the S3 upload
+// manager's that read the object from an io.Reader.
+func Upload(ctx context.Context, bucket, key string, r io.Reader, upload func(context.Context, io.Reader) error) error {
+	ctx, span := beeline.StartSpan(ctx, OpUpload)
+	t := newTransfer(span, OpUpload)
+	addObject(span, bucket, key)
+	err := upload(ctx, &reader{r: r, t: t})
+	t.finish(err)
+	return err
+}
+
+// Download calls open with a context carrying a download span, for SDK calls
+// like S3's GetObject and GCS's NewReader that return the object as an
+// io.ReadCloser. The span is sent when the returned reader is closed, or when
+// open fails. Like the spans of the other helpers returning a reader or
+// writer, it is an async child, since it usually outlives the call.
+func Download(ctx context.Context, bucket, key string, open func(context.Context) (io.ReadCloser, error)) (io.ReadCloser, error) {
+	ctx, span := startStreamSpan(ctx, OpDownload)
+	t := newTransfer(span, OpDownload)
+	addObject(span, bucket, key)
+	rc, err := open(ctx)
+	if err != nil {
+		t.finish(err)
+		return nil, err
+	}
+	return &readCloser{rc: rc, t: t}, nil
+}
+
+// NewWriter calls open with a context carrying an upload span, for SDK calls
+// like GCS's NewWriter that return an io.WriteCloser the object is written
+// to. The span is sent when the returned writer is closed.
+func NewWriter(ctx context.Context, bucket, key string, open func(context.Context) io.WriteCloser) io.WriteCloser {
+	ctx, span := startStreamSpan(ctx, OpUpload)
+	t := newTransfer(span, OpUpload)
+	addObject(span, bucket, key)
+	return &writeCloser{wc: open(ctx), t: t}
+}
+
+// startStreamSpan starts a span named name for a reader or writer that is
+// closed after the function starting it returns. It is an async child of the
+// span in ctx, so sending that span first doesn't send this one before the
+// transfer is done; with no span in ctx it starts a trace.
+func startStreamSpan(ctx context.Context, name string) (context.Context, *trace.Span) {
+	parent := trace.GetSpanFromContext(ctx)
+	if parent == nil {
+		return beeline.StartSpan(ctx, name)
+	}
+	ctx, span := parent.CreateAsyncChild(ctx)
+	span.AddField("name", name)
+	return ctx, span
+}
+
+func addObject(span *trace.Span, bucket, key string) {
+	span.AddField("blob.bucket", bucket)
+	span.AddField("blob.key", key)
+}
+
+// transfer counts the bytes moved in a span, and sends the span once.
+type transfer struct {
+	span  *trace.Span
+	start time.Time
+
+	lock  sync.Mutex
+	bytes int64
+	err   error
+	done  bool
+}
+
+func newTransfer(span *trace.Span, op string) *transfer {
+	span.AddField("io.operation", op)
+	return &transfer{span: span, start: time.Now()}
+}
+
+// add counts n bytes moved, and remembers err if it's the first that isn't
+// io.EOF.
+func (t *transfer) add(n int, err error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.bytes += int64(n)
+	if err != nil && err != io.EOF && t.err == nil {
+		t.err = err
+	}
+}
+
+// finish records the transfer and sends its span, if it hasn't already.
+func (t *transfer) finish(err error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.done {
+		return
+	}
+	t.done = true
+	if t.err == nil {
+		t.err = err
+	}
+	t.span.AddField("io.bytes", t.bytes)
+	if elapsed := time.Since(t.start); elapsed > 0 {
+		t.span.AddField("io.throughput_bytes_per_sec", float64(t.bytes)/elapsed.Seconds())
+	}
+	if t.err != nil {
+		t.span.AddField("io.error", t.err.Error())
+	}
+	t.span.Send()
+}
+
+type reader struct {
+	r io.Reader
+	t *transfer
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.t.add(n, err)
+	return n, err
+}
+
+type readCloser struct {
+	rc io.ReadCloser
+	t  *transfer
+}
+
+func (r *readCloser) Read(p []byte) (int, error) {
+	n, err := r.rc.Read(p)
+	r.t.add(n, err)
+	return n, err
+}
+
+func (r *readCloser) Close() error {
+	err := r.rc.Close()
+	r.t.finish(err)
+	return err
+}
+
+type writeCloser struct {
+	wc io.WriteCloser
+	t  *transfer
+}
+
+func (w *writeCloser) Write(p []byte) (int, error) {
+	n, err := w.wc.Write(p)
+	w.t.add(n, err)
+	return n, err
+}
+
+// Close closes the wrapped writer, which for blob SDKs usually finishes the
+// upload, so its error is the upload's.
+func (w *writeCloser) Close() error {
+	err := w.wc.Close()
+	w.t.finish(err)
+	return err
+}
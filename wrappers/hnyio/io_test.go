@@ -0,0 +1,102 @@
+package hnyio
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	beeline "github.com/honeycombio/beeline-go"
+	"github.com/honeycombio/libhoney-go/transmission"
+)
+
+type nopWriteCloser struct {
+	io.Writer
+	err error
+}
+
+func (w nopWriteCloser) Close() error { return w.err }
+
+func TestTransfers(t *testing.T) {
+	mo := &transmission.MockSender{}
+	beeline.Init(beeline.Config{Transmission: mo})
+	defer beeline.Close()
+
+	ctx, span := beeline.StartSpan(context.Background(), "handler")
+
+	rc := WrapReadCloser(ctx, ioutil.NopCloser(strings.NewReader("rose petals")), "read")
+	b, err := ioutil.ReadAll(rc)
+	assert.NoError(t, err)
+	assert.Equal(t, "rose petals", string(b))
+	rc.Close()
+	rc.Close()
+
+	var buf bytes.Buffer
+	wc := WrapWriteCloser(ctx, nopWriteCloser{Writer: &buf}, "write")
+	io.WriteString(wc, "mint")
+	wc.Close()
+
+	err = Upload(ctx, "flavors", "fig.txt", strings.NewReader("fig jam"), func(ctx context.Context, r io.Reader) error {
+		_, err := ioutil.ReadAll(r)
+		return err
+	})
+	assert.NoError(t, err)
+
+	_, err = Download(ctx, "flavors", "missing.txt", func(context.Context) (io.ReadCloser, error) {
+		return nil, errors.New("no such key")
+	})
+	assert.Error(t, err)
+
+	w := NewWriter(ctx, "flavors", "lime.txt", func(context.Context) io.WriteCloser {
+		return nopWriteCloser{Writer: ioutil.Discard, err: errors.New("quota exceeded")}
+	})
+	io.WriteString(w, "lime")
+	assert.Error(t, w.Close())
+	span.Send()
+
+	events := mo.Events()
+	if !assert.Len(t, events, 6, "each transfer's span should be sent once") {
+		return
+	}
+	read, write, upload, download, gcs := events[0].Data, events[1].Data, events[2].Data, events[3].Data, events[4].Data
+	assert.Equal(t, "read", read["io.operation"])
+	assert.Equal(t, int64(len("rose petals")), read["io.bytes"])
+	assert.Contains(t, read, "io.throughput_bytes_per_sec")
+	assert.Nil(t, read["io.error"], "EOF isn't an error")
+
+	assert.Equal(t, "write", write["name"])
+	assert.Equal(t, int64(4), write["io.bytes"])
+	assert.Equal(t, "mint", buf.String())
+
+	assert.Equal(t, OpUpload, upload["io.operation"])
+	assert.Equal(t, "flavors", upload["blob.bucket"])
+	assert.Equal(t, "fig.txt", upload["blob.key"])
+	assert.Equal(t, int64(len("fig jam")), upload["io.bytes"])
+
+	assert.Equal(t, OpDownload, download["io.operation"])
+	assert.Equal(t, "no such key", download["io.error"])
+
+	assert.Equal(t, "lime.txt", gcs["blob.key"])
+	assert.Equal(t, "quota exceeded", gcs["io.error"])
+
+	// a download read after its parent was sent isn't cut short
+	ctx, span = beeline.StartSpan(context.Background(), "handler")
+	rc, err = Download(ctx, "flavors", "rose.txt", func(context.Context) (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader("rose petals")), nil
+	})
+	assert.NoError(t, err)
+	span.Send()
+	assert.Len(t, mo.Events(), 7, "the download should not be sent with its parent")
+	ioutil.ReadAll(rc)
+	rc.Close()
+	events = mo.Events()
+	if assert.Len(t, events, 8) {
+		assert.Equal(t, int64(len("rose petals")), events[7].Data["io.bytes"])
+		assert.Nil(t, events[7].Data["meta.sent_by_parent"])
+	}
+}
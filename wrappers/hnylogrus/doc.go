@@ -0,0 +1,19 @@
+/*
+Package hnylogrus connects logrus loggers to Honeycomb traces.
+
+Summary
+
+Add Hook to a logger to give entries logged with a context that carries a span
+(eg logger.WithContext(ctx).Info(...)) the trace.trace_id and trace.span_id of
+that span:
+
+	logrus.AddHook(hnylogrus.Hook{})
+	logrus.WithContext(ctx).Info("charging card")
+
+Or annotate a logger once per request with Logger:
+
+	log := hnylogrus.Logger(ctx, logrus.StandardLogger())
+	log.Info("charging card")
+
+*/
+package hnylogrus
@@ -0,0 +1,46 @@
+package hnylogrus
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/honeycombio/beeline-go/trace"
+)
+
+// Fields returns the trace.trace_id and trace.span_id of the span in ctx, or
+// nil if there is none.
+func Fields(ctx context.Context) logrus.Fields {
+	if ctx == nil {
+		return nil
+	}
+	span := trace.GetSpanFromContext(ctx)
+	if span == nil {
+		return nil
+	}
+	return logrus.Fields{
+		"trace.trace_id": span.GetTrace().GetTraceID(),
+		"trace.span_id":  span.GetSpanID(),
+	}
+}
+
+// Logger returns an entry of l annotated with the IDs of the span in ctx.
+func Logger(ctx context.Context, l logrus.FieldLogger) *logrus.Entry {
+	return l.WithFields(Fields(ctx))
+}
+
+// Hook is a logrus hook that adds the IDs of the span in each entry's context.
+type Hook struct{}
+
+// Levels returns all levels.
+func (Hook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire adds span IDs to entry.
+func (Hook) Fire(entry *logrus.Entry) error {
+	for k, v := range Fields(entry.Context) {
+		entry.Data[k] = v
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package hnylogrus
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/honeycombio/beeline-go/trace"
+)
+
+func TestHook(t *testing.T) {
+	l, hook := test.NewNullLogger()
+	l.AddHook(Hook{})
+	ctx, tr := trace.NewTrace(context.Background(), "")
+	l.WithContext(ctx).Info("charging card")
+	entry := hook.LastEntry()
+	assert.Equal(t, tr.GetTraceID(), entry.Data["trace.trace_id"])
+	assert.Equal(t, tr.GetRootSpan().GetSpanID(), entry.Data["trace.span_id"])
+
+	l.Info("no context")
+	assert.Empty(t, hook.LastEntry().Data, "entries without a span should be left alone")
+}
+
+func TestLogger(t *testing.T) {
+	l, hook := test.NewNullLogger()
+	ctx, tr := trace.NewTrace(context.Background(), "")
+	Logger(ctx, l).Info("charging card")
+	assert.Equal(t, tr.GetTraceID(), hook.LastEntry().Data["trace.trace_id"])
+}
@@ -0,0 +1,74 @@
+package hnynethttp
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/honeycombio/beeline-go/trace"
+)
+
+// responseBody wraps the body of a response received with ResponseBody set.
+// It records how much of the body was read and how long reading it took, and
+// sends the request's span, once the body has been read to the end or
+// closed.
+type responseBody struct {
+	io.ReadCloser
+	span    *trace.Span
+	headers time.Time
+
+	// lock guards the counts, since a body may be closed on a different
+	// goroutine from the one reading it, eg to cancel a long download
+	lock    sync.Mutex
+	bytes   int64
+	drained bool
+	done    bool
+}
+
+// wrapResponseBody replaces resp's body with one that sends span when it is
+// finished with.
+func wrapResponseBody(resp *http.Response, span *trace.Span) {
+	resp.Body = &responseBody{ReadCloser: resp.Body, span: span, headers: time.Now()}
+}
+
+func (b *responseBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.lock.Lock()
+	b.bytes += int64(n)
+	if err == io.EOF {
+		b.drained = true
+	}
+	b.lock.Unlock()
+	if err != nil {
+		b.finish(err)
+	}
+	return n, err
+}
+
+func (b *responseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.finish(nil)
+	return err
+}
+
+// finish records the body's fields and sends the span the first time it is
+// called. readErr is the error that ended reading, if any.
+func (b *responseBody) finish(readErr error) {
+	b.lock.Lock()
+	if b.done {
+		b.lock.Unlock()
+		return
+	}
+	b.done = true
+	bytes, drained := b.bytes, b.drained
+	b.lock.Unlock()
+
+	b.span.AddField("response.body_bytes", bytes)
+	b.span.AddField("response.body_read_ms", float64(time.Since(b.headers))/float64(time.Millisecond))
+	b.span.AddField("response.body_drained", drained)
+	if readErr != nil && readErr != io.EOF {
+		b.span.AddField("response.body_error", readErr.Error())
+	}
+	b.span.Send()
+}
@@ -11,6 +11,27 @@ For best results, use WrapHandler to wrap the mux passed to http.ListenAndServe
 Wrapping individual Handlers or HandleFuncs will generate events only for the
 endpoints that are wrapped; 404s, for example, will not generate events.
 
+The wrappers work the same with HTTP/2, including h2c served by
+golang.org/x/net/http2/h2c: they keep the optional interfaces of the
+ResponseWriter they're given and assume none it doesn't have, like
+http.Hijacker. Spans record the protocol in request.protocol, and requests
+the client gave up on, by resetting their stream or closing the connection
+before they were handled, get request.client_cancelled. Go's HTTP/2 servers
+don't expose stream IDs, so those aren't recorded.
+
+The WithOptions versions of the wrappers take their settings as options, the
+same ones the other HTTP wrappers' WithOptions constructors take:
+
+	handler := hnynethttp.WrapHandlerWithOptions(mux,
+		config.WithFilter(config.HealthChecks),
+		config.WithNameFunc(config.MethodAndRoute),
+		config.WithPropagators(propagation.FormatW3C, propagation.FormatHoneycomb),
+	)
+
+To join traces started by a browser RUM library, continue them with
+config.BrowserTraceContext as the HTTPParserHook, and render TraceparentMeta
+into pages so the spans the browser creates for them join the page's trace.
+
 For a complete example showing this wrapper in use, please see the examples in
 https://github.com/honeycombio/beeline-go/tree/main/examples
 
@@ -5,8 +5,8 @@ import (
 	"net/http"
 	"reflect"
 	"runtime"
+	"time"
 
-	"github.com/honeycombio/beeline-go/propagation"
 	"github.com/honeycombio/beeline-go/timer"
 	"github.com/honeycombio/beeline-go/trace"
 	"github.com/honeycombio/beeline-go/wrappers/common"
@@ -18,20 +18,20 @@ import (
 // of this handler with all the standard HTTP fields attached. If passed a
 // ServeMux instead, pull what you can from there. The provided config has a
 // HTTPTraceParserHook, it will be invoked when creating a new span or trace for
-// each incoming HTTP request.
+// each incoming HTTP request. If it has a URLPolicy, that's used to decide how
+// much of each request's URL to record. Requests matching its Skip filter are
+// not traced, and traces for requests matching its Drop filter are not sent.
 func WrapHandlerWithConfig(handler http.Handler, cfg config.HTTPIncomingConfig) http.Handler {
 	// if we can cache handlerName here, let's do so for efficiency's sake
 	handlerName := runtime.FuncForPC(reflect.ValueOf(handler).Pointer()).Name()
 
 	wrappedHandler := func(w http.ResponseWriter, r *http.Request) {
-		// get a new context with our trace from the request, and add common fields
-		var ctx context.Context
-		var span *trace.Span
-		if cfg.HTTPParserHook == nil {
-			ctx, span = common.StartSpanOrTraceFromHTTP(r)
-		} else {
-			ctx, span = common.StartSpanOrTraceFromHTTPWithTraceParserHook(r, cfg.HTTPParserHook)
+		if common.SkipRequest(r, cfg) {
+			handler.ServeHTTP(w, r)
+			return
 		}
+		// get a new context with our trace from the request, and add common fields
+		ctx, span := common.StartSpanOrTraceFromHTTPWithConfig(r, cfg)
 		defer span.Send()
 		// push the context with our trace and span on to the request
 		r = r.WithContext(ctx)
@@ -59,8 +59,15 @@ func WrapHandlerWithConfig(handler http.Handler, cfg config.HTTPIncomingConfig)
 				span.AddField("name", "handler")
 			}
 		}
+		common.NameSpan(span, r, cfg)
+		common.EnrichSpan(span, r, cfg)
+		common.AddResponseHeaders(wrappedWriter.Wrapped.Header(), r, span, cfg)
+		serverTiming := common.ServerTiming(wrappedWriter.Wrapped.Header(), span, cfg)
+		wrappedWriter.BeforeHeader = serverTiming
 
 		handler.ServeHTTP(wrappedWriter.Wrapped, r)
+		common.AddClientCancelled(span, r)
+		serverTiming()
 		if wrappedWriter.Status == 0 {
 			wrappedWriter.Status = 200
 		}
@@ -73,11 +80,17 @@ func WrapHandlerWithConfig(handler http.Handler, cfg config.HTTPIncomingConfig)
 		if ce := wrappedWriter.Wrapped.Header().Get("Content-Encoding"); ce != "" {
 			span.AddField("response.content_encoding", ce)
 		}
-		span.AddField("response.status_code", wrappedWriter.Status)
+		common.AddResponseStatus(span, wrappedWriter.Status, cfg)
 	}
 	return http.HandlerFunc(wrappedHandler)
 }
 
+// WrapHandlerWithOptions is a version of WrapHandlerWithConfig that takes
+// its settings as a list of options; see config.HTTPOption.
+func WrapHandlerWithOptions(handler http.Handler, opts ...config.HTTPOption) http.Handler {
+	return WrapHandlerWithConfig(handler, config.NewHTTPIncomingConfig(opts...))
+}
+
 // WrapHandler will create a Honeycomb event per invocation of this handler with
 // all the standard HTTP fields attached. If passed a ServeMux instead, pull
 // what you can from there
@@ -88,10 +101,26 @@ func WrapHandler(handler http.Handler) http.Handler {
 // WrapHandlerFunc will create a Honeycomb event per invocation of this handler
 // function with all the standard HTTP fields attached.
 func WrapHandlerFunc(hf func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	return WrapHandlerFuncWithConfig(hf, config.HTTPIncomingConfig{})
+}
+
+// WrapHandlerFuncWithOptions is a version of WrapHandlerFuncWithConfig that
+// takes its settings as a list of options; see config.HTTPOption.
+func WrapHandlerFuncWithOptions(hf func(http.ResponseWriter, *http.Request), opts ...config.HTTPOption) func(http.ResponseWriter, *http.Request) {
+	return WrapHandlerFuncWithConfig(hf, config.NewHTTPIncomingConfig(opts...))
+}
+
+// WrapHandlerFuncWithConfig is a version of WrapHandlerFunc that uses the
+// settings in cfg. See WrapHandlerWithConfig.
+func WrapHandlerFuncWithConfig(hf func(http.ResponseWriter, *http.Request), cfg config.HTTPIncomingConfig) func(http.ResponseWriter, *http.Request) {
 	handlerFuncName := runtime.FuncForPC(reflect.ValueOf(hf).Pointer()).Name()
 	return func(w http.ResponseWriter, r *http.Request) {
+		if common.SkipRequest(r, cfg) {
+			hf(w, r)
+			return
+		}
 		// get a new context with our trace from the request, and add common fields
-		ctx, span := common.StartSpanOrTraceFromHTTP(r)
+		ctx, span := common.StartSpanOrTraceFromHTTPWithConfig(r, cfg)
 		defer span.Send()
 		// push the context with our trace and span on to the request
 		r = r.WithContext(ctx)
@@ -102,8 +131,15 @@ func WrapHandlerFunc(hf func(http.ResponseWriter, *http.Request)) func(http.Resp
 			span.AddField("handler_func_name", handlerFuncName)
 			span.AddField("name", handlerFuncName)
 		}
+		common.NameSpan(span, r, cfg)
+		common.EnrichSpan(span, r, cfg)
+		common.AddResponseHeaders(wrappedWriter.Wrapped.Header(), r, span, cfg)
+		serverTiming := common.ServerTiming(wrappedWriter.Wrapped.Header(), span, cfg)
+		wrappedWriter.BeforeHeader = serverTiming
 
 		hf(wrappedWriter.Wrapped, r)
+		common.AddClientCancelled(span, r)
+		serverTiming()
 		if wrappedWriter.Status == 0 {
 			wrappedWriter.Status = 200
 		}
@@ -116,7 +152,7 @@ func WrapHandlerFunc(hf func(http.ResponseWriter, *http.Request)) func(http.Resp
 		if ce := wrappedWriter.Wrapped.Header().Get("Content-Encoding"); ce != "" {
 			span.AddField("response.content_encoding", ce)
 		}
-		span.AddField("response.status_code", wrappedWriter.Status)
+		common.AddResponseStatus(span, wrappedWriter.Status, cfg)
 	}
 }
 
@@ -124,6 +160,19 @@ type hnyTripper struct {
 	// wrt is the wrapped round tripper
 	wrt             http.RoundTripper
 	propagationHook config.HTTPTracePropagationHook
+	urlPolicy       *config.URLPolicy
+	// retries counts attempts when DetectRetries is set
+	retries      *retryTracker
+	responseBody bool
+}
+
+// requestProps returns the common fields for r, recording its URL according
+// to the tripper's URLPolicy.
+func (ht *hnyTripper) requestProps(r *http.Request) map[string]interface{} {
+	if ht.urlPolicy != nil {
+		return common.GetRequestPropsWithPolicy(r, *ht.urlPolicy)
+	}
+	return common.GetRequestProps(r)
 }
 
 func (ht *hnyTripper) RoundTrip(r *http.Request) (*http.Response, error) {
@@ -142,7 +191,7 @@ func (ht *hnyTripper) eventRoundTrip(r *http.Request) (*http.Response, error) {
 	defer ev.Send()
 
 	// add in common request headers.
-	for k, v := range common.GetRequestProps(r) {
+	for k, v := range ht.requestProps(r) {
 		ev.AddField(k, v)
 	}
 
@@ -163,19 +212,39 @@ func (ht *hnyTripper) eventRoundTrip(r *http.Request) (*http.Response, error) {
 func (ht *hnyTripper) spanRoundTrip(ctx context.Context, span *trace.Span, r *http.Request) (*http.Response, error) {
 	// we have a trace, let's use it and pass along trace context in addition to
 	// making a span around this HTTP call
-	ctx, span = span.CreateChild(ctx)
-	defer span.Send()
+	parent := span
+	if ht.responseBody {
+		// the span may be sent once the body is read, after the caller's
+		// span, which mustn't send it first
+		ctx, span = span.CreateAsyncChild(ctx)
+	} else {
+		ctx, span = span.CreateChild(ctx)
+	}
+	bodySendsSpan := false
+	defer func() {
+		if !bodySendsSpan {
+			span.Send()
+		}
+	}()
+	if ht.retries != nil {
+		attempt := ht.retries.attempt(parent, r)
+		span.AddField("retry.attempt", attempt)
+		span.AddField("retry.is_retry", attempt > 1)
+	}
 
 	r = r.WithContext(ctx)
 	// add in common request headers.
-	for k, v := range common.GetRequestProps(r) {
+	for k, v := range ht.requestProps(r) {
 		span.AddField(k, v)
 	}
 	span.AddField("meta.type", "http_client")
 	span.AddField("name", "http_client")
-	// If no propagation hook is defined, default to using the Honeycomb header format.
+	// If no propagation hook is defined, use the formats the beeline was
+	// configured with, which default to the Honeycomb header format.
 	if ht.propagationHook == nil {
-		r.Header.Add(propagation.TracePropagationHTTPHeader, span.SerializeHeaders())
+		for header, value := range span.PropagationHeaders(ctx) {
+			r.Header.Add(header, value)
+		}
 	} else {
 		// if a propagationHook exists, call it to get a map of headers to
 		// inject in the outgoing request.
@@ -185,7 +254,11 @@ func (ht *hnyTripper) spanRoundTrip(ctx context.Context, span *trace.Span, r *ht
 		}
 	}
 
+	start := time.Now()
 	resp, err := ht.wrt.RoundTrip(r)
+	if ht.retries != nil {
+		ht.retries.finish(parent, r, resp, err)
+	}
 
 	if err != nil {
 		// TODO should this error field be namespaced somehow
@@ -201,6 +274,13 @@ func (ht *hnyTripper) spanRoundTrip(ctx context.Context, span *trace.Span, r *ht
 			span.AddField("response.content_encoding", ce)
 		}
 		span.AddField("response.status_code", resp.StatusCode)
+		// the bodies of protocol switches are the new protocol's
+		// connection, which must keep its io.Writer
+		if ht.responseBody && resp.StatusCode != http.StatusSwitchingProtocols && resp.Body != nil && resp.Body != http.NoBody {
+			span.AddField("response.time_to_headers_ms", float64(time.Since(start))/float64(time.Millisecond))
+			wrapResponseBody(resp, span)
+			bodySendsSpan = true
+		}
 	}
 	return resp, err
 }
@@ -218,9 +298,18 @@ func WrapRoundTripper(r http.RoundTripper) http.RoundTripper {
 // WrapRoundTripperWithConfig is a version of WrapRoundTripper that accepts a config.
 // If the config contains a HTTPTracePropagationHook, it will be invoked on each outgoing
 // HTTP call. The return value, a map of header names to header strings, will be added
-// to the headers of the outgoing request.
+// to the headers of the outgoing request. If it has a URLPolicy, that's used to
+// decide how much of each request's URL to record. If it has DetectRetries
+// set, the spans for requests sent again in the same context, as retry
+// libraries do, record which attempt they were. If it has ResponseBody set,
+// spans aren't sent until the response body has been read or closed, and
+// record how it was read; they are async children of the span in the
+// request's context, since the body is often read after it is sent.
 func WrapRoundTripperWithConfig(r http.RoundTripper, cfg config.HTTPOutgoingConfig) http.RoundTripper {
-	tripper := &hnyTripper{wrt: r}
+	tripper := &hnyTripper{wrt: r, urlPolicy: cfg.URLPolicy, responseBody: cfg.ResponseBody}
+	if cfg.DetectRetries {
+		tripper.retries = newRetryTracker()
+	}
 	if cfg.HTTPPropagationHook != nil {
 		tripper.propagationHook = cfg.HTTPPropagationHook
 	}
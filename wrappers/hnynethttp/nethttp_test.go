@@ -1,14 +1,28 @@
 package hnynethttp
 
 import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	beeline "github.com/honeycombio/beeline-go"
+	"github.com/honeycombio/beeline-go/propagation"
+	"github.com/honeycombio/beeline-go/trace"
+	"github.com/honeycombio/beeline-go/wrappers/config"
 	libhoney "github.com/honeycombio/libhoney-go"
 	"github.com/honeycombio/libhoney-go/transmission"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 func TestWrapHandlerFunc(t *testing.T) {
@@ -90,3 +104,532 @@ func TestWrapHandler(t *testing.T) {
 	assert.True(t, ok, "status field must exist on middleware generated event")
 	assert.Equal(t, http.StatusTeapot, status, "served /fail request should have status 418")
 }
+
+func TestWrapHandlerWithConfigTemplatesRoutes(t *testing.T) {
+	// set up libhoney to catch events instead of send them
+	mo := &transmission.MockSender{}
+	client, err := libhoney.NewClient(libhoney.ClientConfig{
+		APIKey:       "placeholder",
+		Dataset:      "placeholder",
+		APIHost:      "placeholder",
+		Transmission: mo})
+	assert.Equal(t, nil, err)
+	beeline.Init(beeline.Config{Client: client})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/users/", func(_ http.ResponseWriter, _ *http.Request) {})
+	handler := WrapHandlerWithConfig(mux, config.HTTPIncomingConfig{TemplateRoutes: true})
+	r, _ := http.NewRequest("GET", "/users/1234", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	evs := mo.Events()
+	assert.Equal(t, 1, len(evs))
+	assert.Equal(t, "/users/1234", evs[0].Data["request.path"], "the raw path should be kept")
+	assert.Equal(t, "/users/:id", evs[0].Data["request.route"])
+}
+
+func TestWrapHandlerWithOptions(t *testing.T) {
+	// set up libhoney to catch events instead of send them
+	mo := &transmission.MockSender{}
+	client, err := libhoney.NewClient(libhoney.ClientConfig{
+		APIKey:       "placeholder",
+		Dataset:      "placeholder",
+		APIHost:      "placeholder",
+		Transmission: mo})
+	assert.Equal(t, nil, err)
+	beeline.Init(beeline.Config{Client: client})
+
+	handler := WrapHandlerFuncWithOptions(func(_ http.ResponseWriter, _ *http.Request) {},
+		config.WithNameFunc(func(r *http.Request) string { return "hello" }),
+		config.WithFilter(config.HealthChecks),
+		config.WithPropagators(propagation.FormatW3C),
+		config.WithFieldEnricher(func(r *http.Request) map[string]interface{} {
+			return map[string]interface{}{"app.tenant": r.Header.Get("Tenant")}
+		}),
+	)
+	r, _ := http.NewRequest("GET", "/healthz", nil)
+	handler(httptest.NewRecorder(), r)
+	r, _ = http.NewRequest("GET", "/hello", nil)
+	r.Header.Set("Tenant", "acme")
+	r.Header.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	handler(httptest.NewRecorder(), r)
+
+	evs := mo.Events()
+	if assert.Equal(t, 1, len(evs), "the health check should be skipped") {
+		assert.Equal(t, "hello", evs[0].Data["name"])
+		assert.Equal(t, "acme", evs[0].Data["app.tenant"])
+		assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", evs[0].Data["trace.trace_id"])
+	}
+}
+
+func TestWrapHandlerH2C(t *testing.T) {
+	// set up libhoney to catch events instead of send them
+	mo := &transmission.MockSender{}
+	client, err := libhoney.NewClient(libhoney.ClientConfig{
+		APIKey:       "placeholder",
+		Dataset:      "placeholder",
+		APIHost:      "placeholder",
+		Transmission: mo})
+	assert.Equal(t, nil, err)
+	beeline.Init(beeline.Config{Client: client})
+
+	handled := make(chan struct{}, 2)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stream", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello")
+		w.(http.Flusher).Flush()
+	})
+	mux.HandleFunc("/wait", func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+	wrapped := WrapHandler(mux)
+	server := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wrapped.ServeHTTP(w, r)
+		handled <- struct{}{}
+	}), &http2.Server{}))
+	defer server.Close()
+	hc := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+			return net.Dial(network, addr)
+		},
+	}}
+
+	resp, err := hc.Get(server.URL + "/stream")
+	if assert.NoError(t, err) {
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Equal(t, "hello", string(body))
+	}
+	<-handled
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r, _ := http.NewRequest("GET", server.URL+"/wait", nil)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		// cancelling the request resets its stream
+		cancel()
+	}()
+	_, err = hc.Do(r.WithContext(ctx))
+	assert.Error(t, err)
+	<-handled
+
+	evs := mo.Events()
+	if assert.Equal(t, 2, len(evs)) {
+		assert.Equal(t, "h2c", evs[0].Data["request.protocol"])
+		assert.Equal(t, "HTTP/2.0", evs[0].Data["request.http_version"])
+		assert.NotContains(t, evs[0].Data, "request.client_cancelled")
+		assert.Equal(t, true, evs[1].Data["request.client_cancelled"])
+	}
+}
+
+func TestWrapHandlerWithConfigSkipsAndDrops(t *testing.T) {
+	// set up libhoney to catch events instead of send them
+	mo := &transmission.MockSender{}
+	client, err := libhoney.NewClient(libhoney.ClientConfig{
+		APIKey:       "placeholder",
+		Dataset:      "placeholder",
+		APIHost:      "placeholder",
+		Transmission: mo})
+	assert.Equal(t, nil, err)
+	beeline.Init(beeline.Config{Client: client})
+
+	var sawSpan bool
+	handler := WrapHandlerWithConfig(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		_, span := beeline.StartSpan(r.Context(), "work")
+		sawSpan = trace.GetSpanFromContext(r.Context()) != nil
+		span.Send()
+	}), config.HTTPIncomingConfig{
+		Skip: config.HealthChecks,
+		Drop: config.CORSPreflight,
+	})
+
+	r, _ := http.NewRequest("GET", "/healthz", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	assert.False(t, sawSpan, "skipped requests shouldn't be traced")
+	assert.Equal(t, 1, len(mo.Events()), "spans in skipped requests start their own traces")
+
+	r, _ = http.NewRequest("OPTIONS", "/users", nil)
+	r.Header.Set("Access-Control-Request-Method", "POST")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	assert.True(t, sawSpan, "dropped requests should still be traced")
+	assert.Equal(t, 1, len(mo.Events()), "nothing in a dropped trace should be sent")
+
+	r, _ = http.NewRequest("GET", "/users", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	assert.Equal(t, 3, len(mo.Events()))
+}
+
+func TestWrapHandlerWithConfigClientFields(t *testing.T) {
+	// set up libhoney to catch events instead of send them
+	mo := &transmission.MockSender{}
+	client, err := libhoney.NewClient(libhoney.ClientConfig{
+		APIKey:       "placeholder",
+		Dataset:      "placeholder",
+		APIHost:      "placeholder",
+		Transmission: mo})
+	assert.Equal(t, nil, err)
+	beeline.Init(beeline.Config{Client: client})
+
+	trusted, _ := config.ParseTrustedProxies("10.0.0.0/8")
+	handler := WrapHandlerWithConfig(http.NotFoundHandler(), config.HTTPIncomingConfig{
+		ClientIP:       true,
+		TrustedProxies: trusted,
+		UserAgent:      true,
+		TLS:            true,
+	})
+	r := httptest.NewRequest("GET", "https://example.com/", nil)
+	r.RemoteAddr = "10.0.0.5:4321"
+	r.Header.Set("X-Forwarded-For", "198.51.100.7")
+	r.Header.Set("User-Agent", "curl/7.64.1")
+	r.TLS = &tls.ConnectionState{Version: tls.VersionTLS12, CipherSuite: tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, ServerName: "example.com"}
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	evs := mo.Events()
+	assert.Equal(t, 1, len(evs))
+	fields := evs[0].Data
+	assert.Equal(t, "198.51.100.7", fields["request.client_ip"])
+	assert.Equal(t, "curl", fields["request.user_agent.family"])
+	assert.Equal(t, "7.64.1", fields["request.user_agent.version"])
+	assert.Equal(t, "1.2", fields["request.tls.version"])
+	assert.Equal(t, "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", fields["request.tls.cipher_suite"])
+	assert.Equal(t, "example.com", fields["request.tls.server_name"])
+}
+
+func TestWrapHandlerWithConfigErrorPolicy(t *testing.T) {
+	// set up libhoney to catch events instead of send them
+	mo := &transmission.MockSender{}
+	client, err := libhoney.NewClient(libhoney.ClientConfig{
+		APIKey:       "placeholder",
+		Dataset:      "placeholder",
+		APIHost:      "placeholder",
+		Transmission: mo})
+	assert.Equal(t, nil, err)
+	beeline.Init(beeline.Config{Client: client})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/gone", func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(499) })
+	handler := WrapHandlerWithConfig(mux, config.HTTPIncomingConfig{ErrorPolicy: &config.ErrorPolicy{
+		Include: []config.StatusRange{{Min: 400, Max: 599}},
+		Exclude: []config.StatusRange{{Min: 404, Max: 404}},
+	}})
+	for _, path := range []string{"/gone", "/missing"} {
+		r, _ := http.NewRequest("GET", path, nil)
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	evs := mo.Events()
+	assert.Equal(t, 2, len(evs))
+	assert.Equal(t, 499, evs[0].Data["response.status_code"])
+	assert.Equal(t, true, evs[0].Data["error"])
+	assert.Equal(t, 404, evs[1].Data["response.status_code"])
+	_, ok := evs[1].Data["error"]
+	assert.False(t, ok, "excluded statuses shouldn't be errors")
+}
+
+func TestWrapRoundTripperPropagationFormats(t *testing.T) {
+	// set up libhoney to catch events instead of send them
+	mo := &transmission.MockSender{}
+	client, err := libhoney.NewClient(libhoney.ClientConfig{
+		APIKey:       "placeholder",
+		Dataset:      "placeholder",
+		APIHost:      "placeholder",
+		Transmission: mo})
+	assert.Equal(t, nil, err)
+	beeline.Init(beeline.Config{
+		Client:             client,
+		PropagationFormats: []propagation.Format{propagation.FormatHoneycomb, propagation.FormatW3C},
+	})
+	defer beeline.Init(beeline.Config{Client: client})
+
+	var received http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		received = r.Header
+	}))
+	defer server.Close()
+
+	ctx, span := beeline.StartSpan(context.Background(), "parent")
+	r, _ := http.NewRequest("GET", server.URL, nil)
+	resp, err := (&http.Client{Transport: WrapRoundTripper(http.DefaultTransport)}).Do(r.WithContext(ctx))
+	assert.NoError(t, err)
+	resp.Body.Close()
+	span.Send()
+
+	hny, err := propagation.UnmarshalHoneycombTraceContext(received.Get("X-Honeycomb-Trace"))
+	assert.NoError(t, err)
+	_, w3c, err := propagation.UnmarshalW3CTraceContext(context.Background(), map[string]string{"traceparent": received.Get("traceparent")})
+	assert.NoError(t, err)
+	assert.Equal(t, hny.TraceID, w3c.TraceID, "headers should identify the same trace")
+	assert.Equal(t, hny.ParentID, w3c.ParentID, "headers should identify the same parent")
+
+	evs := mo.Events()
+	if assert.Equal(t, 2, len(evs)) {
+		assert.Equal(t, evs[0].Data["trace.span_id"], hny.ParentID, "the client span should be the parent")
+	}
+}
+
+func TestWrapRoundTripperDetectRetries(t *testing.T) {
+	// set up libhoney to catch events instead of send them
+	mo := &transmission.MockSender{}
+	client, err := libhoney.NewClient(libhoney.ClientConfig{
+		APIKey:       "placeholder",
+		Dataset:      "placeholder",
+		APIHost:      "placeholder",
+		Transmission: mo})
+	assert.Equal(t, nil, err)
+	beeline.Init(beeline.Config{Client: client})
+
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	hc := &http.Client{Transport: WrapRoundTripperWithConfig(http.DefaultTransport, config.HTTPOutgoingConfig{DetectRetries: true})}
+
+	ctx, span := beeline.StartSpan(context.Background(), "parent")
+	// retry the way retry libraries do, with the same request each time
+	r, _ := http.NewRequest("GET", server.URL, nil)
+	r = r.WithContext(ctx)
+	for {
+		resp, err := hc.Do(r)
+		assert.NoError(t, err)
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			break
+		}
+	}
+	resp, err := hc.Do(r)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	span.Send()
+
+	evs := mo.Events()
+	if assert.Equal(t, 5, len(evs)) {
+		for i, attempt := range []int{1, 2, 3, 1} {
+			assert.Equal(t, attempt, evs[i].Data["retry.attempt"])
+			assert.Equal(t, attempt > 1, evs[i].Data["retry.is_retry"])
+			assert.Equal(t, evs[4].Data["trace.span_id"], evs[i].Data["trace.parent_id"], "attempts should be siblings")
+		}
+	}
+}
+
+func TestRetryTracker(t *testing.T) {
+	mo := &transmission.MockSender{}
+	client, err := libhoney.NewClient(libhoney.ClientConfig{
+		APIKey:       "placeholder",
+		Dataset:      "placeholder",
+		APIHost:      "placeholder",
+		Transmission: mo})
+	assert.Equal(t, nil, err)
+	beeline.Init(beeline.Config{Client: client})
+
+	rt := newRetryTracker()
+	r, _ := http.NewRequest("GET", "http://example.com/", nil)
+	_, a := beeline.StartSpan(context.Background(), "a")
+	_, b := beeline.StartSpan(context.Background(), "b")
+	assert.Equal(t, 1, rt.attempt(a, r))
+	assert.Equal(t, 2, rt.attempt(a, r))
+	assert.Equal(t, 1, rt.attempt(b, r), "attempts from other spans shouldn't count")
+
+	a.Send()
+	assert.Equal(t, 1, rt.tracked, "attempts should be forgotten once their span is sent")
+	_, ok := rt.attempts[a.GetSpanID()]
+	assert.False(t, ok)
+	b.Send()
+	assert.Equal(t, 0, len(rt.attempts))
+
+	// spans that are never sent only hold on to so many requests
+	_, c := beeline.StartSpan(context.Background(), "c")
+	for i := 0; i < maxTrackedRetries+10; i++ {
+		r, _ := http.NewRequest("GET", fmt.Sprintf("http://example.com/%d", i), nil)
+		rt.attempt(c, r)
+	}
+	assert.Equal(t, maxTrackedRetries, rt.tracked)
+	_, ok = rt.attempts[c.GetSpanID()][attemptKey{method: "GET", url: "http://example.com/0"}]
+	assert.False(t, ok, "the least recently attempted should be forgotten first")
+	c.Send()
+	assert.Equal(t, 0, rt.tracked)
+}
+
+func TestWrapRoundTripperResponseBody(t *testing.T) {
+	// set up libhoney to catch events instead of send them
+	mo := &transmission.MockSender{}
+	client, err := libhoney.NewClient(libhoney.ClientConfig{
+		APIKey:       "placeholder",
+		Dataset:      "placeholder",
+		APIHost:      "placeholder",
+		Transmission: mo})
+	assert.Equal(t, nil, err)
+	beeline.Init(beeline.Config{Client: client})
+
+	body := strings.Repeat("x", 10000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, body)
+	}))
+	defer server.Close()
+	hc := &http.Client{Transport: WrapRoundTripperWithConfig(http.DefaultTransport, config.HTTPOutgoingConfig{ResponseBody: true})}
+
+	ctx, span := beeline.StartSpan(context.Background(), "parent")
+	defer span.Send()
+	r, _ := http.NewRequest("GET", server.URL, nil)
+	resp, err := hc.Do(r.WithContext(ctx))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(mo.Events()), "the span should wait for the body")
+	read, err := ioutil.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, body, string(read))
+	resp.Body.Close()
+
+	resp, err = hc.Do(r.WithContext(ctx))
+	assert.NoError(t, err)
+	resp.Body.Read(make([]byte, 10))
+	resp.Body.Close()
+
+	evs := mo.Events()
+	if assert.Equal(t, 2, len(evs)) {
+		assert.Equal(t, int64(len(body)), evs[0].Data["response.body_bytes"])
+		assert.Equal(t, true, evs[0].Data["response.body_drained"])
+		assert.Contains(t, evs[0].Data, "response.body_read_ms")
+		assert.Contains(t, evs[0].Data, "response.time_to_headers_ms")
+		assert.Equal(t, int64(10), evs[1].Data["response.body_bytes"])
+		assert.Equal(t, false, evs[1].Data["response.body_drained"])
+	}
+
+	// a body read after the caller's span was sent isn't cut short
+	ctx, early := beeline.StartSpan(context.Background(), "early")
+	resp, err = hc.Do(r.WithContext(ctx))
+	assert.NoError(t, err)
+	early.Send()
+	assert.Equal(t, 3, len(mo.Events()), "the request's span should wait for the body")
+	ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	evs = mo.Events()
+	if assert.Equal(t, 4, len(evs)) {
+		assert.Equal(t, int64(len(body)), evs[3].Data["response.body_bytes"])
+		assert.Nil(t, evs[3].Data["meta.sent_by_parent"])
+	}
+}
+
+func TestWrapHandlerWithConfigResponseHeaders(t *testing.T) {
+	// set up libhoney to catch events instead of send them
+	mo := &transmission.MockSender{}
+	client, err := libhoney.NewClient(libhoney.ClientConfig{
+		APIKey:       "placeholder",
+		Dataset:      "placeholder",
+		APIHost:      "placeholder",
+		Transmission: mo})
+	assert.Equal(t, nil, err)
+	beeline.Init(beeline.Config{Client: client})
+
+	handler := WrapHandlerWithConfig(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}), config.HTTPIncomingConfig{ResponseHeaderHook: config.TraceIDResponseHeader("X-Honeycomb-Trace-Id")})
+	r, _ := http.NewRequest("GET", "/fail", nil)
+	r.Header.Set("X-Honeycomb-Trace", "1;trace_id=abcdef,parent_id=123456")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	assert.Equal(t, "abcdef", w.Header().Get("X-Honeycomb-Trace-Id"), "the trace ID should be written back to the client")
+	evs := mo.Events()
+	assert.Equal(t, 1, len(evs))
+	assert.Equal(t, "abcdef", evs[0].Data["trace.trace_id"])
+}
+
+func TestWrapHandlerWithConfigServerTiming(t *testing.T) {
+	// set up libhoney to catch events instead of send them
+	mo := &transmission.MockSender{}
+	client, err := libhoney.NewClient(libhoney.ClientConfig{
+		APIKey:       "placeholder",
+		Dataset:      "placeholder",
+		APIHost:      "placeholder",
+		Transmission: mo})
+	assert.Equal(t, nil, err)
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	beeline.Init(beeline.Config{Client: client, Clock: func() time.Time {
+		now = now.Add(time.Millisecond)
+		return now
+	}})
+	defer beeline.Init(beeline.Config{Client: client})
+
+	cfg := config.HTTPIncomingConfig{ServerTiming: true, ServerTimingSpans: []string{"db"}}
+	handler := WrapHandlerWithConfig(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, span := beeline.StartSpan(r.Context(), "db")
+		span.Send()
+		w.Write([]byte("hello"))
+	}), cfg)
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, "total;dur=3.0, db;dur=1.0", w.Header().Get("Server-Timing"))
+
+	// responses that write nothing get the header too
+	handler = WrapHandlerWithConfig(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}), cfg)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, "total;dur=1.0", w.Header().Get("Server-Timing"))
+	assert.Equal(t, 1, len(w.Header()["Server-Timing"]))
+}
+
+func TestTrustPolicy(t *testing.T) {
+	// set up libhoney to catch events instead of send them
+	mo := &transmission.MockSender{}
+	client, err := libhoney.NewClient(libhoney.ClientConfig{
+		APIKey:       "placeholder",
+		Dataset:      "placeholder",
+		APIHost:      "placeholder",
+		Transmission: mo})
+	assert.Equal(t, nil, err)
+	trusted, err := config.ParseTrustedProxies("10.0.0.0/8")
+	assert.NoError(t, err)
+	beeline.Init(beeline.Config{Client: client, TrustPolicy: &propagation.TrustPolicy{
+		Mode:     propagation.TrustSources,
+		Networks: trusted,
+	}})
+	defer beeline.Init(beeline.Config{Client: client})
+
+	handler := WrapHandler(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	for _, addr := range []string{"10.1.2.3:5000", "203.0.113.9:5000"} {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.RemoteAddr = addr
+		r.Header.Set("X-Honeycomb-Trace", "1;trace_id=abcdef,parent_id=123456")
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	evs := mo.Events()
+	assert.Equal(t, 2, len(evs))
+	assert.Equal(t, "abcdef", evs[0].Data["trace.trace_id"], "trace context from trusted peers should be honored")
+	assert.NotEqual(t, "abcdef", evs[1].Data["trace.trace_id"], "trace context from other peers should be ignored")
+	assert.Equal(t, true, evs[1].Data["meta.untrusted_trace_context"])
+}
+
+func TestBrowserTraceparent(t *testing.T) {
+	// set up libhoney to catch events instead of send them
+	mo := &transmission.MockSender{}
+	client, err := libhoney.NewClient(libhoney.ClientConfig{
+		APIKey:       "placeholder",
+		Dataset:      "placeholder",
+		APIHost:      "placeholder",
+		Transmission: mo})
+	assert.Equal(t, nil, err)
+	beeline.Init(beeline.Config{Client: client})
+
+	var meta template.HTML
+	handler := WrapHandlerWithConfig(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		meta = TraceparentMeta(r.Context())
+	}), config.HTTPIncomingConfig{HTTPParserHook: config.BrowserTraceContext("")})
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	evs := mo.Events()
+	assert.Equal(t, 1, len(evs))
+	assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", evs[0].Data["trace.trace_id"])
+	assert.Equal(t, "b7ad6b7169203331", evs[0].Data["trace.parent_id"], "the browser's span should be the parent")
+	assert.Equal(t, template.HTML(fmt.Sprintf(`<meta name="traceparent" content="00-0af7651916cd43dd8448eb211c80319c-%s-01">`, evs[0].Data["trace.span_id"])), meta)
+
+	assert.Equal(t, "", Traceparent(context.Background()))
+	assert.Equal(t, template.HTML(""), TraceparentMeta(context.Background()))
+}
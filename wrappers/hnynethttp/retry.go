@@ -0,0 +1,136 @@
+package hnynethttp
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/honeycombio/beeline-go/trace"
+)
+
+const (
+	// retryWindow is how long after an attempt a request is still counted
+	// as a retry of it.
+	retryWindow = time.Minute
+	// maxTrackedRetries is the most requests whose attempts are tracked;
+	// beyond it the least recently attempted are forgotten.
+	maxTrackedRetries = 1024
+)
+
+// attemptKey identifies a request that may be retried within a span: retry
+// libraries send each attempt with the context of the original request, and
+// so as a child of the same span.
+type attemptKey struct {
+	method string
+	url    string
+}
+
+type attemptCount struct {
+	n    int
+	last time.Time
+	// seq orders the requests by when they were last attempted
+	seq uint64
+}
+
+// retryTracker counts the attempts made to send requests, so the spans for
+// retries can say which attempt they were.
+type retryTracker struct {
+	lock sync.Mutex
+	// attempts holds the attempts made in each span, by its span ID, until
+	// that span is sent
+	attempts map[string]map[attemptKey]*attemptCount
+	// tracked is the number of requests in attempts
+	tracked int
+	seq     uint64
+}
+
+func newRetryTracker() *retryTracker {
+	return &retryTracker{attempts: make(map[string]map[attemptKey]*attemptCount)}
+}
+
+// attempt records an attempt to send r in parent, and returns which attempt
+// it is, starting from 1.
+func (rt *retryTracker) attempt(parent *trace.Span, r *http.Request) int {
+	now := time.Now()
+	id := parent.GetSpanID()
+	key := attemptKey{method: r.Method, url: r.URL.String()}
+	rt.lock.Lock()
+	if rt.tracked >= maxTrackedRetries {
+		rt.evictLocked(now)
+	}
+	requests, ok := rt.attempts[id]
+	if !ok {
+		requests = make(map[attemptKey]*attemptCount)
+		rt.attempts[id] = requests
+	}
+	a, seen := requests[key]
+	if !seen {
+		a = &attemptCount{}
+		requests[key] = a
+		rt.tracked++
+	} else if now.Sub(a.last) > retryWindow {
+		*a = attemptCount{}
+	}
+	a.n++
+	a.last = now
+	rt.seq++
+	a.seq = rt.seq
+	n := a.n
+	rt.lock.Unlock()
+	if !ok {
+		// outside the lock, since it runs right away if parent was sent
+		parent.OnEnd(func(*trace.Span) { rt.forget(id) })
+	}
+	return n
+}
+
+// evictLocked forgets the requests attempted outside the retry window, or if
+// there are none the least recently attempted one. The caller holds lock.
+func (rt *retryTracker) evictLocked(now time.Time) {
+	var oldestID string
+	var oldestKey attemptKey
+	var oldest uint64
+	for id, requests := range rt.attempts {
+		for k, a := range requests {
+			if now.Sub(a.last) > retryWindow {
+				rt.removeLocked(id, k)
+			} else if oldest == 0 || a.seq < oldest {
+				oldestID, oldestKey, oldest = id, k, a.seq
+			}
+		}
+	}
+	if rt.tracked >= maxTrackedRetries && oldest != 0 {
+		rt.removeLocked(oldestID, oldestKey)
+	}
+}
+
+// removeLocked forgets the attempts to send the request key in the span id.
+// The caller holds lock.
+func (rt *retryTracker) removeLocked(id string, key attemptKey) {
+	requests := rt.attempts[id]
+	if _, ok := requests[key]; !ok {
+		return
+	}
+	delete(requests, key)
+	rt.tracked--
+}
+
+// forget forgets the attempts made in the span id, once it has been sent.
+func (rt *retryTracker) forget(id string) {
+	rt.lock.Lock()
+	defer rt.lock.Unlock()
+	rt.tracked -= len(rt.attempts[id])
+	delete(rt.attempts, id)
+}
+
+// finish forgets the attempts to send r in parent if the last one got a
+// response that retry libraries don't retry, so a later request for the same
+// URL in the same span counts as a new one.
+func (rt *retryTracker) finish(parent *trace.Span, r *http.Request, resp *http.Response, err error) {
+	if err != nil || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return
+	}
+	rt.lock.Lock()
+	rt.removeLocked(parent.GetSpanID(), attemptKey{method: r.Method, url: r.URL.String()})
+	rt.lock.Unlock()
+}
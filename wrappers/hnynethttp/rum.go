@@ -0,0 +1,39 @@
+package hnynethttp
+
+import (
+	"context"
+	"html/template"
+
+	"github.com/honeycombio/beeline-go/propagation"
+	"github.com/honeycombio/beeline-go/trace"
+)
+
+// Traceparent returns a W3C traceparent for the span in ctx, marked sampled,
+// for a page rendered while handling a request to hand to its browser RUM
+// library so the spans it creates join the request's trace. It returns "" if
+// ctx has no span or the trace's IDs aren't valid W3C IDs.
+func Traceparent(ctx context.Context) string {
+	span := trace.GetSpanFromContext(ctx)
+	if span == nil {
+		return ""
+	}
+	prop := span.PropagationContext()
+	prop.TraceFlags = 1
+	return propagation.MarshalHeaders(ctx, prop, propagation.FormatW3C)["traceparent"]
+}
+
+// TraceparentMeta returns a meta tag holding Traceparent(ctx), which RUM
+// libraries read from the page's head, or "" if there is no traceparent. Pass
+// it to a template as a value or add it to a FuncMap:
+//
+//	tmpl := template.Must(template.New("page").Funcs(template.FuncMap{
+//		"traceparent": hnynethttp.TraceparentMeta,
+//	}).Parse(`<head>{{ traceparent .Ctx }}</head>`))
+func TraceparentMeta(ctx context.Context) template.HTML {
+	tp := Traceparent(ctx)
+	if tp == "" {
+		return ""
+	}
+	// traceparents are only hex digits and dashes, so need no escaping
+	return template.HTML(`<meta name="traceparent" content="` + tp + `">`)
+}
@@ -0,0 +1,21 @@
+/*
+Package hnyopenfeature records OpenFeature flag evaluations on spans.
+
+Summary
+
+Register a Hook with the OpenFeature API, or with a client, and every flag
+evaluated with a context holding a span is recorded on it with
+beeline.RecordFlagEvaluation: a feature_flag.<flag> field holding the variant,
+and a feature_flag span event with the flag's key, variant and reason.
+Evaluations that fail get a feature_flag span event with the reason ERROR
+and the error's message in feature_flag.error_message.
+
+	openfeature.AddHooks(hnyopenfeature.NewHook())
+
+	enabled, _ := client.BooleanValue(ctx, "new-checkout", false, openfeature.EvaluationContext{})
+
+It is a module of its own, so the beeline doesn't depend on the OpenFeature
+SDK, which needs a newer Go.
+
+*/
+package hnyopenfeature
@@ -0,0 +1,43 @@
+package hnyopenfeature
+
+import (
+	"context"
+
+	"github.com/open-feature/go-sdk/openfeature"
+
+	beeline "github.com/honeycombio/beeline-go"
+	"github.com/honeycombio/beeline-go/trace"
+)
+
+// Hook is an OpenFeature hook recording flag evaluations in the span in the
+// evaluation's context.
+type Hook struct {
+	openfeature.UnimplementedHook
+}
+
+// NewHook returns a Hook to register with openfeature.AddHooks or a client's
+// AddHooks.
+func NewHook() *Hook {
+	return &Hook{}
+}
+
+// After records a successful evaluation with beeline.RecordFlagEvaluation.
+func (h *Hook) After(ctx context.Context, hookContext openfeature.HookContext, details openfeature.InterfaceEvaluationDetails, hints openfeature.HookHints) error {
+	beeline.RecordFlagEvaluation(ctx, hookContext.FlagKey(), details.Variant, string(details.Reason))
+	return nil
+}
+
+// Error records a failed evaluation as a feature_flag span event with the
+// reason ERROR and the error's message. The span gets no feature_flag.<flag>
+// field, since there is no variant.
+func (h *Hook) Error(ctx context.Context, hookContext openfeature.HookContext, err error, hints openfeature.HookHints) {
+	span := trace.GetSpanFromContext(ctx)
+	if span == nil {
+		return
+	}
+	span.SendSpanEvent("feature_flag", map[string]interface{}{
+		"feature_flag.key":           hookContext.FlagKey(),
+		"feature_flag.reason":        beeline.FlagReasonError,
+		"feature_flag.error_message": err.Error(),
+	})
+}
@@ -0,0 +1,56 @@
+package hnyopenfeature
+
+import (
+	"context"
+	"testing"
+
+	"github.com/open-feature/go-sdk/openfeature"
+	"github.com/open-feature/go-sdk/openfeature/memprovider"
+	"github.com/stretchr/testify/assert"
+
+	beeline "github.com/honeycombio/beeline-go"
+	"github.com/honeycombio/libhoney-go/transmission"
+)
+
+func TestHook(t *testing.T) {
+	mo := &transmission.MockSender{}
+	beeline.Init(beeline.Config{Transmission: mo})
+	defer beeline.Close()
+
+	assert.NoError(t, openfeature.SetProvider(memprovider.NewInMemoryProvider(map[string]memprovider.InMemoryFlag{
+		"new-checkout": {
+			Key:            "new-checkout",
+			State:          memprovider.Enabled,
+			DefaultVariant: "on",
+			Variants:       map[string]interface{}{"on": true, "off": false},
+		},
+	})))
+	client := openfeature.NewClient("test")
+	client.AddHooks(NewHook())
+
+	ctx, span := beeline.StartSpan(context.Background(), "handler")
+	enabled, err := client.BooleanValue(ctx, "new-checkout", false, openfeature.EvaluationContext{})
+	assert.NoError(t, err)
+	assert.True(t, enabled)
+	_, err = client.BooleanValue(ctx, "missing", false, openfeature.EvaluationContext{})
+	assert.Error(t, err)
+	span.Send()
+
+	events := mo.Events()
+	if !assert.Len(t, events, 3) {
+		return
+	}
+	evaluated, failed, handler := events[0].Data, events[1].Data, events[2].Data
+	assert.Equal(t, "feature_flag", evaluated["name"])
+	assert.Equal(t, "new-checkout", evaluated["feature_flag.key"])
+	assert.Equal(t, "on", evaluated["feature_flag.variant"])
+	assert.Equal(t, "STATIC", evaluated["feature_flag.reason"])
+
+	assert.Equal(t, "feature_flag", failed["name"])
+	assert.Equal(t, "missing", failed["feature_flag.key"])
+	assert.Equal(t, beeline.FlagReasonError, failed["feature_flag.reason"])
+	assert.Contains(t, failed["feature_flag.error_message"], "FLAG_NOT_FOUND")
+
+	assert.Equal(t, "on", handler["feature_flag.new-checkout"])
+	assert.NotContains(t, handler, "feature_flag.missing")
+}
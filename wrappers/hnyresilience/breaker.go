@@ -0,0 +1,58 @@
+package hnyresilience
+
+import (
+	"context"
+	"sync"
+
+	beeline "github.com/honeycombio/beeline-go"
+	"github.com/honeycombio/beeline-go/trace"
+)
+
+// Breaker records a circuit breaker's state and the calls made through it.
+type Breaker struct {
+	name string
+
+	lock  sync.RWMutex
+	state string
+}
+
+// NewBreaker returns a Breaker recording the breaker name, which starts
+// closed.
+func NewBreaker(name string) *Breaker {
+	return &Breaker{name: name, state: "closed"}
+}
+
+// StateChange records that the breaker changed from the state from to the
+// state to, like "closed" to "open", in a breaker.state_change trace of its
+// own.
+func (b *Breaker) StateChange(from, to string) {
+	b.lock.Lock()
+	b.state = to
+	b.lock.Unlock()
+	_, span := beeline.StartTrace(context.Background(), "breaker.state_change")
+	span.AddField("meta.type", "breaker")
+	span.AddField("breaker.name", b.name)
+	span.AddField("breaker.from", from)
+	span.AddField("breaker.to", to)
+	span.Send()
+}
+
+// State returns the state the breaker last changed to.
+func (b *Breaker) State() string {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	return b.state
+}
+
+// Call adds the breaker's name and state to the span in ctx, for a call made
+// through the breaker, with breaker.rejected set if the breaker refused the
+// call rather than letting it through.
+func (b *Breaker) Call(ctx context.Context, rejected bool) {
+	span := trace.GetSpanFromContext(ctx)
+	if span == nil {
+		return
+	}
+	span.AddField("breaker.name", b.name)
+	span.AddField("breaker.state", b.State())
+	span.AddField("breaker.rejected", rejected)
+}
@@ -0,0 +1,34 @@
+/*
+Package hnyresilience makes retries and circuit breakers visible in traces.
+
+Summary
+
+Retry and breaker libraries run their callers' code in loops and state
+machines of their own, so a request that succeeded on its third attempt, or
+failed fast because a breaker was open, looks like any other. The hooks here
+fit the callbacks those libraries take, without depending on any of them.
+
+A Retry gives a retried operation a span, with a retry_attempt span event
+for each attempt and the outcome and number of attempts on the span. With
+cenkalti/backoff:
+
+	ctx, r := hnyresilience.StartRetry(ctx, "charge card")
+	err := backoff.RetryNotify(r.Operation(ctx, charge), b, r.Notify)
+	r.Finish(err)
+
+A Breaker records a circuit breaker's state changes, each as a trace of its
+own since they don't belong to any one request, and adds the breaker's name
+and state to the spans of calls made through it. With sony/gobreaker:
+
+	breaker := hnyresilience.NewBreaker("payments")
+	cb := gobreaker.NewCircuitBreaker(gobreaker.Settings{
+		Name: "payments",
+		OnStateChange: func(_ string, from, to gobreaker.State) {
+			breaker.StateChange(from.String(), to.String())
+		},
+	})
+	_, err := cb.Execute(func() (interface{}, error) { return nil, pay(ctx) })
+	breaker.Call(ctx, err == gobreaker.ErrOpenState || err == gobreaker.ErrTooManyRequests)
+
+*/
+package hnyresilience
@@ -0,0 +1,92 @@
+package hnyresilience
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	beeline "github.com/honeycombio/beeline-go"
+	"github.com/honeycombio/libhoney-go/transmission"
+)
+
+func TestRetry(t *testing.T) {
+	mo := &transmission.MockSender{}
+	beeline.Init(beeline.Config{Transmission: mo})
+	defer beeline.Close()
+
+	ctx, root := beeline.StartSpan(context.Background(), "handler")
+	ctx, r := StartRetry(ctx, "charge card")
+	calls := 0
+	op := r.Operation(ctx, func(ctx context.Context) error {
+		calls++
+		if calls < 3 {
+			return errors.New("declined")
+		}
+		return nil
+	})
+	// a retry loop like the ones libraries run
+	var err error
+	for {
+		if err = op(); err == nil {
+			break
+		}
+		r.Notify(err, 10*time.Millisecond)
+	}
+	r.Finish(err)
+	r.Finish(errors.New("ignored"))
+	root.Send()
+
+	events := mo.Events()
+	if !assert.Len(t, events, 7) {
+		return
+	}
+	retry := events[5].Data
+	for _, ev := range events[:5] {
+		assert.Equal(t, retry["trace.span_id"], ev.Data["trace.parent_id"])
+	}
+	assert.Equal(t, "retry_attempt", events[0].Data["name"])
+	assert.Equal(t, 1, events[0].Data["retry.attempt"])
+	assert.Equal(t, "declined", events[0].Data["retry.error"])
+	assert.Equal(t, "retry_backoff", events[1].Data["name"])
+	assert.Equal(t, 10.0, events[1].Data["retry.backoff_ms"])
+	assert.Equal(t, 3, events[4].Data["retry.attempt"])
+	assert.Nil(t, events[4].Data["retry.error"])
+
+	assert.Equal(t, "charge card", retry["name"])
+	assert.Equal(t, 3, retry["retry.attempts"])
+	assert.Equal(t, OutcomeSuccess, retry["retry.outcome"])
+}
+
+func TestBreaker(t *testing.T) {
+	mo := &transmission.MockSender{}
+	beeline.Init(beeline.Config{Transmission: mo})
+	defer beeline.Close()
+
+	b := NewBreaker("payments")
+	ctx, span := beeline.StartSpan(context.Background(), "handler")
+	b.Call(ctx, false)
+	span.Send()
+	b.StateChange("closed", "open")
+	ctx, span = beeline.StartSpan(context.Background(), "handler")
+	b.Call(ctx, true)
+	span.Send()
+
+	events := mo.Events()
+	if !assert.Len(t, events, 3) {
+		return
+	}
+	assert.Equal(t, "closed", events[0].Data["breaker.state"])
+	assert.Equal(t, false, events[0].Data["breaker.rejected"])
+
+	change := events[1].Data
+	assert.Equal(t, "breaker.state_change", change["name"])
+	assert.Equal(t, "payments", change["breaker.name"])
+	assert.Equal(t, "open", change["breaker.to"])
+	assert.Nil(t, change["trace.parent_id"], "state changes are traces of their own")
+
+	assert.Equal(t, "open", events[2].Data["breaker.state"])
+	assert.Equal(t, true, events[2].Data["breaker.rejected"])
+}
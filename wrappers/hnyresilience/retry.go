@@ -0,0 +1,89 @@
+package hnyresilience
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	beeline "github.com/honeycombio/beeline-go"
+	"github.com/honeycombio/beeline-go/trace"
+)
+
+// Outcomes of a retried operation, recorded in retry.outcome.
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Retry records the attempts made at an operation by a retry library.
+type Retry struct {
+	span *trace.Span
+
+	lock     sync.Mutex
+	attempts int
+	sent     bool
+}
+
+// StartRetry starts a span named op for a retried operation, a child of the
+// span in ctx, returning a context carrying it for the attempts to be made
+// in. Finish must be called with the operation's final error.
+func StartRetry(ctx context.Context, op string) (context.Context, *Retry) {
+	ctx, span := beeline.StartSpan(ctx, op)
+	span.AddField("meta.type", "retry")
+	return ctx, &Retry{span: span}
+}
+
+// Operation wraps fn, called with ctx, as the operation for a retry library
+// to call once per attempt, recording each attempt in a retry_attempt span
+// event with its number, duration and error.
+func (r *Retry) Operation(ctx context.Context, fn func(context.Context) error) func() error {
+	return func() error {
+		start := time.Now()
+		err := fn(ctx)
+		r.lock.Lock()
+		r.attempts++
+		attempt := r.attempts
+		r.lock.Unlock()
+		fields := map[string]interface{}{
+			"retry.attempt":     attempt,
+			"retry.duration_ms": float64(time.Since(start)) / float64(time.Millisecond),
+		}
+		if err != nil {
+			fields["retry.error"] = err.Error()
+		}
+		r.span.SendSpanEvent("retry_attempt", fields)
+		return err
+	}
+}
+
+// Notify records the backoff before the next attempt, with the error that
+// caused it, as a retry_backoff span event. It matches the notify functions
+// retry libraries like cenkalti/backoff take.
+func (r *Retry) Notify(err error, next time.Duration) {
+	fields := map[string]interface{}{
+		"retry.backoff_ms": float64(next) / float64(time.Millisecond),
+	}
+	if err != nil {
+		fields["retry.error"] = err.Error()
+	}
+	r.span.SendSpanEvent("retry_backoff", fields)
+}
+
+// Finish records the outcome of the operation, which failed with err if it
+// isn't nil, and the number of attempts made, and sends the span.
+func (r *Retry) Finish(err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.sent {
+		return
+	}
+	r.sent = true
+	r.span.AddField("retry.attempts", r.attempts)
+	if err != nil {
+		r.span.AddField("retry.outcome", OutcomeFailure)
+		r.span.AddField("retry.error", err.Error())
+	} else {
+		r.span.AddField("retry.outcome", OutcomeSuccess)
+	}
+	r.span.Send()
+}
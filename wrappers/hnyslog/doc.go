@@ -0,0 +1,20 @@
+/*
+Package hnyslog connects log/slog to Honeycomb traces. It requires Go 1.21 or
+later.
+
+Summary
+
+NewHandler wraps any slog.Handler so that records logged with a context that
+carries a span (eg slog.InfoContext(ctx, ...)) get the trace.trace_id and
+trace.span_id of that span, letting log lines be matched up with traces.
+
+Optionally, records at or above Options.SpanEventLevel are also sent as span
+events on the active span, so errors show up in the trace view:
+
+	handler := hnyslog.NewHandler(slog.NewJSONHandler(os.Stderr, nil), &hnyslog.Options{
+		SpanEventLevel: slog.LevelError,
+	})
+	slog.SetDefault(slog.New(handler))
+
+*/
+package hnyslog
@@ -0,0 +1,129 @@
+//go:build go1.21
+// +build go1.21
+
+package hnyslog
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/honeycombio/beeline-go/trace"
+)
+
+// Options configure a Handler.
+type Options struct {
+	// SpanEventLevel, if set, is the lowest level of records that are also
+	// sent as span events on the span in the record's context, named after
+	// the record's message and with its attributes as fields.
+	SpanEventLevel slog.Leveler
+}
+
+// Handler is a slog.Handler that adds the IDs of the span in each record's
+// context before passing the record to another Handler.
+type Handler struct {
+	inner slog.Handler
+	opts  Options
+	// group is the prefix for attribute names added by WithGroup, and attrs
+	// the fields added by WithAttrs, for span events.
+	group string
+	attrs map[string]interface{}
+}
+
+// NewHandler returns a Handler that passes records to inner. opts may be nil.
+func NewHandler(inner slog.Handler, opts *Options) *Handler {
+	h := &Handler{inner: inner}
+	if opts != nil {
+		h.opts = *opts
+	}
+	return h
+}
+
+// Enabled reports whether the wrapped handler handles records at level, or
+// they would be sent as span events.
+func (h *Handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.inner.Enabled(ctx, level) || h.mirrors(level)
+}
+
+func (h *Handler) mirrors(level slog.Level) bool {
+	return h.opts.SpanEventLevel != nil && level >= h.opts.SpanEventLevel.Level()
+}
+
+// Handle adds trace.trace_id and trace.span_id to r if its context has a span,
+// sends it as a span event if its level calls for one, and passes it on.
+func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+	span := trace.GetSpanFromContext(ctx)
+	if span != nil {
+		if h.mirrors(r.Level) {
+			span.SendSpanEvent(r.Message, h.fields(r))
+		}
+		r = r.Clone()
+		r.AddAttrs(
+			slog.String("trace.trace_id", span.GetTrace().GetTraceID()),
+			slog.String("trace.span_id", span.GetSpanID()),
+		)
+	}
+	if !h.inner.Enabled(ctx, r.Level) {
+		return nil
+	}
+	return h.inner.Handle(ctx, r)
+}
+
+// fields builds the fields of the span event for r.
+func (h *Handler) fields(r slog.Record) map[string]interface{} {
+	fields := make(map[string]interface{}, len(h.attrs)+r.NumAttrs()+1)
+	for k, v := range h.attrs {
+		fields[k] = v
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		addAttr(fields, h.group, a)
+		return true
+	})
+	fields["log.level"] = r.Level.String()
+	return fields
+}
+
+// addAttr adds a to fields, flattening groups into dotted names.
+func addAttr(fields map[string]interface{}, prefix string, a slog.Attr) {
+	v := a.Value.Resolve()
+	if v.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range v.Group() {
+			addAttr(fields, prefix, ga)
+		}
+		return
+	}
+	if a.Key != "" {
+		fields[prefix+a.Key] = v.Any()
+	}
+}
+
+// WithAttrs returns a Handler whose records have attrs.
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := h.clone()
+	h2.inner = h.inner.WithAttrs(attrs)
+	for _, a := range attrs {
+		addAttr(h2.attrs, h.group, a)
+	}
+	return h2
+}
+
+// WithGroup returns a Handler whose records' attributes are in the group name.
+func (h *Handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := h.clone()
+	h2.inner = h.inner.WithGroup(name)
+	h2.group = h.group + name + "."
+	return h2
+}
+
+func (h *Handler) clone() *Handler {
+	attrs := make(map[string]interface{}, len(h.attrs))
+	for k, v := range h.attrs {
+		attrs[k] = v
+	}
+	return &Handler{inner: h.inner, opts: h.opts, group: h.group, attrs: attrs}
+}
@@ -0,0 +1,60 @@
+//go:build go1.21
+// +build go1.21
+
+package hnyslog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/honeycombio/beeline-go/client"
+	"github.com/honeycombio/beeline-go/trace"
+	libhoney "github.com/honeycombio/libhoney-go"
+	"github.com/honeycombio/libhoney-go/transmission"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler(t *testing.T) {
+	mo := &transmission.MockSender{}
+	c, _ := libhoney.NewClient(libhoney.ClientConfig{
+		APIKey:       "placeholder",
+		Dataset:      "placeholder",
+		APIHost:      "placeholder",
+		Transmission: mo,
+	})
+	client.Set(c)
+
+	var buf bytes.Buffer
+	h := NewHandler(slog.NewJSONHandler(&buf, nil), &Options{SpanEventLevel: slog.LevelError})
+	logger := slog.New(h).With("component", "billing")
+
+	ctx, tr := trace.NewTrace(context.Background(), "")
+	span := tr.GetRootSpan()
+	logger.InfoContext(ctx, "charging card")
+	var record map[string]interface{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, tr.GetTraceID(), record["trace.trace_id"])
+	assert.Equal(t, span.GetSpanID(), record["trace.span_id"])
+	assert.Equal(t, 0, len(mo.Events()), "info records should not be span events")
+
+	buf.Reset()
+	logger.ErrorContext(ctx, "card declined", slog.Group("card", "brand", "visa"))
+	events := mo.Events()
+	assert.Equal(t, 1, len(events), "error records should be span events")
+	fields := events[0].Data
+	assert.Equal(t, "card declined", fields["name"])
+	assert.Equal(t, "span_event", fields["meta.annotation_type"])
+	assert.Equal(t, span.GetSpanID(), fields["trace.parent_id"])
+	assert.Equal(t, "billing", fields["component"])
+	assert.Equal(t, "visa", fields["card.brand"])
+	assert.Equal(t, "ERROR", fields["log.level"])
+
+	buf.Reset()
+	logger.Info("no span")
+	record = nil
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Nil(t, record["trace.trace_id"], "records without a span should be passed through")
+}
@@ -0,0 +1,85 @@
+package hnysql
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// fieldAdder is implemented by both *libhoney.Event and *trace.Span.
+type fieldAdder interface {
+	AddField(key string, val interface{})
+}
+
+// cachedStmt returns the statement cached for query, if CacheStatements is
+// set and there is one, recording in f whether there was.
+func (db *DB) cachedStmt(query string, f fieldAdder) *Stmt {
+	if !db.CacheStatements {
+		return nil
+	}
+	db.stmtsLock.Lock()
+	s := db.stmts[query]
+	db.stmtsLock.Unlock()
+	f.AddField("db.stmt_cache_hit", s != nil)
+	if s != nil {
+		f.AddField("db.stmtId", s.id)
+	}
+	return s
+}
+
+// cacheStmt caches s, just prepared for query, if CacheStatements is set. If
+// another call prepared the query at the same time, s is closed and the
+// statement already cached is returned instead.
+func (db *DB) cacheStmt(query string, s *Stmt) *Stmt {
+	if !db.CacheStatements {
+		return s
+	}
+	db.stmtsLock.Lock()
+	defer db.stmtsLock.Unlock()
+	if cached, ok := db.stmts[query]; ok {
+		s.wstmt.Close()
+		return cached
+	}
+	if db.stmts == nil {
+		db.stmts = make(map[string]*Stmt)
+	}
+	s.cached = true
+	db.stmts[query] = s
+	return s
+}
+
+// closeCachedStmts closes the statements cached by CacheStatements.
+func (db *DB) closeCachedStmts() {
+	db.stmtsLock.Lock()
+	defer db.stmtsLock.Unlock()
+	for _, s := range db.stmts {
+		s.wstmt.Close()
+	}
+	db.stmts = nil
+}
+
+// prepareSpan prepares query for ExecContext or QueryContext, with
+// PrepareSpans set, in a child span of the call's span in ctx. The statement
+// must be released when the call is done with it.
+func (db *DB) prepareSpan(ctx context.Context, query string, f fieldAdder) (*Stmt, error) {
+	s, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	f.AddField("db.stmtId", s.id)
+	s.countUse(f)
+	return s, nil
+}
+
+// release closes a statement prepared by prepareSpan unless it is cached.
+// Rows read from it stay open until they are closed.
+func (s *Stmt) release() {
+	if !s.cached {
+		s.wstmt.Close()
+	}
+}
+
+// countUse records in f how many times the statement has been executed,
+// including this one, so reuse of prepared statements can be seen.
+func (s *Stmt) countUse(f fieldAdder) {
+	f.AddField("db.stmt_uses", atomic.AddInt64(&s.uses, 1))
+}
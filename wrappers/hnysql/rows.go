@@ -0,0 +1,139 @@
+package hnysql
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/honeycombio/beeline-go/trace"
+)
+
+// Rows wraps *sql.Rows to record how long reading a result set takes. The
+// query's span is sent when QueryContext returns, before any rows are read,
+// so for large results the time spent streaming them from the database is
+// otherwise invisible. When the rows are closed, by Close or by Next running
+// out of rows, the number of rows scanned and the time spent in Next and Scan
+// are added to the span in the rows' context as the rollup fields
+// db.rows_scanned, db.rows_next_ms and db.rows_scan_ms, so they add up across
+// the queries a span makes.
+type Rows struct {
+	// wrows is the wrapped rows. Like DB's, it is not embedded so that new
+	// methods fail to compile rather than going uninstrumented.
+	wrows *sql.Rows
+
+	ctx       context.Context
+	threshold time.Duration
+	// span is the rows' own span, started once iterating over them takes
+	// longer than threshold
+	span    *trace.Span
+	scanned int
+	next    time.Duration
+	scan    time.Duration
+	closed  bool
+}
+
+// WrapRows instruments reading rows, returned by a query made with ctx. If
+// the DB's RowsSpanThreshold is set and reading the rows takes longer than
+// that, they also get their own span, a child of the span in ctx named
+// db.rows. It starts when the threshold is crossed and carries the totals
+// for the whole iteration in db.rows_scanned, db.rows_next_ms and
+// db.rows_scan_ms.
+//
+// Rows are not safe for concurrent use, just as *sql.Rows are not.
+func (db *DB) WrapRows(ctx context.Context, rows *sql.Rows) *Rows {
+	return &Rows{
+		wrows:     rows,
+		ctx:       ctx,
+		threshold: db.RowsSpanThreshold,
+	}
+}
+
+// Next calls Next on the wrapped rows, timing it.
+func (r *Rows) Next() bool {
+	start := time.Now()
+	more := r.wrows.Next()
+	r.next += time.Since(start)
+	if more {
+		r.checkThreshold()
+	} else {
+		// the rows closed themselves
+		r.finish()
+	}
+	return more
+}
+
+// NextResultSet calls NextResultSet on the wrapped rows, timing it with Next.
+func (r *Rows) NextResultSet() bool {
+	start := time.Now()
+	more := r.wrows.NextResultSet()
+	r.next += time.Since(start)
+	if !more {
+		r.finish()
+	}
+	return more
+}
+
+// Scan calls Scan on the wrapped rows, timing it and counting the row.
+func (r *Rows) Scan(dest ...interface{}) error {
+	start := time.Now()
+	err := r.wrows.Scan(dest...)
+	r.scan += time.Since(start)
+	if err == nil {
+		r.scanned++
+	}
+	r.checkThreshold()
+	return err
+}
+
+// Close closes the wrapped rows and records how reading them went.
+func (r *Rows) Close() error {
+	err := r.wrows.Close()
+	r.finish()
+	return err
+}
+
+// these are not instrumented calls since they only describe the rows
+func (r *Rows) ColumnTypes() ([]*sql.ColumnType, error) { return r.wrows.ColumnTypes() }
+func (r *Rows) Columns() ([]string, error)              { return r.wrows.Columns() }
+func (r *Rows) Err() error                              { return r.wrows.Err() }
+
+// checkThreshold starts the rows' span if reading them has taken longer than
+// the threshold.
+func (r *Rows) checkThreshold() {
+	if r.span != nil || r.threshold <= 0 || r.next+r.scan <= r.threshold {
+		return
+	}
+	parent := trace.GetSpanFromContext(r.ctx)
+	if parent == nil {
+		return
+	}
+	r.span = parent.StartChild("db.rows")
+	r.span.AddField("db.rows_threshold_ms", durationMs(r.threshold))
+}
+
+// finish records the totals once the rows are closed.
+func (r *Rows) finish() {
+	if r.closed {
+		return
+	}
+	r.closed = true
+	next, scan := durationMs(r.next), durationMs(r.scan)
+	if parent := trace.GetSpanFromContext(r.ctx); parent != nil {
+		parent.AddRollupField("db.rows_scanned", float64(r.scanned))
+		parent.AddRollupField("db.rows_next_ms", next)
+		parent.AddRollupField("db.rows_scan_ms", scan)
+	}
+	if r.span != nil {
+		r.span.AddField("db.rows_scanned", r.scanned)
+		r.span.AddField("db.rows_next_ms", next)
+		r.span.AddField("db.rows_scan_ms", scan)
+		if err := r.wrows.Err(); err != nil {
+			r.span.AddField("db.error", err.Error())
+		}
+		r.span.Send()
+	}
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
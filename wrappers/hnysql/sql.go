@@ -4,10 +4,12 @@ import (
 	"context"
 	"database/sql"
 	"database/sql/driver"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 
+	"github.com/honeycombio/beeline-go/timer"
 	"github.com/honeycombio/beeline-go/wrappers/common"
 	libhoney "github.com/honeycombio/libhoney-go"
 )
@@ -25,6 +27,25 @@ type DB struct {
 	// Builder is available in case you wish to add fields to every SQL event
 	// that will be created.
 	Builder *libhoney.Builder
+	// CacheStatements, if set, makes Prepare and PrepareContext return the
+	// statement already prepared for the same query, if there is one,
+	// instead of preparing it again. Their events record whether it was in
+	// db.stmt_cache_hit. Cached statements stay open until the DB is closed;
+	// closing them does nothing.
+	CacheStatements bool
+	// PrepareSpans, if set, makes ExecContext, QueryContext and
+	// QueryRowContext prepare their queries explicitly, in a PrepareContext
+	// child of the call's span, before executing them, so the time spent
+	// preparing statements can be told apart from the time spent executing
+	// them. Unless CacheStatements is also set, this costs every call an
+	// extra round trip to the database.
+	PrepareSpans bool
+	// RowsSpanThreshold, if set, gives rows wrapped with WrapRows their own
+	// span once reading them takes longer than this. See WrapRows.
+	RowsSpanThreshold time.Duration
+
+	stmtsLock sync.Mutex
+	stmts     map[string]*Stmt
 }
 
 func WrapDB(s *sql.DB) *DB {
@@ -154,7 +175,18 @@ func (db *DB) ExecContext(ctx context.Context, query string, args ...interface{}
 	}()
 
 	// do DB call
-	res, err := db.wdb.ExecContext(ctx, query, args...)
+	var res sql.Result
+	if db.PrepareSpans {
+		var stmt *Stmt
+		stmt, err = db.prepareSpan(ctx, query, span)
+		if err != nil {
+			return nil, err
+		}
+		defer stmt.release()
+		res, err = stmt.wstmt.ExecContext(ctx, args...)
+	} else {
+		res, err = db.wdb.ExecContext(ctx, query, args...)
+	}
 
 	// capture results
 	if err == nil {
@@ -200,6 +232,9 @@ func (db *DB) Prepare(query string) (*Stmt, error) {
 	defer func() {
 		sender(err)
 	}()
+	if cached := db.cachedStmt(query, ev); cached != nil {
+		return cached, nil
+	}
 
 	bld := db.Builder.Clone()
 	id, _ := uuid.NewRandom()
@@ -207,6 +242,7 @@ func (db *DB) Prepare(query string) (*Stmt, error) {
 	wrapStmt := &Stmt{
 		db:      db,
 		Builder: bld,
+		id:      stmtid,
 	}
 	bld.AddField("db.stmtId", stmtid)
 	// add the query to the builder so all executions of this prepared statement
@@ -215,8 +251,13 @@ func (db *DB) Prepare(query string) (*Stmt, error) {
 	ev.AddField("db.stmtId", stmtid)
 
 	// do DB call
+	prepareTimer := timer.Start()
 	stmt, err := db.wdb.Prepare(query)
+	bld.AddField("db.stmt_prepare_ms", prepareTimer.Finish())
 	wrapStmt.wstmt = stmt
+	if err == nil {
+		wrapStmt = db.cacheStmt(query, wrapStmt)
+	}
 	return wrapStmt, err
 }
 
@@ -226,6 +267,9 @@ func (db *DB) PrepareContext(ctx context.Context, query string) (*Stmt, error) {
 	defer func() {
 		sender(err)
 	}()
+	if cached := db.cachedStmt(query, span); cached != nil {
+		return cached, nil
+	}
 
 	bld := db.Builder.Clone()
 	id, _ := uuid.NewRandom()
@@ -233,6 +277,7 @@ func (db *DB) PrepareContext(ctx context.Context, query string) (*Stmt, error) {
 	wrapStmt := &Stmt{
 		db:      db,
 		Builder: bld,
+		id:      stmtid,
 	}
 	bld.AddField("db.stmtId", stmtid)
 	// add the query to the builder so all executions of this prepared statement
@@ -243,14 +288,19 @@ func (db *DB) PrepareContext(ctx context.Context, query string) (*Stmt, error) {
 	}
 
 	// do DB call
+	prepareTimer := timer.Start()
 	stmt, err := db.wdb.PrepareContext(ctx, query)
+	bld.AddField("db.stmt_prepare_ms", prepareTimer.Finish())
 	wrapStmt.wstmt = stmt
+	if err == nil {
+		wrapStmt = db.cacheStmt(query, wrapStmt)
+	}
 	return wrapStmt, err
 }
 
 func (db *DB) Query(query string, args ...interface{}) (*sql.Rows, error) {
 	var err error
-	_, sender := common.BuildDBEvent(db.Builder, db.Stats(), query, args)
+	_, sender := common.BuildDBEvent(db.Builder, db.Stats(), query, args...)
 	defer func() {
 		sender(err)
 	}()
@@ -263,18 +313,29 @@ func (db *DB) Query(query string, args ...interface{}) (*sql.Rows, error) {
 
 func (db *DB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
 	var err error
-	ctx, _, sender := common.BuildDBSpan(ctx, db.Builder, db.Stats(), query, args)
+	ctx, span, sender := common.BuildDBSpan(ctx, db.Builder, db.Stats(), query, args...)
 	defer func() {
 		sender(err)
 	}()
 
 	// do DB call
+	if db.PrepareSpans {
+		var stmt *Stmt
+		stmt, err = db.prepareSpan(ctx, query, span)
+		if err != nil {
+			return nil, err
+		}
+		defer stmt.release()
+		var rows *sql.Rows
+		rows, err = stmt.wstmt.QueryContext(ctx, args...)
+		return rows, err
+	}
 	rows, err := db.wdb.QueryContext(ctx, query, args...)
 	return rows, err
 }
 
 func (db *DB) QueryRow(query string, args ...interface{}) *sql.Row {
-	_, sender := common.BuildDBEvent(db.Builder, db.Stats(), query, args)
+	_, sender := common.BuildDBEvent(db.Builder, db.Stats(), query, args...)
 	defer sender(nil)
 
 	// do DB call
@@ -282,10 +343,19 @@ func (db *DB) QueryRow(query string, args ...interface{}) *sql.Row {
 	return row
 }
 func (db *DB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
-	ctx, _, sender := common.BuildDBSpan(ctx, db.Builder, db.Stats(), query, args)
+	ctx, span, sender := common.BuildDBSpan(ctx, db.Builder, db.Stats(), query, args...)
 	defer sender(nil)
 
 	// do DB call
+	if db.PrepareSpans {
+		stmt, err := db.prepareSpan(ctx, query, span)
+		if err == nil {
+			defer stmt.release()
+			return stmt.wstmt.QueryRowContext(ctx, args...)
+		}
+		// a Row can't be made to hold the error, so the query reports it
+		// again on Scan
+	}
 	row := db.wdb.QueryRowContext(ctx, query, args...)
 	return row
 }
@@ -296,6 +366,7 @@ func (db *DB) Close() error {
 	defer func() {
 		sender(err)
 	}()
+	db.closeCachedStmts()
 	err = db.wdb.Close()
 	return err
 }
@@ -409,6 +480,7 @@ func (c *Conn) PrepareContext(ctx context.Context, query string) (*Stmt, error)
 	wrapStmt := &Stmt{
 		db:      c.db,
 		Builder: bld,
+		id:      stmtid,
 	}
 	bld.AddField("db.stmtId", stmtid)
 	bld.AddField("db.query", query)
@@ -417,7 +489,9 @@ func (c *Conn) PrepareContext(ctx context.Context, query string) (*Stmt, error)
 	}
 
 	// do DB call
+	prepareTimer := timer.Start()
 	stmt, err := c.wconn.PrepareContext(ctx, query)
+	bld.AddField("db.stmt_prepare_ms", prepareTimer.Finish())
 
 	wrapStmt.wstmt = stmt
 
@@ -426,7 +500,7 @@ func (c *Conn) PrepareContext(ctx context.Context, query string) (*Stmt, error)
 
 func (c *Conn) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
 	var err error
-	ctx, _, sender := common.BuildDBSpan(ctx, c.Builder, c.db.Stats(), query, args)
+	ctx, _, sender := common.BuildDBSpan(ctx, c.Builder, c.db.Stats(), query, args...)
 	defer func() {
 		sender(err)
 	}()
@@ -437,7 +511,7 @@ func (c *Conn) QueryContext(ctx context.Context, query string, args ...interface
 }
 
 func (c *Conn) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
-	ctx, _, sender := common.BuildDBSpan(ctx, c.Builder, c.db.Stats(), query, args)
+	ctx, _, sender := common.BuildDBSpan(ctx, c.Builder, c.db.Stats(), query, args...)
 	defer sender(nil)
 
 	// do DB call
@@ -449,14 +523,25 @@ type Stmt struct {
 	db      *DB
 	wstmt   *sql.Stmt
 	Builder *libhoney.Builder
+
+	id string
+	// cached is set if the statement is in its DB's statement cache
+	cached bool
+	// uses counts the statement's executions, atomically
+	uses int64
 }
 
 func (s *Stmt) Close() error {
 	var err error
-	_, sender := common.BuildDBEvent(s.Builder, s.db.Stats(), "")
+	ev, sender := common.BuildDBEvent(s.Builder, s.db.Stats(), "")
 	defer func() {
 		sender(err)
 	}()
+	if s.cached {
+		// closed with the DB
+		ev.AddField("db.stmt_cached", true)
+		return nil
+	}
 	err = s.wstmt.Close()
 	return err
 }
@@ -467,6 +552,7 @@ func (s *Stmt) Exec(args ...interface{}) (sql.Result, error) {
 	defer func() {
 		sender(err)
 	}()
+	s.countUse(ev)
 
 	// do DB call
 	res, err := s.wstmt.Exec(args...)
@@ -491,6 +577,9 @@ func (s *Stmt) ExecContext(ctx context.Context, args ...interface{}) (sql.Result
 	defer func() {
 		sender(err)
 	}()
+	if span != nil {
+		s.countUse(span)
+	}
 
 	// do DB call
 	res, err := s.wstmt.ExecContext(ctx, args...)
@@ -515,10 +604,11 @@ func (s *Stmt) ExecContext(ctx context.Context, args ...interface{}) (sql.Result
 
 func (s *Stmt) Query(args ...interface{}) (*sql.Rows, error) {
 	var err error
-	_, sender := common.BuildDBEvent(s.Builder, s.db.Stats(), "", args)
+	ev, sender := common.BuildDBEvent(s.Builder, s.db.Stats(), "", args...)
 	defer func() {
 		sender(err)
 	}()
+	s.countUse(ev)
 
 	// do DB call
 	rows, err := s.wstmt.Query(args...)
@@ -527,10 +617,13 @@ func (s *Stmt) Query(args ...interface{}) (*sql.Rows, error) {
 
 func (s *Stmt) QueryContext(ctx context.Context, args ...interface{}) (*sql.Rows, error) {
 	var err error
-	ctx, _, sender := common.BuildDBSpan(ctx, s.Builder, s.db.Stats(), "", args)
+	ctx, span, sender := common.BuildDBSpan(ctx, s.Builder, s.db.Stats(), "", args...)
 	defer func() {
 		sender(err)
 	}()
+	if span != nil {
+		s.countUse(span)
+	}
 
 	// do DB call
 	rows, err := s.wstmt.QueryContext(ctx, args...)
@@ -538,8 +631,9 @@ func (s *Stmt) QueryContext(ctx context.Context, args ...interface{}) (*sql.Rows
 }
 
 func (s *Stmt) QueryRow(args ...interface{}) *sql.Row {
-	_, sender := common.BuildDBEvent(s.Builder, s.db.Stats(), "", args)
+	ev, sender := common.BuildDBEvent(s.Builder, s.db.Stats(), "", args...)
 	defer sender(nil)
+	s.countUse(ev)
 
 	// do DB call
 	row := s.wstmt.QueryRow(args...)
@@ -547,8 +641,11 @@ func (s *Stmt) QueryRow(args ...interface{}) *sql.Row {
 }
 
 func (s *Stmt) QueryRowContext(ctx context.Context, args ...interface{}) *sql.Row {
-	ctx, _, sender := common.BuildDBSpan(ctx, s.Builder, s.db.Stats(), "", args)
+	ctx, span, sender := common.BuildDBSpan(ctx, s.Builder, s.db.Stats(), "", args...)
 	defer sender(nil)
+	if span != nil {
+		s.countUse(span)
+	}
 
 	// do DB call
 	row := s.wstmt.QueryRowContext(ctx, args...)
@@ -639,13 +736,16 @@ func (tx *Tx) Prepare(query string) (*Stmt, error) {
 	wrapStmt := &Stmt{
 		db:      tx.db,
 		Builder: bld,
+		id:      stmtid,
 	}
 	bld.AddField("db.stmtId", stmtid)
 	ev.AddField("db.stmtId", stmtid)
 	bld.AddField("db.query", query)
 
 	// do DB call
+	prepareTimer := timer.Start()
 	stmt, err := tx.wtx.Prepare(query)
+	bld.AddField("db.stmt_prepare_ms", prepareTimer.Finish())
 	wrapStmt.wstmt = stmt
 	return wrapStmt, err
 }
@@ -663,6 +763,7 @@ func (tx *Tx) PrepareContext(ctx context.Context, query string) (*Stmt, error) {
 	wrapStmt := &Stmt{
 		db:      tx.db,
 		Builder: bld,
+		id:      stmtid,
 	}
 	bld.AddField("db.stmtId", stmtid)
 	if span != nil {
@@ -671,14 +772,16 @@ func (tx *Tx) PrepareContext(ctx context.Context, query string) (*Stmt, error) {
 	bld.AddField("db.query", query)
 
 	// do DB call
+	prepareTimer := timer.Start()
 	stmt, err := tx.wtx.PrepareContext(ctx, query)
+	bld.AddField("db.stmt_prepare_ms", prepareTimer.Finish())
 	wrapStmt.wstmt = stmt
 	return wrapStmt, err
 }
 
 func (tx *Tx) Query(query string, args ...interface{}) (*sql.Rows, error) {
 	var err error
-	_, sender := common.BuildDBEvent(tx.Builder, tx.db.Stats(), query, args)
+	_, sender := common.BuildDBEvent(tx.Builder, tx.db.Stats(), query, args...)
 	defer func() {
 		sender(err)
 	}()
@@ -690,7 +793,7 @@ func (tx *Tx) Query(query string, args ...interface{}) (*sql.Rows, error) {
 
 func (tx *Tx) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
 	var err error
-	ctx, _, sender := common.BuildDBSpan(ctx, tx.Builder, tx.db.Stats(), query, args)
+	ctx, _, sender := common.BuildDBSpan(ctx, tx.Builder, tx.db.Stats(), query, args...)
 	defer func() {
 		sender(err)
 	}()
@@ -701,7 +804,7 @@ func (tx *Tx) QueryContext(ctx context.Context, query string, args ...interface{
 }
 
 func (tx *Tx) QueryRow(query string, args ...interface{}) *sql.Row {
-	_, sender := common.BuildDBEvent(tx.Builder, tx.db.Stats(), query, args)
+	_, sender := common.BuildDBEvent(tx.Builder, tx.db.Stats(), query, args...)
 	defer sender(nil)
 
 	// do DB call
@@ -710,7 +813,7 @@ func (tx *Tx) QueryRow(query string, args ...interface{}) *sql.Row {
 }
 
 func (tx *Tx) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
-	ctx, _, sender := common.BuildDBSpan(ctx, tx.Builder, tx.db.Stats(), query, args)
+	ctx, _, sender := common.BuildDBSpan(ctx, tx.Builder, tx.db.Stats(), query, args...)
 	defer sender(nil)
 
 	// do DB call
@@ -738,6 +841,7 @@ func (tx *Tx) Stmt(stmt *Stmt) *Stmt {
 	wrapStmt := &Stmt{
 		db:      tx.db,
 		Builder: bld,
+		id:      stmt.id,
 	}
 	// add the transaction's ID to the statement so that when it gets executed
 	// you get both
@@ -758,6 +862,7 @@ func (tx *Tx) StmtContext(ctx context.Context, stmt *Stmt) *Stmt {
 	wrapStmt := &Stmt{
 		db:      tx.db,
 		Builder: bld,
+		id:      stmt.id,
 	}
 	// add the transaction's ID to the statement so that when it gets executed
 	// you get both
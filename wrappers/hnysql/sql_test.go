@@ -3,12 +3,15 @@ package hnysql_test
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	_ "github.com/go-sql-driver/mysql"
+	"github.com/honeycombio/libhoney-go/transmission"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/honeycombio/beeline-go"
@@ -113,3 +116,140 @@ func TestSQLMiddleware(t *testing.T) {
 		t.Errorf("there were unfulfilled expectations: %s", err)
 	}
 }
+
+func TestPreparedStatements(t *testing.T) {
+	mo := &transmission.MockSender{}
+	beeline.Init(beeline.Config{Transmission: mo})
+	defer beeline.Close()
+
+	odb, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	prep := mock.ExpectPrepare("insert into flavors")
+	prep.ExpectExec().WithArgs("rose").WillReturnResult(sqlmock.NewResult(1, 1))
+	prep.ExpectExec().WithArgs("mint").WillReturnResult(sqlmock.NewResult(2, 1))
+	prep.WillBeClosed()
+	mock.ExpectClose()
+
+	db := hnysql.WrapDB(odb)
+	db.CacheStatements = true
+	db.PrepareSpans = true
+	ctx, span := beeline.StartSpan(context.Background(), "start")
+	for _, flavor := range []string{"rose", "mint"} {
+		_, err := db.ExecContext(ctx, "insert into flavors (flavor) values (?)", flavor)
+		assert.NoError(t, err)
+	}
+	stmt, err := db.PrepareContext(ctx, "insert into flavors (flavor) values (?)")
+	assert.NoError(t, err)
+	assert.NoError(t, stmt.Close(), "closing a cached statement should do nothing")
+	span.Send()
+	assert.NoError(t, db.Close())
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	events := mo.Events()
+	if assert.Len(t, events, 6) {
+		first, firstExec := events[0].Data, events[1].Data
+		assert.Equal(t, "PrepareContext", first["db.call"])
+		assert.Equal(t, false, first["db.stmt_cache_hit"])
+		assert.Equal(t, firstExec["trace.span_id"], first["trace.parent_id"], "preparing should be a child of the call")
+		assert.Equal(t, "ExecContext", firstExec["db.call"])
+		assert.Equal(t, int64(1), firstExec["db.stmt_uses"])
+		assert.Equal(t, first["db.stmtId"], firstExec["db.stmtId"])
+
+		second, secondExec := events[2].Data, events[3].Data
+		assert.Equal(t, true, second["db.stmt_cache_hit"])
+		assert.Equal(t, int64(2), secondExec["db.stmt_uses"])
+		assert.Equal(t, first["db.stmtId"], secondExec["db.stmtId"])
+
+		assert.Equal(t, true, events[4].Data["db.stmt_cache_hit"])
+	}
+}
+
+func TestCancelledQueries(t *testing.T) {
+	mo := &transmission.MockSender{}
+	beeline.Init(beeline.Config{Transmission: mo})
+	defer beeline.Close()
+
+	odb, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer odb.Close()
+	mock.ExpectQuery("select sleep").WillDelayFor(time.Second).WillReturnRows(sqlmock.NewRows([]string{"1"}))
+	mock.ExpectExec("insert into flavors").WillReturnError(errors.New("duplicate key"))
+
+	db := hnysql.WrapDB(odb)
+	ctx, span := beeline.StartSpan(context.Background(), "start")
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = db.QueryContext(timeout, "select sleep(1)")
+	assert.Error(t, err)
+	_, err = db.ExecContext(ctx, "insert into flavors (flavor) values ('rose')")
+	assert.Error(t, err)
+	span.Send()
+
+	events := mo.Events()
+	if assert.Len(t, events, 3) {
+		timedOut := events[0].Data
+		assert.Equal(t, true, timedOut["db.cancelled"])
+		assert.Equal(t, "deadline_exceeded", timedOut["db.cancel_reason"])
+		assert.Nil(t, timedOut["db.error"], "cancellations aren't database errors")
+		assert.InDelta(t, 10, timedOut["db.deadline_remaining_ms"], 5)
+
+		failed := events[1].Data
+		assert.Equal(t, "duplicate key", failed["db.error"])
+		assert.Nil(t, failed["db.cancelled"])
+		assert.Nil(t, failed["db.deadline_remaining_ms"])
+	}
+}
+
+func TestRows(t *testing.T) {
+	mo := &transmission.MockSender{}
+	beeline.Init(beeline.Config{Transmission: mo})
+	defer beeline.Close()
+
+	odb, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer odb.Close()
+	flavors := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"flavor"}).AddRow("rose").AddRow("mint").AddRow("fig")
+	}
+	mock.ExpectQuery("SELECT flavor FROM flavors").WillReturnRows(flavors())
+	mock.ExpectQuery("SELECT flavor FROM flavors").WillReturnRows(flavors())
+
+	db := hnysql.WrapDB(odb)
+	ctx, span := beeline.StartSpan(context.Background(), "start")
+	read := func() {
+		r, err := db.QueryContext(ctx, "SELECT flavor FROM flavors")
+		if !assert.NoError(t, err) {
+			return
+		}
+		rows := db.WrapRows(ctx, r)
+		defer rows.Close()
+		for rows.Next() {
+			var flavor string
+			assert.NoError(t, rows.Scan(&flavor))
+		}
+		assert.NoError(t, rows.Err())
+	}
+	read()
+	db.RowsSpanThreshold = time.Nanosecond
+	read()
+	span.Send()
+
+	events := mo.Events()
+	if assert.Len(t, events, 4) {
+		assert.Equal(t, "db.rows", events[2].Data["name"], "only reading past the threshold gets a span")
+		assert.Equal(t, 3, events[2].Data["db.rows_scanned"])
+		assert.Contains(t, events[2].Data, "db.rows_next_ms")
+		assert.Contains(t, events[2].Data, "db.rows_scan_ms")
+
+		root := events[3].Data
+		assert.Equal(t, 6.0, root["db.rows_scanned"], "both queries' rows are counted")
+		assert.Contains(t, root, "db.rows_next_ms")
+		assert.Contains(t, root, "db.rows_scan_ms")
+	}
+}
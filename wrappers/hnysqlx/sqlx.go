@@ -397,7 +397,12 @@ func (db *DB) NamedExec(query string, arg interface{}) (sql.Result, error) {
 	}
 
 	// do DB call
-	res, err := db.wdb.NamedExec(query, arg)
+	q, bound, err := db.wdb.BindNamed(query, arg)
+	addNamedFields(ev, arg, len(bound))
+	if err != nil {
+		return nil, err
+	}
+	res, err := db.wdb.Exec(q, bound...)
 
 	// capture results
 	if err == nil {
@@ -426,7 +431,14 @@ func (db *DB) NamedExecContext(ctx context.Context, query string, arg interface{
 	}
 
 	// do DB call
-	res, err := db.wdb.NamedExecContext(ctx, query, arg)
+	q, bound, err := db.wdb.BindNamed(query, arg)
+	if span != nil {
+		addNamedFields(span, arg, len(bound))
+	}
+	if err != nil {
+		return nil, err
+	}
+	res, err := db.wdb.ExecContext(ctx, q, bound...)
 
 	// capture results
 	if err == nil {
@@ -448,7 +460,7 @@ func (db *DB) NamedExecContext(ctx context.Context, query string, arg interface{
 
 func (db *DB) NamedQuery(query string, arg interface{}) (*sqlx.Rows, error) {
 	var err error
-	_, sender := common.BuildDBEvent(db.Builder, db.Stats(), query, arg)
+	ev, sender := common.BuildDBEvent(db.Builder, db.Stats(), query, arg)
 	defer func() {
 		sender(err)
 	}()
@@ -459,13 +471,18 @@ func (db *DB) NamedQuery(query string, arg interface{}) (*sqlx.Rows, error) {
 	}
 
 	// do DB call
-	rows, err := db.wdb.NamedQuery(query, arg)
+	q, bound, err := db.wdb.BindNamed(query, arg)
+	addNamedFields(ev, arg, len(bound))
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.wdb.Queryx(q, bound...)
 	return rows, err
 }
 
 func (db *DB) NamedQueryContext(ctx context.Context, query string, arg interface{}) (*sqlx.Rows, error) {
 	var err error
-	ctx, _, sender := common.BuildDBSpan(ctx, db.Builder, db.Stats(), query, arg)
+	ctx, span, sender := common.BuildDBSpan(ctx, db.Builder, db.Stats(), query, arg)
 	defer func() {
 		sender(err)
 	}()
@@ -476,7 +493,14 @@ func (db *DB) NamedQueryContext(ctx context.Context, query string, arg interface
 	}
 
 	// do DB call
-	rows, err := db.wdb.NamedQueryContext(ctx, query, arg)
+	q, bound, err := db.wdb.BindNamed(query, arg)
+	if span != nil {
+		addNamedFields(span, arg, len(bound))
+	}
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.wdb.QueryxContext(ctx, q, bound...)
 	return rows, err
 }
 
@@ -785,6 +809,25 @@ func (db *DB) Rebind(query string) string {
 	return str
 }
 
+// In expands the slice arguments of query, as sqlx.In does, and rebinds it
+// for the driver, returning the query and arguments to pass to Select, Exec
+// and the rest. The event records the number of arguments before and after
+// expansion in db.args_count and db.expanded_args_count.
+func (db *DB) In(query string, args ...interface{}) (string, []interface{}, error) {
+	var err error
+	ev, sender := common.BuildDBEvent(db.Builder, db.Stats(), query, args...)
+	defer func() {
+		sender(err)
+	}()
+
+	q, expanded, err := sqlx.In(query, args...)
+	if err != nil {
+		return "", nil, err
+	}
+	ev.AddField("db.expanded_args_count", len(expanded))
+	return db.wdb.Rebind(q), expanded, nil
+}
+
 func (db *DB) Select(dest interface{}, query string, args ...interface{}) error {
 	var err error
 	ev, sender := common.BuildDBEvent(db.Builder, db.Stats(), query, args...)
@@ -939,6 +982,7 @@ func (n *NamedStmt) Exec(arg interface{}) (sql.Result, error) {
 	defer func() {
 		sender(err)
 	}()
+	n.addNamedFields(ev, arg)
 
 	res, err := n.wns.Exec(arg)
 
@@ -962,6 +1006,9 @@ func (n *NamedStmt) ExecContext(ctx context.Context, arg interface{}) (sql.Resul
 	defer func() {
 		sender(err)
 	}()
+	if span != nil {
+		n.addNamedFields(span, arg)
+	}
 
 	res, err := n.wns.ExecContext(ctx, arg)
 
@@ -989,6 +1036,7 @@ func (n *NamedStmt) Get(dest interface{}, arg interface{}) error {
 	defer func() {
 		sender(err)
 	}()
+	n.addNamedFields(ev, arg)
 
 	// add the type of the objec being populated
 	ev.AddField("db.dest_type", typeof(dest))
@@ -1003,6 +1051,9 @@ func (n *NamedStmt) GetContext(ctx context.Context, dest interface{}, arg interf
 	defer func() {
 		sender(err)
 	}()
+	if span != nil {
+		n.addNamedFields(span, arg)
+	}
 
 	// add the type of the objec being populated
 	if span != nil {
@@ -1019,6 +1070,7 @@ func (n *NamedStmt) MustExec(arg interface{}) sql.Result {
 	defer func() {
 		sender(err)
 	}()
+	n.addNamedFields(ev, arg)
 
 	// do DB call
 	res, err := n.wns.Exec(arg)
@@ -1047,6 +1099,9 @@ func (n *NamedStmt) MustExecContext(ctx context.Context, arg interface{}) sql.Re
 	defer func() {
 		sender(err)
 	}()
+	if span != nil {
+		n.addNamedFields(span, arg)
+	}
 
 	// do DB call
 	res, err := n.wns.ExecContext(ctx, arg)
@@ -1077,10 +1132,11 @@ func (n *NamedStmt) MustExecContext(ctx context.Context, arg interface{}) sql.Re
 
 func (n *NamedStmt) Query(arg interface{}) (*sql.Rows, error) {
 	var err error
-	_, sender := common.BuildDBEvent(n.Builder, n.db.Stats(), "", arg)
+	ev, sender := common.BuildDBEvent(n.Builder, n.db.Stats(), "", arg)
 	defer func() {
 		sender(err)
 	}()
+	n.addNamedFields(ev, arg)
 
 	// do DB call
 	rows, err := n.wns.Query(arg)
@@ -1089,10 +1145,13 @@ func (n *NamedStmt) Query(arg interface{}) (*sql.Rows, error) {
 
 func (n *NamedStmt) QueryContext(ctx context.Context, arg interface{}) (*sql.Rows, error) {
 	var err error
-	ctx, _, sender := common.BuildDBSpan(ctx, n.Builder, n.db.Stats(), "", arg)
+	ctx, span, sender := common.BuildDBSpan(ctx, n.Builder, n.db.Stats(), "", arg)
 	defer func() {
 		sender(err)
 	}()
+	if span != nil {
+		n.addNamedFields(span, arg)
+	}
 
 	// do DB call
 	rows, err := n.wns.QueryContext(ctx, arg)
@@ -1101,10 +1160,11 @@ func (n *NamedStmt) QueryContext(ctx context.Context, arg interface{}) (*sql.Row
 
 func (n *NamedStmt) QueryRow(arg interface{}) *sqlx.Row {
 	var err error
-	_, sender := common.BuildDBEvent(n.Builder, n.db.Stats(), "", arg)
+	ev, sender := common.BuildDBEvent(n.Builder, n.db.Stats(), "", arg)
 	defer func() {
 		sender(err)
 	}()
+	n.addNamedFields(ev, arg)
 
 	// do DB call
 	row := n.wns.QueryRow(arg)
@@ -1113,10 +1173,13 @@ func (n *NamedStmt) QueryRow(arg interface{}) *sqlx.Row {
 
 func (n *NamedStmt) QueryRowContext(ctx context.Context, arg interface{}) *sqlx.Row {
 	var err error
-	ctx, _, sender := common.BuildDBSpan(ctx, n.Builder, n.db.Stats(), "", arg)
+	ctx, span, sender := common.BuildDBSpan(ctx, n.Builder, n.db.Stats(), "", arg)
 	defer func() {
 		sender(err)
 	}()
+	if span != nil {
+		n.addNamedFields(span, arg)
+	}
 
 	// do DB call
 	row := n.wns.QueryRowContext(ctx, arg)
@@ -1125,10 +1188,11 @@ func (n *NamedStmt) QueryRowContext(ctx context.Context, arg interface{}) *sqlx.
 
 func (n *NamedStmt) QueryRowx(arg interface{}) *sqlx.Row {
 	var err error
-	_, sender := common.BuildDBEvent(n.Builder, n.db.Stats(), "", arg)
+	ev, sender := common.BuildDBEvent(n.Builder, n.db.Stats(), "", arg)
 	defer func() {
 		sender(err)
 	}()
+	n.addNamedFields(ev, arg)
 
 	// do DB call
 	row := n.wns.QueryRowx(arg)
@@ -1137,10 +1201,13 @@ func (n *NamedStmt) QueryRowx(arg interface{}) *sqlx.Row {
 
 func (n *NamedStmt) QueryRowxContext(ctx context.Context, arg interface{}) *sqlx.Row {
 	var err error
-	ctx, _, sender := common.BuildDBSpan(ctx, n.Builder, n.db.Stats(), "", arg)
+	ctx, span, sender := common.BuildDBSpan(ctx, n.Builder, n.db.Stats(), "", arg)
 	defer func() {
 		sender(err)
 	}()
+	if span != nil {
+		n.addNamedFields(span, arg)
+	}
 
 	// do DB call
 	row := n.wns.QueryRowxContext(ctx, arg)
@@ -1149,10 +1216,11 @@ func (n *NamedStmt) QueryRowxContext(ctx context.Context, arg interface{}) *sqlx
 
 func (n *NamedStmt) Queryx(arg interface{}) (*sqlx.Rows, error) {
 	var err error
-	_, sender := common.BuildDBEvent(n.Builder, n.db.Stats(), "", arg)
+	ev, sender := common.BuildDBEvent(n.Builder, n.db.Stats(), "", arg)
 	defer func() {
 		sender(err)
 	}()
+	n.addNamedFields(ev, arg)
 
 	// do DB call
 	rows, err := n.wns.Queryx(arg)
@@ -1161,10 +1229,13 @@ func (n *NamedStmt) Queryx(arg interface{}) (*sqlx.Rows, error) {
 
 func (n *NamedStmt) QueryxContext(ctx context.Context, arg interface{}) (*sqlx.Rows, error) {
 	var err error
-	ctx, _, sender := common.BuildDBSpan(ctx, n.Builder, n.db.Stats(), "", arg)
+	ctx, span, sender := common.BuildDBSpan(ctx, n.Builder, n.db.Stats(), "", arg)
 	defer func() {
 		sender(err)
 	}()
+	if span != nil {
+		n.addNamedFields(span, arg)
+	}
 
 	// do DB call
 	rows, err := n.wns.QueryxContext(ctx, arg)
@@ -1177,6 +1248,7 @@ func (n *NamedStmt) Select(dest interface{}, arg interface{}) error {
 	defer func() {
 		sender(err)
 	}()
+	n.addNamedFields(ev, arg)
 
 	ev.AddField("db.dest_type", typeof(dest))
 
@@ -1191,6 +1263,9 @@ func (n *NamedStmt) SelectContext(ctx context.Context, dest interface{}, arg int
 	defer func() {
 		sender(err)
 	}()
+	if span != nil {
+		n.addNamedFields(span, arg)
+	}
 
 	if span != nil {
 		span.AddField("db.dest_type", typeof(dest))
@@ -1479,7 +1554,7 @@ func (tx *Tx) GetWrappedTx() *sqlx.Tx {
 
 func (tx *Tx) BindNamed(query string, arg interface{}) (string, []interface{}, error) {
 	var err error
-	_, sender := common.BuildDBEvent(tx.Builder, tx.db.Stats(), query, arg)
+	ev, sender := common.BuildDBEvent(tx.Builder, tx.db.Stats(), query, arg)
 	defer func() {
 		sender(err)
 	}()
@@ -1490,6 +1565,7 @@ func (tx *Tx) BindNamed(query string, arg interface{}) (string, []interface{}, e
 	}
 
 	str, i, err := tx.wtx.BindNamed(query, arg)
+	addNamedFields(ev, arg, len(i))
 	return str, i, err
 }
 
@@ -1731,7 +1807,12 @@ func (tx *Tx) NamedExec(query string, arg interface{}) (sql.Result, error) {
 	}
 
 	// do DB call
-	res, err := tx.wtx.NamedExec(query, arg)
+	q, bound, err := tx.wtx.BindNamed(query, arg)
+	addNamedFields(ev, arg, len(bound))
+	if err != nil {
+		return nil, err
+	}
+	res, err := tx.wtx.Exec(q, bound...)
 
 	// capture results
 	if err == nil {
@@ -1760,7 +1841,14 @@ func (tx *Tx) NamedExecContext(ctx context.Context, query string, arg interface{
 	}
 
 	// do DB call
-	res, err := tx.wtx.NamedExecContext(ctx, query, arg)
+	q, bound, err := tx.wtx.BindNamed(query, arg)
+	if span != nil {
+		addNamedFields(span, arg, len(bound))
+	}
+	if err != nil {
+		return nil, err
+	}
+	res, err := tx.wtx.ExecContext(ctx, q, bound...)
 
 	// capture results
 	if err == nil {
@@ -1782,7 +1870,7 @@ func (tx *Tx) NamedExecContext(ctx context.Context, query string, arg interface{
 
 func (tx *Tx) NamedQuery(query string, arg interface{}) (*sqlx.Rows, error) {
 	var err error
-	_, sender := common.BuildDBEvent(tx.Builder, tx.db.Stats(), query, arg)
+	ev, sender := common.BuildDBEvent(tx.Builder, tx.db.Stats(), query, arg)
 	defer func() {
 		sender(err)
 	}()
@@ -1793,13 +1881,18 @@ func (tx *Tx) NamedQuery(query string, arg interface{}) (*sqlx.Rows, error) {
 	}
 
 	// do DB call
-	rows, err := tx.wtx.NamedQuery(query, arg)
+	q, bound, err := tx.wtx.BindNamed(query, arg)
+	addNamedFields(ev, arg, len(bound))
+	if err != nil {
+		return nil, err
+	}
+	rows, err := tx.wtx.Queryx(q, bound...)
 	return rows, err
 }
 
 func (tx *Tx) NamedQueryContext(ctx context.Context, query string, arg interface{}) (*sqlx.Rows, error) {
 	var err error
-	ctx, _, sender := common.BuildDBSpan(ctx, tx.Builder, tx.db.Stats(), query, arg)
+	ctx, span, sender := common.BuildDBSpan(ctx, tx.Builder, tx.db.Stats(), query, arg)
 	defer func() {
 		sender(err)
 	}()
@@ -1809,8 +1902,15 @@ func (tx *Tx) NamedQueryContext(ctx context.Context, query string, arg interface
 		tx.wtx.Mapper = tx.Mapper
 	}
 
-	// do DB call - sqlx doesn't have a NamedQueryContext on a transaction.
-	rows, err := tx.wtx.NamedQuery(query, arg)
+	// do DB call
+	q, bound, err := tx.wtx.BindNamed(query, arg)
+	if span != nil {
+		addNamedFields(span, arg, len(bound))
+	}
+	if err != nil {
+		return nil, err
+	}
+	rows, err := tx.wtx.QueryxContext(ctx, q, bound...)
 	return rows, err
 }
 
@@ -2132,6 +2232,25 @@ func (tx *Tx) Rebind(query string) string {
 	return str
 }
 
+// In expands the slice arguments of query, as sqlx.In does, and rebinds it
+// for the driver, returning the query and arguments to pass to Select, Exec
+// and the rest. The event records the number of arguments before and after
+// expansion in db.args_count and db.expanded_args_count.
+func (tx *Tx) In(query string, args ...interface{}) (string, []interface{}, error) {
+	var err error
+	ev, sender := common.BuildDBEvent(tx.Builder, tx.db.Stats(), query, args...)
+	defer func() {
+		sender(err)
+	}()
+
+	q, expanded, err := sqlx.In(query, args...)
+	if err != nil {
+		return "", nil, err
+	}
+	ev.AddField("db.expanded_args_count", len(expanded))
+	return tx.wtx.Rebind(q), expanded, nil
+}
+
 func (tx *Tx) Rollback() error {
 	var err error
 	_, sender := common.BuildDBEvent(tx.Builder, tx.db.Stats(), "")
@@ -2283,6 +2402,23 @@ func (tx *Tx) Unsafe() *Tx {
 	return tx
 }
 
+// fieldAdder is implemented by both *libhoney.Event and *trace.Span.
+type fieldAdder interface {
+	AddField(key string, val interface{})
+}
+
+// addNamedFields adds the type of the argument to a named query and the
+// number of parameters bound from it.
+func addNamedFields(f fieldAdder, arg interface{}, params int) {
+	f.AddField("db.arg_type", typeof(arg))
+	f.AddField("db.args_count", params)
+}
+
+// addNamedFields adds the fields for arg, an argument to the statement.
+func (n *NamedStmt) addNamedFields(f fieldAdder, arg interface{}) {
+	addNamedFields(f, arg, len(n.wns.Params))
+}
+
 // additional helper functions
 func typeof(i interface{}) string {
 	t := reflect.TypeOf(i)
@@ -9,6 +9,7 @@ import (
 	"github.com/DATA-DOG/go-sqlmock"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/jmoiron/sqlx"
+	"github.com/honeycombio/libhoney-go/transmission"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/honeycombio/beeline-go"
@@ -111,3 +112,48 @@ func TestSQLXMiddleware(t *testing.T) {
 		t.Errorf("there were unfulfilled expectations: %s", err)
 	}
 }
+
+func TestNamedAndInQueries(t *testing.T) {
+	mo := &transmission.MockSender{}
+	beeline.Init(beeline.Config{Transmission: mo})
+	defer beeline.Close()
+
+	odb, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer odb.Close()
+	db := hnysqlx.WrapDB(sqlx.NewDb(odb, "mysql"))
+
+	type flavor struct {
+		Name  string `db:"name"`
+		Price int    `db:"price"`
+	}
+	mock.ExpectExec("insert into flavors").WithArgs("rose", 3).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery("select name from flavors where name in").WithArgs("rose", "mint").
+		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("rose"))
+
+	ctx, span := beeline.StartSpan(context.Background(), "start")
+	_, err = db.NamedExecContext(ctx, "insert into flavors (name, price) values (:name, :price)", flavor{"rose", 3})
+	assert.NoError(t, err)
+	query, args, err := db.In("select name from flavors where name in (?)", []string{"rose", "mint"})
+	assert.NoError(t, err)
+	var names []string
+	assert.NoError(t, db.SelectContext(ctx, &names, query, args...))
+	assert.Equal(t, []string{"rose"}, names)
+	span.Send()
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// In has no context, so its event isn't part of the trace
+	events := mo.Events()
+	if assert.Len(t, events, 3) {
+		named := events[0].Data
+		assert.Equal(t, "NamedExecContext", named["db.call"])
+		assert.Equal(t, "hnysqlx_test.flavor", named["db.arg_type"])
+		assert.Equal(t, 2, named["db.args_count"])
+		sel := events[1].Data
+		assert.Equal(t, "SelectContext", sel["db.call"])
+		assert.Equal(t, 2, sel["db.args_count"])
+		assert.Equal(t, "*[]string", sel["db.dest_type"])
+	}
+}
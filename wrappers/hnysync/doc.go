@@ -0,0 +1,21 @@
+/*
+Package hnysync records lock and singleflight contention in traces.
+
+Summary
+
+Time spent waiting for a lock, or for another goroutine's singleflight call,
+shows up in CPU and block profiles but not in traces, where it is folded into
+whatever span was waiting. The Mutex, RWMutex and Group here work like their
+sync and singleflight counterparts, and their context-taking methods add the
+time waited to the span in ctx as the rollup fields lock.wait_ms and
+singleflight.wait_ms. Waits longer than the Threshold also get a
+lock_contention or singleflight_wait span event, so hotspots can be found by
+the lock's Name:
+
+	var cacheLock = hnysync.Mutex{Name: "cache"}
+
+	cacheLock.LockContext(ctx)
+	defer cacheLock.Unlock()
+
+*/
+package hnysync
@@ -0,0 +1,151 @@
+package hnysync
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"github.com/honeycombio/beeline-go/trace"
+)
+
+// DefaultThreshold is the wait that gets a span event when Threshold isn't
+// set. Uncontended locks are taken in nanoseconds, so waits this long mean
+// another goroutine held the lock.
+const DefaultThreshold = time.Millisecond
+
+// Mutex is a sync.Mutex that records the time LockContext waits for it.
+type Mutex struct {
+	// Name identifies the lock in lock.name.
+	Name string
+	// Threshold is the shortest wait that gets a lock_contention span
+	// event. default: DefaultThreshold
+	Threshold time.Duration
+
+	mu sync.Mutex
+}
+
+// Lock locks m without recording the wait, so a Mutex can be used as a
+// sync.Locker.
+func (m *Mutex) Lock() { m.mu.Lock() }
+
+// Unlock unlocks m.
+func (m *Mutex) Unlock() { m.mu.Unlock() }
+
+// LockContext locks m, recording how long it waited in the span in ctx.
+func (m *Mutex) LockContext(ctx context.Context) {
+	start := time.Now()
+	m.mu.Lock()
+	recordWait(ctx, lockWait, m.Name, "lock.mode", "lock", time.Since(start), m.Threshold)
+}
+
+// RWMutex is a sync.RWMutex that records the time LockContext and
+// RLockContext wait for it.
+type RWMutex struct {
+	// Name identifies the lock in lock.name.
+	Name string
+	// Threshold is the shortest wait that gets a lock_contention span
+	// event. default: DefaultThreshold
+	Threshold time.Duration
+
+	mu sync.RWMutex
+}
+
+// Lock locks rw for writing without recording the wait.
+func (rw *RWMutex) Lock() { rw.mu.Lock() }
+
+// Unlock unlocks rw for writing.
+func (rw *RWMutex) Unlock() { rw.mu.Unlock() }
+
+// RLock locks rw for reading without recording the wait.
+func (rw *RWMutex) RLock() { rw.mu.RLock() }
+
+// RUnlock undoes a single RLock or RLockContext.
+func (rw *RWMutex) RUnlock() { rw.mu.RUnlock() }
+
+// RLocker returns a sync.Locker that read-locks rw.
+func (rw *RWMutex) RLocker() sync.Locker { return rw.mu.RLocker() }
+
+// LockContext locks rw for writing, recording how long it waited in the
+// span in ctx.
+func (rw *RWMutex) LockContext(ctx context.Context) {
+	start := time.Now()
+	rw.mu.Lock()
+	recordWait(ctx, lockWait, rw.Name, "lock.mode", "write", time.Since(start), rw.Threshold)
+}
+
+// RLockContext locks rw for reading, recording how long it waited in the
+// span in ctx.
+func (rw *RWMutex) RLockContext(ctx context.Context) {
+	start := time.Now()
+	rw.mu.RLock()
+	recordWait(ctx, lockWait, rw.Name, "lock.mode", "read", time.Since(start), rw.Threshold)
+}
+
+// Group is a singleflight.Group that records the time callers wait for a
+// call made by another caller.
+type Group struct {
+	// Name identifies the group in singleflight.name.
+	Name string
+	// Threshold is the shortest wait for a shared call that gets a
+	// singleflight_wait span event. default: DefaultThreshold
+	Threshold time.Duration
+
+	g singleflight.Group
+}
+
+// Do calls fn for key, like singleflight.Group's Do, unless a call for key
+// is already in flight, in which case it waits for that call's result. The
+// wait is recorded in the span in ctx.
+func (g *Group) Do(ctx context.Context, key string, fn func() (interface{}, error)) (v interface{}, err error, shared bool) {
+	start := time.Now()
+	called := false
+	v, err, shared = g.g.Do(key, func() (interface{}, error) {
+		called = true
+		return fn()
+	})
+	if shared && !called {
+		recordWait(ctx, singleflightWait, g.Name, "singleflight.key", key, time.Since(start), g.Threshold)
+	}
+	return v, err, shared
+}
+
+// Forget tells the group to forget about key, like singleflight.Group's
+// Forget.
+func (g *Group) Forget(key string) { g.g.Forget(key) }
+
+// waitKind names the event and fields recordWait sends for a kind of wait.
+type waitKind struct {
+	event   string
+	nameKey string
+	waitKey string
+}
+
+var (
+	lockWait         = waitKind{"lock_contention", "lock.name", "lock.wait_ms"}
+	singleflightWait = waitKind{"singleflight_wait", "singleflight.name", "singleflight.wait_ms"}
+)
+
+// recordWait adds a wait to the span in ctx as the rollup field kind.waitKey,
+// and sends a kind.event event if it was longer than threshold, with the
+// lock's mode or the singleflight call's key in the detailKey field.
+func recordWait(ctx context.Context, kind waitKind, name, detailKey, detail string, wait, threshold time.Duration) {
+	span := trace.GetSpanFromContext(ctx)
+	if span == nil {
+		return
+	}
+	ms := float64(wait) / float64(time.Millisecond)
+	span.AddRollupField(kind.waitKey, ms)
+	if threshold <= 0 {
+		threshold = DefaultThreshold
+	}
+	if wait < threshold {
+		return
+	}
+	span.SendSpanEvent(kind.event, map[string]interface{}{
+		kind.nameKey: name,
+		detailKey:    detail,
+		kind.waitKey: ms,
+	})
+}
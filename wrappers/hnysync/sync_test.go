@@ -0,0 +1,94 @@
+package hnysync
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	beeline "github.com/honeycombio/beeline-go"
+	"github.com/honeycombio/libhoney-go/transmission"
+)
+
+func TestMutex(t *testing.T) {
+	mo := &transmission.MockSender{}
+	beeline.Init(beeline.Config{Transmission: mo})
+	defer beeline.Close()
+
+	m := &Mutex{Name: "cache", Threshold: 5 * time.Millisecond}
+	ctx, span := beeline.StartSpan(context.Background(), "handler")
+	m.LockContext(ctx)
+	m.Unlock()
+
+	m.Lock()
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		m.Unlock()
+	}()
+	m.LockContext(ctx)
+	m.Unlock()
+
+	rw := &RWMutex{Name: "config"}
+	rw.RLockContext(ctx)
+	rw.RUnlock()
+	span.Send()
+
+	events := mo.Events()
+	if !assert.Len(t, events, 2, "only the contended wait gets an event") {
+		return
+	}
+	contention := events[0].Data
+	assert.Equal(t, "lock_contention", contention["name"])
+	assert.Equal(t, "cache", contention["lock.name"])
+	assert.Equal(t, "lock", contention["lock.mode"])
+	assert.True(t, contention["lock.wait_ms"].(float64) >= 15)
+	assert.True(t, events[1].Data["lock.wait_ms"].(float64) >= 15, "every wait is rolled up")
+}
+
+func TestGroup(t *testing.T) {
+	mo := &transmission.MockSender{}
+	beeline.Init(beeline.Config{Transmission: mo})
+	defer beeline.Close()
+
+	g := &Group{Name: "users"}
+	ctx, span := beeline.StartSpan(context.Background(), "handler")
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		g.Do(context.Background(), "user:42", func() (interface{}, error) {
+			close(started)
+			<-release
+			return "rose", nil
+		})
+	}()
+	<-started
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		close(release)
+	}()
+	v, err, shared := g.Do(ctx, "user:42", func() (interface{}, error) {
+		t.Error("the call in flight should be shared")
+		return nil, nil
+	})
+	wg.Wait()
+	assert.Equal(t, "rose", v)
+	assert.NoError(t, err)
+	assert.True(t, shared)
+
+	v, _, _ = g.Do(ctx, "user:43", func() (interface{}, error) { return "mint", nil })
+	assert.Equal(t, "mint", v)
+	span.Send()
+
+	events := mo.Events()
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, "singleflight_wait", events[0].Data["name"])
+		assert.Equal(t, "users", events[0].Data["singleflight.name"])
+		assert.Equal(t, "user:42", events[0].Data["singleflight.key"])
+		assert.Contains(t, events[1].Data, "singleflight.wait_ms")
+	}
+}
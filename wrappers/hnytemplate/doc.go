@@ -0,0 +1,14 @@
+/*
+Package hnytemplate times template rendering in its own span.
+
+Summary
+
+Rendering a page's template can take a good part of a handler's time, but
+without a span of its own it is folded into the handler's. Execute and
+ExecuteTemplate render html/template and text/template templates in a child
+of the span in ctx, recording the template's name and the size of its output:
+
+	err := hnytemplate.ExecuteTemplate(r.Context(), tmpl, w, "index.html", page)
+
+*/
+package hnytemplate
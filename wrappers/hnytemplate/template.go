@@ -0,0 +1,56 @@
+package hnytemplate
+
+import (
+	"context"
+	"io"
+
+	beeline "github.com/honeycombio/beeline-go"
+)
+
+// Template is implemented by both *html/template.Template and
+// *text/template.Template.
+type Template interface {
+	Name() string
+	Execute(w io.Writer, data interface{}) error
+	ExecuteTemplate(w io.Writer, name string, data interface{}) error
+}
+
+// Execute renders t with data to w in a span named template.execute.
+func Execute(ctx context.Context, t Template, w io.Writer, data interface{}) error {
+	return render(ctx, t.Name(), w, func(w io.Writer) error {
+		return t.Execute(w, data)
+	})
+}
+
+// ExecuteTemplate renders the template associated with t that has the given
+// name with data to w in a span named template.execute.
+func ExecuteTemplate(ctx context.Context, t Template, w io.Writer, name string, data interface{}) error {
+	return render(ctx, name, w, func(w io.Writer) error {
+		return t.ExecuteTemplate(w, name, data)
+	})
+}
+
+func render(ctx context.Context, name string, w io.Writer, execute func(io.Writer) error) error {
+	_, span := beeline.StartSpan(ctx, "template.execute")
+	defer span.Send()
+	span.AddField("template.name", name)
+	cw := &countingWriter{w: w}
+	err := execute(cw)
+	span.AddField("template.output_bytes", cw.n)
+	if err != nil {
+		span.AddField("template.error", err.Error())
+	}
+	return err
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,48 @@
+package hnytemplate
+
+import (
+	"bytes"
+	"context"
+	htmltemplate "html/template"
+	"testing"
+	texttemplate "text/template"
+
+	"github.com/stretchr/testify/assert"
+
+	beeline "github.com/honeycombio/beeline-go"
+	"github.com/honeycombio/libhoney-go/transmission"
+)
+
+func TestExecute(t *testing.T) {
+	mo := &transmission.MockSender{}
+	beeline.Init(beeline.Config{Transmission: mo})
+	defer beeline.Close()
+
+	html := htmltemplate.Must(htmltemplate.New("page").Parse(`<p>{{.}}</p>`))
+	htmltemplate.Must(html.New("broken").Parse(`{{.Missing}}`))
+	text := texttemplate.Must(texttemplate.New("greeting").Parse(`hello {{.}}`))
+
+	ctx, span := beeline.StartSpan(context.Background(), "handler")
+	var buf bytes.Buffer
+	assert.NoError(t, Execute(ctx, html, &buf, "<rose>"))
+	assert.Equal(t, "<p>&lt;rose&gt;</p>", buf.String())
+	assert.NoError(t, Execute(ctx, text, &bytes.Buffer{}, "mint"))
+	assert.Error(t, ExecuteTemplate(ctx, html, &bytes.Buffer{}, "broken", "fig"))
+	span.Send()
+
+	events := mo.Events()
+	if !assert.Len(t, events, 4) {
+		return
+	}
+	for _, ev := range events[:3] {
+		assert.Equal(t, "template.execute", ev.Data["name"])
+		assert.Equal(t, events[3].Data["trace.span_id"], ev.Data["trace.parent_id"])
+	}
+	assert.Equal(t, "page", events[0].Data["template.name"])
+	assert.Equal(t, int64(len(buf.String())), events[0].Data["template.output_bytes"])
+	assert.Equal(t, "greeting", events[1].Data["template.name"])
+	assert.Equal(t, int64(len("hello mint")), events[1].Data["template.output_bytes"])
+	assert.Equal(t, "broken", events[2].Data["template.name"])
+	assert.Contains(t, events[2].Data["template.error"], "Missing")
+	assert.Nil(t, events[0].Data["template.error"])
+}
@@ -0,0 +1,23 @@
+/*
+Package hnyzap connects zap loggers to Honeycomb traces.
+
+Summary
+
+zap loggers don't see a context, so there are two ways to tie log entries to
+the span that was active when they were logged.
+
+Annotate a logger once per request with Logger, which adds the trace.trace_id
+and trace.span_id of the span in ctx:
+
+	log := hnyzap.Logger(ctx, baseLogger)
+	log.Info("charging card")
+
+Or wrap the logger's core with NewCore and pass the context as a field with
+Context. The core replaces that field with the span's IDs, and without the
+core the field is ignored:
+
+	logger := zap.New(hnyzap.NewCore(core))
+	logger.Info("charging card", hnyzap.Context(ctx))
+
+*/
+package hnyzap
@@ -0,0 +1,91 @@
+package hnyzap
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/honeycombio/beeline-go/trace"
+)
+
+// contextKey names the fields created by Context.
+const contextKey = "hnyzap.context"
+
+// Fields returns the trace.trace_id and trace.span_id of the span in ctx, or
+// nil if there is none.
+func Fields(ctx context.Context) []zap.Field {
+	span := trace.GetSpanFromContext(ctx)
+	if span == nil {
+		return nil
+	}
+	return []zap.Field{
+		zap.String("trace.trace_id", span.GetTrace().GetTraceID()),
+		zap.String("trace.span_id", span.GetSpanID()),
+	}
+}
+
+// Logger returns l annotated with the IDs of the span in ctx.
+func Logger(ctx context.Context, l *zap.Logger) *zap.Logger {
+	fields := Fields(ctx)
+	if fields == nil {
+		return l
+	}
+	return l.With(fields...)
+}
+
+// Context returns a field carrying ctx, which a core created by NewCore
+// replaces with the IDs of the span in ctx. Other cores skip it.
+func Context(ctx context.Context) zap.Field {
+	return zap.Field{Key: contextKey, Type: zapcore.SkipType, Interface: ctx}
+}
+
+// NewCore wraps core so that fields created by Context are replaced with the
+// IDs of the span in their context.
+func NewCore(core zapcore.Core) zapcore.Core {
+	return &contextCore{Core: core}
+}
+
+type contextCore struct {
+	zapcore.Core
+}
+
+func (c *contextCore) With(fields []zap.Field) zapcore.Core {
+	return &contextCore{Core: c.Core.With(expand(fields))}
+}
+
+func (c *contextCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *contextCore) Write(ent zapcore.Entry, fields []zap.Field) error {
+	return c.Core.Write(ent, expand(fields))
+}
+
+// expand replaces the fields created by Context with span IDs.
+func expand(fields []zap.Field) []zap.Field {
+	var found bool
+	for _, f := range fields {
+		if f.Key == contextKey && f.Type == zapcore.SkipType {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fields
+	}
+	expanded := make([]zap.Field, 0, len(fields)+1)
+	for _, f := range fields {
+		if f.Key != contextKey || f.Type != zapcore.SkipType {
+			expanded = append(expanded, f)
+			continue
+		}
+		if ctx, ok := f.Interface.(context.Context); ok {
+			expanded = append(expanded, Fields(ctx)...)
+		}
+	}
+	return expanded
+}
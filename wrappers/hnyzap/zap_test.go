@@ -0,0 +1,46 @@
+package hnyzap
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/honeycombio/beeline-go/trace"
+)
+
+func TestLogger(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	ctx, tr := trace.NewTrace(context.Background(), "")
+	Logger(ctx, zap.New(core)).Info("charging card")
+	Logger(context.Background(), zap.New(core)).Info("no span")
+
+	entries := logs.All()
+	assert.Equal(t, map[string]interface{}{
+		"trace.trace_id": tr.GetTraceID(),
+		"trace.span_id":  tr.GetRootSpan().GetSpanID(),
+	}, entries[0].ContextMap())
+	assert.Empty(t, entries[1].ContextMap(), "loggers without a span should be left alone")
+}
+
+func TestCore(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	ctx, tr := trace.NewTrace(context.Background(), "")
+	logger := zap.New(NewCore(core))
+	logger.Info("charging card", Context(ctx), zap.Int("cents", 500))
+	logger.With(Context(ctx)).Info("declined")
+	zap.New(core).Info("plain", Context(ctx))
+
+	entries := logs.All()
+	for _, ent := range entries[:2] {
+		fields := ent.ContextMap()
+		assert.Equal(t, tr.GetTraceID(), fields["trace.trace_id"], ent.Message)
+		assert.Equal(t, tr.GetRootSpan().GetSpanID(), fields["trace.span_id"], ent.Message)
+		assert.NotContains(t, fields, contextKey)
+	}
+	assert.Equal(t, int64(500), entries[0].ContextMap()["cents"])
+	assert.Empty(t, entries[2].ContextMap(), "other cores should skip the context field")
+}